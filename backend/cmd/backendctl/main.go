@@ -0,0 +1,447 @@
+// Command backendctl runs maintenance tasks against the archives the server
+// is configured for, reading the same environment (DATABASE_URL,
+// ARCHIVES_CONFIG, STORAGE_BACKEND, ...), so operators don't need to call
+// the admin API.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/epstein-files/backend/internal/config"
+	"github.com/epstein-files/backend/internal/database"
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/pgmigrate"
+	"github.com/epstein-files/backend/internal/repository"
+	"github.com/epstein-files/backend/internal/storage"
+	"github.com/epstein-files/backend/internal/verify"
+)
+
+const usage = `Usage: backendctl [-archive id] <command> [flags]
+
+Commands:
+  migrate                      create or update the database schema
+  ingest [args]                run scripts/populate_db.py against the archive's database
+  reindex [-optimize]          rebuild the full-text index, or only merge its segments
+  create-api-key <kind> [name] generate an admin, sync or contributor token
+  backup <path>                write a consistent copy of the database to path
+  verify [-percent p] [-wait]  queue an integrity check of a sample of PDFs for the server
+  verify <document-id>...      re-hash the given documents' PDFs now
+  stats                        print the archive overview as JSON
+  migrate-db -to postgres -dsn url [-batch n]
+                               copy the archive's database into Postgres, resuming an interrupted copy
+
+Without -archive, migrate and stats cover every archive; the other commands
+need -archive when more than one is configured.
+`
+
+// Which archives a command runs against
+const (
+	oneArchive = iota
+	allArchives
+	noArchive
+)
+
+type command struct {
+	scope int
+	run   func(c *cmdContext, args []string) error
+}
+
+var commands = map[string]command{
+	"migrate":        {allArchives, migrate},
+	"ingest":         {oneArchive, ingest},
+	"reindex":        {oneArchive, reindex},
+	"create-api-key": {noArchive, createAPIKey},
+	"backup":         {oneArchive, backup},
+	"verify":         {oneArchive, verifyFiles},
+	"stats":          {allArchives, stats},
+	"migrate-db":     {oneArchive, migrateDB},
+}
+
+// cmdContext is what a command gets for one archive
+type cmdContext struct {
+	ctx     context.Context
+	cfg     *config.Config
+	archive config.Archive
+	scripts string
+}
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	archiveID := flag.String("archive", "", "archive ID from ARCHIVES_CONFIG")
+	scripts := flag.String("scripts", "", "directory of the Python ingest scripts (default $FILES_DIR/scripts)")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	name, args := flag.Arg(0), flag.Args()[1:]
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "backendctl: unknown command %q\n\n", name)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg := config.Load()
+	if *scripts == "" {
+		*scripts = filepath.Join(cfg.FilesDir, "scripts")
+	}
+	if cmd.scope == noArchive {
+		if err := cmd.run(&cmdContext{ctx: context.Background(), cfg: cfg, scripts: *scripts}, args); err != nil {
+			log.Fatalf("backendctl %s: %v", name, err)
+		}
+		return
+	}
+
+	archives, err := config.LoadArchives(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load archives: %v", err)
+	}
+	selected, err := selectArchives(archives, *archiveID, cmd.scope == allArchives)
+	if err != nil {
+		log.Fatalf("backendctl %s: %v", name, err)
+	}
+
+	for _, a := range selected {
+		// Same per-archive settings as the server
+		archiveCfg := *cfg
+		archiveCfg.ArchiveID = a.ID
+		archiveCfg.DatabaseURL = a.DatabaseURL
+		archiveCfg.FilesDir = a.FilesDir
+		archiveCfg.StorageBaseURL = a.StorageBaseURL
+		archiveCfg.ColdStorageDir = a.ColdStorageDir
+
+		c := &cmdContext{ctx: context.Background(), cfg: &archiveCfg, archive: a, scripts: *scripts}
+		if err := cmd.run(c, args); err != nil {
+			log.Fatalf("backendctl %s (archive %s): %v", name, a.ID, err)
+		}
+	}
+}
+
+func selectArchives(archives []config.Archive, id string, all bool) ([]config.Archive, error) {
+	if id != "" {
+		for _, a := range archives {
+			if a.ID == id {
+				return []config.Archive{a}, nil
+			}
+		}
+		return nil, fmt.Errorf("no archive %q", id)
+	}
+	if !all && len(archives) > 1 {
+		return nil, fmt.Errorf("%d archives configured, pick one with -archive", len(archives))
+	}
+	return archives, nil
+}
+
+// openRepo connects to the archive's database. Commands that change data
+// migrate first, as the server would on startup.
+func (c *cmdContext) openRepo(migrate bool) (*repository.Repository, error) {
+	db, err := database.Open(c.archive.DatabaseURL, c.cfg.BusyTimeout(), c.cfg.ForeignKeys)
+	if err != nil {
+		return nil, fmt.Errorf("connect to database: %w", err)
+	}
+	if migrate {
+		if err := database.Migrate(db, c.cfg); err != nil {
+			return nil, err
+		}
+	}
+	return repository.New(db).WithContext(c.ctx), nil
+}
+
+// ============================================================================
+// COMMANDS
+// ============================================================================
+
+func migrate(c *cmdContext, args []string) error {
+	if _, err := c.openRepo(true); err != nil {
+		return err
+	}
+	log.Printf("Archive %s: %s is up to date", c.archive.ID, c.archive.DatabaseURL)
+	return nil
+}
+
+// ingest passes its arguments on to populate_db.py, e.g. "backfill-hashes"
+func ingest(c *cmdContext, args []string) error {
+	repo, err := c.openRepo(true)
+	if err != nil {
+		return err
+	}
+
+	// Fail before starting Python; populate_db.py checks again as it takes the lock
+	lock, err := repo.GetIngestLock()
+	if err != nil {
+		return err
+	}
+	if lock != nil && !lock.Stale(c.cfg.IngestLockStale()) && (len(args) == 0 || args[0] != "unlock") {
+		return fmt.Errorf("another ingest is running: %s, since %s (last heartbeat %s)",
+			lock.Owner, lock.AcquiredAt.Format(time.RFC3339), lock.HeartbeatAt.Format(time.RFC3339))
+	}
+	return c.runScript("populate_db.py", args...)
+}
+
+func reindex(c *cmdContext, args []string) error {
+	fs := flag.NewFlagSet("reindex", flag.ExitOnError)
+	optimize := fs.Bool("optimize", false, "merge index segments instead of rebuilding")
+	fs.Parse(args)
+
+	repo, err := c.openRepo(true)
+	if err != nil {
+		return err
+	}
+	if *optimize {
+		if err := repo.OptimizeFTS(); err != nil {
+			return err
+		}
+	} else if err := c.runScript("populate_db.py", "rebuild-fts"); err != nil {
+		return err
+	}
+
+	status, err := repo.GetFTSStatus(c.cfg.FTSOptions())
+	if err != nil {
+		return err
+	}
+	return printJSON(status)
+}
+
+// createAPIKey prints a random token with the setting it belongs in. Tokens
+// are configuration, so nothing is stored; restart the server to apply it.
+func createAPIKey(c *cmdContext, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: create-api-key admin|sync|contributor <name>")
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(b)
+
+	switch args[0] {
+	case "admin":
+		fmt.Printf("ADMIN_TOKEN=%s\n", token)
+	case "sync":
+		fmt.Printf("SYNC_TOKEN=%s\n", token)
+	case "contributor":
+		if len(args) < 2 || args[1] == "" {
+			return fmt.Errorf("usage: create-api-key contributor <name>")
+		}
+		fmt.Printf("%s:%s\n", args[1], token)
+		log.Printf("Append it to CONTRIB_TOKENS (comma-separated name:token pairs)")
+	default:
+		return fmt.Errorf("unknown key kind %q, expected admin, sync or contributor", args[0])
+	}
+	return nil
+}
+
+func backup(c *cmdContext, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: backup <path>")
+	}
+	path := args[0]
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+
+	repo, err := c.openRepo(false)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	if err := repo.Backup(path); err != nil {
+		return err
+	}
+	log.Printf("Archive %s backed up to %s in %s", c.archive.ID, path, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// verifyFiles checks the named documents in-process. A sample check runs as
+// a server job like POST /api/admin/verify; -wait follows it to the end.
+func verifyFiles(c *cmdContext, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	percent := fs.Float64("percent", c.cfg.VerifySamplePercent, "share of documents to sample, (0, 100]")
+	wait := fs.Bool("wait", false, "wait for the server to finish the check")
+	fs.Parse(args)
+
+	repo, err := c.openRepo(true)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() > 0 {
+		store, err := storage.New(c.cfg.StorageBackend, c.cfg.StorageBaseURL, c.cfg.FilesDir)
+		if err != nil {
+			return err
+		}
+		failed := 0
+		for _, id := range fs.Args() {
+			document, err := repo.GetDocumentByID(id)
+			if err != nil {
+				return fmt.Errorf("document %s not found", id)
+			}
+			res := verify.File(c.ctx, store, storage.DocumentKey(document.Filename), document.SHA256, document.SizeBytes)
+			if !res.OK() {
+				failed++
+			}
+			if err := printJSON(map[string]interface{}{"document_id": id, "ok": res.OK(), "result": res}); err != nil {
+				return err
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d documents failed verification", failed, fs.NArg())
+		}
+		return nil
+	}
+
+	if !(*percent > 0 && *percent <= 100) {
+		return fmt.Errorf("invalid percent, expected (0, 100]")
+	}
+	job := &models.Job{Type: verify.SampleJobType, Params: verify.SampleParams(*percent)}
+	if err := repo.CreateJob(job); err != nil {
+		return err
+	}
+	log.Printf("Queued job %d (%s, %.2g%% of documents)", job.ID, job.Type, *percent)
+	if !*wait {
+		return nil
+	}
+
+	for job.Status == models.JobQueued || job.Status == models.JobRunning {
+		time.Sleep(2 * time.Second)
+		if job, err = repo.GetJob(job.ID); err != nil {
+			return err
+		}
+		log.Printf("Job %d %s: %d/%d processed, %d failed", job.ID, job.Status, job.Processed, job.Total, job.Failed)
+	}
+	if err := printJSON(job); err != nil {
+		return err
+	}
+	if job.Status != models.JobDone || job.Failed > 0 {
+		return fmt.Errorf("job %d %s with %d failures", job.ID, job.Status, job.Failed)
+	}
+	return nil
+}
+
+// stats prints what /api/admin/overview reports from the database; cache
+// and request counts live in the server process
+func stats(c *cmdContext, args []string) error {
+	repo, err := c.openRepo(false)
+	if err != nil {
+		return err
+	}
+	overview, err := repo.GetOverview()
+	if err != nil {
+		return err
+	}
+	if overview.FTS, err = repo.GetFTSStatus(c.cfg.FTSOptions()); err != nil {
+		return err
+	}
+	if info, err := os.Stat(c.archive.DatabaseURL + "-wal"); err == nil {
+		overview.Database.WALBytes = info.Size()
+	}
+	if info, err := os.Stat(c.cfg.SnapshotPath()); err == nil {
+		overview.Storage.SnapshotBytes = info.Size()
+		overview.Storage.TotalBytes += info.Size()
+	}
+	return printJSON(map[string]interface{}{"archive": c.archive.ID, "overview": overview})
+}
+
+// migrateDB copies the archive's SQLite database into Postgres, reading it
+// read-only. Writes during the copy may be missed, so stop the server first
+// or migrate a backup.
+func migrateDB(c *cmdContext, args []string) error {
+	fs := flag.NewFlagSet("migrate-db", flag.ExitOnError)
+	from := fs.String("from", "sqlite", "source engine")
+	to := fs.String("to", "postgres", "target engine")
+	dsn := fs.String("dsn", os.Getenv("POSTGRES_URL"), "target connection string (default $POSTGRES_URL)")
+	batch := fs.Int("batch", 5000, "rows per transaction")
+	fs.Parse(args)
+
+	if *from != "sqlite" || *to != "postgres" {
+		return fmt.Errorf("only -from sqlite -to postgres is supported")
+	}
+	if *dsn == "" {
+		return fmt.Errorf("-dsn or POSTGRES_URL is required")
+	}
+	if _, err := os.Stat(c.archive.DatabaseURL); err != nil {
+		return err
+	}
+
+	src, err := sql.Open("sqlite3", "file:"+c.archive.DatabaseURL+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := sql.Open("postgres", *dsn)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	if err := dst.PingContext(c.ctx); err != nil {
+		return fmt.Errorf("connect to postgres: %w", err)
+	}
+
+	textSearch := "simple"
+	if c.cfg.FTSPorter {
+		textSearch = "english"
+	}
+	report, err := pgmigrate.Run(c.ctx, src, dst, pgmigrate.Options{Batch: *batch, TextSearch: textSearch})
+	if err != nil {
+		return err
+	}
+	if err := printJSON(map[string]interface{}{"archive": c.archive.ID, "report": report}); err != nil {
+		return err
+	}
+	if bad := report.Mismatched(); len(bad) > 0 {
+		return fmt.Errorf("row counts differ for %v", bad)
+	}
+	return nil
+}
+
+// ============================================================================
+// HELPERS
+// ============================================================================
+
+// runScript runs a Python ingest script with the archive's database, and
+// the rest of the environment (FTS settings, CDN credentials) passed through
+func (c *cmdContext) runScript(script string, args ...string) error {
+	dbPath, err := filepath.Abs(c.archive.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	python := c.cfg.Python
+
+	cmd := exec.CommandContext(c.ctx, python, append([]string{script}, args...)...)
+	cmd.Dir = c.scripts
+	cmd.Env = append(os.Environ(), "DATABASE_PATH="+dbPath)
+	// Of several archives, each keeps its files in its own directory
+	if os.Getenv("ARCHIVES_CONFIG") != "" {
+		filesDir, err := filepath.Abs(c.archive.FilesDir)
+		if err != nil {
+			return err
+		}
+		cmd.Env = append(cmd.Env, "ARCHIVE_FILES_DIR="+filesDir)
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %w", python, script, err)
+	}
+	return nil
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
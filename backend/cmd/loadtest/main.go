@@ -0,0 +1,393 @@
+// Command loadtest replays a mix of API requests against a running instance
+// at a fixed rate and reports latency percentiles per kind of request
+// (search, list, detail). Saved reports serve as baselines, so a change to
+// the repository layer can be checked for regressions before release.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// request is one entry of a query mix, picked in proportion to its weight
+type request struct {
+	path   string
+	kind   string
+	weight float64
+}
+
+// KindStats summarizes the responses to one kind of request
+type KindStats struct {
+	Requests int64   `json:"requests"`
+	Errors   int64   `json:"errors"` // transport errors and 5xx
+	P50Ms    float64 `json:"p50_ms"`
+	P90Ms    float64 `json:"p90_ms"`
+	P95Ms    float64 `json:"p95_ms"`
+	P99Ms    float64 `json:"p99_ms"`
+	MaxMs    float64 `json:"max_ms"`
+}
+
+// Report is the outcome of a run, written with -out and read with -baseline
+type Report struct {
+	URL         string                `json:"url"`
+	StartedAt   time.Time             `json:"started_at"`
+	DurationS   float64               `json:"duration_s"`
+	TargetRPS   float64               `json:"target_rps"`
+	AchievedRPS float64               `json:"achieved_rps"`
+	Dropped     int64                 `json:"dropped"` // not sent: concurrency limit reached
+	Kinds       map[string]*KindStats `json:"kinds"`
+}
+
+func main() {
+	base := flag.String("url", "http://localhost:8080", "base URL of the instance")
+	mixPath := flag.String("mix", "", "query mix file (default: sampled from the instance)")
+	rps := flag.Float64("rps", 20, "requests per second")
+	duration := flag.Duration("duration", 30*time.Second, "how long to run")
+	concurrency := flag.Int("concurrency", 50, "maximum requests in flight")
+	timeout := flag.Duration("timeout", 10*time.Second, "per-request timeout")
+	out := flag.String("out", "", "write the report as JSON to this file")
+	baseline := flag.String("baseline", "", "report to compare against")
+	maxRegression := flag.Float64("max-regression", 20, "fail when a kind's p95 is this many percent above the baseline")
+	flag.Parse()
+
+	client := &http.Client{Timeout: *timeout}
+	baseURL := strings.TrimRight(*base, "/")
+
+	var mix []request
+	var err error
+	if *mixPath != "" {
+		mix, err = loadMix(*mixPath)
+	} else {
+		mix, err = sampleMix(client, baseURL)
+	}
+	if err != nil {
+		log.Fatalf("Failed to load query mix: %v", err)
+	}
+	if len(mix) == 0 {
+		log.Fatalf("Query mix is empty")
+	}
+
+	log.Printf("Replaying %d requests at %.0f rps for %s against %s", len(mix), *rps, *duration, baseURL)
+	report := run(client, baseURL, mix, *rps, *duration, *concurrency)
+	printReport(os.Stdout, report)
+
+	if *out != "" {
+		data, _ := json.MarshalIndent(report, "", "  ")
+		if err := os.WriteFile(*out, data, 0644); err != nil {
+			log.Fatalf("Failed to write report: %v", err)
+		}
+	}
+
+	if *baseline != "" {
+		prev, err := readReport(*baseline)
+		if err != nil {
+			log.Fatalf("Failed to read baseline: %v", err)
+		}
+		if regressions := compare(os.Stdout, prev, report, *maxRegression); regressions > 0 {
+			log.Fatalf("%d kinds regressed by more than %.0f%%", regressions, *maxRegression)
+		}
+	}
+}
+
+// ============================================================================
+// QUERY MIX
+// ============================================================================
+
+// loadMix reads one request per line: an optional weight, then the path and
+// query, e.g. "5 /api/search?q=flight+logs". Blank lines and lines starting
+// with # are skipped.
+func loadMix(path string) ([]request, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var mix []request
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		weight := 1.0
+		if fields := strings.Fields(line); len(fields) == 2 {
+			w, err := strconv.ParseFloat(fields[0], 64)
+			if err != nil || w <= 0 {
+				return nil, fmt.Errorf("line %d: invalid weight %q", n, fields[0])
+			}
+			weight, line = w, fields[1]
+		}
+		if !strings.HasPrefix(line, "/") {
+			return nil, fmt.Errorf("line %d: expected a path starting with /", n)
+		}
+		mix = append(mix, request{path: line, kind: kindOf(line), weight: weight})
+	}
+	return mix, scanner.Err()
+}
+
+// Searches used by the sampled mix, with terms common in the release
+var sampleQueries = []string{"flight", "island", "passenger", "massage", "palm beach", "new york", "phone", "2005"}
+
+// sampleMix builds a mix from the instance itself: searches, list pages and
+// the details of documents and images it lists, weighted like public
+// traffic (mostly search and detail views)
+func sampleMix(client *http.Client, baseURL string) ([]request, error) {
+	var documents struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := getJSON(client, baseURL+"/api/documents?limit=100", &documents); err != nil {
+		return nil, err
+	}
+	var images struct {
+		Data []struct {
+			ID uint `json:"id"`
+		} `json:"data"`
+	}
+	if err := getJSON(client, baseURL+"/api/images?limit=100", &images); err != nil {
+		return nil, err
+	}
+
+	var mix []request
+	add := func(weight float64, path string) {
+		mix = append(mix, request{path: path, kind: kindOf(path), weight: weight})
+	}
+	for _, q := range sampleQueries {
+		add(4, "/api/search?q="+url.QueryEscape(q))
+	}
+	add(2, "/api/documents?limit=50")
+	add(2, "/api/images?limit=50")
+	add(1, "/api/images?limit=50&sort=quality")
+	add(1, "/api/stats")
+	for _, d := range documents.Data {
+		add(0.5, "/api/documents/"+d.ID)
+		add(0.2, "/api/documents/"+d.ID+"/pages")
+	}
+	for _, img := range images.Data {
+		add(0.3, fmt.Sprintf("/api/images/%d", img.ID))
+	}
+	return mix, nil
+}
+
+func getJSON(client *http.Client, url string, v interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// kindOf groups a path for reporting: /api/search is "search", a collection
+// such as /api/documents is "list", anything below an item is "detail"
+func kindOf(path string) string {
+	p, _, _ := strings.Cut(path, "?")
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	switch {
+	case len(parts) >= 2 && parts[1] == "search":
+		return "search"
+	case len(parts) == 2:
+		return "list"
+	case len(parts) > 2:
+		return "detail"
+	}
+	return "other"
+}
+
+// ============================================================================
+// RUN
+// ============================================================================
+
+type sample struct {
+	kind    string
+	latency time.Duration
+	failed  bool
+}
+
+// run sends requests at a steady rate whatever the response times, as real
+// visitors do, so a slow server shows up as latency rather than lower load
+func run(client *http.Client, baseURL string, mix []request, rps float64, duration time.Duration, concurrency int) *Report {
+	var totalWeight float64
+	for _, r := range mix {
+		totalWeight += r.weight
+	}
+	pick := func() request {
+		x := rand.Float64() * totalWeight
+		for _, r := range mix {
+			if x -= r.weight; x < 0 {
+				return r
+			}
+		}
+		return mix[len(mix)-1]
+	}
+
+	report := &Report{URL: baseURL, StartedAt: time.Now().UTC(), TargetRPS: rps, Kinds: map[string]*KindStats{}}
+	samples := make(chan sample, concurrency)
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	collected := make(chan map[string][]sample)
+	go func() {
+		byKind := map[string][]sample{}
+		for s := range samples {
+			byKind[s.kind] = append(byKind[s.kind], s)
+		}
+		collected <- byKind
+	}()
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / rps))
+	defer ticker.Stop()
+	deadline := time.After(duration)
+	start := time.Now()
+loop:
+	for {
+		select {
+		case <-deadline:
+			break loop
+		case <-ticker.C:
+		}
+		select {
+		case slots <- struct{}{}:
+		default:
+			report.Dropped++
+			continue
+		}
+
+		wg.Add(1)
+		go func(r request) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			samples <- send(client, baseURL, r)
+		}(pick())
+	}
+	wg.Wait()
+	close(samples)
+	elapsed := time.Since(start)
+
+	var sent int64
+	for kind, list := range <-collected {
+		report.Kinds[kind] = summarize(list)
+		sent += int64(len(list))
+	}
+	report.DurationS = elapsed.Seconds()
+	report.AchievedRPS = float64(sent) / elapsed.Seconds()
+	return report
+}
+
+func send(client *http.Client, baseURL string, r request) sample {
+	start := time.Now()
+	resp, err := client.Get(baseURL + r.path)
+	if err != nil {
+		return sample{kind: r.kind, latency: time.Since(start), failed: true}
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return sample{kind: r.kind, latency: time.Since(start), failed: resp.StatusCode >= 500}
+}
+
+func summarize(samples []sample) *KindStats {
+	latencies := make([]float64, len(samples))
+	stats := &KindStats{Requests: int64(len(samples))}
+	for i, s := range samples {
+		latencies[i] = float64(s.latency) / float64(time.Millisecond)
+		if s.failed {
+			stats.Errors++
+		}
+	}
+	sort.Float64s(latencies)
+
+	stats.P50Ms = percentile(latencies, 50)
+	stats.P90Ms = percentile(latencies, 90)
+	stats.P95Ms = percentile(latencies, 95)
+	stats.P99Ms = percentile(latencies, 99)
+	stats.MaxMs = latencies[len(latencies)-1]
+	return stats
+}
+
+// percentile of sorted values, nearest-rank
+func percentile(sorted []float64, p float64) float64 {
+	i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	return sorted[max(i, 0)]
+}
+
+// ============================================================================
+// REPORTS
+// ============================================================================
+
+func printReport(w io.Writer, r *Report) {
+	fmt.Fprintf(w, "%.0fs at %.1f rps (target %.0f), %d dropped\n\n", r.DurationS, r.AchievedRPS, r.TargetRPS, r.Dropped)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "kind\trequests\terrors\tp50 ms\tp90 ms\tp95 ms\tp99 ms\tmax ms\t")
+	for _, kind := range sortedKinds(r.Kinds) {
+		s := r.Kinds[kind]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%.1f\t%.1f\t%.1f\t%.1f\t\n",
+			kind, s.Requests, s.Errors, s.P50Ms, s.P90Ms, s.P95Ms, s.P99Ms, s.MaxMs)
+	}
+	tw.Flush()
+}
+
+func readReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// compare prints the p95 change of every kind in both reports and returns
+// how many got slower by more than maxRegression percent
+func compare(w io.Writer, baseline, current *Report, maxRegression float64) int {
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "kind\tbaseline p95\tp95\tchange\t\t")
+	regressions := 0
+	for _, kind := range sortedKinds(current.Kinds) {
+		prev, ok := baseline.Kinds[kind]
+		if !ok || prev.P95Ms == 0 {
+			continue
+		}
+		cur := current.Kinds[kind]
+		change := (cur.P95Ms - prev.P95Ms) / prev.P95Ms * 100
+		verdict := ""
+		if change > maxRegression {
+			verdict = "REGRESSED"
+			regressions++
+		}
+		fmt.Fprintf(tw, "%s\t%.1f\t%.1f\t%+.0f%%\t%s\t\n", kind, prev.P95Ms, cur.P95Ms, change, verdict)
+	}
+	tw.Flush()
+	return regressions
+}
+
+func sortedKinds(kinds map[string]*KindStats) []string {
+	names := make([]string, 0, len(kinds))
+	for kind := range kinds {
+		names = append(names, kind)
+	}
+	sort.Strings(names)
+	return names
+}
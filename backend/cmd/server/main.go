@@ -1,115 +1,523 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/epstein-files/backend/internal/archive"
+	"github.com/epstein-files/backend/internal/auth"
+	"github.com/epstein-files/backend/internal/blobs"
+	"github.com/epstein-files/backend/internal/buildinfo"
 	"github.com/epstein-files/backend/internal/config"
+	"github.com/epstein-files/backend/internal/counts"
+	"github.com/epstein-files/backend/internal/database"
+	"github.com/epstein-files/backend/internal/dedup"
+	"github.com/epstein-files/backend/internal/enrich"
+	"github.com/epstein-files/backend/internal/export"
+	"github.com/epstein-files/backend/internal/features"
 	"github.com/epstein-files/backend/internal/handlers"
-	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/integrity"
+	"github.com/epstein-files/backend/internal/jobs"
+	"github.com/epstein-files/backend/internal/logging"
+	"github.com/epstein-files/backend/internal/middleware"
+	"github.com/epstein-files/backend/internal/mirror"
+	"github.com/epstein-files/backend/internal/purge"
+	"github.com/epstein-files/backend/internal/quota"
+	"github.com/epstein-files/backend/internal/reingest"
+	"github.com/epstein-files/backend/internal/report"
 	"github.com/epstein-files/backend/internal/repository"
+	"github.com/epstein-files/backend/internal/storage"
+	"github.com/epstein-files/backend/internal/telemetry"
+	"github.com/epstein-files/backend/internal/tier"
+	"github.com/epstein-files/backend/internal/usage"
+	"github.com/epstein-files/backend/internal/verify"
 
-	"github.com/gin-contrib/cors"
-	"github.com/gin-gonic/gin"
-	"gorm.io/driver/sqlite"
-	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 func main() {
 	// Load configuration
 	cfg := config.Load()
 
-	// Setup database
-	db, err := setupDatabase(cfg.DatabaseURL)
+	// Tracing is exported over OTLP when OTEL_EXPORTER_OTLP_ENDPOINT is set
+	shutdownTracing, err := telemetry.Setup(context.Background())
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		log.Fatalf("Failed to set up tracing: %v", err)
 	}
+	defer shutdownTracing(context.Background())
 
-	// Run migrations
-	if err := models.AutoMigrate(db); err != nil {
-		log.Fatalf("Failed to run migrations: %v", err)
+	if cfg.ManifestSigningKey != "" {
+		if _, err := export.ParseSigningKey(cfg.ManifestSigningKey); err != nil {
+			log.Fatalf("Invalid MANIFEST_SIGNING_KEY: %v", err)
+		}
 	}
 
-	// Initialize repository and handlers
-	repo := repository.New(db)
-	h := handlers.New(repo)
-
-	// Setup Gin
-	gin.SetMode(gin.ReleaseMode)
-	r := gin.New()
-	r.Use(gin.Recovery())
-	r.Use(gin.LoggerWithFormatter(logFormatter))
-
-	// CORS - Allow all origins
-	r.Use(cors.New(cors.Config{
-		AllowAllOrigins:  true,
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"*"},
-		ExposeHeaders:    []string{"Content-Length"},
-		MaxAge:           12 * time.Hour,
-	}))
+	if !logging.Valid(cfg.LogLevel) {
+		log.Fatalf("Invalid LOG_LEVEL %q, expected debug, info, warn, error or silent", cfg.LogLevel)
+	}
+	logging.SetLevel(cfg.LogLevel)
+	config.OnReload(func(c *config.Config) {
+		if !logging.Valid(c.LogLevel) {
+			log.Printf("Ignoring invalid LOG_LEVEL %q on reload", c.LogLevel)
+			return
+		}
+		logging.SetLevel(c.LogLevel)
+	})
 
-	// Routes
-	api := r.Group("/api")
-	{
-		api.GET("/health", h.Health)
-		api.GET("/stats", h.GetStats)
+	if !config.ValidRole(cfg.Role) {
+		log.Fatalf("Invalid ROLE %q, expected api, worker or all", cfg.Role)
+	}
+	if cfg.RunsJobs() && cfg.WorkerID == "" {
+		log.Fatalf("WORKER_ID is required when the hostname is unknown")
+	}
 
-		api.GET("/images", h.GetImages)
-		api.GET("/images/:id", h.GetImageByID)
+	if !database.ValidReplicaMode(cfg.ReadReplica) {
+		log.Fatalf("Invalid READ_REPLICA %q, expected memory or mmap", cfg.ReadReplica)
+	}
 
-		api.GET("/documents", h.GetDocuments)
-		api.GET("/documents/:id", h.GetDocumentByID)
+	archives, err := config.LoadArchives(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load archives: %v", err)
+	}
 
-		api.GET("/search", h.Search)
+	// Admins can also sign in through the configured SSO providers
+	providers, err := config.LoadAuthProviders(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load auth providers: %v", err)
 	}
 
-	// Start server
-	log.Printf("Starting server on :%s", cfg.Port)
-	log.Printf("Database: %s", cfg.DatabaseURL)
-	if err := r.Run(":" + cfg.Port); err != nil {
+	// Each archive gets its own database, repository and router
+	router := archive.NewRouter()
+	for _, a := range archives {
+		r, err := setupArchive(cfg, a, providers)
+		if err != nil {
+			log.Fatalf("Failed to set up archive %s: %v", a.ID, err)
+		}
+		router.Add(a, r)
+		log.Printf("Archive %s: database %s%s", a.ID, a.DatabaseURL, describeRouting(a))
+	}
+
+	// CORS origins and the log level can change without a restart
+	go reloadOnSIGHUP()
+
+	// Start server; a worker only serves its health check
+	build := buildinfo.Get()
+	log.Printf("Starting %s server %s (%s) on :%s", cfg.Role, build.Version, build.Commit, cfg.Port)
+	if err := http.ListenAndServe(":"+cfg.Port, router); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
 
-func setupDatabase(dbURL string) (*gorm.DB, error) {
-	// SQLite configuration for better performance
-	db, err := gorm.Open(sqlite.Open(dbURL+"?_journal_mode=WAL&_synchronous=NORMAL&_cache_size=10000"), &gorm.Config{
-		Logger: logger.New(
-			log.New(os.Stdout, "\r\n", log.LstdFlags),
-			logger.Config{
-				SlowThreshold:             200 * time.Millisecond,
-				LogLevel:                  logger.Warn,
-				IgnoreRecordNotFoundError: true,
-				Colorful:                  true,
-			},
-		),
-	})
+func setupArchive(cfg *config.Config, a config.Archive, providers []config.AuthProvider) (http.Handler, error) {
+	// Setup database
+	db, err := database.Open(a.DatabaseURL, cfg.BusyTimeout(), cfg.ForeignKeys)
 	if err != nil {
+		return nil, fmt.Errorf("connect to database: %w", err)
+	}
+
+	// Run migrations
+	if err := database.Migrate(db, cfg); err != nil {
 		return nil, err
 	}
 
-	// Connection pool settings
-	sqlDB, err := db.DB()
+	// Initialize repository and handlers with this archive's settings
+	archiveCfg := *cfg
+	archiveCfg.ArchiveID = a.ID
+	archiveCfg.DatabaseURL = a.DatabaseURL
+	archiveCfg.ArchivePath = a.PathPrefix
+	archiveCfg.FilesDir = a.FilesDir
+	archiveCfg.StorageBaseURL = a.StorageBaseURL
+	archiveCfg.ColdStorageDir = a.ColdStorageDir
+
+	repo := repository.New(db)
+
+	// Public reads can go to a replica, leaving the one connection to writes
+	var replica *database.Replica
+	if cfg.ReadReplica != "" && cfg.ServesAPI() {
+		replica, err = database.NewReplica(cfg.ReadReplica, a.DatabaseURL, db, cfg.ReadReplicaConns, cfg.ReadReplicaMmapMB)
+		if err != nil {
+			return nil, fmt.Errorf("open read replica: %w", err)
+		}
+		interval := time.Duration(cfg.ReadReplicaRefreshSeconds) * time.Second
+		if interval > 0 {
+			go replica.Run(context.Background(), interval)
+		}
+	}
+
+	store, err := storage.New(cfg.StorageBackend, archiveCfg.StorageBaseURL, archiveCfg.FilesDir)
 	if err != nil {
 		return nil, err
 	}
-	sqlDB.SetMaxOpenConns(1) // SQLite only supports one writer
-	sqlDB.SetMaxIdleConns(1)
-	sqlDB.SetConnMaxLifetime(time.Hour)
+	// Rarely read source PDFs move to cold storage, and back when asked for
+	var tiered *storage.Tiered
+	if archiveCfg.ColdStorageDir != "" {
+		hot, ok := store.(storage.Writer)
+		if !ok {
+			return nil, fmt.Errorf("COLD_STORAGE_DIR needs STORAGE_BACKEND=local")
+		}
+		tiered = storage.NewTiered(hot, storage.NewLocal(archiveCfg.ColdStorageDir))
+		store = tiered
+	}
+
+	// Uploads always land on local disk, next to the ingest working directories
+	var uploads storage.Writer = storage.NewLocal(archiveCfg.FilesDir)
+	if cfg.LegalHold {
+		uploads = storage.NewHold(uploads)
+	}
+
+	// Background jobs run one at a time per worker and resume after a
+	// restart. An API-only process registers them to check what it queues.
+	queue := jobs.NewQueue(repo, cfg.WorkerID)
+	queue.Register(enrich.RecomputeJobType, enrich.RecomputeJob(repo, store))
+	queue.Register(dedup.ClusterJobType, dedup.ClusterJob(repo))
+	queue.Register(counts.JobType, counts.Job(repo, store))
+	queue.Register(integrity.JobType, integrity.Job(repo, store))
+	queue.Register(purge.JobType, purge.Job(repo, store))
+	queue.Register(verify.SampleJobType, verify.SampleJob(repo, store, verify.NewAlerter(cfg.AlertWebhookURL, a.ID)))
+	queue.Register(report.JobType, report.Job(repo, a.ID, archiveCfg.StatsReportPath))
+	queue.Register(export.DownloadJobType, export.DownloadJob(repo, archiveCfg.ExportDir()))
+	queue.Register(blobs.ImportJobType, blobs.ImportJob(repo, store, uploads))
+	queue.Register(blobs.GCJobType, blobs.GCJob(repo, uploads))
+	queue.Register(reingest.JobType, reingest.Job(repo, store, reingest.Scripts{
+		Python:   cfg.Python,
+		Root:     cfg.FilesDir,
+		FilesDir: archiveCfg.FilesDir,
+		Database: a.DatabaseURL,
+	}))
+	if tiered != nil {
+		queue.Register(tier.ArchiveJobType, tier.ArchiveJob(repo, tiered))
+		queue.Register(tier.RestoreJobType, tier.RestoreJob(repo, tiered, time.Duration(cfg.TierRestoreDays)*24*time.Hour))
+	}
+
+	if _, err := export.LoadTokenKey(cfg.ExportTokenSecret, cfg.ExportTokenKeyPath()); err != nil {
+		return nil, fmt.Errorf("load export token key: %w", err)
+	}
+	if a.SyncPrimaryURL != "" && cfg.SyncToken == "" {
+		return nil, fmt.Errorf("SYNC_TOKEN is required to mirror %s", a.SyncPrimaryURL)
+	}
+	if cfg.RunsJobs() {
+		startWorker(&archiveCfg, a, repo, queue, tiered)
+	}
+
+	// Response counts per archive, for the admin overview
+	requests := middleware.NewRequestCounter()
+	// Load shedding for the expensive endpoints, per archive
+	breakers := middleware.NewBreakers(middleware.BreakerSettings{
+		ErrorRate:   cfg.BreakerErrorRate,
+		Slow:        time.Duration(cfg.BreakerSlowMS) * time.Millisecond,
+		MinRequests: cfg.BreakerMinRequests,
+		Window:      time.Duration(cfg.BreakerWindowSeconds) * time.Second,
+		Cooldown:    time.Duration(cfg.BreakerCooldownSeconds) * time.Second,
+	})
+	// Feature flags: the configuration, overridden by this archive's rows
+	flags := features.New(&archiveCfg)
+	stored, err := repo.GetFeatureFlags()
+	if err != nil {
+		return nil, fmt.Errorf("load feature flags: %w", err)
+	}
+	flags.SetStored(stored)
+	config.OnReload(flags.SetConfig)
+
+	// API key quotas, counted in memory and saved every so often
+	quotas := quota.New(&archiveCfg, repo)
+	if err := quotas.Load(); err != nil {
+		return nil, fmt.Errorf("load API usage: %w", err)
+	}
+	if cfg.ServesAPI() {
+		go quotas.Run(context.Background(), 30*time.Second)
+	}
+	config.OnReload(quotas.SetConfig)
+
+	// Sessions are per archive, each in its own database
+	var sso *auth.Service
+	if len(providers) > 0 {
+		key, err := export.LoadTokenKey(cfg.AuthStateSecret, cfg.AuthStateKeyPath())
+		if err != nil {
+			return nil, fmt.Errorf("load auth state key: %w", err)
+		}
+		client := &http.Client{Timeout: 30 * time.Second, Transport: otelhttp.NewTransport(http.DefaultTransport)}
+		sso = auth.New(&archiveCfg, providers, repo, key, client)
+	}
+
+	// Opt-in usage statistics, counted in memory and saved every so often
+	stats := usage.New(&archiveCfg, repo)
+	if stats != nil && cfg.ServesAPI() {
+		go stats.Run(context.Background(), time.Minute)
+	}
+
+	h := handlers.New(repo, &archiveCfg, queue, store, uploads, requests, breakers, replica, flags, quotas, sso, stats)
+
+	if !cfg.ServesAPI() {
+		return newWorkerRouter(h), nil
+	}
+	return newRouter(&archiveCfg, h, requests, breakers, flags, quotas, sso, stats), nil
+}
+
+// startWorker runs an archive's job queue and the background work around it:
+// the schedules queueing jobs, the analytics snapshot, export cleanup and
+// mirror sync
+func startWorker(cfg *config.Config, a config.Archive, repo *repository.Repository, queue *jobs.Queue, tiered *storage.Tiered) {
+	go queue.Run(context.Background())
+
+	// Export downloads are deleted once used or expired
+	go export.SweepDownloads(context.Background(), repo)
+
+	// Weekly spot check of stored files against their recorded hashes
+	if cfg.VerifyIntervalHours > 0 && cfg.VerifySamplePercent > 0 {
+		interval := time.Duration(cfg.VerifyIntervalHours) * time.Hour
+		go verify.Schedule(context.Background(), repo, queue, interval, cfg.VerifySamplePercent)
+	}
+
+	// Daily pass moving PDFs not read lately to cold storage; a move deletes
+	// the hot copy, which legal hold forbids
+	if tiered != nil && cfg.TierColdAfterDays > 0 {
+		if cfg.LegalHold {
+			log.Printf("Archive %s: legal hold is on, not moving files to cold storage", a.ID)
+		} else {
+			go tier.Schedule(context.Background(), repo, queue, 24*time.Hour, cfg.TierColdAfterDays)
+		}
+	}
+
+	// Rebuild the downloadable analytics snapshot in the background
+	if cfg.SnapshotIntervalHours > 0 {
+		interval := time.Duration(cfg.SnapshotIntervalHours) * time.Hour
+		go export.NewSnapshotter(repo, cfg.SnapshotPath(), interval).Run(context.Background())
+	}
+
+	// Regenerate the transparency report
+	if cfg.StatsReportIntervalHours > 0 {
+		interval := time.Duration(cfg.StatsReportIntervalHours) * time.Hour
+		go report.Schedule(context.Background(), repo, queue, interval)
+	}
+
+	// Mirrors follow their primary's change feed
+	if a.SyncPrimaryURL != "" {
+		interval := time.Duration(cfg.SyncIntervalSeconds) * time.Second
+		go mirror.NewClient(repo, a.SyncPrimaryURL, cfg.SyncToken, interval).Run(context.Background())
+	}
+}
 
-	return db, nil
+// newWorkerRouter serves a worker's health and version, for orchestrators
+// and load balancers to probe
+func newWorkerRouter(h *handlers.Handlers) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/health", h.Health)
+	mux.HandleFunc("GET /api/version", h.Version)
+	return middleware.Chain(mux, middleware.Recovery, middleware.Logger)
 }
 
-func logFormatter(param gin.LogFormatterParams) string {
-	return fmt.Sprintf("[%s] %s %s %d %s\n",
-		param.TimeStamp.Format("15:04:05"),
-		param.Method,
-		param.Path,
-		param.StatusCode,
-		param.Latency,
-	)
+func newRouter(cfg *config.Config, h *handlers.Handlers, requests *middleware.RequestCounter, breakers *middleware.Breakers, flags *features.Set, quotas *quota.Limiter, sso *auth.Service, stats *usage.Collector) http.Handler {
+	mux := http.NewServeMux()
+
+	// Each route gets its own span named after its pattern, counts against
+	// the quota of the API key it's called with and, with USAGE_STATS, in
+	// the usage statistics
+	route := func(pattern string, handler http.HandlerFunc, mws ...middleware.Middleware) {
+		mws = append([]middleware.Middleware{stats.Track(pattern), quotas.Enforce}, mws...)
+		mux.Handle(pattern, otelhttp.NewHandler(middleware.Chain(handler, mws...), pattern))
+	}
+
+	// Public reads that may lag an ingest by the replica's refresh interval.
+	// They answer 503 instead of queueing while an ingest holds the database;
+	// exports stream for longer than the deadline allows.
+	bounded := middleware.Timeout(cfg.RequestTimeout())
+	read := func(next http.Handler) http.Handler {
+		return middleware.Chain(next, bounded, h.ReadFromReplica)
+	}
+	// Writes take as long as they take, but a locked database is still a 503
+	locked := middleware.Timeout(0)
+
+	// Cache-Control by route class, picked up again when the configuration
+	// is reloaded
+	cache := middleware.NewCachePolicies(cfg.CachePolicies)
+	config.OnReload(func(c *config.Config) {
+		cache.Set(c.CachePolicies)
+	})
+	statistics, lists, records := cache.Class(middleware.CacheStats), cache.Class(middleware.CacheLists), cache.Class(middleware.CacheRecords)
+	searches, files, exports := cache.Class(middleware.CacheSearch), cache.Class(middleware.CacheFiles), cache.Class(middleware.CacheExports)
+	private := cache.Class(middleware.CachePrivate)
+
+	// Routes
+	mux.HandleFunc("GET /api/health", h.Health)
+	mux.HandleFunc("GET /api/version", h.Version)
+	route("GET /api/stats", h.GetStats, statistics, read)
+	route("GET /api/stats/growth", h.GetGrowth, statistics, read)
+
+	route("GET /api/images", h.GetImages, lists, read)
+	route("GET /api/images/facets", h.GetImageFacets, lists, read)
+	route("GET /api/images/{id}", h.GetImageByID, records, read)
+	route("GET /api/images/{id}/render", h.RenderImage, files, read)
+	route("GET /api/images/{id}/exif/raw", h.GetImageRawExif, records, read)
+	route("GET /api/images/{id}/download", h.DownloadImage, files, read)
+
+	route("GET /api/documents", h.GetDocuments, lists, read)
+	route("GET /api/documents/range", h.GetDocumentRange, lists, read)
+	route("GET /api/documents/{id}", h.GetDocumentByID, records, read)
+	route("GET /api/documents/{id}/pages", h.GetDocumentPages, records, read)
+	route("GET /api/documents/{id}/images", h.GetDocumentImages, records, read)
+	route("GET /api/documents/{id}/text", h.GetDocumentText, records, read)
+	route("GET /api/documents/{id}/tables", h.GetDocumentTables, records, read)
+	route("GET /api/documents/{id}/sprite", h.GetDocumentSprite, files, read)
+	route("GET /api/documents/{id}/versions", h.GetDocumentVersions, records, read)
+	route("GET /api/documents/{id}/verify", h.VerifyDocument, records, read)
+	route("GET /api/documents/{id}/cluster", h.GetDocumentCluster, records, read)
+	route("GET /api/documents/{id}/file", h.DownloadDocument, files, locked)
+	if cfg.ColdStorageDir != "" {
+		route("POST /api/documents/{id}/restore", h.RestoreDocument, private, locked)
+	}
+	route("GET /api/blobs/{hash}", h.GetBlob, files, locked)
+
+	route("GET /api/search", h.Search, searches, h.LongPollSearch, breakers.Guard("search"), read)
+	if cfg.EmbeddingsAPIURL != "" {
+		route("GET /api/search/passages", h.SearchPassages, searches, breakers.Guard("passages"), read)
+	}
+
+	route("GET /api/datasets", h.GetDatasets, lists, read)
+	route("GET /api/datasets/{id}", h.GetDataset, records, read)
+	route("GET /api/datasets/{id}/files/{fileId}", h.GetDatasetFile, files, read)
+
+	route("GET /api/export/documents.parquet", h.ExportDocumentsParquet, exports, breakers.Guard("documents.parquet"), h.ReadFromReplica)
+	route("GET /api/export/images.parquet", h.ExportImagesParquet, exports, breakers.Guard("images.parquet"), h.ReadFromReplica)
+	route("GET /api/export/snapshot.db", h.ExportSnapshot, exports)
+	route("GET /api/export/manifest", h.GetManifest, exports)
+	route("GET /api/export/stats-report", h.ExportStatsReport, exports)
+	route("POST /api/exports", h.CreateExportDownload, private, locked)
+	route("GET /api/exports/{token}", h.GetExportDownload, private, locked)
+
+	route("GET /api/changes", h.GetChanges, exports)
+
+	// Change feed for mirrors, only served when a sync token is configured
+	if cfg.SyncToken != "" {
+		route("GET /api/sync/changes", h.GetSyncChanges, private, middleware.BearerToken(cfg.SyncToken))
+	}
+
+	// Anonymous face clusters, behind the faces flag
+	faces := flags.Require(features.Faces)
+	route("GET /api/faces/clusters", h.GetFaceClusters, lists, faces, read)
+	route("GET /api/faces/clusters/{id}", h.GetFaceCluster, records, faces, read)
+	route("GET /api/faces/clusters/{id}/images", h.GetFaceClusterImages, lists, faces, read)
+
+	// Contributor uploads, only served when contributor tokens are configured
+	// and behind the contributions flag
+	if len(cfg.ContribTokens) > 0 {
+		contributors := middleware.Contributors(cfg.ContribTokens)
+		contributions := flags.Require(features.Contributions)
+		route("POST /api/contrib/documents", h.UploadContribution, private, contributors, contributions, locked)
+		route("GET /api/contrib/documents", h.GetMyContributions, private, contributors, contributions, locked)
+	}
+
+	// API key usage, not metered itself so keys over quota can still see it
+	if len(cfg.ContribTokens) > 0 {
+		usage := "GET /api/keys/self/usage"
+		keys := middleware.Contributors(cfg.ContribTokens)
+		mux.Handle(usage, otelhttp.NewHandler(middleware.Chain(http.HandlerFunc(h.GetKeyUsage), private, keys), usage))
+	}
+
+	// Single sign-on, only served when providers are configured
+	if sso != nil {
+		route("GET /api/auth/providers", h.GetAuthProviders, private)
+		route("GET /api/auth/{provider}/login", h.Login, private, locked)
+		route("GET /api/auth/{provider}/callback", h.LoginCallback, private, locked)
+		route("GET /api/auth/session", h.GetSession, private, locked)
+		route("POST /api/auth/logout", h.Logout, private, locked)
+	}
+
+	// Admin routes, only served when an admin token or single sign-on is
+	// configured
+	if cfg.AdminToken != "" || sso != nil {
+		signedIn := sso.Admin(cfg.AdminToken)
+		admin := func(next http.Handler) http.Handler {
+			return middleware.Chain(next, cache.Class(middleware.CacheAdmin), signedIn, locked)
+		}
+		route("GET /api/admin/overview", h.GetOverview, admin)
+		route("POST /api/admin/config/reload", h.ReloadConfig, admin)
+		route("GET /api/admin/features", h.GetFeatures, admin)
+		route("PUT /api/admin/features/{name}", h.SetFeature, admin)
+		route("DELETE /api/admin/features/{name}", h.DeleteFeature, admin)
+		route("GET /api/admin/fts/status", h.GetFTSStatus, admin)
+		route("POST /api/admin/fts/optimize", h.OptimizeFTS, admin)
+		route("POST /api/admin/recompute", h.Recompute, admin)
+		route("POST /api/admin/documents/{id}/reingest", h.ReingestDocument, admin)
+		if cfg.ColdStorageDir != "" {
+			route("GET /api/admin/tier", h.GetFileTiers, admin)
+			route("POST /api/admin/tier", h.ArchiveColdFiles, admin)
+		}
+		route("GET /api/admin/audit", h.GetAuditLog, admin)
+		route("GET /api/admin/usage", h.GetUsage, admin)
+		route("POST /api/admin/verify", h.VerifySample, admin)
+		route("POST /api/admin/dedup", h.ClusterDuplicates, admin)
+		route("POST /api/admin/counts", h.BackfillCounts, admin)
+		route("GET /api/admin/integrity", h.GetIntegrity, admin)
+		route("POST /api/admin/integrity/cleanup", h.CleanupOrphans, admin)
+		route("DELETE /api/admin/datasets/{id}", h.DeleteDataset, admin)
+		route("POST /api/admin/stats-report", h.GenerateStatsReport, admin)
+		route("POST /api/admin/blobs/import", h.ImportBlobs, admin)
+		route("POST /api/admin/blobs/gc", h.CollectBlobs, admin)
+		route("GET /api/admin/jobs", h.GetJobs, admin)
+		route("GET /api/admin/jobs/{id}", h.GetJob, admin)
+		route("POST /api/admin/jobs/{id}/cancel", h.CancelJob, admin)
+		route("GET /api/admin/contributions", h.GetContributions, admin)
+		route("GET /api/admin/contributions/{id}/file", h.GetContributionFile, admin)
+		route("POST /api/admin/contributions/{id}/approve", h.ApproveContribution, admin)
+		route("POST /api/admin/contributions/{id}/reject", h.RejectContribution, admin)
+	}
+
+	// CORS origins are picked up again when the configuration is reloaded
+	cors := middleware.NewCORSRules(corsPolicies(cfg))
+	config.OnReload(func(c *config.Config) {
+		cors.Set(corsPolicies(c))
+	})
+
+	return middleware.Chain(mux, requests.Count, middleware.Recovery, middleware.Logger, cors.Middleware(), middleware.Casing)
+}
+
+// corsPolicies allows the configured origins globally and opens the public
+// export/feed routes to all
+func corsPolicies(cfg *config.Config) (middleware.CORSPolicy, map[string]middleware.CORSPolicy) {
+	publicCORS := middleware.CORSPolicy{
+		AllowedOrigins: []string{"*"},
+		AllowMethods:   []string{"GET", "HEAD", "OPTIONS"},
+	}
+	overrides := make(map[string]middleware.CORSPolicy)
+	for _, prefix := range cfg.CORSPublicPaths {
+		overrides[prefix] = publicCORS
+	}
+	return middleware.CORSPolicy{
+		AllowedOrigins:   cfg.CORSAllowedOrigins,
+		AllowCredentials: cfg.CORSAllowCredentials,
+	}, overrides
+}
+
+// reloadOnSIGHUP re-reads CONFIG_FILE whenever the process gets SIGHUP
+func reloadOnSIGHUP() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if _, err := config.Reload(); err != nil {
+			log.Printf("Config reload failed: %v", err)
+			continue
+		}
+		log.Printf("Config reloaded (log level %s)", logging.Level())
+	}
+}
+
+func describeRouting(a config.Archive) string {
+	var parts []string
+	if a.PathPrefix != "" {
+		parts = append(parts, "prefix "+a.PathPrefix)
+	}
+	if len(a.Hosts) > 0 {
+		parts = append(parts, "hosts "+strings.Join(a.Hosts, ","))
+	}
+	if len(parts) == 0 {
+		return " (default)"
+	}
+	return " (" + strings.Join(parts, "; ") + ")"
 }
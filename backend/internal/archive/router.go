@@ -0,0 +1,78 @@
+package archive
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/epstein-files/backend/internal/config"
+)
+
+// Router dispatches requests to the handler of the archive they address:
+// first by Host header, then by path prefix, then to the default archive.
+type Router struct {
+	byHost   map[string]http.Handler
+	prefixes []prefixRoute
+	fallback http.Handler
+}
+
+type prefixRoute struct {
+	prefix  string
+	handler http.Handler
+}
+
+func NewRouter() *Router {
+	return &Router{byHost: make(map[string]http.Handler)}
+}
+
+// Add registers the handler serving an archive
+func (rt *Router) Add(a config.Archive, h http.Handler) {
+	for _, host := range a.Hosts {
+		rt.byHost[strings.ToLower(host)] = h
+	}
+	if a.PathPrefix != "" {
+		rt.prefixes = append(rt.prefixes, prefixRoute{
+			prefix:  a.PathPrefix,
+			handler: withPrefix(a.PathPrefix, h),
+		})
+	}
+	if len(a.Hosts) == 0 && a.PathPrefix == "" && rt.fallback == nil {
+		rt.fallback = h
+	}
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if h, ok := rt.byHost[strings.ToLower(host)]; ok {
+		h.ServeHTTP(w, r)
+		return
+	}
+
+	for _, p := range rt.prefixes {
+		if r.URL.Path == p.prefix || strings.HasPrefix(r.URL.Path, p.prefix+"/") {
+			p.handler.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	if rt.fallback != nil {
+		rt.fallback.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte(`{"error":"Unknown archive"}`))
+}
+
+// withPrefix strips the archive prefix and records it in X-Forwarded-Prefix
+// so handlers can build absolute URLs back to this archive.
+func withPrefix(prefix string, h http.Handler) http.Handler {
+	strip := http.StripPrefix(prefix, h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Set("X-Forwarded-Prefix", prefix)
+		strip.ServeHTTP(w, r)
+	})
+}
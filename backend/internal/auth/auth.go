@@ -0,0 +1,403 @@
+// Package auth signs admins in through single sign-on: OpenID Connect
+// providers (Google, Keycloak, ...) and GitHub. A login redirects to the
+// provider with its state, nonce and PKCE verifier kept in a signed cookie;
+// the callback checks them, maps the user's groups and email to roles and
+// stores a session, whose random token the browser keeps in a cookie.
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/epstein-files/backend/internal/config"
+	"github.com/epstein-files/backend/internal/middleware"
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/repository"
+)
+
+const (
+	sessionCookie = "archive_session"
+	loginCookie   = "archive_login"
+	loginTimeout  = 10 * time.Minute // to come back from the provider
+
+	// ActorToken is the audit log's name for requests made with ADMIN_TOKEN
+	ActorToken = "admin-token"
+)
+
+var (
+	// ErrUnknownProvider is a login or callback for a provider not configured
+	ErrUnknownProvider = errors.New("unknown provider")
+	// ErrLoginState is a callback without the login it answers: expired,
+	// from another browser, or forged
+	ErrLoginState = errors.New("login expired or invalid, sign in again")
+	// ErrNoRole is a user the provider vouched for but no role maps
+	ErrNoRole = errors.New("no role is granted to this account")
+)
+
+// Identity is who a provider says the user is
+type Identity struct {
+	Subject       string
+	Name          string
+	Email         string
+	EmailVerified bool
+	Groups        []string
+}
+
+// provider is one kind of identity provider
+type provider interface {
+	// authURL is where the browser is sent to sign in
+	authURL(ctx context.Context, redirect, state, nonce, verifier string) (string, error)
+	// identify redeems the callback's code for the user's identity
+	identify(ctx context.Context, redirect, code, verifier, nonce string) (*Identity, error)
+}
+
+// ProviderInfo is a provider as the login page lists it
+type ProviderInfo struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Service handles logins and sessions for one archive
+type Service struct {
+	providers map[string]provider
+	configs   map[string]config.AuthProvider
+	list      []ProviderInfo
+
+	repo      *repository.Repository
+	key       []byte // signs login state
+	ttl       time.Duration
+	publicURL string   // "" to use the request's host
+	prefix    string   // the archive's path prefix
+	origins   []string // besides this server, where logins may return to
+}
+
+// New sets up the configured providers. Nothing is fetched until the first
+// login, so a provider being down doesn't keep the server from starting.
+func New(cfg *config.Config, providers []config.AuthProvider, repo *repository.Repository, key []byte, client *http.Client) *Service {
+	s := &Service{
+		providers: make(map[string]provider),
+		configs:   make(map[string]config.AuthProvider),
+		repo:      repo,
+		key:       key,
+		ttl:       cfg.SessionTTL(),
+		publicURL: cfg.AuthPublicURL,
+		prefix:    cfg.ArchivePath,
+		origins:   cfg.CORSAllowedOrigins,
+	}
+	for _, p := range providers {
+		switch p.Type {
+		case config.ProviderGitHub:
+			s.providers[p.ID] = newGitHub(p, client)
+		default:
+			s.providers[p.ID] = newOIDC(p, client)
+		}
+		s.configs[p.ID] = p
+		s.list = append(s.list, ProviderInfo{ID: p.ID, Name: p.Name})
+	}
+	return s
+}
+
+// Providers lists the providers admins can sign in with
+func (s *Service) Providers() []ProviderInfo {
+	return s.list
+}
+
+// loginState is what the login cookie carries to the callback
+type loginState struct {
+	Provider string `json:"p"`
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"`
+	ReturnTo string `json:"r"`
+	Expires  int64  `json:"e"`
+}
+
+// Login starts signing in with a provider and returns the URL to send the
+// browser to. returnTo is where the callback sends it on afterwards: a path
+// on this server or a URL on one of the CORS origins.
+func (s *Service) Login(w http.ResponseWriter, r *http.Request, id, returnTo string) (string, error) {
+	p, ok := s.providers[id]
+	if !ok {
+		return "", ErrUnknownProvider
+	}
+	if returnTo == "" {
+		returnTo = s.prefix + "/api/auth/session"
+	}
+	if !s.allowedReturn(returnTo) {
+		return "", fmt.Errorf("return_to must be a path on this server or a URL on an allowed origin")
+	}
+
+	state := loginState{
+		Provider: id,
+		State:    randomToken(),
+		Nonce:    randomToken(),
+		Verifier: randomToken() + randomToken(),
+		ReturnTo: returnTo,
+		Expires:  time.Now().Add(loginTimeout).Unix(),
+	}
+	dest, err := p.authURL(r.Context(), s.redirectURL(r, id), state.State, state.Nonce, state.Verifier)
+	if err != nil {
+		return "", err
+	}
+
+	data, _ := json.Marshal(state)
+	value := base64.RawURLEncoding.EncodeToString(data)
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginCookie,
+		Value:    value + "." + s.sign(value),
+		Path:     s.prefix + "/api/auth/",
+		MaxAge:   int(loginTimeout.Seconds()),
+		HttpOnly: true,
+		Secure:   s.secure(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return dest, nil
+}
+
+// Callback finishes a login: it checks the state the provider sent back,
+// redeems the code, and signs the user in with the roles they map to. It
+// returns the session and where to send the browser.
+func (s *Service) Callback(w http.ResponseWriter, r *http.Request, id string) (*models.Session, string, error) {
+	p, ok := s.providers[id]
+	if !ok {
+		return nil, "", ErrUnknownProvider
+	}
+	state, err := s.readLogin(r)
+	http.SetCookie(w, &http.Cookie{Name: loginCookie, Path: s.prefix + "/api/auth/", MaxAge: -1})
+	if err != nil || state.Provider != id ||
+		subtle.ConstantTimeCompare([]byte(state.State), []byte(r.URL.Query().Get("state"))) != 1 {
+		return nil, "", ErrLoginState
+	}
+	if e := r.URL.Query().Get("error"); e != "" {
+		return nil, "", fmt.Errorf("provider refused the login: %s %s", e, r.URL.Query().Get("error_description"))
+	}
+
+	who, err := p.identify(r.Context(), s.redirectURL(r, id), r.URL.Query().Get("code"), state.Verifier, state.Nonce)
+	if err != nil {
+		return nil, "", err
+	}
+	roles := rolesFor(s.configs[id], who)
+	if len(roles) == 0 {
+		return nil, "", ErrNoRole
+	}
+
+	token := randomToken()
+	session := &models.Session{
+		ID:        hashToken(token),
+		Provider:  id,
+		Subject:   who.Subject,
+		Name:      who.Name,
+		Email:     who.Email,
+		Roles:     strings.Join(roles, ","),
+		ExpiresAt: time.Now().Add(s.ttl),
+	}
+	if err := s.repo.WithContext(r.Context()).CreateSession(session); err != nil {
+		return nil, "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     s.prefix + "/api/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   s.secure(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return session, state.ReturnTo, nil
+}
+
+// Session is the request's signed-in session, nil when there is none
+func (s *Service) Session(r *http.Request) (*models.Session, error) {
+	if s == nil {
+		return nil, nil
+	}
+	if session, ok := r.Context().Value(sessionKey{}).(*models.Session); ok {
+		return session, nil
+	}
+	c, err := r.Cookie(sessionCookie)
+	if err != nil || c.Value == "" {
+		return nil, nil
+	}
+	return s.repo.WithContext(r.Context()).GetSession(hashToken(c.Value))
+}
+
+// Logout ends the request's session and clears its cookie
+func (s *Service) Logout(w http.ResponseWriter, r *http.Request) error {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: s.prefix + "/api/", MaxAge: -1})
+	c, err := r.Cookie(sessionCookie)
+	if err != nil || c.Value == "" {
+		return nil
+	}
+	return s.repo.WithContext(r.Context()).DeleteSession(hashToken(c.Value))
+}
+
+type sessionKey struct{}
+type actorKey struct{}
+
+// Admin lets through requests with "Authorization: Bearer <token>" (when a
+// token is set) or from a session with the admin role. A session's writes
+// must also send an X-Requested-With header, which a cross-site form can't,
+// so another site can't make them with the browser's cookie. s may be nil
+// when single sign-on is off.
+func (s *Service) Admin(token string) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token != "" && strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+				sent := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+				if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) == 1 {
+					next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), actorKey{}, ActorToken)))
+					return
+				}
+			}
+
+			session, err := s.Session(r)
+			switch {
+			case err != nil:
+				writeError(w, http.StatusInternalServerError, err.Error())
+			case session == nil:
+				writeError(w, http.StatusUnauthorized, "Unauthorized")
+			case !session.HasRole(config.AuthRoleAdmin):
+				writeError(w, http.StatusForbidden, "Forbidden")
+			case r.Method != http.MethodGet && r.Method != http.MethodHead && r.Header.Get("X-Requested-With") == "":
+				writeError(w, http.StatusForbidden, "X-Requested-With header required")
+			default:
+				ctx := context.WithValue(r.Context(), sessionKey{}, session)
+				ctx = context.WithValue(ctx, actorKey{}, session.Actor())
+				next.ServeHTTP(w, r.WithContext(ctx))
+			}
+		})
+	}
+}
+
+// Actor names who is making an admin request, for the audit log
+func Actor(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// rolesFor maps the user's groups, verified email and its "@domain" to the
+// roles the provider's configuration grants them
+func rolesFor(p config.AuthProvider, who *Identity) []string {
+	keys := append([]string(nil), who.Groups...)
+	if who.EmailVerified && who.Email != "" {
+		keys = append(keys, who.Email)
+		if at := strings.LastIndex(who.Email, "@"); at >= 0 {
+			keys = append(keys, who.Email[at:])
+		}
+	}
+
+	granted := make(map[string]bool)
+	for _, k := range keys {
+		for _, role := range p.Roles[strings.ToLower(k)] {
+			granted[role] = true
+		}
+	}
+	roles := make([]string, 0, len(granted))
+	for role := range granted {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+func (s *Service) readLogin(r *http.Request) (*loginState, error) {
+	c, err := r.Cookie(loginCookie)
+	if err != nil {
+		return nil, err
+	}
+	value, sig, ok := strings.Cut(c.Value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.sign(value))) {
+		return nil, ErrLoginState
+	}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var state loginState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	if time.Now().Unix() > state.Expires {
+		return nil, ErrLoginState
+	}
+	return &state, nil
+}
+
+func (s *Service) sign(value string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// redirectURL is the provider's callback on this server
+func (s *Service) redirectURL(r *http.Request, id string) string {
+	base := s.publicURL
+	if base == "" {
+		scheme := "http"
+		if s.secure(r) {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host
+	}
+	return base + s.prefix + "/api/auth/" + url.PathEscape(id) + "/callback"
+}
+
+// secure reports whether the browser reaches the server over HTTPS, so
+// cookies are only sent back that way
+func (s *Service) secure(r *http.Request) bool {
+	if s.publicURL != "" {
+		return strings.HasPrefix(s.publicURL, "https://")
+	}
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+// allowedReturn accepts paths on this server and URLs on the configured
+// origins, so a login can't be used to send users elsewhere
+func (s *Service) allowedReturn(to string) bool {
+	if strings.HasPrefix(to, "/") {
+		return !strings.HasPrefix(to, "//") && !strings.HasPrefix(to, "/\\")
+	}
+	u, err := url.Parse(to)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	origin := u.Scheme + "://" + u.Host
+	for _, o := range s.origins {
+		if o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
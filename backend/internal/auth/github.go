@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/epstein-files/backend/internal/config"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+)
+
+const githubAPI = "https://api.github.com"
+
+// githubProvider signs in with GitHub OAuth. GitHub has no ID token, so who
+// the user is, their verified email and their orgs and teams come from its
+// API; the orgs and "org/team" slugs are the groups roles map from.
+type githubProvider struct {
+	cfg    config.AuthProvider
+	client *http.Client
+}
+
+func newGitHub(cfg config.AuthProvider, client *http.Client) *githubProvider {
+	return &githubProvider{cfg: cfg, client: client}
+}
+
+func (p *githubProvider) oauth(redirect string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		Endpoint:     github.Endpoint,
+		RedirectURL:  redirect,
+		Scopes:       append([]string{"read:user", "user:email", "read:org"}, p.cfg.Scopes...),
+	}
+}
+
+func (p *githubProvider) authURL(_ context.Context, redirect, state, _, verifier string) (string, error) {
+	return p.oauth(redirect).AuthCodeURL(state, oauth2.S256ChallengeOption(verifier)), nil
+}
+
+func (p *githubProvider) identify(ctx context.Context, redirect, code, verifier, _ string) (*Identity, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	conf := p.oauth(redirect)
+	token, err := conf.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("redeem code: %w", err)
+	}
+	client := conf.Client(ctx, token)
+
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+	if err := getJSON(ctx, client, "/user", &user); err != nil {
+		return nil, err
+	}
+	who := &Identity{Subject: strconv.FormatInt(user.ID, 10), Name: user.Name}
+	if who.Name == "" {
+		who.Name = user.Login
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, client, "/user/emails", &emails); err != nil {
+		return nil, err
+	}
+	for _, e := range emails {
+		if e.Primary {
+			who.Email, who.EmailVerified = e.Email, e.Verified
+		}
+	}
+
+	var orgs []struct {
+		Login string `json:"login"`
+	}
+	if err := getJSON(ctx, client, "/user/orgs?per_page=100", &orgs); err != nil {
+		return nil, err
+	}
+	for _, o := range orgs {
+		who.Groups = append(who.Groups, o.Login)
+	}
+	var teams []struct {
+		Slug         string `json:"slug"`
+		Organization struct {
+			Login string `json:"login"`
+		} `json:"organization"`
+	}
+	if err := getJSON(ctx, client, "/user/teams?per_page=100", &teams); err != nil {
+		return nil, err
+	}
+	for _, t := range teams {
+		who.Groups = append(who.Groups, t.Organization.Login+"/"+t.Slug)
+	}
+	return who, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, githubAPI+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("github %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("github %s: %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
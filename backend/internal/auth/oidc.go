@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/epstein-files/backend/internal/config"
+	"golang.org/x/oauth2"
+)
+
+// oidcProvider signs in with an OpenID Connect issuer, whose configuration
+// is discovered on first use
+type oidcProvider struct {
+	cfg    config.AuthProvider
+	client *http.Client
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func newOIDC(cfg config.AuthProvider, client *http.Client) *oidcProvider {
+	return &oidcProvider{cfg: cfg, client: client}
+}
+
+func (p *oidcProvider) discover(ctx context.Context) (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.provider == nil {
+		provider, err := oidc.NewProvider(oidc.ClientContext(ctx, p.client), p.cfg.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("discover %s: %w", p.cfg.Issuer, err)
+		}
+		p.provider = provider
+	}
+	return p.provider, nil
+}
+
+func (p *oidcProvider) oauth(ctx context.Context, redirect string) (*oauth2.Config, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  redirect,
+		Scopes:       append([]string{oidc.ScopeOpenID, "email", "profile"}, p.cfg.Scopes...),
+	}, nil
+}
+
+func (p *oidcProvider) authURL(ctx context.Context, redirect, state, nonce, verifier string) (string, error) {
+	conf, err := p.oauth(ctx, redirect)
+	if err != nil {
+		return "", err
+	}
+	return conf.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+func (p *oidcProvider) identify(ctx context.Context, redirect, code, verifier, nonce string) (*Identity, error) {
+	conf, err := p.oauth(ctx, redirect)
+	if err != nil {
+		return nil, err
+	}
+	ctx = oidc.ClientContext(ctx, p.client)
+	token, err := conf.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("redeem code: %w", err)
+	}
+	raw, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("%s returned no ID token", p.cfg.Issuer)
+	}
+	idToken, err := p.provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID}).Verify(ctx, raw)
+	if err != nil {
+		return nil, fmt.Errorf("verify ID token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, ErrLoginState
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("read ID token: %w", err)
+	}
+	who := &Identity{Subject: idToken.Subject}
+	who.Name, _ = claims["name"].(string)
+	who.Email, _ = claims["email"].(string)
+	// Some issuers send email_verified as a string
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		who.EmailVerified = v
+	case string:
+		who.EmailVerified = v == "true"
+	}
+	switch groups := claims[p.cfg.GroupsClaim].(type) {
+	case []any:
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				who.Groups = append(who.Groups, s)
+			}
+		}
+	case string:
+		who.Groups = []string{groups}
+	}
+	if who.Name == "" {
+		who.Name = who.Email
+	}
+	return who, nil
+}
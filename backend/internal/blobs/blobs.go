@@ -0,0 +1,229 @@
+// Package blobs keeps source PDFs and extracted images in a content-addressed
+// store: each file under its SHA-256 once, however many documents or images
+// share it, served at /api/blobs/{sha256} with URLs that never change. The
+// import job copies files from the ingest layout into it and points their
+// documents and images at them; the garbage collection deletes the blobs
+// nothing refers to any more.
+package blobs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/epstein-files/backend/internal/jobs"
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/repository"
+	"github.com/epstein-files/backend/internal/storage"
+)
+
+// Job types
+const (
+	ImportJobType = "blobs-import"
+	GCJobType     = "blobs-gc"
+)
+
+const batchSize = 100
+
+var hashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ValidHash reports whether s is a lowercase hex SHA-256
+func ValidHash(s string) bool {
+	return hashPattern.MatchString(s)
+}
+
+// Put stores r's content in the blob store unless it's already there, and
+// returns the blob, not yet referenced
+func Put(ctx context.Context, w storage.Writer, r io.Reader, contentType string) (*models.Blob, error) {
+	// Hash to a temporary file first: the key depends on the content
+	tmp, err := os.CreateTemp("", "blob-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err != nil {
+		return nil, err
+	}
+	blob := &models.Blob{SHA256: hex.EncodeToString(h.Sum(nil)), Size: size, ContentType: contentType}
+
+	key := storage.BlobKey(blob.SHA256)
+	if ok, err := w.Exists(ctx, key); err != nil || ok {
+		return blob, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return blob, w.Put(ctx, key, tmp)
+}
+
+// ImportJob copies every document's PDF and every image from store into the
+// blob store, documents first, and references them. Files already
+// referenced under the hash recorded at ingest are skipped; a file whose
+// content doesn't match that hash is logged and counted as failed. Running
+// it again after an ingest picks up new and changed files.
+func ImportJob(repo *repository.Repository, store storage.Store, blobs storage.Writer) jobs.Handler {
+	return func(ctx context.Context, job *models.Job, p *jobs.Progress) error {
+		repo := repo.WithContext(ctx)
+
+		if job.Total == 0 {
+			total, err := repo.CountBlobCandidates()
+			if err != nil {
+				return err
+			}
+			job.Total = total
+		}
+		if job.Result == nil {
+			job.Result = models.JSON{"phase": models.BlobDocument, "imported": 0, "bytes": 0}
+		}
+		imported, bytes := jobs.ParamInt(job.Result, "imported"), int64(jobs.ParamInt(job.Result, "bytes"))
+
+		for _, kind := range []string{models.BlobDocument, models.BlobImage} {
+			if kind == models.BlobDocument && job.Result["phase"] == models.BlobImage {
+				continue // done before a restart
+			}
+			if job.Result["phase"] != kind {
+				job.Result["phase"], job.Cursor = kind, 0
+			}
+
+			for {
+				batch, err := repo.GetBlobCandidates(kind, job.Cursor, batchSize)
+				if err != nil {
+					return err
+				}
+				if len(batch) == 0 {
+					break
+				}
+
+				owners := make([]string, len(batch))
+				for i, c := range batch {
+					owners[i] = c.Owner
+				}
+				refs, err := repo.GetBlobRefs(kind, owners)
+				if err != nil {
+					return err
+				}
+
+				for _, c := range batch {
+					if err := ctx.Err(); err != nil {
+						return err
+					}
+					if c.SHA256 == "" || refs[c.Owner] != c.SHA256 {
+						blob, err := importFile(ctx, store, blobs, kind, c)
+						if err == nil {
+							err = repo.AddBlobRef(blob, kind, c.Owner)
+						}
+						if err == nil {
+							imported++
+							bytes += blob.Size
+						} else {
+							log.Printf("Blob import %s %s: %v", kind, c.Owner, err)
+							job.Failed++
+						}
+					}
+					job.Processed++
+					job.Cursor = c.RowID
+				}
+
+				job.Result["imported"], job.Result["bytes"] = imported, bytes
+				if err := p.Save(); err != nil {
+					return err
+				}
+			}
+		}
+		return p.Save()
+	}
+}
+
+func importFile(ctx context.Context, store storage.Store, blobs storage.Writer, kind string, c models.BlobCandidate) (*models.Blob, error) {
+	key, contentType := storage.DocumentKey(c.Filename), "application/pdf"
+	if kind == models.BlobImage {
+		key, contentType = storage.ImageKey(c.DocumentID, c.Filename), mime.TypeByExtension(filepath.Ext(c.Filename))
+	}
+	rc, err := store.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	blob, err := Put(ctx, blobs, rc, contentType)
+	if err != nil {
+		return nil, err
+	}
+	if c.SHA256 != "" && blob.SHA256 != c.SHA256 {
+		return nil, fmt.Errorf("content hashes to %s, ingest recorded %s", blob.SHA256, c.SHA256)
+	}
+	return blob, nil
+}
+
+// GCJob drops the references of deleted documents and images, then deletes
+// the blobs nothing refers to. Under legal hold the files stay and are
+// counted as failed. Only this archive's references are counted, so blobs
+// must be its own store, which the per-archive files directory sees to.
+func GCJob(repo *repository.Repository, blobs storage.Writer) jobs.Handler {
+	return func(ctx context.Context, job *models.Job, p *jobs.Progress) error {
+		repo := repo.WithContext(ctx)
+
+		dropped, err := repo.PruneBlobRefs()
+		if err != nil {
+			return err
+		}
+		var deleted, bytes int64
+		job.Result = models.JSON{"refs_dropped": dropped, "deleted": 0, "bytes": 0}
+
+		seen := make(map[string]bool) // kept ones, so the loop ends
+		for {
+			orphans, err := repo.GetOrphanBlobs(batchSize + len(seen))
+			if err != nil {
+				return err
+			}
+			var batch []models.Blob
+			for _, b := range orphans {
+				if !seen[b.SHA256] {
+					batch = append(batch, b)
+				}
+			}
+			if len(batch) == 0 {
+				break
+			}
+			job.Total += int64(len(batch))
+
+			for _, b := range batch {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				err := blobs.Delete(ctx, storage.BlobKey(b.SHA256))
+				if err == nil || errors.Is(err, storage.ErrNotFound) {
+					var ok bool
+					if ok, err = repo.DeleteBlob(b.SHA256); ok {
+						deleted++
+						bytes += b.Size
+					}
+				}
+				if err != nil {
+					log.Printf("Blob GC %s: %v", b.SHA256, err)
+					job.Failed++
+				}
+				seen[b.SHA256] = true
+				job.Processed++
+			}
+
+			job.Result["deleted"], job.Result["bytes"] = deleted, bytes
+			if err := p.Save(); err != nil {
+				return err
+			}
+		}
+		return p.Save()
+	}
+}
@@ -0,0 +1,63 @@
+// Package buildinfo reports which build of the backend is running. Release
+// builds set the variables at link time:
+//
+//	go build -ldflags "-X github.com/epstein-files/backend/internal/buildinfo.Version=v1.4.0 \
+//	  -X github.com/epstein-files/backend/internal/buildinfo.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/epstein-files/backend/internal/buildinfo.BuildDate=$(date -u +%FT%TZ)" ./cmd/server
+//
+// Without them, the commit and its date come from the VCS stamp Go records when
+// building inside a git checkout.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+var (
+	Version   = "0.0.0-dev" // semver
+	Commit    = ""
+	BuildDate = ""
+)
+
+// Info is the build, as reported by /api/health
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+	Modified  bool   `json:"modified,omitempty"` // built from a checkout with uncommitted changes
+}
+
+var (
+	once sync.Once
+	info Info
+)
+
+// Get returns the build info, filling in what the linker didn't set from the
+// VCS stamp
+func Get() Info {
+	once.Do(func() {
+		info = Info{Version: Version, Commit: Commit, BuildDate: BuildDate, GoVersion: runtime.Version()}
+		bi, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true" && Commit == ""
+			}
+		}
+	})
+	return info
+}
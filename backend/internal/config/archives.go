@@ -0,0 +1,98 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Archive is one document collection served by this instance. Requests are
+// routed to an archive by hostname or path prefix; an archive with neither is
+// the default and receives everything else.
+type Archive struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	DatabaseURL string   `json:"database_url"`
+	PathPrefix  string   `json:"path_prefix,omitempty"` // e.g. "/epstein" serves /epstein/api/...
+	Hosts       []string `json:"hosts,omitempty"`       // e.g. ["epstein.example.org"]
+
+	// Base URL of the primary to mirror, e.g. "https://archive.example.org/epstein"
+	SyncPrimaryURL string `json:"sync_primary_url,omitempty"`
+
+	// Where the archive's files are kept, as FILES_DIR, STORAGE_BASE_URL and
+	// COLD_STORAGE_DIR are for a single archive. Each defaults to a directory
+	// (or URL path) named after the archive under the instance's setting,
+	// e.g. "<FILES_DIR>/epstein", as file names and dataset numbers repeat
+	// across archives.
+	FilesDir       string `json:"files_dir,omitempty"`
+	StorageBaseURL string `json:"storage_base_url,omitempty"`
+	ColdStorageDir string `json:"cold_storage_dir,omitempty"`
+}
+
+// LoadArchives reads ARCHIVES_CONFIG (a JSON array of archives). Without it
+// the instance serves a single default archive backed by DATABASE_URL.
+func LoadArchives(cfg *Config) ([]Archive, error) {
+	path := os.Getenv("ARCHIVES_CONFIG")
+	if path == "" {
+		return []Archive{{
+			ID: "default", Name: "default", DatabaseURL: cfg.DatabaseURL, SyncPrimaryURL: cfg.SyncPrimaryURL,
+			FilesDir: cfg.FilesDir, StorageBaseURL: cfg.StorageBaseURL, ColdStorageDir: cfg.ColdStorageDir,
+		}}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read archives config: %w", err)
+	}
+
+	var archives []Archive
+	if err := json.Unmarshal(data, &archives); err != nil {
+		return nil, fmt.Errorf("parse archives config: %w", err)
+	}
+	if len(archives) == 0 {
+		return nil, fmt.Errorf("archives config %s lists no archives", path)
+	}
+
+	seen := make(map[string]bool)
+	dirs := make(map[string]string) // files and cold storage directories, by archive
+	for i := range archives {
+		a := &archives[i]
+		if a.ID == "" || a.DatabaseURL == "" {
+			return nil, fmt.Errorf("archive %d: id and database_url are required", i)
+		}
+		if seen[a.ID] {
+			return nil, fmt.Errorf("archive %q is listed twice", a.ID)
+		}
+		seen[a.ID] = true
+
+		if a.PathPrefix != "" {
+			a.PathPrefix = "/" + strings.Trim(a.PathPrefix, "/")
+		}
+		if a.Name == "" {
+			a.Name = a.ID
+		}
+
+		if a.FilesDir == "" {
+			a.FilesDir = filepath.Join(cfg.FilesDir, a.ID)
+		}
+		if a.StorageBaseURL == "" && cfg.StorageBaseURL != "" {
+			a.StorageBaseURL = strings.TrimSuffix(cfg.StorageBaseURL, "/") + "/" + a.ID
+		}
+		if a.ColdStorageDir == "" && cfg.ColdStorageDir != "" {
+			a.ColdStorageDir = filepath.Join(cfg.ColdStorageDir, a.ID)
+		}
+		for _, dir := range []string{a.FilesDir, a.ColdStorageDir} {
+			if dir == "" {
+				continue
+			}
+			dir = filepath.Clean(dir)
+			if other, ok := dirs[dir]; ok {
+				return nil, fmt.Errorf("archives %q and %q both keep files in %s", other, a.ID, dir)
+			}
+			dirs[dir] = a.ID
+		}
+	}
+	return archives, nil
+}
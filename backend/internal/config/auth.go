@@ -0,0 +1,110 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Roles a single sign-on user can be given
+const (
+	AuthRoleAdmin = "admin" // the /api/admin routes
+)
+
+// Single sign-on provider types
+const (
+	ProviderOIDC   = "oidc"   // any OpenID Connect issuer: Google, Keycloak, ...
+	ProviderGitHub = "github" // GitHub OAuth, which has no OpenID Connect login
+)
+
+// AuthProvider is one identity provider admins can sign in with
+type AuthProvider struct {
+	ID   string `json:"id"`             // in the login URL, e.g. /api/auth/google/login
+	Type string `json:"type,omitempty"` // "oidc" (the default) or "github"
+	Name string `json:"name,omitempty"` // shown on the login page
+
+	Issuer          string   `json:"issuer,omitempty"` // oidc, e.g. "https://accounts.google.com"
+	ClientID        string   `json:"client_id"`
+	ClientSecret    string   `json:"client_secret,omitempty"`
+	ClientSecretEnv string   `json:"client_secret_env,omitempty"` // variable holding the secret instead
+	Scopes          []string `json:"scopes,omitempty"`            // beyond the provider's defaults
+	GroupsClaim     string   `json:"groups_claim,omitempty"`      // oidc, "groups" by default
+
+	// What a user gets: from a group (an ID token group, or a GitHub
+	// "org" or "org/team"), a verified email address or "@domain" to the
+	// roles it grants. Users matching none can't sign in.
+	Roles map[string][]string `json:"roles"`
+}
+
+// LoadAuthProviders reads AUTH_CONFIG, a JSON array of providers; single
+// sign-on is off without it
+func LoadAuthProviders(cfg *Config) ([]AuthProvider, error) {
+	if cfg.AuthConfig == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(cfg.AuthConfig)
+	if err != nil {
+		return nil, fmt.Errorf("read auth config: %w", err)
+	}
+	var providers []AuthProvider
+	if err := json.Unmarshal(data, &providers); err != nil {
+		return nil, fmt.Errorf("parse auth config: %w", err)
+	}
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("auth config %s lists no providers", cfg.AuthConfig)
+	}
+
+	seen := make(map[string]bool)
+	for i := range providers {
+		p := &providers[i]
+		if p.ID == "" || p.ClientID == "" {
+			return nil, fmt.Errorf("provider %d: id and client_id are required", i)
+		}
+		if seen[p.ID] {
+			return nil, fmt.Errorf("provider %q is listed twice", p.ID)
+		}
+		seen[p.ID] = true
+
+		if p.Type == "" {
+			p.Type = ProviderOIDC
+		}
+		switch p.Type {
+		case ProviderOIDC:
+			if p.Issuer == "" {
+				return nil, fmt.Errorf("provider %q: issuer is required", p.ID)
+			}
+			if p.GroupsClaim == "" {
+				p.GroupsClaim = "groups"
+			}
+		case ProviderGitHub:
+		default:
+			return nil, fmt.Errorf("provider %q: unknown type %q, expected oidc or github", p.ID, p.Type)
+		}
+		if p.ClientSecretEnv != "" {
+			p.ClientSecret = os.Getenv(p.ClientSecretEnv)
+		}
+		if p.ClientSecret == "" {
+			return nil, fmt.Errorf("provider %q: client_secret (or the variable client_secret_env names) is required", p.ID)
+		}
+		if p.Name == "" {
+			p.Name = p.ID
+		}
+
+		if len(p.Roles) == 0 {
+			return nil, fmt.Errorf("provider %q: roles maps no one, so no one could sign in", p.ID)
+		}
+		roles := make(map[string][]string, len(p.Roles))
+		for match, granted := range p.Roles {
+			for _, role := range granted {
+				if role != AuthRoleAdmin {
+					return nil, fmt.Errorf("provider %q: unknown role %q for %q, expected admin", p.ID, role, match)
+				}
+			}
+			roles[strings.ToLower(match)] = granted
+		}
+		p.Roles = roles
+	}
+	return providers, nil
+}
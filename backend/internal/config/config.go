@@ -2,15 +2,221 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/epstein-files/backend/internal/models"
+)
+
+// Process roles (ROLE)
+const (
+	RoleAPI    = "api"    // serves requests and queues jobs
+	RoleWorker = "worker" // runs jobs and the schedules that queue them
+	RoleAll    = "all"    // both, in one process
 )
 
 type Config struct {
 	Port        string
 	DatabaseURL string
+	ArchiveID   string // set per archive when serving several (see archives.go)
+	ArchivePath string // the archive's path prefix, likewise
+
+	// What this process does; several can share a database and job queue,
+	// each worker with a WorkerID of its own (the hostname by default)
+	Role     string
+	WorkerID string
+
+	// Safe mode: images classified as sensitive are blurred (or omitted)
+	SafeModeDefault bool   // safe mode applies unless a request sends safe_mode=false
+	SafeModeAction  string // "blur" or "omit"
+
+	// CORS
+	CORSAllowedOrigins   []string // exact, wildcard subdomain ("https://*.example.org") or "*"
+	CORSAllowCredentials bool
+	CORSPublicPaths      []string // route prefixes open to any origin without credentials
+
+	// Cache-Control by route class (see middleware.CachePolicies); an empty
+	// policy leaves it to the handlers
+	CachePolicies map[string]string
+
+	// debug, info, warn, error or silent (see internal/logging)
+	LogLevel string
+
+	// Analytics snapshot: a VACUUM INTO copy of the database rebuilt periodically
+	SnapshotDir           string
+	SnapshotIntervalHours int // 0 disables the snapshot job
+
+	// Transparency report, written next to the snapshot (0 disables the schedule)
+	StatsReportIntervalHours int
+
+	// Base64 Ed25519 key used to sign /api/export/manifest; unsigned when empty
+	ManifestSigningKey string
+
+	// Background export downloads (POST /api/exports): the key signing their
+	// tokens, generated and kept next to the snapshots when empty, and how
+	// long a token stays valid
+	ExportTokenSecret   string
+	ExportTokenTTLHours int
+
+	// Mirror sync: a primary serves its change feed to holders of SyncToken;
+	// a mirror sets SyncPrimaryURL and pulls from it with the same token
+	SyncToken           string
+	SyncPrimaryURL      string
+	SyncIntervalSeconds int
+
+	// Bearer token for /api/admin; admin routes are disabled when empty
+	// unless single sign-on is configured
+	AdminToken string
+
+	// Single sign-on for the admin routes (see auth.go): the providers
+	// file, the URL the server is reached at for their callbacks (taken
+	// from the request when empty), how long a session lasts, and the key
+	// signing login state, generated next to the snapshots when empty
+	AuthConfig      string
+	AuthPublicURL   string
+	SessionTTLHours int
+	AuthStateSecret string
+
+	// Where archive files are read from: "cdn" (StorageBaseURL) or "local" (FilesDir)
+	StorageBackend string
+	StorageBaseURL string
+	FilesDir       string // project root holding downloads/ and extracted_images/
+
+	// Interpreter for the Python ingest scripts under FilesDir, run by
+	// re-ingest jobs and backendctl
+	Python string
+
+	// Read replica for public GET routes: "memory" (a copy in RAM, reloaded
+	// when the ingest version changes, checked every ReadReplicaRefreshSeconds)
+	// or "mmap" (read-only memory-mapped connections); "" reads the primary
+	ReadReplica               string
+	ReadReplicaConns          int
+	ReadReplicaMmapMB         int
+	ReadReplicaRefreshSeconds int
+
+	// Lock contention: how long SQLite waits on a lock held by another writer
+	// (an ingest) before failing, and the deadline of public reads. A read
+	// running into either answers 503 with Retry-After.
+	DBBusyTimeoutMS       int
+	RequestTimeoutSeconds int // 0 disables the deadline
+
+	// SQLite checks the schema's foreign keys (images to their document,
+	// tags to their image) on every write
+	ForeignKeys bool
+
+	// Circuit breakers around the expensive endpoints (search, Parquet
+	// exports): over a window of requests, the error or slow-response share
+	// that opens one, the response time counted as slow and how long it
+	// stays open. BreakerMinRequests 0 turns them off.
+	BreakerErrorRate       float64
+	BreakerSlowMS          int
+	BreakerMinRequests     int
+	BreakerWindowSeconds   int
+	BreakerCooldownSeconds int
+
+	// Legal hold: stored files and archive rows are append-only; deletes are
+	// refused and changes are kept as versions
+	LegalHold bool
+
+	// Storage tiering (needs STORAGE_BACKEND=local, off without
+	// ColdStorageDir): source PDFs not read through the API for
+	// TierColdAfterDays move to ColdStorageDir, checked daily (0 leaves it to
+	// admins), and a restored PDF stays hot for at least TierRestoreDays
+	ColdStorageDir    string
+	TierColdAfterDays int
+	TierRestoreDays   int
+
+	// Integrity checks: re-hash a random sample of source PDFs every
+	// VerifyIntervalHours (0 disables) and alert on mismatches
+	VerifyIntervalHours int
+	VerifySamplePercent float64
+	AlertWebhookURL     string
+
+	// Contributor uploads: token -> contributor name; uploads are disabled when empty
+	ContribTokens      map[string]string
+	ContribMaxUploadMB int
+	ContribScanCommand string // e.g. "clamdscan --no-summary"; the file path is appended
+
+	// Near-duplicate documents: estimated text similarity at or above which
+	// two documents are clustered
+	DedupThreshold float64
+
+	// An ingest lock not refreshed for this long is taken to be abandoned;
+	// shared with scripts/ingest_lock.py
+	IngestLockStaleMinutes int
+
+	// Search ranking: BM25 weights of filename (document ID) and body text
+	// matches, relevance multipliers by dataset number, and the order used
+	// when a search names none
+	SearchFilenameWeight float64
+	SearchTextWeight     float64
+	SearchDatasetBoosts  map[int]float64
+	SearchDefaultRank    string
+
+	// Relevance multiplier searches with demote_ocr=true apply to OCR-only
+	// documents whose OCR confidence is below the minimum
+	SearchOCRDemotion      float64
+	SearchOCRMinConfidence float64
+
+	// Search result cache: results are fresh for the TTL, then served stale
+	// for up to the stale period while refreshed in the background. A TTL
+	// of 0 disables the cache.
+	SearchCacheTTLSeconds   int
+	SearchCacheStaleSeconds int
+	SearchCacheSize         int // entries
+
+	// Full-text index tokenizer (applied when the index is created or
+	// rebuilt) and terms dropped from indexed text and search queries
+	FTSRemoveDiacritics int
+	FTSPorter           bool
+	FTSStopwords        map[string]bool
+
+	// Face clustering (scripts/cluster_faces.py): the default for the faces
+	// feature flag
+	FacesEnabled bool
+
+	// Passage retrieval (scripts/embed_passages.py): an OpenAI-compatible
+	// embeddings endpoint and the model the passages were embedded with.
+	// /api/search/passages is off without the endpoint.
+	EmbeddingsAPIURL string
+	EmbeddingsAPIKey string
+	EmbeddingsModel  string
+
+	// Feature flags (internal/features) on for everyone, and the API keys
+	// (CONTRIB_TOKENS names) that get a flag while it's off for others
+	Features    []string
+	FeatureKeys map[string][]string
+
+	// API usage quotas: requests per day and per month allowed to each tier,
+	// the tier of each API key (CONTRIB_TOKENS name) and the tier of keys
+	// not listed. Requests without a key aren't metered.
+	QuotaTiers       map[string]QuotaTier
+	APIKeyTiers      map[string]string
+	QuotaDefaultTier string
+
+	// Opt-in usage statistics (internal/usage): requests and latency per
+	// route and day, kept in the archive's database for UsageStatsDays and
+	// only shown to admins
+	UsageStats     bool
+	UsageStatsDays int
 }
 
+// QuotaTier is a quota tier's request allowance; 0 means unlimited
+type QuotaTier struct {
+	Daily   int64
+	Monthly int64
+}
+
+// Load reads the configuration from the environment, after applying
+// CONFIG_FILE over it (see reload.go)
 func Load() *Config {
+	loadConfigFile()
+	return fromEnv()
+}
+
+func fromEnv() *Config {
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -21,12 +227,169 @@ func Load() *Config {
 		dbURL = "./archive.db"
 	}
 
+	// Same CDN the upload scripts publish to
+	var storageBaseURL string
+	if host := os.Getenv("BUNNY_CDN_HOSTNAME"); host != "" {
+		storageBaseURL = "https://" + host
+	}
+
+	// Contributions stay on by default; faces follows FACES_ENABLED
+	facesEnabled := GetEnvBool("FACES_ENABLED", false)
+	defaultFeatures := []string{"contributions"}
+	if facesEnabled {
+		defaultFeatures = append(defaultFeatures, "faces")
+	}
+
+	safeModeAction := GetEnv("SAFE_MODE_ACTION", "blur")
+	if safeModeAction != "omit" {
+		safeModeAction = "blur"
+	}
+
+	workerID := os.Getenv("WORKER_ID")
+	if workerID == "" {
+		workerID, _ = os.Hostname()
+	}
+
 	return &Config{
-		Port:        port,
-		DatabaseURL: dbURL,
+		Port:            port,
+		DatabaseURL:     dbURL,
+		Role:            GetEnv("ROLE", RoleAll),
+		WorkerID:        workerID,
+		SafeModeDefault: GetEnvBool("SAFE_MODE_DEFAULT", true),
+		SafeModeAction:  safeModeAction,
+
+		CORSAllowedOrigins:   GetEnvList("CORS_ALLOWED_ORIGINS", []string{"*"}),
+		CORSAllowCredentials: GetEnvBool("CORS_ALLOW_CREDENTIALS", false),
+		CORSPublicPaths:      GetEnvList("CORS_PUBLIC_PATHS", []string{"/api/export", "/api/changes"}),
+		CachePolicies:        parseCachePolicies(os.Getenv("CACHE_POLICIES")),
+		LogLevel:             GetEnv("LOG_LEVEL", "info"),
+
+		SnapshotDir:           GetEnv("SNAPSHOT_DIR", "./snapshots"),
+		SnapshotIntervalHours: GetEnvInt("SNAPSHOT_INTERVAL_HOURS", 24),
+
+		StatsReportIntervalHours: GetEnvInt("STATS_REPORT_INTERVAL_HOURS", 168),
+
+		ExportTokenSecret:   os.Getenv("EXPORT_TOKEN_SECRET"),
+		ExportTokenTTLHours: GetEnvInt("EXPORT_TOKEN_TTL_HOURS", 24),
+
+		ManifestSigningKey: os.Getenv("MANIFEST_SIGNING_KEY"),
+
+		SyncToken:           os.Getenv("SYNC_TOKEN"),
+		SyncPrimaryURL:      os.Getenv("SYNC_PRIMARY_URL"),
+		SyncIntervalSeconds: GetEnvInt("SYNC_INTERVAL_SECONDS", 60),
+
+		AdminToken: os.Getenv("ADMIN_TOKEN"),
+
+		AuthConfig:      os.Getenv("AUTH_CONFIG"),
+		AuthPublicURL:   strings.TrimSuffix(os.Getenv("AUTH_PUBLIC_URL"), "/"),
+		SessionTTLHours: GetEnvInt("SESSION_TTL_HOURS", 12),
+		AuthStateSecret: os.Getenv("AUTH_STATE_SECRET"),
+
+		StorageBackend: GetEnv("STORAGE_BACKEND", "cdn"),
+		StorageBaseURL: GetEnv("STORAGE_BASE_URL", storageBaseURL),
+		FilesDir:       GetEnv("FILES_DIR", ".."),
+
+		Python: GetEnv("PYTHON", "python"),
+
+		ReadReplica:               os.Getenv("READ_REPLICA"),
+		ReadReplicaConns:          GetEnvInt("READ_REPLICA_CONNS", 4),
+		ReadReplicaMmapMB:         GetEnvInt("READ_REPLICA_MMAP_MB", 1024),
+		ReadReplicaRefreshSeconds: GetEnvInt("READ_REPLICA_REFRESH_SECONDS", 60),
+
+		DBBusyTimeoutMS:       GetEnvInt("DB_BUSY_TIMEOUT_MS", 5000),
+		RequestTimeoutSeconds: GetEnvInt("REQUEST_TIMEOUT_SECONDS", 10),
+
+		ForeignKeys: GetEnvBool("FOREIGN_KEYS", true),
+
+		BreakerErrorRate:       GetEnvFloat("BREAKER_ERROR_RATE", 0.5),
+		BreakerSlowMS:          GetEnvInt("BREAKER_SLOW_MS", 5000),
+		BreakerMinRequests:     GetEnvInt("BREAKER_MIN_REQUESTS", 20),
+		BreakerWindowSeconds:   GetEnvInt("BREAKER_WINDOW_SECONDS", 60),
+		BreakerCooldownSeconds: GetEnvInt("BREAKER_COOLDOWN_SECONDS", 30),
+
+		LegalHold: GetEnvBool("LEGAL_HOLD", false),
+
+		ColdStorageDir:    os.Getenv("COLD_STORAGE_DIR"),
+		TierColdAfterDays: GetEnvInt("TIER_COLD_AFTER_DAYS", 180),
+		TierRestoreDays:   GetEnvInt("TIER_RESTORE_DAYS", 7),
+
+		VerifyIntervalHours: GetEnvInt("VERIFY_INTERVAL_HOURS", 168),
+		VerifySamplePercent: GetEnvFloat("VERIFY_SAMPLE_PERCENT", 1),
+		AlertWebhookURL:     os.Getenv("ALERT_WEBHOOK_URL"),
+
+		ContribTokens:      parseContribTokens(GetEnvList("CONTRIB_TOKENS", nil)),
+		ContribMaxUploadMB: GetEnvInt("CONTRIB_MAX_UPLOAD_MB", 100),
+		ContribScanCommand: os.Getenv("CONTRIB_SCAN_COMMAND"),
+
+		DedupThreshold: GetEnvFloat("DEDUP_THRESHOLD", 0.8),
+
+		IngestLockStaleMinutes: GetEnvInt("INGEST_LOCK_STALE_MINUTES", 10),
+
+		SearchFilenameWeight: GetEnvFloat("SEARCH_WEIGHT_FILENAME", 10),
+		SearchTextWeight:     GetEnvFloat("SEARCH_WEIGHT_TEXT", 1),
+		SearchDatasetBoosts:  parseDatasetBoosts(GetEnvList("SEARCH_DATASET_BOOSTS", nil)),
+		SearchDefaultRank:    GetEnv("SEARCH_DEFAULT_RANK", "relevance"),
+
+		SearchOCRDemotion:      GetEnvFloat("SEARCH_OCR_DEMOTION", 0.5),
+		SearchOCRMinConfidence: GetEnvFloat("SEARCH_OCR_MIN_CONFIDENCE", 0.8),
+
+		SearchCacheTTLSeconds:   GetEnvInt("SEARCH_CACHE_TTL_SECONDS", 30),
+		SearchCacheStaleSeconds: GetEnvInt("SEARCH_CACHE_STALE_SECONDS", 300),
+		SearchCacheSize:         GetEnvInt("SEARCH_CACHE_SIZE", 1000),
+
+		FTSRemoveDiacritics: GetEnvInt("FTS_REMOVE_DIACRITICS", 2),
+		FTSPorter:           GetEnvBool("FTS_PORTER", false),
+		FTSStopwords:        parseStopwords(GetEnvList("FTS_STOPWORDS", nil)),
+
+		FacesEnabled: facesEnabled,
+
+		EmbeddingsAPIURL: os.Getenv("EMBEDDINGS_API_URL"),
+		EmbeddingsAPIKey: os.Getenv("EMBEDDINGS_API_KEY"),
+		EmbeddingsModel:  GetEnv("EMBEDDINGS_MODEL", "nomic-embed-text"),
+
+		Features:    GetEnvList("FEATURES", defaultFeatures),
+		FeatureKeys: parseFeatureKeys(GetEnvList("FEATURE_KEYS", nil)),
+
+		QuotaTiers:       parseQuotaTiers(GetEnvList("QUOTA_TIERS", nil)),
+		APIKeyTiers:      parseKeyTiers(GetEnvList("API_KEY_TIERS", nil)),
+		QuotaDefaultTier: GetEnv("QUOTA_DEFAULT_TIER", "free"),
+
+		UsageStats:     GetEnvBool("USAGE_STATS", false),
+		UsageStatsDays: GetEnvInt("USAGE_STATS_DAYS", 90),
 	}
 }
 
+func GetEnv(key string, defaultVal string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	return defaultVal
+}
+
+// GetEnvList reads a comma-separated list, ignoring empty entries
+func GetEnvList(key string, defaultVal []string) []string {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal
+	}
+	var list []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func GetEnvBool(key string, defaultVal bool) bool {
+	if val := os.Getenv(key); val != "" {
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b
+		}
+	}
+	return defaultVal
+}
+
 func GetEnvInt(key string, defaultVal int) int {
 	if val := os.Getenv(key); val != "" {
 		if i, err := strconv.Atoi(val); err == nil {
@@ -35,3 +398,213 @@ func GetEnvInt(key string, defaultVal int) int {
 	}
 	return defaultVal
 }
+
+func GetEnvFloat(key string, defaultVal float64) float64 {
+	if val := os.Getenv(key); val != "" {
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return f
+		}
+	}
+	return defaultVal
+}
+
+// parseContribTokens reads "name:token" pairs
+func parseContribTokens(pairs []string) map[string]string {
+	tokens := make(map[string]string)
+	for _, pair := range pairs {
+		name, token, ok := strings.Cut(pair, ":")
+		if ok && name != "" && token != "" {
+			tokens[token] = name
+		}
+	}
+	return tokens
+}
+
+// defaultCachePolicies let a CDN keep public reads for a few minutes and
+// keep admin and signed-in responses out of every cache. Files set their
+// own, and exports are left uncached.
+var defaultCachePolicies = map[string]string{
+	"stats":   "public, max-age=60, s-maxage=300",
+	"lists":   "public, max-age=60, s-maxage=300",
+	"records": "public, max-age=60, s-maxage=300",
+	"search":  "public, max-age=0, s-maxage=60",
+	"files":   "",
+	"exports": "",
+	"admin":   "no-store",
+	"private": "no-store",
+}
+
+// parseCachePolicies reads "class=policy" entries over the defaults,
+// separated by semicolons since policies hold commas, e.g.
+// "search=public, s-maxage=600; lists=no-cache"
+func parseCachePolicies(entries string) map[string]string {
+	policies := make(map[string]string, len(defaultCachePolicies))
+	for class, policy := range defaultCachePolicies {
+		policies[class] = policy
+	}
+	for _, entry := range strings.Split(entries, ";") {
+		class, policy, ok := strings.Cut(entry, "=")
+		if class = strings.TrimSpace(class); ok && class != "" {
+			policies[class] = strings.TrimSpace(policy)
+		}
+	}
+	return policies
+}
+
+// parseFeatureKeys reads "flag:key" pairs, e.g. "faces:alice"
+func parseFeatureKeys(pairs []string) map[string][]string {
+	keys := make(map[string][]string)
+	for _, pair := range pairs {
+		flag, key, ok := strings.Cut(pair, ":")
+		if ok && flag != "" && key != "" {
+			keys[flag] = append(keys[flag], key)
+		}
+	}
+	return keys
+}
+
+// parseQuotaTiers reads "tier:daily:monthly" entries, e.g. "free:1000:20000"
+func parseQuotaTiers(entries []string) map[string]QuotaTier {
+	tiers := make(map[string]QuotaTier)
+	for _, entry := range entries {
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 || parts[0] == "" {
+			continue
+		}
+		daily, err1 := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+		monthly, err2 := strconv.ParseInt(strings.TrimSpace(parts[2]), 10, 64)
+		if err1 != nil || err2 != nil || daily < 0 || monthly < 0 {
+			continue
+		}
+		tiers[parts[0]] = QuotaTier{Daily: daily, Monthly: monthly}
+	}
+	return tiers
+}
+
+// parseKeyTiers reads "key:tier" pairs, e.g. "alice:research"
+func parseKeyTiers(pairs []string) map[string]string {
+	tiers := make(map[string]string)
+	for _, pair := range pairs {
+		key, tier, ok := strings.Cut(pair, ":")
+		if ok && key != "" && tier != "" {
+			tiers[key] = tier
+		}
+	}
+	return tiers
+}
+
+// parseDatasetBoosts reads "dataset:multiplier" pairs, e.g. "9:2"
+func parseDatasetBoosts(pairs []string) map[int]float64 {
+	boosts := make(map[int]float64)
+	for _, pair := range pairs {
+		dataset, boost, ok := strings.Cut(pair, ":")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(dataset))
+		if err != nil {
+			continue
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(boost), 64)
+		if err != nil || f <= 0 {
+			continue
+		}
+		boosts[n] = f
+	}
+	return boosts
+}
+
+// parseStopwords lowercases the stopword list into a set
+func parseStopwords(words []string) map[string]bool {
+	stopwords := make(map[string]bool, len(words))
+	for _, word := range words {
+		stopwords[strings.ToLower(word)] = true
+	}
+	return stopwords
+}
+
+// ValidRole reports whether role is one of the process roles
+func ValidRole(role string) bool {
+	return role == RoleAPI || role == RoleWorker || role == RoleAll
+}
+
+// ServesAPI reports whether this process serves the API
+func (c *Config) ServesAPI() bool {
+	return c.Role != RoleWorker
+}
+
+// RunsJobs reports whether this process runs background jobs
+func (c *Config) RunsJobs() bool {
+	return c.Role != RoleAPI
+}
+
+// FTSOptions is the configured full-text index tokenizer
+func (c *Config) FTSOptions() models.FTSOptions {
+	return models.FTSOptions{RemoveDiacritics: c.FTSRemoveDiacritics, Porter: c.FTSPorter}
+}
+
+// SnapshotPath is where this archive's analytics snapshot is written
+func (c *Config) SnapshotPath() string {
+	id := c.ArchiveID
+	if id == "" {
+		id = "default"
+	}
+	return filepath.Join(c.SnapshotDir, id+".db")
+}
+
+// ExportDir is where this archive's export downloads are built
+func (c *Config) ExportDir() string {
+	id := c.ArchiveID
+	if id == "" {
+		id = "default"
+	}
+	return filepath.Join(c.SnapshotDir, "exports", id)
+}
+
+// ExportTokenKeyPath keeps the generated export token key when
+// EXPORT_TOKEN_SECRET is unset
+func (c *Config) ExportTokenKeyPath() string {
+	return filepath.Join(c.SnapshotDir, "export-token.key")
+}
+
+// AuthStateKeyPath keeps the generated login state key when
+// AUTH_STATE_SECRET is unset
+func (c *Config) AuthStateKeyPath() string {
+	return filepath.Join(c.SnapshotDir, "auth-state.key")
+}
+
+// SessionTTL is how long a single sign-on session lasts
+func (c *Config) SessionTTL() time.Duration {
+	return time.Duration(c.SessionTTLHours) * time.Hour
+}
+
+// ExportTokenTTL is how long an export download token stays valid
+func (c *Config) ExportTokenTTL() time.Duration {
+	return time.Duration(c.ExportTokenTTLHours) * time.Hour
+}
+
+// IngestLockStale is how long an ingest lock may go without a heartbeat
+// before it counts as abandoned
+func (c *Config) IngestLockStale() time.Duration {
+	return time.Duration(c.IngestLockStaleMinutes) * time.Minute
+}
+
+// BusyTimeout is how long a query waits for a locked database
+func (c *Config) BusyTimeout() time.Duration {
+	return time.Duration(c.DBBusyTimeoutMS) * time.Millisecond
+}
+
+// RequestTimeout is the deadline of a public read, 0 for none
+func (c *Config) RequestTimeout() time.Duration {
+	return time.Duration(c.RequestTimeoutSeconds) * time.Second
+}
+
+// StatsReportPath is where this archive's transparency report is written in
+// format ("pdf" or "md")
+func (c *Config) StatsReportPath(format string) string {
+	id := c.ArchiveID
+	if id == "" {
+		id = "default"
+	}
+	return filepath.Join(c.SnapshotDir, id+"-stats-report."+format)
+}
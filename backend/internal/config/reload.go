@@ -0,0 +1,122 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// CONFIG_FILE names an env file (KEY=VALUE lines, # comments) read over the
+// environment at startup and again on every Reload, so settings can change
+// without a restart. Only the settings with an OnReload hook (CORS, log
+// level) take effect when reloaded; the rest are read once at startup.
+
+var (
+	reloadMu sync.Mutex
+	hooks    []func(*Config)
+
+	// Environment before the file was applied, by key the file set, so a
+	// key removed from the file goes back to its earlier value
+	original = make(map[string]*string)
+)
+
+// OnReload registers fn to apply the reloaded configuration
+func OnReload(fn func(*Config)) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	hooks = append(hooks, fn)
+}
+
+// Reload re-reads CONFIG_FILE and hands the resulting configuration to the
+// OnReload hooks. When the file can't be read nothing changes.
+func Reload() (*Config, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	if err := applyConfigFile(); err != nil {
+		return nil, err
+	}
+	cfg := fromEnv()
+	for _, fn := range hooks {
+		fn(cfg)
+	}
+	return cfg, nil
+}
+
+// ConfigFile is the file Reload reads, or "" when there is none
+func ConfigFile() string {
+	return os.Getenv("CONFIG_FILE")
+}
+
+func loadConfigFile() {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	if err := applyConfigFile(); err != nil {
+		log.Printf("Config file not applied: %v", err)
+	}
+}
+
+func applyConfigFile() error {
+	path := ConfigFile()
+	if path == "" {
+		return nil
+	}
+	values, err := readEnvFile(path)
+	if err != nil {
+		return err
+	}
+
+	for key, prev := range original {
+		if _, ok := values[key]; !ok {
+			if prev == nil {
+				os.Unsetenv(key)
+			} else {
+				os.Setenv(key, *prev)
+			}
+			delete(original, key)
+		}
+	}
+	for key, val := range values {
+		if _, ok := original[key]; !ok {
+			if prev, set := os.LookupEnv(key); set {
+				original[key] = &prev
+			} else {
+				original[key] = nil
+			}
+		}
+		os.Setenv(key, val)
+	}
+	return nil
+}
+
+// readEnvFile parses KEY=VALUE lines; values may be quoted
+func readEnvFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, val, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || key == "CONFIG_FILE" {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, n)
+		}
+		val = strings.TrimSpace(val)
+		if len(val) >= 2 && (val[0] == '"' || val[0] == '\'') && val[len(val)-1] == val[0] {
+			val = val[1 : len(val)-1]
+		}
+		values[key] = val
+	}
+	return values, scanner.Err()
+}
@@ -0,0 +1,163 @@
+package contrib
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrTooLarge is returned when an upload exceeds the size limit
+var ErrTooLarge = errors.New("file exceeds the upload size limit")
+
+// ErrNotPDF is returned when an upload doesn't start with a PDF header
+var ErrNotPDF = errors.New("file is not a PDF")
+
+// Upload is a received file spooled to a temporary path
+type Upload struct {
+	Path      string
+	SizeBytes int64
+	SHA256    string
+}
+
+// Remove deletes the temporary file
+func (u *Upload) Remove() {
+	os.Remove(u.Path)
+}
+
+// Receive spools src to a temporary file, hashing it on the way, and rejects
+// files over maxBytes or without a PDF header
+func Receive(src io.Reader, maxBytes int64) (*Upload, error) {
+	f, err := os.CreateTemp("", "contrib-*.pdf")
+	if err != nil {
+		return nil, err
+	}
+	u := &Upload{Path: f.Name()}
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(src, maxBytes+1))
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil && n > maxBytes {
+		err = ErrTooLarge
+	}
+	if err == nil {
+		err = checkPDF(u.Path)
+	}
+	if err != nil {
+		u.Remove()
+		return nil, err
+	}
+
+	u.SizeBytes = n
+	u.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return u, nil
+}
+
+func checkPDF(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(f, header); err != nil || !bytes.Equal(header, []byte("%PDF-")) {
+		return ErrNotPDF
+	}
+	return nil
+}
+
+// Provenance is the sidecar written next to a PDF in downloads/
+// (<id>.provenance.json), in the same format the downloaders write.
+// populate_db.py copies it onto the document.
+type Provenance struct {
+	SourceURL     string     `json:"source_url,omitempty"`
+	RetrievedAt   *time.Time `json:"retrieved_at,omitempty"`
+	RetrievalTool string     `json:"retrieval_tool"`
+	SHA256        string     `json:"sha256"`
+	SizeBytes     int64      `json:"size_bytes"`
+	WaybackURL    string     `json:"wayback_url,omitempty"`
+}
+
+// ProvenanceFilename is the sidecar name for a document ID
+func ProvenanceFilename(documentID string) string {
+	return documentID + ".provenance.json"
+}
+
+var unsafeIDChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// DocumentID derives a document ID from an uploaded filename, e.g.
+// "EFTA 0001.pdf" -> "EFTA_0001"
+func DocumentID(filename string) string {
+	name := strings.TrimSuffix(filename, ".pdf")
+	name = strings.TrimSuffix(name, ".PDF")
+	name = strings.Trim(unsafeIDChars.ReplaceAllString(name, "_"), "_")
+	if len(name) > 50 {
+		name = name[:50]
+	}
+	return name
+}
+
+// ValidDocumentID reports whether id is safe to use as a document ID and filename
+func ValidDocumentID(id string) bool {
+	return id != "" && len(id) <= 50 && !unsafeIDChars.MatchString(id)
+}
+
+// ============================================================================
+// VIRUS SCAN
+// ============================================================================
+
+const scanTimeout = 2 * time.Minute
+
+// Scanner runs an external virus scanner on each upload. The command gets the
+// file path as its last argument and follows the ClamAV exit code convention:
+// 0 clean, 1 infected, anything else an error.
+type Scanner struct {
+	args []string
+}
+
+// NewScanner returns nil when command is empty, which skips scanning
+func NewScanner(command string) *Scanner {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil
+	}
+	return &Scanner{args: args}
+}
+
+// Scan reports whether the file is clean, with the scanner's output
+func (s *Scanner) Scan(ctx context.Context, path string) (clean bool, result string, err error) {
+	if s == nil {
+		return true, "", nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, scanTimeout)
+	defer cancel()
+
+	args := append(append([]string{}, s.args[1:]...), path)
+	out, err := exec.CommandContext(ctx, s.args[0], args...).CombinedOutput()
+	result = strings.TrimSpace(strings.ReplaceAll(string(out), path, "upload"))
+	if len(result) > 255 {
+		result = result[:255]
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return true, result, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		return false, result, nil
+	}
+	return false, result, fmt.Errorf("virus scan failed: %w", err)
+}
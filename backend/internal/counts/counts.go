@@ -0,0 +1,118 @@
+// Package counts backfills the page and image counts of documents, which
+// ingest leaves at 0 when the text extraction didn't record them: pages are
+// counted from the stored source PDF, images from the images extracted from
+// it.
+package counts
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/epstein-files/backend/internal/jobs"
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/repository"
+	"github.com/epstein-files/backend/internal/storage"
+)
+
+// JobType is the job type for the page and image count backfill
+const JobType = "counts-backfill"
+
+const batchSize = 100
+
+// Params builds the stored parameters of a backfill job; all recounts every
+// document instead of those missing a count
+func Params(all bool) models.JSON {
+	return models.JSON{"all": all}
+}
+
+// Job fills in the counts of the documents missing a page or image count,
+// or of every document with "all". Pages are only counted again when
+// missing or with "all", so a PDF is opened once. Each batch is written in
+// one short transaction, so the API isn't held up behind the job. A PDF
+// that can't be read or counted is logged and counted as failed, and its
+// image count is still written.
+func Job(repo *repository.Repository, store storage.Store) jobs.Handler {
+	return func(ctx context.Context, job *models.Job, p *jobs.Progress) error {
+		repo := repo.WithContext(ctx)
+		all, _ := job.Params["all"].(bool)
+
+		if job.Total == 0 {
+			total, err := repo.CountCountCandidates(all)
+			if err != nil {
+				return err
+			}
+			job.Total = total
+		}
+		if job.Result == nil {
+			job.Result = models.JSON{"pages": 0, "images": 0}
+		}
+		pages, images := jobs.ParamInt(job.Result, "pages"), jobs.ParamInt(job.Result, "images")
+
+		for {
+			batch, err := repo.GetCountCandidates(job.Cursor, all, batchSize)
+			if err != nil {
+				return err
+			}
+			if len(batch) == 0 {
+				return p.Save()
+			}
+
+			ids := make([]string, len(batch))
+			for i, rec := range batch {
+				ids[i] = rec.ID
+			}
+			imageCounts, err := repo.GetImageCounts(ids)
+			if err != nil {
+				return err
+			}
+
+			updates := make([]repository.DocumentCounts, 0, len(batch))
+			for _, rec := range batch {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				c := repository.DocumentCounts{ID: rec.ID, PageCount: rec.PageCount, ImageCount: imageCounts[rec.ID]}
+				if all || rec.PageCount == 0 {
+					n, err := countPages(ctx, store, rec.Filename)
+					if err != nil {
+						log.Printf("Counting pages of %s: %v", rec.ID, err)
+						job.Failed++
+					} else {
+						c.PageCount = n
+						pages += n
+					}
+				}
+				images += c.ImageCount
+				if c.PageCount != rec.PageCount || c.ImageCount != rec.ImageCount {
+					updates = append(updates, c)
+				}
+				job.Processed++
+				job.Cursor = rec.RowID
+			}
+
+			if err := repo.UpdateDocumentCounts(updates); err != nil {
+				return err
+			}
+			job.Result["pages"], job.Result["images"] = pages, images
+			if err := p.Save(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func countPages(ctx context.Context, store storage.Store, filename string) (int, error) {
+	rc, err := store.Open(ctx, storage.DocumentKey(filename))
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return 0, fmt.Errorf("read: %w", err)
+	}
+	return PageCount(data)
+}
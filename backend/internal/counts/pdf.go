@@ -0,0 +1,136 @@
+package counts
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// maxObjectStream caps what one decompressed object stream may take
+const maxObjectStream = 64 << 20
+
+var (
+	pagesType = regexp.MustCompile(`/Type\s*/Pages\b`)
+	pageType  = regexp.MustCompile(`/Type\s*/Page\b`)
+	objStm    = regexp.MustCompile(`/Type\s*/ObjStm\b`)
+	countKey  = regexp.MustCompile(`/Count\s+(\d+)`)
+	streamKw  = regexp.MustCompile(`^\s*stream\r?\n`)
+)
+
+// PageCount reads the number of pages of a PDF from its page tree: the
+// /Count of the root /Pages node, the largest of them. Page tree nodes kept
+// in compressed object streams (PDF 1.5+) are found by inflating those.
+// Without a page tree, the /Page objects are counted.
+func PageCount(pdf []byte) (int, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(pdf, "\x00\t\n\r "), []byte("%PDF-")) {
+		return 0, errors.New("not a PDF")
+	}
+
+	sources := [][]byte{pdf}
+	for _, loc := range objStm.FindAllIndex(pdf, -1) {
+		if data := inflateStream(pdf, loc[0]); data != nil {
+			sources = append(sources, data)
+		}
+	}
+
+	pages, leaves := 0, 0
+	for _, src := range sources {
+		for _, loc := range pagesType.FindAllIndex(src, -1) {
+			start, end := enclosingDict(src, loc[0])
+			if start < 0 {
+				continue
+			}
+			if m := countKey.FindSubmatch(src[start:end]); m != nil {
+				if n, err := strconv.Atoi(string(m[1])); err == nil && n > pages {
+					pages = n
+				}
+			}
+		}
+		leaves += len(pageType.FindAllIndex(src, -1))
+	}
+	if pages == 0 {
+		pages = leaves
+	}
+	if pages == 0 {
+		return 0, errors.New("no page tree found")
+	}
+	return pages, nil
+}
+
+// enclosingDict returns where the innermost << ... >> around src[at] starts
+// and ends, or -1, -1
+func enclosingDict(src []byte, at int) (int, int) {
+	start, depth := -1, 0
+	for i := at; i > 0; i-- {
+		switch {
+		case src[i-1] == '>' && src[i] == '>':
+			depth++
+			i--
+		case src[i-1] == '<' && src[i] == '<':
+			if depth == 0 {
+				start = i - 1
+			} else {
+				depth--
+				i--
+			}
+		}
+		if start >= 0 {
+			break
+		}
+	}
+	if start < 0 {
+		return -1, -1
+	}
+	end := dictEnd(src, start)
+	if end < 0 {
+		return -1, -1
+	}
+	return start, end
+}
+
+// dictEnd returns the index after the >> closing the dictionary opened at
+// src[start], or -1
+func dictEnd(src []byte, start int) int {
+	depth := 0
+	for i := start; i+1 < len(src); i++ {
+		switch {
+		case src[i] == '<' && src[i+1] == '<':
+			depth++
+			i++
+		case src[i] == '>' && src[i+1] == '>':
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+// inflateStream returns the content of the Flate-encoded stream whose
+// dictionary contains src[at], or nil
+func inflateStream(src []byte, at int) []byte {
+	start, end := enclosingDict(src, at)
+	if start < 0 || !bytes.Contains(src[start:end], []byte("/FlateDecode")) {
+		return nil
+	}
+	rest := src[end:]
+	kw := streamKw.FindIndex(rest)
+	if kw == nil {
+		return nil
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(rest[kw[1]:]))
+	if err != nil {
+		return nil
+	}
+	defer zr.Close()
+	data, err := io.ReadAll(io.LimitReader(zr, maxObjectStream))
+	if err != nil && len(data) == 0 {
+		return nil
+	}
+	return data
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/gorm"
+)
+
+// Busy reports whether err means the database couldn't answer in time: it
+// stayed locked past busy_timeout, or the query's deadline ran out
+func Busy(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var se sqlite3.Error
+	if errors.As(err, &se) {
+		return se.Code == sqlite3.ErrBusy || se.Code == sqlite3.ErrLocked || se.Code == sqlite3.ErrInterrupt
+	}
+	return false
+}
+
+type busyKey struct{}
+
+// TrackBusy returns a context whose queries set the returned flag when they
+// fail as Busy, so a request can tell contention from other errors
+func TrackBusy(ctx context.Context) (context.Context, *atomic.Bool) {
+	busy := &atomic.Bool{}
+	return context.WithValue(ctx, busyKey{}, busy), busy
+}
+
+// busyPlugin sets the TrackBusy flag of a statement's context
+type busyPlugin struct{}
+
+func (busyPlugin) Name() string { return "busy" }
+
+func (busyPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	hooks := []struct {
+		name     string
+		register func(string, func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().After("gorm:raw").Register},
+	}
+	for _, h := range hooks {
+		if err := h.register("busy:after_"+h.name, markBusy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func markBusy(db *gorm.DB) {
+	if db.Error == nil || !Busy(db.Error) {
+		return
+	}
+	if busy, ok := db.Statement.Context.Value(busyKey{}).(*atomic.Bool); ok {
+		busy.Store(true)
+	}
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/epstein-files/backend/internal/config"
+	"github.com/epstein-files/backend/internal/logging"
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/telemetry"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Open connects to an archive's SQLite database the way the server and
+// backendctl both use it: WAL mode, traced queries and a single connection.
+// A query finding the database locked retries for up to busyTimeout. With
+// foreignKeys, writes breaking a foreign key fail; SQLite leaves them
+// unchecked otherwise.
+func Open(dbURL string, busyTimeout time.Duration, foreignKeys bool) (*gorm.DB, error) {
+	// SQLite configuration for better performance
+	dsn := fmt.Sprintf("%s?_journal_mode=WAL&_synchronous=NORMAL&_cache_size=10000&_busy_timeout=%d",
+		dbURL, busyTimeout.Milliseconds())
+	if foreignKeys {
+		dsn += "&_foreign_keys=1"
+	}
+	db, err := open(sqlite.Open(dsn))
+	if err != nil {
+		return nil, err
+	}
+
+	// Connection pool settings
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1) // SQLite only supports one writer
+	sqlDB.SetMaxIdleConns(1)
+	sqlDB.SetConnMaxLifetime(time.Hour)
+
+	return db, nil
+}
+
+// open applies the logging (at LOG_LEVEL) and tracing every connection shares
+func open(dialector gorm.Dialector) (*gorm.DB, error) {
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger: logging.GormLogger(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Use(telemetry.GormPlugin{}); err != nil {
+		return nil, err
+	}
+	if err := db.Use(busyPlugin{}); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Migrate brings the schema up to date and applies the legal hold setting
+func Migrate(db *gorm.DB, cfg *config.Config) error {
+	if err := models.AutoMigrate(db, cfg.FTSOptions()); err != nil {
+		return fmt.Errorf("run migrations: %w", err)
+	}
+	if err := models.SetLegalHold(db, cfg.LegalHold); err != nil {
+		return fmt.Errorf("set legal hold: %w", err)
+	}
+	return nil
+}
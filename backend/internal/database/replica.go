@@ -0,0 +1,262 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/repository"
+	"github.com/mattn/go-sqlite3"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Read replica modes (READ_REPLICA)
+const (
+	ReplicaMemory = "memory" // a copy of the database in RAM, reloaded after each ingest
+	ReplicaMmap   = "mmap"   // a read-only connection pool that memory-maps the file
+)
+
+// ValidReplicaMode reports whether mode names a replica mode; "" disables it
+func ValidReplicaMode(mode string) bool {
+	return mode == "" || mode == ReplicaMemory || mode == ReplicaMmap
+}
+
+// Replica answers read-only queries off the single writer connection, with
+// a pool of its own. In memory mode it holds a copy of the database, taken
+// with SQLite's online backup and swapped for a fresh one whenever the
+// ingest version changes; queries already running finish on the old copy.
+type Replica struct {
+	mode    string
+	dbURL   string
+	source  *gorm.DB // the archive's database
+	conns   int
+	current atomic.Pointer[replicaDB]
+
+	mu     sync.Mutex // guards status
+	status models.ReplicaStatus
+}
+
+type replicaDB struct {
+	db      *gorm.DB
+	repo    *repository.Repository
+	version string
+}
+
+// Names in-memory databases, which are shared by name within the process
+var memoryDBs atomic.Int64
+
+// NewReplica opens the replica of source, loading it in memory mode.
+// mmapMB sizes the memory map of each connection.
+func NewReplica(mode, dbURL string, source *gorm.DB, conns, mmapMB int) (*Replica, error) {
+	r := &Replica{
+		mode:   mode,
+		dbURL:  dbURL,
+		source: source,
+		conns:  max(conns, 1),
+		status: models.ReplicaStatus{Mode: mode},
+	}
+
+	var rdb *replicaDB
+	var err error
+	start := time.Now()
+	switch mode {
+	case ReplicaMemory:
+		rdb, err = r.loadMemory(context.Background())
+	case ReplicaMmap:
+		rdb, err = r.openMmap(mmapMB)
+	default:
+		err = fmt.Errorf("unknown replica mode %q", mode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.swap(rdb, time.Since(start))
+	return r, nil
+}
+
+// Repository returns the current copy's repository
+func (r *Replica) Repository() *repository.Repository {
+	return r.current.Load().repo
+}
+
+// Status reports what the replica holds
+func (r *Replica) Status() models.ReplicaStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// Run reloads a memory replica when the ingest version changes, checking
+// every interval until ctx is cancelled. mmap replicas read the live file
+// and need no refresh.
+func (r *Replica) Run(ctx context.Context, interval time.Duration) {
+	if r.mode != ReplicaMemory {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		version, err := repository.New(r.source).WithContext(ctx).IngestVersion()
+		if err != nil || version == r.current.Load().version {
+			continue
+		}
+
+		start := time.Now()
+		rdb, err := r.loadMemory(ctx)
+		if err != nil {
+			log.Printf("Read replica: reload failed: %v", err)
+			r.mu.Lock()
+			r.status.LastError = err.Error()
+			r.mu.Unlock()
+			continue
+		}
+		old := r.current.Load()
+		r.swap(rdb, time.Since(start))
+		log.Printf("Read replica reloaded in %s", time.Since(start).Round(time.Millisecond))
+
+		// Close waits for queries still running on the old copy
+		go closeDB(old.db)
+	}
+}
+
+func (r *Replica) swap(rdb *replicaDB, took time.Duration) {
+	r.current.Store(rdb)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.Version = rdb.version
+	r.status.LoadedAt = time.Now().UTC()
+	r.status.LoadSeconds = took.Seconds()
+	r.status.Loads++
+	r.status.LastError = ""
+}
+
+// loadMemory copies the source database into a new shared-cache in-memory
+// database. The copy lives as long as one of its connections does, so the
+// pool never closes idle ones.
+func (r *Replica) loadMemory(ctx context.Context) (*replicaDB, error) {
+	version, err := repository.New(r.source).WithContext(ctx).IngestVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("file:replica%d?mode=memory&cache=shared", memoryDBs.Add(1))
+	db, err := open(sqlite.Open(name))
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(r.conns)
+	sqlDB.SetMaxIdleConns(r.conns)
+	sqlDB.SetConnMaxLifetime(0)
+	sqlDB.SetConnMaxIdleTime(0)
+
+	src, err := r.source.DB()
+	if err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	if err := backup(ctx, sqlDB, src); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("copy database into memory: %w", err)
+	}
+
+	return &replicaDB{db: db, repo: repository.New(db), version: version}, nil
+}
+
+// backup copies every page of src into dst with the online backup API, so
+// the copy is consistent even while the source is written
+func backup(ctx context.Context, dst, src *sql.DB) error {
+	dstConn, err := dst.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dstConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return dstConn.Raw(func(d interface{}) error {
+		return srcConn.Raw(func(s interface{}) error {
+			dc, ok := d.(*sqlite3.SQLiteConn)
+			sc, ok2 := s.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return fmt.Errorf("backup needs the mattn/go-sqlite3 driver")
+			}
+			b, err := dc.Backup("main", sc, "main")
+			if err != nil {
+				return err
+			}
+			for {
+				done, err := b.Step(-1)
+				if err != nil {
+					b.Close()
+					return err
+				}
+				if done {
+					return b.Finish()
+				}
+			}
+		})
+	})
+}
+
+// Driver for mmap replicas, registered on first use since the map size is
+// set per connection
+const mmapDriver = "sqlite3_mmap"
+
+var mmapDriverOnce sync.Once
+
+// openMmap opens a read-only pool on the database file whose connections
+// map up to mmapMB of it into memory, so reads skip the page cache copy
+func (r *Replica) openMmap(mmapMB int) (*replicaDB, error) {
+	mmapDriverOnce.Do(func() {
+		sql.Register(mmapDriver, &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				_, err := conn.Exec(fmt.Sprintf("PRAGMA mmap_size = %d", int64(mmapMB)<<20), nil)
+				return err
+			},
+		})
+	})
+
+	db, err := open(&sqlite.Dialector{
+		DriverName: mmapDriver,
+		DSN:        "file:" + r.dbURL + "?mode=ro&_cache_size=10000",
+	})
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(r.conns)
+	sqlDB.SetMaxIdleConns(r.conns)
+	sqlDB.SetConnMaxLifetime(time.Hour)
+
+	return &replicaDB{db: db, repo: repository.New(db)}, nil
+}
+
+func closeDB(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
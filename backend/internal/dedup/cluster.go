@@ -0,0 +1,87 @@
+package dedup
+
+import "sort"
+
+// Doc is a document's signature as input to Cluster
+type Doc struct {
+	ID        string
+	Shingles  int
+	Signature Signature
+}
+
+// Group is one near-duplicate cluster. Similarity maps each member,
+// including the canonical document itself, to its estimated similarity with
+// the canonical document.
+type Group struct {
+	CanonicalID string
+	Similarity  map[string]float64
+}
+
+// Cluster links documents whose estimated similarity is at least threshold
+// and returns the groups of two or more, largest first. Candidates come from
+// LSH banding, so pairs far below the banding threshold (about 0.7) are
+// never compared.
+func Cluster(docs []Doc, threshold float64) []Group {
+	parent := make([]int, len(docs))
+	for i := range parent {
+		parent[i] = i
+	}
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+
+	// Within a bucket, compare each document to the bucket's first one;
+	// other buckets supply the remaining links
+	buckets := make(map[uint64]int)
+	for i := range docs {
+		for _, key := range docs[i].Signature.bandKeys() {
+			first, ok := buckets[key]
+			if !ok {
+				buckets[key] = i
+				continue
+			}
+			a, b := find(first), find(i)
+			if a != b && docs[first].Signature.Similarity(&docs[i].Signature) >= threshold {
+				parent[b] = a
+			}
+		}
+	}
+
+	members := make(map[int][]int)
+	for i := range docs {
+		root := find(i)
+		members[root] = append(members[root], i)
+	}
+
+	var groups []Group
+	for _, idx := range members {
+		if len(idx) < 2 {
+			continue
+		}
+		// The most complete text is canonical; ties go to the earliest ID
+		canon := idx[0]
+		for _, i := range idx[1:] {
+			if docs[i].Shingles > docs[canon].Shingles ||
+				(docs[i].Shingles == docs[canon].Shingles && docs[i].ID < docs[canon].ID) {
+				canon = i
+			}
+		}
+		g := Group{CanonicalID: docs[canon].ID, Similarity: make(map[string]float64, len(idx))}
+		for _, i := range idx {
+			g.Similarity[docs[i].ID] = docs[canon].Signature.Similarity(&docs[i].Signature)
+		}
+		groups = append(groups, g)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if len(groups[i].Similarity) != len(groups[j].Similarity) {
+			return len(groups[i].Similarity) > len(groups[j].Similarity)
+		}
+		return groups[i].CanonicalID < groups[j].CanonicalID
+	})
+	return groups
+}
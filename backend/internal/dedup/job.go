@@ -0,0 +1,116 @@
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/epstein-files/backend/internal/jobs"
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/repository"
+)
+
+// ClusterJobType is the job type for rebuilding near-duplicate clusters
+const ClusterJobType = "text-clusters"
+
+const signatureBatchSize = 200
+
+// ClusterParams builds the stored parameters of a clustering job
+func ClusterParams(threshold float64) models.JSON {
+	return models.JSON{"threshold": threshold}
+}
+
+// ClusterJob recomputes the MinHash signature of every document, then
+// replaces the near-duplicate clusters with ones built from the fresh
+// signatures. Signatures are saved batch by batch, so an interrupted job
+// resumes where it stopped; clusters are swapped in only at the end.
+func ClusterJob(repo *repository.Repository) jobs.Handler {
+	return func(ctx context.Context, job *models.Job, p *jobs.Progress) error {
+		repo := repo.WithContext(ctx)
+
+		threshold, _ := job.Params["threshold"].(float64)
+		if threshold <= 0 || threshold > 1 {
+			return fmt.Errorf("invalid threshold %v", job.Params["threshold"])
+		}
+
+		if job.Total == 0 {
+			total, err := repo.CountDocuments()
+			if err != nil {
+				return err
+			}
+			job.Total = total
+		}
+
+		for {
+			records, err := repo.GetDocumentTextBatch(job.Cursor, signatureBatchSize)
+			if err != nil {
+				return err
+			}
+			if len(records) == 0 {
+				break
+			}
+
+			sigs := make([]models.DocumentSignature, len(records))
+			for i, rec := range records {
+				shingles := Shingles(rec.FullText)
+				sig := MinHash(shingles)
+				sigs[i] = models.DocumentSignature{
+					DocumentID: rec.ID,
+					Signature:  sig.Bytes(),
+					Shingles:   len(shingles),
+				}
+			}
+			if err := repo.SaveDocumentSignatures(sigs); err != nil {
+				return err
+			}
+
+			job.Processed += int64(len(records))
+			job.Cursor = records[len(records)-1].RowID
+			if err := p.Save(); err != nil {
+				return err
+			}
+		}
+
+		stored, err := repo.GetDocumentSignatures(minShingles)
+		if err != nil {
+			return err
+		}
+		docs := make([]Doc, 0, len(stored))
+		for _, s := range stored {
+			sig, ok := ParseSignature(s.Signature)
+			if !ok {
+				job.Failed++
+				continue
+			}
+			docs = append(docs, Doc{ID: s.DocumentID, Shingles: s.Shingles, Signature: sig})
+		}
+
+		groups := Cluster(docs, threshold)
+		clusters := make([]models.DocumentCluster, len(groups))
+		duplicates := 0
+		for i, g := range groups {
+			c := models.DocumentCluster{Size: len(g.Similarity), CanonicalID: g.CanonicalID}
+			for id, sim := range g.Similarity {
+				c.Members = append(c.Members, models.DocumentClusterMember{DocumentID: id, Similarity: round2(sim)})
+			}
+			clusters[i] = c
+			duplicates += c.Size - 1
+		}
+		if err := repo.ReplaceDocumentClusters(clusters); err != nil {
+			return err
+		}
+
+		log.Printf("Near-duplicate clustering: %d clusters, %d duplicate documents", len(clusters), duplicates)
+		job.Result = models.JSON{
+			"clustered_documents": len(docs),
+			"clusters":            len(clusters),
+			"duplicates":          duplicates,
+		}
+		return p.Save()
+	}
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,156 @@
+package dedup
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"strings"
+	"unicode"
+)
+
+// Signature parameters. Every clustering job recomputes the stored
+// signatures, so these can change between runs.
+const (
+	shingleWords = 5   // words per shingle
+	numHashes    = 128 // signature length
+	bands        = 16  // LSH bands of numHashes/bands rows each
+)
+
+// Documents with fewer shingles than this (blank pages, a lone stamp) are
+// left out of clustering; they would all look alike
+const minShingles = 20
+
+// seeds derives the per-position hash seeds
+var seeds = func() [numHashes]uint64 {
+	var s [numHashes]uint64
+	for i := range s {
+		s[i] = mix(uint64(i) + 1)
+	}
+	return s
+}()
+
+// mix is the splitmix64 finalizer
+func mix(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// words lowercases text and splits it into alphanumeric words, dropping
+// Bates numbers, which differ on every copy of a page
+func words(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	out := fields[:0]
+	for _, w := range fields {
+		if isBates(w) {
+			continue
+		}
+		out = append(out, w)
+	}
+	return out
+}
+
+func isBates(w string) bool {
+	if !strings.HasPrefix(w, "efta") || len(w) == 4 {
+		return false
+	}
+	for _, r := range w[4:] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Shingles hashes each run of shingleWords consecutive words, deduplicated
+func Shingles(text string) []uint64 {
+	ws := words(text)
+	if len(ws) < shingleWords {
+		return nil
+	}
+
+	seen := make(map[uint64]struct{}, len(ws))
+	out := make([]uint64, 0, len(ws))
+	h := fnv.New64a()
+	for i := 0; i+shingleWords <= len(ws); i++ {
+		h.Reset()
+		h.Write([]byte(strings.Join(ws[i:i+shingleWords], " ")))
+		sum := h.Sum64()
+		if _, ok := seen[sum]; !ok {
+			seen[sum] = struct{}{}
+			out = append(out, sum)
+		}
+	}
+	return out
+}
+
+// Signature is the MinHash of a shingle set: for each seed, the smallest
+// hash over all shingles
+type Signature [numHashes]uint32
+
+func MinHash(shingles []uint64) Signature {
+	var sig Signature
+	for i := range sig {
+		sig[i] = ^uint32(0)
+	}
+	for _, s := range shingles {
+		for i, seed := range seeds {
+			if v := uint32(mix(s ^ seed)); v < sig[i] {
+				sig[i] = v
+			}
+		}
+	}
+	return sig
+}
+
+// Similarity estimates the Jaccard similarity of the two shingle sets
+func (s *Signature) Similarity(o *Signature) float64 {
+	same := 0
+	for i := range s {
+		if s[i] == o[i] {
+			same++
+		}
+	}
+	return float64(same) / numHashes
+}
+
+// Bytes encodes the signature for storage
+func (s *Signature) Bytes() []byte {
+	b := make([]byte, 4*numHashes)
+	for i, v := range s {
+		binary.LittleEndian.PutUint32(b[4*i:], v)
+	}
+	return b
+}
+
+// ParseSignature decodes a stored signature; ok is false if its length is wrong
+func ParseSignature(b []byte) (sig Signature, ok bool) {
+	if len(b) != 4*numHashes {
+		return sig, false
+	}
+	for i := range sig {
+		sig[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+	return sig, true
+}
+
+// bandKeys hashes each band of the signature; documents sharing any band
+// key are candidate duplicates
+func (s *Signature) bandKeys() [bands]uint64 {
+	var keys [bands]uint64
+	rows := numHashes / bands
+	for b := range keys {
+		h := fnv.New64a()
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], uint32(b))
+		h.Write(buf[:])
+		for _, v := range s[b*rows : (b+1)*rows] {
+			binary.LittleEndian.PutUint32(buf[:], v)
+			h.Write(buf[:])
+		}
+		keys[b] = h.Sum64()
+	}
+	return keys
+}
@@ -0,0 +1,52 @@
+package enrich
+
+import (
+	"image"
+	"math"
+
+	"github.com/epstein-files/backend/internal/imaging"
+)
+
+// Must match extract_pdf_content.py. Scans of printed pages pick up a little
+// chroma noise, so anything below the threshold counts as grayscale.
+const (
+	colorMaxSide   = 256
+	colorThreshold = 15.0
+)
+
+// Color measures colorfulness (Hasler and Süsstrunk, on the 0-255 scale) and
+// classifies the image as color or grayscale. Megapixels and size class come
+// from the stored width and height, not from this stage.
+func Color(_ []byte, img image.Image) (map[string]interface{}, error) {
+	small := imaging.Fit(img, colorMaxSide)
+	b := small.Bounds()
+
+	var rgSum, rgSq, ybSum, ybSq float64
+	var n float64
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := small.At(x, y).RGBA()
+			rf, gf, bf := float64(r>>8), float64(g>>8), float64(bl>>8)
+			rg := rf - gf
+			yb := 0.5*(rf+gf) - bf
+			rgSum += rg
+			rgSq += rg * rg
+			ybSum += yb
+			ybSq += yb * yb
+			n++
+		}
+	}
+
+	colorfulness := 0.0
+	if n > 0 {
+		rgMean, ybMean := rgSum/n, ybSum/n
+		rgStd := math.Sqrt(math.Max(0, rgSq/n-rgMean*rgMean))
+		ybStd := math.Sqrt(math.Max(0, ybSq/n-ybMean*ybMean))
+		colorfulness = math.Hypot(rgStd, ybStd) + 0.3*math.Hypot(rgMean, ybMean)
+	}
+
+	return map[string]interface{}{
+		"is_color":     colorfulness >= colorThreshold,
+		"colorfulness": round(colorfulness, 2),
+	}, nil
+}
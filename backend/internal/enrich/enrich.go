@@ -0,0 +1,75 @@
+package enrich
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"sort"
+	"strings"
+)
+
+// Stage recomputes one group of image columns from the stored file. It
+// returns the column values to write back.
+type Stage func(data []byte, img image.Image) (map[string]interface{}, error)
+
+// Stages are the enrichment stages that can be re-run, by name
+var Stages = map[string]Stage{
+	"quality": Quality,
+	"phash":   PHash,
+	"exif":    Exif,
+	"color":   Color,
+}
+
+// StageNames lists the available stages in a stable order
+func StageNames() []string {
+	names := make([]string, 0, len(Stages))
+	for name := range Stages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseStages validates a comma-separated list of stage names
+func ParseStages(list string) ([]string, error) {
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		if _, ok := Stages[name]; !ok {
+			return nil, fmt.Errorf("unknown field %q (available: %s)", name, strings.Join(StageNames(), ", "))
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no fields given (available: %s)", strings.Join(StageNames(), ", "))
+	}
+	return names, nil
+}
+
+// Run decodes the file once and applies the named stages, merging their columns
+func Run(names []string, data []byte) (map[string]interface{}, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+
+	fields := map[string]interface{}{}
+	for _, name := range names {
+		out, err := Stages[name](data, img)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		for k, v := range out {
+			fields[k] = v
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,66 @@
+package enrich
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// Exif re-reads EXIF tags using the same tag names as the Python extractor
+// (DateTimeOriginal, GPSLatitude, ...), so has_gps and date_taken follow the
+// same rules as at ingest. Images without EXIF get their fields cleared.
+func Exif(data []byte, _ image.Image) (map[string]interface{}, error) {
+	fields := map[string]interface{}{
+		"exif":       nil,
+		"has_gps":    false,
+		"date_taken": "",
+	}
+
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		// Most images extracted from PDFs carry no EXIF block at all
+		return fields, nil
+	}
+
+	tags := map[string]interface{}{}
+	x.Walk(walker(func(name exif.FieldName, tag *tiff.Tag) {
+		if s, err := tag.StringVal(); err == nil {
+			tags[string(name)] = strings.TrimRight(s, "\x00 ")
+		} else {
+			tags[string(name)] = strings.Trim(tag.String(), `"`)
+		}
+	}))
+	if len(tags) == 0 {
+		return fields, nil
+	}
+
+	encoded, err := json.Marshal(tags)
+	if err != nil {
+		return nil, err
+	}
+	fields["exif"] = string(encoded)
+
+	for name := range tags {
+		if strings.Contains(name, "GPS") {
+			fields["has_gps"] = true
+			break
+		}
+	}
+	if v, ok := tags["DateTimeOriginal"].(string); ok {
+		fields["date_taken"] = v
+	} else if v, ok := tags["DateTime"].(string); ok {
+		fields["date_taken"] = v
+	}
+	return fields, nil
+}
+
+type walker func(exif.FieldName, *tiff.Tag)
+
+func (w walker) Walk(name exif.FieldName, tag *tiff.Tag) error {
+	w(name, tag)
+	return nil
+}
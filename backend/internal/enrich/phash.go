@@ -0,0 +1,87 @@
+package enrich
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+
+	"github.com/epstein-files/backend/internal/imaging"
+)
+
+// PHash computes a 64-bit DCT perceptual hash: the image is reduced to 32x32
+// grayscale, and each bit of the hash says whether one of the 8x8 lowest
+// frequency DCT coefficients is above their median. Near-duplicate images
+// differ in only a few bits.
+func PHash(_ []byte, img image.Image) (map[string]interface{}, error) {
+	const size, low = 32, 8
+
+	gray := toGray(imaging.Resize(img, size, size))
+	pixels := make([][]float64, size)
+	for y := 0; y < size; y++ {
+		pixels[y] = make([]float64, size)
+		for x := 0; x < size; x++ {
+			pixels[y][x] = float64(gray.GrayAt(gray.Rect.Min.X+x, gray.Rect.Min.Y+y).Y)
+		}
+	}
+
+	coeffs := dct2(pixels)
+	vals := make([]float64, 0, low*low)
+	for y := 0; y < low; y++ {
+		for x := 0; x < low; x++ {
+			vals = append(vals, coeffs[y][x])
+		}
+	}
+
+	// The DC term reflects overall brightness, not structure
+	sorted := append([]float64(nil), vals[1:]...)
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	var hash uint64
+	for i, v := range vals {
+		if v > median {
+			hash |= 1 << uint(63-i)
+		}
+	}
+	return map[string]interface{}{"phash": fmt.Sprintf("%016x", hash)}, nil
+}
+
+// dct2 is a straightforward 2D DCT-II; 32x32 is small enough not to need FFT
+func dct2(in [][]float64) [][]float64 {
+	n := len(in)
+	cos := make([][]float64, n)
+	for k := 0; k < n; k++ {
+		cos[k] = make([]float64, n)
+		for i := 0; i < n; i++ {
+			cos[k][i] = math.Cos(math.Pi / float64(n) * (float64(i) + 0.5) * float64(k))
+		}
+	}
+
+	rows := make([][]float64, n)
+	for y := 0; y < n; y++ {
+		rows[y] = make([]float64, n)
+		for k := 0; k < n; k++ {
+			var s float64
+			for x := 0; x < n; x++ {
+				s += in[y][x] * cos[k][x]
+			}
+			rows[y][k] = s
+		}
+	}
+
+	out := make([][]float64, n)
+	for k := 0; k < n; k++ {
+		out[k] = make([]float64, n)
+	}
+	for x := 0; x < n; x++ {
+		for k := 0; k < n; k++ {
+			var s float64
+			for y := 0; y < n; y++ {
+				s += rows[y][x] * cos[k][y]
+			}
+			out[k][x] = s
+		}
+	}
+	return out
+}
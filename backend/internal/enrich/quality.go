@@ -0,0 +1,97 @@
+package enrich
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/epstein-files/backend/internal/imaging"
+)
+
+// Must match extract_pdf_content.py so recomputed scores are comparable
+const (
+	qualityMaxSide     = 512
+	sharpnessReference = 1000.0
+)
+
+// Quality scores sharpness (Laplacian variance) and brightness. quality is a
+// 0-1 blend of normalized sharpness and exposure, where exposure penalises
+// images that are nearly black or washed out.
+func Quality(_ []byte, img image.Image) (map[string]interface{}, error) {
+	gray := toGray(imaging.Fit(img, qualityMaxSide))
+	b := gray.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	var sum float64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sum += float64(gray.GrayAt(b.Min.X+x, b.Min.Y+y).Y)
+		}
+	}
+	brightness := 0.0
+	if w*h > 0 {
+		brightness = sum / float64(w*h) / 255.0
+	}
+
+	// Same kernel and 8-bit clamping as PIL's ImageFilter.Kernel with offset 128
+	var lapSum, lapSq float64
+	var n int
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			at := func(dx, dy int) float64 {
+				px := clamp(x+dx, 0, w-1)
+				py := clamp(y+dy, 0, h-1)
+				return float64(gray.GrayAt(b.Min.X+px, b.Min.Y+py).Y)
+			}
+			v := at(0, -1) + at(-1, 0) + at(1, 0) + at(0, 1) - 4*at(0, 0) + 128
+			v = math.Max(0, math.Min(255, v))
+			lapSum += v
+			lapSq += v * v
+			n++
+		}
+	}
+	sharpness := 0.0
+	if n > 0 {
+		mean := lapSum / float64(n)
+		sharpness = lapSq/float64(n) - mean*mean
+	}
+
+	sharpnessNorm := math.Min(sharpness/sharpnessReference, 1.0)
+	exposure := math.Max(0, 1.0-math.Abs(brightness-0.5)*2)
+	quality := 0.7*sharpnessNorm + 0.3*exposure
+
+	return map[string]interface{}{
+		"sharpness":  round(sharpness, 2),
+		"brightness": round(brightness, 4),
+		"quality":    round(quality, 4),
+	}, nil
+}
+
+func toGray(img image.Image) *image.Gray {
+	if g, ok := img.(*image.Gray); ok {
+		return g
+	}
+	b := img.Bounds()
+	gray := image.NewGray(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			gray.Set(x, y, color.GrayModel.Convert(img.At(x, y)))
+		}
+	}
+	return gray
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+func round(v float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(v*p) / p
+}
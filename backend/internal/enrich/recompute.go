@@ -0,0 +1,100 @@
+package enrich
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/epstein-files/backend/internal/jobs"
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/repository"
+	"github.com/epstein-files/backend/internal/storage"
+)
+
+// RecomputeJobType is the job type for re-running enrichment stages
+const RecomputeJobType = "recompute"
+
+const recomputeBatchSize = 100
+
+// RecomputeParams builds the stored parameters of a recompute job
+func RecomputeParams(fields []string, documentID string) models.JSON {
+	params := models.JSON{"fields": strings.Join(fields, ",")}
+	if documentID != "" {
+		params["document_id"] = documentID
+	}
+	return params
+}
+
+// RecomputeJob re-reads each selected image from storage and re-runs the
+// stages named in the job's "fields" parameter, writing the results back.
+// Images that fail (missing file, undecodable) are counted and skipped.
+func RecomputeJob(repo *repository.Repository, store storage.Store) jobs.Handler {
+	return func(ctx context.Context, job *models.Job, p *jobs.Progress) error {
+		repo := repo.WithContext(ctx)
+
+		fieldList, _ := job.Params["fields"].(string)
+		names, err := ParseStages(fieldList)
+		if err != nil {
+			return err
+		}
+		documentID, _ := job.Params["document_id"].(string)
+
+		if job.Total == 0 {
+			if job.Total, err = repo.CountImages(documentID); err != nil {
+				return err
+			}
+		}
+
+		for {
+			images, err := repo.GetImageBatch(job.Cursor, documentID, recomputeBatchSize)
+			if err != nil {
+				return err
+			}
+			if len(images) == 0 {
+				return p.Save()
+			}
+
+			for _, img := range images {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if err := recomputeImage(ctx, repo, store, names, img); err != nil {
+					log.Printf("Recompute image %d: %v", img.ID, err)
+					job.Failed++
+				}
+				job.Processed++
+				job.Cursor = img.ID
+			}
+
+			if err := p.Save(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func recomputeImage(ctx context.Context, repo *repository.Repository, store storage.Store, names []string, img models.Image) error {
+	fields, err := Recompute(ctx, store, names, img)
+	if err != nil {
+		return err
+	}
+	return repo.UpdateImageFields(img.ID, fields)
+}
+
+// Recompute reads an image from storage and runs the named stages on it,
+// returning the columns to write back
+func Recompute(ctx context.Context, store storage.Store, names []string, img models.Image) (map[string]interface{}, error) {
+	rc, err := store.Open(ctx, storage.ImageKey(img.DocumentID, img.Filename))
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+	return Run(names, data)
+}
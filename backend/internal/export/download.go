@@ -0,0 +1,210 @@
+package export
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/epstein-files/backend/internal/jobs"
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/repository"
+)
+
+// Large exports can be built in the background and fetched with a download
+// token instead of streamed. The job writes the file to disk; the token,
+// signed so forged ones are refused without a lookup, addresses it until it
+// has been downloaded in full once or has expired.
+
+// DownloadJobType is the job type that builds an export download
+const DownloadJobType = "export"
+
+// DownloadKinds are the exports that can be built for download
+var DownloadKinds = []string{"documents.parquet", "images.parquet"}
+
+// ErrBadToken is returned for a download token that is malformed or wasn't
+// signed with the key
+var ErrBadToken = errors.New("invalid download token")
+
+// DownloadJob builds the export download named by the job's download_id
+// param into dir, for it and the downloads sharing the job. An interrupted
+// job starts the file over.
+func DownloadJob(repo *repository.Repository, dir string) jobs.Handler {
+	return func(ctx context.Context, job *models.Job, p *jobs.Progress) error {
+		repo := repo.WithContext(ctx)
+		id, _ := job.Params["download_id"].(float64)
+		d, err := repo.GetExportDownload(uint(id))
+		if err != nil {
+			return fmt.Errorf("export download %v: %w", job.Params["download_id"], err)
+		}
+
+		var write func(io.Writer) error
+		switch d.Kind {
+		case "documents.parquet":
+			write = func(w io.Writer) error { return WriteDocuments(w, repo.EachDocumentBatch) }
+		case "images.parquet":
+			write = func(w io.Writer) error { return WriteImages(w, repo.EachImageBatch) }
+		default:
+			return fmt.Errorf("unknown export %q", d.Kind)
+		}
+
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%d-%s", d.ID, d.Kind))
+		tmp := path + ".tmp"
+		f, err := os.Create(tmp)
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		counter := &countingWriter{w: io.MultiWriter(f, h)}
+		err = write(counter)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(tmp, path)
+		}
+		if err != nil {
+			os.Remove(tmp)
+			return err
+		}
+
+		d.Path, d.SizeBytes, d.SHA256 = path, counter.n, hex.EncodeToString(h.Sum(nil))
+		// Swept before it was built, the file has no download left
+		n, err := repo.SetExportDownloadFile(d.ID, job.ID, d.Path, d.SizeBytes, d.SHA256)
+		if err != nil || n == 0 {
+			os.Remove(path)
+			return err
+		}
+		job.Total, job.Processed = 1, 1
+		job.Result = models.JSON{"download_id": d.ID, "kind": d.Kind, "size_bytes": d.SizeBytes, "sha256": d.SHA256}
+		return p.Save()
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// SweepDownloads deletes the rows of downloads that have expired, or were
+// used up more than an hour ago, and their files once no other download
+// shares them, checking hourly until ctx is cancelled. The hour lets
+// parallel range requests still in flight finish.
+func SweepDownloads(ctx context.Context, repo *repository.Repository) {
+	for {
+		now := time.Now()
+		finished, err := repo.WithContext(ctx).GetFinishedExportDownloads(now, now.Add(-time.Hour))
+		if err != nil {
+			log.Printf("Export download sweep: %v", err)
+		}
+		for _, d := range finished {
+			if d.Path != "" {
+				shared, err := repo.WithContext(ctx).CountOtherExportDownloadsOfFile(d.ID, d.Path)
+				if err != nil {
+					log.Printf("Export download sweep: %v", err)
+					continue
+				}
+				if shared == 0 {
+					if err := os.Remove(d.Path); err != nil && !os.IsNotExist(err) {
+						log.Printf("Export download sweep: %v", err)
+						continue
+					}
+				}
+			}
+			if err := repo.WithContext(ctx).DeleteExportDownload(d.ID); err != nil {
+				log.Printf("Export download sweep: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Hour):
+		}
+	}
+}
+
+// ValidDownloadKind reports whether kind can be built for download
+func ValidDownloadKind(kind string) bool {
+	return slices.Contains(DownloadKinds, kind)
+}
+
+// SignToken makes the download token for download id of archive, valid
+// until expires: "<id>.<expires unix>.<HMAC-SHA256>"
+func SignToken(key []byte, archive string, id uint, expires time.Time) string {
+	payload := fmt.Sprintf("%d.%d", id, expires.Unix())
+	return payload + "." + tokenMAC(key, archive, payload)
+}
+
+// ParseToken checks a download token's signature and returns the download
+// ID and expiry it carries. Whether it has expired is left to the caller.
+func ParseToken(key []byte, archive, token string) (uint, time.Time, error) {
+	i := strings.LastIndex(token, ".")
+	if i < 0 {
+		return 0, time.Time{}, ErrBadToken
+	}
+	payload, mac := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(mac), []byte(tokenMAC(key, archive, payload))) {
+		return 0, time.Time{}, ErrBadToken
+	}
+	idPart, expPart, ok := strings.Cut(payload, ".")
+	id, err1 := strconv.ParseUint(idPart, 10, 32)
+	exp, err2 := strconv.ParseInt(expPart, 10, 64)
+	if !ok || err1 != nil || err2 != nil {
+		return 0, time.Time{}, ErrBadToken
+	}
+	return uint(id), time.Unix(exp, 0).UTC(), nil
+}
+
+func tokenMAC(key []byte, archive, payload string) string {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(archive + ":" + payload))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+// LoadTokenKey returns the download token signing key: secret when given,
+// or else the random key kept in path, created on first use so tokens stay
+// valid across restarts
+func LoadTokenKey(secret, path string) ([]byte, error) {
+	if secret != "" {
+		return []byte(secret), nil
+	}
+	if data, err := os.ReadFile(path); err == nil && len(data) > 0 {
+		return data, nil
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, key, 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
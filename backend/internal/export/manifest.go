@@ -0,0 +1,137 @@
+package export
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/epstein-files/backend/internal/models"
+)
+
+// Manifest lists every file in the archive so mirrors can verify their copy.
+//
+// Each file contributes a leaf SHA256(0x00 || path "\n" sha256 "\n" size);
+// parents are SHA256(0x01 || left || right), with an odd last node carried
+// up unchanged. Files are ordered by path. The signature is Ed25519 over
+// SigningPayload(), which commits to the merkle root and therefore to every
+// file.
+type Manifest struct {
+	Archive     string         `json:"archive"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	FileCount   int            `json:"file_count"`
+	TotalBytes  int64          `json:"total_bytes"`
+	MerkleRoot  string         `json:"merkle_root"`
+	Unhashed    int            `json:"unhashed"` // files skipped for lack of a hash
+	Algorithm   string         `json:"algorithm,omitempty"`
+	PublicKey   string         `json:"public_key,omitempty"`
+	Signature   string         `json:"signature,omitempty"`
+	Files       []ManifestFile `json:"files"`
+}
+
+type ManifestFile struct {
+	Path   string `json:"path"`
+	URL    string `json:"url,omitempty"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// BuildManifest collects the source PDFs and extracted images into a manifest.
+// Files are laid out the way they are published on the CDN.
+func BuildManifest(archive string, documents []models.Document, images []models.Image) *Manifest {
+	m := &Manifest{
+		Archive:     archive,
+		GeneratedAt: time.Now().UTC().Truncate(time.Second),
+		Files:       []ManifestFile{},
+	}
+
+	add := func(f ManifestFile) {
+		if f.SHA256 == "" {
+			m.Unhashed++
+			return
+		}
+		m.Files = append(m.Files, f)
+		m.TotalBytes += f.Size
+	}
+	for _, d := range documents {
+		add(ManifestFile{Path: "pdfs/" + d.Filename, Size: d.SizeBytes, SHA256: d.SHA256})
+	}
+	for _, img := range images {
+		add(ManifestFile{
+			Path:   "images/" + img.DocumentID + "/" + img.Filename,
+			URL:    img.CDNUrl,
+			Size:   img.SizeBytes,
+			SHA256: img.SHA256,
+		})
+	}
+
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+	m.FileCount = len(m.Files)
+	m.MerkleRoot = hex.EncodeToString(merkleRoot(m.Files))
+	return m
+}
+
+// SigningPayload is the exact byte string covered by the signature
+func (m *Manifest) SigningPayload() []byte {
+	return []byte(fmt.Sprintf("%s\n%s\n%d\n%d\n%s",
+		m.Archive, m.GeneratedAt.Format(time.RFC3339), m.FileCount, m.TotalBytes, m.MerkleRoot))
+}
+
+// Sign attaches an Ed25519 signature and the matching public key
+func (m *Manifest) Sign(key ed25519.PrivateKey) {
+	m.Algorithm = "ed25519"
+	m.PublicKey = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	m.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, m.SigningPayload()))
+}
+
+// ParseSigningKey accepts a base64 Ed25519 seed (32 bytes) or private key (64 bytes)
+func ParseSigningKey(s string) (ed25519.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("decode signing key: %w", err)
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	}
+	return nil, errors.New("signing key must be a 32-byte seed or 64-byte private key")
+}
+
+func merkleRoot(files []ManifestFile) []byte {
+	if len(files) == 0 {
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	}
+
+	level := make([][]byte, len(files))
+	for i, f := range files {
+		h := sha256.New()
+		h.Write([]byte{0x00})
+		h.Write([]byte(f.Path + "\n" + f.SHA256 + "\n" + strconv.FormatInt(f.Size, 10)))
+		level[i] = h.Sum(nil)
+	}
+
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			h := sha256.New()
+			h.Write([]byte{0x01})
+			h.Write(level[i])
+			h.Write(level[i+1])
+			next = append(next, h.Sum(nil))
+		}
+		level = next
+	}
+	return level[0]
+}
@@ -0,0 +1,165 @@
+package export
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/parquet-go/parquet-go"
+)
+
+// DocumentRow is the Parquet schema for documents.parquet
+type DocumentRow struct {
+	ID              string    `parquet:"id"`
+	Filename        string    `parquet:"filename"`
+	PageCount       int32     `parquet:"page_count"`
+	BlankPageCount  int32     `parquet:"blank_page_count"`
+	ImageCount      int32     `parquet:"image_count"`
+	SizeBytes       int64     `parquet:"size_bytes"`
+	SHA256          string    `parquet:"sha256"`
+	SourceURL       string    `parquet:"source_url"`
+	RetrievedAt     time.Time `parquet:"retrieved_at,optional,timestamp(millisecond)"` // zero is null
+	RetrievalTool   string    `parquet:"retrieval_tool,dict"`
+	WaybackURL      string    `parquet:"wayback_url"`
+	ResponseHeaders *string   `parquet:"response_headers,optional,json"`
+	WordCount       int32     `parquet:"word_count"`
+	Language        string    `parquet:"language,dict"`
+	AvgWordLength   float64   `parquet:"avg_word_length"`
+	ReadingEase     *float64  `parquet:"reading_ease,optional"`
+	TextSource      string    `parquet:"text_source,dict"`
+	OCRConfidence   *float64  `parquet:"ocr_confidence,optional"`
+	CreatedAt       time.Time `parquet:"created_at,timestamp(millisecond)"`
+	UpdatedAt       time.Time `parquet:"updated_at,timestamp(millisecond)"`
+}
+
+// ImageRow is the Parquet schema for images.parquet
+type ImageRow struct {
+	ID           int64     `parquet:"id"`
+	DocumentID   string    `parquet:"document_id,dict"`
+	Page         int32     `parquet:"page"`
+	Filename     string    `parquet:"filename"`
+	CDNUrl       string    `parquet:"cdn_url"`
+	Width        int32     `parquet:"width"`
+	Height       int32     `parquet:"height"`
+	SizeBytes    int64     `parquet:"size_bytes"`
+	Format       string    `parquet:"format,dict"`
+	HasGPS       bool      `parquet:"has_gps"`
+	DateTaken    string    `parquet:"date_taken"`
+	Sharpness    float64   `parquet:"sharpness"`
+	Brightness   float64   `parquet:"brightness"`
+	Quality      float64   `parquet:"quality"`
+	IsBlank      bool      `parquet:"is_blank"`
+	IsColor      *bool     `parquet:"is_color,optional"`
+	Colorfulness float64   `parquet:"colorfulness"`
+	Megapixels   float64   `parquet:"megapixels"`
+	SizeClass    string    `parquet:"size_class,dict"`
+	Orientation  string    `parquet:"orientation,dict"`
+	SafetyLabel  string    `parquet:"safety_label,dict"`
+	OCRText      string    `parquet:"ocr_text"`
+	Exif         *string   `parquet:"exif,optional,json"`
+	CreatedAt    time.Time `parquet:"created_at,timestamp(millisecond)"`
+}
+
+// BatchSource feeds rows in batches; fn must be called once per batch and
+// the source stops at the first error returned by fn.
+type BatchSource[T any] func(fn func([]T) error) error
+
+// WriteDocuments streams documents from src into a zstd-compressed Parquet
+// file. Each batch becomes a row group so memory stays bounded.
+func WriteDocuments(w io.Writer, src BatchSource[models.Document]) error {
+	return writeParquet(w, src, func(d models.Document) DocumentRow {
+		var headers *string
+		if len(d.ResponseHeaders) > 0 {
+			if data, err := json.Marshal(d.ResponseHeaders); err == nil {
+				s := string(data)
+				headers = &s
+			}
+		}
+		var retrievedAt time.Time
+		if d.RetrievedAt != nil {
+			retrievedAt = *d.RetrievedAt
+		}
+		return DocumentRow{
+			ID:              d.ID,
+			Filename:        d.Filename,
+			PageCount:       int32(d.PageCount),
+			BlankPageCount:  int32(d.BlankPageCount),
+			ImageCount:      int32(d.ImageCount),
+			SizeBytes:       d.SizeBytes,
+			SHA256:          d.SHA256,
+			SourceURL:       d.SourceURL,
+			RetrievedAt:     retrievedAt,
+			RetrievalTool:   d.RetrievalTool,
+			WaybackURL:      d.WaybackURL,
+			ResponseHeaders: headers,
+			WordCount:       int32(d.WordCount),
+			Language:        d.Language,
+			AvgWordLength:   d.AvgWordLength,
+			ReadingEase:     d.ReadingEase,
+			TextSource:      d.TextSource,
+			OCRConfidence:   d.OCRConfidence,
+			CreatedAt:       d.CreatedAt,
+			UpdatedAt:       d.UpdatedAt,
+		}
+	})
+}
+
+// WriteImages streams images from src into a zstd-compressed Parquet file
+func WriteImages(w io.Writer, src BatchSource[models.Image]) error {
+	return writeParquet(w, src, func(img models.Image) ImageRow {
+		var exif *string
+		if len(img.Exif) > 0 {
+			if data, err := json.Marshal(img.Exif); err == nil {
+				s := string(data)
+				exif = &s
+			}
+		}
+		return ImageRow{
+			ID:           int64(img.ID),
+			DocumentID:   img.DocumentID,
+			Page:         int32(img.Page),
+			Filename:     img.Filename,
+			CDNUrl:       img.CDNUrl,
+			Width:        int32(img.Width),
+			Height:       int32(img.Height),
+			SizeBytes:    img.SizeBytes,
+			Format:       img.Format,
+			HasGPS:       img.HasGPS,
+			DateTaken:    img.DateTaken,
+			Sharpness:    img.Sharpness,
+			Brightness:   img.Brightness,
+			Quality:      img.Quality,
+			IsBlank:      img.IsBlank,
+			IsColor:      img.IsColor,
+			Colorfulness: img.Colorfulness,
+			Megapixels:   img.Megapixels,
+			SizeClass:    img.SizeClass,
+			Orientation:  img.Orientation,
+			SafetyLabel:  img.SafetyLabel,
+			OCRText:      img.OCRText,
+			Exif:         exif,
+			CreatedAt:    img.CreatedAt,
+		}
+	})
+}
+
+func writeParquet[M any, R any](w io.Writer, src BatchSource[M], convert func(M) R) error {
+	pw := parquet.NewGenericWriter[R](w, parquet.Compression(&parquet.Zstd))
+
+	rows := make([]R, 0, 1000)
+	err := src(func(batch []M) error {
+		rows = rows[:0]
+		for _, m := range batch {
+			rows = append(rows, convert(m))
+		}
+		if _, err := pw.Write(rows); err != nil {
+			return err
+		}
+		return pw.Flush()
+	})
+	if err != nil {
+		return err
+	}
+	return pw.Close()
+}
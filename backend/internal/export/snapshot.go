@@ -0,0 +1,70 @@
+package export
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Vacuumer copies the live database to a standalone file
+type Vacuumer interface {
+	VacuumInto(path string) error
+}
+
+// Snapshotter periodically rebuilds a read-only copy of the database that
+// analysts can download and query without touching the production file
+type Snapshotter struct {
+	db       Vacuumer
+	path     string
+	interval time.Duration
+}
+
+func NewSnapshotter(db Vacuumer, path string, interval time.Duration) *Snapshotter {
+	return &Snapshotter{db: db, path: path, interval: interval}
+}
+
+// Run builds the snapshot whenever it is missing or older than the interval,
+// then every interval until ctx is cancelled
+func (s *Snapshotter) Run(ctx context.Context) {
+	if info, err := os.Stat(s.path); err != nil || time.Since(info.ModTime()) >= s.interval {
+		s.buildAndLog()
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.buildAndLog()
+		}
+	}
+}
+
+func (s *Snapshotter) buildAndLog() {
+	start := time.Now()
+	if err := s.Build(); err != nil {
+		log.Printf("Snapshot %s failed: %v", s.path, err)
+		return
+	}
+	log.Printf("Snapshot %s rebuilt in %s", s.path, time.Since(start).Round(time.Millisecond))
+}
+
+// Build writes the snapshot to a temporary file and swaps it in atomically,
+// so downloads in progress keep reading the previous copy
+func (s *Snapshotter) Build() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	os.Remove(tmp) // VACUUM INTO refuses to overwrite
+	if err := s.db.VacuumInto(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,154 @@
+// Package features gates experimental endpoints per deployment and per API
+// key. Flags come from the configuration (FEATURES, FEATURE_KEYS), and an
+// archive's feature_flags rows override them.
+package features
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/epstein-files/backend/internal/config"
+	"github.com/epstein-files/backend/internal/middleware"
+	"github.com/epstein-files/backend/internal/models"
+)
+
+// Flags
+const (
+	Faces         = "faces"
+	Contributions = "contributions"
+)
+
+// Known describes every flag
+var Known = map[string]string{
+	Faces:         "Anonymous face cluster endpoints (/api/faces)",
+	Contributions: "Contributor uploads (/api/contrib)",
+}
+
+// Flag is a flag's effective setting: on for everyone, or only for
+// requests made with one of Keys
+type Flag struct {
+	Enabled bool     `json:"enabled"`
+	Keys    []string `json:"keys,omitempty"`
+	Source  string   `json:"source"` // "config" or "database"
+}
+
+// Set holds one archive's flags
+type Set struct {
+	mu     sync.RWMutex
+	config map[string]Flag
+	stored map[string]Flag
+	tokens map[string]string // API key token -> key name
+}
+
+func New(cfg *config.Config) *Set {
+	s := &Set{stored: make(map[string]Flag)}
+	s.SetConfig(cfg)
+	return s
+}
+
+// SetConfig applies FEATURES and FEATURE_KEYS, at startup and on reload
+func (s *Set) SetConfig(cfg *config.Config) {
+	flags := make(map[string]Flag)
+	for name := range Known {
+		flags[name] = Flag{Keys: cfg.FeatureKeys[name], Source: "config"}
+	}
+	for _, name := range cfg.Features {
+		if f, ok := flags[name]; ok {
+			f.Enabled = true
+			flags[name] = f
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = flags
+	s.tokens = cfg.ContribTokens
+}
+
+// SetStored applies the archive's stored overrides, replacing earlier ones
+func (s *Set) SetStored(rows []models.FeatureFlag) {
+	stored := make(map[string]Flag)
+	for _, row := range rows {
+		if _, ok := Known[row.Name]; !ok {
+			continue
+		}
+		f := Flag{Enabled: row.Enabled, Source: "database"}
+		for _, key := range strings.Split(row.Keys, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				f.Keys = append(f.Keys, key)
+			}
+		}
+		stored[row.Name] = f
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stored = stored
+}
+
+// All returns every flag's effective setting
+func (s *Set) All() map[string]Flag {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	all := make(map[string]Flag, len(Known))
+	for name := range Known {
+		all[name] = s.get(name)
+	}
+	return all
+}
+
+// get returns a flag's setting; the caller holds mu
+func (s *Set) get(name string) Flag {
+	if f, ok := s.stored[name]; ok {
+		return f
+	}
+	return s.config[name]
+}
+
+// Enabled reports whether the flag is on for the request's API key
+func (s *Set) Enabled(name string, r *http.Request) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f := s.get(name)
+	if f.Enabled {
+		return true
+	}
+	if len(f.Keys) == 0 {
+		return false
+	}
+	key := s.keyName(r)
+	return key != "" && slices.Contains(f.Keys, key)
+}
+
+// For reports every flag as it applies to the request, for capability
+// detection
+func (s *Set) For(r *http.Request) map[string]bool {
+	flags := make(map[string]bool, len(Known))
+	for name := range Known {
+		flags[name] = s.Enabled(name, r)
+	}
+	return flags
+}
+
+// Require answers 404, as if the route didn't exist, unless the flag is on
+// for the request
+func (s *Set) Require(name string) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !s.Enabled(name, r) {
+				http.NotFound(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// keyName names the API key the request was made with. The caller holds mu.
+func (s *Set) keyName(r *http.Request) string {
+	return middleware.KeyName(s.tokens, r)
+}
@@ -0,0 +1,517 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/epstein-files/backend/internal/auth"
+	"github.com/epstein-files/backend/internal/config"
+	"github.com/epstein-files/backend/internal/counts"
+	"github.com/epstein-files/backend/internal/dedup"
+	"github.com/epstein-files/backend/internal/enrich"
+	"github.com/epstein-files/backend/internal/features"
+	"github.com/epstein-files/backend/internal/integrity"
+	"github.com/epstein-files/backend/internal/logging"
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/purge"
+	"github.com/epstein-files/backend/internal/reingest"
+	"github.com/epstein-files/backend/internal/repository"
+	"github.com/epstein-files/backend/internal/verify"
+)
+
+// ============================================================================
+// ADMIN
+// ============================================================================
+
+// Only one FTS optimize may run at a time
+var ftsOptimizeMu sync.Mutex
+
+// GetFTSStatus reports full-text index size and health
+// GET /api/admin/fts/status
+func (h *Handlers) GetFTSStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := h.repoFor(r).GetFTSStatus(h.cfg.FTSOptions())
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// OptimizeFTS merges the full-text index segments
+// POST /api/admin/fts/optimize
+func (h *Handlers) OptimizeFTS(w http.ResponseWriter, r *http.Request) {
+	if !ftsOptimizeMu.TryLock() {
+		writeJSON(w, http.StatusConflict, H{"error": "Optimize already running"})
+		return
+	}
+	defer ftsOptimizeMu.Unlock()
+
+	if err := h.repoFor(r).OptimizeFTS(); err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	h.GetFTSStatus(w, r)
+}
+
+// cacheCounter counts lookups of an in-memory cache for the overview
+type cacheCounter struct {
+	hits, misses atomic.Int64
+}
+
+func (c *cacheCounter) hit()  { c.hits.Add(1) }
+func (c *cacheCounter) miss() { c.misses.Add(1) }
+
+func (c *cacheCounter) stats() models.CacheStats {
+	s := models.CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load()}
+	if total := s.Hits + s.Misses; total > 0 {
+		s.HitRate = float64(s.Hits) / float64(total)
+	}
+	return s
+}
+
+// ReloadConfig re-reads CONFIG_FILE like SIGHUP does, for every archive, and
+// returns the settings that took effect
+// POST /api/admin/config/reload
+func (h *Handlers) ReloadConfig(w http.ResponseWriter, r *http.Request) {
+	cfg, err := config.Reload()
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, H{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, H{
+		"config_file":            config.ConfigFile(),
+		"log_level":              logging.Level(),
+		"cors_allowed_origins":   cfg.CORSAllowedOrigins,
+		"cors_allow_credentials": cfg.CORSAllowCredentials,
+		"cors_public_paths":      cfg.CORSPublicPaths,
+	})
+}
+
+// GetFeatures lists every feature flag with its effective setting
+// GET /api/admin/features
+func (h *Handlers) GetFeatures(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, H{"features": h.features.All(), "known": features.Known})
+}
+
+// SetFeature stores an override for a flag in this archive
+// PUT /api/admin/features/{name}?enabled=false&keys=alice,bob
+func (h *Handlers) SetFeature(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, ok := features.Known[name]; !ok {
+		writeJSON(w, http.StatusNotFound, H{"error": "Unknown feature"})
+		return
+	}
+	enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, H{"error": "enabled must be true or false"})
+		return
+	}
+
+	flag := &models.FeatureFlag{Name: name, Enabled: enabled, Keys: r.URL.Query().Get("keys")}
+	h.saveFeatures(w, r, func(repo *repository.Repository) error {
+		return repo.SaveFeatureFlag(flag)
+	})
+}
+
+// DeleteFeature removes a flag's override, so it follows FEATURES and
+// FEATURE_KEYS again
+// DELETE /api/admin/features/{name}
+func (h *Handlers) DeleteFeature(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	h.saveFeatures(w, r, func(repo *repository.Repository) error {
+		return repo.DeleteFeatureFlag(name)
+	})
+}
+
+// saveFeatures applies a change to the stored flags and reloads them
+func (h *Handlers) saveFeatures(w http.ResponseWriter, r *http.Request, change func(*repository.Repository) error) {
+	repo := h.repoFor(r)
+	if err := change(repo); err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	stored, err := repo.GetFeatureFlags()
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	h.features.SetStored(stored)
+
+	writeJSON(w, http.StatusOK, H{"features": h.features.All()})
+}
+
+// GetOverview gathers queue depth, last ingest, database and storage size,
+// cache hit rates, request error rates and FTS health for the operations
+// dashboard
+// GET /api/admin/overview
+func (h *Handlers) GetOverview(w http.ResponseWriter, r *http.Request) {
+	repo := h.repoFor(r)
+	overview, err := repo.GetOverview()
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	if overview.FTS, err = repo.GetFTSStatus(h.cfg.FTSOptions()); err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	if info, err := os.Stat(h.cfg.DatabaseURL + "-wal"); err == nil {
+		overview.Database.WALBytes = info.Size()
+	}
+	if info, err := os.Stat(h.cfg.SnapshotPath()); err == nil {
+		overview.Storage.SnapshotBytes = info.Size()
+		overview.Storage.TotalBytes += info.Size()
+	}
+
+	overview.Caches = map[string]models.CacheStats{
+		"manifest": h.manifest.stats.stats(),
+		"search":   h.search.stats.stats(),
+	}
+	overview.Requests = h.requests.Stats()
+	overview.Breakers = h.breakers.Stats()
+	// A lock left by an ingest that died is not an ingest running
+	if lock, err := repo.GetIngestLock(); err == nil && lock != nil && !lock.Stale(h.cfg.IngestLockStale()) {
+		overview.Ingest = lock
+	}
+	if h.replica != nil {
+		status := h.replica.Status()
+		overview.Replica = &status
+	}
+
+	writeJSON(w, http.StatusOK, overview)
+}
+
+// ============================================================================
+// JOBS
+// ============================================================================
+
+// Recompute queues a job that re-runs enrichment stages over stored images
+// POST /api/admin/recompute?fields=phash,quality,exif,color&document_id=xxx
+func (h *Handlers) Recompute(w http.ResponseWriter, r *http.Request) {
+	fields, err := enrich.ParseStages(r.URL.Query().Get("fields"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, H{"error": err.Error()})
+		return
+	}
+
+	params := enrich.RecomputeParams(fields, r.URL.Query().Get("document_id"))
+	job, err := h.jobs.Enqueue(r.Context(), enrich.RecomputeJobType, params)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// ReingestDocument queues a job that re-runs the ingest pipeline for one
+// document, e.g. after a corrupt download was replaced, and records it in
+// the audit log
+// POST /api/admin/documents/{id}/reingest?stages=text,images,exif
+func (h *Handlers) ReingestDocument(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	stages, err := reingest.ParseStages(r.URL.Query().Get("stages"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, H{"error": err.Error()})
+		return
+	}
+
+	repo := h.repoFor(r)
+	exists, err := repo.DocumentExists(id)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	if !exists {
+		writeJSON(w, http.StatusNotFound, H{"error": "Document not found"})
+		return
+	}
+
+	job, err := h.jobs.Enqueue(r.Context(), reingest.JobType, reingest.Params(id, stages))
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	err = repo.RecordAudit(&models.AuditEntry{
+		Action:     models.AuditReingest,
+		Target:     id,
+		Details:    models.JSON{"stages": stages, "job_id": job.ID},
+		RemoteAddr: r.RemoteAddr,
+		Actor:      auth.Actor(r.Context()),
+	})
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// GetAuditLog lists audit entries, newest first
+// GET /api/admin/audit?target=xxx&limit=50
+func (h *Handlers) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	limit := getIntParam(r, "limit", 50)
+	if limit > 100 {
+		limit = 100
+	}
+
+	entries, err := h.repoFor(r).GetAuditLog(r.URL.Query().Get("target"), limit)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, H{"data": entries})
+}
+
+// GetUsage reports the opt-in usage statistics: requests per day, and per
+// route with error rates and latency, over the last days days
+// GET /api/admin/usage?days=30
+func (h *Handlers) GetUsage(w http.ResponseWriter, r *http.Request) {
+	if h.usage == nil {
+		writeJSON(w, http.StatusNotFound, H{"error": "Usage statistics are off, set USAGE_STATS=true to collect them"})
+		return
+	}
+	days := getIntParam(r, "days", 30)
+	if days < 1 {
+		days = 1
+	}
+	if days > h.cfg.UsageStatsDays {
+		days = h.cfg.UsageStatsDays
+	}
+
+	report, err := h.usage.Report(r.Context(), days)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// VerifySample queues an integrity check of a random sample of source PDFs
+// POST /api/admin/verify?percent=1
+func (h *Handlers) VerifySample(w http.ResponseWriter, r *http.Request) {
+	percent := h.cfg.VerifySamplePercent
+	if v := r.URL.Query().Get("percent"); v != "" {
+		p, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, H{"error": "Invalid percent, expected (0, 100]"})
+			return
+		}
+		percent = p
+	}
+	// The default too, as VERIFY_SAMPLE_PERCENT=0 only turns the schedule off
+	if !(percent > 0 && percent <= 100) {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid percent, expected (0, 100]"})
+		return
+	}
+
+	job, err := h.jobs.Enqueue(r.Context(), verify.SampleJobType, verify.SampleParams(percent))
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// ClusterDuplicates queues a job that rebuilds the near-duplicate document clusters
+// POST /api/admin/dedup?threshold=0.8
+func (h *Handlers) ClusterDuplicates(w http.ResponseWriter, r *http.Request) {
+	threshold := h.cfg.DedupThreshold
+	if v := r.URL.Query().Get("threshold"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil || t <= 0 || t > 1 {
+			writeJSON(w, http.StatusBadRequest, H{"error": "Invalid threshold, expected (0, 1]"})
+			return
+		}
+		threshold = t
+	}
+
+	job, err := h.jobs.Enqueue(r.Context(), dedup.ClusterJobType, dedup.ClusterParams(threshold))
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// BackfillCounts queues a job filling in the page and image counts of the
+// documents missing them, or recounting every document with all=true
+// POST /api/admin/counts?all=true
+func (h *Handlers) BackfillCounts(w http.ResponseWriter, r *http.Request) {
+	job, err := h.jobs.Enqueue(r.Context(), counts.JobType, counts.Params(r.URL.Query().Get("all") == "true"))
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// CleanupOrphans queues a job removing the images whose document is gone,
+// with their tags and faces; files=true also removes those whose stored file
+// is gone, dry_run=true only reports them
+// POST /api/admin/integrity/cleanup?files=true&dry_run=true
+func (h *Handlers) CleanupOrphans(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	job, err := h.jobs.Enqueue(r.Context(), integrity.JobType, integrity.Params(q.Get("files") == "true", q.Get("dry_run") == "true"))
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// GetIntegrity reports the rows referring to a document or image that is
+// gone, whether foreign keys are enforced, and the last cleanup job with
+// what it removed
+// GET /api/admin/integrity
+func (h *Handlers) GetIntegrity(w http.ResponseWriter, r *http.Request) {
+	repo := h.repoFor(r)
+	enforced, err := repo.ForeignKeysEnforced()
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	violations, err := repo.GetIntegrityViolations()
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	last, err := repo.LastJob(integrity.JobType)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, H{"foreign_keys": enforced, "violations": violations, "last_cleanup": last})
+}
+
+// DeleteDataset queues a job removing a dataset with all its documents and
+// what derives from them, rows and stored files. With dry_run it only
+// counts the rows that would go, by table, and queues nothing. A dataset
+// without its own row can still be removed while documents match it. The
+// removal is recorded in the audit log.
+// DELETE /api/admin/datasets/{id}?dry_run=true
+func (h *Handlers) DeleteDataset(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid dataset ID"})
+		return
+	}
+
+	repo := h.repoFor(r)
+	footprint, err := repo.GetDatasetFootprint(uint(id))
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	if footprint["datasets"] == 0 && footprint["documents"] == 0 {
+		writeJSON(w, http.StatusNotFound, H{"error": "Dataset not found"})
+		return
+	}
+	if r.URL.Query().Get("dry_run") == "true" {
+		writeJSON(w, http.StatusOK, H{"dataset_id": id, "dry_run": true, "rows": footprint})
+		return
+	}
+	if h.cfg.LegalHold {
+		writeJSON(w, http.StatusConflict, H{"error": "Legal hold is on; datasets cannot be deleted"})
+		return
+	}
+
+	// Recorded first, so no removal runs without its audit entry
+	err = repo.RecordAudit(&models.AuditEntry{
+		Action:     models.AuditDatasetDelete,
+		Target:     strconv.FormatUint(id, 10),
+		Details:    models.JSON{"rows": footprint},
+		RemoteAddr: r.RemoteAddr,
+		Actor:      auth.Actor(r.Context()),
+	})
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	job, err := h.jobs.Enqueue(r.Context(), purge.JobType, purge.Params(uint(id)))
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// GetJobs lists background jobs, newest first
+// GET /api/admin/jobs?limit=50
+func (h *Handlers) GetJobs(w http.ResponseWriter, r *http.Request) {
+	limit := getIntParam(r, "limit", 50)
+	if limit > 100 {
+		limit = 100
+	}
+
+	list, err := h.repoFor(r).GetJobs(limit)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, H{"data": list})
+}
+
+// GetJob returns a job with its progress
+// GET /api/admin/jobs/{id}
+func (h *Handlers) GetJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid job ID"})
+		return
+	}
+
+	job, err := h.repoFor(r).GetJob(uint(id))
+	if err != nil {
+		writeError(w, r, err, "Job not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, job)
+}
+
+// GenerateStatsReport queues a fresh transparency report, unless one is
+// already queued or running
+// POST /api/admin/stats-report
+func (h *Handlers) GenerateStatsReport(w http.ResponseWriter, r *http.Request) {
+	job, err := h.queueStatsReport(r)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// CancelJob stops a queued or running job
+// POST /api/admin/jobs/{id}/cancel
+func (h *Handlers) CancelJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid job ID"})
+		return
+	}
+
+	job, err := h.repoFor(r).CancelJob(uint(id))
+	if err != nil {
+		writeError(w, r, err, "Job not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, job)
+}
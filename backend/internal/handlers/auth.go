@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/epstein-files/backend/internal/auth"
+)
+
+// ============================================================================
+// SINGLE SIGN-ON
+// ============================================================================
+
+// GetAuthProviders lists the providers admins can sign in with
+// GET /api/auth/providers
+func (h *Handlers) GetAuthProviders(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, H{"providers": h.sso.Providers()})
+}
+
+// Login sends the browser to a provider to sign in, and back to return_to
+// (a path on this server or a URL on an allowed CORS origin) afterwards
+// GET /api/auth/{provider}/login?return_to=/admin
+func (h *Handlers) Login(w http.ResponseWriter, r *http.Request) {
+	dest, err := h.sso.Login(w, r, r.PathValue("provider"), r.URL.Query().Get("return_to"))
+	if errors.Is(err, auth.ErrUnknownProvider) {
+		writeJSON(w, http.StatusNotFound, H{"error": "Provider not found"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, H{"error": err.Error()})
+		return
+	}
+	http.Redirect(w, r, dest, http.StatusFound)
+}
+
+// LoginCallback is where the provider sends the browser back; it starts the
+// session and redirects on to where the login was asked to return
+// GET /api/auth/{provider}/callback?code=xxx&state=xxx
+func (h *Handlers) LoginCallback(w http.ResponseWriter, r *http.Request) {
+	_, returnTo, err := h.sso.Callback(w, r, r.PathValue("provider"))
+	switch {
+	case errors.Is(err, auth.ErrUnknownProvider):
+		writeJSON(w, http.StatusNotFound, H{"error": "Provider not found"})
+	case errors.Is(err, auth.ErrLoginState):
+		writeJSON(w, http.StatusBadRequest, H{"error": err.Error()})
+	case errors.Is(err, auth.ErrNoRole):
+		writeJSON(w, http.StatusForbidden, H{"error": err.Error()})
+	case err != nil:
+		writeJSON(w, http.StatusBadGateway, H{"error": err.Error()})
+	default:
+		http.Redirect(w, r, returnTo, http.StatusSeeOther)
+	}
+}
+
+// GetSession reports who is signed in and with which roles
+// GET /api/auth/session
+func (h *Handlers) GetSession(w http.ResponseWriter, r *http.Request) {
+	session, err := h.sso.Session(r)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	if session == nil {
+		writeJSON(w, http.StatusUnauthorized, H{"error": "Not signed in"})
+		return
+	}
+	writeJSON(w, http.StatusOK, H{"session": session, "roles": session.RoleList()})
+}
+
+// Logout ends the session
+// POST /api/auth/logout
+func (h *Handlers) Logout(w http.ResponseWriter, r *http.Request) {
+	if err := h.sso.Logout(w, r); err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	writeJSON(w, http.StatusOK, H{"signed_out": true})
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/epstein-files/backend/internal/blobs"
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/storage"
+)
+
+// ============================================================================
+// BLOBS
+// ============================================================================
+
+// GetBlob serves a file from the content-addressed store. The URL names the
+// content, so it can be cached forever; only blobs a document or image
+// refers to are served.
+// GET /api/blobs/{hash}
+func (h *Handlers) GetBlob(w http.ResponseWriter, r *http.Request) {
+	hash := r.PathValue("hash")
+	if !blobs.ValidHash(hash) {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid hash, expected a lowercase hex SHA-256"})
+		return
+	}
+
+	blob, err := h.repoFor(r).GetBlob(hash)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	if blob == nil {
+		writeJSON(w, http.StatusNotFound, H{"error": "Blob not found"})
+		return
+	}
+
+	rc, err := h.uploads.Open(r.Context(), storage.BlobKey(hash))
+	if errors.Is(err, storage.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, H{"error": "File not in storage"})
+		return
+	}
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", blob.ContentType)
+	w.Header().Set("ETag", `"`+hash+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	if content, ok := rc.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", blob.CreatedAt, content)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(blob.Size, 10))
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, rc)
+}
+
+// ImportBlobs queues a job copying the source PDFs and images into the
+// content-addressed store
+// POST /api/admin/blobs/import
+func (h *Handlers) ImportBlobs(w http.ResponseWriter, r *http.Request) {
+	job, err := h.jobs.Enqueue(r.Context(), blobs.ImportJobType, models.JSON{})
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// CollectBlobs queues a job deleting the blobs nothing refers to any more
+// POST /api/admin/blobs/gc
+func (h *Handlers) CollectBlobs(w http.ResponseWriter, r *http.Request) {
+	job, err := h.jobs.Enqueue(r.Context(), blobs.GCJobType, models.JSON{})
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// setBlobURLs points the document and its images at their blobs, leaving
+// out images safe mode blurred
+func (h *Handlers) setBlobURLs(r *http.Request, document *models.Document) error {
+	repo := h.repoFor(r)
+	refs, err := repo.GetBlobRefs(models.BlobDocument, []string{document.ID})
+	if err != nil {
+		return err
+	}
+	if sha := refs[document.ID]; sha != "" {
+		document.BlobURL = blobURL(r, sha)
+	}
+	return h.setImageBlobURLs(r, document.Images)
+}
+
+func (h *Handlers) setImageBlobURLs(r *http.Request, images []models.Image) error {
+	owners := make([]string, 0, len(images))
+	for _, image := range images {
+		owners = append(owners, strconv.FormatUint(uint64(image.ID), 10))
+	}
+	refs, err := h.repoFor(r).GetBlobRefs(models.BlobImage, owners)
+	if err != nil {
+		return err
+	}
+	for i := range images {
+		if sha := refs[owners[i]]; sha != "" && !images[i].Blurred {
+			images[i].BlobURL = blobURL(r, sha)
+		}
+	}
+	return nil
+}
+
+func blobURL(r *http.Request, sha string) string {
+	return baseURL(r) + "/api/blobs/" + sha
+}
@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/epstein-files/backend/internal/contrib"
+	"github.com/epstein-files/backend/internal/middleware"
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/repository"
+	"github.com/epstein-files/backend/internal/storage"
+)
+
+// Multipart parts beyond the file itself (provenance fields) are small
+const contribFormOverhead = 1 << 20
+
+// ============================================================================
+// CONTRIBUTIONS
+// ============================================================================
+
+// UploadContribution accepts a PDF from a trusted contributor into the
+// moderation queue
+// POST /api/contrib/documents (multipart: file, title, source_url, retrieved_at, notes)
+func (h *Handlers) UploadContribution(w http.ResponseWriter, r *http.Request) {
+	maxBytes := int64(h.cfg.ContribMaxUploadMB) << 20
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+contribFormOverhead)
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSON(w, http.StatusRequestEntityTooLarge, H{"error": contrib.ErrTooLarge.Error()})
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid multipart form"})
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	var retrievedAt *time.Time
+	if v := r.FormValue("retrieved_at"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, H{"error": "Invalid retrieved_at, expected RFC 3339"})
+			return
+		}
+		retrievedAt = &t
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Missing file"})
+		return
+	}
+	defer file.Close()
+
+	upload, err := contrib.Receive(file, maxBytes)
+	switch {
+	case errors.Is(err, contrib.ErrTooLarge):
+		writeJSON(w, http.StatusRequestEntityTooLarge, H{"error": err.Error()})
+		return
+	case errors.Is(err, contrib.ErrNotPDF):
+		writeJSON(w, http.StatusUnsupportedMediaType, H{"error": err.Error()})
+		return
+	case err != nil:
+		writeError(w, r, err, "")
+		return
+	}
+	defer upload.Remove()
+
+	repo := h.repoFor(r)
+	documentID, contributionID, err := repo.FindByHash(upload.SHA256)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	if documentID != "" || contributionID != 0 {
+		writeJSON(w, http.StatusConflict, H{
+			"error":           "File already in the archive",
+			"document_id":     documentID,
+			"contribution_id": contributionID,
+		})
+		return
+	}
+
+	clean, result, err := h.scanner.Scan(r.Context(), upload.Path)
+	if err != nil {
+		log.Printf("Contribution from %s: %v", middleware.Contributor(r.Context()), err)
+		writeJSON(w, http.StatusServiceUnavailable, H{"error": "Virus scan unavailable, try again later"})
+		return
+	}
+	if !clean {
+		log.Printf("Contribution from %s rejected by virus scan: %s", middleware.Contributor(r.Context()), result)
+		writeJSON(w, http.StatusUnprocessableEntity, H{"error": "File failed virus scan", "scan_result": result})
+		return
+	}
+
+	key := storage.ContributionKey(upload.SHA256)
+	if err := h.putFile(r, key, upload.Path); err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	c := &models.Contribution{
+		Contributor: middleware.Contributor(r.Context()),
+		Filename:    header.Filename,
+		StorageKey:  key,
+		SizeBytes:   upload.SizeBytes,
+		SHA256:      upload.SHA256,
+		ScanResult:  result,
+		Title:       r.FormValue("title"),
+		SourceURL:   r.FormValue("source_url"),
+		RetrievedAt: retrievedAt,
+		Notes:       r.FormValue("notes"),
+	}
+	if err := repo.CreateContribution(c); err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, c)
+}
+
+// GetMyContributions lists the authenticated contributor's uploads
+// GET /api/contrib/documents?status=pending&cursor=xxx&limit=50
+func (h *Handlers) GetMyContributions(w http.ResponseWriter, r *http.Request) {
+	h.listContributions(w, r, middleware.Contributor(r.Context()))
+}
+
+// GetContributions lists the moderation queue
+// GET /api/admin/contributions?status=pending&cursor=xxx&limit=50
+func (h *Handlers) GetContributions(w http.ResponseWriter, r *http.Request) {
+	h.listContributions(w, r, r.URL.Query().Get("contributor"))
+}
+
+func (h *Handlers) listContributions(w http.ResponseWriter, r *http.Request, contributor string) {
+	cursor := r.URL.Query().Get("cursor")
+	limit := getIntParam(r, "limit", 50)
+	if limit > 100 {
+		limit = 100
+	}
+
+	result, err := h.repoFor(r).GetContributions(r.URL.Query().Get("status"), contributor, cursor, limit)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	paginate(r, result, limit)
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// GetContributionFile downloads an uploaded PDF for review
+// GET /api/admin/contributions/{id}/file
+func (h *Handlers) GetContributionFile(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.contribution(w, r)
+	if !ok {
+		return
+	}
+
+	f, err := h.uploads.Open(r.Context(), c.StorageKey)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, H{"error": "File not found"})
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `inline; filename="`+c.SHA256+`.pdf"`)
+	w.Header().Set("Content-Length", strconv.FormatInt(c.SizeBytes, 10))
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, f)
+}
+
+// ApproveContribution publishes an upload: the PDF and a provenance sidecar
+// are copied into downloads/ under its document ID, where the extraction
+// scripts pick them up. An ID already taken by a document or a file in
+// downloads/ is refused.
+// POST /api/admin/contributions/{id}/approve?document_id=xxx&note=xxx
+func (h *Handlers) ApproveContribution(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.contribution(w, r)
+	if !ok {
+		return
+	}
+
+	documentID := r.URL.Query().Get("document_id")
+	if documentID == "" {
+		documentID = contrib.DocumentID(c.Filename)
+	}
+	if !contrib.ValidDocumentID(documentID) {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid document_id; use letters, digits, '-' and '_'"})
+		return
+	}
+
+	if c.Status != models.ContribPending {
+		writeJSON(w, http.StatusConflict, H{"error": repository.ErrAlreadyReviewed.Error()})
+		return
+	}
+
+	// An original downloaded but not ingested yet, or kept by a dataset
+	// removal, is in downloads/ without a row; it must not be replaced
+	repo := h.repoFor(r)
+	exists, err := repo.DocumentExists(documentID)
+	if err == nil && !exists {
+		exists, err = h.uploads.Exists(r.Context(), storage.DocumentKey(documentID+".pdf"))
+	}
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	if exists {
+		writeJSON(w, http.StatusConflict, H{"error": "Document ID already in use"})
+		return
+	}
+
+	src, err := h.uploads.Open(r.Context(), c.StorageKey)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	defer src.Close()
+	if err := h.uploads.Put(r.Context(), storage.DocumentKey(documentID+".pdf"), src); err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	// The contributor's account of where the file came from travels with it
+	sidecar, _ := json.MarshalIndent(contrib.Provenance{
+		SourceURL:     c.SourceURL,
+		RetrievedAt:   c.RetrievedAt,
+		RetrievalTool: "contribution:" + c.Contributor,
+		SHA256:        c.SHA256,
+		SizeBytes:     c.SizeBytes,
+	}, "", "  ")
+	key := storage.DocumentKey(contrib.ProvenanceFilename(documentID))
+	if err := h.uploads.Put(r.Context(), key, bytes.NewReader(sidecar)); err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	h.review(w, r, c, models.ContribApproved, documentID)
+}
+
+// RejectContribution declines an upload; the file is kept for the record
+// POST /api/admin/contributions/{id}/reject?note=xxx
+func (h *Handlers) RejectContribution(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.contribution(w, r)
+	if !ok {
+		return
+	}
+	h.review(w, r, c, models.ContribRejected, "")
+}
+
+func (h *Handlers) review(w http.ResponseWriter, r *http.Request, c *models.Contribution, status, documentID string) {
+	err := h.repoFor(r).ReviewContribution(c, status, r.URL.Query().Get("note"), documentID)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, c)
+}
+
+func (h *Handlers) contribution(w http.ResponseWriter, r *http.Request) (*models.Contribution, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid contribution ID"})
+		return nil, false
+	}
+
+	c, err := h.repoFor(r).GetContribution(uint(id))
+	if err != nil {
+		writeError(w, r, err, "Contribution not found")
+		return nil, false
+	}
+	return c, true
+}
+
+func (h *Handlers) putFile(r *http.Request, key, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return h.uploads.Put(r.Context(), key, f)
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/storage"
+)
+
+// GetDatasets lists the DOJ releases with their metadata files (without text)
+// GET /api/datasets
+func (h *Handlers) GetDatasets(w http.ResponseWriter, r *http.Request) {
+	datasets, err := h.repoFor(r).GetDatasets()
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, H{"data": datasets})
+}
+
+// GetDataset returns one release with the text of its README, index and
+// cover letter files
+// GET /api/datasets/{id}
+func (h *Handlers) GetDataset(w http.ResponseWriter, r *http.Request) {
+	dataset, ok := h.dataset(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, dataset)
+}
+
+// GetDatasetFile streams a dataset metadata file as it was shipped
+// GET /api/datasets/{id}/files/{fileId}
+func (h *Handlers) GetDatasetFile(w http.ResponseWriter, r *http.Request) {
+	dataset, ok := h.dataset(w, r)
+	if !ok {
+		return
+	}
+
+	fileID, err := strconv.ParseUint(r.PathValue("fileId"), 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid file ID"})
+		return
+	}
+	var file *models.DatasetFile
+	for i := range dataset.Files {
+		if dataset.Files[i].ID == uint(fileID) {
+			file = &dataset.Files[i]
+			break
+		}
+	}
+	if file == nil {
+		writeJSON(w, http.StatusNotFound, H{"error": "File not found"})
+		return
+	}
+
+	rc, err := h.files.Open(r.Context(), storage.DatasetFileKey(dataset.ID, file.Filename))
+	if errors.Is(err, storage.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, H{"error": "File not in storage"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, H{"error": err.Error()})
+		return
+	}
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", file.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": file.Filename}))
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, rc)
+}
+
+// dataset loads the dataset named by the {id} path value, writing the error
+// response itself when it can't
+func (h *Handlers) dataset(w http.ResponseWriter, r *http.Request) (*models.Dataset, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid dataset ID"})
+		return nil, false
+	}
+
+	dataset, err := h.repoFor(r).GetDataset(uint(id))
+	if err != nil {
+		writeError(w, r, err, "Dataset not found")
+		return nil, false
+	}
+	return dataset, true
+}
@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/epstein-files/backend/internal/config"
+
+	"github.com/epstein-files/backend/internal/export"
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/report"
+	"github.com/epstein-files/backend/internal/repository"
+)
+
+// ============================================================================
+// EXPORTS
+// ============================================================================
+
+// ExportDocumentsParquet streams all document metadata as a Parquet file
+// GET /api/export/documents.parquet
+func (h *Handlers) ExportDocumentsParquet(w http.ResponseWriter, r *http.Request) {
+	startParquetDownload(w, "documents.parquet")
+	if err := export.WriteDocuments(w, h.repoFor(r).EachDocumentBatch); err != nil {
+		// Headers are already sent; all we can do is cut the stream short
+		log.Printf("documents.parquet export failed: %v", err)
+	}
+}
+
+// ExportImagesParquet streams all image metadata as a Parquet file
+// GET /api/export/images.parquet
+func (h *Handlers) ExportImagesParquet(w http.ResponseWriter, r *http.Request) {
+	startParquetDownload(w, "images.parquet")
+	if err := export.WriteImages(w, h.repoFor(r).EachImageBatch); err != nil {
+		log.Printf("images.parquet export failed: %v", err)
+	}
+}
+
+func startParquetDownload(w http.ResponseWriter, filename string) {
+	w.Header().Set("Content-Type", "application/vnd.apache.parquet")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+// ExportSnapshot downloads the latest SQLite analytics snapshot
+// GET /api/export/snapshot.db
+func (h *Handlers) ExportSnapshot(w http.ResponseWriter, r *http.Request) {
+	path := h.cfg.SnapshotPath()
+	if _, err := os.Stat(path); err != nil {
+		writeJSON(w, http.StatusNotFound, H{"error": "Snapshot not available yet"})
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="snapshot.db"`)
+	http.ServeFile(w, r, path)
+}
+
+// Content types of the transparency report formats
+var reportContentTypes = map[string]string{
+	"pdf": "application/pdf",
+	"md":  "text/markdown; charset=utf-8",
+}
+
+// ExportStatsReport downloads the latest transparency report. Until the
+// first one has been generated it queues the job and answers 202.
+// GET /api/export/stats-report?format=pdf|md
+func (h *Handlers) ExportStatsReport(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "pdf"
+	}
+	if !slices.Contains(report.Formats, format) {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid format, expected pdf or md"})
+		return
+	}
+
+	f, err := os.Open(h.cfg.StatsReportPath(format))
+	if err != nil {
+		job, err := h.queueStatsReport(r)
+		if err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+		w.Header().Set("Retry-After", "60")
+		writeJSON(w, http.StatusAccepted, H{"status": "generating", "job": job})
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	w.Header().Set("Content-Type", reportContentTypes[format])
+	w.Header().Set("Content-Disposition", `attachment; filename="stats-report-`+info.ModTime().UTC().Format("2006-01-02")+"."+format+`"`)
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
+
+// queueStatsReport returns the report job already queued or running, or
+// queues one
+func (h *Handlers) queueStatsReport(r *http.Request) (*models.Job, error) {
+	last, err := h.repoFor(r).LastJob(report.JobType)
+	if err != nil {
+		return nil, err
+	}
+	if last != nil && (last.Status == models.JobQueued || last.Status == models.JobRunning) {
+		return last, nil
+	}
+	return h.jobs.Enqueue(r.Context(), report.JobType, nil)
+}
+
+// CreateExportDownload queues a background export and returns the download
+// token it can be fetched with once built. An export of the same kind
+// already built or queued since the last ingest is shared instead, so
+// repeated requests don't each build a copy.
+// POST /api/exports?kind=documents.parquet|images.parquet
+func (h *Handlers) CreateExportDownload(w http.ResponseWriter, r *http.Request) {
+	kind := r.URL.Query().Get("kind")
+	if !export.ValidDownloadKind(kind) {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid kind, expected " + strings.Join(export.DownloadKinds, " or ")})
+		return
+	}
+	key, err := export.LoadTokenKey(h.cfg.ExportTokenSecret, h.cfg.ExportTokenKeyPath())
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	repo := h.repoFor(r)
+	version, err := repo.IngestVersion()
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	now := time.Now()
+	d := &models.ExportDownload{Kind: kind, IngestVersion: version, ExpiresAt: now.Add(h.cfg.ExportTokenTTL()).UTC().Truncate(time.Second)}
+	shared, err := repo.GetReusableExportDownload(kind, version, now)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	var job *models.Job
+	if shared != nil {
+		d.JobID, d.Path, d.SizeBytes, d.SHA256 = shared.JobID, shared.Path, shared.SizeBytes, shared.SHA256
+		if err := repo.CreateExportDownload(d); err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+		if job, err = repo.GetJob(d.JobID); err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+	} else {
+		// The row comes first so the job finds it however soon it runs
+		if err := repo.CreateExportDownload(d); err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+		if job, err = h.jobs.Enqueue(r.Context(), export.DownloadJobType, models.JSON{"download_id": d.ID}); err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+		d.JobID = job.ID
+		if err := repo.SaveExportDownload(d); err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+	}
+
+	token := export.SignToken(key, h.cfg.ArchiveID, d.ID, d.ExpiresAt)
+	writeJSON(w, http.StatusAccepted, H{
+		"token":      token,
+		"url":        baseURL(r) + "/api/exports/" + token,
+		"kind":       kind,
+		"expires_at": d.ExpiresAt,
+		"job":        job,
+	})
+}
+
+// GetExportDownload serves an export download by its token, with Range
+// support so an interrupted transfer can be resumed. While the export is
+// still being built it answers 202. The token is used up once a response
+// has delivered the file's last byte; after that, or once it has expired,
+// it answers 410.
+// GET /api/exports/{token}
+func (h *Handlers) GetExportDownload(w http.ResponseWriter, r *http.Request) {
+	key, err := export.LoadTokenKey(h.cfg.ExportTokenSecret, h.cfg.ExportTokenKeyPath())
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	id, expires, err := export.ParseToken(key, h.cfg.ArchiveID, r.PathValue("token"))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, H{"error": "Unknown download token"})
+		return
+	}
+	if time.Now().After(expires) {
+		writeJSON(w, http.StatusGone, H{"error": "Download token expired"})
+		return
+	}
+
+	repo := h.repoFor(r)
+	d, err := repo.GetExportDownload(id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeJSON(w, http.StatusGone, H{"error": "Download no longer available"})
+		return
+	}
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	if d.ConsumedAt != nil {
+		writeJSON(w, http.StatusGone, H{"error": "Download token already used"})
+		return
+	}
+
+	if d.Path == "" {
+		job, err := repo.GetJob(d.JobID)
+		if err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+		if job.Status == models.JobFailed || job.Status == models.JobCancelled {
+			writeJSON(w, http.StatusInternalServerError, H{"error": "Export " + job.Status, "job": job})
+			return
+		}
+		w.Header().Set("Retry-After", "10")
+		writeJSON(w, http.StatusAccepted, H{"status": "building", "job": job})
+		return
+	}
+
+	f, err := os.Open(d.Path)
+	if err != nil {
+		writeJSON(w, http.StatusGone, H{"error": "Download no longer available"})
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.apache.parquet")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+d.Kind+`"`)
+	w.Header().Set("ETag", `"`+d.SHA256+`"`)
+	dw := &deliveryWriter{ResponseWriter: w, status: http.StatusOK}
+	http.ServeContent(dw, r, "", info.ModTime(), f)
+
+	if r.Method != http.MethodHead && dw.deliveredEnd(info.Size()) {
+		if err := repo.ConsumeExportDownload(d.ID, time.Now().UTC()); err != nil {
+			log.Printf("Export download %d: %v", d.ID, err)
+		}
+	}
+}
+
+// deliveryWriter counts the body bytes written, to tell whether a response
+// delivered the end of the file
+type deliveryWriter struct {
+	http.ResponseWriter
+	status int
+	n      int64
+}
+
+func (w *deliveryWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *deliveryWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.n += int64(n)
+	return n, err
+}
+
+// deliveredEnd reports whether the whole response went out and reached the
+// last byte of a file of size bytes
+func (w *deliveryWriter) deliveredEnd(size int64) bool {
+	switch w.status {
+	case http.StatusOK:
+		return w.n == size
+	case http.StatusPartialContent:
+		// Single ranges only; multipart responses never count
+		var from, to, total int64
+		if _, err := fmt.Sscanf(w.Header().Get("Content-Range"), "bytes %d-%d/%d", &from, &to, &total); err != nil {
+			return false
+		}
+		return total == size && to == size-1 && w.n == to-from+1
+	}
+	return false
+}
+
+// GetManifest returns the signed file manifest, rebuilt when the archive changes
+// GET /api/export/manifest
+func (h *Handlers) GetManifest(w http.ResponseWriter, r *http.Request) {
+	manifest, err := h.manifest.get(h.repoFor(r), h.cfg)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	writeJSON(w, http.StatusOK, manifest)
+}
+
+// manifestCache holds the last manifest until the next ingest
+type manifestCache struct {
+	mu       sync.Mutex
+	version  string
+	manifest *export.Manifest
+	stats    cacheCounter
+}
+
+func (mc *manifestCache) get(repo *repository.Repository, cfg *config.Config) (*export.Manifest, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	version, err := repo.IngestVersion()
+	if err != nil {
+		return nil, err
+	}
+	if mc.manifest != nil && version == mc.version {
+		mc.stats.hit()
+		return mc.manifest, nil
+	}
+	mc.stats.miss()
+
+	documents, err := repo.GetManifestDocuments()
+	if err != nil {
+		return nil, err
+	}
+	images, err := repo.GetManifestImages()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := export.BuildManifest(cfg.ArchiveID, documents, images)
+	if cfg.ManifestSigningKey != "" {
+		key, err := export.ParseSigningKey(cfg.ManifestSigningKey)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Sign(key)
+	}
+
+	mc.version = version
+	mc.manifest = manifest
+	return manifest, nil
+}
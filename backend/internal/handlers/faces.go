@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/epstein-files/backend/internal/models"
+)
+
+// GetFaceClusters lists anonymous face clusters, largest first
+// GET /api/faces/clusters?cursor=xxx&limit=50&min_faces=2
+func (h *Handlers) GetFaceClusters(w http.ResponseWriter, r *http.Request) {
+	cursor := r.URL.Query().Get("cursor")
+	limit := getIntParam(r, "limit", 50)
+	if limit > 100 {
+		limit = 100
+	}
+	minFaces := getIntParam(r, "min_faces", 2)
+
+	result, err := h.repoFor(r).GetFaceClusters(cursor, limit, minFaces)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	paginate(r, result, limit)
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// GetFaceCluster returns one face cluster
+// GET /api/faces/clusters/{id}
+func (h *Handlers) GetFaceCluster(w http.ResponseWriter, r *http.Request) {
+	cluster, ok := h.faceCluster(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, cluster)
+}
+
+// GetFaceClusterImages lists the images containing a face in the cluster,
+// each with the bounding boxes of its faces in that cluster. Takes the same
+// filters as GetImages.
+// GET /api/faces/clusters/{id}/images?cursor=xxx&limit=50
+func (h *Handlers) GetFaceClusterImages(w http.ResponseWriter, r *http.Request) {
+	cluster, ok := h.faceCluster(w, r)
+	if !ok {
+		return
+	}
+
+	cursor := r.URL.Query().Get("cursor")
+	limit := getIntParam(r, "limit", 50)
+	if limit > 100 {
+		limit = 100
+	}
+
+	filters, err := h.imageFilters(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, H{"error": err.Error()})
+		return
+	}
+	filters.FaceCluster = cluster.ID
+
+	repo := h.repoFor(r)
+	result, err := repo.GetImages(cursor, limit, filters)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	images := result.Data.([]models.Image)
+	if err := repo.AttachClusterFaces(cluster.ID, images); err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	if h.safeMode(r) {
+		result.Data = h.applySafeMode(r, images)
+	}
+	paginate(r, result, limit)
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// faceCluster loads the cluster named in the path, writing the error
+// response itself when it cannot
+func (h *Handlers) faceCluster(w http.ResponseWriter, r *http.Request) (*models.FaceCluster, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid cluster ID"})
+		return nil, false
+	}
+
+	cluster, err := h.repoFor(r).GetFaceCluster(uint(id))
+	if err != nil {
+		writeError(w, r, err, "Face cluster not found")
+		return nil, false
+	}
+	return cluster, true
+}
@@ -1,19 +1,119 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
 	"net/http"
+	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/epstein-files/backend/internal/auth"
+	"github.com/epstein-files/backend/internal/config"
+	"github.com/epstein-files/backend/internal/contrib"
+	"github.com/epstein-files/backend/internal/database"
+	"github.com/epstein-files/backend/internal/features"
+	"github.com/epstein-files/backend/internal/imaging"
+	"github.com/epstein-files/backend/internal/jobs"
+	"github.com/epstein-files/backend/internal/middleware"
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/passages"
+	"github.com/epstein-files/backend/internal/quota"
 	"github.com/epstein-files/backend/internal/repository"
-	"github.com/gin-gonic/gin"
+	"github.com/epstein-files/backend/internal/storage"
+	"github.com/epstein-files/backend/internal/telemetry"
+	"github.com/epstein-files/backend/internal/usage"
+	"github.com/epstein-files/backend/internal/verify"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 type Handlers struct {
-	repo *repository.Repository
+	repo     *repository.Repository
+	cfg      *config.Config
+	client   *http.Client
+	jobs     *jobs.Queue
+	files    storage.Store  // archive files, as configured by STORAGE_BACKEND
+	uploads  storage.Writer // contributor uploads and approved PDFs
+	scanner  *contrib.Scanner
+	manifest manifestCache
+	search   *searchCache
+	corpus   corpusVersions
+	requests *middleware.RequestCounter
+	breakers *middleware.Breakers
+	replica  *database.Replica // nil unless READ_REPLICA is set
+	features *features.Set
+	quotas   *quota.Limiter
+	sso      *auth.Service    // nil unless AUTH_CONFIG is set
+	usage    *usage.Collector // nil unless USAGE_STATS is on
+	passages *passages.Index  // nil unless EMBEDDINGS_API_URL is set
 }
 
-func New(repo *repository.Repository) *Handlers {
-	return &Handlers{repo: repo}
+func New(repo *repository.Repository, cfg *config.Config, queue *jobs.Queue, files storage.Store, uploads storage.Writer, requests *middleware.RequestCounter, breakers *middleware.Breakers, replica *database.Replica, flags *features.Set, quotas *quota.Limiter, sso *auth.Service, stats *usage.Collector) *Handlers {
+	return &Handlers{
+		repo:     repo,
+		cfg:      cfg,
+		jobs:     queue,
+		files:    files,
+		uploads:  uploads,
+		requests: requests,
+		breakers: breakers,
+		replica:  replica,
+		features: flags,
+		quotas:   quotas,
+		sso:      sso,
+		usage:    stats,
+		search: newSearchCache(
+			time.Duration(cfg.SearchCacheTTLSeconds)*time.Second,
+			time.Duration(cfg.SearchCacheStaleSeconds)*time.Second,
+			cfg.SearchCacheSize,
+		),
+		scanner:  contrib.NewScanner(cfg.ContribScanCommand),
+		passages: passages.NewIndex(passages.NewEmbedder(cfg.EmbeddingsAPIURL, cfg.EmbeddingsAPIKey, cfg.EmbeddingsModel)),
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+	}
+}
+
+// repoFor binds the repository to the request so queries are cancelled with
+// it and traced under its span
+func (h *Handlers) repoFor(r *http.Request) *repository.Repository {
+	return h.repoIn(r.Context())
+}
+
+// repoIn binds the repository to ctx. Routes wrapped in ReadFromReplica
+// read from the replica when there is one.
+func (h *Handlers) repoIn(ctx context.Context) *repository.Repository {
+	if h.replica != nil && ctx.Value(replicaKey{}) != nil {
+		return h.replica.Repository().WithContext(ctx)
+	}
+	return h.repo.WithContext(ctx)
+}
+
+type replicaKey struct{}
+
+// ReadFromReplica marks a route as read-only and tolerant of data as old as
+// the replica's last refresh
+func (h *Handlers) ReadFromReplica(next http.Handler) http.Handler {
+	if h.replica == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), replicaKey{}, true)))
+	})
 }
 
 // ============================================================================
@@ -21,118 +121,751 @@ func New(repo *repository.Repository) *Handlers {
 // ============================================================================
 
 // GetImages returns paginated images with optional filters
-// GET /api/images?cursor=xxx&limit=50&has_gps=true&has_date=true&has_text=true&document_id=xxx
-func (h *Handlers) GetImages(c *gin.Context) {
-	cursor := c.Query("cursor")
-	limit := getIntParam(c, "limit", 50)
+// GET /api/images?cursor=xxx&limit=50&has_gps=true&has_date=true&has_text=true&document_id=xxx&q=whiteboard&min_quality=0.5&sort=quality&include_blank=true&color=true&min_megapixels=2&size_class=large&orientation=portrait&format=jpeg&size_bucket=small&tag=beach,boat&min_tag_confidence=0.5
+func (h *Handlers) GetImages(w http.ResponseWriter, r *http.Request) {
+	cursor := r.URL.Query().Get("cursor")
+	limit := getIntParam(r, "limit", 50)
 	if limit > 100 {
 		limit = 100
 	}
 
+	filters, err := h.imageFilters(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.repoFor(r).GetImages(cursor, limit, filters)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	if h.safeMode(r) {
+		result.Data = h.applySafeMode(r, result.Data.([]models.Image))
+	}
+	paginate(r, result, limit)
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// GetImageFacets counts the images matching the same filters as GetImages
+// by color, size class and tag
+// GET /api/images/facets?has_gps=true&min_quality=0.5
+func (h *Handlers) GetImageFacets(w http.ResponseWriter, r *http.Request) {
+	filters, err := h.imageFilters(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, H{"error": err.Error()})
+		return
+	}
+
+	facets, err := h.repoFor(r).GetImageFacets(filters)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, facets)
+}
+
+// imageFilters reads the image list filters from the query string
+func (h *Handlers) imageFilters(r *http.Request) (repository.ImageFilters, error) {
 	filters := repository.ImageFilters{
-		DocumentID: c.Query("document_id"),
+		DocumentID:   r.URL.Query().Get("document_id"),
+		SearchQuery:  r.URL.Query().Get("q"),
+		Sort:         r.URL.Query().Get("sort"),
+		IncludeBlank: r.URL.Query().Get("include_blank") == "true",
+	}
+	if h.safeMode(r) && h.cfg.SafeModeAction == "omit" {
+		filters.ExcludeFlagged = true
 	}
 
-	if hasGPS := c.Query("has_gps"); hasGPS == "true" {
+	if hasGPS := r.URL.Query().Get("has_gps"); hasGPS == "true" {
 		val := true
 		filters.HasGPS = &val
 	}
-	if hasDate := c.Query("has_date"); hasDate == "true" {
+	if hasDate := r.URL.Query().Get("has_date"); hasDate == "true" {
 		val := true
 		filters.HasDate = &val
 	}
-	if hasText := c.Query("has_text"); hasText == "true" {
+	if hasText := r.URL.Query().Get("has_text"); hasText == "true" {
 		val := true
 		filters.HasText = &val
 	}
+	if minQuality := r.URL.Query().Get("min_quality"); minQuality != "" {
+		val, err := strconv.ParseFloat(minQuality, 64)
+		if err != nil {
+			return filters, errors.New("Invalid min_quality")
+		}
+		filters.MinQuality = &val
+	}
+	if color := r.URL.Query().Get("color"); color != "" {
+		val, err := strconv.ParseBool(color)
+		if err != nil {
+			return filters, errors.New("Invalid color, expected true or false")
+		}
+		filters.Color = &val
+	}
+	if minMP := r.URL.Query().Get("min_megapixels"); minMP != "" {
+		val, err := strconv.ParseFloat(minMP, 64)
+		if err != nil {
+			return filters, errors.New("Invalid min_megapixels")
+		}
+		filters.MinMegapixels = &val
+	}
+	if sizeClass := r.URL.Query().Get("size_class"); sizeClass != "" {
+		if !models.ValidSizeClass(sizeClass) {
+			return filters, errors.New("Invalid size_class")
+		}
+		filters.SizeClass = sizeClass
+	}
+	if orientation := r.URL.Query().Get("orientation"); orientation != "" {
+		if !models.ValidOrientation(orientation) {
+			return filters, errors.New("Invalid orientation, expected portrait, landscape or square")
+		}
+		filters.Orientation = orientation
+	}
+	if format := r.URL.Query().Get("format"); format != "" {
+		val, ok := models.ImageFormat(format)
+		if !ok {
+			return filters, errors.New("Invalid format, expected jpeg, png or tiff")
+		}
+		filters.Format = val
+	}
+	if sizeBucket := r.URL.Query().Get("size_bucket"); sizeBucket != "" {
+		if _, _, ok := models.SizeBucketRange(sizeBucket); !ok {
+			return filters, errors.New("Invalid size_bucket, expected small, medium or large")
+		}
+		filters.SizeBucket = sizeBucket
+	}
+	if tags := r.URL.Query().Get("tag"); tags != "" {
+		for _, tag := range strings.Split(tags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				filters.Tags = append(filters.Tags, strings.ToLower(tag))
+			}
+		}
+	}
+	if minConf := r.URL.Query().Get("min_tag_confidence"); minConf != "" {
+		val, err := strconv.ParseFloat(minConf, 64)
+		if err != nil {
+			return filters, errors.New("Invalid min_tag_confidence")
+		}
+		filters.MinTagConfidence = val
+	}
+
+	return filters, nil
+}
+
+// GetImageByID returns a single image with full details
+// GET /api/images/{id}
+func (h *Handlers) GetImageByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid image ID"})
+		return
+	}
 
-	result, err := h.repo.GetImages(cursor, limit, filters)
+	image, err := h.repoFor(r).GetImageByID(uint(id))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(w, r, err, "Image not found")
 		return
 	}
+	if h.safeMode(r) && image.IsFlagged() {
+		h.blurImage(r, image)
+	}
+	images := []models.Image{*image}
+	if err := h.setImageBlobURLs(r, images); err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	image.BlobURL = images[0].BlobURL
 
-	c.JSON(http.StatusOK, result)
+	writeJSON(w, http.StatusOK, image)
 }
 
-// GetImageByID returns a single image with full details
-// GET /api/images/:id
-func (h *Handlers) GetImageByID(c *gin.Context) {
-	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+// RenderImage returns the image rotated/deskewed upright, optionally resized
+// GET /api/images/{id}/render?size=512&blur=true
+func (h *Handlers) RenderImage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid image ID"})
+		return
+	}
+
+	img, err := h.repoFor(r).GetImageByID(uint(id))
+	if err != nil {
+		writeError(w, r, err, "Image not found")
+		return
+	}
+
+	src, err := h.fetchImage(r.Context(), img.CDNUrl)
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, H{"error": err.Error()})
+		return
+	}
+
+	_, span := telemetry.Start(r.Context(), "imaging.render")
+	out := imaging.Rotate(src, img.CorrectionAngle)
+	if size := getIntParam(r, "size", 0); size > 0 {
+		out = imaging.Fit(out, min(size, 2048))
+	}
+	if r.URL.Query().Get("blur") == "true" || (h.safeMode(r) && img.IsFlagged()) {
+		out = imaging.Blur(out, blurStrength)
+	}
+	span.End()
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.WriteHeader(http.StatusOK)
+	jpeg.Encode(w, out, &jpeg.Options{Quality: 85})
+}
+
+// GetImageRawExif returns the EXIF, XMP and IPTC blocks exactly as they are
+// in the stored file, with the hash of the bytes read and the reader that
+// split them out
+// GET /api/images/{id}/exif/raw
+func (h *Handlers) GetImageRawExif(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid image ID"})
+		return
+	}
+
+	img, err := h.repoFor(r).GetImageByID(uint(id))
+	if err != nil {
+		writeError(w, r, err, "Image not found")
+		return
+	}
+
+	rc, err := h.files.Open(r.Context(), storage.ImageKey(img.DocumentID, img.Filename))
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, H{"error": err.Error()})
+		return
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, H{"error": err.Error()})
+		return
+	}
+
+	metadata, err := imaging.ReadMetadata(data)
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, H{"error": err.Error()})
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	result := H{
+		"image_id":    img.ID,
+		"document_id": img.DocumentID,
+		"filename":    img.Filename,
+		"sha256":      hex.EncodeToString(sum[:]),
+		"size_bytes":  len(data),
+		"metadata":    metadata,
+		"reader":      imaging.MetadataReader(),
+	}
+	// Lets analysts confirm the blocks came from the file that was ingested
+	if img.SHA256 != "" {
+		result["sha256_matches"] = img.SHA256 == hex.EncodeToString(sum[:])
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// DownloadImage streams the original image file as an attachment, with
+// range requests, so clients need neither the CDN URL nor CDN CORS
+// GET /api/images/{id}/download
+func (h *Handlers) DownloadImage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid image ID"})
+		return
+	}
+
+	img, err := h.repoFor(r).GetImageByID(uint(id))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image ID"})
+		writeError(w, r, err, "Image not found")
+		return
+	}
+	if h.safeMode(r) && img.IsFlagged() {
+		writeJSON(w, http.StatusForbidden, H{"error": "Image is flagged as sensitive; request it with safe_mode=false"})
 		return
 	}
 
-	image, err := h.repo.GetImageByID(uint(id))
+	rc, err := h.files.Open(r.Context(), storage.ImageKey(img.DocumentID, img.Filename))
+	if errors.Is(err, storage.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, H{"error": "File not in storage"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		writeJSON(w, http.StatusBadGateway, H{"error": err.Error()})
 		return
 	}
+	defer rc.Close()
 
-	c.JSON(http.StatusOK, image)
+	// Local files seek; CDN bodies don't, so those are read whole (images
+	// are small) to answer ranges
+	content, ok := rc.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			writeJSON(w, http.StatusBadGateway, H{"error": err.Error()})
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+
+	if ct := mime.TypeByExtension(filepath.Ext(img.Filename)); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": img.DocumentID + "_" + img.Filename,
+	}))
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	if img.SHA256 != "" {
+		w.Header().Set("ETag", `"`+img.SHA256+`"`)
+	}
+	http.ServeContent(w, r, img.Filename, img.CreatedAt, content)
 }
 
 // ============================================================================
 // DOCUMENTS
 // ============================================================================
 
-// GetDocuments returns paginated documents
-// GET /api/documents?cursor=xxx&limit=50
-func (h *Handlers) GetDocuments(c *gin.Context) {
-	cursor := c.Query("cursor")
-	limit := getIntParam(c, "limit", 50)
+// Longest filename_like / filename_regex accepted
+const maxFilenamePatternLen = 128
+
+// GetDocuments returns paginated documents, optionally matched by filename or
+// cut down to those with enough text
+// GET /api/documents?cursor=xxx&limit=50&filename_like=EFTA0012*&filename_regex=^EFTA0012[0-9]{4}\.pdf$&min_words=50
+func (h *Handlers) GetDocuments(w http.ResponseWriter, r *http.Request) {
+	cursor := r.URL.Query().Get("cursor")
+	limit := getIntParam(r, "limit", 50)
 	if limit > 100 {
 		limit = 100
 	}
 
-	result, err := h.repo.GetDocuments(cursor, limit)
+	var filters repository.DocumentFilters
+	if like := r.URL.Query().Get("filename_like"); like != "" {
+		if len(like) > maxFilenamePatternLen {
+			writeJSON(w, http.StatusBadRequest, H{"error": "filename_like is too long"})
+			return
+		}
+		filters.FilenameLike = like
+	}
+	if expr := r.URL.Query().Get("filename_regex"); expr != "" {
+		if len(expr) > maxFilenamePatternLen {
+			writeJSON(w, http.StatusBadRequest, H{"error": "filename_regex is too long"})
+			return
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, H{"error": "Invalid filename_regex"})
+			return
+		}
+		filters.FilenameRegex = re
+	}
+	if minWords := r.URL.Query().Get("min_words"); minWords != "" {
+		val, err := strconv.Atoi(minWords)
+		if err != nil || val < 0 {
+			writeJSON(w, http.StatusBadRequest, H{"error": "Invalid min_words"})
+			return
+		}
+		filters.MinWords = val
+	}
+
+	result, err := h.repoFor(r).GetDocuments(cursor, limit, filters)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(w, r, err, "")
 		return
 	}
+	paginate(r, result, limit)
 
-	c.JSON(http.StatusOK, result)
+	writeJSON(w, http.StatusOK, result)
+}
+
+// Most EFTA numbers one range request may span
+const maxDocumentRange = 1000
+
+// GetDocumentRange lists a contiguous EFTA range, marking missing numbers
+// GET /api/documents/range?from=EFTA00010000&to=EFTA00010500
+func (h *Handlers) GetDocumentRange(w http.ResponseWriter, r *http.Request) {
+	from, ok := models.ParseEFTA(r.URL.Query().Get("from"))
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid from, expected an EFTA number such as EFTA00010000"})
+		return
+	}
+	to, ok := models.ParseEFTA(r.URL.Query().Get("to"))
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid to, expected an EFTA number such as EFTA00010500"})
+		return
+	}
+	if to < from {
+		writeJSON(w, http.StatusBadRequest, H{"error": "to must not be before from"})
+		return
+	}
+	if to-from+1 > maxDocumentRange {
+		writeJSON(w, http.StatusBadRequest, H{"error": fmt.Sprintf("Range too large, at most %d numbers", maxDocumentRange)})
+		return
+	}
+
+	result, err := h.repoFor(r).GetDocumentRange(from, to)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
 }
 
 // GetDocumentByID returns a single document with all its images
-// GET /api/documents/:id
-func (h *Handlers) GetDocumentByID(c *gin.Context) {
-	id := c.Param("id")
+// GET /api/documents/{id}
+func (h *Handlers) GetDocumentByID(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid document ID"})
+		return
+	}
+
+	document, err := h.repoFor(r).GetDocumentByID(id)
+	if err != nil {
+		writeError(w, r, err, "Document not found")
+		return
+	}
+	if h.safeMode(r) {
+		document.Images = h.applySafeMode(r, document.Images)
+	}
+	if h.tiering() {
+		ft, err := h.repoFor(r).GetFileTier(id)
+		if err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+		document.StorageTier = ft.Tier
+		if document.StorageTier == "" {
+			document.StorageTier = tierHot
+		}
+	}
+	if err := h.setBlobURLs(r, document); err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, document)
+}
+
+// GetDocumentTables returns the tables extracted from a document as CSV
+// GET /api/documents/{id}/tables
+func (h *Handlers) GetDocumentTables(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid document ID"})
+		return
+	}
+
+	tables, err := h.repoFor(r).GetDocumentTables(id)
+	if err != nil {
+		writeError(w, r, err, "Document not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, H{
+		"document_id": id,
+		"tables":      tables,
+	})
+}
+
+// GetDocumentSprite returns page thumbnail sprite sheets and tile coordinates
+// GET /api/documents/{id}/sprite
+func (h *Handlers) GetDocumentSprite(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid document ID"})
+		return
+	}
+
+	sprite, err := h.repoFor(r).GetDocumentSprite(id)
+	if err != nil {
+		writeError(w, r, err, "Sprite not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sprite)
+}
+
+// GetDocumentCluster returns the near-duplicates of a document (the same text
+// from other scans or OCR runs); cluster is null when it has none
+// GET /api/documents/{id}/cluster
+func (h *Handlers) GetDocumentCluster(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid document ID"})
+		return
+	}
+
+	repo := h.repoFor(r)
+	exists, err := repo.DocumentExists(id)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	if !exists {
+		writeJSON(w, http.StatusNotFound, H{"error": "Document not found"})
+		return
+	}
+
+	cluster, err := repo.GetDocumentCluster(id)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, H{"document_id": id, "cluster": cluster})
+}
+
+// GetDocumentVersions returns earlier states of a document recorded under
+// legal hold: previous metadata rows and stored revisions of its PDF
+// GET /api/documents/{id}/versions
+func (h *Handlers) GetDocumentVersions(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid document ID"})
+		return
+	}
+
+	document, err := h.repoFor(r).GetDocumentByID(id)
+	if err != nil {
+		writeError(w, r, err, "Document not found")
+		return
+	}
+
+	rows, err := h.repoFor(r).GetRowVersions("documents", id)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	files := []storage.Version{}
+	if hold, ok := h.uploads.(*storage.Hold); ok {
+		if files, err = hold.Versions(r.Context(), storage.DocumentKey(document.Filename)); err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, H{
+		"document_id": id,
+		"legal_hold":  h.cfg.LegalHold,
+		"versions":    rows,
+		"files":       files,
+	})
+}
+
+// VerifyDocument re-hashes the stored PDF and compares it with the SHA-256
+// recorded at ingest
+// GET /api/documents/{id}/verify
+func (h *Handlers) VerifyDocument(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid document ID"})
+		return
+	}
+
+	document, err := h.repoFor(r).GetDocumentByID(id)
+	if err != nil {
+		writeError(w, r, err, "Document not found")
+		return
+	}
+
+	res := verify.File(r.Context(), h.files, storage.DocumentKey(document.Filename), document.SHA256, document.SizeBytes)
+	writeJSON(w, http.StatusOK, H{
+		"document_id": id,
+		"ok":          res.OK(),
+		"result":      res,
+	})
+}
+
+// GetDocumentPages returns a document's pages with reading-order text
+// GET /api/documents/{id}/pages?cursor=xxx&limit=50
+func (h *Handlers) GetDocumentPages(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid document ID"})
+		return
+	}
+
+	cursor := r.URL.Query().Get("cursor")
+	limit := getIntParam(r, "limit", 50)
+	if limit > 100 {
+		limit = 100
+	}
+
+	result, err := h.repoFor(r).GetDocumentPages(id, cursor, limit)
+	if err != nil {
+		writeError(w, r, err, "Document not found")
+		return
+	}
+	paginate(r, result, limit)
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// GetDocumentImages returns a document's images in page order, each with the
+// IDs of the images before and after it, to drive a page-by-page viewer.
+// Blank pages are skipped unless include_blank=true.
+// GET /api/documents/{id}/images?cursor=xxx&limit=50&include_blank=true
+func (h *Handlers) GetDocumentImages(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid document ID"})
+		return
+	}
+
+	cursor := r.URL.Query().Get("cursor")
+	limit := getIntParam(r, "limit", 50)
+	if limit > 100 {
+		limit = 100
+	}
+
+	filters := repository.ImageFilters{
+		IncludeBlank:   r.URL.Query().Get("include_blank") == "true",
+		ExcludeFlagged: h.safeMode(r) && h.cfg.SafeModeAction == "omit",
+	}
+
+	result, err := h.repoFor(r).GetDocumentImages(id, cursor, limit, filters)
+	if err != nil {
+		writeError(w, r, err, "Document not found")
+		return
+	}
+	if h.safeMode(r) {
+		// Omitted images are already filtered out, so neighbours skip them too
+		images := result.Data.([]models.DocumentImage)
+		for i := range images {
+			if images[i].IsFlagged() {
+				h.blurImage(r, &images[i].Image)
+			}
+		}
+	}
+	paginate(r, result, limit)
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// GetDocumentText returns a document's full text as plain text
+// GET /api/documents/{id}/text
+func (h *Handlers) GetDocumentText(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
 	if id == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid document ID"})
 		return
 	}
 
-	document, err := h.repo.GetDocumentByID(id)
+	text, err := h.repoFor(r).GetDocumentText(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		writeError(w, r, err, "Document not found")
 		return
 	}
 
-	c.JSON(http.StatusOK, document)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !text.UpdatedAt.IsZero() {
+		w.Header().Set("Last-Modified", text.UpdatedAt.UTC().Format(http.TimeFormat))
+	}
+	io.WriteString(w, text.Text)
 }
 
 // ============================================================================
 // SEARCH
 // ============================================================================
 
-// Search performs full-text search
-// GET /api/search?q=search+query&limit=50
-func (h *Handlers) Search(c *gin.Context) {
-	query := c.Query("q")
-	limit := getIntParam(c, "limit", 50)
-	if limit > 100 {
-		limit = 100
+// Matching images returned per search result unless expand=true
+const searchImagesPerDocument = 3
+
+// Search performs full-text search; repeated searches are answered from the
+// search cache (X-Cache: HIT, STALE or MISS). The ETag changes with the
+// corpus, so a poll with If-None-Match gets a 304 until new files are
+// ingested; with wait it is held until then (LongPollSearch).
+// GET /api/search?q=search+query&limit=50&collapse_duplicates=true&rank=relevance&expand=true&demote_ocr=true&wait=30
+func (h *Handlers) Search(w http.ResponseWriter, r *http.Request) {
+	query, key, opts, err := h.searchRequest(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, H{"error": err.Error()})
+		return
 	}
 
-	result, err := h.repo.Search(query, limit)
+	version, err := h.corpus.get(h.repoFor(r), h.readsReplica(r))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(w, r, err, "")
+		return
+	}
+	etag := searchETag(version, key, query, h.safeMode(r))
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	c.JSON(http.StatusOK, result)
+	// Results cached before an ingest aren't served after it
+	cached, status, err := h.search.get(r.Context(), version+"\x00"+key, func(ctx context.Context) (*models.SearchResult, error) {
+		return h.repoIn(ctx).Search(query, opts)
+	})
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	// The cached result is shared; safe mode rewrites images in place
+	result := *cached
+	result.Query = query
+	if h.safeMode(r) {
+		result.Documents = append([]models.Document(nil), cached.Documents...)
+		for i := range result.Documents {
+			result.Documents[i].Images = h.applySafeMode(r, append([]models.Image(nil), cached.Documents[i].Images...))
+		}
+	}
+
+	w.Header().Set("X-Cache", status)
+	writeJSON(w, http.StatusOK, result)
+}
+
+// searchRequest reads a search's parameters, and the search cache key of
+// its results
+func (h *Handlers) searchRequest(r *http.Request) (query, key string, opts repository.SearchOptions, err error) {
+	query = r.URL.Query().Get("q")
+	limit := getIntParam(r, "limit", 50)
+	if limit > 100 {
+		limit = 100
+	}
+
+	rank := r.URL.Query().Get("rank")
+	if rank == "" {
+		rank = h.cfg.SearchDefaultRank
+	}
+	if !repository.ValidRank(rank) {
+		return "", "", opts, errors.New("Invalid rank. Use relevance, date or efta")
+	}
+
+	opts = repository.SearchOptions{
+		Limit:              limit,
+		Rank:               rank,
+		FilenameWeight:     h.cfg.SearchFilenameWeight,
+		TextWeight:         h.cfg.SearchTextWeight,
+		DatasetBoosts:      h.cfg.SearchDatasetBoosts,
+		Stopwords:          h.cfg.FTSStopwords,
+		CollapseDuplicates: r.URL.Query().Get("collapse_duplicates") == "true",
+		ImagesPerDocument:  searchImagesPerDocument,
+	}
+	if r.URL.Query().Get("expand") == "true" {
+		opts.ImagesPerDocument = 0
+	}
+	if r.URL.Query().Get("demote_ocr") == "true" {
+		opts.OCRDemotion = h.cfg.SearchOCRDemotion
+		opts.OCRMinConfidence = h.cfg.SearchOCRMinConfidence
+	}
+
+	// Matching ignores case and spacing, so those searches share an entry
+	key = fmt.Sprintf("%s\x00%d\x00%s\x00%t\x00%d\x00%g",
+		strings.Join(strings.Fields(strings.ToLower(query)), " "), limit, rank, opts.CollapseDuplicates, opts.ImagesPerDocument, opts.OCRDemotion)
+	return query, key, opts, nil
 }
 
 // ============================================================================
@@ -141,41 +874,63 @@ func (h *Handlers) Search(c *gin.Context) {
 
 // GetStats returns archive statistics
 // GET /api/stats
-func (h *Handlers) GetStats(c *gin.Context) {
-	stats, err := h.repo.GetStats()
+func (h *Handlers) GetStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.repoFor(r).GetStats()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(w, r, err, "")
 		return
 	}
 
-	c.JSON(http.StatusOK, stats)
+	writeJSON(w, http.StatusOK, stats)
 }
 
-// ============================================================================
-// HEALTH
-// ============================================================================
+// GetGrowth returns documents, images and bytes added per interval
+// GET /api/stats/growth?interval=week
+func (h *Handlers) GetGrowth(w http.ResponseWriter, r *http.Request) {
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "week"
+	}
+	if !repository.ValidGrowthInterval(interval) {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid interval, expected day, week, month or year"})
+		return
+	}
 
-// Health check endpoint
-// GET /api/health
-func (h *Handlers) Health(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"status": "ok",
-		"service": "epstein-files-api",
-	})
+	buckets, err := h.repoFor(r).GetGrowth(interval)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, H{"interval": interval, "data": buckets})
 }
 
 // ============================================================================
 // HELPERS
 // ============================================================================
 
-func getIntParam(c *gin.Context, key string, defaultVal int) int {
-	val := c.Query(key)
-	if val == "" {
-		return defaultVal
+func (h *Handlers) fetchImage(ctx context.Context, url string) (image.Image, error) {
+	if url == "" {
+		return nil, fmt.Errorf("image has no CDN URL")
 	}
-	i, err := strconv.Atoi(val)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetch image: %w", err)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch image: CDN returned %d", resp.StatusCode)
+	}
+
+	img, _, err := image.Decode(resp.Body)
 	if err != nil {
-		return defaultVal
+		return nil, fmt.Errorf("decode image: %w", err)
 	}
-	return i
+	return img, nil
 }
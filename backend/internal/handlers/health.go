@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/epstein-files/backend/internal/buildinfo"
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/storage"
+)
+
+// ============================================================================
+// HEALTH
+// ============================================================================
+
+// healthTimeout bounds each component check, so a hung dependency shows as
+// failed instead of hanging the probe
+const healthTimeout = 2 * time.Second
+
+// healthCheck checks one component, returning its status and details
+type healthCheck func(ctx context.Context) (status string, detail any, err error)
+
+// Health checks the database, full-text index, file storage, search cache
+// and job queue, and reports the build. It answers 503 when the database is
+// down, so load balancers can take the instance out; a degraded archive
+// still serves with 200. The feature flags on for the caller are included
+// so frontends can detect what is available.
+// GET /api/health
+func (h *Handlers) Health(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]healthCheck{
+		"db":      h.checkDB,
+		"fts":     h.checkFTS,
+		"storage": h.checkStorage,
+		"cache":   h.checkCache,
+		"jobs":    h.checkJobs,
+	}
+
+	health := models.Health{
+		Status:     models.HealthOK,
+		Service:    "epstein-files-api",
+		Archive:    h.cfg.ArchiveID,
+		Build:      buildinfo.Get(),
+		CheckedAt:  time.Now().UTC(),
+		Components: make(map[string]models.HealthCheck, len(checks)),
+		Features:   h.features.For(r),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check healthCheck) {
+			defer wg.Done()
+			result := runHealthCheck(r.Context(), check)
+			mu.Lock()
+			health.Components[name] = result
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	for _, c := range health.Components {
+		if healthRank[c.Status] > healthRank[health.Status] {
+			health.Status = c.Status
+		}
+	}
+
+	status := http.StatusOK
+	if health.Status == models.HealthDown {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, health)
+}
+
+var healthRank = map[string]int{models.HealthOK: 0, models.HealthDegraded: 1, models.HealthDown: 2}
+
+func runHealthCheck(ctx context.Context, check healthCheck) models.HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+
+	start := time.Now()
+	status, detail, err := check(ctx)
+	result := models.HealthCheck{
+		Status:    status,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+		Detail:    detail,
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func (h *Handlers) checkDB(ctx context.Context) (string, any, error) {
+	if err := h.repo.WithContext(ctx).Ping(); err != nil {
+		return models.HealthDown, nil, err
+	}
+	return models.HealthOK, nil, nil
+}
+
+// checkFTS is degraded without an index or with one missing documents:
+// search then falls back to LIKE or misses results
+func (h *Handlers) checkFTS(ctx context.Context) (string, any, error) {
+	fts, err := h.repo.WithContext(ctx).GetFTSStatus(h.cfg.FTSOptions())
+	if err != nil {
+		return models.HealthDegraded, nil, err
+	}
+	detail := H{
+		"available":           fts.Available,
+		"in_sync":             fts.InSync,
+		"indexed_rows":        fts.IndexedRows,
+		"documents_with_text": fts.DocumentsWithText,
+	}
+	if !fts.Available || !fts.InSync {
+		return models.HealthDegraded, detail, nil
+	}
+	return models.HealthOK, detail, nil
+}
+
+// checkStorage is degraded when files can't be reached: metadata and search
+// still work, but PDFs and images don't
+func (h *Handlers) checkStorage(ctx context.Context) (string, any, error) {
+	detail := H{"backend": h.cfg.StorageBackend}
+	checker, ok := h.files.(storage.Checker)
+	if !ok {
+		return models.HealthOK, detail, nil
+	}
+	if err := checker.Check(ctx); err != nil {
+		return models.HealthDegraded, detail, err
+	}
+	return models.HealthOK, detail, nil
+}
+
+func (h *Handlers) checkCache(ctx context.Context) (string, any, error) {
+	if !h.search.enabled() {
+		return models.HealthOK, H{"enabled": false}, nil
+	}
+	return models.HealthOK, H{
+		"enabled": true,
+		"entries": h.search.len(),
+		"size":    h.search.size,
+		"search":  h.search.stats.stats(),
+	}, nil
+}
+
+// checkJobs is degraded when the worker has stopped looking for jobs. With
+// ROLE=api jobs run elsewhere, so it is degraded when no worker process has
+// checked in lately.
+func (h *Handlers) checkJobs(ctx context.Context) (string, any, error) {
+	repo := h.repo.WithContext(ctx)
+	queued, err := repo.CountJobs(models.JobQueued)
+	if err != nil {
+		return models.HealthDegraded, nil, err
+	}
+	running, err := repo.CountJobs(models.JobRunning)
+	if err != nil {
+		return models.HealthDegraded, nil, err
+	}
+	detail := H{"queued": queued, "running": running}
+
+	var alive bool
+	if h.cfg.RunsJobs() {
+		alive = h.jobs.Alive()
+	} else {
+		workers, err := h.jobs.Workers(ctx)
+		if err != nil {
+			return models.HealthDegraded, detail, err
+		}
+		ids := make([]string, len(workers))
+		for i, w := range workers {
+			ids[i] = w.ID
+		}
+		detail["workers"] = ids
+		alive = len(workers) > 0
+	}
+	detail["worker_alive"] = alive
+	if !alive {
+		return models.HealthDegraded, detail, nil
+	}
+	return models.HealthOK, detail, nil
+}
+
+// Version reports the build and schema versions, for ingesters and mirrors
+// to check they are compatible before writing
+// GET /api/version
+func (h *Handlers) Version(w http.ResponseWriter, r *http.Request) {
+	stored, err := h.repoFor(r).GetSchemaVersion()
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	writeJSON(w, http.StatusOK, models.Version{
+		Info:                  buildinfo.Get(),
+		SchemaVersion:         models.SchemaVersion,
+		DatabaseSchemaVersion: stored,
+	})
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/epstein-files/backend/internal/middleware"
+	"github.com/epstein-files/backend/internal/models"
+)
+
+// GetKeyUsage reports the authenticated API key's tier, its use of today's
+// and this month's quotas and its daily counts for the last days days. It is
+// not itself metered, so a key can check its usage once it's used up.
+// GET /api/keys/self/usage?days=30
+func (h *Handlers) GetKeyUsage(w http.ResponseWriter, r *http.Request) {
+	days := getIntParam(r, "days", 30)
+	if days < 1 {
+		days = 1
+	}
+	if days > 90 {
+		days = 90
+	}
+
+	key := middleware.Contributor(r.Context())
+	usage := h.quotas.Usage(key)
+
+	today := time.Now().UTC()
+	since := today.AddDate(0, 0, 1-days).Format("2006-01-02")
+	history, err := h.repoFor(r).GetAPIUsageHistory(key, since)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	// Today's stored count lags the live one until the next flush
+	if len(history) > 0 && history[0].Date == today.Format("2006-01-02") {
+		history = history[1:]
+	}
+	usage.History = append([]models.DailyUsage{{Date: today.Format("2006-01-02"), Count: usage.Daily.Used}}, history...)
+
+	writeJSON(w, http.StatusOK, usage)
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/epstein-files/backend/internal/passages"
+)
+
+// Most passages a passage search returns
+const maxPassages = 50
+
+// SearchPassages returns the page text chunks closest in meaning to q, each
+// with its document, page and character offsets into the page text, for
+// retrieval-augmented generation
+// GET /api/search/passages?q=flights+to+the+island&k=10
+func (h *Handlers) SearchPassages(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Query parameter 'q' is required"})
+		return
+	}
+	k := getIntParam(r, "k", 10)
+	if k < 1 || k > maxPassages {
+		writeJSON(w, http.StatusBadRequest, H{"error": "Invalid k, expected 1 to 50"})
+		return
+	}
+
+	result, err := h.passages.Search(r.Context(), h.repoFor(r), query, k)
+	if errors.Is(err, passages.ErrNoPassages) {
+		writeJSON(w, http.StatusNotFound, H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, H{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
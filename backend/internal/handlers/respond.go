@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/repository"
+)
+
+// H is a shorthand for ad-hoc JSON objects
+type H map[string]interface{}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers with the status for the kind of repository error err
+// is: 404 with notFound (or err's message when empty), 409 or 400 with err's
+// message. Anything else is logged and answered 500 without its details.
+func writeError(w http.ResponseWriter, r *http.Request, err error, notFound string) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		if notFound == "" {
+			notFound = err.Error()
+		}
+		writeJSON(w, http.StatusNotFound, H{"error": notFound})
+	case errors.Is(err, repository.ErrConflict):
+		writeJSON(w, http.StatusConflict, H{"error": err.Error()})
+	case errors.Is(err, repository.ErrInvalid):
+		writeJSON(w, http.StatusBadRequest, H{"error": err.Error()})
+	default:
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+		writeJSON(w, http.StatusInternalServerError, H{"error": "Internal server error"})
+	}
+}
+
+func getIntParam(r *http.Request, key string, defaultVal int) int {
+	val := r.URL.Query().Get(key)
+	if val == "" {
+		return defaultVal
+	}
+	i, err := strconv.Atoi(val)
+	if err != nil {
+		return defaultVal
+	}
+	return i
+}
+
+// paginate echoes a list page's limit and links it to its neighbours: the
+// request's URL with its query in canonical order and only the cursor changed
+func paginate(r *http.Request, result *models.PaginatedResponse, limit int) {
+	link := func(cursor string) string {
+		q := r.URL.Query()
+		q.Set("limit", strconv.Itoa(limit))
+		if cursor == "" {
+			q.Del("cursor")
+		} else {
+			q.Set("cursor", cursor)
+		}
+		return baseURL(r) + r.URL.Path + "?" + q.Encode()
+	}
+
+	result.Limit = limit
+	result.Links = &models.PageLinks{Self: link(r.URL.Query().Get("cursor"))}
+	if result.NextCursor != "" {
+		result.Links.Next = link(result.NextCursor)
+	}
+	if result.PrevCursor != "" {
+		result.Links.Prev = link(result.PrevCursor)
+	}
+}
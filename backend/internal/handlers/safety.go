@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/epstein-files/backend/internal/models"
+)
+
+// Side length of the intermediate thumbnail used to blur flagged images
+const blurStrength = 24
+
+// safeMode reports whether flagged images must be hidden for this request.
+// The deployment default applies unless the client sends safe_mode explicitly.
+func (h *Handlers) safeMode(r *http.Request) bool {
+	switch r.URL.Query().Get("safe_mode") {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return h.cfg.SafeModeDefault
+}
+
+// applySafeMode blurs or drops flagged images according to SAFE_MODE_ACTION
+func (h *Handlers) applySafeMode(r *http.Request, images []models.Image) []models.Image {
+	out := images[:0]
+	for i := range images {
+		if images[i].IsFlagged() {
+			if h.cfg.SafeModeAction == "omit" {
+				continue
+			}
+			h.blurImage(r, &images[i])
+		}
+		out = append(out, images[i])
+	}
+	return out
+}
+
+// blurImage points the image at a blurred rendition served by this API
+func (h *Handlers) blurImage(r *http.Request, image *models.Image) {
+	image.CDNUrl = fmt.Sprintf("%s/api/images/%d/render?size=512&blur=true", baseURL(r), image.ID)
+	image.Blurred = true
+}
+
+// baseURL is the scheme, host and archive prefix the client used to reach the API
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host + r.Header.Get("X-Forwarded-Prefix")
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/epstein-files/backend/internal/models"
+)
+
+// How a search was answered, sent as X-Cache
+const (
+	cacheHit   = "HIT"
+	cacheStale = "STALE"
+	cacheMiss  = "MISS"
+)
+
+// searchCache keeps recent search results so a burst of identical searches
+// costs one FTS query. Results are fresh for ttl; for a further stale period
+// they are still served while one background query refreshes them. Misses
+// on the same key wait for a single query instead of each running their own.
+type searchCache struct {
+	ttl, stale time.Duration
+	size       int
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element // of *searchEntry
+	lru      *list.List               // most recently used first
+	inflight map[string]*searchCall
+	stats    cacheCounter
+}
+
+type searchEntry struct {
+	key        string
+	result     *models.SearchResult
+	fetched    time.Time
+	refreshing bool
+}
+
+type searchCall struct {
+	done   chan struct{}
+	result *models.SearchResult
+	err    error
+}
+
+type searchFetch func(ctx context.Context) (*models.SearchResult, error)
+
+func newSearchCache(ttl, stale time.Duration, size int) *searchCache {
+	return &searchCache{
+		ttl:      ttl,
+		stale:    stale,
+		size:     size,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		inflight: make(map[string]*searchCall),
+	}
+}
+
+func (c *searchCache) enabled() bool {
+	return c.ttl > 0 && c.size > 0
+}
+
+// len returns the number of cached results
+func (c *searchCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// get returns the cached result for key, running fetch when there is none.
+// The result is shared: callers must copy it before modifying it. fetch
+// runs detached from ctx's cancellation, since other requests may be
+// waiting on it.
+func (c *searchCache) get(ctx context.Context, key string, fetch searchFetch) (*models.SearchResult, string, error) {
+	ctx = context.WithoutCancel(ctx)
+	if !c.enabled() {
+		result, err := fetch(ctx)
+		return result, cacheMiss, err
+	}
+
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*searchEntry)
+		age := time.Since(entry.fetched)
+		if age < c.ttl {
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+			c.stats.hit()
+			return entry.result, cacheHit, nil
+		}
+		if age < c.ttl+c.stale {
+			c.lru.MoveToFront(el)
+			if !entry.refreshing {
+				entry.refreshing = true
+				go c.refresh(ctx, key, fetch)
+			}
+			c.mu.Unlock()
+			c.stats.hit()
+			return entry.result, cacheStale, nil
+		}
+	}
+
+	// Waiting on another request's query spares the index all the same, so
+	// it counts as a hit
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		c.stats.hit()
+		<-call.done
+		return call.result, cacheMiss, call.err
+	}
+	c.stats.miss()
+	call := &searchCall{done: make(chan struct{})}
+	c.inflight[key] = call
+	c.mu.Unlock()
+
+	// Release the waiters even if fetch panics
+	defer func() {
+		c.mu.Lock()
+		delete(c.inflight, key)
+		switch {
+		case call.err != nil:
+		case call.result == nil:
+			call.err = errors.New("search failed")
+		default:
+			c.store(key, call.result)
+		}
+		c.mu.Unlock()
+		close(call.done)
+	}()
+	call.result, call.err = fetch(ctx)
+
+	return call.result, cacheMiss, call.err
+}
+
+// refresh replaces a stale entry. On failure the stale result stays until
+// it expires, and the next request tries again.
+func (c *searchCache) refresh(ctx context.Context, key string, fetch searchFetch) {
+	result, err := fetch(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		log.Printf("search cache: refreshing %q: %v", key, err)
+		if el, ok := c.entries[key]; ok {
+			el.Value.(*searchEntry).refreshing = false
+		}
+		return
+	}
+	c.store(key, result)
+}
+
+// store saves a result, evicting the least recently used entries over
+// size. Callers hold mu.
+func (c *searchCache) store(key string, result *models.SearchResult) {
+	if el, ok := c.entries[key]; ok {
+		*el.Value.(*searchEntry) = searchEntry{key: key, result: result, fetched: time.Now()}
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&searchEntry{key: key, result: result, fetched: time.Now()})
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*searchEntry).key)
+	}
+}
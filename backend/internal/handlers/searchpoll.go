@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/epstein-files/backend/internal/repository"
+)
+
+// Frontends poll pinned searches. A search's ETag is a hash of the corpus
+// version (the ingest version the manifest cache also keys on) and the
+// search, so a poll sending it back as If-None-Match is answered 304 without
+// the search being run until something is ingested. With wait=<seconds> a
+// poll that would be a 304 is held until the corpus changes or wait runs out.
+
+const (
+	maxSearchWait    = 60 * time.Second
+	corpusCheckEvery = 2 * time.Second // the most a version may lag an ingest
+)
+
+// corpusVersions memoizes the ingest version of the primary and the
+// replica, so polls cost one query per corpusCheckEvery between them
+type corpusVersions struct {
+	mu      sync.Mutex
+	version [2]string // primary, replica
+	checked [2]time.Time
+}
+
+func (c *corpusVersions) get(repo *repository.Repository, replica bool) (string, error) {
+	i := 0
+	if replica {
+		i = 1
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.checked[i]) < corpusCheckEvery {
+		return c.version[i], nil
+	}
+	version, err := repo.IngestVersion()
+	if err != nil {
+		return "", err
+	}
+	c.version[i], c.checked[i] = version, time.Now()
+	return version, nil
+}
+
+// readsReplica reports whether r reads from the replica
+func (h *Handlers) readsReplica(r *http.Request) bool {
+	return h.replica != nil && r.Context().Value(replicaKey{}) != nil
+}
+
+// searchETag identifies a search's response: its results at version, the
+// query as echoed and whether safe mode rewrote its images
+func searchETag(version, key, query string, safe bool) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%t", version, key, query, safe)))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header names etag
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// LongPollSearch holds a search with wait whose If-None-Match is still
+// current until the corpus changes, then passes it on to be answered as
+// usual. It goes outside the breaker, so the wait isn't taken for a slow
+// search.
+func (h *Handlers) LongPollSearch(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wait := min(time.Duration(getIntParam(r, "wait", 0))*time.Second, maxSearchWait)
+		sent := r.Header.Get("If-None-Match")
+		if wait <= 0 || sent == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		_, key, _, err := h.searchRequest(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		query, safe := r.URL.Query().Get("q"), h.safeMode(r)
+		until := time.Now().Add(wait)
+		for time.Now().Before(until) {
+			// Searches read from the replica when there is one
+			repo := h.repo
+			if h.replica != nil {
+				repo = h.replica.Repository()
+			}
+			version, err := h.corpus.get(repo.WithContext(r.Context()), h.replica != nil)
+			if err != nil || !etagMatches(sent, searchETag(version, key, query, safe)) {
+				break
+			}
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(min(corpusCheckEvery, time.Until(until))):
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/epstein-files/backend/internal/models"
+)
+
+// ============================================================================
+// SYNC
+// ============================================================================
+
+// GetSyncChanges returns change log entries with current row data, for mirrors
+// GET /api/sync/changes?cursor=xxx&limit=500
+func (h *Handlers) GetSyncChanges(w http.ResponseWriter, r *http.Request) {
+	cursor := r.URL.Query().Get("cursor")
+	limit := getIntParam(r, "limit", 500)
+	if limit > 1000 {
+		limit = 1000
+	}
+
+	result, err := h.repoFor(r).GetChanges(cursor, limit)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+
+	changes := result.Data.([]models.Change)
+	data := make([]models.SyncChange, 0, len(changes))
+	for _, change := range changes {
+		sc := models.SyncChange{Change: change}
+		if change.Op != models.ChangeDelete {
+			row, err := h.repoFor(r).GetRow(change.Entity, change.EntityID)
+			if err != nil {
+				writeError(w, r, err, "")
+				return
+			}
+			sc.Data = row
+		}
+		data = append(data, sc)
+	}
+	result.Data = data
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// GetChanges returns the public feed of create/update/delete events in order.
+// With wait=N the request is held up to N seconds until new events arrive.
+// GET /api/changes?since=xxx&limit=100&wait=30
+func (h *Handlers) GetChanges(w http.ResponseWriter, r *http.Request) {
+	since := r.URL.Query().Get("since")
+	limit := getIntParam(r, "limit", 100)
+	if limit > 1000 {
+		limit = 1000
+	}
+	wait := getIntParam(r, "wait", 0)
+	if wait > 60 {
+		wait = 60
+	}
+
+	deadline := time.Now().Add(time.Duration(wait) * time.Second)
+	for {
+		result, err := h.repoFor(r).GetChanges(since, limit)
+		if err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+
+		if len(result.Data.([]models.Change)) > 0 || !time.Now().Before(deadline) {
+			writeJSON(w, http.StatusOK, result)
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(changePollInterval):
+		}
+	}
+}
+
+// How often a long-polling change feed request re-checks the log
+const changePollInterval = time.Second
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/storage"
+	"github.com/epstein-files/backend/internal/tier"
+)
+
+// Name of the hot tier in responses; its rows have an empty tier
+const tierHot = "hot"
+
+// tiering reports whether source PDFs are tiered (COLD_STORAGE_DIR is set)
+func (h *Handlers) tiering() bool {
+	_, ok := h.files.(*storage.Tiered)
+	return ok
+}
+
+// DownloadDocument streams a document's source PDF, with range requests when
+// files are stored locally, and records the read for the tiering policy. A
+// PDF in cold storage answers 409 with status restore_required, or restoring
+// once a restore has been requested, until it is back in the hot tier.
+// GET /api/documents/{id}/file
+func (h *Handlers) DownloadDocument(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	repo := h.repoFor(r)
+	document, err := repo.GetDocumentByID(id)
+	if err != nil {
+		writeError(w, r, err, "Document not found")
+		return
+	}
+
+	tiering := h.tiering()
+	if tiering {
+		ft, err := repo.GetFileTier(id)
+		if err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+		if ft.Tier == models.TierCold || ft.Tier == models.TierRestoring {
+			restoreRequired(w, r, id, ft.Tier)
+			return
+		}
+	}
+
+	rc, err := h.files.Open(r.Context(), storage.DocumentKey(document.Filename))
+	if errors.Is(err, storage.ErrRestoreRequired) {
+		// Archived without a row, e.g. moved by hand; record it so it can be restored
+		if err := repo.SetFileTier(id, models.TierCold, nil); err != nil {
+			writeError(w, r, err, "")
+			return
+		}
+		restoreRequired(w, r, id, models.TierCold)
+		return
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, H{"error": "File not in storage"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, H{"error": err.Error()})
+		return
+	}
+	defer rc.Close()
+
+	if tiering {
+		if err := repo.TouchFile(id, time.Now().UTC()); err != nil {
+			log.Printf("Record read of %s: %v", id, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": document.Filename}))
+	if document.SHA256 != "" {
+		w.Header().Set("ETag", `"`+document.SHA256+`"`)
+	}
+	// Local files seek; CDN bodies are streamed whole
+	if content, ok := rc.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, document.Filename, document.UpdatedAt, content)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, rc)
+}
+
+// restoreRequired answers a read of a PDF in cold storage
+func restoreRequired(w http.ResponseWriter, r *http.Request, documentID, fileTier string) {
+	status := "restore_required"
+	if fileTier == models.TierRestoring {
+		status = "restoring"
+		w.Header().Set("Retry-After", "60")
+	}
+	writeJSON(w, http.StatusConflict, H{
+		"error":       "Source PDF is in cold storage",
+		"status":      status,
+		"restore_url": baseURL(r) + "/api/documents/" + documentID + "/restore",
+	})
+}
+
+// RestoreDocument queues a job copying a document's source PDF back from
+// cold storage; it answers 202 while the restore is pending and 200 once the
+// PDF is hot
+// POST /api/documents/{id}/restore
+func (h *Handlers) RestoreDocument(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	repo := h.repoFor(r)
+	exists, err := repo.DocumentExists(id)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	if !exists {
+		writeJSON(w, http.StatusNotFound, H{"error": "Document not found"})
+		return
+	}
+
+	// Asking for it counts as a read, so it isn't archived again straight away
+	if err := repo.TouchFile(id, time.Now().UTC()); err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	claimed, err := repo.ClaimRestore(id)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	if claimed {
+		job, err := h.jobs.Enqueue(r.Context(), tier.RestoreJobType, tier.RestoreParams(id))
+		if err != nil {
+			repo.SetFileTier(id, models.TierCold, nil)
+			writeError(w, r, err, "")
+			return
+		}
+		w.Header().Set("Retry-After", "60")
+		writeJSON(w, http.StatusAccepted, H{"document_id": id, "status": "restoring", "job": job})
+		return
+	}
+
+	ft, err := repo.GetFileTier(id)
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	switch ft.Tier {
+	case models.TierRestoring:
+		w.Header().Set("Retry-After", "60")
+		writeJSON(w, http.StatusAccepted, H{"document_id": id, "status": "restoring"})
+	case models.TierRestored:
+		writeJSON(w, http.StatusOK, H{"document_id": id, "status": "restored", "restored_until": ft.RestoredUntil})
+	default:
+		writeJSON(w, http.StatusOK, H{"document_id": id, "status": tierHot})
+	}
+}
+
+// GetFileTiers counts source PDFs by storage tier
+// GET /api/admin/tier
+func (h *Handlers) GetFileTiers(w http.ResponseWriter, r *http.Request) {
+	counts, err := h.repoFor(r).CountFileTiers()
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	counts[tierHot] = counts[""]
+	delete(counts, "")
+
+	writeJSON(w, http.StatusOK, H{
+		"tiers":           counts,
+		"cold_after_days": h.cfg.TierColdAfterDays,
+		"restore_days":    h.cfg.TierRestoreDays,
+	})
+}
+
+// ArchiveColdFiles queues a job moving the source PDFs not read for
+// cold_after_days (TIER_COLD_AFTER_DAYS by default) to cold storage
+// POST /api/admin/tier?cold_after_days=180
+func (h *Handlers) ArchiveColdFiles(w http.ResponseWriter, r *http.Request) {
+	if h.cfg.LegalHold {
+		writeJSON(w, http.StatusConflict, H{"error": "Legal hold is on; files cannot be moved to cold storage"})
+		return
+	}
+	days := getIntParam(r, "cold_after_days", h.cfg.TierColdAfterDays)
+	if days < 1 {
+		writeJSON(w, http.StatusBadRequest, H{"error": "cold_after_days must be at least 1"})
+		return
+	}
+
+	job, err := h.jobs.Enqueue(r.Context(), tier.ArchiveJobType, tier.ArchiveParams(days, time.Now()))
+	if err != nil {
+		writeError(w, r, err, "")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, job)
+}
@@ -0,0 +1,162 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Rotate turns src clockwise by degrees. Multiples of 90 are exact pixel
+// transposes; any other angle is bilinear-sampled onto a canvas large enough
+// to hold the rotated image, with the uncovered corners filled white.
+func Rotate(src image.Image, degrees float64) image.Image {
+	degrees = math.Mod(degrees, 360)
+	if degrees < 0 {
+		degrees += 360
+	}
+
+	switch degrees {
+	case 0:
+		return src
+	case 90, 180, 270:
+		return rotateRightAngle(src, int(degrees))
+	}
+
+	b := src.Bounds()
+	w, h := float64(b.Dx()), float64(b.Dy())
+	rad := degrees * math.Pi / 180
+	sin, cos := math.Sin(rad), math.Cos(rad)
+
+	dw := int(math.Ceil(math.Abs(w*cos) + math.Abs(h*sin)))
+	dh := int(math.Ceil(math.Abs(w*sin) + math.Abs(h*cos)))
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	cx, cy := w/2, h/2
+	dcx, dcy := float64(dw)/2, float64(dh)/2
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			// Inverse mapping: rotate the destination point back into src
+			dx, dy := float64(x)+0.5-dcx, float64(y)+0.5-dcy
+			sx := dx*cos + dy*sin + cx - 0.5
+			sy := -dx*sin + dy*cos + cy - 0.5
+			dst.Set(x, y, bilinear(src, b, sx, sy))
+		}
+	}
+	return dst
+}
+
+// Fit downscales src so that its longest side is at most maxSide, using box
+// filtering. Images already small enough are returned unchanged.
+func Fit(src image.Image, maxSide int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if maxSide <= 0 || (w <= maxSide && h <= maxSide) {
+		return src
+	}
+
+	scale := float64(maxSide) / float64(max(w, h))
+	dw := max(1, int(float64(w)*scale))
+	dh := max(1, int(float64(h)*scale))
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		y0 := b.Min.Y + y*h/dh
+		y1 := max(y0+1, b.Min.Y+(y+1)*h/dh)
+		for x := 0; x < dw; x++ {
+			x0 := b.Min.X + x*w/dw
+			x1 := max(x0+1, b.Min.X+(x+1)*w/dw)
+
+			var r, g, bl, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+cr, g+cg, bl+cb, a+ca
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(bl / n), uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+// Blur obscures src by shrinking it to a tiny thumbnail and scaling it back
+// up with bilinear interpolation. strength is the side length of the
+// intermediate thumbnail; smaller is blurrier.
+func Blur(src image.Image, strength int) image.Image {
+	b := src.Bounds()
+	return Resize(Fit(src, strength), b.Dx(), b.Dy())
+}
+
+// Resize scales src to exactly w x h using bilinear interpolation.
+func Resize(src image.Image, w, h int) image.Image {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	sx := float64(b.Dx()) / float64(w)
+	sy := float64(b.Dy()) / float64(h)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// Clamp so edge pixels sample the image rather than the white fill
+			fx := math.Max(0, math.Min(float64(x)*sx+sx/2-0.5, float64(b.Dx()-1)))
+			fy := math.Max(0, math.Min(float64(y)*sy+sy/2-0.5, float64(b.Dy()-1)))
+			dst.Set(x, y, bilinear(src, b, fx, fy))
+		}
+	}
+	return dst
+}
+
+func rotateRightAngle(src image.Image, degrees int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	var dst *image.RGBA
+	if degrees == 180 {
+		dst = image.NewRGBA(image.Rect(0, 0, w, h))
+	} else {
+		dst = image.NewRGBA(image.Rect(0, 0, h, w))
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := src.At(b.Min.X+x, b.Min.Y+y)
+			switch degrees {
+			case 90:
+				dst.Set(h-1-y, x, c)
+			case 180:
+				dst.Set(w-1-x, h-1-y, c)
+			case 270:
+				dst.Set(y, w-1-x, c)
+			}
+		}
+	}
+	return dst
+}
+
+func bilinear(src image.Image, b image.Rectangle, x, y float64) color.Color {
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+
+	var r, g, bl, a float64
+	for _, p := range [4]struct {
+		dx, dy int
+		w      float64
+	}{
+		{0, 0, (1 - fx) * (1 - fy)},
+		{1, 0, fx * (1 - fy)},
+		{0, 1, (1 - fx) * fy},
+		{1, 1, fx * fy},
+	} {
+		px, py := b.Min.X+x0+p.dx, b.Min.Y+y0+p.dy
+		var cr, cg, cb, ca uint32 = 0xffff, 0xffff, 0xffff, 0xffff // white outside the source
+		if image.Pt(px, py).In(b) {
+			cr, cg, cb, ca = src.At(px, py).RGBA()
+		}
+		r += float64(cr) * p.w
+		g += float64(cg) * p.w
+		bl += float64(cb) * p.w
+		a += float64(ca) * p.w
+	}
+	return color.RGBA64{uint16(r), uint16(g), uint16(bl), uint16(a)}
+}
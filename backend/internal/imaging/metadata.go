@@ -0,0 +1,360 @@
+package imaging
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"sort"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// RawMetadata holds the metadata blocks of an image file byte for byte, as
+// opposed to the normalized EXIF subset stored at ingest
+type RawMetadata struct {
+	Format string `json:"format"` // "jpeg", "png" or "" when unrecognized
+
+	EXIF     []byte    `json:"exif,omitempty"` // TIFF-structured EXIF block
+	EXIFTags []EXIFTag `json:"exif_tags,omitempty"`
+	XMP      string    `json:"xmp,omitempty"`          // XMP packet
+	XMPExt   string    `json:"xmp_extended,omitempty"` // JPEG extended XMP, chunks joined in order
+	IPTC     []byte    `json:"iptc,omitempty"`         // IPTC-NAA record (Photoshop resource 0x0404)
+
+	IPTCDatasets []IPTCDataset `json:"iptc_datasets,omitempty"`
+}
+
+// EXIFTag is one entry of an EXIF IFD with its undecoded value bytes
+type EXIFTag struct {
+	IFD   string `json:"ifd"` // IFD0, IFD1, Exif, GPS or Interop
+	ID    string `json:"id"`  // e.g. 0x010f
+	Name  string `json:"name,omitempty"`
+	Type  uint16 `json:"type"`
+	Count uint32 `json:"count"`
+	Value string `json:"value"`
+	Raw   string `json:"raw"` // hex
+}
+
+// IPTCDataset is one record:dataset value of an IPTC-NAA block
+type IPTCDataset struct {
+	Record  uint8  `json:"record"`
+	Dataset uint8  `json:"dataset"`
+	Value   string `json:"value"`
+}
+
+var (
+	jpegEXIFHeader   = []byte("Exif\x00\x00")
+	jpegXMPHeader    = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	jpegXMPExtHeader = []byte("http://ns.adobe.com/xmp/extension/\x00")
+	photoshopHeader  = []byte("Photoshop 3.0\x00")
+	pngSignature     = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// ReadMetadata extracts the EXIF, XMP and IPTC blocks of a JPEG or PNG file
+// without interpreting or rewriting them. Formats it doesn't know return an
+// empty result.
+func ReadMetadata(data []byte) (*RawMetadata, error) {
+	m := &RawMetadata{}
+	var err error
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		m.Format = "jpeg"
+		err = readJPEGSegments(data, m)
+	case bytes.HasPrefix(data, pngSignature):
+		m.Format = "png"
+		err = readPNGChunks(data, m)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(m.EXIF) > 0 {
+		m.EXIFTags = dumpEXIF(m.EXIF)
+	}
+	if len(m.IPTC) > 0 {
+		m.IPTCDatasets = parseIPTC(m.IPTC)
+	}
+	return m, nil
+}
+
+// readJPEGSegments walks the marker segments up to the start of scan, where
+// every metadata segment has been seen
+func readJPEGSegments(data []byte, m *RawMetadata) error {
+	type xmpChunk struct {
+		offset uint32
+		data   []byte
+	}
+	var extended []xmpChunk
+
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return fmt.Errorf("jpeg: expected marker at offset %d", pos)
+		}
+		marker := data[pos+1]
+		if marker == 0xFF { // fill byte
+			pos++
+			continue
+		}
+		if marker == 0xD9 || marker == 0xDA { // EOI, SOS
+			break
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) { // no length
+			pos += 2
+			continue
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return fmt.Errorf("jpeg: truncated segment 0x%02X at offset %d", marker, pos)
+		}
+		payload := data[pos+4 : pos+2+length]
+
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(payload, jpegEXIFHeader):
+			m.EXIF = payload[len(jpegEXIFHeader):]
+		case marker == 0xE1 && bytes.HasPrefix(payload, jpegXMPHeader):
+			m.XMP = string(payload[len(jpegXMPHeader):])
+		case marker == 0xE1 && bytes.HasPrefix(payload, jpegXMPExtHeader):
+			// 32-byte GUID, 4-byte full length, 4-byte offset, then data
+			rest := payload[len(jpegXMPExtHeader):]
+			if len(rest) > 40 {
+				extended = append(extended, xmpChunk{binary.BigEndian.Uint32(rest[36:40]), rest[40:]})
+			}
+		case marker == 0xED && bytes.HasPrefix(payload, photoshopHeader):
+			m.IPTC = photoshopIPTC(payload[len(photoshopHeader):])
+		}
+		pos += 2 + length
+	}
+
+	if len(extended) > 0 {
+		// Chunks may arrive out of order; offsets say where each belongs
+		sort.Slice(extended, func(i, j int) bool { return extended[i].offset < extended[j].offset })
+		var b bytes.Buffer
+		for _, c := range extended {
+			b.Write(c.data)
+		}
+		m.XMPExt = b.String()
+	}
+	return nil
+}
+
+// photoshopIPTC finds the IPTC-NAA resource among Photoshop image resources
+func photoshopIPTC(resources []byte) []byte {
+	pos := 0
+	for pos+8 <= len(resources) && bytes.Equal(resources[pos:pos+4], []byte("8BIM")) {
+		id := binary.BigEndian.Uint16(resources[pos+4:])
+		pos += 6
+
+		// Pascal string name, padded to an even length
+		if pos >= len(resources) {
+			return nil
+		}
+		nameLen := int(resources[pos]) + 1
+		if nameLen%2 == 1 {
+			nameLen++
+		}
+		pos += nameLen
+		if pos+4 > len(resources) {
+			return nil
+		}
+
+		size := int(binary.BigEndian.Uint32(resources[pos:]))
+		pos += 4
+		if size < 0 || pos+size > len(resources) {
+			return nil
+		}
+		if id == 0x0404 {
+			return resources[pos : pos+size]
+		}
+		pos += size + size%2
+	}
+	return nil
+}
+
+// readPNGChunks pulls EXIF from eXIf and XMP from its iTXt chunk
+func readPNGChunks(data []byte, m *RawMetadata) error {
+	pos := len(pngSignature)
+	for pos+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		kind := string(data[pos+4 : pos+8])
+		if length < 0 || pos+12+length > len(data) {
+			return fmt.Errorf("png: truncated %s chunk at offset %d", kind, pos)
+		}
+		chunk := data[pos+8 : pos+8+length]
+
+		switch kind {
+		case "eXIf":
+			m.EXIF = chunk
+		case "iTXt":
+			if xmp, ok := pngXMP(chunk); ok {
+				m.XMP = xmp
+			}
+		case "IEND":
+			return nil
+		}
+		pos += 12 + length
+	}
+	return nil
+}
+
+// pngXMP reads the text of an iTXt chunk with the XMP keyword
+func pngXMP(chunk []byte) (string, bool) {
+	keyword, rest, ok := bytes.Cut(chunk, []byte{0})
+	if !ok || string(keyword) != "XML:com.adobe.xmp" || len(rest) < 2 {
+		return "", false
+	}
+	compressed := rest[0] == 1
+	// Skip the compression method, language tag and translated keyword
+	_, rest, ok = bytes.Cut(rest[2:], []byte{0})
+	if !ok {
+		return "", false
+	}
+	_, text, ok := bytes.Cut(rest, []byte{0})
+	if !ok {
+		return "", false
+	}
+	if compressed {
+		zr, err := zlib.NewReader(bytes.NewReader(text))
+		if err != nil {
+			return "", false
+		}
+		defer zr.Close()
+		if text, err = io.ReadAll(zr); err != nil {
+			return "", false
+		}
+	}
+	return string(text), true
+}
+
+// Sub-IFD pointer tags and the names of the IFDs they point to
+var exifSubIFDs = map[uint16]string{
+	0x8769: "Exif",
+	0x8825: "GPS",
+	0xA005: "Interop",
+}
+
+// dumpEXIF lists every tag of every IFD in the block, known or not. Tag
+// names come from goexif, which only keeps the tags it knows.
+func dumpEXIF(block []byte) []EXIFTag {
+	t, err := tiff.Decode(bytes.NewReader(block))
+	if err != nil {
+		return nil
+	}
+
+	// GPS and Interop tag IDs overlap, so keep every name seen per ID
+	names := map[uint16][]string{}
+	if x, err := exif.Decode(bytes.NewReader(block)); err == nil {
+		x.Walk(walker(func(name exif.FieldName, tag *tiff.Tag) {
+			names[tag.Id] = append(names[tag.Id], string(name))
+		}))
+	}
+	nameIn := func(ifd string, id uint16) string {
+		for _, name := range names[id] {
+			gps := strings.HasPrefix(name, "GPS")
+			interop := strings.HasPrefix(name, "Interoperability")
+			if (ifd == "GPS") == gps && (ifd == "Interop") == interop {
+				return name
+			}
+		}
+		return ""
+	}
+
+	var tags []EXIFTag
+	visited := map[int64]bool{}
+	var walk func(ifd string, dir *tiff.Dir)
+	walk = func(ifd string, dir *tiff.Dir) {
+		for _, tag := range dir.Tags {
+			tags = append(tags, EXIFTag{
+				IFD:   ifd,
+				ID:    fmt.Sprintf("0x%04x", tag.Id),
+				Name:  nameIn(ifd, tag.Id),
+				Type:  uint16(tag.Type),
+				Count: tag.Count,
+				Value: strings.Trim(tag.String(), `"`),
+				Raw:   hex.EncodeToString(tag.Val),
+			})
+
+			sub, ok := exifSubIFDs[tag.Id]
+			if !ok {
+				continue
+			}
+			offset, err := tag.Int64(0)
+			if err != nil || offset <= 0 || offset >= int64(len(block)) || visited[offset] {
+				continue
+			}
+			visited[offset] = true
+			r := bytes.NewReader(block)
+			r.Seek(offset, io.SeekStart)
+			if subDir, _, err := tiff.DecodeDir(r, t.Order); err == nil {
+				walk(sub, subDir)
+			}
+		}
+	}
+	for i, dir := range t.Dirs {
+		walk(fmt.Sprintf("IFD%d", i), dir)
+	}
+	return tags
+}
+
+type walker func(exif.FieldName, *tiff.Tag)
+
+func (w walker) Walk(name exif.FieldName, tag *tiff.Tag) error {
+	w(name, tag)
+	return nil
+}
+
+// parseIPTC splits an IPTC-NAA block into its datasets
+func parseIPTC(block []byte) []IPTCDataset {
+	var datasets []IPTCDataset
+	pos := 0
+	for pos+5 <= len(block) && block[pos] == 0x1C {
+		size := int(binary.BigEndian.Uint16(block[pos+3:]))
+		if size&0x8000 != 0 { // extended dataset lengths aren't used for text
+			break
+		}
+		start := pos + 5
+		if start+size > len(block) {
+			break
+		}
+		datasets = append(datasets, IPTCDataset{
+			Record:  block[pos+1],
+			Dataset: block[pos+2],
+			Value:   string(block[start : start+size]),
+		})
+		pos = start + size
+	}
+	return datasets
+}
+
+// MetadataReader names the code that produced a RawMetadata: this module's
+// reader and the EXIF decoder it uses, with their build versions
+func MetadataReader() map[string]string {
+	reader := map[string]string{
+		"tool":    "epstein-files/backend imaging.ReadMetadata",
+		"version": "(devel)",
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return reader
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		reader["version"] = info.Main.Version
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			reader["version"] = s.Value
+		}
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == "github.com/rwcarlsen/goexif" {
+			reader["exif_decoder"] = dep.Path + "@" + dep.Version
+		}
+	}
+	return reader
+}
@@ -0,0 +1,148 @@
+// Package integrity removes the image rows whose document or stored file is
+// gone: what deletes made before foreign keys were enforced (or by scripts
+// that don't enforce them) leave behind. The tags and faces of those images
+// go with them.
+package integrity
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/epstein-files/backend/internal/jobs"
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/repository"
+	"github.com/epstein-files/backend/internal/storage"
+)
+
+// JobType is the job type for the orphaned image cleanup
+const JobType = "orphan-cleanup"
+
+const batchSize = 200
+
+// Removed images listed in the job result; the counts cover the rest
+const maxReportedImages = 100
+
+// Why an image was removed
+const (
+	reasonDocument = "document_gone"
+	reasonFile     = "file_gone"
+)
+
+// Params builds the stored parameters of a cleanup job. files also checks
+// that the file of each image with a document is still stored, which opens
+// every image; against the wrong store it would find them all gone, so a
+// dry run first is wise. dryRun finds the orphans without removing them.
+func Params(files, dryRun bool) models.JSON {
+	return models.JSON{"files": files, "dry_run": dryRun}
+}
+
+// Job finds the images whose document is gone, and with "files" those whose
+// file is, and removes them a batch per transaction, so the API isn't held
+// up behind the job. A file that can't be checked for another reason than
+// being missing is logged, counted as failed and kept. Tags and faces whose
+// image was already gone are removed at the end. The result counts what was
+// removed by reason and lists the first images.
+func Job(repo *repository.Repository, store storage.Store) jobs.Handler {
+	return func(ctx context.Context, job *models.Job, p *jobs.Progress) error {
+		repo := repo.WithContext(ctx)
+		files, _ := job.Params["files"].(bool)
+		dryRun, _ := job.Params["dry_run"].(bool)
+
+		if job.Total == 0 {
+			total, err := repo.CountOrphanCandidates(files)
+			if err != nil {
+				return err
+			}
+			job.Total = total
+		}
+		if job.Result == nil {
+			job.Result = models.JSON{
+				reasonDocument: 0, reasonFile: 0, "tags": 0, "faces": 0,
+				"dry_run": dryRun, "images": []interface{}{},
+			}
+		}
+
+		for {
+			batch, err := repo.GetOrphanCandidates(job.Cursor, files, batchSize)
+			if err != nil {
+				return err
+			}
+			if len(batch) == 0 {
+				break
+			}
+
+			var orphans []uint
+			for _, img := range batch {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				reason, err := check(ctx, store, img, files)
+				if err != nil {
+					log.Printf("Checking the file of image %d: %v", img.ID, err)
+					job.Failed++
+				} else if reason != "" {
+					orphans = append(orphans, img.ID)
+					record(job, img, reason)
+				}
+				job.Processed++
+				job.Cursor = img.ID
+			}
+
+			if !dryRun {
+				tags, faces, err := repo.DeleteImages(orphans)
+				if err != nil {
+					return err
+				}
+				jobs.AddCount(job.Result, "tags", tags)
+				jobs.AddCount(job.Result, "faces", faces)
+			}
+			if err := p.Save(); err != nil {
+				return err
+			}
+		}
+
+		if !dryRun {
+			tags, faces, err := repo.DeleteDetachedImageRows()
+			if err != nil {
+				return err
+			}
+			jobs.AddCount(job.Result, "tags", tags)
+			jobs.AddCount(job.Result, "faces", faces)
+		}
+		return p.Save()
+	}
+}
+
+// check returns why img is an orphan, or "" when it isn't
+func check(ctx context.Context, store storage.Store, img repository.ImageLink, files bool) (string, error) {
+	if !img.HasDocument {
+		return reasonDocument, nil
+	}
+	if !files {
+		return "", nil
+	}
+	rc, err := store.Open(ctx, storage.ImageKey(img.DocumentID, img.Filename))
+	if errors.Is(err, storage.ErrNotFound) {
+		return reasonFile, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	rc.Close()
+	return "", nil
+}
+
+func record(job *models.Job, img repository.ImageLink, reason string) {
+	jobs.AddCount(job.Result, reason, 1)
+
+	images, _ := job.Result["images"].([]interface{})
+	if len(images) >= maxReportedImages {
+		return
+	}
+	job.Result["images"] = append(images, map[string]interface{}{
+		"id":          img.ID,
+		"document_id": img.DocumentID,
+		"reason":      reason,
+	})
+}
@@ -0,0 +1,24 @@
+package jobs
+
+import "github.com/epstein-files/backend/internal/models"
+
+// ParamInt reads a number from job params or a result, which come back from
+// JSON as float64 on a resumed job; it is 0 when the key is missing
+func ParamInt(params models.JSON, key string) int {
+	switch v := params[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case uint:
+		return int(v)
+	}
+	return 0
+}
+
+// AddCount adds n to a count in a job result
+func AddCount(result models.JSON, key string, n int64) {
+	result[key] = int64(ParamInt(result, key)) + n
+}
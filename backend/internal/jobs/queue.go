@@ -0,0 +1,220 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/repository"
+	"github.com/epstein-files/backend/internal/telemetry"
+)
+
+// ErrCancelled is returned by Progress.Save once the job has been cancelled
+var ErrCancelled = errors.New("job cancelled")
+
+// pollInterval is how often an idle worker looks for jobs it was not woken
+// for, and a busy one heartbeats the job it is running
+const pollInterval = 30 * time.Second
+
+// leaseTimeout is how long a running job may go without a heartbeat before
+// another worker takes it over
+const leaseTimeout = 5 * pollInterval
+
+// Handler runs one job. It should resume from job.Cursor, and call p.Save
+// after each batch so progress is visible and survives a restart.
+type Handler func(ctx context.Context, job *models.Job, p *Progress) error
+
+// Queue runs jobs stored in the jobs table one at a time, in order.
+// A job left running when the process stopped is resumed on startup. Several
+// processes can share the table, each a worker with its own ID running one
+// job at a time; one that dies mid-job has it taken over once its heartbeat
+// lapses.
+type Queue struct {
+	repo     *repository.Repository
+	worker   string
+	started  time.Time
+	mu       sync.RWMutex
+	handlers map[string]Handler
+	wake     chan struct{}
+
+	polled  atomic.Int64 // unix nanoseconds of the last look for a job
+	running atomic.Bool  // a job is being run
+}
+
+// NewQueue returns a queue whose Run claims jobs as worker, which must be
+// unique among the processes sharing the database
+func NewQueue(repo *repository.Repository, worker string) *Queue {
+	return &Queue{
+		repo:     repo,
+		worker:   worker,
+		started:  time.Now(),
+		handlers: make(map[string]Handler),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Register sets the handler for a job type
+func (q *Queue) Register(jobType string, h Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[jobType] = h
+}
+
+// Enqueue stores a new job and wakes the worker. Workers in other processes
+// find it within pollInterval.
+func (q *Queue) Enqueue(ctx context.Context, jobType string, params models.JSON) (*models.Job, error) {
+	q.mu.RLock()
+	_, ok := q.handlers[jobType]
+	q.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown job type %q", jobType)
+	}
+
+	job := &models.Job{Type: jobType, Params: params}
+	if err := q.repo.WithContext(ctx).CreateJob(job); err != nil {
+		return nil, err
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Run processes jobs until ctx is cancelled
+func (q *Queue) Run(ctx context.Context) {
+	for {
+		q.polled.Store(time.Now().UnixNano())
+		repo := q.repo.WithContext(ctx)
+		if err := repo.TouchWorker(q.worker, q.started); err != nil {
+			log.Printf("Job queue: check in: %v", err)
+		}
+		job, err := repo.ClaimNextJob(q.worker, time.Now().Add(-leaseTimeout))
+		if err != nil {
+			log.Printf("Job queue: claim failed: %v", err)
+		}
+		if job != nil {
+			q.running.Store(true)
+			q.run(ctx, job)
+			q.running.Store(false)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// Alive reports whether the worker is running a job or has looked for one
+// within the last two poll intervals. It is false before Run starts.
+func (q *Queue) Alive() bool {
+	if q.running.Load() {
+		return true
+	}
+	polled := q.polled.Load()
+	return polled != 0 && time.Since(time.Unix(0, polled)) < 2*pollInterval
+}
+
+// Workers returns the workers of any process sharing the database that
+// looked for a job or heartbeat one within the last two poll intervals
+func (q *Queue) Workers(ctx context.Context) ([]models.JobWorker, error) {
+	return q.repo.WithContext(ctx).GetJobWorkers(time.Now().Add(-2 * pollInterval))
+}
+
+func (q *Queue) run(ctx context.Context, job *models.Job) {
+	ctx, span := telemetry.Start(ctx, "jobs."+job.Type)
+	defer span.End()
+	repo := q.repo.WithContext(ctx)
+
+	q.mu.RLock()
+	h, ok := q.handlers[job.Type]
+	q.mu.RUnlock()
+	if !ok {
+		repo.FinishJob(job, models.JobFailed, fmt.Sprintf("unknown job type %q", job.Type))
+		return
+	}
+
+	log.Printf("Job %d (%s) started at cursor %d", job.ID, job.Type, job.Cursor)
+	stop := q.heartbeat(ctx, job.ID)
+	err := h(ctx, job, &Progress{job: job, repo: repo})
+	stop()
+
+	// Shutting down: keep the job running so the next start resumes it
+	if ctx.Err() != nil {
+		q.repo.WithContext(context.WithoutCancel(ctx)).SaveJobProgress(job)
+		log.Printf("Job %d (%s) interrupted at cursor %d", job.ID, job.Type, job.Cursor)
+		return
+	}
+
+	status, msg := models.JobDone, ""
+	switch {
+	case errors.Is(err, ErrCancelled):
+		status = models.JobCancelled
+	case err != nil:
+		status, msg = models.JobFailed, err.Error()
+	}
+	if err := repo.FinishJob(job, status, msg); err != nil {
+		log.Printf("Job %d: save final status: %v", job.ID, err)
+		return
+	}
+	log.Printf("Job %d (%s) %s: %d processed, %d failed", job.ID, job.Type, status, job.Processed, job.Failed)
+}
+
+// heartbeat keeps the job's lease fresh until the returned func is called
+func (q *Queue) heartbeat(ctx context.Context, id uint) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				repo := q.repo.WithContext(ctx)
+				err := repo.HeartbeatJob(id, q.worker)
+				if err == nil {
+					err = repo.TouchWorker(q.worker, q.started)
+				}
+				if err != nil && ctx.Err() == nil {
+					log.Printf("Job %d: heartbeat: %v", id, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// Progress lets a running handler checkpoint its counters and cursor
+type Progress struct {
+	job  *models.Job
+	repo *repository.Repository
+}
+
+// Save persists the job's counters and cursor. It returns ErrCancelled when
+// the job was cancelled meanwhile; handlers should return it as is.
+func (p *Progress) Save() error {
+	status, err := p.repo.SaveJobProgress(p.job)
+	if err != nil {
+		return err
+	}
+	if status == models.JobCancelled {
+		return ErrCancelled
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Package logging holds the server's log level (LOG_LEVEL), which can
+// change while serving when the configuration is reloaded
+package logging
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm/logger"
+)
+
+// Log levels, most verbose first
+const (
+	Debug  = "debug"  // every SQL statement too
+	Info   = "info"   // one line per request, slow queries and errors
+	Warn   = "warn"   // slow queries and errors
+	Error  = "error"  // errors only
+	Silent = "silent" // nothing
+)
+
+var levels = []string{Debug, Info, Warn, Error, Silent}
+
+var current atomic.Int32
+
+func init() {
+	current.Store(rank(Info))
+}
+
+func rank(level string) int32 {
+	for i, l := range levels {
+		if l == level {
+			return int32(i)
+		}
+	}
+	return -1
+}
+
+// Valid reports whether level names a log level
+func Valid(level string) bool {
+	return rank(level) >= 0
+}
+
+// SetLevel changes the log level; unknown levels are ignored
+func SetLevel(level string) {
+	if r := rank(level); r >= 0 {
+		current.Store(r)
+	}
+}
+
+// Level returns the current log level
+func Level() string {
+	return levels[current.Load()]
+}
+
+// Enabled reports whether messages at level are logged
+func Enabled(level string) bool {
+	return rank(level) >= current.Load()
+}
+
+// GormLogger follows the current level: SQL at debug, slow queries down to
+// warn and errors down to error
+func GormLogger() logger.Interface {
+	base := func(level logger.LogLevel) logger.Interface {
+		return logger.New(
+			log.New(os.Stdout, "\r\n", log.LstdFlags),
+			logger.Config{
+				SlowThreshold:             200 * time.Millisecond,
+				LogLevel:                  level,
+				IgnoreRecordNotFoundError: true,
+				Colorful:                  true,
+			},
+		)
+	}
+	return gormLogger{
+		base(logger.Info),
+		base(logger.Warn),
+		base(logger.Warn),
+		base(logger.Error),
+		base(logger.Silent),
+	}
+}
+
+// gormLogger holds one gorm logger per level and forwards to the current one
+type gormLogger []logger.Interface
+
+func (l gormLogger) now() logger.Interface {
+	return l[current.Load()]
+}
+
+// LogMode is how gorm's Debug() asks for more output; the level stays ours
+func (l gormLogger) LogMode(logger.LogLevel) logger.Interface {
+	return l
+}
+
+func (l gormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	l.now().Info(ctx, msg, args...)
+}
+
+func (l gormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	l.now().Warn(ctx, msg, args...)
+}
+
+func (l gormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	l.now().Error(ctx, msg, args...)
+}
+
+func (l gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	l.now().Trace(ctx, begin, fc, err)
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// BearerToken rejects requests that don't send "Authorization: Bearer <token>"
+func BearerToken(token string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sent := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+				writeError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type contributorKey struct{}
+
+// Contributors authenticates "Authorization: Bearer <token>" against a set of
+// tokens, each issued to a named contributor, and records the name for
+// handlers (see Contributor)
+func Contributors(tokens map[string]string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := KeyName(tokens, r)
+			if name == "" {
+				writeError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contributorKey{}, name)))
+		})
+	}
+}
+
+// KeyName names the API key the request was made with: the contributor
+// already authenticated, or the one of tokens (token -> name) it sends.
+// Empty when it sends none of them.
+func KeyName(tokens map[string]string, r *http.Request) string {
+	if name := Contributor(r.Context()); name != "" {
+		return name
+	}
+	sent := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if sent == "" {
+		return ""
+	}
+	name := ""
+	for token, n := range tokens {
+		if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) == 1 {
+			name = n
+		}
+	}
+	return name
+}
+
+// Contributor is the name of the contributor authenticated by Contributors
+func Contributor(ctx context.Context) string {
+	name, _ := ctx.Value(contributorKey{}).(string)
+	return name
+}
@@ -0,0 +1,235 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/epstein-files/backend/internal/models"
+)
+
+// Breaker states
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half_open"
+)
+
+// BreakerSettings configure every circuit breaker of a Breakers
+type BreakerSettings struct {
+	ErrorRate   float64       // failure share of the window that opens a breaker
+	Slow        time.Duration // a response slower than this to start is a failure; 0 for none
+	MinRequests int           // requests in the window before it can open; 0 never does
+	Window      time.Duration
+	Cooldown    time.Duration // how long an open breaker sheds load
+}
+
+// Breakers are the circuit breakers of one archive's expensive endpoints.
+// Each counts its responses over a sliding window. When enough of them fail
+// (5xx, or slow to start) it opens and answers 503 with Retry-After for the
+// cooldown, leaving the database to the cheap endpoints. Then it lets one
+// request through: if that one succeeds it closes again, otherwise it stays
+// open for another cooldown.
+type Breakers struct {
+	settings BreakerSettings
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+type breaker struct {
+	state    string
+	openedAt time.Time
+	probing  bool // the half-open request is in flight
+	trips    int64
+	shed     int64
+	seconds  []breakerBucket // ring of one-second buckets over the window
+}
+
+type breakerBucket struct {
+	second             int64 // unix second the bucket counts
+	requests, failures int64
+}
+
+func NewBreakers(settings BreakerSettings) *Breakers {
+	return &Breakers{settings: settings, breakers: make(map[string]*breaker)}
+}
+
+// Guard wraps an endpoint in the breaker called name. Put it outside the
+// request timeout so the 503s of a busy database count as failures.
+func (b *Breakers) Guard(name string) Middleware {
+	b.mu.Lock()
+	b.breakers[name] = &breaker{
+		state:   breakerClosed,
+		seconds: make([]breakerBucket, max(int(b.settings.Window/time.Second), 1)),
+	}
+	b.mu.Unlock()
+
+	return func(next http.Handler) http.Handler {
+		if b.settings.MinRequests <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			probe, wait := b.allow(name, time.Now())
+			if wait > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds()+0.999)))
+				writeError(w, http.StatusServiceUnavailable, fmt.Sprintf("%s is shedding load, retry shortly", name))
+				return
+			}
+
+			start := time.Now()
+			tw := &firstByteWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(tw, r)
+			if tw.started.IsZero() {
+				tw.started = time.Now()
+			}
+			// A client gone away says nothing about the endpoint
+			if errors.Is(r.Context().Err(), context.Canceled) {
+				b.abandon(name, probe)
+				return
+			}
+			slow := b.settings.Slow > 0 && tw.started.Sub(start) > b.settings.Slow
+			b.record(name, probe, tw.status >= 500 || slow, time.Now())
+		})
+	}
+}
+
+// allow decides whether a request may go through the breaker: whether it is
+// the half-open probe, or else how long to wait when it may not
+func (b *Breakers) allow(name string, now time.Time) (probe bool, wait time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br := b.breakers[name]
+
+	switch br.state {
+	case breakerOpen:
+		if left := b.settings.Cooldown - now.Sub(br.openedAt); left > 0 {
+			br.shed++
+			return false, left
+		}
+		br.state = breakerHalfOpen
+		fallthrough
+	case breakerHalfOpen:
+		if br.probing {
+			br.shed++
+			return false, time.Second
+		}
+		br.probing = true
+		return true, 0
+	}
+	return false, 0
+}
+
+func (b *Breakers) record(name string, probe, failed bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br := b.breakers[name]
+
+	if probe {
+		br.probing = false
+		if failed {
+			br.state, br.openedAt = breakerOpen, now
+			return
+		}
+		br.state = breakerClosed
+		clear(br.seconds)
+	}
+	if br.state != breakerClosed {
+		// Requests let in before the breaker opened
+		return
+	}
+
+	second := now.Unix()
+	bucket := &br.seconds[second%int64(len(br.seconds))]
+	if bucket.second != second {
+		*bucket = breakerBucket{second: second}
+	}
+	bucket.requests++
+	if failed {
+		bucket.failures++
+	}
+
+	requests, failures := br.window(second)
+	if requests >= int64(b.settings.MinRequests) && failures > 0 && float64(failures) >= b.settings.ErrorRate*float64(requests) {
+		br.state, br.openedAt = breakerOpen, now
+		br.trips++
+	}
+}
+
+// abandon forgets a request the client cancelled, letting another probe
+// through if it was the probe
+func (b *Breakers) abandon(name string, probe bool) {
+	if !probe {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.breakers[name].probing = false
+}
+
+// window sums the buckets within the window ending at second
+func (br *breaker) window(second int64) (requests, failures int64) {
+	for _, bucket := range br.seconds {
+		if second-bucket.second < int64(len(br.seconds)) {
+			requests += bucket.requests
+			failures += bucket.failures
+		}
+	}
+	return requests, failures
+}
+
+// Stats reports every breaker, for the admin overview
+func (b *Breakers) Stats() map[string]models.BreakerStatus {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := make(map[string]models.BreakerStatus, len(b.breakers))
+	for name, br := range b.breakers {
+		s := models.BreakerStatus{State: br.state, Trips: br.trips, Shed: br.shed}
+		if b.settings.MinRequests <= 0 {
+			s.State = "disabled"
+		}
+		s.Requests, s.Failures = br.window(now.Unix())
+		if s.Requests > 0 {
+			s.ErrorRate = float64(s.Failures) / float64(s.Requests)
+		}
+		if br.state != breakerClosed {
+			openedAt := br.openedAt.UTC()
+			s.OpenedAt = &openedAt
+		}
+		stats[name] = s
+	}
+	return stats
+}
+
+// firstByteWriter records the response status and when the response
+// started, so streaming responses are timed by how long they took to begin
+type firstByteWriter struct {
+	http.ResponseWriter
+	status  int
+	started time.Time
+}
+
+func (w *firstByteWriter) WriteHeader(status int) {
+	if w.started.IsZero() {
+		w.status, w.started = status, time.Now()
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *firstByteWriter) Write(b []byte) (int, error) {
+	if w.started.IsZero() {
+		w.started = time.Now()
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach Flush etc. on the real writer
+func (w *firstByteWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
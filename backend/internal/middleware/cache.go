@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// Route classes with a Cache-Control policy each (CACHE_POLICIES)
+const (
+	CacheStats   = "stats"   // archive statistics
+	CacheLists   = "lists"   // listings of documents, images, datasets and face clusters
+	CacheRecords = "records" // one document, image, dataset or face cluster
+	CacheSearch  = "search"
+	CacheFiles   = "files"   // PDFs, images, sprites and blobs
+	CacheExports = "exports" // Parquet exports, snapshot, manifest, report and change feed
+	CacheAdmin   = "admin"
+	CachePrivate = "private" // sign-in, contributions, API key usage and export downloads
+)
+
+// CachePolicies are the Cache-Control values of the route classes. Set
+// replaces them while serving, when the configuration is reloaded.
+type CachePolicies struct {
+	current atomic.Pointer[map[string]string]
+}
+
+func NewCachePolicies(policies map[string]string) *CachePolicies {
+	c := &CachePolicies{}
+	c.Set(policies)
+	return c
+}
+
+// Set replaces the policies for requests from now on
+func (c *CachePolicies) Set(policies map[string]string) {
+	c.current.Store(&policies)
+}
+
+// Class gives the responses of class's routes its Cache-Control, unless the
+// handler sets its own; an empty policy leaves it to the handler. Errors
+// are never stored. A request with an API key or admin token gets a private
+// copy of a policy that lets shared caches store the response, and shared
+// responses vary on Authorization, so a CDN keeps the two apart.
+func (c *CachePolicies) Class(class string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			policy := (*c.current.Load())[class]
+			if policy == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			shared := shareable(policy)
+			if shared && r.Header.Get("Authorization") != "" {
+				policy, shared = privateCopy(policy), false
+			}
+			next.ServeHTTP(&cacheWriter{ResponseWriter: w, policy: policy, shared: shared}, r)
+		})
+	}
+}
+
+// directives splits a Cache-Control value, with each directive's name
+// lowercased
+func directives(policy string) (names, values []string) {
+	for _, d := range strings.Split(policy, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			name, _, _ := strings.Cut(d, "=")
+			names = append(names, strings.ToLower(name))
+			values = append(values, d)
+		}
+	}
+	return names, values
+}
+
+// shareable reports whether policy lets shared caches store responses
+func shareable(policy string) bool {
+	names, _ := directives(policy)
+	for _, name := range names {
+		if name == "public" || name == "s-maxage" {
+			return true
+		}
+	}
+	return false
+}
+
+// privateCopy drops the directives meant for shared caches from policy
+func privateCopy(policy string) string {
+	kept := []string{"private"}
+	names, values := directives(policy)
+	for i, name := range names {
+		switch name {
+		case "public", "private", "s-maxage", "proxy-revalidate":
+		default:
+			kept = append(kept, values[i])
+		}
+	}
+	return strings.Join(kept, ", ")
+}
+
+// cacheWriter sets Cache-Control as the response starts
+type cacheWriter struct {
+	http.ResponseWriter
+	policy string
+	shared bool
+	wrote  bool
+}
+
+func (w *cacheWriter) WriteHeader(status int) {
+	if !w.wrote {
+		w.wrote = true
+		h := w.Header()
+		if h.Get("Cache-Control") == "" {
+			if status >= 400 {
+				h.Set("Cache-Control", "no-store")
+			} else {
+				h.Set("Cache-Control", w.policy)
+			}
+		}
+		if w.shared {
+			h.Add("Vary", "Authorization")
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cacheWriter) Write(b []byte) (int, error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach Flush etc. on the real writer
+func (w *cacheWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,195 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// Casing rewrites the keys of JSON responses from snake_case to camelCase
+// for clients that ask with ?case=camel or "Accept: application/json;
+// case=camel". Handlers keep writing snake_case; other responses (files,
+// Parquet, images) pass through untouched.
+func Casing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		if !wantsCamel(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &camelWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+		cw.finish()
+	})
+}
+
+func wantsCamel(r *http.Request) bool {
+	if c := r.URL.Query().Get("case"); c != "" {
+		return c == "camel"
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if _, params, err := mime.ParseMediaType(accept); err == nil && params["case"] == "camel" {
+			return true
+		}
+	}
+	return false
+}
+
+// camelWriter holds back JSON bodies until the handler is done, since keys
+// can only be rewritten once the whole document is there
+type camelWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	buffering   bool
+	buf         bytes.Buffer
+}
+
+func (w *camelWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+
+	mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if mediaType == "application/json" {
+		w.buffering = true
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *camelWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.buffering {
+		return w.buf.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the real writer
+func (w *camelWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish sends the buffered body with its keys converted, or as written if
+// it isn't valid JSON after all
+func (w *camelWriter) finish() {
+	if !w.buffering {
+		return
+	}
+
+	body := w.buf.Bytes()
+	var out bytes.Buffer
+	if err := camelKeys(&out, body); err == nil {
+		body = out.Bytes()
+	}
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(body)
+}
+
+// camelKeys copies the JSON value in src to dst token by token, so key
+// order and numbers stay exactly as the handler wrote them
+func camelKeys(dst *bytes.Buffer, src []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(src))
+	dec.UseNumber()
+
+	// Open objects and arrays, with the tokens written in each so far; in
+	// an object, even ones are keys
+	type level struct {
+		object bool
+		n      int
+	}
+	var stack []level
+
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			dst.WriteByte('\n')
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if d, ok := tok.(json.Delim); ok && (d == '}' || d == ']') {
+			stack = stack[:len(stack)-1]
+			dst.WriteByte(byte(d))
+			continue
+		}
+
+		isKey := false
+		if n := len(stack); n > 0 {
+			top := &stack[n-1]
+			isKey = top.object && top.n%2 == 0
+			switch {
+			case top.n == 0:
+			case top.object && !isKey:
+				dst.WriteByte(':')
+			default:
+				dst.WriteByte(',')
+			}
+			top.n++
+		}
+
+		switch t := tok.(type) {
+		case json.Delim:
+			dst.WriteByte(byte(t))
+			stack = append(stack, level{object: t == '{'})
+		case string:
+			if isKey {
+				t = camelCase(t)
+			}
+			b, _ := json.Marshal(t)
+			dst.Write(b)
+		case json.Number:
+			dst.WriteString(t.String())
+		case bool:
+			if t {
+				dst.WriteString("true")
+			} else {
+				dst.WriteString("false")
+			}
+		case nil:
+			dst.WriteString("null")
+		}
+	}
+}
+
+// camelCase turns a snake_case key into camelCase. Keys that aren't plain
+// lower-case snake_case, such as EXIF tag names, are left alone.
+func camelCase(key string) string {
+	if !strings.Contains(key, "_") || strings.HasPrefix(key, "_") || strings.HasSuffix(key, "_") {
+		return key
+	}
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_') {
+			return key
+		}
+	}
+
+	var b strings.Builder
+	upper := false
+	for _, c := range key {
+		switch {
+		case c == '_':
+			upper = true
+		case upper:
+			b.WriteRune(unicode.ToUpper(c))
+			upper = false
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
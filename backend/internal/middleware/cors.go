@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// CORSPolicy describes which browser origins may call a set of routes
+type CORSPolicy struct {
+	// Exact origins ("https://example.org"), wildcard subdomains
+	// ("https://*.example.org") or "*" for any origin
+	AllowedOrigins   []string
+	AllowCredentials bool
+	AllowMethods     []string
+}
+
+// CORS applies the global policy to every route except those under a prefix
+// in overrides, which get their own policy (longest prefix wins).
+func CORS(global CORSPolicy, overrides map[string]CORSPolicy) Middleware {
+	return NewCORSRules(global, overrides).Middleware()
+}
+
+// CORSRules are the policies a CORS middleware applies. Set replaces them
+// while serving, when the configuration is reloaded.
+type CORSRules struct {
+	current atomic.Pointer[corsRoutes]
+}
+
+// corsRoutes are override policies by prefix, longest first
+type corsRoutes struct {
+	global    CORSPolicy
+	overrides []corsRoute
+}
+
+type corsRoute struct {
+	prefix string
+	policy CORSPolicy
+}
+
+func NewCORSRules(global CORSPolicy, overrides map[string]CORSPolicy) *CORSRules {
+	c := &CORSRules{}
+	c.Set(global, overrides)
+	return c
+}
+
+// Set replaces the policies for requests from now on
+func (c *CORSRules) Set(global CORSPolicy, overrides map[string]CORSPolicy) {
+	routes := &corsRoutes{global: global}
+	for prefix, policy := range overrides {
+		routes.overrides = append(routes.overrides, corsRoute{prefix: prefix, policy: policy})
+	}
+	sort.Slice(routes.overrides, func(i, j int) bool {
+		return len(routes.overrides[i].prefix) > len(routes.overrides[j].prefix)
+	})
+	c.current.Store(routes)
+}
+
+func (c *CORSRules) policyFor(path string) CORSPolicy {
+	routes := c.current.Load()
+	for _, r := range routes.overrides {
+		if strings.HasPrefix(path, r.prefix) {
+			return r.policy
+		}
+	}
+	return routes.global
+}
+
+// Middleware applies the current policies
+func (c *CORSRules) Middleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			p := c.policyFor(r.URL.Path)
+			if !originAllowed(p.AllowedOrigins, origin) {
+				writeError(w, http.StatusForbidden, "Origin not allowed")
+				return
+			}
+
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			h.Set("Access-Control-Allow-Origin", origin)
+			// Never for "*": any site could then act as the signed-in user
+			if p.AllowCredentials && originListed(p.AllowedOrigins, origin) {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			// Answer preflight requests without reaching the routes
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				methods := p.AllowMethods
+				if len(methods) == 0 {
+					methods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+				}
+				h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+				if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+					h.Set("Access-Control-Allow-Headers", headers)
+				}
+				h.Set("Access-Control-Max-Age", "43200")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			h.Set("Access-Control-Expose-Headers", "Content-Length")
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func originAllowed(patterns []string, origin string) bool {
+	for _, pattern := range patterns {
+		if matchOrigin(pattern, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// originListed is originAllowed without "*", for the origins that may send
+// credentials
+func originListed(patterns []string, origin string) bool {
+	for _, pattern := range patterns {
+		if pattern != "*" && matchOrigin(pattern, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOrigin compares an Origin header against a configured pattern. A "*"
+// in the host matches one or more subdomain labels, never the bare domain:
+// "https://*.example.org" allows "https://a.b.example.org" but not
+// "https://example.org" or "https://evil-example.org".
+func matchOrigin(pattern, origin string) bool {
+	if pattern == "*" {
+		return true
+	}
+	if !strings.Contains(pattern, "*") {
+		return strings.EqualFold(pattern, origin)
+	}
+
+	p, err := url.Parse(strings.Replace(pattern, "*", "wildcard", 1))
+	if err != nil {
+		return false
+	}
+	o, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if !strings.EqualFold(p.Scheme, o.Scheme) || p.Port() != o.Port() {
+		return false
+	}
+
+	suffix := strings.TrimPrefix(p.Hostname(), "wildcard")
+	host := strings.ToLower(o.Hostname())
+	return strings.HasSuffix(host, strings.ToLower(suffix)) && len(host) > len(suffix)
+}
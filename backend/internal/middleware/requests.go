@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/epstein-files/backend/internal/models"
+)
+
+// recentMinutes is the window of RequestStats.Recent
+const recentMinutes = 15
+
+// RequestCounter counts responses by status class for the admin overview,
+// in total and per minute over the last recentMinutes
+type RequestCounter struct {
+	mu      sync.Mutex
+	since   time.Time
+	total   requestBucket
+	minutes [recentMinutes]requestBucket
+}
+
+type requestBucket struct {
+	minute                     int64 // unix minute the bucket counts
+	total                      int64
+	clientErrors, serverErrors int64
+}
+
+func (b *requestBucket) add(status int) {
+	b.total++
+	switch {
+	case status >= 500:
+		b.serverErrors++
+	case status >= 400:
+		b.clientErrors++
+	}
+}
+
+func NewRequestCounter() *RequestCounter {
+	return &RequestCounter{since: time.Now().UTC()}
+}
+
+// Count records the status of every response. Put it outside Recovery so
+// panics count as server errors.
+func (c *RequestCounter) Count(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		c.record(sw.status, time.Now())
+	})
+}
+
+func (c *RequestCounter) record(status int, now time.Time) {
+	minute := now.Unix() / 60
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.total.add(status)
+	b := &c.minutes[minute%recentMinutes]
+	if b.minute != minute {
+		*b = requestBucket{minute: minute}
+	}
+	b.add(status)
+}
+
+// Stats returns the counts since startup, with the last recentMinutes in
+// Recent
+func (c *RequestCounter) Stats() models.RequestStats {
+	now := time.Now().UTC()
+	minute := now.Unix() / 60
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var recent requestBucket
+	for _, b := range c.minutes {
+		if minute-b.minute < recentMinutes {
+			recent.total += b.total
+			recent.clientErrors += b.clientErrors
+			recent.serverErrors += b.serverErrors
+		}
+	}
+
+	stats := c.total.stats(c.since)
+	window := recent.stats(time.Unix((minute-recentMinutes+1)*60, 0).UTC())
+	if window.Since.Before(c.since) {
+		window.Since = c.since
+	}
+	stats.Recent = &window
+	return stats
+}
+
+func (b requestBucket) stats(since time.Time) models.RequestStats {
+	s := models.RequestStats{
+		Since:        since,
+		Total:        b.total,
+		ClientErrors: b.clientErrors,
+		ServerErrors: b.serverErrors,
+	}
+	if b.total > 0 {
+		s.ErrorRate = float64(b.serverErrors) / float64(b.total)
+	}
+	return s
+}
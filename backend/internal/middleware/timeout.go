@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/epstein-files/backend/internal/database"
+)
+
+// busyRetryAfter is the Retry-After sent with a 503 for a busy database, in
+// seconds: about as long as an ingest batch holds the write lock
+const busyRetryAfter = 5
+
+// Timeout gives each request a deadline, which its database queries inherit
+// through the request context. A request that runs past it, or whose
+// queries find the database locked past busy_timeout, answers 503 with
+// Retry-After instead of its error, so readers back off while an ingest
+// holds the lock rather than pile up behind it. d <= 0 sets no deadline but
+// still turns lock errors into 503s.
+func Timeout(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if d > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, d)
+				defer cancel()
+			}
+			ctx, busy := database.TrackBusy(ctx)
+			next.ServeHTTP(&busyWriter{ResponseWriter: w, ctx: ctx, busy: busy}, r.WithContext(ctx))
+		})
+	}
+}
+
+// busyWriter replaces a server error caused by a busy database with a 503
+type busyWriter struct {
+	http.ResponseWriter
+	ctx      context.Context
+	busy     *atomic.Bool
+	replaced bool
+}
+
+func (w *busyWriter) WriteHeader(status int) {
+	if status >= 500 && (w.busy.Load() || errors.Is(w.ctx.Err(), context.DeadlineExceeded)) {
+		w.replaced = true
+		w.Header().Set("Retry-After", strconv.Itoa(busyRetryAfter))
+		writeError(w.ResponseWriter, http.StatusServiceUnavailable, "Database busy, retry shortly")
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write drops the body of a replaced response
+func (w *busyWriter) Write(b []byte) (int, error) {
+	if w.replaced {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach Flush etc. on the real writer
+func (w *busyWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,204 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/repository"
+	"github.com/epstein-files/backend/internal/telemetry"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// cursorKey stores how far this mirror has replayed the primary's change log
+const cursorKey = "sync.cursor"
+
+const pageSize = 500
+
+// ErrIncompatible is returned when the primary writes a different schema
+// version than this mirror; nothing is applied until both match
+var ErrIncompatible = errors.New("primary schema version is incompatible")
+
+// Client keeps a secondary instance up to date by tailing the primary's
+// authenticated change feed (GET /api/sync/changes) and replaying each
+// change into the local database.
+type Client struct {
+	repo     *repository.Repository
+	primary  string
+	token    string
+	interval time.Duration
+	http     *http.Client
+}
+
+func NewClient(repo *repository.Repository, primaryURL, token string, interval time.Duration) *Client {
+	return &Client{
+		repo:     repo,
+		primary:  strings.TrimSuffix(primaryURL, "/"),
+		token:    token,
+		interval: interval,
+		http: &http.Client{
+			Timeout:   60 * time.Second,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+	}
+}
+
+// Run syncs until ctx is cancelled, sleeping for the interval once caught up
+func (c *Client) Run(ctx context.Context) {
+	for {
+		applied, err := c.SyncOnce(ctx)
+		if err != nil {
+			log.Printf("Sync from %s failed: %v", c.primary, err)
+		} else if applied > 0 {
+			log.Printf("Synced %d changes from %s", applied, c.primary)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.interval):
+		}
+	}
+}
+
+// SyncOnce pulls and applies changes until the feed is drained, saving the
+// cursor after every page so an interrupted sync resumes where it stopped
+func (c *Client) SyncOnce(ctx context.Context) (int, error) {
+	ctx, span := telemetry.Start(ctx, "mirror.SyncOnce")
+	defer span.End()
+	repo := c.repo.WithContext(ctx)
+
+	if err := c.checkVersion(ctx); err != nil {
+		return 0, err
+	}
+
+	cursor, err := repo.GetMeta(cursorKey)
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for {
+		page, err := c.fetch(ctx, cursor)
+		if err != nil {
+			return applied, err
+		}
+
+		for _, change := range page.Data {
+			err := repo.ApplyChange(change.Entity, change.Op, change.EntityID, normalizeRow(change.Data))
+			if errors.Is(err, repository.ErrLegalHold) {
+				// This mirror preserves everything; keep the row and move on
+				log.Printf("Kept %s/%s under legal hold (change %d deletes it)", change.Entity, change.EntityID, change.ID)
+				err = nil
+			}
+			if err != nil {
+				return applied, fmt.Errorf("apply change %d (%s %s/%s): %w",
+					change.ID, change.Op, change.Entity, change.EntityID, err)
+			}
+			applied++
+		}
+
+		if page.NextCursor != "" && page.NextCursor != cursor {
+			cursor = page.NextCursor
+			if err := repo.SetMeta(cursorKey, cursor); err != nil {
+				return applied, err
+			}
+		}
+		if !page.HasMore {
+			return applied, nil
+		}
+	}
+}
+
+// checkVersion asks the primary for its schema version. Rows from another
+// version may name columns this database lacks or has dropped.
+func (c *Client) checkVersion(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.primary+"/api/version", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: primary predates /api/version, upgrade it", ErrIncompatible)
+	default:
+		return fmt.Errorf("primary returned %s for /api/version", resp.Status)
+	}
+
+	var v models.Version
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return err
+	}
+	if v.SchemaVersion != models.SchemaVersion {
+		return fmt.Errorf("%w: primary %s writes schema %d, this mirror %d",
+			ErrIncompatible, v.Version, v.SchemaVersion, models.SchemaVersion)
+	}
+	return nil
+}
+
+type changePage struct {
+	Data       []models.SyncChange `json:"data"`
+	NextCursor string              `json:"next_cursor"`
+	HasMore    bool                `json:"has_more"`
+}
+
+func (c *Client) fetch(ctx context.Context, cursor string) (*changePage, error) {
+	q := url.Values{"limit": {fmt.Sprint(pageSize)}}
+	if cursor != "" {
+		q.Set("cursor", cursor)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.primary+"/api/sync/changes?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("primary returned %s", resp.Status)
+	}
+
+	// Keep numbers exact; IDs and sizes must not round-trip through float64
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	var page changePage
+	if err := dec.Decode(&page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// normalizeRow converts JSON numbers into values the SQLite driver accepts
+func normalizeRow(row map[string]interface{}) map[string]interface{} {
+	for col, val := range row {
+		n, ok := val.(json.Number)
+		if !ok {
+			continue
+		}
+		if i, err := n.Int64(); err == nil {
+			row[col] = i
+		} else if f, err := n.Float64(); err == nil {
+			row[col] = f
+		}
+	}
+	return row
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Audit actions
+const (
+	AuditReingest      = "document.reingest"
+	AuditDatasetDelete = "dataset.delete"
+)
+
+// AuditEntry records an admin action that changed archive data outside the
+// regular ingest, e.g. a single document re-ingest
+type AuditEntry struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Action     string    `gorm:"size:50;not null;index" json:"action"`
+	Target     string    `gorm:"size:100;index" json:"target"` // e.g. the document ID
+	Details    JSON      `gorm:"type:json" json:"details,omitempty"`
+	Actor      string    `gorm:"size:255" json:"actor,omitempty"` // "admin-token", or the signed-in user
+	RemoteAddr string    `gorm:"size:100" json:"remote_addr,omitempty"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (AuditEntry) TableName() string { return "audit_log" }
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Kinds of file a blob is referenced as
+const (
+	BlobDocument = "document" // a source PDF; the owner is the document ID
+	BlobImage    = "image"    // an extracted image; the owner is the image ID
+)
+
+// Blob is a file in the content-addressed store, kept under its SHA-256 in
+// "blobs/ab/cd/<sha256>" however many documents or images share it. RefCount
+// counts its BlobRefs; a blob nothing refers to any more is deleted by the
+// next garbage collection.
+type Blob struct {
+	SHA256      string    `gorm:"primaryKey;size:64;column:sha256" json:"sha256"`
+	Size        int64     `gorm:"not null" json:"size"`
+	ContentType string    `gorm:"size:100" json:"content_type"`
+	RefCount    int64     `gorm:"not null;default:0;index" json:"ref_count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// BlobRef is one file's use of a blob: a document's PDF or an image
+type BlobRef struct {
+	Kind   string `gorm:"primaryKey;size:20" json:"kind"`
+	Owner  string `gorm:"primaryKey;size:50" json:"owner"`
+	SHA256 string `gorm:"size:64;column:sha256;index;not null" json:"sha256"`
+}
+
+// BlobCandidate is a document or image the blob import looks at
+type BlobCandidate struct {
+	RowID      uint
+	Owner      string
+	DocumentID string // images only
+	Filename   string
+	SHA256     string // as recorded at ingest; may be empty
+}
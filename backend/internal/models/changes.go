@@ -0,0 +1,118 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Change operations recorded in the change log
+const (
+	ChangeCreate = "create"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+// Change is one row-level event in the change log. Rows are written by
+// SQLite triggers, so ingest scripts that bypass the API are captured too.
+type Change struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Entity    string    `gorm:"size:50;not null;index" json:"entity"` // table name
+	EntityID  string    `gorm:"size:100;not null" json:"entity_id"`
+	Op        string    `gorm:"size:10;not null" json:"op"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// Meta is a small key/value store for instance state (sync cursors etc.)
+type Meta struct {
+	Key       string    `gorm:"primaryKey;size:100" json:"key"`
+	Value     string    `gorm:"type:text" json:"value"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName keeps the table name singular; "metas" reads oddly
+func (Meta) TableName() string { return "meta" }
+
+// ChangeTables are the tables tracked by the change log, in the order a
+// consumer should apply an initial snapshot. They hold the archive's
+// content, whoever writes it; the legal hold covers the same tables. What
+// each instance derives or keeps for itself (text signatures, duplicate
+// clusters, storage tiers, jobs) isn't logged.
+var ChangeTables = []string{
+	"documents", "pages", "images", "document_tables", "document_sprites",
+	"image_tags", "face_clusters", "faces", "passages", "datasets", "dataset_files",
+}
+
+// MetaChangeTables lists, comma-separated, the tables whose rows were all
+// logged when their triggers were first installed
+const MetaChangeTables = "changes.tables"
+
+// migrateChangeLog installs the change triggers, again on each start since
+// a table rebuilt by AutoMigrate loses them. The first time a table is
+// tracked every existing row of it is logged as a create, so consumers
+// starting from the beginning of the feed see the whole archive, and those
+// already following it get the rows of a table tracked since.
+func migrateChangeLog(db *gorm.DB) error {
+	logged := map[string]bool{}
+	var meta Meta
+	if err := db.Where("key = ?", MetaChangeTables).Limit(1).Find(&meta).Error; err != nil {
+		return err
+	}
+	if meta.Value != "" {
+		for _, table := range strings.Split(meta.Value, ",") {
+			logged[table] = true
+		}
+	} else {
+		// Databases from before the list: the tables already in the log
+		var entities []string
+		if err := db.Model(&Change{}).Distinct().Pluck("entity", &entities).Error; err != nil {
+			return err
+		}
+		for _, table := range entities {
+			logged[table] = true
+		}
+	}
+
+	triggers := []struct{ event, op, row string }{
+		{"INSERT", ChangeCreate, "NEW"},
+		{"UPDATE", ChangeUpdate, "NEW"},
+		{"DELETE", ChangeDelete, "OLD"},
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range ChangeTables {
+			for _, t := range triggers {
+				err := tx.Exec(fmt.Sprintf(`
+					CREATE TRIGGER IF NOT EXISTS changes_%[1]s_%[2]s AFTER %[3]s ON %[1]s
+					BEGIN
+						INSERT INTO changes (entity, entity_id, op, created_at)
+						VALUES ('%[1]s', %[4]s.id, '%[2]s', CURRENT_TIMESTAMP);
+					END
+				`, table, t.op, t.event, t.row)).Error
+				if err != nil {
+					return err
+				}
+			}
+
+			if logged[table] {
+				continue
+			}
+			err := tx.Exec(fmt.Sprintf(`
+				INSERT INTO changes (entity, entity_id, op, created_at)
+				SELECT '%[1]s', id, '%[2]s', CURRENT_TIMESTAMP FROM %[1]s ORDER BY id
+			`, table, ChangeCreate)).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Save(&Meta{Key: MetaChangeTables, Value: strings.Join(ChangeTables, ",")}).Error
+	})
+}
+
+// SyncChange is a change log entry with the row's current values, as served
+// to mirrors. Data is omitted for deletes and for rows deleted since.
+type SyncChange struct {
+	Change
+	Data map[string]interface{} `json:"data,omitempty"`
+}
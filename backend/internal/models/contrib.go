@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Contribution statuses
+const (
+	ContribPending  = "pending"
+	ContribApproved = "approved"
+	ContribRejected = "rejected"
+)
+
+// Contribution is a document uploaded by a trusted contributor. It waits in
+// the moderation queue until an admin approves it for ingestion or rejects it.
+type Contribution struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	Status      string `gorm:"size:20;not null;index" json:"status"`
+	Contributor string `gorm:"size:100;not null;index" json:"contributor"`
+	Filename    string `gorm:"size:255;not null" json:"filename"` // as uploaded
+	StorageKey  string `gorm:"size:255;not null" json:"-"`
+	SizeBytes   int64  `gorm:"default:0" json:"size_bytes"`
+	SHA256      string `gorm:"size:64;uniqueIndex;column:sha256" json:"sha256"`
+	ScanResult  string `gorm:"size:255" json:"scan_result,omitempty"`
+
+	// Provenance supplied by the contributor
+	Title       string     `gorm:"size:255" json:"title,omitempty"`
+	SourceURL   string     `gorm:"size:500" json:"source_url,omitempty"`
+	RetrievedAt *time.Time `json:"retrieved_at,omitempty"`
+	Notes       string     `gorm:"type:text" json:"notes,omitempty"`
+
+	// Moderation
+	ReviewNote string     `gorm:"type:text" json:"review_note,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	DocumentID string     `gorm:"size:50" json:"document_id,omitempty"` // set on approval
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// Dataset is one DOJ release ("DataSet 9"), keyed by its number. Its
+// official README, index and cover letter files are ingested by
+// scripts/ingest_datasets.py.
+type Dataset struct {
+	ID         uint       `gorm:"primaryKey;autoIncrement:false" json:"id"`
+	Name       string     `gorm:"size:255" json:"name"`
+	SourceURL  string     `gorm:"size:500" json:"source_url,omitempty"` // release folder on justice.gov
+	ReleasedAt *time.Time `json:"released_at,omitempty"`
+	Notes      string     `gorm:"type:text" json:"notes,omitempty"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+
+	// Documents whose source URL lies in this release
+	DocumentCount int64 `gorm:"-" json:"document_count"`
+
+	// Relations
+	Files []DatasetFile `gorm:"foreignKey:DatasetID" json:"files,omitempty"`
+}
+
+// Kinds of dataset metadata files
+const (
+	DatasetFileReadme      = "readme"
+	DatasetFileIndex       = "index"
+	DatasetFileCoverLetter = "cover_letter"
+	DatasetFileManifest    = "manifest"
+	DatasetFileOther       = "other"
+)
+
+// DatasetFile is a file shipped alongside a release rather than part of
+// it, kept verbatim with its hash and extracted text
+type DatasetFile struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	DatasetID   uint      `gorm:"not null;uniqueIndex:idx_dataset_file" json:"dataset_id"`
+	Filename    string    `gorm:"size:255;not null;uniqueIndex:idx_dataset_file" json:"filename"`
+	Kind        string    `gorm:"size:20;not null" json:"kind"`
+	SourceURL   string    `gorm:"size:500" json:"source_url,omitempty"`
+	ContentType string    `gorm:"size:100" json:"content_type,omitempty"`
+	SizeBytes   int64     `gorm:"default:0" json:"size_bytes"`
+	SHA256      string    `gorm:"size:64;column:sha256" json:"sha256"`
+	Text        string    `gorm:"type:text" json:"text,omitempty"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// DocumentSignature is the MinHash signature of a document's text, used to
+// find near-duplicates such as the same letter OCR'd from two scans
+type DocumentSignature struct {
+	DocumentID string    `gorm:"primaryKey;size:50"`
+	Signature  []byte    `gorm:"type:blob"` // little-endian uint32 minimums
+	Shingles   int       `gorm:"default:0"` // distinct word shingles in the text
+	UpdatedAt  time.Time `gorm:"autoUpdateTime"`
+}
+
+// DocumentCluster groups documents whose text is nearly identical. The
+// canonical document is the most complete copy. Clusters are rebuilt from
+// scratch by each clustering job, so IDs are not stable across runs.
+type DocumentCluster struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Size        int       `gorm:"default:0;index" json:"size"`
+	CanonicalID string    `gorm:"size:50" json:"canonical_id"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+
+	Members []DocumentClusterMember `gorm:"foreignKey:ClusterID" json:"members,omitempty"` // most similar first
+}
+
+// DocumentClusterMember places a document in a near-duplicate cluster
+type DocumentClusterMember struct {
+	DocumentID string  `gorm:"primaryKey;size:50" json:"document_id"`
+	ClusterID  uint    `gorm:"not null;index" json:"-"`
+	Similarity float64 `gorm:"default:0" json:"similarity"` // estimated Jaccard similarity to the canonical document
+
+	Document *Document `gorm:"foreignKey:DocumentID" json:"document,omitempty"`
+}
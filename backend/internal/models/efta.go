@@ -0,0 +1,56 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EFTA numbers are the Bates numbers stamped on the DOJ release: the
+// prefix and eight zero-padded digits, e.g. EFTA00010000. Document IDs use
+// the same form.
+const (
+	eftaPrefix = "EFTA"
+	eftaDigits = 8
+)
+
+// ParseEFTA returns the number of an EFTA identifier. The prefix is
+// case-insensitive and the digits need not be padded.
+func ParseEFTA(id string) (int, bool) {
+	if len(id) <= len(eftaPrefix) || !strings.EqualFold(id[:len(eftaPrefix)], eftaPrefix) {
+		return 0, false
+	}
+	digits := id[len(eftaPrefix):]
+	if len(digits) > eftaDigits {
+		return 0, false
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.Atoi(digits)
+	return n, err == nil
+}
+
+// EFTAID formats an EFTA number as a document ID
+func EFTAID(n int) string {
+	return fmt.Sprintf("%s%0*d", eftaPrefix, eftaDigits, n)
+}
+
+// DocumentRangeEntry is one EFTA number of a range; Document is nil when no
+// document has that number
+type DocumentRangeEntry struct {
+	ID       string    `json:"id"`
+	Present  bool      `json:"present"`
+	Document *Document `json:"document,omitempty"`
+}
+
+// DocumentRange lists every EFTA number from From to To, in numeric order
+type DocumentRange struct {
+	From    string               `json:"from"`
+	To      string               `json:"to"`
+	Present int                  `json:"present"`
+	Missing int                  `json:"missing"`
+	Entries []DocumentRangeEntry `json:"entries"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// ExportDownload is a file export built by a background job and fetched
+// with a signed download token. The file stays on disk until the token has
+// been used or has expired, so the download can be resumed with Range
+// requests rather than needing one connection to last the whole stream.
+// Downloads of the same kind and ingest version share one build: its job
+// and file.
+type ExportDownload struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	JobID         uint       `gorm:"index" json:"job_id"`
+	Kind          string     `gorm:"size:50;not null" json:"kind"` // e.g. "documents.parquet"
+	IngestVersion string     `gorm:"size:200" json:"-"`            // of the data the build was asked for
+	Path          string     `gorm:"size:500;index" json:"-"`
+	SizeBytes     int64      `json:"size_bytes"`
+	SHA256        string     `gorm:"size:64" json:"sha256,omitempty"`
+	ExpiresAt     time.Time  `gorm:"index" json:"expires_at"`
+	ConsumedAt    *time.Time `json:"consumed_at,omitempty"` // when the last byte was delivered
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Face is a face found in an image by scripts/cluster_faces.py. Faces are
+// only grouped into anonymous clusters of the same unidentified person; no
+// name or identity is ever attached, and the embedding never leaves the
+// server.
+type Face struct {
+	ID         uint    `gorm:"primaryKey" json:"id"`
+	ImageID    uint    `gorm:"not null;index" json:"image_id"`
+	DocumentID string  `gorm:"size:50;not null;index" json:"document_id"`
+	X          int     `gorm:"default:0" json:"x"` // bounding box in image pixels
+	Y          int     `gorm:"default:0" json:"y"`
+	Width      int     `gorm:"default:0" json:"width"`
+	Height     int     `gorm:"default:0" json:"height"`
+	Score      float64 `gorm:"default:0" json:"score"` // detector confidence
+	Embedding  []byte  `gorm:"type:blob" json:"-"`     // little-endian float32 vector
+	ClusterID  *uint   `gorm:"index" json:"cluster_id,omitempty"`
+	Provider   string  `gorm:"size:50" json:"-"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// FaceCluster groups faces whose embeddings are close enough to be the same
+// person. Clusters are rebuilt from scratch on every clustering run, so IDs
+// are not stable across runs.
+type FaceCluster struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	FaceCount     int       `gorm:"default:0;index" json:"face_count"`
+	ImageCount    int       `gorm:"default:0" json:"image_count"`
+	DocumentCount int       `gorm:"default:0" json:"document_count"`
+	CoverFaceID   uint      `json:"cover_face_id"` // most confident detection
+	CoverImageID  uint      `json:"cover_image_id"`
+	CreatedAt     time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
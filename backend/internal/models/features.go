@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// FeatureFlag overrides a flag's FEATURES / FEATURE_KEYS setting for one
+// archive; managed through /api/admin/features
+type FeatureFlag struct {
+	Name      string    `gorm:"primaryKey;size:50" json:"name"`
+	Enabled   bool      `gorm:"not null;default:false" json:"enabled"`
+	Keys      string    `gorm:"size:1000" json:"keys,omitempty"` // comma-separated API key names
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/epstein-files/backend/internal/buildinfo"
+)
+
+// Health statuses, from best to worst. An archive is down when its database
+// doesn't answer; anything else failing leaves it degraded.
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+)
+
+// Health is the /api/health payload. Its fields and status values are kept
+// stable for load balancers and deploy checks.
+type Health struct {
+	Status     string                 `json:"status"`
+	Service    string                 `json:"service"`
+	Archive    string                 `json:"archive"`
+	Build      buildinfo.Info         `json:"build"`
+	CheckedAt  time.Time              `json:"checked_at"`
+	Components map[string]HealthCheck `json:"components"` // db, fts, storage, cache, jobs
+	Features   map[string]bool        `json:"features"`
+}
+
+// HealthCheck is the outcome of checking one component
+type HealthCheck struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+	Detail    any     `json:"detail,omitempty"`
+}
+
+// Version is the /api/version payload: the build, the schema version this
+// backend writes and the one its database was last migrated to
+type Version struct {
+	buildinfo.Info
+	SchemaVersion         int `json:"schema_version"`
+	DatabaseSchemaVersion int `json:"database_schema_version"`
+}
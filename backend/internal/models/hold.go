@@ -0,0 +1,100 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RowVersion is the state of an archive row before it was changed under
+// legal hold. Replacing a row (INSERT OR REPLACE on re-ingest) counts as a
+// change too.
+type RowVersion struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Entity     string    `gorm:"size:50;not null;index:idx_row_versions_entity" json:"entity"`
+	EntityID   string    `gorm:"size:100;not null;index:idx_row_versions_entity" json:"entity_id"`
+	Data       JSON      `gorm:"type:json" json:"data"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+// LegalHoldError is the message the hold triggers abort with
+const LegalHoldError = "legal hold"
+
+// holdMatch finds the existing row an insert would replace: by primary key,
+// or by the table's unique key when it has one
+var holdMatch = map[string]string{
+	"pages":         "old_row.id = NEW.id OR (old_row.document_id = NEW.document_id AND old_row.number = NEW.number)",
+	"image_tags":    "old_row.id = NEW.id OR (old_row.image_id = NEW.image_id AND old_row.tag = NEW.tag)",
+	"dataset_files": "old_row.id = NEW.id OR (old_row.dataset_id = NEW.dataset_id AND old_row.filename = NEW.filename)",
+}
+
+// SetLegalHold installs or removes the legal hold triggers on the archive
+// tables. Under hold, deleting a row is refused and every update or
+// replacement first copies the old row into row_versions. The triggers are
+// rebuilt each start so they cover columns added by later migrations.
+func SetLegalHold(db *gorm.DB, on bool) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var existing []string
+		tx.Raw("SELECT name FROM sqlite_master WHERE type='trigger' AND name LIKE 'hold_%'").Scan(&existing)
+		for _, name := range existing {
+			if err := tx.Exec("DROP TRIGGER IF EXISTS " + name).Error; err != nil {
+				return err
+			}
+		}
+		if !on {
+			return nil
+		}
+
+		for _, table := range ChangeTables {
+			columns, err := tx.Migrator().ColumnTypes(table)
+			if err != nil {
+				return err
+			}
+			var pairs []string
+			for _, col := range columns {
+				// JSON can't hold a BLOB, such as an embedding
+				value := "old_row." + col.Name()
+				if strings.EqualFold(col.DatabaseTypeName(), "blob") {
+					value = "hex(" + value + ")"
+				}
+				pairs = append(pairs, fmt.Sprintf("'%s', %s", col.Name(), value))
+			}
+			snapshot := "json_object(" + strings.Join(pairs, ", ") + ")"
+
+			match := holdMatch[table]
+			if match == "" {
+				match = "old_row.id = NEW.id"
+			}
+
+			statements := []string{
+				fmt.Sprintf(`
+					CREATE TRIGGER hold_%[1]s_delete BEFORE DELETE ON %[1]s
+					BEGIN
+						SELECT RAISE(ABORT, '%[2]s: rows in %[1]s cannot be deleted');
+					END`, table, LegalHoldError),
+				fmt.Sprintf(`
+					CREATE TRIGGER hold_%[1]s_update BEFORE UPDATE ON %[1]s
+					BEGIN
+						INSERT INTO row_versions (entity, entity_id, data, replaced_at)
+						SELECT '%[1]s', old_row.id, %[2]s, CURRENT_TIMESTAMP
+						FROM %[1]s AS old_row WHERE old_row.id = OLD.id;
+					END`, table, snapshot),
+				fmt.Sprintf(`
+					CREATE TRIGGER hold_%[1]s_replace BEFORE INSERT ON %[1]s
+					BEGIN
+						INSERT INTO row_versions (entity, entity_id, data, replaced_at)
+						SELECT '%[1]s', old_row.id, %[2]s, CURRENT_TIMESTAMP
+						FROM %[1]s AS old_row WHERE %[3]s;
+					END`, table, snapshot, match),
+			}
+			for _, stmt := range statements {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// IngestLockName is the row an ingest holds while it writes
+const IngestLockName = "ingest"
+
+// IngestLock is the advisory lock scripts/ingest_lock.py takes for the
+// length of an ingest, so two runs can't interleave their writes. The
+// holder refreshes HeartbeatAt every minute; a lock whose heartbeat is
+// older than INGEST_LOCK_STALE_MINUTES was left by a run that died.
+type IngestLock struct {
+	Name        string    `gorm:"primaryKey;size:50" json:"name"`
+	Owner       string    `gorm:"size:255;not null" json:"owner"` // host:pid and command
+	AcquiredAt  time.Time `json:"acquired_at"`
+	HeartbeatAt time.Time `json:"heartbeat_at"`
+}
+
+// Stale reports whether the holder stopped refreshing the lock
+func (l *IngestLock) Stale(after time.Duration) bool {
+	return time.Since(l.HeartbeatAt) > after
+}
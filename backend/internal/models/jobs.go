@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Job statuses
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobDone      = "done"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Job is a unit of background work. Progress and the resume cursor are
+// saved as the job runs, so a job interrupted by a restart picks up where it
+// stopped instead of starting over. A running job belongs to the worker
+// that claimed it for as long as that worker keeps HeartbeatAt fresh.
+type Job struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	Type        string     `gorm:"size:50;not null;index" json:"type"`
+	Params      JSON       `gorm:"type:json" json:"params,omitempty"`
+	Status      string     `gorm:"size:20;not null;index" json:"status"`
+	Total       int64      `gorm:"default:0" json:"total"`
+	Processed   int64      `gorm:"default:0" json:"processed"`
+	Failed      int64      `gorm:"default:0" json:"failed"`
+	Cursor      uint       `gorm:"default:0" json:"cursor"` // last item ID completed
+	Error       string     `gorm:"type:text" json:"error,omitempty"`
+	Result      JSON       `gorm:"type:json" json:"result,omitempty"` // job-specific summary
+	Worker      string     `gorm:"size:255" json:"worker,omitempty"`  // WORKER_ID of the process running it
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	HeartbeatAt *time.Time `json:"heartbeat_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// JobWorker is a process running jobs, seen each time it looks for one.
+// With ROLE=api the API runs none itself and reports on these instead.
+type JobWorker struct {
+	ID        string    `gorm:"primaryKey;size:255" json:"id"` // WORKER_ID
+	StartedAt time.Time `json:"started_at"`
+	SeenAt    time.Time `json:"seen_at"`
+}
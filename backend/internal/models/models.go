@@ -4,6 +4,9 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -24,84 +27,495 @@ func (j *JSON) Scan(value interface{}) error {
 		*j = nil
 		return nil
 	}
-	bytes, ok := value.([]byte)
-	if !ok {
-		return errors.New("type assertion to []byte failed")
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, j)
+	case string:
+		return json.Unmarshal([]byte(v), j)
 	}
-	return json.Unmarshal(bytes, j)
+	return errors.New("type assertion to []byte failed")
 }
 
 // Document represents a PDF document
 type Document struct {
-	ID        string    `gorm:"primaryKey;size:50" json:"id"`
-	Filename  string    `gorm:"size:255;not null" json:"filename"`
-	PageCount int       `gorm:"default:0" json:"page_count"`
-	FullText  string    `gorm:"type:text" json:"-"` // Excluded from JSON, used for FTS
-	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	ID             string    `gorm:"primaryKey;size:50" json:"id"`
+	Filename       string    `gorm:"size:255;not null;index" json:"filename"`
+	PageCount      int       `gorm:"default:0" json:"page_count"`
+	BlankPageCount int       `gorm:"default:0" json:"blank_page_count"`
+	ImageCount     int       `gorm:"default:0" json:"image_count"`                  // extracted images, see the counts-backfill job
+	SizeBytes      int64     `gorm:"default:0" json:"size_bytes"`                   // Source PDF size
+	SHA256         string    `gorm:"size:64;column:sha256" json:"sha256,omitempty"` // Source PDF hash
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+
+	// Provenance, from the sidecar the downloader writes next to each PDF
+	SourceURL     string     `gorm:"size:500" json:"source_url,omitempty"`
+	RetrievedAt   *time.Time `json:"retrieved_at,omitempty"`
+	RetrievalTool string     `gorm:"size:100" json:"retrieval_tool,omitempty"`
+	WaybackURL    string     `gorm:"size:500" json:"wayback_url,omitempty"` // Internet Archive capture of SourceURL
+
+	// Last-Modified, ETag, Content-Length, ... as served with the original download
+	ResponseHeaders JSON `gorm:"type:json" json:"response_headers,omitempty"`
+
+	// Text statistics computed by populate_db.py, for skipping empty or
+	// garbled OCR
+	WordCount     int      `gorm:"default:0;index" json:"word_count"`
+	Language      string   `gorm:"size:10" json:"language,omitempty"` // ISO 639-1; empty when not recognised
+	AvgWordLength float64  `gorm:"default:0" json:"avg_word_length"`
+	ReadingEase   *float64 `json:"reading_ease,omitempty"` // Flesch reading ease; English text of 100+ words only
+
+	// Where the text came from, one of the TextSource constants; empty for
+	// no text or text extracted before OCR layers were detected
+	TextSource    string   `gorm:"size:10;index" json:"text_source,omitempty"`
+	OCRConfidence *float64 `gorm:"column:ocr_confidence" json:"ocr_confidence,omitempty"` // mean over OCR pages, 0-1
+
+	// Set on a single document: the source PDF's tier, see FileTier, and
+	// its content-addressed URL once it's in the blob store
+	StorageTier string `gorm:"-" json:"storage_tier,omitempty"`
+	BlobURL     string `gorm:"-" json:"blob_url,omitempty"`
+
+	// Set on search results collapsed to one document per near-duplicate cluster
+	DuplicateClusterID  uint `gorm:"-" json:"duplicate_cluster_id,omitempty"`
+	CollapsedDuplicates int  `gorm:"-" json:"collapsed_duplicates,omitempty"`
+
+	// Set on search results: images whose page matched, of which Images
+	// holds the first few unless expanded
+	MatchingImages int `gorm:"-" json:"matching_images,omitempty"`
 
 	// Relations
 	Images []Image `gorm:"foreignKey:DocumentID" json:"images,omitempty"`
 }
 
+// DocumentText is a document's full text, used for FTS. It is kept out of
+// documents so the megabytes of text in a huge PDF are only read on demand.
+type DocumentText struct {
+	DocumentID string    `gorm:"primaryKey;size:50" json:"document_id"`
+	Text       string    `gorm:"type:text" json:"text"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
 // Image represents an extracted image from a PDF
 type Image struct {
+	ID              uint    `gorm:"primaryKey" json:"id"`
+	DocumentID      string  `gorm:"size:50;index;index:idx_images_document_file;not null" json:"document_id"`
+	Page            int     `gorm:"not null" json:"page"`
+	Filename        string  `gorm:"size:255;index:idx_images_document_file" json:"filename"`
+	CDNUrl          string  `gorm:"size:500" json:"cdn_url"`
+	Width           int     `gorm:"default:0" json:"width"`
+	Height          int     `gorm:"default:0" json:"height"`
+	SizeBytes       int64   `gorm:"default:0;index" json:"size_bytes"`
+	Format          string  `gorm:"size:20;index" json:"format"`
+	SHA256          string  `gorm:"size:64;column:sha256" json:"sha256,omitempty"`
+	PHash           string  `gorm:"size:16;index;column:phash" json:"phash,omitempty"` // 64-bit perceptual hash, hex
+	Exif            JSON    `gorm:"type:json" json:"exif,omitempty"`
+	HasGPS          bool    `gorm:"default:false;index" json:"has_gps"`
+	DateTaken       string  `gorm:"size:50;index" json:"date_taken,omitempty"`
+	PageText        string  `gorm:"->;-:migration" json:"page_text,omitempty"` // Joined from pages
+	CorrectionAngle float64 `gorm:"->;-:migration" json:"correction_angle"`    // Joined from pages
+	Sharpness       float64 `gorm:"default:0" json:"sharpness"`
+	Brightness      float64 `gorm:"default:0" json:"brightness"`
+	Quality         float64 `gorm:"default:0;index" json:"quality"`
+	IsBlank         bool    `gorm:"default:false;index" json:"is_blank"`
+	// nil until the color stage has run
+	IsColor      *bool   `gorm:"index" json:"is_color,omitempty"`
+	Colorfulness float64 `gorm:"default:0" json:"colorfulness"`
+	Megapixels   float64 `gorm:"default:0;index" json:"megapixels"`
+	SizeClass    string  `gorm:"size:10;index" json:"size_class,omitempty"`  // see SizeClassFor
+	Orientation  string  `gorm:"size:10;index" json:"orientation,omitempty"` // see OrientationFor
+	// Safety classification; empty label means not yet classified
+	SafetyLabel    string    `gorm:"size:20;index" json:"safety_label,omitempty"`
+	SafetyScore    float64   `gorm:"default:0" json:"safety_score,omitempty"`
+	SafetyProvider string    `gorm:"size:50" json:"safety_provider,omitempty"`
+	Blurred        bool      `gorm:"-" json:"blurred,omitempty"`  // Set when safe mode replaced cdn_url
+	BlobURL        string    `gorm:"-" json:"blob_url,omitempty"` // Set once the file is in the blob store
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+
+	// Face detection: nil until cluster_faces.py has scanned the image
+	FaceCount *int   `gorm:"column:face_count" json:"-"`
+	Faces     []Face `gorm:"-" json:"faces,omitempty"` // set when listing a face cluster
+
+	// Object/scene tagging: nil until tag_images.py has labelled the image
+	TaggedAt *time.Time `json:"-"`
+
+	// Text in the picture itself (signs, papers held up, whiteboards), one
+	// line per line read; OCRAt is nil until ocr_images.py has read it
+	OCRText string     `gorm:"type:text;column:ocr_text" json:"ocr_text,omitempty"`
+	OCRAt   *time.Time `gorm:"column:ocr_at" json:"-"`
+
+	// Relations
+	Document *Document  `gorm:"foreignKey:DocumentID" json:"document,omitempty"`
+	Tags     []ImageTag `gorm:"foreignKey:ImageID" json:"tags,omitempty"` // most confident first
+}
+
+// DocumentImage is an image in its document's page-by-page listing, with the
+// images either side of it in that order, across page boundaries
+type DocumentImage struct {
+	Image
+	Position    int64 `json:"position"`      // 1-based, in page order
+	PrevImageID *uint `json:"prev_image_id"` // nil for the first image
+	NextImageID *uint `json:"next_image_id"` // nil for the last image
+}
+
+// Page is a single page of a document with its text in reading order
+type Page struct {
+	ID            uint     `gorm:"primaryKey" json:"id"`
+	DocumentID    string   `gorm:"size:50;not null;uniqueIndex:idx_pages_document_number" json:"document_id"`
+	Number        int      `gorm:"not null;uniqueIndex:idx_pages_document_number" json:"number"`
+	Text          string   `gorm:"type:text" json:"text"`
+	OCRConfidence *float64 `gorm:"column:ocr_confidence" json:"ocr_confidence"` // estimated; nil for native text layers
+	Width         float64  `gorm:"default:0" json:"width"`
+	Height        float64  `gorm:"default:0" json:"height"`
+	Rotation      int      `gorm:"default:0" json:"rotation"`
+	// Clockwise correction needed to display the page upright: a multiple of
+	// 90 for sideways scans plus a small deskew angle, both in degrees
+	CorrectionRotation int       `gorm:"default:0" json:"correction_rotation"`
+	SkewAngle          float64   `gorm:"default:0" json:"skew_angle"`
+	IsBlank            bool      `gorm:"default:false" json:"is_blank"`
+	CreatedAt          time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// Document text sources, as detected by extract_pdf_content.py
+const (
+	TextSourceNative = "native" // born-digital text layer
+	TextSourceOCR    = "ocr"    // OCR layer over scans on every page with text
+	TextSourceMixed  = "mixed"
+)
+
+// Safety labels assigned by the classification stage
+const (
+	SafetySafe      = "safe"
+	SafetySensitive = "sensitive"
+	SafetyExplicit  = "explicit"
+)
+
+// Image size classes by megapixels, smallest first. populate_db.py uses the
+// same thresholds.
+var SizeClasses = []struct {
+	Name          string
+	MaxMegapixels float64 // exclusive; 0 for the last class
+}{
+	{"tiny", 0.1},
+	{"small", 0.5},
+	{"medium", 2},
+	{"large", 8},
+	{"xlarge", 0},
+}
+
+// SizeClassFor buckets image dimensions into a size class
+func SizeClassFor(width, height int) string {
+	mp := float64(width) * float64(height) / 1e6
+	for _, c := range SizeClasses {
+		if c.MaxMegapixels == 0 || mp < c.MaxMegapixels {
+			return c.Name
+		}
+	}
+	return ""
+}
+
+// ValidSizeClass reports whether name is one of SizeClasses
+func ValidSizeClass(name string) bool {
+	for _, c := range SizeClasses {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Image orientations by aspect ratio
+const (
+	OrientationPortrait  = "portrait"
+	OrientationLandscape = "landscape"
+	OrientationSquare    = "square"
+)
+
+// OrientationFor gives the orientation of an image's dimensions, empty when
+// they are unknown. populate_db.py does the same.
+func OrientationFor(width, height int) string {
+	switch {
+	case width <= 0 || height <= 0:
+		return ""
+	case height > width:
+		return OrientationPortrait
+	case width > height:
+		return OrientationLandscape
+	}
+	return OrientationSquare
+}
+
+// ValidOrientation reports whether name is an orientation
+func ValidOrientation(name string) bool {
+	return name == OrientationPortrait || name == OrientationLandscape || name == OrientationSquare
+}
+
+// Image file size buckets, smallest first
+var SizeBuckets = []struct {
+	Name     string
+	MaxBytes int64 // exclusive; 0 for the last bucket
+}{
+	{"small", 100 << 10},
+	{"medium", 1 << 20},
+	{"large", 0},
+}
+
+// SizeBucketRange returns the file sizes of the named bucket, from up to but
+// excluding to (0 for no limit); ok is false for an unknown name
+func SizeBucketRange(name string) (from, to int64, ok bool) {
+	for _, b := range SizeBuckets {
+		if b.Name == name {
+			return from, b.MaxBytes, true
+		}
+		from = b.MaxBytes
+	}
+	return 0, 0, false
+}
+
+// imageFormats maps format filter values to the format names recorded at
+// extraction (Pillow's)
+var imageFormats = map[string]string{
+	"jpeg": "JPEG",
+	"jpg":  "JPEG",
+	"png":  "PNG",
+	"tiff": "TIFF",
+	"tif":  "TIFF",
+}
+
+// ImageFormat returns the recorded format name for a format filter value
+func ImageFormat(name string) (string, bool) {
+	format, ok := imageFormats[strings.ToLower(name)]
+	return format, ok
+}
+
+// IsFlagged reports whether the image was classified as unsafe to show unblurred
+func (i *Image) IsFlagged() bool {
+	return i.SafetyLabel == SafetySensitive || i.SafetyLabel == SafetyExplicit
+}
+
+// CorrectionAngle is the total clockwise rotation that displays the page upright
+func (p *Page) CorrectionAngle() float64 {
+	return float64(p.CorrectionRotation) + p.SkewAngle
+}
+
+// DocumentTable is a table detected on a document page, stored as CSV
+type DocumentTable struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	DocumentID  string    `gorm:"size:50;index;not null" json:"document_id"`
+	Page        int       `gorm:"not null" json:"page"`
+	TableIndex  int       `gorm:"not null" json:"table_index"`
+	RowCount    int       `gorm:"default:0" json:"row_count"`
+	ColumnCount int       `gorm:"default:0" json:"column_count"`
+	Extractor   string    `gorm:"size:50" json:"extractor"`
+	CSV         string    `gorm:"column:csv;type:text" json:"csv"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// DocumentSprite is one sprite sheet: a grid of page thumbnails in a single image
+type DocumentSprite struct {
 	ID         uint      `gorm:"primaryKey" json:"id"`
 	DocumentID string    `gorm:"size:50;index;not null" json:"document_id"`
-	Page       int       `gorm:"not null" json:"page"`
-	Filename   string    `gorm:"size:255" json:"filename"`
+	Sheet      int       `gorm:"not null" json:"sheet"`
 	CDNUrl     string    `gorm:"size:500" json:"cdn_url"`
-	Width      int       `gorm:"default:0" json:"width"`
-	Height     int       `gorm:"default:0" json:"height"`
-	SizeBytes  int64     `gorm:"default:0" json:"size_bytes"`
-	Format     string    `gorm:"size:20" json:"format"`
-	Exif       JSON      `gorm:"type:json" json:"exif,omitempty"`
-	HasGPS     bool      `gorm:"default:false;index" json:"has_gps"`
-	DateTaken  string    `gorm:"size:50;index" json:"date_taken,omitempty"`
-	PageText   string    `gorm:"type:text" json:"page_text,omitempty"`
+	TileWidth  int       `gorm:"default:0" json:"tile_width"`
+	TileHeight int       `gorm:"default:0" json:"tile_height"`
+	Columns    int       `gorm:"default:0" json:"columns"`
+	Rows       int       `gorm:"default:0" json:"rows"`
+	FirstPage  int       `gorm:"default:1" json:"first_page"`
+	PageCount  int       `gorm:"default:0" json:"page_count"`
 	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
 
-	// Relations
-	Document *Document `gorm:"foreignKey:DocumentID" json:"document,omitempty"`
+// SpriteTile locates a single page thumbnail within a sprite sheet
+type SpriteTile struct {
+	Page  int `json:"page"`
+	Sheet int `json:"sheet"`
+	X     int `json:"x"`
+	Y     int `json:"y"`
+}
+
+// SpriteResponse is the sprite sheets of a document plus per-page coordinates
+type SpriteResponse struct {
+	DocumentID string           `json:"document_id"`
+	TileWidth  int              `json:"tile_width"`
+	TileHeight int              `json:"tile_height"`
+	Sheets     []DocumentSprite `json:"sheets"`
+	Pages      []SpriteTile     `json:"pages"`
 }
 
 // Stats for the archive
 type Stats struct {
-	TotalDocuments  int64 `json:"total_documents"`
-	TotalImages     int64 `json:"total_images"`
-	ImagesWithGPS   int64 `json:"images_with_gps"`
-	ImagesWithDate  int64 `json:"images_with_date"`
-	TotalSizeBytes  int64 `json:"total_size_bytes"`
+	TotalDocuments int64 `json:"total_documents"`
+	TotalImages    int64 `json:"total_images"`
+	ImagesWithGPS  int64 `json:"images_with_gps"`
+	ImagesWithDate int64 `json:"images_with_date"`
+	TotalSizeBytes int64 `json:"total_size_bytes"`
+	BlankPages     int64 `json:"blank_pages"`
+}
+
+// GrowthBucket is what was ingested in one period, with running totals
+type GrowthBucket struct {
+	Period         string `json:"period"` // first day of the period, YYYY-MM-DD
+	Documents      int64  `json:"documents"`
+	Images         int64  `json:"images"`
+	DocumentBytes  int64  `json:"document_bytes"`
+	ImageBytes     int64  `json:"image_bytes"`
+	TotalDocuments int64  `json:"total_documents"`
+	TotalImages    int64  `json:"total_images"`
+	TotalBytes     int64  `json:"total_bytes"` // documents and images
+}
+
+// ImageFacets counts matching images per facet value
+type ImageFacets struct {
+	Total     int64            `json:"total"`
+	Color     map[string]int64 `json:"color"`      // color, grayscale, unknown
+	SizeClass map[string]int64 `json:"size_class"` // tiny ... xlarge, unknown
+	Tags      map[string]int64 `json:"tags"`       // most common tags only
+
+	Orientation map[string]int64 `json:"orientation"` // portrait, landscape, square, unknown
+	Format      map[string]int64 `json:"format"`      // lowercased: jpeg, png, tiff ...
+	SizeBucket  map[string]int64 `json:"size_bucket"` // small, medium, large
+}
+
+// FTSStatus describes the health of the full-text search index
+type FTSStatus struct {
+	Available         bool   `json:"available"`      // documents_fts exists
+	FTS5Available     bool   `json:"fts5_available"` // SQLite build supports FTS5
+	Module            string `json:"module,omitempty"`
+	Tokenizer         string `json:"tokenizer,omitempty"`
+	IndexedRows       int64  `json:"indexed_rows"`
+	Documents         int64  `json:"documents"`
+	DocumentsWithText int64  `json:"documents_with_text"`
+	InSync            bool   `json:"in_sync"` // every document with text is indexed once
+	LastRebuild       string `json:"last_rebuild,omitempty"`
+	LastOptimize      string `json:"last_optimize,omitempty"`
+
+	// Tokenizer the configuration asks for, and whether the index was built
+	// with a different one (rebuild to apply it)
+	ConfiguredTokenizer string `json:"configured_tokenizer,omitempty"`
+	TokenizerOutdated   bool   `json:"tokenizer_outdated"`
+}
+
+// FTSOptions configures how documents_fts splits text into terms. Changes
+// only apply once the index is rebuilt (populate_db.py rebuild-fts).
+type FTSOptions struct {
+	RemoveDiacritics int  // unicode61 remove_diacritics: 0 keeps accents, 1 or 2 folds them
+	Porter           bool // English stemming, so "flights" matches "flight"
+}
+
+// Tokenizer returns the FTS5 tokenize argument, e.g.
+// "porter unicode61 remove_diacritics 2"
+func (o FTSOptions) Tokenizer() string {
+	tokenizer := fmt.Sprintf("unicode61 remove_diacritics %d", o.RemoveDiacritics)
+	if o.Porter {
+		tokenizer = "porter " + tokenizer
+	}
+	return tokenizer
+}
+
+// fts4Tokenize returns the FTS4 tokenize option. FTS4 can't wrap unicode61
+// in porter, so stemming replaces diacritic folding there.
+func (o FTSOptions) fts4Tokenize() string {
+	if o.Porter {
+		return "tokenize=porter"
+	}
+	return fmt.Sprintf(`tokenize=unicode61 "remove_diacritics=%d"`, o.RemoveDiacritics)
 }
 
-// Pagination cursor
+// Pagination cursor. Before marks a prev_cursor, which pages back from
+// the row it names instead of forward.
 type Cursor struct {
 	LastID    uint   `json:"last_id,omitempty"`
 	LastValue string `json:"last_value,omitempty"`
+	Before    bool   `json:"before,omitempty"`
 }
 
 // Paginated response
 type PaginatedResponse struct {
 	Data       interface{} `json:"data"`
 	NextCursor string      `json:"next_cursor,omitempty"`
+	PrevCursor string      `json:"prev_cursor,omitempty"`
 	HasMore    bool        `json:"has_more"`
 	Total      int64       `json:"total,omitempty"`
+	Limit      int         `json:"limit,omitempty"`
+	Links      *PageLinks  `json:"links,omitempty"`
 }
 
-// Search result
+// PageLinks are absolute URLs of a page and its neighbours, with the
+// request's filters in canonical (sorted) order
+type PageLinks struct {
+	Self string `json:"self"`
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// Search result. Image hits are grouped under their documents.
 type SearchResult struct {
 	Documents []Document `json:"documents"`
-	Images    []Image    `json:"images"`
 	Query     string     `json:"query"`
 	Total     int64      `json:"total"`
 }
 
-// AutoMigrate runs database migrations
-func AutoMigrate(db *gorm.DB) error {
-	err := db.AutoMigrate(&Document{}, &Image{})
+// SchemaVersion is the version of the schema this backend migrates to,
+// recorded in meta under MetaSchemaVersion. Bump it when a change breaks
+// other writers (populate_db.py's SCHEMA_VERSION, mirrors of this archive);
+// added tables and columns alone don't need it. 2 moved document text into
+// document_texts.
+const SchemaVersion = 2
+
+const MetaSchemaVersion = "schema.version"
+
+// ErrSchemaTooNew is returned when the database was migrated by a newer
+// backend than this one
+var ErrSchemaTooNew = errors.New("database schema is newer than this backend")
+
+// StoredSchemaVersion reads the schema version recorded in the database: 0
+// for a new database or one migrated before versions were recorded
+func StoredSchemaVersion(db *gorm.DB) (int, error) {
+	if !db.Migrator().HasTable(&Meta{}) {
+		return 0, nil
+	}
+	var meta Meta
+	err := db.Where("key = ?", MetaSchemaVersion).Limit(1).Find(&meta).Error
+	if err != nil || meta.Value == "" {
+		return 0, err
+	}
+	return strconv.Atoi(meta.Value)
+}
+
+// AutoMigrate runs database migrations. fts configures the tokenizer of a
+// newly created full-text index.
+func AutoMigrate(db *gorm.DB, fts FTSOptions) error {
+	stored, err := StoredSchemaVersion(db)
 	if err != nil {
 		return err
 	}
+	if stored > SchemaVersion {
+		return fmt.Errorf("%w: version %d, this backend knows %d", ErrSchemaTooNew, stored, SchemaVersion)
+	}
+
+	err = db.AutoMigrate(&Document{}, &DocumentText{}, &Image{}, &Page{}, &DocumentTable{}, &DocumentSprite{}, &Change{}, &Meta{}, &Job{}, &Contribution{}, &RowVersion{}, &Face{}, &FaceCluster{}, &ImageTag{}, &DocumentSignature{}, &DocumentCluster{}, &DocumentClusterMember{}, &Dataset{}, &DatasetFile{}, &FeatureFlag{}, &IngestLock{}, &APIUsage{}, &ExportDownload{}, &AuditEntry{}, &FileTier{}, &JobWorker{}, &Session{}, &UsageStat{}, &Blob{}, &BlobRef{}, &Passage{})
+	if err != nil {
+		return err
+	}
+
+	if err := migrateImagePageText(db); err != nil {
+		return err
+	}
+
+	if err := migrateDocumentText(db); err != nil {
+		return err
+	}
+
+	if err := migrateChangeLog(db); err != nil {
+		return err
+	}
+
+	if err := migrateImageDimensions(db); err != nil {
+		return err
+	}
+
+	if err := migrateIngestTimes(db); err != nil {
+		return err
+	}
 
 	// Try to create FTS5 virtual table for full-text search
 	// FTS5 may not be available in all SQLite builds
@@ -113,7 +527,8 @@ func AutoMigrate(db *gorm.DB) error {
 		err = db.Exec(`
 			CREATE VIRTUAL TABLE IF NOT EXISTS documents_fts USING fts5(
 				document_id,
-				full_text
+				full_text,
+				tokenize = '` + fts.Tokenizer() + `'
 			)
 		`).Error
 
@@ -122,7 +537,8 @@ func AutoMigrate(db *gorm.DB) error {
 			err = db.Exec(`
 				CREATE VIRTUAL TABLE IF NOT EXISTS documents_fts USING fts4(
 					document_id,
-					full_text
+					full_text,
+					` + fts.fts4Tokenize() + `
 				)
 			`).Error
 
@@ -133,5 +549,94 @@ func AutoMigrate(db *gorm.DB) error {
 		}
 	}
 
-	return nil
+	return db.Save(&Meta{Key: MetaSchemaVersion, Value: strconv.Itoa(SchemaVersion)}).Error
+}
+
+// migrateImagePageText moves the legacy images.page_text column into pages,
+// one row per (document, page), then drops the column.
+func migrateImagePageText(db *gorm.DB) error {
+	if !db.Migrator().HasColumn("images", "page_text") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`
+			INSERT INTO pages (document_id, number, text, created_at)
+			SELECT document_id, page, MAX(page_text), CURRENT_TIMESTAMP
+			FROM images
+			WHERE page_text IS NOT NULL AND page_text != ''
+			  AND NOT EXISTS (
+				SELECT 1 FROM pages p WHERE p.document_id = images.document_id AND p.number = images.page
+			  )
+			GROUP BY document_id, page
+		`).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec("ALTER TABLE images DROP COLUMN page_text").Error
+	})
+}
+
+// migrateDocumentText moves the legacy documents.full_text column into
+// document_texts, then drops the column.
+func migrateDocumentText(db *gorm.DB) error {
+	if !db.Migrator().HasColumn("documents", "full_text") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`
+			INSERT OR IGNORE INTO document_texts (document_id, text, updated_at)
+			SELECT id, full_text, CURRENT_TIMESTAMP
+			FROM documents
+			WHERE full_text IS NOT NULL AND full_text != ''
+		`).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec("ALTER TABLE documents DROP COLUMN full_text").Error
+	})
+}
+
+// migrateIngestTimes dates rows that populate_db.py inserted without
+// created_at: documents by their last update and images by their document
+func migrateIngestTimes(db *gorm.DB) error {
+	err := db.Exec("UPDATE documents SET created_at = updated_at WHERE created_at IS NULL AND updated_at IS NOT NULL").Error
+	if err != nil {
+		return err
+	}
+	return db.Exec(`
+		UPDATE images
+		SET created_at = (SELECT documents.created_at FROM documents WHERE documents.id = images.document_id)
+		WHERE created_at IS NULL
+	`).Error
+}
+
+// migrateImageDimensions fills megapixels, size_class and orientation for
+// images ingested before they were recorded
+func migrateImageDimensions(db *gorm.DB) error {
+	var cases []string
+	for _, c := range SizeClasses {
+		if c.MaxMegapixels == 0 {
+			cases = append(cases, fmt.Sprintf("ELSE '%s'", c.Name))
+		} else {
+			cases = append(cases, fmt.Sprintf("WHEN width * height < %g THEN '%s'", c.MaxMegapixels*1e6, c.Name))
+		}
+	}
+
+	err := db.Exec(`
+		UPDATE images
+		SET megapixels = ROUND(width * height / 1000000.0, 2),
+		    size_class = CASE ` + strings.Join(cases, " ") + ` END
+		WHERE (size_class IS NULL OR size_class = '') AND width > 0 AND height > 0
+	`).Error
+	if err != nil {
+		return err
+	}
+
+	return db.Exec(`
+		UPDATE images
+		SET orientation = CASE WHEN height > width THEN ? WHEN width > height THEN ? ELSE ? END
+		WHERE (orientation IS NULL OR orientation = '') AND width > 0 AND height > 0
+	`, OrientationPortrait, OrientationLandscape, OrientationSquare).Error
 }
@@ -0,0 +1,86 @@
+package models
+
+import "time"
+
+// Overview is the operations dashboard payload: one snapshot of the
+// archive's queue, storage, caches, request errors and search index
+type Overview struct {
+	GeneratedAt  time.Time                `json:"generated_at"`
+	LastIngestAt string                   `json:"last_ingest_at,omitempty"` // latest documents.updated_at
+	Ingest       *IngestLock              `json:"ingest,omitempty"`         // the ingest running now
+	Jobs         JobQueueStats            `json:"jobs"`
+	Database     DatabaseStats            `json:"database"`
+	Storage      StorageUsage             `json:"storage"`
+	Caches       map[string]CacheStats    `json:"caches"`
+	Requests     RequestStats             `json:"requests"`
+	FTS          *FTSStatus               `json:"fts"`
+	Replica      *ReplicaStatus           `json:"replica,omitempty"`
+	Breakers     map[string]BreakerStatus `json:"breakers,omitempty"`
+}
+
+// JobQueueStats counts background jobs by state
+type JobQueueStats struct {
+	Queued       int64 `json:"queued"`
+	Running      int64 `json:"running"`
+	Failed24h    int64 `json:"failed_24h"` // jobs that failed in the last day
+	OldestQueued *Job  `json:"oldest_queued,omitempty"`
+}
+
+// DatabaseStats is the SQLite file size, from its page counts, plus the
+// write-ahead log on disk
+type DatabaseStats struct {
+	SizeBytes int64 `json:"size_bytes"`
+	FreeBytes int64 `json:"free_bytes"` // pages on the freelist, reclaimed by VACUUM
+	WALBytes  int64 `json:"wal_bytes"`
+}
+
+// StorageUsage sums the file sizes recorded for the archive's stored files
+type StorageUsage struct {
+	Documents         int64 `json:"documents"`
+	DocumentBytes     int64 `json:"document_bytes"`
+	Images            int64 `json:"images"`
+	ImageBytes        int64 `json:"image_bytes"`
+	DatasetFileBytes  int64 `json:"dataset_file_bytes"`
+	ContributionBytes int64 `json:"contribution_bytes"`
+	SnapshotBytes     int64 `json:"snapshot_bytes"`
+	TotalBytes        int64 `json:"total_bytes"`
+}
+
+// CacheStats counts lookups of one in-memory cache since startup
+type CacheStats struct {
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hit_rate"` // 0 before the first lookup
+}
+
+// RequestStats counts responses by status class, since startup and over
+// the recent window
+type RequestStats struct {
+	Since        time.Time     `json:"since"`
+	Total        int64         `json:"total"`
+	ClientErrors int64         `json:"client_errors"` // 4xx
+	ServerErrors int64         `json:"server_errors"` // 5xx
+	ErrorRate    float64       `json:"error_rate"`    // 5xx share of all responses
+	Recent       *RequestStats `json:"recent,omitempty"`
+}
+
+// ReplicaStatus describes the read replica answering public queries
+type ReplicaStatus struct {
+	Mode        string    `json:"mode"`              // memory or mmap
+	Version     string    `json:"version,omitempty"` // ingest version of the loaded copy (memory)
+	LoadedAt    time.Time `json:"loaded_at"`
+	LoadSeconds float64   `json:"load_seconds"`
+	Loads       int64     `json:"loads"`
+	LastError   string    `json:"last_error,omitempty"` // of the last failed refresh
+}
+
+// BreakerStatus describes a circuit breaker around an expensive endpoint
+type BreakerStatus struct {
+	State     string     `json:"state"`      // closed, open or half_open
+	Requests  int64      `json:"requests"`   // in the current window
+	Failures  int64      `json:"failures"`   // 5xx or slow, in the current window
+	ErrorRate float64    `json:"error_rate"` // failures share of requests
+	Trips     int64      `json:"trips"`      // times opened since start
+	OpenedAt  *time.Time `json:"opened_at,omitempty"`
+	Shed      int64      `json:"shed"` // requests refused since start
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Passage is a chunk of a page's text embedded by scripts/embed_passages.py
+// for semantic retrieval. Start and End are character (code point) offsets
+// into the page text, and Text is that slice of it.
+type Passage struct {
+	ID         uint      `gorm:"primaryKey" json:"-"`
+	DocumentID string    `gorm:"size:50;not null;index" json:"document_id"`
+	Page       int       `gorm:"not null" json:"page"`
+	Start      int       `gorm:"not null" json:"start"`
+	End        int       `gorm:"not null" json:"end"`
+	Text       string    `gorm:"type:text" json:"text"`
+	Embedding  []byte    `gorm:"type:blob" json:"-"` // little-endian float32 vector
+	Model      string    `gorm:"size:100;index" json:"-"`
+	Score      float64   `gorm:"-" json:"score"` // cosine similarity to the query
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"-"`
+}
+
+// PassageResults is the /api/search/passages payload
+type PassageResults struct {
+	Query    string    `json:"query"`
+	Model    string    `json:"model"`
+	Passages []Passage `json:"passages"` // best match first
+}
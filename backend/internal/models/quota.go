@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Quota periods
+const (
+	QuotaDay   = "day"
+	QuotaMonth = "month"
+)
+
+// APIUsage counts an API key's requests in one day or month (UTC). Start
+// names the period: "2006-01-02" for a day, "2006-01" for a month.
+type APIUsage struct {
+	Key       string    `gorm:"primaryKey;size:100" json:"key"`
+	Period    string    `gorm:"primaryKey;size:10" json:"period"`
+	Start     string    `gorm:"primaryKey;size:10" json:"start"`
+	Count     int64     `gorm:"not null;default:0" json:"count"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (APIUsage) TableName() string { return "api_usage" }
+
+// QuotaWindow is a key's usage of one quota period
+type QuotaWindow struct {
+	Limit     int64     `json:"limit"` // 0 for unlimited
+	Used      int64     `json:"used"`
+	Remaining *int64    `json:"remaining,omitempty"` // nil when unlimited
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+// DailyUsage is a key's request count on one day
+type DailyUsage struct {
+	Date  string `json:"date"`
+	Count int64  `json:"count"`
+}
+
+// KeyUsage is what /api/keys/self/usage reports for the calling key
+type KeyUsage struct {
+	Key     string       `json:"key"`
+	Tier    string       `json:"tier"`
+	Daily   QuotaWindow  `json:"daily"`
+	Monthly QuotaWindow  `json:"monthly"`
+	History []DailyUsage `json:"history"` // most recent first, today included
+}
@@ -0,0 +1,26 @@
+package models
+
+// Coverage is how much of the EFTA number range the archive holds, from
+// the lowest number it has to the highest
+type Coverage struct {
+	FirstID string  `json:"first_id,omitempty"`
+	LastID  string  `json:"last_id,omitempty"`
+	Present int64   `json:"present"`
+	Missing int64   `json:"missing"`
+	Percent float64 `json:"percent"`
+}
+
+// RedactionMarkers are the strings that show a redaction in extracted page
+// text: the FOIA exemption codes DOJ stamps over withheld material, and
+// the word itself. Matching is case-insensitive.
+var RedactionMarkers = []string{"REDACTED", "(b)(6)", "(b)(7)(A)", "(b)(7)(C)", "(b)(7)(D)", "(b)(7)(E)", "(b)(7)(F)"}
+
+// RedactionStats counts the pages showing signs of redaction
+type RedactionStats struct {
+	Pages            int64            `json:"pages"`
+	BlankPages       int64            `json:"blank_pages"`
+	PagesWithoutText int64            `json:"pages_without_text"`
+	MarkedPages      int64            `json:"marked_pages"` // pages citing at least one marker
+	MarkedDocuments  int64            `json:"marked_documents"`
+	Markers          map[string]int64 `json:"markers"` // pages citing each marker
+}
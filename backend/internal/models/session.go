@@ -0,0 +1,46 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Session is an admin signed in through a single sign-on provider. The
+// browser holds a random token; only its SHA-256 is stored.
+type Session struct {
+	ID        string    `gorm:"primaryKey;size:64" json:"-"`
+	Provider  string    `gorm:"size:50;not null" json:"provider"`
+	Subject   string    `gorm:"size:255;not null" json:"subject"` // the provider's user ID
+	Name      string    `gorm:"size:255" json:"name,omitempty"`
+	Email     string    `gorm:"size:255" json:"email,omitempty"`
+	Roles     string    `gorm:"size:255" json:"-"` // comma-separated
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// RoleList is the session's roles
+func (s *Session) RoleList() []string {
+	if s.Roles == "" {
+		return []string{}
+	}
+	return strings.Split(s.Roles, ",")
+}
+
+// HasRole reports whether the session was granted role
+func (s *Session) HasRole(role string) bool {
+	for _, r := range s.RoleList() {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Actor names the user in the audit log, e.g. "google:ed@example.org"
+func (s *Session) Actor() string {
+	who := s.Email
+	if who == "" {
+		who = s.Subject
+	}
+	return s.Provider + ":" + who
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// ImageTag is an object or scene label assigned to an image by
+// scripts/tag_images.py, e.g. "beach" or "aircraft interior"
+type ImageTag struct {
+	ID         uint      `gorm:"primaryKey" json:"-"`
+	ImageID    uint      `gorm:"not null;uniqueIndex:idx_image_tag" json:"-"`
+	Tag        string    `gorm:"size:100;not null;uniqueIndex:idx_image_tag;index" json:"tag"`
+	Confidence float64   `gorm:"default:0" json:"confidence"` // 0-1
+	Provider   string    `gorm:"size:50" json:"provider,omitempty"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"-"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Storage tiers of a source PDF besides the hot tier, see storage.Tiered
+const (
+	TierCold      = "cold"      // in cold storage only; must be restored to be read
+	TierRestoring = "restoring" // a restore job is queued or running
+	TierRestored  = "restored"  // copied back to the hot tier
+)
+
+// FileTier is the storage tier of a document's source PDF and when it was
+// last read through the API; a document without a row is hot and unread.
+// It is kept out of documents so reads don't fill the change log, and each
+// mirror tiers its own files.
+type FileTier struct {
+	DocumentID     string     `gorm:"primaryKey;size:50" json:"document_id"`
+	Tier           string     `gorm:"size:10;index" json:"tier"` // empty for the hot tier
+	LastAccessedAt *time.Time `json:"last_accessed_at,omitempty"`
+	RestoredUntil  *time.Time `json:"restored_until,omitempty"` // a restored PDF isn't archived again before then
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
@@ -0,0 +1,74 @@
+package models
+
+import "time"
+
+// LatencyBoundsMS are the upper bounds of UsageLatency's buckets
+var LatencyBoundsMS = []int64{10, 50, 100, 250, 500, 1000, 5000}
+
+// UsageStat counts one route's requests on one day (UTC) for the opt-in
+// usage statistics. Route is the pattern, e.g. "GET /api/documents/{id}", so
+// no IDs, query strings, keys or addresses are kept.
+type UsageStat struct {
+	Day          string       `gorm:"primaryKey;size:10" json:"day"`
+	Route        string       `gorm:"primaryKey;size:200" json:"route"`
+	Requests     int64        `gorm:"not null;default:0" json:"requests"`
+	ClientErrors int64        `gorm:"not null;default:0" json:"client_errors"`
+	ServerErrors int64        `gorm:"not null;default:0" json:"server_errors"`
+	TotalUS      int64        `gorm:"not null;default:0" json:"total_us"` // microseconds, summed for the mean
+	Latency      UsageLatency `gorm:"embedded;embeddedPrefix:ms_" json:"latency"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+}
+
+func (UsageStat) TableName() string { return "usage_stats" }
+
+// UsageLatency counts requests by how long they took, in the buckets of
+// LatencyBoundsMS and one for slower ones
+type UsageLatency struct {
+	Le10   int64 `gorm:"not null;default:0" json:"le_10"`
+	Le50   int64 `gorm:"not null;default:0" json:"le_50"`
+	Le100  int64 `gorm:"not null;default:0" json:"le_100"`
+	Le250  int64 `gorm:"not null;default:0" json:"le_250"`
+	Le500  int64 `gorm:"not null;default:0" json:"le_500"`
+	Le1000 int64 `gorm:"not null;default:0" json:"le_1000"`
+	Le5000 int64 `gorm:"not null;default:0" json:"le_5000"`
+	Slower int64 `gorm:"not null;default:0" json:"slower"`
+}
+
+// Buckets are the counts in order, the last one being Slower
+func (l *UsageLatency) Buckets() []*int64 {
+	return []*int64{&l.Le10, &l.Le50, &l.Le100, &l.Le250, &l.Le500, &l.Le1000, &l.Le5000, &l.Slower}
+}
+
+// Add counts every request of o as well
+func (s *UsageStat) Add(o *UsageStat) {
+	s.Requests += o.Requests
+	s.ClientErrors += o.ClientErrors
+	s.ServerErrors += o.ServerErrors
+	s.TotalUS += o.TotalUS
+	mine, theirs := s.Latency.Buckets(), o.Latency.Buckets()
+	for i := range mine {
+		*mine[i] += *theirs[i]
+	}
+}
+
+// RouteUsage is one route's requests over a UsageReport's days. The
+// percentiles are the bucket bound the request falls under, and are left
+// out when it took longer than the last bound.
+type RouteUsage struct {
+	Route        string  `json:"route"`
+	Requests     int64   `json:"requests"`
+	ClientErrors int64   `json:"client_errors"`
+	ServerErrors int64   `json:"server_errors"`
+	ErrorRate    float64 `json:"error_rate"` // server errors per request
+	MeanMS       float64 `json:"mean_ms"`
+	P50MS        *int64  `json:"p50_ms,omitempty"`
+	P95MS        *int64  `json:"p95_ms,omitempty"`
+	P99MS        *int64  `json:"p99_ms,omitempty"`
+}
+
+// UsageReport is what /api/admin/usage reports
+type UsageReport struct {
+	Since  string       `json:"since"`  // first day counted
+	Days   []DailyUsage `json:"days"`   // requests per day, most recent first
+	Routes []RouteUsage `json:"routes"` // busiest first
+}
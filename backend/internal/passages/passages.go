@@ -0,0 +1,283 @@
+// Package passages answers semantic searches over the page text chunks
+// scripts/embed_passages.py embedded. The query is embedded by the same
+// OpenAI-compatible endpoint, then compared with every passage embedded
+// with the same model, held in memory: 4 bytes per dimension per passage.
+// The index catches up with new passages on the next search after they are
+// written, and is rebuilt when passages were deleted or re-embedded.
+package passages
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/repository"
+)
+
+// ErrNoPassages is returned when nothing has been embedded with the
+// configured model yet
+var ErrNoPassages = errors.New("no passages are embedded with this model; run scripts/embed_passages.py")
+
+const loadBatch = 5000
+
+// Embedder calls an OpenAI-compatible /v1/embeddings endpoint
+type Embedder struct {
+	url, key, model string
+	client          *http.Client
+}
+
+// NewEmbedder returns an embedder, or nil without a URL
+func NewEmbedder(url, key, model string) *Embedder {
+	if url == "" {
+		return nil
+	}
+	return &Embedder{url: url, key: key, model: model, client: &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
+	}}
+}
+
+// Model is the embedding model passages must have been embedded with
+func (e *Embedder) Model() string {
+	return e.model
+}
+
+// Embed returns the embedding of text
+func (e *Embedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	body, err := json.Marshal(map[string]any{"model": e.model, "input": []string{text}})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.key != "" {
+		req.Header.Set("Authorization", "Bearer "+e.key)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embeddings endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("embeddings endpoint: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	var result struct {
+		Data []struct {
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("embeddings endpoint: %w", err)
+	}
+	if len(result.Data) != 1 || len(result.Data[0].Embedding) == 0 {
+		return nil, errors.New("embeddings endpoint returned no embedding")
+	}
+	return result.Data[0].Embedding, nil
+}
+
+// Index holds the passage embeddings of one archive, normalized to unit
+// length so a dot product is their cosine similarity
+type Index struct {
+	embedder *Embedder
+
+	mu      sync.Mutex
+	dims    int
+	ids     []uint
+	vectors []float32 // dims per passage, in ids order
+	count   int64     // passages with the model when last loaded
+	maxID   uint
+}
+
+// NewIndex returns an empty index for embedder's model, or nil without an
+// embedder
+func NewIndex(embedder *Embedder) *Index {
+	if embedder == nil {
+		return nil
+	}
+	return &Index{embedder: embedder}
+}
+
+// Search returns the k passages closest to query, best first
+func (x *Index) Search(ctx context.Context, repo *repository.Repository, query string, k int) (*models.PassageResults, error) {
+	q, err := x.embedder.Embed(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	normalize(q)
+
+	x.mu.Lock()
+	err = x.refresh(repo)
+	if err == nil && x.dims != len(q) {
+		err = fmt.Errorf("the query embeds to %d dimensions, the passages to %d; were they embedded with %s?", len(q), x.dims, x.embedder.model)
+	}
+	if err != nil {
+		x.mu.Unlock()
+		return nil, err
+	}
+	top := x.nearest(q, k)
+	x.mu.Unlock()
+
+	ids := make([]uint, len(top))
+	scores := make(map[uint]float64, len(top))
+	for i, h := range top {
+		ids[i] = h.id
+		scores[h.id] = float64(h.score)
+	}
+	passages, err := repo.GetPassagesByID(ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range passages {
+		passages[i].Score = scores[passages[i].ID]
+	}
+	sort.Slice(passages, func(i, j int) bool {
+		return passages[i].Score > passages[j].Score
+	})
+	return &models.PassageResults{Query: query, Model: x.embedder.model, Passages: passages}, nil
+}
+
+// refresh loads the passages written since the last load, or all of them
+// again when some were deleted or replaced (embed_passages.py replaces a
+// page's passages when it re-embeds it). Callers hold mu.
+func (x *Index) refresh(repo *repository.Repository) error {
+	count, maxID, err := repo.GetPassageStats(x.embedder.model)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		x.reset()
+		return ErrNoPassages
+	}
+	if count == x.count && maxID == x.maxID {
+		return nil
+	}
+	if maxID <= x.maxID {
+		x.reset()
+	}
+	if err := x.load(repo); err != nil {
+		return err
+	}
+	if int64(len(x.ids)) != count && x.count != 0 {
+		// Some of those already loaded are gone
+		x.reset()
+		if err := x.load(repo); err != nil {
+			return err
+		}
+	}
+	x.count = int64(len(x.ids))
+	return nil
+}
+
+func (x *Index) reset() {
+	x.dims, x.ids, x.vectors, x.count, x.maxID = 0, nil, nil, 0, 0
+}
+
+// load appends the passages after maxID. Callers hold mu.
+func (x *Index) load(repo *repository.Repository) error {
+	for {
+		batch, err := repo.GetPassageEmbeddings(x.embedder.model, x.maxID, loadBatch)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		for _, p := range batch {
+			v, err := decode(p.Embedding)
+			if err != nil {
+				return fmt.Errorf("passage %d: %w", p.ID, err)
+			}
+			if x.dims == 0 {
+				x.dims = len(v)
+			}
+			if len(v) != x.dims {
+				return fmt.Errorf("passage %d has %d dimensions, others %d", p.ID, len(v), x.dims)
+			}
+			normalize(v)
+			x.ids = append(x.ids, p.ID)
+			x.vectors = append(x.vectors, v...)
+			x.maxID = p.ID
+		}
+	}
+}
+
+type hit struct {
+	id    uint
+	score float32
+}
+
+// hits is a min-heap on score, holding the best k seen so far
+type hits []hit
+
+func (h hits) Len() int           { return len(h) }
+func (h hits) Less(i, j int) bool { return h[i].score < h[j].score }
+func (h hits) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *hits) Push(v any)        { *h = append(*h, v.(hit)) }
+func (h *hits) Pop() any {
+	old := *h
+	v := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return v
+}
+
+// nearest scans every passage for the k most similar to q. Callers hold mu.
+func (x *Index) nearest(q []float32, k int) []hit {
+	top := make(hits, 0, k+1)
+	for i, id := range x.ids {
+		v := x.vectors[i*x.dims : (i+1)*x.dims]
+		var score float32
+		for d, qd := range q {
+			score += qd * v[d]
+		}
+		if len(top) < k {
+			heap.Push(&top, hit{id, score})
+		} else if score > top[0].score {
+			top[0] = hit{id, score}
+			heap.Fix(&top, 0)
+		}
+	}
+	return top
+}
+
+func decode(b []byte) ([]float32, error) {
+	if len(b) == 0 || len(b)%4 != 0 {
+		return nil, fmt.Errorf("embedding of %d bytes isn't a float32 vector", len(b))
+	}
+	v := make([]float32, len(b)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:]))
+	}
+	return v, nil
+}
+
+func normalize(v []float32) {
+	var sum float64
+	for _, f := range v {
+		sum += float64(f) * float64(f)
+	}
+	if sum == 0 {
+		return
+	}
+	n := float32(1 / math.Sqrt(sum))
+	for i := range v {
+		v[i] *= n
+	}
+}
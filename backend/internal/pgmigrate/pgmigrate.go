@@ -0,0 +1,790 @@
+// Package pgmigrate copies an archive's SQLite database into Postgres:
+// every table with its rows, primary keys, indexes, foreign keys and id
+// sequences, and the full-text table as a tsvector column with a GIN
+// index. Tables are copied in rowid order, a batch per transaction that
+// also records how far the table got, so a migration that stops can be run
+// again and picks up where it left off.
+package pgmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// progressTable records, in the target, how far each table's copy got
+const progressTable = "_sqlite_migration"
+
+// How often a long table logs its progress
+const progressInterval = 10 * time.Second
+
+// Options tune a migration
+type Options struct {
+	// Rows per COPY and transaction
+	Batch int
+	// Text search configuration for the full-text tsvector, e.g. "english"
+	// to stem like FTS_PORTER, or "simple"
+	TextSearch string
+}
+
+// TableReport compares a table's row counts once it has been copied
+type TableReport struct {
+	Table   string `json:"table"`
+	Source  int64  `json:"source_rows"`
+	Target  int64  `json:"target_rows"`
+	Resumed bool   `json:"resumed,omitempty"`
+	FTS     bool   `json:"fts,omitempty"`
+}
+
+// Report is what a migration copied and what it left behind
+type Report struct {
+	Tables []TableReport `json:"tables"`
+	// Triggers and views aren't carried over: the change-log triggers are
+	// SQLite code, and the server doesn't define views
+	Skipped []string `json:"skipped,omitempty"`
+	// Foreign keys declared on the copied tables; those that rows already
+	// break are enforced on new writes only, listed with the error
+	ForeignKeys int      `json:"foreign_keys"`
+	Unvalidated []string `json:"unvalidated_foreign_keys,omitempty"`
+	Elapsed     string   `json:"elapsed"`
+}
+
+// Mismatched lists the tables whose counts differ
+func (r *Report) Mismatched() []string {
+	var out []string
+	for _, t := range r.Tables {
+		if t.Source != t.Target {
+			out = append(out, t.Table)
+		}
+	}
+	return out
+}
+
+type column struct {
+	name    string
+	typ     string // declared SQLite type, lowercased
+	notNull bool
+	dflt    sql.NullString
+	pk      int
+}
+
+type table struct {
+	name    string
+	columns []column
+	fts     bool
+	// Highest id SQLite's AUTOINCREMENT handed out, which can be above
+	// the largest id left in the table
+	seq int64
+}
+
+// identity reports whether the table's primary key is its integer rowid
+func (t *table) identity() bool {
+	pks := 0
+	for _, c := range t.columns {
+		if c.pk > 0 {
+			pks++
+		}
+	}
+	return pks == 1 && !t.fts && t.pkColumn().typ == "integer"
+}
+
+func (t *table) pkColumn() column {
+	for _, c := range t.columns {
+		if c.pk == 1 {
+			return c
+		}
+	}
+	return column{}
+}
+
+// Run copies src, a SQLite database, into the Postgres database dst. Tables
+// already copied on an earlier run are checked again, not copied, and a
+// partly copied one continues after its last committed batch.
+func Run(ctx context.Context, src, dst *sql.DB, opts Options) (*Report, error) {
+	start := time.Now()
+	if opts.Batch <= 0 {
+		opts.Batch = 5000
+	}
+	if opts.TextSearch == "" {
+		opts.TextSearch = "simple"
+	}
+
+	tables, skipped, err := listTables(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dst.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+progressTable+` (
+		table_name TEXT PRIMARY KEY,
+		last_rowid BIGINT NOT NULL DEFAULT 0,
+		copied BIGINT NOT NULL DEFAULT 0,
+		done BOOLEAN NOT NULL DEFAULT false,
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return nil, fmt.Errorf("create %s: %w", progressTable, err)
+	}
+
+	report := &Report{Skipped: skipped}
+	for _, t := range tables {
+		resumed, err := copyTable(ctx, src, dst, t, opts)
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %w", t.name, err)
+		}
+
+		tr := TableReport{Table: t.name, Resumed: resumed, FTS: t.fts}
+		if err := src.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+quote(t.name)).Scan(&tr.Source); err != nil {
+			return nil, fmt.Errorf("count %s: %w", t.name, err)
+		}
+		if err := dst.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+quote(t.name)).Scan(&tr.Target); err != nil {
+			return nil, fmt.Errorf("count %s in target: %w", t.name, err)
+		}
+		report.Tables = append(report.Tables, tr)
+	}
+	if report.ForeignKeys, report.Unvalidated, err = addForeignKeys(ctx, src, dst, tables); err != nil {
+		return nil, fmt.Errorf("foreign keys: %w", err)
+	}
+	report.Elapsed = time.Since(start).Round(time.Second).String()
+	return report, nil
+}
+
+// listTables reads the schema: ordinary tables and full-text tables to copy,
+// leaving out SQLite's internal tables and the FTS shadow tables its virtual
+// tables keep their index in. Triggers and views are listed as skipped.
+func listTables(ctx context.Context, src *sql.DB) ([]*table, []string, error) {
+	rows, err := src.QueryContext(ctx, `SELECT type, name, COALESCE(sql, '') FROM sqlite_master
+		WHERE type IN ('table', 'view', 'trigger') ORDER BY name`)
+	if err != nil {
+		return nil, nil, err
+	}
+	type entry struct{ typ, name, sql string }
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.typ, &e.name, &e.sql); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	virtual := map[string]bool{}
+	for _, e := range entries {
+		if e.typ == "table" && strings.HasPrefix(strings.ToUpper(e.sql), "CREATE VIRTUAL TABLE") {
+			virtual[e.name] = true
+		}
+	}
+	shadow := func(name string) bool {
+		for v := range virtual {
+			if strings.HasPrefix(name, v+"_") {
+				return true
+			}
+		}
+		return false
+	}
+
+	seqs := map[string]int64{}
+	for _, e := range entries {
+		if e.name == "sqlite_sequence" {
+			if seqs, err = readSequences(ctx, src); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	var tables []*table
+	var skipped []string
+	for _, e := range entries {
+		switch {
+		case e.typ != "table":
+			skipped = append(skipped, e.typ+" "+e.name)
+			continue
+		case strings.HasPrefix(e.name, "sqlite_"), e.name == progressTable, shadow(e.name):
+			continue
+		}
+
+		t := &table{name: e.name, seq: seqs[e.name]}
+		if virtual[e.name] {
+			if !strings.Contains(strings.ToLower(e.sql), "using fts") {
+				skipped = append(skipped, "virtual table "+e.name)
+				continue
+			}
+			t.fts = true
+		}
+		if t.columns, err = readColumns(ctx, src, e.name); err != nil {
+			return nil, nil, err
+		}
+		tables = append(tables, t)
+	}
+	return tables, skipped, nil
+}
+
+func readSequences(ctx context.Context, src *sql.DB) (map[string]int64, error) {
+	rows, err := src.QueryContext(ctx, `SELECT name, seq FROM sqlite_sequence`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	seqs := map[string]int64{}
+	for rows.Next() {
+		var name string
+		var seq int64
+		if err := rows.Scan(&name, &seq); err != nil {
+			return nil, err
+		}
+		seqs[name] = seq
+	}
+	return seqs, rows.Err()
+}
+
+func readColumns(ctx context.Context, src *sql.DB, name string) ([]column, error) {
+	rows, err := src.QueryContext(ctx, `SELECT name, type, "notnull", dflt_value, pk FROM pragma_table_info(?)`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cols []column
+	for rows.Next() {
+		var c column
+		if err := rows.Scan(&c.name, &c.typ, &c.notNull, &c.dflt, &c.pk); err != nil {
+			return nil, err
+		}
+		c.typ = strings.ToLower(c.typ)
+		cols = append(cols, c)
+	}
+	return cols, rows.Err()
+}
+
+// copyTable creates the table in the target on the first run, copies its
+// rows in batches and then adds its indexes and sequence. It reports whether
+// an earlier run had already started on it.
+func copyTable(ctx context.Context, src, dst *sql.DB, t *table, opts Options) (bool, error) {
+	var lastRowID, copied int64
+	var done bool
+	err := dst.QueryRowContext(ctx, `SELECT last_rowid, copied, done FROM `+progressTable+` WHERE table_name = $1`, t.name).
+		Scan(&lastRowID, &copied, &done)
+	resumed := err == nil
+	switch {
+	case err == sql.ErrNoRows:
+		if err := createTable(ctx, dst, t, opts); err != nil {
+			return false, err
+		}
+	case err != nil:
+		return false, err
+	case done:
+		return true, nil
+	}
+
+	var total int64
+	if err := src.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+quote(t.name)).Scan(&total); err != nil {
+		return resumed, err
+	}
+	if resumed {
+		log.Printf("%s: resuming after rowid %d, %d of %d rows copied", t.name, lastRowID, copied, total)
+	}
+
+	names := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		names[i] = quote(c.name)
+	}
+	targetCols := columnNames(t)
+	query := fmt.Sprintf(`SELECT rowid, %s FROM %s WHERE rowid > ? ORDER BY rowid LIMIT %d`,
+		strings.Join(names, ", "), quote(t.name), opts.Batch)
+
+	lastLog := time.Now()
+	for {
+		batch, last, err := readBatch(ctx, src, query, lastRowID, t)
+		if err != nil {
+			return resumed, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		if err := writeBatch(ctx, dst, t.name, targetCols, batch, last); err != nil {
+			return resumed, err
+		}
+		lastRowID = last
+		copied += int64(len(batch))
+		if time.Since(lastLog) >= progressInterval {
+			log.Printf("%s: %d of %d rows copied", t.name, copied, total)
+			lastLog = time.Now()
+		}
+	}
+
+	if err := finishTable(ctx, src, dst, t); err != nil {
+		return resumed, err
+	}
+	log.Printf("%s: %d rows copied", t.name, copied)
+	return resumed, nil
+}
+
+// columnNames are the target's columns in the order readBatch returns values
+func columnNames(t *table) []string {
+	var names []string
+	if t.fts {
+		names = append(names, "rowid")
+	}
+	for _, c := range t.columns {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+func readBatch(ctx context.Context, src *sql.DB, query string, after int64, t *table) ([][]interface{}, int64, error) {
+	rows, err := src.QueryContext(ctx, query, after)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var batch [][]interface{}
+	last := after
+	for rows.Next() {
+		vals := make([]interface{}, len(t.columns)+1)
+		ptrs := make([]interface{}, len(vals))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, 0, err
+		}
+		last = vals[0].(int64)
+
+		row := make([]interface{}, 0, len(vals))
+		if t.fts {
+			row = append(row, last)
+		}
+		for i, c := range t.columns {
+			v, err := convert(c, vals[i+1])
+			if err != nil {
+				return nil, 0, fmt.Errorf("rowid %d, column %s: %w", last, c.name, err)
+			}
+			row = append(row, v)
+		}
+		batch = append(batch, row)
+	}
+	return batch, last, rows.Err()
+}
+
+// writeBatch copies rows and moves the table's progress on in one
+// transaction, so a batch is either fully in the target or not at all
+func writeBatch(ctx context.Context, dst *sql.DB, name string, cols []string, batch [][]interface{}, last int64) error {
+	tx, err := dst.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(name, cols...))
+	if err != nil {
+		return err
+	}
+	for _, row := range batch {
+		if _, err := stmt.ExecContext(ctx, row...); err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return err
+	}
+	if err := stmt.Close(); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE `+progressTable+`
+		SET last_rowid = $2, copied = copied + $3, updated_at = now() WHERE table_name = $1`,
+		name, last, len(batch)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// createTable creates the target table along with its progress row. A table
+// that is already there without one wasn't made by this migration, and is
+// left alone.
+func createTable(ctx context.Context, dst *sql.DB, t *table, opts Options) error {
+	var existing sql.NullString
+	if err := dst.QueryRowContext(ctx, `SELECT to_regclass($1)::text`, quote(t.name)).Scan(&existing); err != nil {
+		return err
+	}
+	if existing.Valid {
+		return fmt.Errorf("already exists in the target and wasn't created by a migration; drop it or migrate into an empty database")
+	}
+
+	tx, err := dst.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, createSQL(t, opts)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO `+progressTable+` (table_name) VALUES ($1)`, t.name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// createSQL is the CREATE TABLE statement for t in Postgres
+func createSQL(t *table, opts Options) string {
+	var defs []string
+	var pks []string
+	if t.fts {
+		defs = append(defs, "rowid BIGINT PRIMARY KEY")
+	}
+	for _, c := range t.columns {
+		if t.identity() && c.pk == 1 {
+			defs = append(defs, quote(c.name)+" BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY")
+			continue
+		}
+		def := quote(c.name) + " " + pgType(c)
+		if c.notNull {
+			def += " NOT NULL"
+		}
+		if d, ok := pgDefault(c); ok {
+			def += " DEFAULT " + d
+		}
+		defs = append(defs, def)
+		if c.pk > 0 {
+			pks = append(pks, quote(c.name))
+		}
+	}
+	if len(pks) > 0 {
+		// pragma_table_info lists columns in table order, which for a
+		// composite key the pk numbers (1, 2, ...) rearrange
+		ordered := make([]string, len(pks))
+		i := 0
+		for _, c := range t.columns {
+			if c.pk > 0 {
+				ordered[c.pk-1] = pks[i]
+				i++
+			}
+		}
+		defs = append(defs, "PRIMARY KEY ("+strings.Join(ordered, ", ")+")")
+	}
+	if t.fts {
+		var text []string
+		for _, c := range t.columns {
+			text = append(text, "COALESCE("+quote(c.name)+", '')")
+		}
+		defs = append(defs, fmt.Sprintf("tsv tsvector GENERATED ALWAYS AS (to_tsvector(%s, %s)) STORED",
+			pq.QuoteLiteral(opts.TextSearch), strings.Join(text, " || ' ' || ")))
+	}
+
+	return "CREATE TABLE " + quote(t.name) + " (\n\t" + strings.Join(defs, ",\n\t") + "\n)"
+}
+
+// finishTable adds what is quicker to build once the rows are in: the
+// table's indexes, and its id sequence moved past the copied ids
+func finishTable(ctx context.Context, src, dst *sql.DB, t *table) error {
+	indexes, err := readIndexes(ctx, src, t.name)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range indexes {
+		if _, err := dst.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if t.fts {
+		if _, err := dst.ExecContext(ctx, fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s USING GIN (tsv)`,
+			quote(t.name+"_tsv"), quote(t.name))); err != nil {
+			return err
+		}
+	}
+
+	if t.identity() {
+		pk := t.pkColumn().name
+		if _, err := dst.ExecContext(ctx, fmt.Sprintf(
+			`SELECT setval(pg_get_serial_sequence($1, $2), GREATEST(COALESCE(MAX(%s), 0), $3, 1), GREATEST(COALESCE(MAX(%s), 0), $3) > 0) FROM %s`,
+			quote(pk), quote(pk), quote(t.name)), quote(t.name), pk, t.seq); err != nil {
+			return fmt.Errorf("set id sequence: %w", err)
+		}
+	}
+
+	_, err = dst.ExecContext(ctx, `UPDATE `+progressTable+` SET done = true, updated_at = now() WHERE table_name = $1`, t.name)
+	return err
+}
+
+// foreignKey is one of a table's foreign keys, maybe over several columns
+type foreignKey struct {
+	parent   string
+	from, to []string
+}
+
+// addForeignKeys declares the foreign keys of the SQLite schema between
+// copied tables. Each is added NOT VALID, so rows copied as they were can't
+// fail the migration, then validated; one that existing rows break stays
+// unvalidated and is returned with the error. A constraint from an earlier
+// run is validated again if it wasn't.
+func addForeignKeys(ctx context.Context, src, dst *sql.DB, tables []*table) (int, []string, error) {
+	copied := map[string]bool{}
+	for _, t := range tables {
+		copied[t.name] = true
+	}
+
+	added := 0
+	var unvalidated []string
+	for _, t := range tables {
+		if t.fts {
+			continue
+		}
+		fks, err := readForeignKeys(ctx, src, t.name)
+		if err != nil {
+			return 0, nil, err
+		}
+		for _, fk := range fks {
+			if !copied[fk.parent] {
+				continue
+			}
+			name := "fk_" + t.name + "_" + strings.Join(fk.from, "_")
+			var validated bool
+			err := dst.QueryRowContext(ctx, `SELECT convalidated FROM pg_constraint WHERE conname = $1 AND conrelid = $2::regclass`,
+				name, quote(t.name)).Scan(&validated)
+			if err == sql.ErrNoRows {
+				cols := func(names []string) string {
+					quoted := make([]string, len(names))
+					for i, n := range names {
+						quoted[i] = quote(n)
+					}
+					return strings.Join(quoted, ", ")
+				}
+				_, err = dst.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s) NOT VALID`,
+					quote(t.name), quote(name), cols(fk.from), quote(fk.parent), cols(fk.to)))
+			}
+			if err != nil {
+				return 0, nil, fmt.Errorf("%s: %w", name, err)
+			}
+			added++
+			if validated {
+				continue
+			}
+			if _, err := dst.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s VALIDATE CONSTRAINT %s`, quote(t.name), quote(name))); err != nil {
+				log.Printf("%s: foreign key %s left unvalidated: %v", t.name, name, err)
+				unvalidated = append(unvalidated, name+": "+err.Error())
+			}
+		}
+	}
+	return added, unvalidated, nil
+}
+
+// readForeignKeys lists a table's foreign keys; one naming no parent columns
+// refers to the parent's primary key, id in this schema
+func readForeignKeys(ctx context.Context, src *sql.DB, name string) ([]foreignKey, error) {
+	rows, err := src.QueryContext(ctx, `SELECT id, "table", "from", COALESCE("to", '') FROM pragma_foreign_key_list(?) ORDER BY id, seq`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fks []foreignKey
+	last := -1
+	for rows.Next() {
+		var id int
+		var parent, from, to string
+		if err := rows.Scan(&id, &parent, &from, &to); err != nil {
+			return nil, err
+		}
+		if to == "" {
+			to = "id"
+		}
+		if id != last {
+			fks = append(fks, foreignKey{parent: parent})
+			last = id
+		}
+		fk := &fks[len(fks)-1]
+		fk.from, fk.to = append(fk.from, from), append(fk.to, to)
+	}
+	return fks, rows.Err()
+}
+
+// readIndexes turns the table's indexes into CREATE INDEX statements. The
+// primary key is already part of the table; partial and expression indexes
+// are SQLite syntax and are left out.
+func readIndexes(ctx context.Context, src *sql.DB, name string) ([]string, error) {
+	rows, err := src.QueryContext(ctx, `SELECT name, "unique", origin, partial FROM pragma_index_list(?)`, name)
+	if err != nil {
+		return nil, err
+	}
+	type index struct {
+		name    string
+		unique  bool
+		origin  string
+		partial bool
+	}
+	var indexes []index
+	for rows.Next() {
+		var ix index
+		if err := rows.Scan(&ix.name, &ix.unique, &ix.origin, &ix.partial); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		indexes = append(indexes, ix)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var stmts []string
+	for _, ix := range indexes {
+		if ix.origin == "pk" || ix.partial {
+			continue
+		}
+		cols, err := indexColumns(ctx, src, ix.name)
+		if err != nil {
+			return nil, err
+		}
+		if cols == nil {
+			continue
+		}
+
+		// UNIQUE constraints get an automatic index whose name is
+		// SQLite's; name it after its columns as Postgres would
+		ixName := ix.name
+		if ix.origin == "u" {
+			ixName = name + "_" + strings.Join(cols, "_") + "_key"
+		}
+		quoted := make([]string, len(cols))
+		for i, c := range cols {
+			quoted[i] = quote(c)
+		}
+		unique := ""
+		if ix.unique {
+			unique = "UNIQUE "
+		}
+		stmts = append(stmts, fmt.Sprintf("CREATE %sINDEX IF NOT EXISTS %s ON %s (%s)",
+			unique, quote(ixName), quote(name), strings.Join(quoted, ", ")))
+	}
+	return stmts, nil
+}
+
+// indexColumns returns nil for an index on an expression
+func indexColumns(ctx context.Context, src *sql.DB, index string) ([]string, error) {
+	rows, err := src.QueryContext(ctx, `SELECT name FROM pragma_index_info(?) ORDER BY seqno`, index)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cols []string
+	for rows.Next() {
+		var c sql.NullString
+		if err := rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		if !c.Valid {
+			return nil, nil
+		}
+		cols = append(cols, c.String)
+	}
+	return cols, rows.Err()
+}
+
+// pgType maps the SQLite types gorm declares to their Postgres equivalent
+func pgType(c column) string {
+	switch c.typ {
+	case "integer":
+		return "BIGINT"
+	case "real":
+		return "DOUBLE PRECISION"
+	case "blob":
+		return "BYTEA"
+	case "datetime":
+		return "TIMESTAMPTZ"
+	case "numeric":
+		// gorm's type for bool
+		return "BOOLEAN"
+	case "json":
+		return "JSONB"
+	default:
+		return "TEXT"
+	}
+}
+
+// pgDefault carries over literal defaults; anything else is left to the
+// application, which sets every column it writes
+func pgDefault(c column) (string, bool) {
+	if !c.dflt.Valid {
+		return "", false
+	}
+	d := strings.TrimSpace(c.dflt.String)
+	if c.typ == "numeric" {
+		switch strings.ToLower(d) {
+		case "0", "false":
+			return "false", true
+		case "1", "true":
+			return "true", true
+		}
+		return "", false
+	}
+	if strings.EqualFold(d, "CURRENT_TIMESTAMP") {
+		return "CURRENT_TIMESTAMP", true
+	}
+	if _, err := strconv.ParseFloat(d, 64); err == nil {
+		return d, true
+	}
+	if len(d) >= 2 && d[0] == '\'' && d[len(d)-1] == '\'' {
+		return d, true
+	}
+	return "", false
+}
+
+// convert turns a SQLite value into one COPY accepts for the column's
+// Postgres type. SQLite doesn't enforce declared types, so text can turn up
+// in an integer column and the other way round.
+func convert(c column, v interface{}) (interface{}, error) {
+	if b, ok := v.([]byte); ok && c.typ != "blob" {
+		v = string(b)
+	}
+	if v == nil {
+		return nil, nil
+	}
+
+	switch c.typ {
+	case "numeric":
+		switch x := v.(type) {
+		case int64:
+			return x != 0, nil
+		case float64:
+			return x != 0, nil
+		case bool:
+			return x, nil
+		case string:
+			return strconv.ParseBool(x)
+		}
+	case "json":
+		if s, ok := v.(string); ok && s == "" {
+			return nil, nil
+		}
+	case "datetime":
+		if s, ok := v.(string); ok && s == "" {
+			return nil, nil
+		}
+		return v, nil
+	case "integer", "real", "blob":
+		return v, nil
+	}
+	if s, ok := v.(string); ok {
+		// Postgres text can't hold NUL characters
+		return strings.ReplaceAll(s, "\x00", ""), nil
+	}
+	if t, ok := v.(time.Time); ok {
+		return t.Format(time.RFC3339Nano), nil
+	}
+	return fmt.Sprint(v), nil
+}
+
+// quote double-quotes an identifier, which works in both SQLite and Postgres
+func quote(name string) string {
+	return pq.QuoteIdentifier(name)
+}
@@ -0,0 +1,142 @@
+// Package purge removes a dataset from the archive: every document of the
+// release with its pages, images, text, FTS rows and other derived rows,
+// the files storage holds for them, and the dataset's own metadata files.
+// It is for undoing an import that shouldn't have reached the archive, such
+// as a test run against production.
+package purge
+
+import (
+	"context"
+	"errors"
+	"log"
+	"path"
+
+	"github.com/epstein-files/backend/internal/jobs"
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/repository"
+	"github.com/epstein-files/backend/internal/storage"
+)
+
+// JobType is the job type for removing a dataset
+const JobType = "dataset-delete"
+
+const batchSize = 100
+
+// Params builds the stored parameters of a removal job
+func Params(datasetID uint) models.JSON {
+	return models.JSON{"dataset_id": datasetID}
+}
+
+// Job removes the documents of a dataset a batch per transaction, so the API
+// isn't held up behind the job, then the dataset itself. The files of a
+// batch are deleted from storage once its rows are gone; a file that can't
+// be deleted is logged and counted as failed, and one already missing is
+// counted as such. A store that can't delete files, like the CDN, keeps
+// them all, counted as kept. The store is the archive's own, under its
+// files directory, so the same key in another archive is never touched. The
+// result counts the rows removed by table.
+func Job(repo *repository.Repository, store storage.Store) jobs.Handler {
+	return func(ctx context.Context, job *models.Job, p *jobs.Progress) error {
+		repo := repo.WithContext(ctx)
+		id := uint(jobs.ParamInt(job.Params, "dataset_id"))
+		writer, _ := store.(storage.Writer)
+
+		if job.Total == 0 {
+			footprint, err := repo.GetDatasetFootprint(id)
+			if err != nil {
+				return err
+			}
+			job.Total = footprint["documents"]
+		}
+		if job.Result == nil {
+			job.Result = models.JSON{
+				"dataset_id": id, "rows": map[string]interface{}{},
+				"files_deleted": 0, "files_missing": 0, "files_kept": 0,
+			}
+		}
+		rows, ok := job.Result["rows"].(map[string]interface{})
+		if !ok {
+			rows = map[string]interface{}{}
+			job.Result["rows"] = rows
+		}
+
+		// Removed documents no longer match, so each batch is the first
+		for {
+			batch, err := repo.GetDatasetDocuments(id, batchSize)
+			if err != nil {
+				return err
+			}
+			if len(batch) == 0 {
+				break
+			}
+
+			ids := make([]string, len(batch))
+			var keys []string
+			for i, doc := range batch {
+				ids[i] = doc.ID
+				keys = append(keys, storage.DocumentKey(doc.Filename))
+				for _, filename := range doc.Images {
+					keys = append(keys, storage.ImageKey(doc.ID, filename))
+				}
+				for _, url := range doc.Sprites {
+					keys = append(keys, storage.SpriteKey(doc.ID, path.Base(url)))
+				}
+			}
+			deleted, err := repo.DeleteDocuments(ids)
+			if err != nil {
+				return err
+			}
+			for table, n := range deleted {
+				jobs.AddCount(rows, table, n)
+			}
+			job.Processed += int64(len(batch))
+
+			if err := deleteFiles(ctx, writer, job, keys); err != nil {
+				return err
+			}
+			if err := p.Save(); err != nil {
+				return err
+			}
+		}
+
+		files, datasets, err := repo.DeleteDataset(id)
+		if err != nil {
+			return err
+		}
+		jobs.AddCount(rows, "dataset_files", int64(len(files)))
+		jobs.AddCount(rows, "datasets", datasets)
+		keys := make([]string, len(files))
+		for i, f := range files {
+			keys[i] = storage.DatasetFileKey(id, f.Filename)
+		}
+		if err := deleteFiles(ctx, writer, job, keys); err != nil {
+			return err
+		}
+		return p.Save()
+	}
+}
+
+// deleteFiles deletes the files of removed rows, counting the outcomes in
+// the result; it only fails when the job is cancelled
+func deleteFiles(ctx context.Context, writer storage.Writer, job *models.Job, keys []string) error {
+	if writer == nil {
+		jobs.AddCount(job.Result, "files_kept", int64(len(keys)))
+		return nil
+	}
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := writer.Delete(ctx, key)
+		switch {
+		case err == nil:
+			jobs.AddCount(job.Result, "files_deleted", 1)
+		case errors.Is(err, storage.ErrNotFound):
+			jobs.AddCount(job.Result, "files_missing", 1)
+		default:
+			log.Printf("Deleting %s: %v", key, err)
+			job.Failed++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+// Package quota meters API keys against the daily and monthly request
+// allowances of their tier (QUOTA_TIERS, API_KEY_TIERS). Days and months are
+// UTC. Counts are kept in memory and written to the archive's api_usage
+// table every so often, so a restart loses at most one interval's requests.
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/epstein-files/backend/internal/config"
+	"github.com/epstein-files/backend/internal/middleware"
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/repository"
+)
+
+const (
+	dayFormat   = "2006-01-02"
+	monthFormat = "2006-01"
+)
+
+// counter is one key's requests this day and month
+type counter struct {
+	day, month     string
+	daily, monthly int64
+	dirty          bool // changed since the last flush
+}
+
+// Limiter holds one archive's quota settings and usage
+type Limiter struct {
+	repo *repository.Repository
+
+	mu          sync.Mutex
+	tiers       map[string]config.QuotaTier
+	keyTiers    map[string]string
+	defaultTier string
+	tokens      map[string]string // API key token -> key name
+	usage       map[string]*counter
+	pending     []models.APIUsage // finished periods not yet written
+}
+
+func New(cfg *config.Config, repo *repository.Repository) *Limiter {
+	l := &Limiter{repo: repo, usage: make(map[string]*counter)}
+	l.SetConfig(cfg)
+	return l
+}
+
+// SetConfig applies QUOTA_TIERS, API_KEY_TIERS and QUOTA_DEFAULT_TIER, at
+// startup and on reload
+func (l *Limiter) SetConfig(cfg *config.Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tiers = cfg.QuotaTiers
+	l.keyTiers = cfg.APIKeyTiers
+	l.defaultTier = cfg.QuotaDefaultTier
+	l.tokens = cfg.ContribTokens
+}
+
+// Load reads the current day's and month's counts back from the database
+func (l *Limiter) Load() error {
+	now := time.Now().UTC()
+	day, month := now.Format(dayFormat), now.Format(monthFormat)
+	rows, err := l.repo.GetAPIUsage(day, month)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, row := range rows {
+		c := l.counter(row.Key, day, month)
+		switch row.Period {
+		case models.QuotaDay:
+			c.daily = row.Count
+		case models.QuotaMonth:
+			c.monthly = row.Count
+		}
+	}
+	return nil
+}
+
+// Run flushes the counts every interval until ctx is done, then once more
+func (l *Limiter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			l.flush()
+			return
+		}
+		l.flush()
+	}
+}
+
+func (l *Limiter) flush() {
+	if err := l.Flush(); err != nil {
+		log.Printf("Failed to save API usage: %v", err)
+	}
+}
+
+// Flush writes the counts changed since the last flush
+func (l *Limiter) Flush() error {
+	l.mu.Lock()
+	rows := l.pending
+	l.pending = nil
+	var flushed []*counter
+	now := time.Now()
+	for key, c := range l.usage {
+		if !c.dirty {
+			continue
+		}
+		rows = append(rows, c.rows(key, now)...)
+		c.dirty = false
+		flushed = append(flushed, c)
+	}
+	finished := len(rows) - 2*len(flushed)
+	l.mu.Unlock()
+
+	err := l.repo.SaveAPIUsage(rows)
+	if err != nil {
+		// Try again next time: finished periods as they were, current ones
+		// with whatever they've counted by then
+		l.mu.Lock()
+		l.pending = append(rows[:finished:finished], l.pending...)
+		for _, c := range flushed {
+			c.dirty = true
+		}
+		l.mu.Unlock()
+	}
+	return err
+}
+
+// rows are the counter's day and month as api_usage rows
+func (c *counter) rows(key string, now time.Time) []models.APIUsage {
+	return []models.APIUsage{
+		{Key: key, Period: models.QuotaDay, Start: c.day, Count: c.daily, UpdatedAt: now},
+		{Key: key, Period: models.QuotaMonth, Start: c.month, Count: c.monthly, UpdatedAt: now},
+	}
+}
+
+// counter returns key's counter for day and month, starting it over when a
+// period has ended. The caller holds mu.
+func (l *Limiter) counter(key, day, month string) *counter {
+	c, ok := l.usage[key]
+	if !ok {
+		c = &counter{day: day, month: month}
+		l.usage[key] = c
+		return c
+	}
+	if c.day == day && c.month == month {
+		return c
+	}
+	if c.dirty {
+		l.pending = append(l.pending, c.rows(key, time.Now())...)
+		c.dirty = false
+	}
+	if c.day != day {
+		c.day, c.daily = day, 0
+	}
+	if c.month != month {
+		c.month, c.monthly = month, 0
+	}
+	return c
+}
+
+// tier returns key's tier name and allowance; the caller holds mu
+func (l *Limiter) tier(key string) (string, config.QuotaTier) {
+	name, ok := l.keyTiers[key]
+	if !ok {
+		name = l.defaultTier
+	}
+	return name, l.tiers[name]
+}
+
+// Usage reports key's tier and its use of the current day and month
+func (l *Limiter) Usage(key string) models.KeyUsage {
+	now := time.Now().UTC()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	name, tier := l.tier(key)
+	c := l.counter(key, now.Format(dayFormat), now.Format(monthFormat))
+	return models.KeyUsage{
+		Key:     key,
+		Tier:    name,
+		Daily:   window(tier.Daily, c.daily, nextDay(now)),
+		Monthly: window(tier.Monthly, c.monthly, nextMonth(now)),
+	}
+}
+
+func window(limit, used int64, resets time.Time) models.QuotaWindow {
+	w := models.QuotaWindow{Limit: limit, Used: used, ResetsAt: resets}
+	if limit > 0 {
+		remaining := max(limit-used, 0)
+		w.Remaining = &remaining
+	}
+	return w
+}
+
+func nextDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+}
+
+func nextMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Enforce counts requests made with an API key against its tier's quotas,
+// answering 429 once either is used up. Metered responses carry
+// X-RateLimit-Limit, -Remaining and -Reset (Unix seconds) for whichever
+// quota is closer to running out. Requests without a key pass unmetered.
+func (l *Limiter) Enforce(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.mu.Lock()
+		key := middleware.KeyName(l.tokens, r)
+		if key == "" {
+			l.mu.Unlock()
+			next.ServeHTTP(w, r)
+			return
+		}
+		now := time.Now().UTC()
+		_, tier := l.tier(key)
+		c := l.counter(key, now.Format(dayFormat), now.Format(monthFormat))
+		daily := window(tier.Daily, c.daily, nextDay(now))
+		monthly := window(tier.Monthly, c.monthly, nextMonth(now))
+		exceeded := exhausted(daily) || exhausted(monthly)
+		if !exceeded {
+			c.daily++
+			c.monthly++
+			c.dirty = true
+			daily = window(tier.Daily, c.daily, nextDay(now))
+			monthly = window(tier.Monthly, c.monthly, nextMonth(now))
+		}
+		l.mu.Unlock()
+
+		period, binding := "daily", daily
+		switch {
+		case exhausted(monthly):
+			// Used up for the month; the day's reset doesn't help
+			period, binding = "monthly", monthly
+		case exhausted(daily):
+		case monthly.Remaining != nil && (daily.Remaining == nil || *monthly.Remaining < *daily.Remaining):
+			period, binding = "monthly", monthly
+		}
+		if binding.Remaining != nil {
+			w.Header().Set("X-RateLimit-Limit", strconv.FormatInt(binding.Limit, 10))
+			w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(*binding.Remaining, 10))
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(binding.ResetsAt.Unix(), 10))
+		}
+
+		if exceeded {
+			w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(binding.ResetsAt).Seconds())+1))
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error":     fmt.Sprintf("API key %s quota of %d requests used up", period, binding.Limit),
+				"resets_at": binding.ResetsAt,
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func exhausted(w models.QuotaWindow) bool {
+	return w.Remaining != nil && *w.Remaining == 0
+}
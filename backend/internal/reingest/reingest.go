@@ -0,0 +1,214 @@
+package reingest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/epstein-files/backend/internal/enrich"
+	"github.com/epstein-files/backend/internal/jobs"
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/repository"
+	"github.com/epstein-files/backend/internal/storage"
+)
+
+// JobType is the job type for re-running the ingest pipeline on one document
+const JobType = "reingest"
+
+// Stages are the pipeline stages a re-ingest can run, in the order they run:
+// text and images extract the PDF again and replace the document's pages,
+// text and full-text index row, or its images; exif re-reads the EXIF tags
+// of the document's stored images.
+var Stages = []string{"text", "images", "exif"}
+
+const imageBatchSize = 100
+
+// Longest script output kept in a job error
+const maxOutput = 500
+
+// ParseStages validates a comma-separated list of stage names and puts them
+// in running order; an empty list selects every stage
+func ParseStages(list string) ([]string, error) {
+	if strings.TrimSpace(list) == "" {
+		return Stages, nil
+	}
+	selected := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !isStage(name) {
+			return nil, fmt.Errorf("unknown stage %q (available: %s)", name, strings.Join(Stages, ", "))
+		}
+		selected[name] = true
+	}
+
+	var names []string
+	for _, name := range Stages {
+		if selected[name] {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no stages given (available: %s)", strings.Join(Stages, ", "))
+	}
+	return names, nil
+}
+
+func isStage(name string) bool {
+	for _, s := range Stages {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Params builds the stored parameters of a re-ingest job
+func Params(documentID string, stages []string) models.JSON {
+	return models.JSON{"document_id": documentID, "stages": strings.Join(stages, ",")}
+}
+
+// Scripts runs the Python pipeline for this archive
+type Scripts struct {
+	Python   string
+	Root     string // holds extract_pdf_content.py and scripts/
+	FilesDir string // this archive's working directories (downloads/, extracted_images/, ...)
+	Database string // this archive's database file
+}
+
+// run runs a script under Root in the archive's working directories with
+// its database, returning its last line of output in the error when it
+// fails. extract_pdf_content.py finds the directories from where it runs,
+// scripts/config.py from ARCHIVE_FILES_DIR.
+func (s Scripts) run(ctx context.Context, script string, args ...string) error {
+	dbPath, err := filepath.Abs(s.Database)
+	if err != nil {
+		return err
+	}
+	path, err := filepath.Abs(filepath.Join(s.Root, script))
+	if err != nil {
+		return err
+	}
+	filesDir, err := filepath.Abs(s.FilesDir)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, s.Python, append([]string{path}, args...)...)
+	cmd.Dir = filesDir
+	cmd.Env = append(os.Environ(), "DATABASE_PATH="+dbPath, "ARCHIVE_FILES_DIR="+filesDir)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %w: %s", s.Python, script, err, lastLine(out))
+	}
+	return nil
+}
+
+func lastLine(out []byte) string {
+	lines := bytes.Split(bytes.TrimSpace(out), []byte("\n"))
+	line := string(lines[len(lines)-1])
+	if len(line) > maxOutput {
+		line = line[:maxOutput]
+	}
+	return line
+}
+
+// Job re-runs the stages named in the job's "stages" parameter for one
+// document. The text and images stages extract the PDF again
+// (extract_pdf_content.py reextract) and then replace the derived rows in
+// one transaction (populate_db.py reingest); exif writes every image's tags
+// in one transaction. The cursor counts the stages done, so a job
+// interrupted by a restart doesn't repeat them.
+func Job(repo *repository.Repository, store storage.Store, scripts Scripts) jobs.Handler {
+	return func(ctx context.Context, job *models.Job, p *jobs.Progress) error {
+		repo := repo.WithContext(ctx)
+
+		documentID, _ := job.Params["document_id"].(string)
+		stageList, _ := job.Params["stages"].(string)
+		stages, err := ParseStages(stageList)
+		if err != nil {
+			return err
+		}
+		if exists, err := repo.DocumentExists(documentID); err != nil {
+			return err
+		} else if !exists {
+			return fmt.Errorf("document %q not found", documentID)
+		}
+		job.Total = int64(len(stages))
+
+		remaining := stages[min(int(job.Cursor), len(stages)):]
+		var extract []string
+		for _, stage := range remaining {
+			if stage == "text" || stage == "images" {
+				extract = append(extract, stage)
+			}
+		}
+		if len(extract) > 0 {
+			list := strings.Join(extract, ",")
+			if err := scripts.run(ctx, "extract_pdf_content.py", "reextract", documentID, "--stages", list); err != nil {
+				return err
+			}
+			if err := scripts.run(ctx, filepath.Join("scripts", "populate_db.py"), "reingest", documentID, "--stages", list); err != nil {
+				return err
+			}
+			job.Processed += int64(len(extract))
+			job.Cursor += uint(len(extract))
+			if err := p.Save(); err != nil {
+				return err
+			}
+		}
+
+		if len(remaining) > len(extract) {
+			if err := reingestExif(ctx, repo, store, job, documentID); err != nil {
+				return err
+			}
+			job.Processed++
+			job.Cursor++
+		}
+
+		images, err := repo.CountImages(documentID)
+		if err != nil {
+			return err
+		}
+		job.Result = models.JSON{"document_id": documentID, "stages": stageList, "images": images}
+		return p.Save()
+	}
+}
+
+// reingestExif re-reads the EXIF tags of every image of the document and
+// writes them back together. Images that can't be read are counted as
+// failed and keep their tags.
+func reingestExif(ctx context.Context, repo *repository.Repository, store storage.Store, job *models.Job, documentID string) error {
+	fields := map[uint]map[string]interface{}{}
+	var cursor uint
+	for {
+		images, err := repo.GetImageBatch(cursor, documentID, imageBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(images) == 0 {
+			break
+		}
+		for _, img := range images {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			f, err := enrich.Recompute(ctx, store, []string{"exif"}, img)
+			if err != nil {
+				log.Printf("Re-ingest %s: image %d: %v", documentID, img.ID, err)
+				job.Failed++
+			} else {
+				fields[img.ID] = f
+			}
+			cursor = img.ID
+		}
+	}
+	return repo.UpdateImagesFields(fields)
+}
@@ -0,0 +1,88 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/epstein-files/backend/internal/jobs"
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/repository"
+)
+
+// JobType is the job type for generating the transparency report
+const JobType = "stats-report"
+
+// Job builds the report and writes it in every format, path(format) naming
+// each file. Files are swapped in whole, so downloads in progress keep
+// reading the previous report.
+func Job(repo *repository.Repository, archiveID string, path func(format string) string) jobs.Handler {
+	return func(ctx context.Context, job *models.Job, p *jobs.Progress) error {
+		rep, err := Build(repo.WithContext(ctx), archiveID)
+		if err != nil {
+			return err
+		}
+
+		job.Total = int64(len(Formats))
+		for _, format := range Formats {
+			var buf bytes.Buffer
+			if format == "pdf" {
+				err = rep.PDF(&buf)
+			} else {
+				err = rep.Markdown(&buf)
+			}
+			if err != nil {
+				return err
+			}
+			if err := writeFile(path(format), buf.Bytes()); err != nil {
+				return err
+			}
+			job.Processed++
+		}
+
+		log.Printf("Transparency report: %d documents, %.1f%% coverage", rep.Stats.TotalDocuments, rep.Coverage.Percent)
+		job.Result = models.JSON{
+			"generated_at":     rep.GeneratedAt,
+			"documents":        rep.Stats.TotalDocuments,
+			"images":           rep.Stats.TotalImages,
+			"coverage_percent": rep.Coverage.Percent,
+			"marked_pages":     rep.Redactions.MarkedPages,
+		}
+		return p.Save()
+	}
+}
+
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Schedule queues a report whenever the last one is older than interval,
+// checking hourly until ctx is cancelled
+func Schedule(ctx context.Context, repo *repository.Repository, queue *jobs.Queue, interval time.Duration) {
+	for {
+		last, err := repo.WithContext(ctx).LastJob(JobType)
+		if err != nil {
+			log.Printf("Transparency report schedule: %v", err)
+		} else if last == nil || time.Since(last.CreatedAt) >= interval {
+			if _, err := queue.Enqueue(ctx, JobType, nil); err != nil {
+				log.Printf("Transparency report schedule: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Hour):
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// A minimal PDF writer for the report: text in the standard Helvetica and
+// Courier fonts, which every reader has, on A4 pages. Tables are set in
+// Courier so their columns line up.
+
+const (
+	pageWidth  = 595.0
+	pageHeight = 842.0
+	margin     = 56.0
+
+	bodySize  = 10.0
+	tableSize = 8.5
+)
+
+// Standard fonts, by resource name
+var pdfFonts = []struct{ name, base string }{
+	{"F1", "Helvetica"},
+	{"F2", "Helvetica-Bold"},
+	{"F3", "Courier"},
+	{"F4", "Courier-Bold"},
+}
+
+type pdf struct {
+	title   string
+	created time.Time
+	pages   []*bytes.Buffer // content streams
+	y       float64         // baseline of the last line set
+}
+
+func newPDF(title string, created time.Time) *pdf {
+	p := &pdf{title: title, created: created}
+	p.newPage()
+	return p
+}
+
+func (p *pdf) newPage() {
+	p.pages = append(p.pages, &bytes.Buffer{})
+	p.y = pageHeight - margin
+}
+
+// line sets one line of text below the last, starting a page when full
+func (p *pdf) line(font string, size float64, s string) {
+	lead := size * 1.35
+	if p.y-lead < margin {
+		p.newPage()
+	}
+	p.y -= lead
+	fmt.Fprintf(p.pages[len(p.pages)-1], "BT /%s %.1f Tf %.1f %.1f Td (%s) Tj ET\n", font, size, margin, p.y, pdfString(s))
+}
+
+func (p *pdf) heading(s string, size float64) {
+	p.y -= size * 0.6
+	p.line("F2", size, s)
+	p.y -= 2
+}
+
+func (p *pdf) paragraph(s string) {
+	// Helvetica averages about half an em per character
+	width := (pageWidth - 2*margin) / (bodySize * 0.52)
+	for _, l := range wrap(s, int(width)) {
+		p.line("F1", bodySize, l)
+	}
+	p.y -= 4
+}
+
+// table sets the columns padded to their widest cell, numbers right-aligned
+// after the first column, shrinking the widest column when they don't fit
+func (p *pdf) table(header []string, rows [][]string) {
+	widths := make([]int, len(header))
+	for _, row := range append([][]string{header}, rows...) {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+	const gap = 2
+	chars := (pageWidth - 2*margin) / (tableSize * 0.6) // Courier is 0.6 em wide
+	fit := int(chars) - gap*(len(widths)-1)
+	for sum(widths) > fit {
+		widest := 0
+		for i, w := range widths {
+			if w > widths[widest] {
+				widest = i
+			}
+		}
+		if widths[widest] <= 4 {
+			break
+		}
+		widths[widest]--
+	}
+
+	format := func(row []string) string {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				cell = string([]rune(cell)[:widths[i]-3]) + "..."
+			}
+			pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+			if i > 0 {
+				cells[i] = pad + cell
+			} else {
+				cells[i] = cell + pad
+			}
+		}
+		return strings.TrimRight(strings.Join(cells, strings.Repeat(" ", gap)), " ")
+	}
+
+	p.y -= 2
+	p.line("F4", tableSize, format(header))
+	for _, row := range rows {
+		p.line("F3", tableSize, format(row))
+	}
+	p.y -= 6
+}
+
+// bytes assembles the document: catalog, page tree, fonts, info and each
+// page with its content stream, numbered in the footer
+func (p *pdf) bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1 and 2, the fonts from 3, the info dictionary, then pages
+	firstPage := 3 + len(pdfFonts) + 1
+	kids := make([]string, len(p.pages))
+	for i := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	var fonts strings.Builder
+	for i, f := range pdfFonts {
+		fmt.Fprintf(&fonts, "/%s %d 0 R ", f.name, 3+i)
+	}
+
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	for _, f := range pdfFonts {
+		obj(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", f.base))
+	}
+	obj(fmt.Sprintf("<< /Title (%s) /Producer (epstein-files backend) /CreationDate (D:%s) >>",
+		pdfString(p.title), p.created.UTC().Format("20060102150405Z")))
+
+	for i, content := range p.pages {
+		fmt.Fprintf(content, "BT /F1 8.0 Tf %.1f %.1f Td (%s) Tj ET\n",
+			pageWidth-margin-60, margin/2, pdfString(fmt.Sprintf("Page %d of %d", i+1, len(p.pages))))
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << %s>> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, fonts.String(), firstPage+2*i+1))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(offsets)+1, 3+len(pdfFonts), xref)
+	return out.Bytes()
+}
+
+// pdfString escapes s for a literal string in WinAnsiEncoding; characters
+// outside Latin-1 become '?'
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// wrap breaks s into lines of at most width characters at spaces
+func wrap(s string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(s) {
+		if line != "" && utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func sum(ns []int) int {
+	total := 0
+	for _, n := range ns {
+		total += n
+	}
+	return total
+}
@@ -0,0 +1,204 @@
+// Package report builds the archive's transparency report: what it holds,
+// how much of the EFTA range that covers, how it grew and how much of it is
+// redacted, as a Markdown or PDF document
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/repository"
+)
+
+// Formats the report is written in
+var Formats = []string{"pdf", "md"}
+
+// Report is everything the transparency report states
+type Report struct {
+	ArchiveID   string
+	GeneratedAt time.Time
+	Stats       *models.Stats
+	Coverage    *models.Coverage
+	Datasets    []models.Dataset
+	Growth      []models.GrowthBucket // per month
+	Redactions  *models.RedactionStats
+}
+
+// Build gathers the report's figures from the archive
+func Build(repo *repository.Repository, archiveID string) (*Report, error) {
+	rep := &Report{ArchiveID: archiveID, GeneratedAt: time.Now().UTC()}
+	var err error
+	if rep.Stats, err = repo.GetStats(); err != nil {
+		return nil, err
+	}
+	if rep.Coverage, err = repo.GetCoverage(); err != nil {
+		return nil, err
+	}
+	if rep.Datasets, err = repo.GetDatasets(); err != nil {
+		return nil, err
+	}
+	if rep.Growth, err = repo.GetGrowth("month"); err != nil {
+		return nil, err
+	}
+	if rep.Redactions, err = repo.GetRedactionStats(); err != nil {
+		return nil, err
+	}
+	return rep, nil
+}
+
+// block is one piece of the report: a heading, a paragraph or a table
+type block struct {
+	heading string
+	text    string
+	header  []string
+	rows    [][]string
+}
+
+func (rep *Report) title() string {
+	if rep.ArchiveID == "" {
+		return "Transparency Report"
+	}
+	return "Transparency Report: " + rep.ArchiveID
+}
+
+func (rep *Report) blocks() []block {
+	s, c, red := rep.Stats, rep.Coverage, rep.Redactions
+	blocks := []block{
+		{text: "Generated " + rep.GeneratedAt.Format("2006-01-02 15:04 MST") + "."},
+
+		{heading: "Totals"},
+		{header: []string{"", "Count"}, rows: [][]string{
+			{"Documents", count(s.TotalDocuments)},
+			{"Pages", count(red.Pages)},
+			{"Images", count(s.TotalImages)},
+			{"Images with GPS", count(s.ImagesWithGPS)},
+			{"Images with a date taken", count(s.ImagesWithDate)},
+			{"Image storage", size(s.TotalSizeBytes)},
+		}},
+
+		{heading: "Coverage"},
+	}
+
+	if c.FirstID == "" {
+		blocks = append(blocks, block{text: "The archive holds no EFTA-numbered documents yet."})
+	} else {
+		blocks = append(blocks, block{text: fmt.Sprintf(
+			"From %s to %s the archive holds %s of %s numbers (%.1f%%); %s are missing.",
+			c.FirstID, c.LastID, count(c.Present), count(c.Present+c.Missing), c.Percent, count(c.Missing))})
+	}
+	if len(rep.Datasets) > 0 {
+		t := block{header: []string{"Dataset", "Released", "Documents"}}
+		for _, d := range rep.Datasets {
+			released := ""
+			if d.ReleasedAt != nil {
+				released = d.ReleasedAt.Format("2006-01-02")
+			}
+			t.rows = append(t.rows, []string{d.Name, released, count(d.DocumentCount)})
+		}
+		blocks = append(blocks, t)
+	}
+
+	blocks = append(blocks, block{heading: "Growth"})
+	if len(rep.Growth) == 0 {
+		blocks = append(blocks, block{text: "Nothing has been ingested yet."})
+	} else {
+		t := block{header: []string{"Month", "Documents added", "Images added", "Total documents", "Total images"}}
+		for _, g := range rep.Growth {
+			t.rows = append(t.rows, []string{
+				strings.TrimSuffix(g.Period, "-01"),
+				count(g.Documents), count(g.Images), count(g.TotalDocuments), count(g.TotalImages),
+			})
+		}
+		blocks = append(blocks, t)
+	}
+
+	markers := block{header: []string{"Marker", "Pages"}}
+	for _, marker := range models.RedactionMarkers {
+		markers.rows = append(markers.rows, []string{marker, count(red.Markers[marker])})
+	}
+	blocks = append(blocks,
+		block{heading: "Redactions"},
+		block{text: "Pages citing a marker contain a FOIA exemption code or the word REDACTED in their " +
+			"extracted text. Blank pages and pages without text may be fully withheld, but are counted separately."},
+		block{header: []string{"", "Count"}, rows: [][]string{
+			{"Blank pages", count(red.BlankPages)},
+			{"Pages without text", count(red.PagesWithoutText)},
+			{"Pages citing a marker", count(red.MarkedPages)},
+			{"Documents citing a marker", count(red.MarkedDocuments)},
+		}},
+		markers,
+	)
+	return blocks
+}
+
+// Markdown writes the report as a Markdown document
+func (rep *Report) Markdown(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# " + rep.title() + "\n")
+	for _, bl := range rep.blocks() {
+		b.WriteString("\n")
+		switch {
+		case bl.heading != "":
+			b.WriteString("## " + bl.heading + "\n")
+		case bl.header != nil:
+			b.WriteString(markdownRow(bl.header))
+			b.WriteString("|" + strings.Repeat("---|", len(bl.header)) + "\n")
+			for _, row := range bl.rows {
+				b.WriteString(markdownRow(row))
+			}
+		default:
+			b.WriteString(bl.text + "\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func markdownRow(cells []string) string {
+	escaped := make([]string, len(cells))
+	for i, c := range cells {
+		escaped[i] = strings.ReplaceAll(c, "|", `\|`)
+	}
+	return "| " + strings.Join(escaped, " | ") + " |\n"
+}
+
+// PDF writes the report as a PDF document
+func (rep *Report) PDF(w io.Writer) error {
+	doc := newPDF(rep.title(), rep.GeneratedAt)
+	doc.heading(rep.title(), 18)
+	for _, bl := range rep.blocks() {
+		switch {
+		case bl.heading != "":
+			doc.heading(bl.heading, 13)
+		case bl.header != nil:
+			doc.table(bl.header, bl.rows)
+		default:
+			doc.paragraph(bl.text)
+		}
+	}
+	_, err := w.Write(doc.bytes())
+	return err
+}
+
+// count formats n with thousands separators
+func count(n int64) string {
+	if n < 0 {
+		return "-" + count(-n)
+	}
+	s := fmt.Sprint(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+func size(bytes int64) string {
+	const gb = 1 << 30
+	if bytes >= gb {
+		return fmt.Sprintf("%.1f GB", float64(bytes)/gb)
+	}
+	return fmt.Sprintf("%.1f MB", float64(bytes)/(1<<20))
+}
@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/epstein-files/backend/internal/models"
+)
+
+// Meta keys recording FTS maintenance; populate_db.py sets the rebuild time
+const (
+	metaFTSLastRebuild  = "fts.last_rebuild"
+	metaFTSLastOptimize = "fts.last_optimize"
+)
+
+// ErrFTSUnavailable is returned when the documents_fts table doesn't exist
+var ErrFTSUnavailable = newError(ErrNotFound, "full-text index not available")
+
+var (
+	ftsModule    = regexp.MustCompile(`(?i)USING\s+(fts\d)`)
+	ftsTokenizer = regexp.MustCompile(`(?i)tokenize\s*=\s*['"]?([a-z0-9_ ]+)`)
+)
+
+// Ping runs a trivial query, to check the database answers
+func (r *Repository) Ping() error {
+	r, end := r.trace("Ping")
+	defer end()
+
+	var one int
+	return r.db.Raw("SELECT 1").Scan(&one).Error
+}
+
+// GetSchemaVersion returns the schema version recorded by the last migration
+func (r *Repository) GetSchemaVersion() (int, error) {
+	r, end := r.trace("GetSchemaVersion")
+	defer end()
+
+	return models.StoredSchemaVersion(r.db)
+}
+
+// GetFTSStatus reports index size against the documents table and how the
+// index was built, compared with the configured fts options
+func (r *Repository) GetFTSStatus(fts models.FTSOptions) (*models.FTSStatus, error) {
+	r, end := r.trace("GetFTSStatus")
+	defer end()
+
+	status := &models.FTSStatus{}
+
+	var fts5 int
+	r.db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5)
+	status.FTS5Available = fts5 == 1
+
+	r.db.Model(&models.Document{}).Count(&status.Documents)
+	r.db.Model(&models.DocumentText{}).Where("text IS NOT NULL AND text != ''").Count(&status.DocumentsWithText)
+
+	var ddl string
+	r.db.Raw("SELECT sql FROM sqlite_master WHERE type='table' AND name='documents_fts'").Scan(&ddl)
+	if ddl != "" {
+		status.Available = true
+		if m := ftsModule.FindStringSubmatch(ddl); m != nil {
+			status.Module = strings.ToLower(m[1])
+		}
+		status.Tokenizer = defaultTokenizer(status.Module)
+		if m := ftsTokenizer.FindStringSubmatch(ddl); m != nil {
+			status.Tokenizer = strings.TrimSpace(m[1])
+		}
+
+		if err := r.db.Raw("SELECT COUNT(*) FROM documents_fts").Scan(&status.IndexedRows).Error; err != nil {
+			return nil, err
+		}
+		status.InSync = status.IndexedRows == status.DocumentsWithText
+
+		// Only FTS5 records its tokenizer options in full
+		if status.Module == "fts5" {
+			status.ConfiguredTokenizer = fts.Tokenizer()
+			status.TokenizerOutdated = normalizeTokenizer(status.Tokenizer) != status.ConfiguredTokenizer
+		}
+	}
+
+	var err error
+	if status.LastRebuild, err = r.GetMeta(metaFTSLastRebuild); err != nil {
+		return nil, err
+	}
+	if status.LastOptimize, err = r.GetMeta(metaFTSLastOptimize); err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// OptimizeFTS merges the index b-trees. It holds the write lock while it
+// runs, so callers should not run it concurrently.
+func (r *Repository) OptimizeFTS() error {
+	r, end := r.trace("OptimizeFTS")
+	defer end()
+
+	var count int64
+	r.db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='documents_fts'").Scan(&count)
+	if count == 0 {
+		return ErrFTSUnavailable
+	}
+
+	if err := r.db.Exec("INSERT INTO documents_fts(documents_fts) VALUES('optimize')").Error; err != nil {
+		return err
+	}
+	return r.SetMeta(metaFTSLastOptimize, time.Now().UTC().Format(time.RFC3339))
+}
+
+// normalizeTokenizer spells out unicode61's implied remove_diacritics 1 so
+// FTS5 tokenize arguments compare equal
+func normalizeTokenizer(tokenizer string) string {
+	tokenizer = strings.Join(strings.Fields(strings.ToLower(tokenizer)), " ")
+	if strings.HasSuffix(tokenizer, "unicode61") {
+		tokenizer += " remove_diacritics 1"
+	}
+	return tokenizer
+}
+
+func defaultTokenizer(module string) string {
+	switch module {
+	case "fts5":
+		return "unicode61"
+	case "fts4", "fts3":
+		return "simple"
+	}
+	return ""
+}
+
+// GetOverview collects the database-side figures of the admin overview:
+// job queue, last ingest, database pages and recorded file sizes
+func (r *Repository) GetOverview() (*models.Overview, error) {
+	r, end := r.trace("GetOverview")
+	defer end()
+
+	o := &models.Overview{GeneratedAt: time.Now().UTC()}
+
+	if err := r.db.Model(&models.Job{}).Where("status = ?", models.JobQueued).Count(&o.Jobs.Queued).Error; err != nil {
+		return nil, err
+	}
+	r.db.Model(&models.Job{}).Where("status = ?", models.JobRunning).Count(&o.Jobs.Running)
+	r.db.Model(&models.Job{}).
+		Where("status = ? AND finished_at >= ?", models.JobFailed, time.Now().Add(-24*time.Hour)).
+		Count(&o.Jobs.Failed24h)
+	var oldest models.Job
+	if err := r.db.Where("status = ?", models.JobQueued).Order("id ASC").Limit(1).Find(&oldest).Error; err != nil {
+		return nil, err
+	}
+	if oldest.ID != 0 {
+		o.Jobs.OldestQueued = &oldest
+	}
+
+	r.db.Raw("SELECT COALESCE(MAX(updated_at), '') FROM documents").Scan(&o.LastIngestAt)
+
+	var pages struct {
+		PageSize, PageCount, FreelistCount int64
+	}
+	r.db.Raw("PRAGMA page_size").Scan(&pages.PageSize)
+	r.db.Raw("PRAGMA page_count").Scan(&pages.PageCount)
+	r.db.Raw("PRAGMA freelist_count").Scan(&pages.FreelistCount)
+	o.Database.SizeBytes = pages.PageSize * pages.PageCount
+	o.Database.FreeBytes = pages.PageSize * pages.FreelistCount
+
+	s := &o.Storage
+	err := r.db.Raw(`
+		SELECT
+			(SELECT COUNT(*) FROM documents) AS documents,
+			(SELECT COALESCE(SUM(size_bytes), 0) FROM documents) AS document_bytes,
+			(SELECT COUNT(*) FROM images) AS images,
+			(SELECT COALESCE(SUM(size_bytes), 0) FROM images) AS image_bytes,
+			(SELECT COALESCE(SUM(size_bytes), 0) FROM dataset_files) AS dataset_file_bytes,
+			(SELECT COALESCE(SUM(size_bytes), 0) FROM contributions) AS contribution_bytes
+	`).Scan(s).Error
+	if err != nil {
+		return nil, err
+	}
+	s.TotalBytes = s.DocumentBytes + s.ImageBytes + s.DatasetFileBytes + s.ContributionBytes
+
+	return o, nil
+}
@@ -0,0 +1,25 @@
+package repository
+
+import "github.com/epstein-files/backend/internal/models"
+
+// RecordAudit adds an entry to the audit log
+func (r *Repository) RecordAudit(entry *models.AuditEntry) error {
+	r, end := r.trace("RecordAudit")
+	defer end()
+
+	return r.db.Create(entry).Error
+}
+
+// GetAuditLog lists audit entries newest first, optionally for one target
+func (r *Repository) GetAuditLog(target string, limit int) ([]models.AuditEntry, error) {
+	r, end := r.trace("GetAuditLog")
+	defer end()
+
+	entries := []models.AuditEntry{}
+	query := r.db.Order("id DESC").Limit(limit)
+	if target != "" {
+		query = query.Where("target = ?", target)
+	}
+	err := query.Find(&entries).Error
+	return entries, err
+}
@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/epstein-files/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============================================================================
+// BLOBS
+// ============================================================================
+
+// AddBlobRef points kind/owner at blob, storing the blob row if it's new.
+// The blob the owner referred to before, if another, loses a reference.
+func (r *Repository) AddBlobRef(blob *models.Blob, kind, owner string) error {
+	r, end := r.trace("AddBlobRef")
+	defer end()
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(blob).Error; err != nil {
+			return err
+		}
+		var old models.BlobRef
+		err := tx.Where("kind = ? AND owner = ?", kind, owner).First(&old).Error
+		switch {
+		case err == nil && old.SHA256 == blob.SHA256:
+			return nil
+		case err == nil:
+			if err := tx.Model(&old).Update("sha256", blob.SHA256).Error; err != nil {
+				return err
+			}
+			if err := adjustRefCount(tx, old.SHA256, -1); err != nil {
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := tx.Create(&models.BlobRef{Kind: kind, Owner: owner, SHA256: blob.SHA256}).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+		return adjustRefCount(tx, blob.SHA256, 1)
+	})
+}
+
+func adjustRefCount(tx *gorm.DB, sha string, by int) error {
+	return tx.Model(&models.Blob{}).Where("sha256 = ?", sha).
+		Update("ref_count", gorm.Expr("ref_count + ?", by)).Error
+}
+
+// GetBlob returns a blob that something still refers to, nil when there is
+// none
+func (r *Repository) GetBlob(sha string) (*models.Blob, error) {
+	r, end := r.trace("GetBlob")
+	defer end()
+
+	var blob models.Blob
+	err := r.db.Where("sha256 = ? AND ref_count > 0", sha).First(&blob).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &blob, nil
+}
+
+// GetBlobRefs returns the blob hash of each of the owners of kind that has
+// one
+func (r *Repository) GetBlobRefs(kind string, owners []string) (map[string]string, error) {
+	r, end := r.trace("GetBlobRefs")
+	defer end()
+
+	refs := make(map[string]string)
+	if len(owners) == 0 {
+		return refs, nil
+	}
+	var rows []models.BlobRef
+	if err := r.db.Where("kind = ? AND owner IN ?", kind, owners).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, ref := range rows {
+		refs[ref.Owner] = ref.SHA256
+	}
+	return refs, nil
+}
+
+// GetBlobCandidates returns the next documents or images after rowid, in
+// rowid order, for the blob import
+func (r *Repository) GetBlobCandidates(kind string, after uint, limit int) ([]models.BlobCandidate, error) {
+	r, end := r.trace("GetBlobCandidates")
+	defer end()
+
+	var rows []models.BlobCandidate
+	var err error
+	switch kind {
+	case models.BlobDocument:
+		err = r.db.Raw(`SELECT rowid AS row_id, id AS owner, filename, COALESCE(sha256, '') AS sha256
+			FROM documents WHERE rowid > ? ORDER BY rowid LIMIT ?`, after, limit).Scan(&rows).Error
+	case models.BlobImage:
+		err = r.db.Raw(`SELECT id AS row_id, CAST(id AS TEXT) AS owner, document_id, filename, COALESCE(sha256, '') AS sha256
+			FROM images WHERE id > ? ORDER BY id LIMIT ?`, after, limit).Scan(&rows).Error
+	default:
+		return nil, invalidf("unknown blob kind %s", kind)
+	}
+	return rows, err
+}
+
+// CountBlobCandidates counts the documents and images the blob import goes
+// through
+func (r *Repository) CountBlobCandidates() (int64, error) {
+	r, end := r.trace("CountBlobCandidates")
+	defer end()
+
+	var documents, images int64
+	if err := r.db.Model(&models.Document{}).Count(&documents).Error; err != nil {
+		return 0, err
+	}
+	if err := r.db.Model(&models.Image{}).Count(&images).Error; err != nil {
+		return 0, err
+	}
+	return documents + images, nil
+}
+
+// PruneBlobRefs drops the references of documents and images that are
+// gone, and recounts every blob's references. It returns the references
+// dropped.
+func (r *Repository) PruneBlobRefs() (int64, error) {
+	r, end := r.trace("PruneBlobRefs")
+	defer end()
+
+	var dropped int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Exec(`DELETE FROM blob_refs WHERE
+			(kind = ? AND owner NOT IN (SELECT id FROM documents)) OR
+			(kind = ? AND owner NOT IN (SELECT CAST(id AS TEXT) FROM images))`,
+			models.BlobDocument, models.BlobImage)
+		if res.Error != nil {
+			return res.Error
+		}
+		dropped = res.RowsAffected
+		return tx.Exec(`UPDATE blobs SET ref_count =
+			(SELECT COUNT(*) FROM blob_refs WHERE blob_refs.sha256 = blobs.sha256)`).Error
+	})
+	return dropped, err
+}
+
+// GetOrphanBlobs returns up to limit blobs nothing refers to
+func (r *Repository) GetOrphanBlobs(limit int) ([]models.Blob, error) {
+	r, end := r.trace("GetOrphanBlobs")
+	defer end()
+
+	var blobs []models.Blob
+	err := r.db.Where("ref_count <= 0").Order("sha256").Limit(limit).Find(&blobs).Error
+	return blobs, err
+}
+
+// DeleteBlob drops a blob's row, unless it has been referenced again
+// meanwhile; deleted is false then
+func (r *Repository) DeleteBlob(sha string) (deleted bool, err error) {
+	r, end := r.trace("DeleteBlob")
+	defer end()
+
+	res := r.db.Where("sha256 = ? AND ref_count <= 0", sha).Delete(&models.Blob{})
+	return res.RowsAffected > 0, res.Error
+}
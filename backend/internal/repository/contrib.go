@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/epstein-files/backend/internal/models"
+)
+
+// ErrAlreadyReviewed is returned when moderating a contribution that is not pending
+var ErrAlreadyReviewed = newError(ErrConflict, "contribution has already been reviewed")
+
+// ============================================================================
+// CONTRIBUTIONS
+// ============================================================================
+
+// FindByHash returns the ID of the document or contribution that already
+// holds a file with this SHA-256, or empty strings when the file is new
+func (r *Repository) FindByHash(sha256 string) (documentID string, contributionID uint, err error) {
+	r, end := r.trace("FindByHash")
+	defer end()
+
+	var docIDs []string
+	err = r.db.Model(&models.Document{}).Where("sha256 = ?", sha256).Limit(1).Pluck("id", &docIDs).Error
+	if err != nil || len(docIDs) > 0 {
+		if len(docIDs) > 0 {
+			documentID = docIDs[0]
+		}
+		return documentID, 0, err
+	}
+
+	var ids []uint
+	err = r.db.Model(&models.Contribution{}).Where("sha256 = ?", sha256).Limit(1).Pluck("id", &ids).Error
+	if len(ids) > 0 {
+		contributionID = ids[0]
+	}
+	return "", contributionID, err
+}
+
+func (r *Repository) CreateContribution(c *models.Contribution) error {
+	r, end := r.trace("CreateContribution")
+	defer end()
+
+	if c.Status == "" {
+		c.Status = models.ContribPending
+	}
+	return r.db.Create(c).Error
+}
+
+func (r *Repository) GetContribution(id uint) (*models.Contribution, error) {
+	r, end := r.trace("GetContribution")
+	defer end()
+
+	var c models.Contribution
+	if err := r.db.First(&c, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &c, nil
+}
+
+// GetContributions returns contributions, oldest first, optionally by
+// status and contributor
+func (r *Repository) GetContributions(status, contributor, cursor string, limit int) (*models.PaginatedResponse, error) {
+	r, end := r.trace("GetContributions")
+	defer end()
+
+	query := r.db.Model(&models.Contribution{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if contributor != "" {
+		query = query.Where("contributor = ?", contributor)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	c := pageCursor(cursor)
+	order := "id ASC"
+	if c != nil {
+		if c.Before {
+			query = query.Where("id < ?", c.LastID)
+			order = "id DESC"
+		} else {
+			query = query.Where("id > ?", c.LastID)
+		}
+	}
+
+	contributions := []models.Contribution{}
+	if err := query.Order(order).Limit(limit + 1).Find(&contributions).Error; err != nil {
+		return nil, err
+	}
+
+	resp := &models.PaginatedResponse{Total: total}
+	resp.Data = keysetPage(resp, contributions, limit, c, func(c models.Contribution) models.Cursor {
+		return models.Cursor{LastID: c.ID}
+	})
+	return resp, nil
+}
+
+// ReviewContribution moves a pending contribution to approved or rejected
+func (r *Repository) ReviewContribution(c *models.Contribution, status, note, documentID string) error {
+	r, end := r.trace("ReviewContribution")
+	defer end()
+
+	now := time.Now()
+	res := r.db.Model(c).Where("status = ?", models.ContribPending).Updates(map[string]interface{}{
+		"status":      status,
+		"review_note": note,
+		"reviewed_at": now,
+		"document_id": documentID,
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrAlreadyReviewed
+	}
+
+	c.Status = status
+	c.ReviewNote = note
+	c.ReviewedAt = &now
+	c.DocumentID = documentID
+	return nil
+}
+
+// DocumentExists reports whether a document ID is taken
+func (r *Repository) DocumentExists(id string) (bool, error) {
+	r, end := r.trace("DocumentExists")
+	defer end()
+
+	var count int64
+	err := r.db.Model(&models.Document{}).Where("id = ?", id).Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"github.com/epstein-files/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// PAGE AND IMAGE COUNTS
+// ============================================================================
+
+// CountRecord is a document whose counts the backfill job fills in,
+// addressed by rowid like FileRecord
+type CountRecord struct {
+	RowID      uint   `gorm:"column:rowid"`
+	ID         string `gorm:"column:id"`
+	Filename   string `gorm:"column:filename"`
+	PageCount  int    `gorm:"column:page_count"`
+	ImageCount int    `gorm:"column:image_count"`
+}
+
+// DocumentCounts are the counts to write back to one document
+type DocumentCounts struct {
+	ID         string
+	PageCount  int
+	ImageCount int
+}
+
+// countCandidates selects every document with all, else those missing a
+// page or image count
+func (r *Repository) countCandidates(all bool) *gorm.DB {
+	q := r.db.Model(&models.Document{})
+	if !all {
+		q = q.Where("COALESCE(page_count, 0) = 0 OR COALESCE(image_count, 0) = 0")
+	}
+	return q
+}
+
+// CountCountCandidates counts the documents GetCountCandidates will visit
+func (r *Repository) CountCountCandidates(all bool) (int64, error) {
+	r, end := r.trace("CountCountCandidates")
+	defer end()
+
+	var count int64
+	err := r.countCandidates(all).Count(&count).Error
+	return count, err
+}
+
+// GetCountCandidates returns the documents after afterRowID to backfill
+func (r *Repository) GetCountCandidates(afterRowID uint, all bool, limit int) ([]CountRecord, error) {
+	r, end := r.trace("GetCountCandidates")
+	defer end()
+
+	records := []CountRecord{}
+	err := r.countCandidates(all).
+		Select("rowid, id, filename, page_count, image_count").
+		Where("rowid > ?", afterRowID).
+		Order("rowid ASC").Limit(limit).Scan(&records).Error
+	return records, err
+}
+
+// GetImageCounts returns how many extracted images each document has;
+// documents without any are left out
+func (r *Repository) GetImageCounts(documentIDs []string) (map[string]int, error) {
+	r, end := r.trace("GetImageCounts")
+	defer end()
+
+	var rows []struct {
+		DocumentID string
+		Images     int
+	}
+	err := r.db.Model(&models.Image{}).
+		Select("document_id, COUNT(*) AS images").
+		Where("document_id IN ?", documentIDs).
+		Group("document_id").Scan(&rows).Error
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.DocumentID] = row.Images
+	}
+	return counts, err
+}
+
+// UpdateDocumentCounts writes a batch of counts in one transaction, so the
+// database is locked once per batch rather than once per document
+func (r *Repository) UpdateDocumentCounts(counts []DocumentCounts) error {
+	r, end := r.trace("UpdateDocumentCounts")
+	defer end()
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for _, c := range counts {
+			err := tx.Model(&models.Document{}).Where("id = ?", c.ID).Updates(map[string]interface{}{
+				"page_count":  c.PageCount,
+				"image_count": c.ImageCount,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
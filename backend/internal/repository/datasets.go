@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/epstein-files/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// DATASETS
+// ============================================================================
+
+// datasetURLPatterns returns the source URL path segments of a DOJ dataset,
+// URL-encoded and plain
+func datasetURLPatterns(n int) (string, string) {
+	return fmt.Sprintf("DataSet%%20%d/", n), fmt.Sprintf("DataSet %d/", n)
+}
+
+// GetDatasets lists every dataset with its files, leaving out their text
+func (r *Repository) GetDatasets() ([]models.Dataset, error) {
+	r, end := r.trace("GetDatasets")
+	defer end()
+
+	datasets := []models.Dataset{}
+	err := r.db.Preload("Files", func(db *gorm.DB) *gorm.DB {
+		return db.Omit("text").Order("kind ASC, filename ASC")
+	}).Order("id ASC").Find(&datasets).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range datasets {
+		if err := r.countDatasetDocuments(&datasets[i]); err != nil {
+			return nil, err
+		}
+	}
+	return datasets, nil
+}
+
+// GetDataset returns one dataset with the full text of its files
+func (r *Repository) GetDataset(id uint) (*models.Dataset, error) {
+	r, end := r.trace("GetDataset")
+	defer end()
+
+	var dataset models.Dataset
+	err := r.db.Preload("Files", func(db *gorm.DB) *gorm.DB {
+		return db.Order("kind ASC, filename ASC")
+	}).First(&dataset, id).Error
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	if err := r.countDatasetDocuments(&dataset); err != nil {
+		return nil, err
+	}
+	return &dataset, nil
+}
+
+func (r *Repository) countDatasetDocuments(dataset *models.Dataset) error {
+	return r.datasetDocuments(dataset.ID).Count(&dataset.DocumentCount).Error
+}
+
+// ============================================================================
+// DATASET REMOVAL
+// ============================================================================
+
+// documentRows are the tables holding rows of a document, children before
+// their parents, each with the condition selecting those of the documents in
+// ?. Blob references are left to the blob GC (PruneBlobRefs), and the sizes
+// of near-duplicate clusters to the next clustering job.
+var documentRows = []struct{ table, where string }{
+	{"image_tags", "image_id IN (SELECT id FROM images WHERE document_id IN (?))"},
+	{"faces", "document_id IN (?)"},
+	{"images", "document_id IN (?)"},
+	{"pages", "document_id IN (?)"},
+	{"document_tables", "document_id IN (?)"},
+	{"document_sprites", "document_id IN (?)"},
+	{"passages", "document_id IN (?)"},
+	{"document_signatures", "document_id IN (?)"},
+	{"document_cluster_members", "document_id IN (?)"},
+	{"file_tiers", "document_id IN (?)"},
+	{"documents_fts", "document_id IN (?)"},
+	{"document_texts", "document_id IN (?)"},
+	{"documents", "id IN (?)"},
+}
+
+// StoredDocument is a document with the names of the files storage holds
+// for it: its source PDF, extracted images and sprite sheets
+type StoredDocument struct {
+	ID       string   `gorm:"column:id"`
+	Filename string   `gorm:"column:filename"`
+	Images   []string `gorm:"-"`
+	Sprites  []string `gorm:"-"` // CDN URLs
+}
+
+// datasetDocuments selects the documents whose source URL lies in a dataset
+func (r *Repository) datasetDocuments(id uint) *gorm.DB {
+	encoded, plain := datasetURLPatterns(int(id))
+	return r.db.Model(&models.Document{}).
+		Where("instr(source_url, ?) > 0 OR instr(source_url, ?) > 0", encoded, plain)
+}
+
+// GetDatasetFootprint counts the rows removing a dataset would delete, by
+// table: those of its documents, its metadata files and its own. Tables
+// the database doesn't have are left out.
+func (r *Repository) GetDatasetFootprint(id uint) (map[string]int64, error) {
+	r, end := r.trace("GetDatasetFootprint")
+	defer end()
+
+	footprint := map[string]int64{}
+	documents := r.datasetDocuments(id).Select("id")
+	for _, t := range documentRows {
+		if !r.db.Migrator().HasTable(t.table) {
+			continue
+		}
+		var count int64
+		if err := r.db.Table(t.table).Where(t.where, documents).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		footprint[t.table] = count
+	}
+
+	var files, datasets int64
+	if err := r.db.Model(&models.DatasetFile{}).Where("dataset_id = ?", id).Count(&files).Error; err != nil {
+		return nil, err
+	}
+	if err := r.db.Model(&models.Dataset{}).Where("id = ?", id).Count(&datasets).Error; err != nil {
+		return nil, err
+	}
+	footprint["dataset_files"] = files
+	footprint["datasets"] = datasets
+	return footprint, nil
+}
+
+// GetDatasetDocuments returns the first documents of a dataset with their
+// stored files, for the removal to work through a batch at a time
+func (r *Repository) GetDatasetDocuments(id uint, limit int) ([]StoredDocument, error) {
+	r, end := r.trace("GetDatasetDocuments")
+	defer end()
+
+	documents := []StoredDocument{}
+	err := r.datasetDocuments(id).Select("id, filename").
+		Order("rowid ASC").Limit(limit).Scan(&documents).Error
+	if err != nil || len(documents) == 0 {
+		return documents, err
+	}
+
+	ids := make([]string, len(documents))
+	byID := make(map[string]*StoredDocument, len(documents))
+	for i := range documents {
+		ids[i] = documents[i].ID
+		byID[documents[i].ID] = &documents[i]
+	}
+	var images []models.Image
+	if err := r.db.Select("document_id, filename").Where("document_id IN ?", ids).Find(&images).Error; err != nil {
+		return nil, err
+	}
+	for _, img := range images {
+		byID[img.DocumentID].Images = append(byID[img.DocumentID].Images, img.Filename)
+	}
+	var sprites []models.DocumentSprite
+	if err := r.db.Select("document_id, cdn_url").Where("document_id IN ?", ids).Find(&sprites).Error; err != nil {
+		return nil, err
+	}
+	for _, s := range sprites {
+		byID[s.DocumentID].Sprites = append(byID[s.DocumentID].Sprites, s.CDNUrl)
+	}
+	return documents, nil
+}
+
+// DeleteDocuments removes documents with every row of theirs in one
+// transaction, returning how many rows went by table. The change log
+// records the deletes of the tables it tracks for mirrors to follow; the
+// signatures, cluster memberships and tiers aren't logged, so a mirror keeps
+// its own for the removed documents.
+func (r *Repository) DeleteDocuments(ids []string) (map[string]int64, error) {
+	r, end := r.trace("DeleteDocuments")
+	defer end()
+
+	deleted := map[string]int64{}
+	if len(ids) == 0 {
+		return deleted, nil
+	}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for _, t := range documentRows {
+			if !tx.Migrator().HasTable(t.table) {
+				continue
+			}
+			res := tx.Exec("DELETE FROM "+t.table+" WHERE "+t.where, ids)
+			if res.Error != nil {
+				return holdError(res.Error)
+			}
+			deleted[t.table] = res.RowsAffected
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// DeleteDataset removes a dataset and its metadata files, returning the
+// files for their stored copies to be deleted too, and whether the dataset
+// had a row. Its documents go first, with DeleteDocuments.
+func (r *Repository) DeleteDataset(id uint) (files []models.DatasetFile, datasets int64, err error) {
+	r, end := r.trace("DeleteDataset")
+	defer end()
+
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("text").Where("dataset_id = ?", id).Find(&files).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("dataset_id = ?", id).Delete(&models.DatasetFile{}).Error; err != nil {
+			return holdError(err)
+		}
+		res := tx.Delete(&models.Dataset{}, id)
+		datasets = res.RowsAffected
+		return holdError(res.Error)
+	})
+	return files, datasets, err
+}
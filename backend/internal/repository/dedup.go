@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"github.com/epstein-files/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============================================================================
+// NEAR-DUPLICATE CLUSTERS
+// ============================================================================
+
+// TextRecord is a document's text, addressed by rowid so batch jobs can walk
+// documents in a stable order
+type TextRecord struct {
+	RowID    uint   `gorm:"column:rowid"`
+	ID       string `gorm:"column:id"`
+	FullText string `gorm:"column:full_text"`
+}
+
+// GetDocumentTextBatch returns the text of documents after afterRowID
+func (r *Repository) GetDocumentTextBatch(afterRowID uint, limit int) ([]TextRecord, error) {
+	r, end := r.trace("GetDocumentTextBatch")
+	defer end()
+
+	records := []TextRecord{}
+	err := r.db.Model(&models.Document{}).
+		Select("documents.rowid, documents.id, document_texts.text AS full_text").
+		Joins("LEFT JOIN document_texts ON document_texts.document_id = documents.id").
+		Where("documents.rowid > ?", afterRowID).
+		Order("documents.rowid ASC").Limit(limit).Scan(&records).Error
+	return records, err
+}
+
+func (r *Repository) CountDocuments() (int64, error) {
+	r, end := r.trace("CountDocuments")
+	defer end()
+
+	var count int64
+	err := r.db.Model(&models.Document{}).Count(&count).Error
+	return count, err
+}
+
+// SaveDocumentSignatures inserts or replaces signatures
+func (r *Repository) SaveDocumentSignatures(sigs []models.DocumentSignature) error {
+	r, end := r.trace("SaveDocumentSignatures")
+	defer end()
+
+	if len(sigs) == 0 {
+		return nil
+	}
+	return r.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&sigs).Error
+}
+
+// GetDocumentSignatures returns the signatures of existing documents with at
+// least minShingles shingles
+func (r *Repository) GetDocumentSignatures(minShingles int) ([]models.DocumentSignature, error) {
+	r, end := r.trace("GetDocumentSignatures")
+	defer end()
+
+	var sigs []models.DocumentSignature
+	err := r.db.Where("shingles >= ? AND document_id IN (SELECT id FROM documents)", minShingles).
+		Order("document_id ASC").Find(&sigs).Error
+	return sigs, err
+}
+
+// ReplaceDocumentClusters swaps the stored clusters for a new set in one
+// transaction, so readers never see a half-built clustering
+func (r *Repository) ReplaceDocumentClusters(clusters []models.DocumentCluster) error {
+	r, end := r.trace("ReplaceDocumentClusters")
+	defer end()
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM document_cluster_members").Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM document_clusters").Error; err != nil {
+			return err
+		}
+		for i := range clusters {
+			// Members are saved with the cluster
+			if err := tx.Create(&clusters[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetDocumentCluster returns the near-duplicate cluster containing a
+// document with its members, or nil if the document has no near-duplicates
+func (r *Repository) GetDocumentCluster(documentID string) (*models.DocumentCluster, error) {
+	r, end := r.trace("GetDocumentCluster")
+	defer end()
+
+	var clusterIDs []uint
+	err := r.db.Model(&models.DocumentClusterMember{}).Where("document_id = ?", documentID).
+		Pluck("cluster_id", &clusterIDs).Error
+	if err != nil || len(clusterIDs) == 0 {
+		return nil, err
+	}
+
+	var cluster models.DocumentCluster
+	err = r.db.
+		Preload("Members", func(db *gorm.DB) *gorm.DB {
+			return db.Order("similarity DESC").Order("document_id ASC")
+		}).
+		Preload("Members.Document").
+		First(&cluster, clusterIDs[0]).Error
+	if err != nil {
+		return nil, err
+	}
+	return &cluster, nil
+}
+
+// documentClusters maps each of ids that belongs to a cluster to its cluster ID
+func (r *Repository) documentClusters(ids []string) (map[string]uint, error) {
+	var members []models.DocumentClusterMember
+	err := r.db.Select("document_id, cluster_id").Where("document_id IN ?", ids).Find(&members).Error
+	if err != nil {
+		return nil, err
+	}
+
+	clusters := make(map[string]uint, len(members))
+	for _, m := range members {
+		clusters[m.DocumentID] = m.ClusterID
+	}
+	return clusters, nil
+}
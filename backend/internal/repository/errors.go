@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Kinds of repository error. The errors the repository returns on purpose
+// match one of them with errors.Is, so the API can answer each with its own
+// status; any other error is internal.
+var (
+	// ErrNotFound is a record, or a feature of the database, that isn't there
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is a change the current state of a record doesn't allow
+	ErrConflict = errors.New("conflict")
+	// ErrInvalid is a request the repository can't make sense of
+	ErrInvalid = errors.New("invalid")
+)
+
+// kindError is an error of a kind, with its own message and optionally a
+// cause it still matches
+type kindError struct {
+	kind error
+	msg  string
+	err  error
+}
+
+func (e *kindError) Error() string        { return e.msg }
+func (e *kindError) Is(target error) bool { return target == e.kind }
+func (e *kindError) Unwrap() error        { return e.err }
+
+func newError(kind error, msg string) error {
+	return &kindError{kind: kind, msg: msg}
+}
+
+func invalidf(format string, args ...interface{}) error {
+	return &kindError{kind: ErrInvalid, msg: fmt.Sprintf(format, args...)}
+}
+
+// notFound makes gorm's record not found an ErrNotFound; it still matches
+// gorm.ErrRecordNotFound
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &kindError{kind: ErrNotFound, msg: err.Error(), err: err}
+	}
+	return err
+}
@@ -0,0 +1,308 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/epstein-files/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Batch size used when walking whole tables for exports
+const exportBatchSize = 1000
+
+// EachDocumentBatch walks all documents in ID order, exportBatchSize at a time
+func (r *Repository) EachDocumentBatch(fn func([]models.Document) error) error {
+	r, end := r.trace("EachDocumentBatch")
+	defer end()
+
+	var lastID string
+	for {
+		var batch []models.Document
+		err := r.db.Where("id > ?", lastID).Order("id ASC").Limit(exportBatchSize).Find(&batch).Error
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+}
+
+// EachImageBatch walks all images in ID order, exportBatchSize at a time
+func (r *Repository) EachImageBatch(fn func([]models.Image) error) error {
+	r, end := r.trace("EachImageBatch")
+	defer end()
+
+	var lastID uint
+	for {
+		var batch []models.Image
+		err := r.db.Where("id > ?", lastID).Order("id ASC").Limit(exportBatchSize).Find(&batch).Error
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+}
+
+// Backup writes a complete, consistent copy of the database to path, face
+// detections included. The target must not already exist.
+func (r *Repository) Backup(path string) error {
+	r, end := r.trace("Backup")
+	defer end()
+
+	return r.db.Exec("VACUUM INTO ?", path).Error
+}
+
+// snapshotTables are the tables snapshot.db keeps. Every other table is
+// dropped, so one added later stays private until it is listed here. Face
+// detections are not, as their embeddings must not leave the server, and
+// neither are API keys and their usage, sessions, the audit log, jobs,
+// storage bookkeeping and instance state.
+var snapshotTables = map[string]bool{
+	"documents":                true,
+	"document_texts":           true,
+	"documents_fts":            true, // with its shadow tables
+	"pages":                    true,
+	"images":                   true,
+	"image_tags":               true,
+	"document_tables":          true,
+	"document_sprites":         true,
+	"document_signatures":      true,
+	"document_clusters":        true,
+	"document_cluster_members": true,
+	"passages":                 true,
+	"datasets":                 true,
+	"dataset_files":            true,
+	"contributions":            true, // approved only, see VacuumInto
+	"meta":                     true, // the schema version only
+}
+
+func inSnapshot(table string) bool {
+	return snapshotTables[table] || strings.HasPrefix(table, "documents_fts_") || strings.HasPrefix(table, "sqlite_")
+}
+
+// VacuumInto writes a compacted, consistent copy of the database to path,
+// keeping only snapshotTables. The target must not already exist. Of
+// contributions only the approved are kept, without who uploaded them,
+// their notes or where they are stored. Triggers are dropped, as the change
+// log they write to stays behind.
+func (r *Repository) VacuumInto(path string) error {
+	r, end := r.trace("VacuumInto")
+	defer end()
+
+	if err := r.db.Exec("VACUUM INTO ?", path).Error; err != nil {
+		return err
+	}
+
+	// ATTACH and the foreign keys pragma are per connection, so keep to one
+	return r.db.Connection(func(tx *gorm.DB) error {
+		if err := tx.Exec("ATTACH DATABASE ? AS snapshot", path).Error; err != nil {
+			return err
+		}
+		defer tx.Exec("DETACH DATABASE snapshot")
+		// Dropped tables may be referred to by others dropped later
+		var enforced int
+		if err := tx.Raw("PRAGMA foreign_keys").Scan(&enforced).Error; err != nil {
+			return err
+		}
+		if enforced == 1 {
+			tx.Exec("PRAGMA foreign_keys = OFF")
+			defer tx.Exec("PRAGMA foreign_keys = ON")
+		}
+
+		var triggers, tables []string
+		if err := tx.Raw("SELECT name FROM snapshot.sqlite_master WHERE type = 'trigger'").Scan(&triggers).Error; err != nil {
+			return err
+		}
+		if err := tx.Raw("SELECT name FROM snapshot.sqlite_master WHERE type = 'table'").Scan(&tables).Error; err != nil {
+			return err
+		}
+
+		stmts := []string{"PRAGMA snapshot.secure_delete = ON"}
+		for _, trigger := range triggers {
+			stmts = append(stmts, fmt.Sprintf("DROP TRIGGER snapshot.%q", trigger))
+		}
+		stmts = append(stmts,
+			"DELETE FROM snapshot.contributions WHERE status <> '"+models.ContribApproved+"'",
+			"UPDATE snapshot.contributions SET contributor = '', notes = NULL, review_note = NULL, storage_key = ''",
+			"DELETE FROM snapshot.meta WHERE key <> '"+models.MetaSchemaVersion+"'",
+		)
+		for _, table := range tables {
+			if !inSnapshot(table) {
+				stmts = append(stmts, fmt.Sprintf("DROP TABLE snapshot.%q", table))
+			}
+		}
+		stmts = append(stmts, "VACUUM snapshot")
+
+		for _, stmt := range stmts {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetManifestDocuments returns the file fields of every document, in ID order
+func (r *Repository) GetManifestDocuments() ([]models.Document, error) {
+	r, end := r.trace("GetManifestDocuments")
+	defer end()
+
+	var documents []models.Document
+	err := r.db.Select("id, filename, size_bytes, sha256").Order("id ASC").Find(&documents).Error
+	return documents, err
+}
+
+// GetManifestImages returns the file fields of every image, in ID order
+func (r *Repository) GetManifestImages() ([]models.Image, error) {
+	r, end := r.trace("GetManifestImages")
+	defer end()
+
+	var images []models.Image
+	err := r.db.Select("id, document_id, filename, cdn_url, size_bytes, sha256").Order("id ASC").Find(&images).Error
+	return images, err
+}
+
+// IngestVersion changes whenever documents or images are added, re-ingested
+// or hashed, so cached exports know when to rebuild
+func (r *Repository) IngestVersion() (string, error) {
+	r, end := r.trace("IngestVersion")
+	defer end()
+
+	var v struct {
+		Documents    int64
+		LastUpdate   string
+		Images       int64
+		LastImageID  int64
+		HashedImages int64
+		HashedDocs   int64
+	}
+	err := r.db.Raw(`
+		SELECT
+			(SELECT COUNT(*) FROM documents) AS documents,
+			(SELECT COALESCE(MAX(updated_at), '') FROM documents) AS last_update,
+			(SELECT COUNT(*) FROM images) AS images,
+			(SELECT COALESCE(MAX(id), 0) FROM images) AS last_image_id,
+			(SELECT COUNT(*) FROM images WHERE sha256 != '') AS hashed_images,
+			(SELECT COUNT(*) FROM documents WHERE sha256 != '') AS hashed_docs
+	`).Scan(&v).Error
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d/%s/%d/%d/%d/%d", v.Documents, v.LastUpdate, v.Images, v.LastImageID, v.HashedImages, v.HashedDocs), nil
+}
+
+// ============================================================================
+// EXPORT DOWNLOADS
+// ============================================================================
+
+func (r *Repository) CreateExportDownload(d *models.ExportDownload) error {
+	r, end := r.trace("CreateExportDownload")
+	defer end()
+
+	return r.db.Create(d).Error
+}
+
+func (r *Repository) GetExportDownload(id uint) (*models.ExportDownload, error) {
+	r, end := r.trace("GetExportDownload")
+	defer end()
+
+	var d models.ExportDownload
+	if err := r.db.First(&d, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &d, nil
+}
+
+func (r *Repository) SaveExportDownload(d *models.ExportDownload) error {
+	r, end := r.trace("SaveExportDownload")
+	defer end()
+
+	return r.db.Save(d).Error
+}
+
+// GetReusableExportDownload returns the newest download of kind built, or
+// being built, for ingestVersion that is neither expired nor used, or nil.
+// A new download can share its build.
+func (r *Repository) GetReusableExportDownload(kind, ingestVersion string, now time.Time) (*models.ExportDownload, error) {
+	r, end := r.trace("GetReusableExportDownload")
+	defer end()
+
+	var downloads []models.ExportDownload
+	err := r.db.Joins("JOIN jobs ON jobs.id = export_downloads.job_id").
+		Where("export_downloads.kind = ? AND export_downloads.ingest_version = ?", kind, ingestVersion).
+		Where("export_downloads.expires_at > ? AND export_downloads.consumed_at IS NULL", now).
+		Where("jobs.status IN ?", []string{models.JobQueued, models.JobRunning, models.JobDone}).
+		Order("export_downloads.id DESC").Limit(1).Find(&downloads).Error
+	if err != nil || len(downloads) == 0 {
+		return nil, err
+	}
+	return &downloads[0], nil
+}
+
+// SetExportDownloadFile records the built file on download id and on every
+// download sharing job jobID, returning how many it was recorded on
+func (r *Repository) SetExportDownloadFile(id, jobID uint, path string, size int64, sha256 string) (int64, error) {
+	r, end := r.trace("SetExportDownloadFile")
+	defer end()
+
+	res := r.db.Model(&models.ExportDownload{}).
+		Where("id = ? OR job_id = ?", id, jobID).
+		Updates(map[string]interface{}{"path": path, "size_bytes": size, "sha256": sha256})
+	return res.RowsAffected, res.Error
+}
+
+// CountOtherExportDownloadsOfFile counts the downloads besides id that
+// address path
+func (r *Repository) CountOtherExportDownloadsOfFile(id uint, path string) (int64, error) {
+	r, end := r.trace("CountOtherExportDownloadsOfFile")
+	defer end()
+
+	var count int64
+	err := r.db.Model(&models.ExportDownload{}).Where("path = ? AND id <> ?", path, id).Count(&count).Error
+	return count, err
+}
+
+// ConsumeExportDownload marks a download used, unless it already was
+func (r *Repository) ConsumeExportDownload(id uint, at time.Time) error {
+	r, end := r.trace("ConsumeExportDownload")
+	defer end()
+
+	return r.db.Model(&models.ExportDownload{}).
+		Where("id = ? AND consumed_at IS NULL", id).
+		Update("consumed_at", at).Error
+}
+
+// GetFinishedExportDownloads returns the downloads expired by now or used
+// before consumedBefore, whose files can go
+func (r *Repository) GetFinishedExportDownloads(now, consumedBefore time.Time) ([]models.ExportDownload, error) {
+	r, end := r.trace("GetFinishedExportDownloads")
+	defer end()
+
+	var downloads []models.ExportDownload
+	err := r.db.Where("expires_at < ? OR consumed_at < ?", now, consumedBefore).
+		Order("id").Find(&downloads).Error
+	if err != nil {
+		return nil, err
+	}
+	return downloads, nil
+}
+
+func (r *Repository) DeleteExportDownload(id uint) error {
+	r, end := r.trace("DeleteExportDownload")
+	defer end()
+
+	return r.db.Delete(&models.ExportDownload{}, id).Error
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"strconv"
+
+	"github.com/epstein-files/backend/internal/models"
+)
+
+// ============================================================================
+// FACE CLUSTERS
+// ============================================================================
+
+// GetFaceClusters returns clusters with at least minFaces faces, largest first
+func (r *Repository) GetFaceClusters(cursor string, limit, minFaces int) (*models.PaginatedResponse, error) {
+	r, end := r.trace("GetFaceClusters")
+	defer end()
+
+	query := r.db.Model(&models.FaceCluster{}).Where("face_count >= ?", minFaces)
+
+	var total int64
+	query.Count(&total)
+
+	c := pageCursor(cursor)
+	if c != nil && c.LastID > 0 {
+		lastCount, _ := strconv.Atoi(c.LastValue)
+		if c.Before {
+			query = query.Where("face_count > ? OR (face_count = ? AND id < ?)", lastCount, lastCount, c.LastID)
+		} else {
+			query = query.Where("face_count < ? OR (face_count = ? AND id > ?)", lastCount, lastCount, c.LastID)
+		}
+	}
+
+	countOrder, idOrder := "face_count DESC", "id ASC"
+	if backward(c) {
+		countOrder, idOrder = "face_count ASC", "id DESC"
+	}
+	clusters := []models.FaceCluster{}
+	if err := query.Order(countOrder).Order(idOrder).Limit(limit + 1).Find(&clusters).Error; err != nil {
+		return nil, err
+	}
+
+	resp := &models.PaginatedResponse{Total: total}
+	resp.Data = keysetPage(resp, clusters, limit, c, func(cluster models.FaceCluster) models.Cursor {
+		return models.Cursor{LastID: cluster.ID, LastValue: strconv.Itoa(cluster.FaceCount)}
+	})
+	return resp, nil
+}
+
+func (r *Repository) GetFaceCluster(id uint) (*models.FaceCluster, error) {
+	r, end := r.trace("GetFaceCluster")
+	defer end()
+
+	var cluster models.FaceCluster
+	if err := r.db.First(&cluster, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &cluster, nil
+}
+
+// AttachClusterFaces sets Faces on each image to its faces in the cluster
+func (r *Repository) AttachClusterFaces(clusterID uint, images []models.Image) error {
+	r, end := r.trace("AttachClusterFaces")
+	defer end()
+
+	if len(images) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(images))
+	for i, img := range images {
+		ids[i] = img.ID
+	}
+
+	var faces []models.Face
+	err := r.db.Omit("embedding").Where("cluster_id = ? AND image_id IN ?", clusterID, ids).
+		Order("id ASC").Find(&faces).Error
+	if err != nil {
+		return err
+	}
+
+	byImage := make(map[uint][]models.Face)
+	for _, f := range faces {
+		byImage[f.ImageID] = append(byImage[f.ImageID], f)
+	}
+	for i := range images {
+		images[i].Faces = byImage[images[i].ID]
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"github.com/epstein-files/backend/internal/models"
+)
+
+// ============================================================================
+// FEATURE FLAGS
+// ============================================================================
+
+// GetFeatureFlags returns the archive's stored flag overrides
+func (r *Repository) GetFeatureFlags() ([]models.FeatureFlag, error) {
+	r, end := r.trace("GetFeatureFlags")
+	defer end()
+
+	var flags []models.FeatureFlag
+	if err := r.db.Order("name").Find(&flags).Error; err != nil {
+		return nil, err
+	}
+	return flags, nil
+}
+
+// SaveFeatureFlag creates or replaces a flag override
+func (r *Repository) SaveFeatureFlag(flag *models.FeatureFlag) error {
+	r, end := r.trace("SaveFeatureFlag")
+	defer end()
+
+	return r.db.Save(flag).Error
+}
+
+// DeleteFeatureFlag removes an override, so the flag follows the
+// configuration again
+func (r *Repository) DeleteFeatureFlag(name string) error {
+	r, end := r.trace("DeleteFeatureFlag")
+	defer end()
+
+	return r.db.Delete(&models.FeatureFlag{}, "name = ?", name).Error
+}
@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/epstein-files/backend/internal/models"
+)
+
+// ErrLegalHold is returned when the database refuses a delete under legal hold
+var ErrLegalHold = newError(ErrConflict, "legal hold is on; archive rows cannot be deleted")
+
+// holdError maps the legal hold trigger's abort to ErrLegalHold
+func holdError(err error) error {
+	if err != nil && strings.Contains(err.Error(), models.LegalHoldError) {
+		return fmt.Errorf("%w: %v", ErrLegalHold, err)
+	}
+	return err
+}
+
+// ============================================================================
+// VERSIONS
+// ============================================================================
+
+// GetRowVersions returns the earlier states of a row, oldest first
+func (r *Repository) GetRowVersions(entity, id string) ([]models.RowVersion, error) {
+	r, end := r.trace("GetRowVersions")
+	defer end()
+
+	versions := []models.RowVersion{}
+	err := r.db.Where("entity = ? AND entity_id = ?", entity, id).Order("id ASC").Find(&versions).Error
+	return versions, err
+}
@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"github.com/epstein-files/backend/internal/models"
+)
+
+// GetIngestLock returns the ingest lock, or nil when no ingest holds it
+func (r *Repository) GetIngestLock() (*models.IngestLock, error) {
+	r, end := r.trace("GetIngestLock")
+	defer end()
+
+	var locks []models.IngestLock
+	if err := r.db.Where("name = ?", models.IngestLockName).Limit(1).Find(&locks).Error; err != nil {
+		return nil, err
+	}
+	if len(locks) == 0 {
+		return nil, nil
+	}
+	return &locks[0], nil
+}
@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"github.com/epstein-files/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// REFERENTIAL INTEGRITY
+// ============================================================================
+
+// IntegrityViolation counts the rows of a table referring to parent rows that
+// are gone. Declared is whether the schema has the reference as a foreign
+// key, which SQLite enforces on new writes with FOREIGN_KEYS; the others are
+// only kept by the ingest scripts.
+type IntegrityViolation struct {
+	Table    string `json:"table"`
+	Column   string `json:"column"`
+	Parent   string `json:"parent"`
+	Rows     int64  `json:"rows"`
+	Declared bool   `json:"declared"`
+}
+
+// undeclaredReferences are the references the schema doesn't declare as
+// foreign keys, checked alongside those that it does
+var undeclaredReferences = []IntegrityViolation{
+	{Table: "pages", Column: "document_id", Parent: "documents"},
+	{Table: "document_tables", Column: "document_id", Parent: "documents"},
+	{Table: "document_sprites", Column: "document_id", Parent: "documents"},
+	{Table: "faces", Column: "image_id", Parent: "images"},
+}
+
+// ImageLink is an image with whether its document still exists, addressed
+// by id for the orphan cleanup to resume from
+type ImageLink struct {
+	ID          uint   `gorm:"column:id"`
+	DocumentID  string `gorm:"column:document_id"`
+	Filename    string `gorm:"column:filename"`
+	HasDocument bool   `gorm:"column:has_document"`
+}
+
+// ForeignKeysEnforced reports whether the connection checks foreign keys
+func (r *Repository) ForeignKeysEnforced() (bool, error) {
+	r, end := r.trace("ForeignKeysEnforced")
+	defer end()
+
+	var enforced int
+	err := r.db.Raw("PRAGMA foreign_keys").Scan(&enforced).Error
+	return enforced == 1, err
+}
+
+// GetIntegrityViolations counts the rows breaking each declared foreign key,
+// then each undeclared reference; references without any are left out
+func (r *Repository) GetIntegrityViolations() ([]IntegrityViolation, error) {
+	r, end := r.trace("GetIntegrityViolations")
+	defer end()
+
+	violations := []IntegrityViolation{}
+	var declared []struct {
+		Table  string `gorm:"column:child"`
+		Parent string `gorm:"column:parent"`
+		FKID   int    `gorm:"column:fkid"`
+		Rows   int64  `gorm:"column:rows"`
+	}
+	err := r.db.Raw(`SELECT "table" AS child, parent, fkid, COUNT(*) AS rows
+		FROM pragma_foreign_key_check GROUP BY "table", parent, fkid ORDER BY "table", fkid`).Scan(&declared).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range declared {
+		var column string
+		err := r.db.Raw(`SELECT "from" FROM pragma_foreign_key_list(?) WHERE id = ? LIMIT 1`, d.Table, d.FKID).
+			Scan(&column).Error
+		if err != nil {
+			return nil, err
+		}
+		violations = append(violations, IntegrityViolation{
+			Table: d.Table, Column: column, Parent: d.Parent, Rows: d.Rows, Declared: true,
+		})
+	}
+
+	for _, ref := range undeclaredReferences {
+		if !r.db.Migrator().HasTable(ref.Table) {
+			continue
+		}
+		err := r.db.Table(ref.Table).
+			Where(ref.Column + " NOT IN (SELECT id FROM " + ref.Parent + ")").
+			Count(&ref.Rows).Error
+		if err != nil {
+			return nil, err
+		}
+		if ref.Rows > 0 {
+			violations = append(violations, ref)
+		}
+	}
+	return violations, nil
+}
+
+// orphanCandidates selects every image with files, whose files the cleanup
+// checks too, else only those whose document is gone
+func (r *Repository) orphanCandidates(files bool) *gorm.DB {
+	q := r.db.Table("images").Joins("LEFT JOIN documents ON documents.id = images.document_id")
+	if !files {
+		q = q.Where("documents.id IS NULL")
+	}
+	return q
+}
+
+// CountOrphanCandidates counts the images GetOrphanCandidates will visit
+func (r *Repository) CountOrphanCandidates(files bool) (int64, error) {
+	r, end := r.trace("CountOrphanCandidates")
+	defer end()
+
+	var count int64
+	err := r.orphanCandidates(files).Count(&count).Error
+	return count, err
+}
+
+// GetOrphanCandidates returns the images after afterID for the cleanup to
+// check
+func (r *Repository) GetOrphanCandidates(afterID uint, files bool, limit int) ([]ImageLink, error) {
+	r, end := r.trace("GetOrphanCandidates")
+	defer end()
+
+	links := []ImageLink{}
+	err := r.orphanCandidates(files).
+		Select("images.id, images.document_id, images.filename, documents.id IS NOT NULL AS has_document").
+		Where("images.id > ?", afterID).
+		Order("images.id ASC").Limit(limit).Scan(&links).Error
+	return links, err
+}
+
+// DeleteImages removes images with their tags and faces in one transaction,
+// returning how many tags and faces went with them. Their blob references
+// are dropped by the blob GC (PruneBlobRefs).
+func (r *Repository) DeleteImages(ids []uint) (tags, faces int64, err error) {
+	r, end := r.trace("DeleteImages")
+	defer end()
+
+	if len(ids) == 0 {
+		return 0, 0, nil
+	}
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("image_id IN ?", ids).Delete(&models.ImageTag{})
+		if res.Error != nil {
+			return holdError(res.Error)
+		}
+		tags = res.RowsAffected
+		res = tx.Where("image_id IN ?", ids).Delete(&models.Face{})
+		if res.Error != nil {
+			return holdError(res.Error)
+		}
+		faces = res.RowsAffected
+		return holdError(tx.Where("id IN ?", ids).Delete(&models.Image{}).Error)
+	})
+	return tags, faces, err
+}
+
+// DeleteDetachedImageRows removes the tags and faces of images that are
+// gone, left behind from before foreign keys were enforced
+func (r *Repository) DeleteDetachedImageRows() (tags, faces int64, err error) {
+	r, end := r.trace("DeleteDetachedImageRows")
+	defer end()
+
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("image_id NOT IN (SELECT id FROM images)").Delete(&models.ImageTag{})
+		if res.Error != nil {
+			return holdError(res.Error)
+		}
+		tags = res.RowsAffected
+		res = tx.Where("image_id NOT IN (SELECT id FROM images)").Delete(&models.Face{})
+		if res.Error != nil {
+			return holdError(res.Error)
+		}
+		faces = res.RowsAffected
+		return nil
+	})
+	return tags, faces, err
+}
@@ -0,0 +1,295 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/epstein-files/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============================================================================
+// JOBS
+// ============================================================================
+
+func (r *Repository) CreateJob(job *models.Job) error {
+	r, end := r.trace("CreateJob")
+	defer end()
+
+	job.Status = models.JobQueued
+	return r.db.Create(job).Error
+}
+
+func (r *Repository) GetJob(id uint) (*models.Job, error) {
+	r, end := r.trace("GetJob")
+	defer end()
+
+	var job models.Job
+	if err := r.db.First(&job, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &job, nil
+}
+
+// GetJobs returns the most recent jobs first
+func (r *Repository) GetJobs(limit int) ([]models.Job, error) {
+	r, end := r.trace("GetJobs")
+	defer end()
+
+	jobs := []models.Job{}
+	err := r.db.Order("id DESC").Limit(limit).Find(&jobs).Error
+	return jobs, err
+}
+
+// ClaimNextJob marks the oldest pending job as running for worker and
+// returns it. Running jobs whose worker stopped heartbeating before
+// staleBefore are claimed first so they resume, as are worker's own, left by
+// the process it restarted as. The claim is conditional, so workers polling
+// the same database never both take a job.
+func (r *Repository) ClaimNextJob(worker string, staleBefore time.Time) (*models.Job, error) {
+	r, end := r.trace("ClaimNextJob")
+	defer end()
+
+	claimable := func(db *gorm.DB) *gorm.DB {
+		return db.Where("status = ? OR (status = ? AND (worker = ? OR heartbeat_at IS NULL OR heartbeat_at < ?))",
+			models.JobQueued, models.JobRunning, worker, staleBefore)
+	}
+	for {
+		var job models.Job
+		err := r.db.Scopes(claimable).
+			Order("CASE status WHEN 'running' THEN 0 ELSE 1 END, id ASC").
+			Limit(1).Find(&job).Error
+		if err != nil || job.ID == 0 {
+			return nil, err
+		}
+
+		now := time.Now()
+		if job.StartedAt == nil {
+			job.StartedAt = &now
+		}
+		job.Status = models.JobRunning
+		job.Worker = worker
+		job.HeartbeatAt = &now
+		res := r.db.Model(&models.Job{}).Where("id = ?", job.ID).Scopes(claimable).Updates(map[string]interface{}{
+			"status":       job.Status,
+			"started_at":   job.StartedAt,
+			"worker":       worker,
+			"heartbeat_at": now,
+		})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected > 0 {
+			return &job, nil
+		}
+		// Another worker got there first
+	}
+}
+
+// HeartbeatJob records that worker is still running a job
+func (r *Repository) HeartbeatJob(id uint, worker string) error {
+	r, end := r.trace("HeartbeatJob")
+	defer end()
+
+	return r.db.Model(&models.Job{}).
+		Where("id = ? AND worker = ? AND status = ?", id, worker, models.JobRunning).
+		Update("heartbeat_at", time.Now()).Error
+}
+
+// TouchWorker records that a worker started at startedAt is looking for jobs
+func (r *Repository) TouchWorker(id string, startedAt time.Time) error {
+	r, end := r.trace("TouchWorker")
+	defer end()
+
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"started_at", "seen_at"}),
+	}).Create(&models.JobWorker{ID: id, StartedAt: startedAt, SeenAt: time.Now()}).Error
+}
+
+// GetJobWorkers returns the workers seen since a time, most recent first
+func (r *Repository) GetJobWorkers(since time.Time) ([]models.JobWorker, error) {
+	r, end := r.trace("GetJobWorkers")
+	defer end()
+
+	workers := []models.JobWorker{}
+	err := r.db.Where("seen_at >= ?", since).Order("seen_at DESC").Find(&workers).Error
+	return workers, err
+}
+
+// SaveJobProgress records counters and the resume cursor, and returns the
+// job's current status so a runner can notice cancellation
+func (r *Repository) SaveJobProgress(job *models.Job) (string, error) {
+	r, end := r.trace("SaveJobProgress")
+	defer end()
+
+	err := r.db.Model(job).Updates(map[string]interface{}{
+		"total":     job.Total,
+		"processed": job.Processed,
+		"failed":    job.Failed,
+		"cursor":    job.Cursor,
+		"result":    job.Result,
+	}).Error
+	if err != nil {
+		return "", err
+	}
+
+	var status string
+	err = r.db.Model(&models.Job{}).Where("id = ?", job.ID).Pluck("status", &status).Error
+	return status, err
+}
+
+// FinishJob records the final status of a job
+func (r *Repository) FinishJob(job *models.Job, status, errMsg string) error {
+	r, end := r.trace("FinishJob")
+	defer end()
+
+	now := time.Now()
+	job.Status = status
+	job.Error = errMsg
+	job.FinishedAt = &now
+	return r.db.Model(job).Updates(map[string]interface{}{
+		"status":      status,
+		"error":       errMsg,
+		"finished_at": now,
+		"total":       job.Total,
+		"processed":   job.Processed,
+		"failed":      job.Failed,
+		"cursor":      job.Cursor,
+		"result":      job.Result,
+	}).Error
+}
+
+// LastJob returns the most recent job of a type, or nil if there is none
+func (r *Repository) LastJob(jobType string) (*models.Job, error) {
+	r, end := r.trace("LastJob")
+	defer end()
+
+	var job models.Job
+	err := r.db.Where("type = ?", jobType).Order("id DESC").Limit(1).Find(&job).Error
+	if err != nil || job.ID == 0 {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// CancelJob stops a queued or running job; runners stop at their next checkpoint
+func (r *Repository) CancelJob(id uint) (*models.Job, error) {
+	r, end := r.trace("CancelJob")
+	defer end()
+
+	err := r.db.Model(&models.Job{}).
+		Where("id = ? AND status IN ?", id, []string{models.JobQueued, models.JobRunning}).
+		Update("status", models.JobCancelled).Error
+	if err != nil {
+		return nil, err
+	}
+	return r.GetJob(id)
+}
+
+// ============================================================================
+// ENRICHMENT
+// ============================================================================
+
+// GetImageBatch returns images with ID greater than afterID, optionally
+// limited to one document, for batch jobs that walk the image table
+func (r *Repository) GetImageBatch(afterID uint, documentID string, limit int) ([]models.Image, error) {
+	r, end := r.trace("GetImageBatch")
+	defer end()
+
+	images := []models.Image{}
+	query := r.db.Where("id > ?", afterID)
+	if documentID != "" {
+		query = query.Where("document_id = ?", documentID)
+	}
+	err := query.Order("id ASC").Limit(limit).Find(&images).Error
+	return images, err
+}
+
+// CountImages counts the images a batch job will visit
+func (r *Repository) CountImages(documentID string) (int64, error) {
+	r, end := r.trace("CountImages")
+	defer end()
+
+	var count int64
+	query := r.db.Model(&models.Image{})
+	if documentID != "" {
+		query = query.Where("document_id = ?", documentID)
+	}
+	err := query.Count(&count).Error
+	return count, err
+}
+
+// UpdateImageFields writes recomputed columns for one image
+func (r *Repository) UpdateImageFields(id uint, fields map[string]interface{}) error {
+	r, end := r.trace("UpdateImageFields")
+	defer end()
+
+	return r.db.Model(&models.Image{}).Where("id = ?", id).Updates(fields).Error
+}
+
+// UpdateImagesFields writes recomputed columns of several images, by image
+// ID, in one transaction
+func (r *Repository) UpdateImagesFields(fields map[uint]map[string]interface{}) error {
+	r, end := r.trace("UpdateImagesFields")
+	defer end()
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for id, f := range fields {
+			if err := tx.Model(&models.Image{}).Where("id = ?", id).Updates(f).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ============================================================================
+// VERIFICATION
+// ============================================================================
+
+// FileRecord is the recorded hash of a stored file, addressed by rowid so
+// batch jobs can walk documents in a stable order
+type FileRecord struct {
+	RowID     uint   `gorm:"column:rowid"`
+	ID        string `gorm:"column:id"`
+	Filename  string `gorm:"column:filename"`
+	SizeBytes int64  `gorm:"column:size_bytes"`
+	SHA256    string `gorm:"column:sha256"`
+}
+
+// GetDocumentSample returns hashed documents after afterRowID whose rowid
+// falls in the sample (rowid % modulus == offset)
+func (r *Repository) GetDocumentSample(afterRowID uint, modulus, offset int, limit int) ([]FileRecord, error) {
+	r, end := r.trace("GetDocumentSample")
+	defer end()
+
+	records := []FileRecord{}
+	err := r.db.Model(&models.Document{}).
+		Select("rowid, id, filename, size_bytes, sha256").
+		Where("rowid > ? AND sha256 IS NOT NULL AND sha256 != '' AND rowid % ? = ?", afterRowID, modulus, offset).
+		Order("rowid ASC").Limit(limit).Scan(&records).Error
+	return records, err
+}
+
+// CountDocumentSample counts the documents GetDocumentSample will visit
+func (r *Repository) CountDocumentSample(modulus, offset int) (int64, error) {
+	r, end := r.trace("CountDocumentSample")
+	defer end()
+
+	var count int64
+	err := r.db.Model(&models.Document{}).
+		Where("sha256 IS NOT NULL AND sha256 != '' AND rowid % ? = ?", modulus, offset).
+		Count(&count).Error
+	return count, err
+}
+
+// CountJobs returns how many jobs have status
+func (r *Repository) CountJobs(status string) (int64, error) {
+	r, end := r.trace("CountJobs")
+	defer end()
+
+	var n int64
+	err := r.db.Model(&models.Job{}).Where("status = ?", status).Count(&n).Error
+	return n, err
+}
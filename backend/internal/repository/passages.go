@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"github.com/epstein-files/backend/internal/models"
+)
+
+// ============================================================================
+// PASSAGES
+// ============================================================================
+
+// GetPassageStats counts the passages embedded with model and returns the
+// highest ID among them, so an index of them can tell when it is stale
+func (r *Repository) GetPassageStats(model string) (int64, uint, error) {
+	r, end := r.trace("GetPassageStats")
+	defer end()
+
+	var stats struct {
+		Count int64
+		MaxID uint
+	}
+	err := r.db.Model(&models.Passage{}).Select("COUNT(*) AS count, COALESCE(MAX(id), 0) AS max_id").
+		Where("model = ?", model).Scan(&stats).Error
+	return stats.Count, stats.MaxID, err
+}
+
+// GetPassageEmbeddings returns the IDs and embeddings of up to limit
+// passages embedded with model, after afterID in ID order
+func (r *Repository) GetPassageEmbeddings(model string, afterID uint, limit int) ([]models.Passage, error) {
+	r, end := r.trace("GetPassageEmbeddings")
+	defer end()
+
+	var passages []models.Passage
+	err := r.db.Select("id", "embedding").Where("model = ? AND id > ?", model, afterID).
+		Order("id ASC").Limit(limit).Find(&passages).Error
+	return passages, err
+}
+
+// GetPassagesByID returns the passages with ids, without their embeddings,
+// in no particular order
+func (r *Repository) GetPassagesByID(ids []uint) ([]models.Passage, error) {
+	r, end := r.trace("GetPassagesByID")
+	defer end()
+
+	var passages []models.Passage
+	err := r.db.Omit("embedding").Where("id IN ?", ids).Find(&passages).Error
+	return passages, err
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"github.com/epstein-files/backend/internal/models"
+	"gorm.io/gorm/clause"
+)
+
+// ============================================================================
+// API USAGE
+// ============================================================================
+
+// GetAPIUsage returns every key's count for the given day and month
+func (r *Repository) GetAPIUsage(day, month string) ([]models.APIUsage, error) {
+	r, end := r.trace("GetAPIUsage")
+	defer end()
+
+	var usage []models.APIUsage
+	err := r.db.Where("(period = ? AND start = ?) OR (period = ? AND start = ?)",
+		models.QuotaDay, day, models.QuotaMonth, month).Find(&usage).Error
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// SaveAPIUsage writes period counts, replacing the stored ones
+func (r *Repository) SaveAPIUsage(usage []models.APIUsage) error {
+	r, end := r.trace("SaveAPIUsage")
+	defer end()
+
+	if len(usage) == 0 {
+		return nil
+	}
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}, {Name: "period"}, {Name: "start"}},
+		DoUpdates: clause.AssignmentColumns([]string{"count", "updated_at"}),
+	}).Create(&usage).Error
+}
+
+// GetAPIUsageHistory returns a key's daily counts from since ("2006-01-02")
+// on, most recent first
+func (r *Repository) GetAPIUsageHistory(key, since string) ([]models.DailyUsage, error) {
+	r, end := r.trace("GetAPIUsageHistory")
+	defer end()
+
+	var days []models.DailyUsage
+	err := r.db.Model(&models.APIUsage{}).
+		Select("start AS date, count").
+		Where("key = ? AND period = ? AND start >= ?", key, models.QuotaDay, since).
+		Order("start DESC").
+		Scan(&days).Error
+	if err != nil {
+		return nil, err
+	}
+	return days, nil
+}
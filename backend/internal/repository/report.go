@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"strings"
+
+	"github.com/epstein-files/backend/internal/models"
+)
+
+// ============================================================================
+// TRANSPARENCY REPORT
+// ============================================================================
+
+// GetCoverage counts the EFTA numbers held between the lowest and highest
+func (r *Repository) GetCoverage() (*models.Coverage, error) {
+	r, end := r.trace("GetCoverage")
+	defer end()
+
+	// IDs are zero-padded, so string order is numeric order
+	var row struct {
+		First, Last string
+		Count       int64
+	}
+	err := r.db.Model(&models.Document{}).
+		Select("COALESCE(MIN(id), '') AS first, COALESCE(MAX(id), '') AS last, COUNT(*) AS count").
+		Where("id LIKE 'EFTA%'").Scan(&row).Error
+	if err != nil {
+		return nil, err
+	}
+
+	c := &models.Coverage{FirstID: row.First, LastID: row.Last, Present: row.Count}
+	first, ok1 := models.ParseEFTA(row.First)
+	last, ok2 := models.ParseEFTA(row.Last)
+	if ok1 && ok2 {
+		span := int64(last - first + 1)
+		c.Missing = span - c.Present
+		c.Percent = float64(c.Present) * 100 / float64(span)
+	}
+	return c, nil
+}
+
+// GetRedactionStats counts blank pages, pages without a text layer and
+// pages whose text cites a redaction marker
+func (r *Repository) GetRedactionStats() (*models.RedactionStats, error) {
+	r, end := r.trace("GetRedactionStats")
+	defer end()
+
+	s := &models.RedactionStats{Markers: make(map[string]int64, len(models.RedactionMarkers))}
+	if err := r.db.Model(&models.Page{}).Count(&s.Pages).Error; err != nil {
+		return nil, err
+	}
+	r.db.Model(&models.Page{}).Where("is_blank = ?", true).Count(&s.BlankPages)
+	r.db.Model(&models.Page{}).Where("text IS NULL OR TRIM(text) = ''").Count(&s.PagesWithoutText)
+
+	// LIKE is case-insensitive for ASCII, which the markers are
+	var any []string
+	var args []interface{}
+	for _, marker := range models.RedactionMarkers {
+		var n int64
+		if err := r.db.Model(&models.Page{}).Where("text LIKE ?", "%"+marker+"%").Count(&n).Error; err != nil {
+			return nil, err
+		}
+		s.Markers[marker] = n
+		any = append(any, "text LIKE ?")
+		args = append(args, "%"+marker+"%")
+	}
+	marked := strings.Join(any, " OR ")
+	r.db.Model(&models.Page{}).Where(marked, args...).Count(&s.MarkedPages)
+	r.db.Model(&models.Page{}).Where(marked, args...).Distinct("document_id").Count(&s.MarkedDocuments)
+
+	return s, nil
+}
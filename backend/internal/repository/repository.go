@@ -1,11 +1,19 @@
 package repository
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/telemetry"
 	"gorm.io/gorm"
 )
 
@@ -17,6 +25,19 @@ func New(db *gorm.DB) *Repository {
 	return &Repository{db: db}
 }
 
+// WithContext returns a repository whose queries run under ctx, so they are
+// cancelled with the request and traced as children of its span
+func (r *Repository) WithContext(ctx context.Context) *Repository {
+	return &Repository{db: r.db.WithContext(ctx)}
+}
+
+// trace starts a span for a repository method and returns a repository bound
+// to it, so the method's queries nest underneath
+func (r *Repository) trace(method string) (*Repository, func()) {
+	ctx, span := telemetry.Start(r.db.Statement.Context, "Repository."+method)
+	return r.WithContext(ctx), func() { span.End() }
+}
+
 // ============================================================================
 // IMAGES
 // ============================================================================
@@ -26,168 +47,899 @@ type ImageFilters struct {
 	HasDate     *bool
 	HasText     *bool
 	DocumentID  string
-	SearchQuery string
+	SearchQuery string // every term in the image's own text or its page's
+	MinQuality  *float64
+	Sort        string // "id" (default) or "quality"
+
+	// Color photos vs grayscale scans, and image size
+	Color         *bool
+	MinMegapixels *float64
+	SizeClass     string
+
+	// Shape, stored format (as recorded, e.g. "JPEG") and file size bucket
+	Orientation string
+	Format      string
+	SizeBucket  string
+
+	// Images with a face in this face cluster
+	FaceCluster uint
+
+	// Images carrying every one of Tags with at least MinTagConfidence
+	Tags             []string
+	MinTagConfidence float64
+
+	// Blank separator pages are hidden unless explicitly requested
+	IncludeBlank bool
+
+	// Drop images classified as sensitive/explicit (safe mode "omit")
+	ExcludeFlagged bool
 }
 
 func (r *Repository) GetImages(cursor string, limit int, filters ImageFilters) (*models.PaginatedResponse, error) {
+	r, end := r.trace("GetImages")
+	defer end()
+
 	var images []models.Image
-	query := r.db.Model(&models.Image{})
+	query := applyImageFilters(r.db.Model(&models.Image{}).Joins(joinImagePages), filters)
+
+	// Get total count
+	var total int64
+	query.Count(&total)
+
+	sortByQuality := filters.Sort == "quality"
+
+	// Apply cursor
+	c := pageCursor(cursor)
+	if c != nil && c.LastID > 0 {
+		switch {
+		case sortByQuality && c.Before:
+			lastQuality, _ := strconv.ParseFloat(c.LastValue, 64)
+			query = query.Where("images.quality > ? OR (images.quality = ? AND images.id < ?)", lastQuality, lastQuality, c.LastID)
+		case sortByQuality:
+			lastQuality, _ := strconv.ParseFloat(c.LastValue, 64)
+			query = query.Where("images.quality < ? OR (images.quality = ? AND images.id > ?)", lastQuality, lastQuality, c.LastID)
+		case c.Before:
+			query = query.Where("images.id < ?", c.LastID)
+		default:
+			query = query.Where("images.id > ?", c.LastID)
+		}
+	}
+
+	// Best quality first, ties broken by ID so the cursor stays stable
+	qualityOrder, idOrder := "images.quality DESC", "images.id ASC"
+	if backward(c) {
+		qualityOrder, idOrder = "images.quality ASC", "images.id DESC"
+	}
+	if sortByQuality {
+		query = query.Order(qualityOrder)
+	}
+	query = query.Order(idOrder)
+
+	// Fetch with limit + 1 to check if there are more
+	err := query.Select(imageColumnsWithPageText).Preload("Tags", tagsByConfidence).Limit(limit + 1).Find(&images).Error
+	if err != nil {
+		return nil, err
+	}
 
-	// Apply filters
+	resp := &models.PaginatedResponse{Total: total}
+	resp.Data = keysetPage(resp, images, limit, c, func(image models.Image) models.Cursor {
+		next := models.Cursor{LastID: image.ID}
+		if sortByQuality {
+			next.LastValue = strconv.FormatFloat(image.Quality, 'g', -1, 64)
+		}
+		return next
+	})
+	return resp, nil
+}
+
+// applyImageFilters narrows an images query (joined with pages) to filters
+func applyImageFilters(query *gorm.DB, filters ImageFilters) *gorm.DB {
 	if filters.HasGPS != nil && *filters.HasGPS {
-		query = query.Where("has_gps = ?", true)
+		query = query.Where("images.has_gps = ?", true)
 	}
 	if filters.HasDate != nil && *filters.HasDate {
-		query = query.Where("date_taken IS NOT NULL AND date_taken != ''")
+		query = query.Where("images.date_taken IS NOT NULL AND images.date_taken != ''")
 	}
 	if filters.HasText != nil && *filters.HasText {
-		query = query.Where("page_text IS NOT NULL AND page_text != ''")
+		query = query.Where("pages.text IS NOT NULL AND pages.text != ''")
 	}
 	if filters.DocumentID != "" {
-		query = query.Where("document_id = ?", filters.DocumentID)
+		query = query.Where("images.document_id = ?", filters.DocumentID)
+	}
+	for _, term := range searchTerms(filters.SearchQuery) {
+		query = query.Where("(pages.text LIKE ? OR images.ocr_text LIKE ?)", "%"+term+"%", "%"+term+"%")
+	}
+	if filters.MinQuality != nil {
+		query = query.Where("images.quality >= ?", *filters.MinQuality)
+	}
+	if !filters.IncludeBlank {
+		query = query.Where("images.is_blank = ?", false)
+	}
+	if filters.Color != nil {
+		query = query.Where("images.is_color = ?", *filters.Color)
+	}
+	if filters.MinMegapixels != nil {
+		query = query.Where("images.megapixels >= ?", *filters.MinMegapixels)
+	}
+	if filters.SizeClass != "" {
+		query = query.Where("images.size_class = ?", filters.SizeClass)
+	}
+	if filters.Orientation != "" {
+		query = query.Where("images.orientation = ?", filters.Orientation)
+	}
+	if filters.Format != "" {
+		query = query.Where("images.format = ?", filters.Format)
+	}
+	if from, to, ok := models.SizeBucketRange(filters.SizeBucket); ok {
+		query = query.Where("images.size_bytes >= ?", from)
+		if to > 0 {
+			query = query.Where("images.size_bytes < ?", to)
+		}
+	}
+	for _, tag := range filters.Tags {
+		query = query.Where("images.id IN (SELECT image_id FROM image_tags WHERE tag = ? AND confidence >= ?)",
+			tag, filters.MinTagConfidence)
+	}
+	if filters.FaceCluster != 0 {
+		query = query.Where("images.id IN (SELECT image_id FROM faces WHERE cluster_id = ?)", filters.FaceCluster)
+	}
+	if filters.ExcludeFlagged {
+		query = query.Where("images.safety_label IS NULL OR images.safety_label NOT IN ?",
+			[]string{models.SafetySensitive, models.SafetyExplicit})
 	}
+	return query
+}
 
-	// Get total count
-	var total int64
-	query.Count(&total)
+// Number of tags returned in image facets
+const imageTagFacetLimit = 50
 
-	// Apply cursor
-	if cursor != "" {
-		decoded, err := decodeCursor(cursor)
-		if err == nil && decoded.LastID > 0 {
-			query = query.Where("id > ?", decoded.LastID)
+// GetImageFacets counts the images matching filters by color, size class,
+// orientation, format, file size bucket and tag
+func (r *Repository) GetImageFacets(filters ImageFilters) (*models.ImageFacets, error) {
+	r, end := r.trace("GetImageFacets")
+	defer end()
+
+	facets := &models.ImageFacets{
+		Color:       map[string]int64{},
+		SizeClass:   map[string]int64{},
+		Tags:        map[string]int64{},
+		Orientation: map[string]int64{},
+		Format:      map[string]int64{},
+		SizeBucket:  map[string]int64{},
+	}
+	counts := func(expr string, into map[string]int64) error {
+		var rows []struct {
+			Facet string
+			Count int64
+		}
+		err := applyImageFilters(r.db.Model(&models.Image{}).Joins(joinImagePages), filters).
+			Select(expr + " AS facet, COUNT(*) AS count").Group("facet").Scan(&rows).Error
+		for _, row := range rows {
+			into[row.Facet] = row.Count
 		}
+		return err
 	}
 
-	// Fetch with limit + 1 to check if there are more
-	err := query.Order("id ASC").Limit(limit + 1).Find(&images).Error
+	err := counts("CASE WHEN images.is_color IS NULL THEN 'unknown' "+
+		"WHEN images.is_color THEN 'color' ELSE 'grayscale' END", facets.Color)
 	if err != nil {
 		return nil, err
 	}
+	if err := counts("COALESCE(NULLIF(images.size_class, ''), 'unknown')", facets.SizeClass); err != nil {
+		return nil, err
+	}
+	if err := counts("COALESCE(NULLIF(images.orientation, ''), 'unknown')", facets.Orientation); err != nil {
+		return nil, err
+	}
+	if err := counts("COALESCE(NULLIF(LOWER(images.format), ''), 'unknown')", facets.Format); err != nil {
+		return nil, err
+	}
+	if err := counts(sizeBucketCase(), facets.SizeBucket); err != nil {
+		return nil, err
+	}
 
-	hasMore := len(images) > limit
-	if hasMore {
-		images = images[:limit]
+	// An image has many tags, so these are counted over the tag rows
+	var tags []struct {
+		Tag   string
+		Count int64
+	}
+	matching := applyImageFilters(r.db.Model(&models.Image{}).Joins(joinImagePages), filters).Select("images.id")
+	err = r.db.Model(&models.ImageTag{}).
+		Where("image_id IN (?) AND confidence >= ?", matching, filters.MinTagConfidence).
+		Select("tag, COUNT(*) AS count").Group("tag").Order("count DESC").Order("tag ASC").
+		Limit(imageTagFacetLimit).Scan(&tags).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tags {
+		facets.Tags[t.Tag] = t.Count
 	}
 
-	var nextCursor string
-	if hasMore && len(images) > 0 {
-		nextCursor = encodeCursor(models.Cursor{LastID: images[len(images)-1].ID})
+	for _, n := range facets.Color {
+		facets.Total += n
 	}
+	return facets, nil
+}
 
-	return &models.PaginatedResponse{
-		Data:       images,
-		NextCursor: nextCursor,
-		HasMore:    hasMore,
-		Total:      total,
-	}, nil
+// sizeBucketCase is a SQL expression naming an image's file size bucket
+func sizeBucketCase() string {
+	var cases []string
+	for _, b := range models.SizeBuckets {
+		if b.MaxBytes == 0 {
+			cases = append(cases, fmt.Sprintf("ELSE '%s'", b.Name))
+		} else {
+			cases = append(cases, fmt.Sprintf("WHEN images.size_bytes < %d THEN '%s'", b.MaxBytes, b.Name))
+		}
+	}
+	return "CASE " + strings.Join(cases, " ") + " END"
 }
 
 func (r *Repository) GetImageByID(id uint) (*models.Image, error) {
+	r, end := r.trace("GetImageByID")
+	defer end()
+
 	var image models.Image
-	err := r.db.Preload("Document").First(&image, id).Error
+	err := r.db.Scopes(withPageText).Preload("Document").Preload("Tags", tagsByConfidence).
+		First(&image, "images.id = ?", id).Error
 	if err != nil {
-		return nil, err
+		return nil, notFound(err)
 	}
 	return &image, nil
 }
 
+// Page text and rotation correction live on the pages table; images expose
+// them read-only via this join
+const joinImagePages = "LEFT JOIN pages ON pages.document_id = images.document_id AND pages.number = images.page"
+
+const imageColumnsWithPageText = "images.*, pages.text AS page_text, " +
+	"COALESCE(pages.correction_rotation + pages.skew_angle, 0) AS correction_angle"
+
+func tagsByConfidence(db *gorm.DB) *gorm.DB {
+	return db.Order("confidence DESC").Order("tag ASC")
+}
+
+func withPageText(db *gorm.DB) *gorm.DB {
+	return db.Select(imageColumnsWithPageText).Joins(joinImagePages)
+}
+
 // ============================================================================
 // DOCUMENTS
 // ============================================================================
 
-func (r *Repository) GetDocuments(cursor string, limit int) (*models.PaginatedResponse, error) {
-	var documents []models.Document
+// Filename regexes are checked in Go, reading at most this many candidate
+// rows per page; a page may come back short with has_more set
+const filenameRegexScanLimit = 50000
+
+// DocumentFilters narrows the document list by filename and length
+type DocumentFilters struct {
+	// Shell-style wildcard: * matches any run of characters, ? one character.
+	// Case-sensitive, so a literal prefix such as EFTA0012* uses the index.
+	FilenameLike string
+
+	// Regular expression the filename must match
+	FilenameRegex *regexp.Regexp
+
+	// Fewest words of text; 0 for any
+	MinWords int
+}
+
+// documentQuery returns a fresh query over documents matching the SQL side
+// of filters
+func (r *Repository) documentQuery(filters DocumentFilters) *gorm.DB {
 	query := r.db.Model(&models.Document{})
+	if filters.FilenameLike != "" {
+		query = query.Where("filename GLOB ?", wildcardToGlob(filters.FilenameLike))
+	}
+	if filters.FilenameRegex != nil {
+		// An anchored literal prefix narrows the rows the regex has to check
+		if prefix := regexLiteralPrefix(filters.FilenameRegex); prefix != "" {
+			query = query.Where("filename GLOB ?", escapeGlob(prefix)+"*")
+		}
+	}
+	if filters.MinWords > 0 {
+		query = query.Where("word_count >= ?", filters.MinWords)
+	}
+	return query
+}
+
+// wildcardToGlob turns a * and ? wildcard into a GLOB pattern, escaping
+// GLOB's own character classes
+func wildcardToGlob(pattern string) string {
+	var b strings.Builder
+	for _, c := range pattern {
+		switch c {
+		case '*', '?':
+			b.WriteRune(c)
+		default:
+			b.WriteString(escapeGlob(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// escapeGlob makes every character of s match literally in a GLOB pattern
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[':
+			b.WriteString("[" + string(c) + "]")
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// regexLiteralPrefix returns the literal text every match of a ^-anchored
+// regex starts with. Alternations may be anchored per branch, so they get
+// no prefix.
+func regexLiteralPrefix(re *regexp.Regexp) string {
+	expr := re.String()
+	if !strings.HasPrefix(expr, "^") || strings.Contains(expr, "|") {
+		return ""
+	}
+	unanchored, err := regexp.Compile(expr[1:])
+	if err != nil {
+		return ""
+	}
+	prefix, _ := unanchored.LiteralPrefix()
+	return prefix
+}
+
+func (r *Repository) GetDocuments(cursor string, limit int, filters DocumentFilters) (*models.PaginatedResponse, error) {
+	r, end := r.trace("GetDocuments")
+	defer end()
+
+	if filters.FilenameRegex != nil {
+		return r.getDocumentsByRegex(cursor, limit, filters)
+	}
+
+	var documents []models.Document
+	query := r.documentQuery(filters)
 
 	// Get total count
 	var total int64
 	query.Count(&total)
 
 	// Apply cursor
-	if cursor != "" {
-		decoded, err := decodeCursor(cursor)
-		if err == nil && decoded.LastValue != "" {
-			query = query.Where("id > ?", decoded.LastValue)
+	c := pageCursor(cursor)
+	order := "id ASC"
+	if c != nil && c.LastValue != "" {
+		if c.Before {
+			query = query.Where("id < ?", c.LastValue)
+			order = "id DESC"
+		} else {
+			query = query.Where("id > ?", c.LastValue)
 		}
 	}
 
 	// Fetch with limit + 1
-	err := query.Order("id ASC").Limit(limit + 1).Find(&documents).Error
+	err := query.Order(order).Limit(limit + 1).Find(&documents).Error
 	if err != nil {
 		return nil, err
 	}
 
-	hasMore := len(documents) > limit
-	if hasMore {
-		documents = documents[:limit]
+	resp := &models.PaginatedResponse{Total: total}
+	resp.Data = keysetPage(resp, documents, limit, c, func(document models.Document) models.Cursor {
+		return models.Cursor{LastValue: document.ID}
+	})
+	return resp, nil
+}
+
+// getDocumentsByRegex pages through documents whose filename matches
+// filters.FilenameRegex, in ID order. The total is unknown and left out,
+// and pages only go forward: scanning back would need its own budget.
+func (r *Repository) getDocumentsByRegex(cursor string, limit int, filters DocumentFilters) (*models.PaginatedResponse, error) {
+	const batchSize = 1000
+
+	var lastID string
+	if cursor != "" {
+		if decoded, err := decodeCursor(cursor); err == nil {
+			lastID = decoded.LastValue
+		}
+	}
+
+	var matched []string
+	scanned, exhausted := 0, false
+	for len(matched) <= limit && scanned < filenameRegexScanLimit {
+		var rows []struct {
+			ID       string
+			Filename string
+		}
+		query := r.documentQuery(filters).Select("id, filename")
+		if lastID != "" {
+			query = query.Where("id > ?", lastID)
+		}
+		if err := query.Order("id ASC").Limit(batchSize).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+
+		for _, row := range rows {
+			scanned++
+			lastID = row.ID
+			if filters.FilenameRegex.MatchString(row.Filename) {
+				if matched = append(matched, row.ID); len(matched) > limit {
+					break
+				}
+			}
+		}
+		if len(rows) < batchSize {
+			exhausted = true
+			break
+		}
 	}
 
 	var nextCursor string
-	if hasMore && len(documents) > 0 {
-		nextCursor = encodeCursor(models.Cursor{LastValue: documents[len(documents)-1].ID})
+	hasMore := len(matched) > limit
+	if hasMore {
+		matched = matched[:limit]
+		nextCursor = encodeCursor(models.Cursor{LastValue: matched[len(matched)-1]})
+	} else if !exhausted {
+		// Scan budget ran out; continue after the last row checked
+		hasMore = true
+		nextCursor = encodeCursor(models.Cursor{LastValue: lastID})
+	}
+
+	documents := []models.Document{}
+	if len(matched) > 0 {
+		if err := r.db.Where("id IN ?", matched).Order("id ASC").Find(&documents).Error; err != nil {
+			return nil, err
+		}
 	}
 
 	return &models.PaginatedResponse{
 		Data:       documents,
 		NextCursor: nextCursor,
 		HasMore:    hasMore,
-		Total:      total,
 	}, nil
 }
 
 func (r *Repository) GetDocumentByID(id string) (*models.Document, error) {
+	r, end := r.trace("GetDocumentByID")
+	defer end()
+
 	var document models.Document
-	err := r.db.Preload("Images").First(&document, "id = ?", id).Error
+	err := r.db.Preload("Images", withPageText).First(&document, "id = ?", id).Error
 	if err != nil {
-		return nil, err
+		return nil, notFound(err)
 	}
 	return &document, nil
 }
 
+// GetDocumentRange returns every EFTA number from from to to (inclusive),
+// marking which ones have a document
+func (r *Repository) GetDocumentRange(from, to int) (*models.DocumentRange, error) {
+	r, end := r.trace("GetDocumentRange")
+	defer end()
+
+	// IDs are zero-padded, so string order is numeric order
+	var documents []models.Document
+	err := r.db.Where("id BETWEEN ? AND ?", models.EFTAID(from), models.EFTAID(to)).
+		Order("id ASC").
+		Find(&documents).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byNumber := make(map[int]*models.Document, len(documents))
+	for i := range documents {
+		if n, ok := models.ParseEFTA(documents[i].ID); ok {
+			byNumber[n] = &documents[i]
+		}
+	}
+
+	result := &models.DocumentRange{
+		From:    models.EFTAID(from),
+		To:      models.EFTAID(to),
+		Entries: make([]models.DocumentRangeEntry, 0, to-from+1),
+	}
+	for n := from; n <= to; n++ {
+		entry := models.DocumentRangeEntry{ID: models.EFTAID(n), Document: byNumber[n]}
+		if entry.Document != nil {
+			entry.Present = true
+			result.Present++
+		} else {
+			result.Missing++
+		}
+		result.Entries = append(result.Entries, entry)
+	}
+	return result, nil
+}
+
+func (r *Repository) GetDocumentTables(id string) ([]models.DocumentTable, error) {
+	r, end := r.trace("GetDocumentTables")
+	defer end()
+
+	var document models.Document
+	if err := r.db.Select("id").First(&document, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+
+	tables := []models.DocumentTable{}
+	err := r.db.Where("document_id = ?", id).
+		Order("page ASC, table_index ASC").
+		Find(&tables).Error
+	if err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
+
+func (r *Repository) GetDocumentSprite(id string) (*models.SpriteResponse, error) {
+	r, end := r.trace("GetDocumentSprite")
+	defer end()
+
+	var sheets []models.DocumentSprite
+	err := r.db.Where("document_id = ?", id).Order("sheet ASC").Find(&sheets).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(sheets) == 0 {
+		return nil, notFound(gorm.ErrRecordNotFound)
+	}
+
+	resp := &models.SpriteResponse{
+		DocumentID: id,
+		TileWidth:  sheets[0].TileWidth,
+		TileHeight: sheets[0].TileHeight,
+		Sheets:     sheets,
+		Pages:      []models.SpriteTile{},
+	}
+
+	// Tiles are laid out row by row, left to right
+	for _, sheet := range sheets {
+		if sheet.Columns == 0 {
+			continue
+		}
+		for i := 0; i < sheet.PageCount; i++ {
+			resp.Pages = append(resp.Pages, models.SpriteTile{
+				Page:  sheet.FirstPage + i,
+				Sheet: sheet.Sheet,
+				X:     (i % sheet.Columns) * sheet.TileWidth,
+				Y:     (i / sheet.Columns) * sheet.TileHeight,
+			})
+		}
+	}
+
+	return resp, nil
+}
+
+// GetDocumentPages returns a document's pages in reading order, paginated by page number
+func (r *Repository) GetDocumentPages(id string, cursor string, limit int) (*models.PaginatedResponse, error) {
+	r, end := r.trace("GetDocumentPages")
+	defer end()
+
+	var document models.Document
+	if err := r.db.Select("id").First(&document, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+
+	var pages []models.Page
+	query := r.db.Model(&models.Page{}).Where("document_id = ?", id)
+
+	var total int64
+	query.Count(&total)
+
+	c := pageCursor(cursor)
+	order := "number ASC"
+	if c != nil && c.LastID > 0 {
+		if c.Before {
+			query = query.Where("number < ?", c.LastID)
+			order = "number DESC"
+		} else {
+			query = query.Where("number > ?", c.LastID)
+		}
+	}
+
+	err := query.Order(order).Limit(limit + 1).Find(&pages).Error
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &models.PaginatedResponse{Total: total}
+	resp.Data = keysetPage(resp, pages, limit, c, func(page models.Page) models.Cursor {
+		return models.Cursor{LastID: uint(page.Number)}
+	})
+	return resp, nil
+}
+
+// Images before and after (page, id) in a document's page order
+const (
+	imageBefore = "images.page < ? OR (images.page = ? AND images.id < ?)"
+	imageAfter  = "images.page > ? OR (images.page = ? AND images.id > ?)"
+)
+
+// GetDocumentImages returns a document's images by page number, each with its
+// position and neighbours among the images matching filters. The neighbours
+// of the first and last image may lie on the pages either side.
+func (r *Repository) GetDocumentImages(id string, cursor string, limit int, filters ImageFilters) (*models.PaginatedResponse, error) {
+	r, end := r.trace("GetDocumentImages")
+	defer end()
+
+	var document models.Document
+	if err := r.db.Select("id").First(&document, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+
+	filters.DocumentID = id
+	inDocument := func() *gorm.DB {
+		return applyImageFilters(r.db.Model(&models.Image{}).Joins(joinImagePages), filters)
+	}
+
+	var total int64
+	inDocument().Count(&total)
+
+	query := inDocument()
+	c := pageCursor(cursor)
+	if c != nil && c.LastID > 0 {
+		lastPage, _ := strconv.Atoi(c.LastValue)
+		if c.Before {
+			query = query.Where(imageBefore, lastPage, lastPage, c.LastID)
+		} else {
+			query = query.Where(imageAfter, lastPage, lastPage, c.LastID)
+		}
+	}
+
+	pageOrder, idOrder := "images.page ASC", "images.id ASC"
+	if backward(c) {
+		pageOrder, idOrder = "images.page DESC", "images.id DESC"
+	}
+	var images []models.Image
+	err := query.Select(imageColumnsWithPageText).Preload("Tags", tagsByConfidence).
+		Order(pageOrder).Order(idOrder).Limit(limit + 1).Find(&images).Error
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &models.PaginatedResponse{Total: total}
+	images = keysetPage(resp, images, limit, c, func(image models.Image) models.Cursor {
+		return models.Cursor{LastID: image.ID, LastValue: strconv.Itoa(image.Page)}
+	})
+
+	items := make([]models.DocumentImage, len(images))
+	resp.Data = items
+	if len(images) == 0 {
+		return resp, nil
+	}
+
+	first, last := images[0], images[len(images)-1]
+	var earlier int64
+	if err := inDocument().Where(imageBefore, first.Page, first.Page, first.ID).Count(&earlier).Error; err != nil {
+		return nil, err
+	}
+	var prev, next []uint
+	err = inDocument().Where(imageBefore, first.Page, first.Page, first.ID).
+		Order("images.page DESC").Order("images.id DESC").Limit(1).Pluck("images.id", &prev).Error
+	if err != nil {
+		return nil, err
+	}
+	err = inDocument().Where(imageAfter, last.Page, last.Page, last.ID).
+		Order("images.page ASC").Order("images.id ASC").Limit(1).Pluck("images.id", &next).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range images {
+		items[i] = models.DocumentImage{Image: images[i], Position: earlier + int64(i) + 1}
+		switch {
+		case i > 0:
+			items[i].PrevImageID = &images[i-1].ID
+		case len(prev) > 0:
+			items[i].PrevImageID = &prev[0]
+		}
+		switch {
+		case i < len(images)-1:
+			items[i].NextImageID = &images[i+1].ID
+		case len(next) > 0:
+			items[i].NextImageID = &next[0]
+		}
+	}
+	return resp, nil
+}
+
+// GetDocumentText returns a document's full text, empty when it has none
+func (r *Repository) GetDocumentText(id string) (*models.DocumentText, error) {
+	r, end := r.trace("GetDocumentText")
+	defer end()
+
+	var document models.Document
+	if err := r.db.Select("id").First(&document, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+
+	text := models.DocumentText{DocumentID: id}
+	err := r.db.Where("document_id = ?", id).Limit(1).Find(&text).Error
+	return &text, err
+}
+
 // ============================================================================
 // SEARCH
 // ============================================================================
 
-func (r *Repository) Search(query string, limit int) (*models.SearchResult, error) {
+// Search result orderings
+const (
+	RankRelevance = "relevance" // weighted BM25 with dataset boosts
+	RankDate      = "date"      // most recently ingested first
+	RankEFTA      = "efta"      // EFTA (Bates) number order
+)
+
+// SearchOptions controls how Search ranks and trims results
+type SearchOptions struct {
+	Limit int
+	Rank  string // RankRelevance (default), RankDate or RankEFTA
+
+	// BM25 weights of the FTS columns: the document ID (the filename) and
+	// the text. Zero weights default to 1.
+	FilenameWeight float64
+	TextWeight     float64
+
+	// Relevance multipliers by DOJ dataset number, matched on source_url
+	DatasetBoosts map[int]float64
+
+	// Relevance multiplier for OCR-only documents whose OCR confidence is
+	// below OCRMinConfidence; 0 leaves them be
+	OCRDemotion      float64
+	OCRMinConfidence float64
+
+	// Lowercase terms left out of the index, so dropped from the query
+	Stopwords map[string]bool
+
+	// Keep only the best-ranked document of each near-duplicate cluster
+	CollapseDuplicates bool
+
+	// Matching images returned per document; 0 returns them all
+	ImagesPerDocument int
+}
+
+// dropStopwords removes stopwords from a search query. A query made only of
+// stopwords is kept as it is.
+func dropStopwords(query string, stopwords map[string]bool) string {
+	if len(stopwords) == 0 {
+		return query
+	}
+	var kept []string
+	for _, term := range strings.Fields(query) {
+		if !stopwords[strings.ToLower(strings.Trim(term, `"'()*,.:;?!`))] {
+			kept = append(kept, term)
+		}
+	}
+	if len(kept) == 0 {
+		return query
+	}
+	return strings.Join(kept, " ")
+}
+
+// ValidRank reports whether rank is a known search ordering
+func ValidRank(rank string) bool {
+	return rank == RankRelevance || rank == RankDate || rank == RankEFTA
+}
+
+// searchOrder builds the ORDER BY clause and its arguments for a search
+// over documents_fts joined with documents
+func searchOrder(opts SearchOptions) (string, []interface{}) {
+	switch opts.Rank {
+	case RankDate:
+		return "documents.created_at DESC, documents.id ASC", nil
+	case RankEFTA:
+		return "documents.id ASC", nil
+	}
+
+	weight := func(w float64) float64 {
+		if w == 0 {
+			return 1
+		}
+		return w
+	}
+	order := "bm25(documents_fts, ?, ?)"
+	args := []interface{}{weight(opts.FilenameWeight), weight(opts.TextWeight)}
+
+	// bm25 is negative, better matches lower, so a boost above 1 lifts a
+	// document. Datasets in sorted order keep the SQL stable.
+	if len(opts.DatasetBoosts) > 0 {
+		datasets := make([]int, 0, len(opts.DatasetBoosts))
+		for n := range opts.DatasetBoosts {
+			datasets = append(datasets, n)
+		}
+		sort.Ints(datasets)
+
+		order += " * CASE"
+		for _, n := range datasets {
+			encoded, plain := datasetURLPatterns(n)
+			order += " WHEN instr(documents.source_url, ?) > 0 OR instr(documents.source_url, ?) > 0 THEN ?"
+			args = append(args, encoded, plain, opts.DatasetBoosts[n])
+		}
+		order += " ELSE 1 END"
+	}
+	if opts.OCRDemotion > 0 {
+		order += " * CASE WHEN documents.text_source = ? AND documents.ocr_confidence < ? THEN ? ELSE 1 END"
+		args = append(args, models.TextSourceOCR, opts.OCRMinConfidence, opts.OCRDemotion)
+	}
+	return order + ", documents.id ASC", args
+}
+
+// Search finds documents matching query, in rank order, each with the
+// images on pages that match it too
+func (r *Repository) Search(query string, opts SearchOptions) (*models.SearchResult, error) {
+	r, end := r.trace("Search")
+	defer end()
+
 	result := &models.SearchResult{
 		Query:     query,
 		Documents: []models.Document{},
-		Images:    []models.Image{},
 	}
 
 	if query == "" {
 		return result, nil
 	}
 
+	limit := opts.Limit
+
+	// Collapsing drops results, so over-fetch to still fill the page
+	fetch := limit
+	if opts.CollapseDuplicates {
+		fetch = limit * collapseOverfetch
+	}
+
 	// Search using FTS5
 	var documentIDs []string
-	searchQuery := fmt.Sprintf("%s*", query) // Prefix search
+	searchQuery := fmt.Sprintf("%s*", dropStopwords(query, opts.Stopwords)) // Prefix search
 
+	order, orderArgs := searchOrder(opts)
+	args := append([]interface{}{searchQuery}, orderArgs...)
 	err := r.db.Raw(`
-		SELECT document_id FROM documents_fts
+		SELECT documents_fts.document_id FROM documents_fts
+		JOIN documents ON documents.id = documents_fts.document_id
 		WHERE documents_fts MATCH ?
-		ORDER BY rank
+		ORDER BY `+order+`
 		LIMIT ?
-	`, searchQuery, limit).Scan(&documentIDs).Error
+	`, append(args, fetch)...).Scan(&documentIDs).Error
 
 	if err != nil {
-		// Fallback to LIKE search if FTS fails
+		// Fallback to LIKE search if FTS fails; without scores relevance
+		// falls back to EFTA order
+		fallback := "documents.id ASC"
+		if opts.Rank == RankDate {
+			fallback = "documents.created_at DESC, documents.id ASC"
+		}
 		err = r.db.Model(&models.Document{}).
-			Where("full_text LIKE ?", "%"+query+"%").
-			Limit(limit).
+			Where("id IN (SELECT document_id FROM document_texts WHERE text LIKE ?)", "%"+query+"%").
+			Order(fallback).
+			Limit(fetch).
 			Pluck("id", &documentIDs).Error
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	var collapsed map[string]collapsedResult
+	if opts.CollapseDuplicates && len(documentIDs) > 0 {
+		documentIDs, collapsed, err = r.collapseDuplicates(documentIDs, limit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if len(documentIDs) > 0 {
-		// Get documents
+		// Get documents, back in rank order
 		r.db.Where("id IN ?", documentIDs).Find(&result.Documents)
+		position := make(map[string]int, len(documentIDs))
+		for i, id := range documentIDs {
+			position[id] = i
+		}
+		sort.Slice(result.Documents, func(i, j int) bool {
+			return position[result.Documents[i].ID] < position[result.Documents[j].ID]
+		})
+		for i := range result.Documents {
+			if c, ok := collapsed[result.Documents[i].ID]; ok {
+				result.Documents[i].DuplicateClusterID = c.clusterID
+				result.Documents[i].CollapsedDuplicates = c.dropped
+			}
+		}
 
-		// Get images from those documents
-		r.db.Where("document_id IN ?", documentIDs).Find(&result.Images)
+		if err := r.searchImages(result.Documents, dropStopwords(query, opts.Stopwords), opts.ImagesPerDocument); err != nil {
+			return nil, err
+		}
 
 		result.Total = int64(len(result.Documents))
 	}
@@ -195,11 +947,115 @@ func (r *Repository) Search(query string, limit int) (*models.SearchResult, erro
 	return result, nil
 }
 
+// searchImages attaches to each document the images whose page text or own
+// OCR text has every term of query, up to perDocument of them (0 for all). An image
+// already shown, in the same or a better-ranked document, isn't repeated.
+func (r *Repository) searchImages(documents []models.Document, query string, perDocument int) error {
+	ids := make([]string, len(documents))
+	for i, d := range documents {
+		ids[i] = d.ID
+	}
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil
+	}
+	q := r.db.Scopes(withPageText).Where("images.document_id IN ?", ids)
+	for _, term := range terms {
+		q = q.Where("(pages.text LIKE ? OR images.ocr_text LIKE ?)", "%"+term+"%", "%"+term+"%")
+	}
+
+	var images []models.Image
+	if err := q.Order("images.page ASC, images.id ASC").Find(&images).Error; err != nil {
+		return err
+	}
+	byDocument := make(map[string][]models.Image)
+	for _, img := range images {
+		byDocument[img.DocumentID] = append(byDocument[img.DocumentID], img)
+	}
+
+	seen := make(map[string]bool) // by content hash
+	for i := range documents {
+		d := &documents[i]
+		for _, img := range byDocument[d.ID] {
+			if img.SHA256 != "" {
+				if seen[img.SHA256] {
+					continue
+				}
+				seen[img.SHA256] = true
+			}
+			d.MatchingImages++
+			if perDocument == 0 || len(d.Images) < perDocument {
+				d.Images = append(d.Images, img)
+			}
+		}
+	}
+	return nil
+}
+
+// searchTerms splits a search query into the words images must contain,
+// leaving out punctuation and the FTS operators
+func searchTerms(query string) []string {
+	var terms []string
+	for _, term := range strings.Fields(query) {
+		term = strings.Trim(term, `"'()*,.:;?!`)
+		if term == "" || strings.EqualFold(term, "AND") || strings.EqualFold(term, "OR") || strings.EqualFold(term, "NOT") {
+			continue
+		}
+		terms = append(terms, term)
+	}
+	return terms
+}
+
+// How many candidates per result Search fetches when collapsing duplicates
+const collapseOverfetch = 3
+
+type collapsedResult struct {
+	clusterID uint
+	dropped   int // lower-ranked members of the cluster left out
+}
+
+// collapseDuplicates keeps the first of ids from each near-duplicate
+// cluster, preserving rank order, up to limit ids
+func (r *Repository) collapseDuplicates(ids []string, limit int) ([]string, map[string]collapsedResult, error) {
+	clusters, err := r.documentClusters(ids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	kept := make([]string, 0, limit)
+	keptFor := make(map[uint]string)
+	collapsed := make(map[string]collapsedResult)
+	for _, id := range ids {
+		clusterID, ok := clusters[id]
+		if !ok {
+			if len(kept) < limit {
+				kept = append(kept, id)
+			}
+			continue
+		}
+		if first, seen := keptFor[clusterID]; seen {
+			c := collapsed[first]
+			c.dropped++
+			collapsed[first] = c
+			continue
+		}
+		if len(kept) < limit {
+			kept = append(kept, id)
+			keptFor[clusterID] = id
+			collapsed[id] = collapsedResult{clusterID: clusterID}
+		}
+	}
+	return kept, collapsed, nil
+}
+
 // ============================================================================
 // STATS
 // ============================================================================
 
 func (r *Repository) GetStats() (*models.Stats, error) {
+	r, end := r.trace("GetStats")
+	defer end()
+
 	stats := &models.Stats{}
 
 	r.db.Model(&models.Document{}).Count(&stats.TotalDocuments)
@@ -211,9 +1067,107 @@ func (r *Repository) GetStats() (*models.Stats, error) {
 	r.db.Model(&models.Image{}).Select("COALESCE(SUM(size_bytes), 0)").Scan(&totalSize)
 	stats.TotalSizeBytes = totalSize
 
+	r.db.Model(&models.Document{}).Select("COALESCE(SUM(blank_page_count), 0)").Scan(&stats.BlankPages)
+
 	return stats, nil
 }
 
+// Start-of-period expressions and steps for GetGrowth. Weeks start on Monday.
+var growthIntervals = map[string]struct {
+	period              string
+	years, months, days int
+}{
+	"day":   {"date(%s)", 0, 0, 1},
+	"week":  {"date(%s, 'weekday 0', '-6 days')", 0, 0, 7},
+	"month": {"strftime('%%Y-%%m-01', %s)", 0, 1, 0},
+	"year":  {"strftime('%%Y-01-01', %s)", 1, 0, 0},
+}
+
+// ValidGrowthInterval reports whether GetGrowth accepts interval
+func ValidGrowthInterval(interval string) bool {
+	_, ok := growthIntervals[interval]
+	return ok
+}
+
+// GetGrowth counts the documents and images ingested per interval, oldest
+// first. Periods with nothing ingested are included so charts have no gaps.
+func (r *Repository) GetGrowth(interval string) ([]models.GrowthBucket, error) {
+	r, end := r.trace("GetGrowth")
+	defer end()
+
+	iv, ok := growthIntervals[interval]
+	if !ok {
+		return nil, invalidf("unknown interval %q", interval)
+	}
+
+	type row struct {
+		Period string
+		Count  int64
+		Bytes  int64
+	}
+	added := func(model interface{}) (map[string]row, error) {
+		var rows []row
+		period := fmt.Sprintf(iv.period, "created_at")
+		err := r.db.Model(model).
+			Select(period + " AS period, COUNT(*) AS count, COALESCE(SUM(size_bytes), 0) AS bytes").
+			Where("created_at IS NOT NULL").Group("period").Scan(&rows).Error
+		byPeriod := make(map[string]row, len(rows))
+		for _, x := range rows {
+			byPeriod[x.Period] = x
+		}
+		return byPeriod, err
+	}
+
+	docs, err := added(&models.Document{})
+	if err != nil {
+		return nil, err
+	}
+	images, err := added(&models.Image{})
+	if err != nil {
+		return nil, err
+	}
+
+	var first, last time.Time
+	for _, m := range []map[string]row{docs, images} {
+		for p := range m {
+			t, err := time.Parse("2006-01-02", p)
+			if err != nil {
+				continue
+			}
+			if first.IsZero() || t.Before(first) {
+				first = t
+			}
+			if t.After(last) {
+				last = t
+			}
+		}
+	}
+
+	buckets := []models.GrowthBucket{}
+	if first.IsZero() {
+		return buckets, nil
+	}
+	var totalDocs, totalImages, totalBytes int64
+	for t := first; !t.After(last); t = t.AddDate(iv.years, iv.months, iv.days) {
+		p := t.Format("2006-01-02")
+		d, img := docs[p], images[p]
+		totalDocs += d.Count
+		totalImages += img.Count
+		totalBytes += d.Bytes + img.Bytes
+		buckets = append(buckets, models.GrowthBucket{
+			Period:         p,
+			Documents:      d.Count,
+			Images:         img.Count,
+			DocumentBytes:  d.Bytes,
+			ImageBytes:     img.Bytes,
+			TotalDocuments: totalDocs,
+			TotalImages:    totalImages,
+			TotalBytes:     totalBytes,
+		})
+	}
+	return buckets, nil
+}
+
 // ============================================================================
 // CURSOR HELPERS
 // ============================================================================
@@ -223,6 +1177,61 @@ func encodeCursor(c models.Cursor) string {
 	return base64.URLEncoding.EncodeToString(data)
 }
 
+// pageCursor decodes a list cursor, or returns nil for the first page. An
+// invalid cursor also starts from the beginning.
+func pageCursor(s string) *models.Cursor {
+	if s == "" {
+		return nil
+	}
+	c, err := decodeCursor(s)
+	if err != nil {
+		return nil
+	}
+	return c
+}
+
+// backward reports whether c is a prev cursor, so the page is read in
+// reverse order up to its row
+func backward(c *models.Cursor) bool {
+	return c != nil && c.Before
+}
+
+// keysetPage trims rows, fetched with limit+1 from cursor c, to one page
+// in list order and sets resp's cursors. key gives the cursor after a row.
+func keysetPage[T any](resp *models.PaginatedResponse, rows []T, limit int, c *models.Cursor, key func(T) models.Cursor) []T {
+	extra := len(rows) > limit
+	if extra {
+		rows = rows[:limit]
+	}
+	if backward(c) {
+		slices.Reverse(rows)
+	}
+	if len(rows) == 0 {
+		return rows
+	}
+
+	next := key(rows[len(rows)-1])
+	prev := key(rows[0])
+	prev.Before = true
+	if backward(c) {
+		// The page ends before the cursor's row, so there is always more after
+		resp.HasMore = true
+		resp.NextCursor = encodeCursor(next)
+		if extra {
+			resp.PrevCursor = encodeCursor(prev)
+		}
+	} else {
+		resp.HasMore = extra
+		if extra {
+			resp.NextCursor = encodeCursor(next)
+		}
+		if c != nil {
+			resp.PrevCursor = encodeCursor(prev)
+		}
+	}
+	return rows
+}
+
 func decodeCursor(s string) (*models.Cursor, error) {
 	data, err := base64.URLEncoding.DecodeString(s)
 	if err != nil {
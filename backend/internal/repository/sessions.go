@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/epstein-files/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// SESSIONS
+// ============================================================================
+
+// CreateSession stores a new sign-in, clearing out expired ones
+func (r *Repository) CreateSession(session *models.Session) error {
+	r, end := r.trace("CreateSession")
+	defer end()
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expires_at < ?", time.Now()).Delete(&models.Session{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(session).Error
+	})
+}
+
+// GetSession returns the session stored under id, nil when there is none or
+// it has expired
+func (r *Repository) GetSession(id string) (*models.Session, error) {
+	r, end := r.trace("GetSession")
+	defer end()
+
+	var session models.Session
+	err := r.db.Where("id = ? AND expires_at > ?", id, time.Now()).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// DeleteSession signs a session out
+func (r *Repository) DeleteSession(id string) error {
+	r, end := r.trace("DeleteSession")
+	defer end()
+
+	return r.db.Delete(&models.Session{}, "id = ?", id).Error
+}
@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/epstein-files/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// CHANGE LOG
+// ============================================================================
+
+// GetChanges returns change log entries after the cursor, oldest first. The
+// next cursor is always set so consumers that are caught up can keep polling.
+func (r *Repository) GetChanges(cursor string, limit int) (*models.PaginatedResponse, error) {
+	r, end := r.trace("GetChanges")
+	defer end()
+
+	changes := []models.Change{}
+	query := r.db.Model(&models.Change{})
+
+	var afterID uint
+	if cursor != "" {
+		decoded, err := decodeCursor(cursor)
+		if err == nil {
+			afterID = decoded.LastID
+		}
+	}
+
+	err := query.Where("id > ?", afterID).Order("id ASC").Limit(limit + 1).Find(&changes).Error
+	if err != nil {
+		return nil, err
+	}
+
+	hasMore := len(changes) > limit
+	if hasMore {
+		changes = changes[:limit]
+	}
+
+	if len(changes) > 0 {
+		afterID = changes[len(changes)-1].ID
+	}
+
+	return &models.PaginatedResponse{
+		Data:       changes,
+		NextCursor: encodeCursor(models.Cursor{LastID: afterID}),
+		HasMore:    hasMore,
+	}, nil
+}
+
+// GetRow returns the current column values of a tracked row, or nil if it
+// no longer exists. Documents carry their text as full_text, so mirrors
+// receive it with the row. Face embeddings never leave the server.
+func (r *Repository) GetRow(table, id string) (map[string]interface{}, error) {
+	r, end := r.trace("GetRow")
+	defer end()
+
+	if !isChangeTable(table) {
+		return nil, invalidf("unknown table %q", table)
+	}
+	row := map[string]interface{}{}
+	err := r.db.Table(table).Where("id = ?", id).Take(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	for _, col := range privateColumns[table] {
+		delete(row, col)
+	}
+	if err != nil || table != "documents" {
+		return row, err
+	}
+
+	var texts []string
+	if err := r.db.Model(&models.DocumentText{}).Where("document_id = ?", id).Pluck("text", &texts).Error; err != nil {
+		return nil, err
+	}
+	if len(texts) > 0 {
+		row["full_text"] = texts[0]
+	}
+	return row, nil
+}
+
+// Columns of tracked rows that are kept out of the change feed
+var privateColumns = map[string][]string{
+	"faces": {"embedding"},
+}
+
+// BLOB columns of tracked rows, which arrive base64-encoded from JSON
+var blobColumns = map[string]bool{
+	"passages.embedding": true,
+}
+
+var columnName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// ApplyChange replays a change from another instance. Upserts replace the
+// whole row; document text is stored apart and re-indexed for full-text
+// search. Foreign keys aren't checked: the rows are the primary's, orphans
+// included, and an image may arrive before its document.
+func (r *Repository) ApplyChange(table, op, id string, row map[string]interface{}) error {
+	r, end := r.trace("ApplyChange")
+	defer end()
+
+	if !isChangeTable(table) {
+		return invalidf("unknown table %q", table)
+	}
+
+	// The pragma is per connection and can't change inside a transaction
+	return r.db.Connection(func(conn *gorm.DB) error {
+		var enforced int
+		if err := conn.Raw("PRAGMA foreign_keys").Scan(&enforced).Error; err != nil {
+			return err
+		}
+		if enforced == 1 {
+			conn.Exec("PRAGMA foreign_keys = OFF")
+			defer conn.Exec("PRAGMA foreign_keys = ON")
+		}
+		return conn.Transaction(func(tx *gorm.DB) error {
+			return applyChange(tx, table, op, id, row)
+		})
+	})
+}
+
+func applyChange(tx *gorm.DB, table, op, id string, row map[string]interface{}) error {
+	if op == models.ChangeDelete || row == nil {
+		if err := tx.Exec("DELETE FROM "+table+" WHERE id = ?", id).Error; err != nil {
+			return holdError(err)
+		}
+		if table == "documents" {
+			if err := tx.Delete(&models.DocumentText{}, "document_id = ?", id).Error; err != nil {
+				return err
+			}
+			tx.Exec("DELETE FROM documents_fts WHERE document_id = ?", id)
+		}
+		return nil
+	}
+
+	var text string
+	if table == "documents" {
+		text, _ = row["full_text"].(string)
+		delete(row, "full_text")
+	}
+
+	columns := make([]string, 0, len(row))
+	for col := range row {
+		if !columnName.MatchString(col) {
+			return invalidf("invalid column %q", col)
+		}
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+
+	values := make([]interface{}, len(columns))
+	for i, col := range columns {
+		values[i] = row[col]
+		if encoded, ok := row[col].(string); ok && blobColumns[table+"."+col] {
+			blob, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return invalidf("invalid %s.%s: %v", table, col, err)
+			}
+			values[i] = blob
+		}
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	err := tx.Exec(fmt.Sprintf("INSERT OR REPLACE INTO %s (%s) VALUES (%s)",
+		table, strings.Join(columns, ", "), placeholders), values...).Error
+	if err != nil {
+		return err
+	}
+
+	if table == "documents" {
+		if err := tx.Save(&models.DocumentText{DocumentID: id, Text: text}).Error; err != nil {
+			return err
+		}
+		// FTS may be unavailable; search falls back to LIKE then
+		tx.Exec("DELETE FROM documents_fts WHERE document_id = ?", id)
+		if text != "" {
+			tx.Exec("INSERT INTO documents_fts (document_id, full_text) VALUES (?, ?)", id, text)
+		}
+	}
+	return nil
+}
+
+func isChangeTable(table string) bool {
+	for _, t := range models.ChangeTables {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
+
+// ============================================================================
+// META
+// ============================================================================
+
+// GetMeta returns a stored instance value, or "" if unset
+func (r *Repository) GetMeta(key string) (string, error) {
+	var meta models.Meta
+	err := r.db.First(&meta, "key = ?", key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	return meta.Value, err
+}
+
+func (r *Repository) SetMeta(key, value string) error {
+	return r.db.Save(&models.Meta{Key: key, Value: value}).Error
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/epstein-files/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============================================================================
+// STORAGE TIERS
+// ============================================================================
+
+// GetFileTier returns the tier of a document's source PDF; a document without
+// a row is hot
+func (r *Repository) GetFileTier(documentID string) (*models.FileTier, error) {
+	r, end := r.trace("GetFileTier")
+	defer end()
+
+	tier := models.FileTier{DocumentID: documentID}
+	err := r.db.Where("document_id = ?", documentID).Limit(1).Find(&tier).Error
+	return &tier, err
+}
+
+// TouchFile records a read of a document's source PDF
+func (r *Repository) TouchFile(documentID string, at time.Time) error {
+	r, end := r.trace("TouchFile")
+	defer end()
+
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "document_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_accessed_at", "updated_at"}),
+	}).Create(&models.FileTier{DocumentID: documentID, LastAccessedAt: &at}).Error
+}
+
+// SetFileTier records the tier a document's source PDF was moved to
+func (r *Repository) SetFileTier(documentID, tier string, restoredUntil *time.Time) error {
+	r, end := r.trace("SetFileTier")
+	defer end()
+
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "document_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"tier", "restored_until", "updated_at"}),
+	}).Create(&models.FileTier{DocumentID: documentID, Tier: tier, RestoredUntil: restoredUntil}).Error
+}
+
+// ClaimRestore marks a cold PDF as being restored, returning false when it
+// isn't cold (already hot, or another request got there first)
+func (r *Repository) ClaimRestore(documentID string) (bool, error) {
+	r, end := r.trace("ClaimRestore")
+	defer end()
+
+	res := r.db.Model(&models.FileTier{}).
+		Where("document_id = ? AND tier = ?", documentID, models.TierCold).
+		Update("tier", models.TierRestoring)
+	return res.RowsAffected > 0, res.Error
+}
+
+// coldCandidates selects the hot and restored documents last read (or, never
+// read, ingested) before accessedBefore, leaving restored ones until their
+// RestoredUntil has passed by now
+func (r *Repository) coldCandidates(accessedBefore, now time.Time) *gorm.DB {
+	return r.db.Model(&models.Document{}).
+		Joins("LEFT JOIN file_tiers ON file_tiers.document_id = documents.id").
+		Where("COALESCE(file_tiers.tier, '') IN ?", []string{"", models.TierRestored}).
+		Where("COALESCE(file_tiers.last_accessed_at, documents.created_at) < ?", accessedBefore).
+		Where("(file_tiers.restored_until IS NULL OR file_tiers.restored_until < ?)", now)
+}
+
+// GetColdCandidates returns documents after afterRowID whose source PDF is
+// due to move to the cold tier
+func (r *Repository) GetColdCandidates(afterRowID uint, accessedBefore, now time.Time, limit int) ([]FileRecord, error) {
+	r, end := r.trace("GetColdCandidates")
+	defer end()
+
+	records := []FileRecord{}
+	err := r.coldCandidates(accessedBefore, now).
+		Select("documents.rowid, documents.id, documents.filename, documents.size_bytes, documents.sha256").
+		Where("documents.rowid > ?", afterRowID).
+		Order("documents.rowid ASC").Limit(limit).Scan(&records).Error
+	return records, err
+}
+
+// CountColdCandidates counts the documents GetColdCandidates will visit
+func (r *Repository) CountColdCandidates(accessedBefore, now time.Time) (int64, error) {
+	r, end := r.trace("CountColdCandidates")
+	defer end()
+
+	var count int64
+	err := r.coldCandidates(accessedBefore, now).Count(&count).Error
+	return count, err
+}
+
+// CountFileTiers counts source PDFs by tier; documents without a row are
+// counted as hot ("")
+func (r *Repository) CountFileTiers() (map[string]int64, error) {
+	r, end := r.trace("CountFileTiers")
+	defer end()
+
+	var rows []struct {
+		Tier  string
+		Count int64
+	}
+	err := r.db.Model(&models.Document{}).
+		Select("COALESCE(file_tiers.tier, '') AS tier, COUNT(*) AS count").
+		Joins("LEFT JOIN file_tiers ON file_tiers.document_id = documents.id").
+		Group("COALESCE(file_tiers.tier, '')").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int64{}
+	for _, row := range rows {
+		counts[row.Tier] = row.Count
+	}
+	return counts, nil
+}
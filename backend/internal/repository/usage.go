@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"github.com/epstein-files/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============================================================================
+// USAGE STATISTICS
+// ============================================================================
+
+// AddUsageStats adds the counts to the stored ones for the same day and
+// route, so several processes can share the table
+func (r *Repository) AddUsageStats(stats []models.UsageStat) error {
+	r, end := r.trace("AddUsageStats")
+	defer end()
+
+	if len(stats) == 0 {
+		return nil
+	}
+	add := func(column string) clause.Assignment {
+		return clause.Assignment{
+			Column: clause.Column{Name: column},
+			Value:  gorm.Expr("usage_stats." + column + " + excluded." + column),
+		}
+	}
+	set := []clause.Assignment{add("requests"), add("client_errors"), add("server_errors"), add("total_us"),
+		{Column: clause.Column{Name: "updated_at"}, Value: gorm.Expr("excluded.updated_at")}}
+	for _, b := range []string{"le10", "le50", "le100", "le250", "le500", "le1000", "le5000", "slower"} {
+		set = append(set, add("ms_"+b))
+	}
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "day"}, {Name: "route"}},
+		DoUpdates: clause.Set(set),
+	}).Create(&stats).Error
+}
+
+// GetUsageStats returns the counts from since ("2006-01-02") on
+func (r *Repository) GetUsageStats(since string) ([]models.UsageStat, error) {
+	r, end := r.trace("GetUsageStats")
+	defer end()
+
+	var stats []models.UsageStat
+	if err := r.db.Where("day >= ?", since).Find(&stats).Error; err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// DeleteUsageStatsBefore drops the counts of days before day
+func (r *Repository) DeleteUsageStatsBefore(day string) error {
+	r, end := r.trace("DeleteUsageStatsBefore")
+	defer end()
+
+	return r.db.Where("day < ?", day).Delete(&models.UsageStat{}).Error
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrLegalHold is returned for deletes while legal hold is on
+var ErrLegalHold = errors.New("storage: legal hold is on; files cannot be deleted")
+
+// Version is one stored revision of a file; version 1 is the original
+type Version struct {
+	Number int    `json:"number"`
+	Key    string `json:"key"`
+}
+
+// Hold makes a Writer append-only for archives with preservation
+// requirements. Nothing stored is ever removed or modified: deletes are
+// refused, and writing to an existing key stores the new content as the
+// next version of the file next to the original ("<key>@v2", "<key>@v3").
+// Open returns the latest version.
+type Hold struct {
+	w  Writer
+	mu sync.Mutex // serializes version numbering
+}
+
+func NewHold(w Writer) *Hold {
+	return &Hold{w: w}
+}
+
+func versionKey(key string, n int) string {
+	if n == 1 {
+		return key
+	}
+	return fmt.Sprintf("%s@v%d", key, n)
+}
+
+// Versions lists the stored revisions of key, oldest first
+func (h *Hold) Versions(ctx context.Context, key string) ([]Version, error) {
+	var versions []Version
+	for n := 1; ; n++ {
+		k := versionKey(key, n)
+		ok, err := h.w.Exists(ctx, k)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return versions, nil
+		}
+		versions = append(versions, Version{Number: n, Key: k})
+	}
+}
+
+func (h *Hold) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	versions, err := h.Versions(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, ErrNotFound
+	}
+	return h.w.Open(ctx, versions[len(versions)-1].Key)
+}
+
+func (h *Hold) Put(ctx context.Context, key string, r io.Reader) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	versions, err := h.Versions(ctx, key)
+	if err != nil {
+		return err
+	}
+	return h.w.Put(ctx, versionKey(key, len(versions)+1), r)
+}
+
+func (h *Hold) Delete(ctx context.Context, key string) error {
+	return ErrLegalHold
+}
+
+func (h *Hold) Exists(ctx context.Context, key string) (bool, error) {
+	return h.w.Exists(ctx, key)
+}
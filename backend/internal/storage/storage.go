@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// ErrNotFound is returned when a key has no stored file
+var ErrNotFound = errors.New("file not found in storage")
+
+// Store reads archive files by key. Keys use the CDN layout:
+// "pdfs/<file>.pdf", "images/<document>/<file>", "sprites/<document>/<file>".
+type Store interface {
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// Writer is a Store that can also save and delete files
+type Writer interface {
+	Store
+	Put(ctx context.Context, key string, r io.Reader) error
+	Delete(ctx context.Context, key string) error
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+// Checker is a Store that can report whether its backend is reachable,
+// without reading any file
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+func ContributionKey(sha256 string) string {
+	return "contrib/" + sha256 + ".pdf"
+}
+
+func DocumentKey(filename string) string {
+	return "pdfs/" + filename
+}
+
+func DatasetFileKey(datasetID uint, filename string) string {
+	return fmt.Sprintf("datasets/%d/%s", datasetID, filename)
+}
+
+func ImageKey(documentID, filename string) string {
+	return "images/" + documentID + "/" + filename
+}
+
+func SpriteKey(documentID, filename string) string {
+	return "sprites/" + documentID + "/" + filename
+}
+
+// BlobKey is where the content-addressed store keeps a file by its SHA-256,
+// fanned out over two levels of directories
+func BlobKey(sha256 string) string {
+	return "blobs/" + sha256[:2] + "/" + sha256[2:4] + "/" + sha256
+}
+
+// ============================================================================
+// CDN
+// ============================================================================
+
+// CDN reads files over HTTP from the public CDN
+type CDN struct {
+	BaseURL string
+	client  *http.Client
+}
+
+func NewCDN(baseURL string) *CDN {
+	return &CDN{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		client: &http.Client{
+			Timeout:   60 * time.Second,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+	}
+}
+
+func (s *CDN) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	if s.BaseURL == "" {
+		return nil, errors.New("storage: STORAGE_BASE_URL is not set")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.BaseURL+"/"+key, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	resp.Body.Close()
+	return nil, fmt.Errorf("storage: CDN returned %s for %s", resp.Status, key)
+}
+
+// Check sends a HEAD to the CDN root; any answer short of a server error
+// means it is up
+func (s *CDN) Check(ctx context.Context) error {
+	if s.BaseURL == "" {
+		return errors.New("storage: STORAGE_BASE_URL is not set")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, s.BaseURL+"/", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("storage: CDN returned %s", resp.Status)
+	}
+	return nil
+}
+
+// ============================================================================
+// LOCAL
+// ============================================================================
+
+// Local reads files from the ingest working directories under Root
+// (downloads/, extracted_images/, extracted_sprites/) and contributor
+// uploads awaiting moderation (contrib/)
+type Local struct {
+	Root string
+}
+
+// Directory under Root holding each key prefix
+var localDirs = map[string]string{
+	"pdfs":     "downloads",
+	"images":   "extracted_images",
+	"sprites":  "extracted_sprites",
+	"contrib":  "contrib",
+	"datasets": "datasets",
+	"blobs":    "blobs",
+}
+
+func NewLocal(root string) *Local {
+	return &Local{Root: root}
+}
+
+func (s *Local) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Put writes to a temporary file first so readers never see a partial file
+func (s *Local) Put(ctx context.Context, key string, r io.Reader) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *Local) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *Local) Exists(ctx context.Context, key string) (bool, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Check confirms Root is a readable directory
+func (s *Local) Check(ctx context.Context) error {
+	f, err := os.Open(s.Root)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("storage: %s is not a directory", s.Root)
+	}
+	return nil
+}
+
+func (s *Local) path(key string) (string, error) {
+	prefix, rest, ok := strings.Cut(key, "/")
+	dir, known := localDirs[prefix]
+	if !ok || !known {
+		return "", fmt.Errorf("storage: unknown key %q", key)
+	}
+	clean := filepath.Clean("/" + rest)
+	return filepath.Join(s.Root, dir, clean), nil
+}
+
+// ============================================================================
+// CONFIG
+// ============================================================================
+
+// New builds the store selected by backend ("cdn" or "local")
+func New(backend, baseURL, filesDir string) (Store, error) {
+	switch backend {
+	case "", "cdn":
+		return NewCDN(baseURL), nil
+	case "local":
+		return NewLocal(filesDir), nil
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", backend)
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrRestoreRequired is returned for files only in the cold tier, which must
+// be restored before they can be read
+var ErrRestoreRequired = errors.New("storage: file is in cold storage; restore it first")
+
+// Tiered keeps rarely read files in a cheaper cold Writer, such as an
+// archive-class bucket mounted as a directory. Reads and writes go to the
+// hot tier; Archive and Restore move files between the two.
+type Tiered struct {
+	hot  Writer
+	cold Writer
+}
+
+func NewTiered(hot, cold Writer) *Tiered {
+	return &Tiered{hot: hot, cold: cold}
+}
+
+// Open reads from the hot tier, returning ErrRestoreRequired for a file that
+// is only in the cold tier
+func (t *Tiered) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	rc, err := t.hot.Open(ctx, key)
+	if !errors.Is(err, ErrNotFound) {
+		return rc, err
+	}
+	if ok, cerr := t.cold.Exists(ctx, key); cerr == nil && ok {
+		return nil, ErrRestoreRequired
+	}
+	return nil, err
+}
+
+func (t *Tiered) Put(ctx context.Context, key string, r io.Reader) error {
+	return t.hot.Put(ctx, key, r)
+}
+
+func (t *Tiered) Delete(ctx context.Context, key string) error {
+	return t.hot.Delete(ctx, key)
+}
+
+func (t *Tiered) Exists(ctx context.Context, key string) (bool, error) {
+	return t.hot.Exists(ctx, key)
+}
+
+// Check reports on the hot tier, which every read goes to
+func (t *Tiered) Check(ctx context.Context) error {
+	if checker, ok := t.hot.(Checker); ok {
+		return checker.Check(ctx)
+	}
+	return nil
+}
+
+// Archive moves a file to the cold tier. A file restored earlier is still
+// there, so only its hot copy is deleted.
+func (t *Tiered) Archive(ctx context.Context, key string) error {
+	ok, err := t.cold.Exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if err := copyKey(ctx, t.hot, t.cold, key); err != nil {
+			return err
+		}
+	}
+	err = t.hot.Delete(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Restore copies a file back to the hot tier, keeping the cold copy so it
+// can be archived again without another upload
+func (t *Tiered) Restore(ctx context.Context, key string) error {
+	return copyKey(ctx, t.cold, t.hot, key)
+}
+
+func copyKey(ctx context.Context, from Store, to Writer, key string) error {
+	rc, err := from.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return to.Put(ctx, key, rc)
+}
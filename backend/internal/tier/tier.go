@@ -0,0 +1,152 @@
+package tier
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/epstein-files/backend/internal/jobs"
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/repository"
+	"github.com/epstein-files/backend/internal/storage"
+)
+
+// Job types for moving source PDFs between storage tiers
+const (
+	ArchiveJobType = "tier-archive"
+	RestoreJobType = "tier-restore"
+)
+
+const archiveBatchSize = 100
+
+const day = 24 * time.Hour
+
+// ArchiveParams moves the PDFs not read for coldAfterDays days as of now;
+// keeping the time in the parameters lets a resumed job pick the same files
+func ArchiveParams(coldAfterDays int, now time.Time) models.JSON {
+	return models.JSON{
+		"cold_after_days": coldAfterDays,
+		"as_of":           now.UTC().Format(time.RFC3339),
+	}
+}
+
+// RestoreParams restores one document's source PDF
+func RestoreParams(documentID string) models.JSON {
+	return models.JSON{"document_id": documentID}
+}
+
+// ArchiveJob moves the source PDFs that haven't been read through the API
+// for the job's cold_after_days (counting from ingest for those never read)
+// to the cold tier, restored ones too once their restore period is over.
+// Files that fail to move are logged, counted as failed and left hot.
+func ArchiveJob(repo *repository.Repository, store *storage.Tiered) jobs.Handler {
+	return func(ctx context.Context, job *models.Job, p *jobs.Progress) error {
+		repo := repo.WithContext(ctx)
+
+		days := jobs.ParamInt(job.Params, "cold_after_days")
+		asOf, err := time.Parse(time.RFC3339, fmt.Sprint(job.Params["as_of"]))
+		if days < 1 || err != nil {
+			return fmt.Errorf("invalid tiering policy (cold_after_days %v, as_of %v)", job.Params["cold_after_days"], job.Params["as_of"])
+		}
+		accessedBefore := asOf.Add(-time.Duration(days) * day)
+
+		if job.Total == 0 {
+			total, err := repo.CountColdCandidates(accessedBefore, asOf)
+			if err != nil {
+				return err
+			}
+			job.Total = total
+		}
+		if job.Result == nil {
+			job.Result = models.JSON{"archived": 0, "bytes": 0}
+		}
+		archived, bytes := jobs.ParamInt(job.Result, "archived"), int64(jobs.ParamInt(job.Result, "bytes"))
+
+		for {
+			records, err := repo.GetColdCandidates(job.Cursor, accessedBefore, asOf, archiveBatchSize)
+			if err != nil {
+				return err
+			}
+			if len(records) == 0 {
+				break
+			}
+
+			for _, rec := range records {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if err := store.Archive(ctx, storage.DocumentKey(rec.Filename)); err != nil {
+					log.Printf("Tiering %s: %v", rec.ID, err)
+					job.Failed++
+				} else if err := repo.SetFileTier(rec.ID, models.TierCold, nil); err != nil {
+					return err
+				} else {
+					archived++
+					bytes += rec.SizeBytes
+				}
+				job.Processed++
+				job.Cursor = rec.RowID
+			}
+
+			job.Result["archived"], job.Result["bytes"] = archived, bytes
+			if err := p.Save(); err != nil {
+				return err
+			}
+		}
+		return p.Save()
+	}
+}
+
+// RestoreJob copies one document's source PDF back to the hot tier, where it
+// stays for at least keep. A failed restore leaves the PDF cold, so it can be
+// requested again.
+func RestoreJob(repo *repository.Repository, store *storage.Tiered, keep time.Duration) jobs.Handler {
+	return func(ctx context.Context, job *models.Job, p *jobs.Progress) error {
+		repo := repo.WithContext(ctx)
+
+		documentID, _ := job.Params["document_id"].(string)
+		document, err := repo.GetDocumentByID(documentID)
+		if err != nil {
+			return fmt.Errorf("document %q: %w", documentID, err)
+		}
+
+		job.Total = 1
+		if err := store.Restore(ctx, storage.DocumentKey(document.Filename)); err != nil {
+			// Not with ctx, which may be what failed
+			if serr := repo.WithContext(context.Background()).SetFileTier(documentID, models.TierCold, nil); serr != nil {
+				log.Printf("Restore %s: %v", documentID, serr)
+			}
+			return err
+		}
+		until := time.Now().Add(keep).UTC()
+		if err := repo.SetFileTier(documentID, models.TierRestored, &until); err != nil {
+			return err
+		}
+
+		job.Processed = 1
+		job.Result = models.JSON{"document_id": documentID, "restored_until": until.Format(time.RFC3339)}
+		return p.Save()
+	}
+}
+
+// Schedule enqueues an archive job whenever the last one is older than
+// interval, checking hourly so the schedule survives restarts
+func Schedule(ctx context.Context, repo *repository.Repository, queue *jobs.Queue, interval time.Duration, coldAfterDays int) {
+	for {
+		last, err := repo.WithContext(ctx).LastJob(ArchiveJobType)
+		if err != nil {
+			log.Printf("Tiering schedule: %v", err)
+		} else if last == nil || time.Since(last.CreatedAt) >= interval {
+			if _, err := queue.Enqueue(ctx, ArchiveJobType, ArchiveParams(coldAfterDays, time.Now())); err != nil {
+				log.Printf("Tiering schedule: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Hour):
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// Package usage keeps the opt-in usage statistics (USAGE_STATS): how often
+// each route is called, how often it fails and how long it takes, per day.
+// Only the route pattern is recorded, never IDs, query strings, API keys or
+// client addresses, and nothing is sent anywhere: the counts stay in the
+// archive's usage_stats table, for admins to read at /api/admin/usage. They
+// are kept in memory and added to the table every so often.
+package usage
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/epstein-files/backend/internal/config"
+	"github.com/epstein-files/backend/internal/middleware"
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/repository"
+)
+
+const dayFormat = "2006-01-02"
+
+type statKey struct{ day, route string }
+
+// Collector counts one archive's requests
+type Collector struct {
+	repo *repository.Repository
+	keep int // days
+
+	mu      sync.Mutex
+	pending map[statKey]*models.UsageStat // not yet written
+}
+
+// New returns the archive's collector, or nil when USAGE_STATS is off
+func New(cfg *config.Config, repo *repository.Repository) *Collector {
+	if !cfg.UsageStats {
+		return nil
+	}
+	return &Collector{
+		repo:    repo,
+		keep:    max(cfg.UsageStatsDays, 1),
+		pending: make(map[statKey]*models.UsageStat),
+	}
+}
+
+// Track counts the requests to the route registered as pattern. On a nil
+// collector it does nothing.
+func (c *Collector) Track(pattern string) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		if c == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, r)
+			c.record(pattern, sw.status, time.Since(start))
+		})
+	}
+}
+
+func (c *Collector) record(route string, status int, took time.Duration) {
+	k := statKey{time.Now().UTC().Format(dayFormat), route}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.pending[k]
+	if s == nil {
+		s = &models.UsageStat{Day: k.day, Route: route}
+		c.pending[k] = s
+	}
+	s.Requests++
+	switch {
+	case status >= 500:
+		s.ServerErrors++
+	case status >= 400:
+		s.ClientErrors++
+	}
+	s.TotalUS += took.Microseconds()
+	ms := took.Milliseconds()
+	buckets := s.Latency.Buckets()
+	i := sort.Search(len(models.LatencyBoundsMS), func(i int) bool { return ms <= models.LatencyBoundsMS[i] })
+	*buckets[i]++
+}
+
+// Run flushes the counts every interval until ctx is done, then once more
+func (c *Collector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			c.flush()
+			return
+		}
+		c.flush()
+	}
+}
+
+func (c *Collector) flush() {
+	if err := c.Flush(); err != nil {
+		log.Printf("Failed to save usage statistics: %v", err)
+	}
+}
+
+// Flush adds the counts since the last flush to the table, and drops the
+// days past USAGE_STATS_DAYS
+func (c *Collector) Flush() error {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = make(map[statKey]*models.UsageStat)
+	c.mu.Unlock()
+
+	now := time.Now()
+	rows := make([]models.UsageStat, 0, len(pending))
+	for _, s := range pending {
+		s.UpdatedAt = now
+		rows = append(rows, *s)
+	}
+	if err := c.repo.AddUsageStats(rows); err != nil {
+		// Count them again next time
+		c.mu.Lock()
+		for k, s := range pending {
+			if cur := c.pending[k]; cur != nil {
+				s.Add(cur)
+			}
+			c.pending[k] = s
+		}
+		c.mu.Unlock()
+		return err
+	}
+	return c.repo.DeleteUsageStatsBefore(c.since(now, c.keep))
+}
+
+// Report sums up the last days days, today included
+func (c *Collector) Report(ctx context.Context, days int) (*models.UsageReport, error) {
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+	since := c.since(time.Now(), days)
+	stats, err := c.repo.WithContext(ctx).GetUsageStats(since)
+	if err != nil {
+		return nil, err
+	}
+
+	perDay := make(map[string]int64)
+	perRoute := make(map[string]*models.UsageStat)
+	for i := range stats {
+		s := &stats[i]
+		perDay[s.Day] += s.Requests
+		if perRoute[s.Route] == nil {
+			perRoute[s.Route] = &models.UsageStat{Route: s.Route}
+		}
+		perRoute[s.Route].Add(s)
+	}
+
+	report := &models.UsageReport{
+		Since:  since,
+		Days:   make([]models.DailyUsage, 0, len(perDay)),
+		Routes: make([]models.RouteUsage, 0, len(perRoute)),
+	}
+	for day, n := range perDay {
+		report.Days = append(report.Days, models.DailyUsage{Date: day, Count: n})
+	}
+	sort.Slice(report.Days, func(i, j int) bool { return report.Days[i].Date > report.Days[j].Date })
+	for _, s := range perRoute {
+		report.Routes = append(report.Routes, routeUsage(s))
+	}
+	sort.Slice(report.Routes, func(i, j int) bool {
+		if report.Routes[i].Requests != report.Routes[j].Requests {
+			return report.Routes[i].Requests > report.Routes[j].Requests
+		}
+		return report.Routes[i].Route < report.Routes[j].Route
+	})
+	return report, nil
+}
+
+// since is the first of the last days days, today included
+func (c *Collector) since(now time.Time, days int) string {
+	return now.UTC().AddDate(0, 0, 1-days).Format(dayFormat)
+}
+
+func routeUsage(s *models.UsageStat) models.RouteUsage {
+	u := models.RouteUsage{
+		Route:        s.Route,
+		Requests:     s.Requests,
+		ClientErrors: s.ClientErrors,
+		ServerErrors: s.ServerErrors,
+	}
+	if s.Requests > 0 {
+		u.ErrorRate = float64(s.ServerErrors) / float64(s.Requests)
+		u.MeanMS = float64(s.TotalUS) / 1000 / float64(s.Requests)
+		u.P50MS = percentile(s, 0.50)
+		u.P95MS = percentile(s, 0.95)
+		u.P99MS = percentile(s, 0.99)
+	}
+	return u
+}
+
+// percentile is the bound of the bucket holding the p-th request, nil when
+// it's the one past the last bound
+func percentile(s *models.UsageStat, p float64) *int64 {
+	rank := int64(p*float64(s.Requests) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, n := range s.Latency.Buckets() {
+		seen += *n
+		if seen >= rank {
+			if i == len(models.LatencyBoundsMS) {
+				return nil
+			}
+			bound := models.LatencyBoundsMS[i]
+			return &bound
+		}
+	}
+	return nil
+}
+
+// statusWriter records the response status
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach Flush etc. on the real writer
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,60 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Alerter reports integrity failures to the log and, when configured, to a
+// webhook. The payload's "text" field makes it usable with Slack and
+// Mattermost incoming webhooks as is.
+type Alerter struct {
+	webhookURL string
+	archive    string
+	client     *http.Client
+}
+
+func NewAlerter(webhookURL, archive string) *Alerter {
+	return &Alerter{
+		webhookURL: webhookURL,
+		archive:    archive,
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+	}
+}
+
+func (a *Alerter) Alert(ctx context.Context, text string, details interface{}) {
+	log.Printf("ALERT [%s]: %s", a.archive, text)
+	if a.webhookURL == "" {
+		return
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"text":    "[" + a.archive + "] " + text,
+		"archive": a.archive,
+		"details": details,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Alert webhook: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		log.Printf("Alert webhook: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Alert webhook: %s", resp.Status)
+	}
+}
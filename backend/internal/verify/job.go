@@ -0,0 +1,141 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/epstein-files/backend/internal/jobs"
+	"github.com/epstein-files/backend/internal/models"
+	"github.com/epstein-files/backend/internal/repository"
+	"github.com/epstein-files/backend/internal/storage"
+)
+
+// SampleJobType is the job type for corpus spot checks
+const SampleJobType = "verify-sample"
+
+const sampleBatchSize = 100
+
+// Failures listed in the job result; the count covers the rest
+const maxReportedFailures = 100
+
+// maxModulus bounds the sample from below: one document in 2^31
+const maxModulus = 1 << 31
+
+// SampleParams picks a sample of about percent% of documents: those whose
+// rowid falls in one residue class, chosen at random so each run checks
+// different files. Callers validate percent; whatever it is, the modulus
+// stays within [1, maxModulus].
+func SampleParams(percent float64) models.JSON {
+	modulus := maxModulus
+	switch n := math.Round(100 / percent); {
+	case n < 1:
+		modulus = 1
+	case n < maxModulus:
+		modulus = int(n)
+	}
+	return models.JSON{
+		"percent": percent,
+		"modulus": modulus,
+		"offset":  rand.Intn(modulus),
+	}
+}
+
+// SampleJob re-hashes a sample of source PDFs, records the files that no
+// longer match in the job result and raises an alert if any do
+func SampleJob(repo *repository.Repository, store storage.Store, alerter *Alerter) jobs.Handler {
+	return func(ctx context.Context, job *models.Job, p *jobs.Progress) error {
+		repo := repo.WithContext(ctx)
+
+		modulus, offset := jobs.ParamInt(job.Params, "modulus"), jobs.ParamInt(job.Params, "offset")
+		_, hasOffset := job.Params["offset"]
+		if modulus < 1 || !hasOffset || offset < 0 || offset >= modulus {
+			return fmt.Errorf("invalid sample (modulus %d, offset %d)", modulus, offset)
+		}
+
+		if job.Total == 0 {
+			total, err := repo.CountDocumentSample(modulus, offset)
+			if err != nil {
+				return err
+			}
+			job.Total = total
+		}
+		if job.Result == nil {
+			job.Result = models.JSON{"failures": []interface{}{}}
+		}
+
+		for {
+			records, err := repo.GetDocumentSample(job.Cursor, modulus, offset, sampleBatchSize)
+			if err != nil {
+				return err
+			}
+			if len(records) == 0 {
+				break
+			}
+
+			for _, rec := range records {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				res := File(ctx, store, storage.DocumentKey(rec.Filename), rec.SHA256, rec.SizeBytes)
+				// Cold files are skipped rather than restored to be read
+				if !res.OK() && res.Status != StatusCold {
+					job.Failed++
+					recordFailure(job, rec.ID, res)
+				}
+				job.Processed++
+				job.Cursor = rec.RowID
+			}
+
+			if err := p.Save(); err != nil {
+				return err
+			}
+		}
+
+		if job.Failed > 0 {
+			alerter.Alert(ctx, fmt.Sprintf("Integrity check job %d: %d of %d sampled files failed verification",
+				job.ID, job.Failed, job.Processed), job.Result)
+		}
+		return p.Save()
+	}
+}
+
+func recordFailure(job *models.Job, documentID string, res *Result) {
+	log.Printf("Verify %s: %s (%s)", documentID, res.Status, res.Key)
+
+	failures, _ := job.Result["failures"].([]interface{})
+	if len(failures) >= maxReportedFailures {
+		return
+	}
+	job.Result["failures"] = append(failures, map[string]interface{}{
+		"document_id": documentID,
+		"status":      res.Status,
+		"expected":    res.ExpectedSHA256,
+		"actual":      res.ActualSHA256,
+		"error":       res.Error,
+	})
+}
+
+// Schedule enqueues a sample job whenever the last one is older than
+// interval, checking hourly so the schedule survives restarts
+func Schedule(ctx context.Context, repo *repository.Repository, queue *jobs.Queue, interval time.Duration, percent float64) {
+	for {
+		last, err := repo.WithContext(ctx).LastJob(SampleJobType)
+		if err != nil {
+			log.Printf("Integrity check schedule: %v", err)
+		} else if last == nil || time.Since(last.CreatedAt) >= interval {
+			if _, err := queue.Enqueue(ctx, SampleJobType, SampleParams(percent)); err != nil {
+				log.Printf("Integrity check schedule: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Hour):
+		}
+	}
+}
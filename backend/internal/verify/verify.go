@@ -0,0 +1,84 @@
+package verify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/epstein-files/backend/internal/storage"
+)
+
+// Verification outcomes
+const (
+	StatusPass       = "pass"
+	StatusFail       = "fail"       // stored bytes differ from the recorded hash
+	StatusMissing    = "missing"    // no file in storage
+	StatusUnrecorded = "unrecorded" // no hash was recorded at ingest
+	StatusError      = "error"      // storage could not be read
+	StatusCold       = "cold"       // in cold storage, not read until restored
+)
+
+// Result is the outcome of re-hashing one stored file
+type Result struct {
+	Key            string    `json:"key"`
+	Status         string    `json:"status"`
+	ExpectedSHA256 string    `json:"expected_sha256,omitempty"`
+	ActualSHA256   string    `json:"actual_sha256,omitempty"`
+	ExpectedSize   int64     `json:"expected_size,omitempty"`
+	ActualSize     int64     `json:"actual_size,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	CheckedAt      time.Time `json:"checked_at"`
+}
+
+// OK reports whether the file matched its recorded hash
+func (r *Result) OK() bool {
+	return r.Status == StatusPass
+}
+
+// File streams the file at key through SHA-256 and compares it with the
+// hash recorded at ingest
+func File(ctx context.Context, store storage.Store, key, expectedSHA256 string, expectedSize int64) *Result {
+	res := &Result{
+		Key:            key,
+		ExpectedSHA256: expectedSHA256,
+		ExpectedSize:   expectedSize,
+		CheckedAt:      time.Now().UTC(),
+	}
+
+	rc, err := store.Open(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		res.Status = StatusMissing
+		return res
+	}
+	if errors.Is(err, storage.ErrRestoreRequired) {
+		res.Status = StatusCold
+		return res
+	}
+	if err != nil {
+		res.Status, res.Error = StatusError, err.Error()
+		return res
+	}
+	defer rc.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, rc)
+	if err != nil {
+		res.Status, res.Error = StatusError, err.Error()
+		return res
+	}
+	res.ActualSHA256 = hex.EncodeToString(h.Sum(nil))
+	res.ActualSize = n
+
+	switch {
+	case expectedSHA256 == "":
+		res.Status = StatusUnrecorded
+	case res.ActualSHA256 == expectedSHA256:
+		res.Status = StatusPass
+	default:
+		res.Status = StatusFail
+	}
+	return res
+}
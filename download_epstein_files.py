@@ -14,6 +14,7 @@ Features:
 import asyncio
 import aiohttp
 import aiofiles
+import hashlib
 import os
 import json
 import argparse
@@ -294,6 +295,28 @@ def get_url(num: int, dataset: str) -> str:
     return f"{BASE_URL}{dataset}{get_filename(num)}"
 
 
+# Response headers kept in the sidecar: what the server said about the file
+RETAINED_HEADERS = ("Last-Modified", "ETag", "Content-Length", "Content-Type", "Date")
+
+
+async def write_provenance(filepath: Path, url: str, content: bytes, headers=None):
+    """Write the provenance sidecar (EFTA00000001.provenance.json) that
+    populate_db.py records on the document"""
+    sidecar = {
+        "source_url": url,
+        "retrieved_at": datetime.utcnow().strftime('%Y-%m-%dT%H:%M:%SZ'),
+        "retrieval_tool": "download_epstein_files.py",
+        "sha256": hashlib.sha256(content).hexdigest(),
+        "size_bytes": len(content),
+    }
+    if headers:
+        retained = {name: headers[name] for name in RETAINED_HEADERS if name in headers}
+        if retained:
+            sidecar["response_headers"] = retained
+    async with aiofiles.open(filepath.with_suffix(".provenance.json"), 'w') as f:
+        await f.write(json.dumps(sidecar, indent=2))
+
+
 def load_checkpoint() -> dict:
     """Load checkpoint from file"""
     if Path(CHECKPOINT_FILE).exists():
@@ -324,8 +347,10 @@ def get_downloaded_files() -> set:
         for f in OUTPUT_DIR.glob("EFTA*.pdf"):
             try:
                 num = int(f.stem[4:])
-                if f.stat().st_size > 0:
-                    downloaded.add(num)
+                # Error pages saved as PDFs by older runs are downloaded again
+                with open(f, 'rb') as fh:
+                    if fh.read(4) == b"%PDF":
+                        downloaded.add(num)
             except (ValueError, OSError):
                 pass
     return downloaded
@@ -405,8 +430,17 @@ async def download_file_with_retry(
                     async with session.get(url, **kwargs) as response:
                         if response.status == 200:
                             content = await response.read()
+                            # The site sometimes answers 200 with an HTML error page
+                            if not content.startswith(b"%PDF"):
+                                kind = "empty response" if not content else f"not a PDF ({response.headers.get('Content-Type', 'no content type')})"
+                                logger.warning(f"{kind} for {num}, retrying in {backoff}s...")
+                                await stats.record_retry()
+                                await asyncio.sleep(backoff)
+                                backoff = min(backoff * 2, MAX_BACKOFF)
+                                continue
                             async with aiofiles.open(filepath, 'wb') as f:
                                 await f.write(content)
+                            await write_provenance(filepath, url, content, response.headers)
                             await stats.record_success(len(content))
                             pbar.update(1)
                             return (num, "success", f"{len(content)} bytes")
@@ -629,6 +663,7 @@ Examples:
   python download_epstein_files.py --no-browser        # Use .env cookies only (manual)
   python download_epstein_files.py -d "files/DataSet%202/"  # Use different dataset
   python download_epstein_files.py --proxy-chunk 100   # Use 100 proxies per rotation
+  python download_epstein_files.py --harvest-cookies   # Print fresh cookies and exit
         """
     )
     parser.add_argument("-s", "--start", type=int, default=DEFAULT_START,
@@ -645,9 +680,24 @@ Examples:
                         help="Skip automatic browser cookie harvest, use .env cookies only")
     parser.add_argument("--show-browser", action="store_true",
                         help="Show browser window during cookie harvest (for debugging)")
+    parser.add_argument("--harvest-cookies", action="store_true",
+                        help="Only harvest cookies, printing name=value lines (the Go downloader's -refresh-browser)")
 
     args = parser.parse_args()
 
+    if args.harvest_cookies:
+        if os.name == 'nt':
+            asyncio.set_event_loop_policy(asyncio.WindowsSelectorEventLoopPolicy())
+        # Logs go to stderr, so stdout is only the cookies
+        cookies = asyncio.run(harvest_cookies_with_browser(
+            headless=not args.show_browser, dataset=args.dataset, probe_file=args.start
+        ))
+        if not cookies:
+            raise SystemExit(1)
+        for name, value in cookies.items():
+            print(f"{name}={value}")
+        raise SystemExit(0)
+
     print(f"Dataset: {args.dataset}")
     print(f"Download range: EFTA{args.start:08d} to EFTA{args.end:08d}")
 
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// With -archive tar (or zip), finished files are appended to rolling archive
+// shards in each output directory, archive-000001.tar, archive-000002.tar,
+// ..., the next started once one reaches -archive-size, instead of being
+// saved as millions of loose files. archive_index.csv next to them maps each
+// file to its shard and to the offset of its data there (files are stored
+// uncompressed), so one can be read straight out of a shard. The last line
+// for a file counts; an empty shard means it was removed.
+//
+// Downloads in progress are .part files in the output directory, as without
+// -archive. A tar shard left open is carried on by the next run, cut back to
+// the end of its last indexed file; a zip shard is only readable once its
+// central directory is written on close, so each run starts a new one.
+
+const archiveIndexName = "archive_index.csv"
+
+// Default -archive-size
+const defaultArchiveSize = 4 << 30
+
+// archiveStore saves files into archive shards
+type archiveStore struct {
+	format string // "tar" or "zip"
+	limit  int64  // size at which a shard is closed
+
+	mu   sync.Mutex // one file is appended at a time
+	dirs []string   // output directories, longest first
+	sets map[string]*archiveSet
+}
+
+// archiveEntry is where a file's data is in a shard
+type archiveEntry struct {
+	shard        string // shard file name
+	offset, size int64
+}
+
+// archiveSet is the shards and index of one output directory
+type archiveSet struct {
+	dir     string
+	entries map[string]archiveEntry // by slash-separated path relative to dir
+	index   *os.File
+
+	// The shard being appended to, once opened
+	number int
+	file   *os.File
+	count  *countingWriter
+	tw     *tar.Writer
+	zw     *zip.Writer
+}
+
+func newArchiveStore(format string, limit int64, dirs []string) (*archiveStore, error) {
+	if format != "tar" && format != "zip" {
+		return nil, fmt.Errorf("-archive must be tar or zip, not %q", format)
+	}
+	if limit <= 0 {
+		limit = defaultArchiveSize
+	}
+	dirs = append([]string(nil), dirs...)
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+	return &archiveStore{format: format, limit: limit, dirs: dirs, sets: make(map[string]*archiveSet)}, nil
+}
+
+// find returns the set of the output directory holding p, loading its index
+// on first use, and p's name in it. Callers hold s.mu.
+func (s *archiveStore) find(p string) (*archiveSet, string, error) {
+	for _, dir := range s.dirs {
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		set, ok := s.sets[dir]
+		if !ok {
+			if set, err = loadArchiveSet(dir); err != nil {
+				return nil, "", err
+			}
+			s.sets[dir] = set
+		}
+		return set, filepath.ToSlash(rel), nil
+	}
+	return nil, "", fmt.Errorf("%s is outside every output directory", p)
+}
+
+// loadArchiveSet reads dir's index, if it has one
+func loadArchiveSet(dir string) (*archiveSet, error) {
+	set := &archiveSet{dir: dir, entries: make(map[string]archiveEntry)}
+	f, err := os.Open(filepath.Join(dir, archiveIndexName))
+	if os.IsNotExist(err) {
+		return set, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ",")
+		if len(fields) != 4 || fields[0] == "filename" {
+			continue
+		}
+		if fields[1] == "" {
+			delete(set.entries, fields[0])
+			continue
+		}
+		offset, err1 := strconv.ParseInt(fields[2], 10, 64)
+		size, err2 := strconv.ParseInt(fields[3], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue // cut short by a crash
+		}
+		set.entries[fields[0]] = archiveEntry{shard: fields[1], offset: offset, size: size}
+	}
+	return set, scanner.Err()
+}
+
+func shardFileName(number int, format string) string {
+	return fmt.Sprintf("archive-%06d.%s", number, format)
+}
+
+// lastShard is the highest shard number in dir, of either format, or 0
+func lastShard(dir string) int {
+	last := 0
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		var n int
+		var ext string
+		if _, err := fmt.Sscanf(e.Name(), "archive-%06d.%s", &n, &ext); err == nil && n > last {
+			last = n
+		}
+	}
+	return last
+}
+
+// open makes a shard ready to append to: the last one when it is a tar
+// shard with room left, truncated after the last file in the index, or else
+// a new one
+func (set *archiveSet) open(format string, limit int64) error {
+	if set.index == nil {
+		index, err := openIndex(filepath.Join(set.dir, archiveIndexName))
+		if err != nil {
+			return err
+		}
+		set.index = index
+	}
+
+	number := lastShard(set.dir)
+	if format == "tar" && number > 0 {
+		name := shardFileName(number, format)
+		var end int64
+		for _, e := range set.entries {
+			if e.shard == name {
+				end = max(end, e.offset+(e.size+511)/512*512)
+			}
+		}
+		if info, err := os.Stat(filepath.Join(set.dir, name)); err == nil && end < limit && info.Size() >= end {
+			f, err := os.OpenFile(filepath.Join(set.dir, name), os.O_RDWR, 0644)
+			if err != nil {
+				return err
+			}
+			if err := f.Truncate(end); err != nil {
+				f.Close()
+				return err
+			}
+			if _, err := f.Seek(end, io.SeekStart); err != nil {
+				f.Close()
+				return err
+			}
+			set.start(f, number, end, format)
+			return nil
+		}
+	}
+
+	f, err := os.OpenFile(filepath.Join(set.dir, shardFileName(number+1, format)), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	set.start(f, number+1, 0, format)
+	return nil
+}
+
+// openIndex opens an archive index for appending, writing the header line
+// when it is new
+func openIndex(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := f.Stat(); err == nil && info.Size() == 0 {
+		if _, err := fmt.Fprintln(f, "filename,shard,offset,size"); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (set *archiveSet) start(f *os.File, number int, offset int64, format string) {
+	set.file, set.number = f, number
+	set.count = &countingWriter{w: f, n: offset}
+	if format == "tar" {
+		set.tw = tar.NewWriter(set.count)
+	} else {
+		set.zw = zip.NewWriter(set.count)
+		set.zw.SetOffset(offset)
+	}
+}
+
+// closeShard finishes the open shard: a tar's end blocks, a zip's central
+// directory
+func (set *archiveSet) closeShard() error {
+	if set.file == nil {
+		return nil
+	}
+	var err error
+	if set.tw != nil {
+		err = set.tw.Close()
+	} else {
+		err = set.zw.Close()
+	}
+	if cerr := set.file.Close(); err == nil {
+		err = cerr
+	}
+	set.file, set.tw, set.zw = nil, nil, nil
+	return err
+}
+
+// add appends size bytes from r as name, starting the next shard first when
+// the open one is full. crc is the data's CRC-32, which zip headers need up
+// front.
+func (s *archiveStore) add(p string, r io.Reader, size int64, crc uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set, name, err := s.find(p)
+	if err != nil {
+		return err
+	}
+	if set.file != nil && set.count.n >= s.limit {
+		if err := set.closeShard(); err != nil {
+			return err
+		}
+	}
+	if set.file == nil {
+		if err := set.open(s.format, s.limit); err != nil {
+			return err
+		}
+	}
+
+	var w io.Writer
+	if set.tw != nil {
+		err = set.tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Size:     size,
+			Mode:     0644,
+			ModTime:  time.Now(),
+		})
+		w = set.tw
+	} else {
+		w, err = set.zw.CreateRaw(&zip.FileHeader{
+			Name:               name,
+			Method:             zip.Store,
+			Modified:           time.Now(),
+			CRC32:              crc,
+			CompressedSize64:   uint64(size),
+			UncompressedSize64: uint64(size),
+		})
+	}
+	if err != nil {
+		return err
+	}
+	if set.zw != nil {
+		// The zip writer buffers, so the header only reaches set.count on flush
+		if err := set.zw.Flush(); err != nil {
+			return err
+		}
+	}
+	offset := set.count.n
+	if _, err := io.CopyN(w, r, size); err != nil {
+		return err
+	}
+	if set.tw != nil {
+		if err := set.tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	// Recorded only once the data is in, so a crash never indexes a torn file
+	e := archiveEntry{shard: shardFileName(set.number, s.format), offset: offset, size: size}
+	if _, err := fmt.Fprintf(set.index, "%s,%s,%d,%d\n", name, e.shard, e.offset, e.size); err != nil {
+		return err
+	}
+	set.entries[name] = e
+	return nil
+}
+
+// entry looks p up in its directory's index
+func (s *archiveStore) entry(p string) (*archiveSet, archiveEntry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set, name, err := s.find(p)
+	if err != nil {
+		return nil, archiveEntry{}, false, err
+	}
+	e, ok := set.entries[name]
+	return set, e, ok, nil
+}
+
+// close finishes every open shard and index, returning the first error
+func (s *archiveStore) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var first error
+	for _, set := range s.sets {
+		if err := set.closeShard(); err != nil && first == nil {
+			first = err
+		}
+		if set.index != nil {
+			if err := set.index.Close(); err != nil && first == nil {
+				first = err
+			}
+			set.index = nil
+		}
+	}
+	return first
+}
+
+// ============================================================================
+// fileStore
+// ============================================================================
+
+func (*archiveStore) partial(p string) int64 {
+	return localStore{}.partial(p)
+}
+
+func (s *archiveStore) create(p string, resume bool, h io.Writer) (fileWriter, error) {
+	file, err := openPart(p+".part", resume, h)
+	if err != nil {
+		return nil, err
+	}
+	return &archivePart{partFile: partFile{File: file, path: p}, store: s}, nil
+}
+
+func (*archiveStore) dropPartial(p string) {
+	localStore{}.dropPartial(p)
+}
+
+func (s *archiveStore) writeFile(p string, data []byte) error {
+	return s.add(p, strings.NewReader(string(data)), int64(len(data)), crc32.ChecksumIEEE(data))
+}
+
+// remove drops p from the index; its bytes stay in the shard
+func (s *archiveStore) remove(p string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set, name, err := s.find(p)
+	if err != nil {
+		return err
+	}
+	if _, ok := set.entries[name]; !ok {
+		return os.ErrNotExist
+	}
+	if set.index == nil {
+		if set.index, err = openIndex(filepath.Join(set.dir, archiveIndexName)); err != nil {
+			return err
+		}
+	}
+	delete(set.entries, name)
+	_, err = fmt.Fprintf(set.index, "%s,,,\n", name)
+	return err
+}
+
+func (s *archiveStore) stat(p string) (int64, bool, error) {
+	_, e, ok, err := s.entry(p)
+	return e.size, ok, err
+}
+
+func (s *archiveStore) readHead(p string, n int) ([]byte, error) {
+	set, e, ok, err := s.entry(p)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	f, err := os.Open(filepath.Join(set.dir, e.shard))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	head := make([]byte, min(int64(n), e.size))
+	read, err := f.ReadAt(head, e.offset)
+	if err == io.EOF {
+		err = nil
+	}
+	return head[:read], err
+}
+
+// list returns the PDFs in dir's index, at the top level or in a shard
+// subdirectory
+func (s *archiveStore) list(dir string) (map[string]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set, _, err := s.find(filepath.Join(dir, archiveIndexName))
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]int64)
+	for name, e := range set.entries {
+		if !strings.HasSuffix(name, ".pdf") {
+			continue
+		}
+		if d := path.Dir(name); d != "." && !isShardDir(d) {
+			continue
+		}
+		files[name] = e.size
+	}
+	return files, nil
+}
+
+func (s *archiveStore) location(p string) string {
+	return fmt.Sprintf("%s (%s shards)", p, s.format)
+}
+
+func (s *archiveStore) String() string {
+	return s.format + " shards in the output directory"
+}
+
+// archivePart is a download in progress in its .part file, appended to a
+// shard on commit
+type archivePart struct {
+	partFile
+	store *archiveStore
+}
+
+func (a *archivePart) commit() error {
+	// Zip headers come before the data, so their CRC is taken first
+	if _, err := a.Seek(0, io.SeekStart); err != nil {
+		a.Close()
+		return err
+	}
+	crc := crc32.NewIEEE()
+	size, err := io.Copy(crc, a.File)
+	if err == nil {
+		_, err = a.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		err = a.store.add(a.path, a.File, size, crc.Sum32())
+	}
+	if cerr := a.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(a.Name())
+}
+
+// countingWriter counts the bytes written through it, on top of where it
+// started
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The bandwidth limit is one token bucket shared by every worker: each read
+// from a response body spends its size in tokens, which refill at the -bw
+// rate, so the downloads together never use more than it however many run
+
+type bandwidth struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	burst  float64 // most tokens that can build up
+	tokens float64 // may go negative: the debt readers wait off
+	last   time.Time
+}
+
+// newBandwidth limits reads to rate bytes per second, or to nothing when
+// rate is 0
+func newBandwidth(rate int64) *bandwidth {
+	if rate <= 0 {
+		return nil
+	}
+	// A tenth of a second's worth, so idle time isn't saved up into a burst
+	burst := max(float64(rate)/10, 32*1024)
+	return &bandwidth{rate: float64(rate), burst: burst, tokens: burst, last: time.Now()}
+}
+
+// wait spends n tokens, sleeping until the bucket is out of debt
+func (b *bandwidth) wait(n int) {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*b.rate, b.burst)
+	b.last = now
+	b.tokens -= float64(n)
+	debt := -b.tokens
+	b.mu.Unlock()
+
+	if debt > 0 {
+		sleep(time.Duration(debt / b.rate * float64(time.Second)))
+	}
+}
+
+// reader limits r to the shared rate; a nil bandwidth passes it through
+func (b *bandwidth) reader(r io.Reader) io.Reader {
+	if b == nil {
+		return r
+	}
+	return &limitedReader{r: r, b: b}
+}
+
+type limitedReader struct {
+	r io.Reader
+	b *bandwidth
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	// Read no more than a burst at a time, so one worker can't run up a
+	// debt that stalls the others
+	if len(p) > int(l.b.burst) {
+		p = p[:int(l.b.burst)]
+	}
+	n, err := l.r.Read(p)
+	if n > 0 {
+		l.b.wait(n)
+	}
+	return n, err
+}
+
+// parseRate reads a -bw value: bytes per second, with an optional K, M or G
+// suffix (KB, MB and GB also accepted, all powers of 1024), e.g. "50MB" or
+// "1.5M"; empty means no limit
+func parseRate(s string) (int64, error) {
+	n, err := parseBytes(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "/S"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid bandwidth %q: want e.g. 50MB, 500K or 0 for no limit", s)
+	}
+	return n, nil
+}
+
+// parseBytes reads a byte count with an optional K, M or G suffix (KB, MB
+// and GB also accepted, all powers of 1024); empty is 0
+func parseBytes(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	if v == "" {
+		return 0, nil
+	}
+	v = strings.TrimSuffix(v, "B")
+	mult := 1.0
+	for suffix, m := range map[string]float64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30} {
+		if strings.HasSuffix(v, suffix) {
+			v, mult = strings.TrimSuffix(v, suffix), m
+		}
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * mult), nil
+}
+
+// formatRate is the inverse of parseRate, for display
+func formatRate(rate int64) string {
+	switch {
+	case rate >= 1<<30:
+		return fmt.Sprintf("%.1f GB/s", float64(rate)/(1<<30))
+	case rate >= 1<<20:
+		return fmt.Sprintf("%.1f MB/s", float64(rate)/(1<<20))
+	default:
+		return fmt.Sprintf("%.1f KB/s", float64(rate)/(1<<10))
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Each dataset's output directory gets a checksum manifest, a CSV of
+// filename,sha256,size with a line appended as each download completes. The
+// hash is the one computed while streaming the file, the same as in its
+// provenance sidecar. A file downloaded again gets another line; the last
+// one counts.
+
+// checksumLog appends to the datasets' checksum manifests
+type checksumLog struct {
+	name string // file name in each output directory
+
+	mu    sync.Mutex
+	files map[*datasetSpec]*os.File
+}
+
+func newChecksumLog(name string) *checksumLog {
+	return &checksumLog{name: name, files: make(map[*datasetSpec]*os.File)}
+}
+
+// add records one downloaded file of ds, opening its manifest on first use.
+// A nil log records nothing.
+func (c *checksumLog) add(ds *datasetSpec, filename, sha string, size int64) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, ok := c.files[ds]
+	if !ok {
+		var err error
+		if f, err = openChecksums(filepath.Join(ds.dir, c.name)); err != nil {
+			return err
+		}
+		c.files[ds] = f
+	}
+	_, err := fmt.Fprintf(f, "%s,%s,%d\n", filename, sha, size)
+	return err
+}
+
+// openChecksums opens a checksum manifest for appending, writing the header
+// line when it is new
+func openChecksums(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := f.Stat(); err == nil && info.Size() == 0 {
+		if _, err := fmt.Fprintln(f, "filename,sha256,size"); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// close syncs and closes every manifest opened, returning the first error
+func (c *checksumLog) close() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var first error
+	for ds, f := range c.files {
+		if err := f.Sync(); err != nil && first == nil {
+			first = err
+		}
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+		delete(c.files, ds)
+	}
+	return first
+}
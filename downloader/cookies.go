@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Expired cookies turn every response into a 302. With a refresh source set,
+// the first worker to see one pauses the others, fetches fresh cookies and
+// lets everyone retry, so a long run carries on instead of failing the rest
+// of its files.
+
+const (
+	refreshTimeout     = 3 * time.Minute
+	minRefreshInterval = 30 * time.Second // fresh cookies sooner than this didn't help
+	maxRefreshFailures = 3                // in a row, before giving up on refreshing
+)
+
+// Names of the cookies the site needs
+const (
+	cookieAkBmsc      = "ak_bmsc"
+	cookieAgeVerified = "justiceGovAgeVerified"
+	cookieQueueIT     = "QueueITAccepted-SDFrts345E-V3_usdojfiles"
+)
+
+// cookieSource obtains a fresh set of cookies
+type cookieSource interface {
+	String() string
+	fetch(ctx context.Context, current map[string]string) (map[string]string, error)
+}
+
+// cookieSet is the cookies sent with every request. The generation counts
+// refreshes, so a worker can tell whether its 302 came before or after one.
+type cookieSet struct {
+	mu         sync.RWMutex
+	values     map[string]string
+	generation int
+	expired    int       // generation last answered with a 302, 0 for none
+	expiredAt  time.Time // when
+}
+
+func newCookieSet(values map[string]string) *cookieSet {
+	c := &cookieSet{values: map[string]string{}}
+	c.update(values)
+	return c
+}
+
+// header returns the Cookie header value and the generation it belongs to
+func (c *cookieSet) header() (string, int) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	names := make([]string, 0, len(c.values))
+	for name := range c.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + c.values[name]
+	}
+	return strings.Join(pairs, "; "), c.generation
+}
+
+func (c *cookieSet) snapshot() map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	values := make(map[string]string, len(c.values))
+	for name, value := range c.values {
+		values[name] = value
+	}
+	return values
+}
+
+// update merges values in, dropping empty ones, and starts a new generation
+func (c *cookieSet) update(values map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, value := range values {
+		if value != "" {
+			c.values[name] = value
+		}
+	}
+	c.generation++
+}
+
+// markExpired records a 302 on a request sent with cookies of generation
+// seen, for -web's cookie status
+func (c *cookieSet) markExpired(seen int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expired, c.expiredAt = seen, time.Now()
+}
+
+// expiry reports whether the current cookies have been answered with a 302,
+// and when the last 302 was
+func (c *cookieSet) expiry() (expired bool, at time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.expired == c.generation, c.expiredAt
+}
+
+type refresher struct {
+	source  cookieSource
+	cookies *cookieSet
+
+	mu       sync.Mutex
+	running  chan struct{} // closed when the refresh in progress ends; nil when idle
+	last     time.Time
+	failures int // in a row
+
+	refreshes int64
+}
+
+func newRefresher(source cookieSource, cookies *cookieSet) *refresher {
+	return &refresher{source: source, cookies: cookies}
+}
+
+// wait holds a worker's next request while a refresh is in progress
+func (r *refresher) wait() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	running := r.running
+	r.mu.Unlock()
+	if running != nil {
+		select {
+		case <-running:
+		case <-abortCtx.Done():
+		}
+	}
+}
+
+// status reports whether a refresh is running, the refreshes done, the
+// failures in a row and when the last attempt ended
+func (r *refresher) status() (running bool, refreshes int64, failures int, last time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.running != nil, r.refreshes, r.failures, r.last
+}
+
+// refresh handles a 302 on a request sent with cookies of generation seen,
+// refreshing them unless someone already has. It reports whether retrying
+// is worth it: false without a source, or when fresh cookies didn't help.
+func (r *refresher) refresh(seen int) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	if _, current := r.cookies.header(); current != seen {
+		r.mu.Unlock()
+		return true // refreshed since that request went out
+	}
+	if running := r.running; running != nil {
+		r.mu.Unlock()
+		r.wait()
+		return true
+	}
+	if r.failures >= maxRefreshFailures || time.Since(r.last) < minRefreshInterval {
+		r.mu.Unlock()
+		return false
+	}
+	done := make(chan struct{})
+	r.running = done
+	r.mu.Unlock()
+
+	logger.Info(fmt.Sprintf("Refreshing cookies via %s; downloads wait meanwhile", r.source), "event", "COOKIES", "source", r.source.String())
+	ctx, cancel := context.WithTimeout(abortCtx, refreshTimeout)
+	values, err := r.source.fetch(ctx, r.cookies.snapshot())
+	cancel()
+	if err == nil && len(values) == 0 {
+		err = fmt.Errorf("no cookies returned")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.last = time.Now()
+	r.running = nil
+	close(done)
+	if err != nil {
+		r.failures++
+		logger.Warn(fmt.Sprintf("Refresh failed (%d of %d): %v", r.failures, maxRefreshFailures, err), "event", "COOKIES", "failures", r.failures, "error", err)
+		return false
+	}
+	r.cookies.update(values)
+	r.failures = 0
+	r.refreshes++
+	logger.Info(fmt.Sprintf("Refreshed %d cookies; resuming", len(values)), "event", "COOKIES", "cookies", len(values))
+	return true
+}
+
+// commandSource runs a command that prints cookies on stdout, as name=value
+// lines or one "a=1; b=2" header line
+type commandSource struct {
+	command string
+}
+
+func (s commandSource) String() string { return "command: " + s.command }
+
+func (s commandSource) fetch(ctx context.Context, _ map[string]string) (map[string]string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", s.command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", s.command)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(string(out)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "Cookie:"))
+		for _, pair := range strings.Split(line, ";") {
+			if name, value, ok := strings.Cut(strings.TrimSpace(pair), "="); ok && name != "" {
+				values[strings.TrimSpace(name)] = strings.TrimSpace(value)
+			}
+		}
+	}
+	return values, nil
+}
+
+// endpointSource requests a URL with the current cookies, following
+// redirects, and keeps every cookie set along the way, as the site's own
+// re-negotiation does in a browser
+type endpointSource struct {
+	url *url.URL
+}
+
+func (s endpointSource) String() string { return "endpoint: " + s.url.String() }
+
+func (s endpointSource) fetch(ctx context.Context, current map[string]string) (map[string]string, error) {
+	jar, _ := cookiejar.New(nil)
+	var sent []*http.Cookie
+	for name, value := range current {
+		sent = append(sent, &http.Cookie{Name: name, Value: value})
+	}
+	jar.SetCookies(s.url, sent)
+
+	client := &http.Client{Jar: jar, Transport: proxies.pick().roundTripper(), Timeout: refreshTimeout}
+	req, err := http.NewRequestWithContext(ctx, "GET", s.url.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+
+	values := map[string]string{}
+	for _, c := range jar.Cookies(s.url) {
+		if current[c.Name] != c.Value {
+			values[c.Name] = c.Value
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// One run can download several datasets, given as a -d list or a -datasets
+// file. Each has its own file range and output directory; their work is
+// queued one dataset after another, or interleaved a file from each in turn.
+// A dataset given an ID list downloads just the files listed, in place of
+// its range; -retry-failed uses each dataset's failed.txt as its list.
+
+// datasetSpec is one dataset to download
+type datasetSpec struct {
+	Path   string `json:"path"`   // on the site, e.g. "files/DataSet 2/"
+	Start  int    `json:"start"`  // default -s
+	End    int    `json:"end"`    // default -e
+	Output string `json:"output"` // relative to -o unless absolute
+	IDs    string `json:"ids"`    // ID list file, default -f
+
+	dir string // resolved output directory
+	ids []int  // from the ID list, sorted; nil for the whole range
+
+	saved map[int]saved // -update: files already downloaded, to ask for again (update.go)
+
+	downloaded, skipped, failed int64
+}
+
+// name is the dataset's last path element, unescaped: "DataSet 2"
+func (ds *datasetSpec) name() string {
+	name := path.Base(strings.TrimSuffix(ds.Path, "/"))
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	return name
+}
+
+// files lists the numbers to download: the ID list, or else Start to End
+func (ds *datasetSpec) files() []int {
+	if ds.ids != nil {
+		return ds.ids
+	}
+	nums := make([]int, 0, ds.End-ds.Start+1)
+	for i := ds.Start; i <= ds.End; i++ {
+		nums = append(nums, i)
+	}
+	return nums
+}
+
+// task is one file of one dataset for a worker
+type task struct {
+	ds    *datasetSpec
+	num   int
+	claim *claim // with -claims, the range it's in
+}
+
+// loadDatasets reads the -datasets file, or else the -d list: comma-separated
+// paths, each optionally followed by ":start-end", where a bare number N
+// stands for "files/DataSet%20N/". With more than one dataset, each without
+// an output of its own goes to a subdirectory of -o named after it. A
+// dataset's ID list, or else idsFile, narrows it to the files listed; with
+// retryFailed, to those in its failed.txt, if any.
+func loadDatasets(list, file, idsFile string, retryFailed bool, start, end int, root string) ([]*datasetSpec, error) {
+	var specs []*datasetSpec
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &specs); err != nil {
+			return nil, fmt.Errorf("invalid datasets file %s: %v", file, err)
+		}
+	} else {
+		for _, entry := range strings.Split(list, ",") {
+			if entry = strings.TrimSpace(entry); entry == "" {
+				continue
+			}
+			ds, err := parseDataset(entry)
+			if err != nil {
+				return nil, err
+			}
+			specs = append(specs, ds)
+		}
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("no datasets given")
+	}
+
+	seen := map[string]bool{}
+	for _, ds := range specs {
+		if ds.Path == "" {
+			return nil, fmt.Errorf("dataset without a path")
+		}
+		if n, err := strconv.Atoi(ds.Path); err == nil {
+			ds.Path = datasetPath(n)
+		}
+		if !strings.HasSuffix(ds.Path, "/") {
+			ds.Path += "/"
+		}
+		if seen[ds.Path] {
+			return nil, fmt.Errorf("dataset %s given twice", ds.Path)
+		}
+		seen[ds.Path] = true
+
+		if ds.Start == 0 {
+			ds.Start = start
+		}
+		if ds.End == 0 {
+			ds.End = end
+		}
+		if ds.Start > ds.End {
+			return nil, fmt.Errorf("dataset %s: start %d is after end %d", ds.Path, ds.Start, ds.End)
+		}
+
+		switch {
+		case filepath.IsAbs(ds.Output):
+			ds.dir = ds.Output
+		case ds.Output != "":
+			ds.dir = filepath.Join(root, ds.Output)
+		case len(specs) > 1:
+			ds.dir = filepath.Join(root, ds.name())
+		default:
+			ds.dir = root
+		}
+
+		if ds.IDs == "" {
+			ds.IDs = idsFile
+		}
+		if retryFailed {
+			if ds.IDs != "" {
+				return nil, fmt.Errorf("dataset %s: -retry-failed replaces its ID list", ds.Path)
+			}
+			ds.IDs = filepath.Join(ds.dir, failedFile)
+			if _, err := os.Stat(ds.IDs); os.IsNotExist(err) {
+				ds.ids = []int{}
+				continue
+			}
+		}
+		if ds.IDs != "" {
+			ids, err := readIDs(ds.IDs)
+			if err != nil {
+				return nil, fmt.Errorf("dataset %s: %v", ds.Path, err)
+			}
+			ds.ids, ds.Start, ds.End = ids, ids[0], ids[len(ids)-1]
+		}
+	}
+	return specs, nil
+}
+
+// parseDataset reads one -d entry: a path or number, optionally with
+// ":start-end"
+func parseDataset(entry string) (*datasetSpec, error) {
+	ds := &datasetSpec{Path: entry}
+	if i := strings.LastIndex(entry, ":"); i >= 0 {
+		from, to, ok := strings.Cut(entry[i+1:], "-")
+		start, err1 := strconv.Atoi(from)
+		end, err2 := strconv.Atoi(to)
+		if !ok || err1 != nil || err2 != nil || start < 1 {
+			return nil, fmt.Errorf("invalid dataset %q: want path or path:start-end", entry)
+		}
+		ds.Path, ds.Start, ds.End = entry[:i], start, end
+	}
+	return ds, nil
+}
+
+// readIDs reads an ID list: file numbers or EFTA filenames ("EFTA00001234",
+// with or without ".pdf"), separated by whitespace or commas. Anything after
+// a # is a comment. The numbers come back sorted, without
+// repeats.
+func readIDs(file string) ([]int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	seen := map[int]bool{}
+	var ids []int
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		for _, field := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			id := strings.TrimSuffix(strings.TrimPrefix(strings.ToUpper(field), "EFTA"), ".PDF")
+			num, err := strconv.Atoi(id)
+			if err != nil || num < 1 {
+				return nil, fmt.Errorf("%s:%d: invalid file ID %q", file, line, field)
+			}
+			if !seen[num] {
+				seen[num] = true
+				ids = append(ids, num)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no file IDs in %s", file)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// datasetPath is the site path of DataSet n
+func datasetPath(n int) string {
+	return fmt.Sprintf("files/DataSet%%20%d/", n)
+}
+
+// schedule orders the datasets' work: each dataset's files in turn
+// ("sequence") or one file from each dataset in turn ("interleave")
+func schedule(work map[*datasetSpec][]int, specs []*datasetSpec, order string) []task {
+	var tasks []task
+	if order == "interleave" {
+		for i := 0; ; i++ {
+			added := false
+			for _, ds := range specs {
+				if i < len(work[ds]) {
+					tasks = append(tasks, task{ds: ds, num: work[ds][i]})
+					added = true
+				}
+			}
+			if !added {
+				return tasks
+			}
+		}
+	}
+	for _, ds := range specs {
+		for _, num := range work[ds] {
+			tasks = append(tasks, task{ds: ds, num: num})
+		}
+	}
+	return tasks
+}
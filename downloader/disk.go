@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The disk watchdog checks the free space on the volumes of the output
+// directories before the run starts and every diskCheckEvery during it.
+// Below -min-free no new files start, a warning says how much is left, and
+// the run picks up again by itself once space has been freed. Files in
+// flight finish, so -min-free should leave room for -c of them. It's off
+// with -store, which doesn't save PDFs locally, and with -min-free 0.
+
+var (
+	minFreeFlag string
+	disk        *diskWatch
+)
+
+const diskCheckEvery = 10 * time.Second
+
+type diskWatch struct {
+	dirs    []string
+	minFree int64
+
+	mu   sync.Mutex
+	low  bool
+	left int64 // bytes free on the fullest volume at the last check, -1 unknown
+}
+
+// newDiskWatch watches dirs, or returns nil when there's nothing to watch
+func newDiskWatch(dirs []string, minFree int64) *diskWatch {
+	if minFree <= 0 || len(dirs) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool)
+	d := &diskWatch{minFree: minFree, left: -1}
+	for _, dir := range dirs {
+		if !seen[dir] {
+			seen[dir] = true
+			d.dirs = append(d.dirs, dir)
+		}
+	}
+	return d
+}
+
+// run checks now and then every diskCheckEvery until the run stops
+func (d *diskWatch) run() {
+	if d == nil {
+		return
+	}
+	d.check()
+	go func() {
+		ticker := time.NewTicker(diskCheckEvery)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.check()
+			case <-stopCtx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// check holds new files back while any volume is under the minimum, and
+// lets them go once none is
+func (d *diskWatch) check() {
+	left, fullest := int64(-1), ""
+	for _, dir := range d.dirs {
+		free, err := freeSpace(dir)
+		if err != nil {
+			logger.Debug(fmt.Sprintf("free space of %s: %v", dir, err), "event", "DISK", "dir", dir, "error", err)
+			continue
+		}
+		if left < 0 || free < left {
+			left, fullest = free, dir
+		}
+	}
+
+	d.mu.Lock()
+	was := d.low
+	d.left = left
+	d.low = left >= 0 && left < d.minFree
+	low := d.low
+	d.mu.Unlock()
+
+	switch {
+	case low && !was:
+		limiter.hold(holdDisk, true)
+		logger.Warn(fmt.Sprintf("Only %s free on %s, under -min-free %s: no new files start until space is freed",
+			formatSize(left), fullest, formatSize(d.minFree)), "event", "DISK", "dir", fullest, "free", left, "min_free", d.minFree)
+	case !low && was:
+		limiter.hold(holdDisk, false)
+		logger.Info(fmt.Sprintf("%s free on %s again, resuming", formatSize(left), fullest),
+			"event", "DISK", "dir", fullest, "free", left)
+	}
+}
+
+// free is the space left on the fullest volume at the last check, -1 when
+// unknown or not watched
+func (d *diskWatch) free() int64 {
+	if d == nil {
+		return -1
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.left
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A dry run works out what a run would download without writing anything:
+// the manifest is only read, and each file is probed with a HEAD request for
+// whether it exists and its Content-Length. -offline skips the requests and
+// estimates sizes from the files downloaded so far.
+
+// probeStats are a dataset's dry run results
+type probeStats struct {
+	found, missing, unknown int64
+	bytes                   int64 // Content-Length of the files found
+	unsized                 int64 // found without a Content-Length
+}
+
+// dryRun probes tasks, or with offline just counts them, and prints the
+// totals per dataset
+func dryRun(tasks []task, offline bool) {
+	stats := make(map[*datasetSpec]*probeStats)
+	for _, ds := range datasets {
+		stats[ds] = &probeStats{}
+	}
+
+	if offline {
+		for _, t := range tasks {
+			stats[t.ds].found++
+		}
+		fmt.Println("\n========================================")
+		fmt.Println("DRY RUN (offline)")
+		fmt.Println("========================================")
+		var total int64
+		for _, ds := range datasets {
+			s := stats[ds]
+			line := fmt.Sprintf("%s: %d to download", ds.name(), s.found)
+			if avg, n, err := state.averageSize(ds.Path); err == nil && n > 0 && s.found > 0 {
+				estimate := avg * s.found
+				total += estimate
+				line += fmt.Sprintf(", about %s (average of %d downloaded)", formatSize(estimate), n)
+			}
+			fmt.Println(line)
+		}
+		fmt.Printf("Files: %d\n", len(tasks))
+		if total > 0 {
+			fmt.Printf("Estimated size: %s\n", formatSize(total))
+		}
+		return
+	}
+
+	startTime := time.Now()
+	jobs := make(chan task, concurrency*2)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client := newProbeClient()
+			for t := range jobs {
+				if !limiter.acquire() {
+					continue
+				}
+				status, size := probeFile(client, t.ds, t.num)
+				limiter.release()
+
+				s := stats[t.ds]
+				switch status {
+				case statusOK:
+					atomic.AddInt64(&s.found, 1)
+					if size >= 0 {
+						atomic.AddInt64(&s.bytes, size)
+					} else {
+						atomic.AddInt64(&s.unsized, 1)
+					}
+				case statusMissing:
+					atomic.AddInt64(&s.missing, 1)
+				case statusFailed:
+					atomic.AddInt64(&s.unknown, 1)
+				}
+			}
+		}()
+	}
+
+	done := make(chan bool)
+	if !verbose {
+		go progressReporter(startTime, done)
+	}
+
+dispatch:
+	for _, t := range tasks {
+		select {
+		case jobs <- t:
+		case <-stopCtx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if !verbose {
+		done <- true
+	}
+
+	fmt.Println("\n========================================")
+	if stopCtx.Err() != nil {
+		fmt.Println("DRY RUN INTERRUPTED")
+	} else {
+		fmt.Println("DRY RUN")
+	}
+	fmt.Println("========================================")
+	fmt.Printf("Time: %v\n", time.Since(startTime).Round(time.Second))
+	var found, missing, unknown, bytes, unsized int64
+	for _, ds := range datasets {
+		s := stats[ds]
+		found, missing, unknown, bytes, unsized = found+s.found, missing+s.missing, unknown+s.unknown, bytes+s.bytes, unsized+s.unsized
+		if len(datasets) > 1 {
+			fmt.Printf("  %s: %d to download (%s), %d not found, %d unknown\n", ds.name(), s.found, formatSize(s.bytes), s.missing, s.unknown)
+		}
+	}
+	fmt.Printf("Would download: %d\n", found)
+	fmt.Printf("Not found (404): %d\n", missing)
+	fmt.Printf("Unknown (errors): %d\n", unknown)
+	fmt.Printf("Total size: %s", formatSize(bytes))
+	if unsized > 0 {
+		fmt.Printf(" (%d files without a Content-Length)", unsized)
+	}
+	fmt.Println()
+	if rest := len(tasks) - int(found+missing+unknown); rest > 0 {
+		fmt.Printf("Not probed: %d\n", rest)
+	}
+}
+
+// probeFile probes one PDF for the dry run, counting and reporting it
+func probeFile(client *http.Client, ds *datasetSpec, num int) (string, int64) {
+	filename := fmt.Sprintf("EFTA%08d.pdf", num)
+	status, size := headFile(client, ds, num)
+	switch status {
+	case statusOK:
+		atomic.AddInt64(&downloaded, 1)
+		if size >= 0 {
+			logger.Debug(fmt.Sprintf("%d bytes", size), "event", "WOULD", "file", filename, "bytes", size)
+		} else {
+			logger.Debug("size unknown", "event", "WOULD", "file", filename)
+		}
+	case statusMissing:
+		atomic.AddInt64(&skipped, 1)
+		logger.Debug("not found", "event", "404", "file", filename)
+	case statusFailed:
+		atomic.AddInt64(&failed, 1)
+	}
+	return status, size
+}
+
+// newProbeClient returns a client for headFile, which handles redirects
+// itself
+func newProbeClient() *http.Client {
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// headFile asks for one PDF's headers and returns statusOK with its size
+// (-1 when unknown), statusMissing, statusFailed when no answer came, or
+// statusPending when aborted. A server refusing HEAD is asked for the first
+// byte instead.
+func headFile(client *http.Client, ds *datasetSpec, num int) (string, int64) {
+	filename := fmt.Sprintf("EFTA%08d.pdf", num)
+	method := http.MethodHead
+
+	for attempt := 0; attempt < 3 && abortCtx.Err() == nil; attempt++ {
+		req := (&http.Request{
+			Method: method,
+			URL:    buildURL(ds.Path, filename),
+			Header: make(http.Header),
+		}).WithContext(abortCtx)
+		req.Header.Set("User-Agent", userAgent)
+		req.Header.Set("Connection", "keep-alive")
+		if method == http.MethodGet {
+			req.Header.Set("Range", "bytes=0-0")
+		}
+
+		if d := limiter.pauseLeft(); d > 0 {
+			sleep(d)
+		}
+		refreshCookies.wait()
+		cookieHeader, generation := cookies.header()
+		req.Header.Set("Cookie", cookieHeader)
+
+		px := proxies.pick()
+		client.Transport = px.roundTripper()
+
+		sent := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			if abortCtx.Err() == nil {
+				limiter.observe(0, time.Since(sent))
+				proxies.failed(px, err)
+			}
+			logger.Debug(fmt.Sprintf("attempt %d: %v", attempt+1, err), "event", "RETRY", "file", filename, "attempt", attempt+1, "error", err)
+			sleep(time.Duration(attempt+1) * 500 * time.Millisecond)
+			continue
+		}
+		resp.Body.Close()
+		limiter.observe(resp.StatusCode, time.Since(sent))
+		proxies.ok(px)
+
+		switch resp.StatusCode {
+		case 200, 206:
+			size := resp.ContentLength
+			if resp.StatusCode == 206 {
+				size = rangeTotal(resp.Header.Get("Content-Range"))
+			}
+			return statusOK, size
+
+		case 404:
+			return statusMissing, 0
+
+		case 405, 501:
+			if method == http.MethodHead {
+				method = http.MethodGet
+				attempt--
+				continue
+			}
+
+		case 429, 503:
+			if wait, given := retryAfter(resp.Header); given || resp.StatusCode == 429 {
+				limiter.pause(min(wait, maxPause))
+				sleep(wait + jitter(wait))
+				continue
+			}
+
+		case 302:
+			cookies.markExpired(generation)
+			if refreshCookies.refresh(generation) {
+				continue
+			}
+			logger.Warn("302 redirect, cookies may be expired!", "event", "WARN", "file", filename)
+			return statusFailed, 0
+		}
+
+		logger.Debug("unexpected status, retrying...", "event", strconv.Itoa(resp.StatusCode), "file", filename, "attempt", attempt+1)
+		sleep(time.Duration(attempt+1) * 500 * time.Millisecond)
+	}
+
+	if abortCtx.Err() != nil {
+		return statusPending, 0
+	}
+	logger.Debug("no answer after retries", "event", "FAIL", "file", filename)
+	return statusFailed, 0
+}
+
+// rangeTotal reads the complete length from a Content-Range such as
+// "bytes 0-0/12345", or -1
+func rangeTotal(contentRange string) int64 {
+	_, total, ok := strings.Cut(contentRange, "/")
+	if !ok {
+		return -1
+	}
+	n, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// formatSize prints a byte count like formatRate does a rate
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.2f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	default:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+}
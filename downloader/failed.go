@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// After a run each dataset's output directory gets a failed.txt listing the
+// files the manifest has as failed, with why. It is an ID list, so
+// -retry-failed (or -f) can queue just those files again.
+
+const failedFile = "failed.txt"
+
+// writeFailed rewrites ds's failed.txt from the manifest, removing it when
+// nothing failed, and returns how many files it lists
+func writeFailed(ds *datasetSpec) (int, error) {
+	failures, err := state.failures(ds.Path, ds.Start, ds.End)
+	if err != nil {
+		return 0, err
+	}
+	if ds.ids != nil {
+		listed := make(map[int]bool, len(ds.ids))
+		for _, num := range ds.ids {
+			listed[num] = true
+		}
+		kept := failures[:0]
+		for _, f := range failures {
+			if listed[f.num] {
+				kept = append(kept, f)
+			}
+		}
+		failures = kept
+	}
+
+	path := filepath.Join(ds.dir, failedFile)
+	if len(failures) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+		return 0, nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	fmt.Fprintf(f, "# Failed downloads from %s at %s\n", ds.Path, time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintln(f, "# Retry them with -retry-failed")
+	for _, failure := range failures {
+		fmt.Fprintf(f, "EFTA%08d  # %s\n", failure.num, failure.reason)
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	return len(failures), nil
+}
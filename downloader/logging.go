@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// Per-file events ([OK], [RETRY], [404], ...), warnings and errors are
+// structured records through logger, each with an "event" and, for a file,
+// its "file" name, next to whatever numbers it carries. The console shows
+// them as the bracketed lines it always has, per-file events (debug level)
+// only with -v, or -tui in its event pane; -web lists the failures.
+// -log-file appends every record, per-file events included, as key=value
+// text or with -log-format json as JSON lines, along with a record of the
+// run's settings at the start and its totals at the end, so a long run can
+// be analysed afterwards. The progress line goes to stderr.
+
+var (
+	logFile   string
+	logFormat string
+
+	logger  = slog.New(&consoleHandler{})
+	fileLog = slog.New(discardHandler{}) // the log file alone
+	logOut  *os.File
+
+	// The progress line is on screen without a newline after it
+	progressShown atomic.Bool
+	consoleMu     sync.Mutex
+)
+
+// openLog sets up logger once the flags are parsed
+func openLog() error {
+	if logFormat != "text" && logFormat != "json" {
+		return fmt.Errorf("-log-format must be text or json, not %q", logFormat)
+	}
+	console := &consoleHandler{}
+	if logFile == "" {
+		logger = slog.New(console)
+		return nil
+	}
+
+	f, err := os.OpenFile(logFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var file slog.Handler
+	if logFormat == "json" {
+		file = slog.NewJSONHandler(f, opts)
+	} else {
+		file = slog.NewTextHandler(f, opts)
+	}
+	logOut = f
+	logger = slog.New(teeHandler{console, file})
+	fileLog = slog.New(file)
+	return nil
+}
+
+func closeLog() {
+	if logOut != nil {
+		logOut.Close()
+	}
+}
+
+// fatal logs an error that stops the run, and exits
+func fatal(format string, args ...any) {
+	dash.close()
+	logger.Error(fmt.Sprintf(format, args...))
+	closeLog()
+	os.Exit(1)
+}
+
+// printProgress redraws the progress line on stderr
+func printProgress(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "\r"+format, args...)
+	progressShown.Store(true)
+}
+
+// consoleHandler prints records as "[EVENT] file - message", or for those
+// without an event "Error: message" and "[WARN] message"
+type consoleHandler struct {
+	attrs []slog.Attr
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level > slog.LevelDebug || verbose || dash.visible() || web != nil
+}
+
+func (h *consoleHandler) Handle(_ context.Context, r slog.Record) error {
+	var event, file string
+	find := func(a slog.Attr) bool {
+		switch a.Key {
+		case "event":
+			event = a.Value.String()
+		case "file":
+			file = a.Value.String()
+		}
+		return true
+	}
+	for _, a := range h.attrs {
+		find(a)
+	}
+	r.Attrs(find)
+
+	line := r.Message
+	switch {
+	case event != "" && file != "":
+		line = fmt.Sprintf("[%s] %s - %s", event, file, r.Message)
+	case event != "":
+		line = fmt.Sprintf("[%s] %s", event, r.Message)
+	case r.Level >= slog.LevelError:
+		line = "Error: " + r.Message
+	case r.Level >= slog.LevelWarn:
+		line = "[WARN] " + r.Message
+	}
+
+	// -web lists the failures, -tui shows the line in its event pane while
+	// it draws the screen
+	web.add(r.Level, event, file, line)
+	if dash.visible() {
+		dash.add(r.Level, event, line)
+		return nil
+	}
+	if r.Level <= slog.LevelDebug && !verbose {
+		return nil
+	}
+
+	consoleMu.Lock()
+	defer consoleMu.Unlock()
+	if progressShown.Swap(false) {
+		line = "\n" + line
+	}
+	_, err := fmt.Fprintln(os.Stdout, line)
+	return err
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &consoleHandler{attrs: append(append([]slog.Attr(nil), h.attrs...), attrs...)}
+}
+
+func (h *consoleHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// teeHandler passes records on to each handler that wants them
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var first error
+	for _, h := range t {
+		if h.Enabled(ctx, r.Level) {
+			if err := h.Handle(ctx, r.Clone()); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(teeHandler, len(t))
+	for i, h := range t {
+		out[i] = h.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	out := make(teeHandler, len(t))
+	for i, h := range t {
+		out[i] = h.WithGroup(name)
+	}
+	return out
+}
+
+// discardHandler drops every record, for fileLog without -log-file
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (d discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return d }
+func (d discardHandler) WithGroup(string) slog.Handler           { return d }
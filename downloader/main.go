@@ -2,17 +2,25 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
-	"net"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -23,14 +31,62 @@ var (
 	endNum      int
 	outputDir   string
 	concurrency int
+	fixed       bool
 	verbose     bool
 
-	// Cookies
-	akBmsc      string
-	ageVerified string
-	queueIT     string
+	// Dry run (dryrun.go)
+	dryRunMode bool
+	offline    bool
+
+	// Verify pass (verify.go)
+	verifyMode bool
+
+	// Datasets (datasets.go)
+	datasetsFile string
+	idsFile      string
+	retryFailed  bool
+	order        string
+	datasets     []*datasetSpec
+
+	// Adaptive concurrency (throttle.go)
+	limiter *throttle
+
+	// Bandwidth limit (bandwidth.go)
+	bwFlag  string
+	bwLimit *bandwidth
+
+	// Download state (manifest.go)
+	manifestPath string
+	recheck404   bool
+	state        *manifest
+
+	// Output subdirectories (shard.go)
+	shardSize int
+
+	// Where PDFs are saved (storage.go, s3.go)
+	storeURL string
+	store    fileStore = localStore{}
+
+	// Archive shards (archive.go)
+	archiveFormat string
+	archiveSize   string
+
+	// Checksum manifests (checksums.go)
+	checksumName string
+	checksums    *checksumLog
+
+	// Cookies (cookies.go)
+	akBmsc         string
+	ageVerified    string
+	queueIT        string
+	refreshCmd     string
+	refreshURL     string
+	refreshBrowser bool
+	cookies        *cookieSet
+	refreshCookies *refresher
 
 	// Stats
+	planned    int64 // files to download; grows as -claims takes over ranges
 	downloaded int64
 	failed     int64
 	skipped    int64
@@ -44,6 +100,17 @@ var (
 
 	// Shared transport for connection pooling
 	transport *http.Transport
+
+	// Proxies (proxy.go)
+	proxyList string
+	proxyFile string
+	proxies   *proxyPool
+
+	// Shutdown: the first SIGINT/SIGTERM cancels stopCtx, so no new files
+	// start; a second cancels abortCtx, cutting off transfers in progress
+	stopCtx     context.Context
+	abortCtx    context.Context
+	interrupted int64 // files aborted mid-transfer
 )
 
 func loadEnvFile() {
@@ -79,16 +146,150 @@ func loadEnvFile() {
 func main() {
 	loadEnvFile()
 
-	flag.StringVar(&dataset, "d", "files/DataSet%201/", "Dataset path")
+	flag.StringVar(&dataset, "d", "files/DataSet%201/", "Dataset path, or a comma-separated list (each path or number, optionally with :start-end)")
+	flag.StringVar(&datasetsFile, "datasets", "", "JSON file of datasets, each with path, start, end and output")
+	flag.StringVar(&order, "order", "sequence", "With several datasets: sequence (one after another) or interleave (a file from each in turn)")
+	flag.StringVar(&idsFile, "f", "", "File of file numbers or EFTA filenames to download instead of the -s/-e range")
+	flag.BoolVar(&retryFailed, "retry-failed", false, "Download only the files listed in each dataset's failed.txt by an earlier run")
 	flag.IntVar(&startNum, "s", 1, "Start file number")
 	flag.IntVar(&endNum, "e", 2731783, "End file number")
 	flag.StringVar(&outputDir, "o", "../downloads", "Output directory")
-	flag.IntVar(&concurrency, "c", 100, "Concurrent downloads")
+	flag.StringVar(&storeURL, "store", "", "Save PDFs to object storage instead, s3://bucket/prefix or gs://bucket/prefix (credentials from the environment)")
+	flag.StringVar(&archiveFormat, "archive", "", "Append PDFs to rolling tar or zip shards in the output directory instead of saving loose files")
+	flag.StringVar(&archiveSize, "archive-size", "4GB", "Size at which -archive starts the next shard")
+	flag.IntVar(&shardSize, "shard", 0, "Files per output subdirectory, e.g. 10000 saves EFTA00273456.pdf in 000027/ (0 for none)")
+	flag.StringVar(&partitionFlag, "partition", "", "This instance's share when several split the work, i/n, e.g. 2/4 for the second of four")
+	flag.StringVar(&claimsPath, "claims", "", "SQLite database shared by -partition instances, to take over each other's unfinished ranges")
+	flag.StringVar(&minFreeFlag, "min-free", "2GB", "Start no new files while an output disk has less free space than this (0 for no check)")
+	flag.IntVar(&concurrency, "c", 100, "Maximum concurrent downloads")
+	flag.BoolVar(&fixed, "fixed", false, "Always run -c downloads at once instead of adapting to rate limits")
+	flag.StringVar(&proxyList, "proxy", "", "Proxy URL, or a comma-separated list to rotate over (http://, https:// or socks5://)")
+	flag.StringVar(&proxyFile, "proxy-file", "", "File of proxy URLs to rotate over, one per line")
+	flag.DurationVar(&stallTimeout, "stall", 30*time.Second, "Give up on a transfer, keeping what arrived for the next attempt, when no bytes arrive for this long (0 for never)")
+	flag.StringVar(&minRateFlag, "min-rate", "10K", "Slowest average rate a transfer may keep, which with its size sets how long it may take (0 for no limit)")
+	flag.StringVar(&bwFlag, "bw", "", "Total bandwidth limit, e.g. 50MB or 500K per second (default no limit)")
+	flag.StringVar(&httpVersion, "http", "1.1", "HTTP version to use: 1.1 (a connection per download) or 2 (downloads multiplexed over fewer connections)")
+	flag.IntVar(&idlePerHost, "idle-per-host", 0, "Idle connections kept per host for reuse (default twice -c)")
+	flag.IntVar(&tlsSessions, "tls-sessions", 0, "TLS sessions cached for resuming handshakes on new connections (0 for none)")
+	flag.DurationVar(&dialTimeout, "dial-timeout", 10*time.Second, "Time allowed to open a TCP connection")
+	flag.DurationVar(&keepAlive, "keepalive", 30*time.Second, "Interval of TCP keep-alive probes (negative to turn them off)")
+	flag.DurationVar(&tlsTimeout, "tls-timeout", 10*time.Second, "Time allowed for a TLS handshake")
+	flag.StringVar(&readBufferFlag, "read-buffer", "", "Size of each connection's read buffer, e.g. 64K (default 4K)")
 	flag.BoolVar(&verbose, "v", false, "Verbose output (show each file)")
+	flag.BoolVar(&tuiMode, "tui", false, "Show a full-screen dashboard of workers, speed and errors instead of the progress line")
+	flag.StringVar(&webAddr, "web", "", "Serve a status page with pause and resume buttons on this address, e.g. localhost:9090")
+	flag.StringVar(&webToken, "web-token", "", "Token the -web page and API require (default $DOWNLOADER_WEB_TOKEN; required unless -web is a loopback address)")
+	flag.StringVar(&logFile, "log-file", "", "File to append every event to, per-file ones included, for analysis after the run")
+	flag.StringVar(&logFormat, "log-format", "text", "Format of -log-file: text (key=value) or json (one object per line)")
+	flag.BoolVar(&dryRunMode, "dry-run", false, "Probe files with HEAD requests and report what would be downloaded, writing nothing")
+	flag.BoolVar(&offline, "offline", false, "Dry run without any requests, from the manifest and output directories alone")
+	flag.BoolVar(&verifyMode, "verify", false, "First check downloaded files against the server's Content-Length, downloading mismatched or truncated ones again")
+	flag.BoolVar(&updateMode, "update", false, "Ask again for files already downloaded, with If-None-Match/If-Modified-Since, and download those the server has replaced")
+	flag.StringVar(&checksumName, "checksums", "checksums.csv", "CSV of filename,sha256,size appended to in each output directory (\"\" for none)")
+	flag.StringVar(&manifestPath, "manifest", "", "Download state database (default <output>/download_manifest.db)")
+	flag.BoolVar(&recheck404, "recheck-404", false, "Request files the manifest recorded as 404 again")
+	flag.DurationVar(&watchEvery, "watch", 0, "Keep running and sweep the range again this often, e.g. 6h, to pick up newly published files")
+	flag.DurationVar(&watchMax, "watch-max", 0, "Longest wait between sweeps as it doubles while sweeps find nothing new (default 8 times -watch)")
 	flag.StringVar(&akBmsc, "ak", "", "ak_bmsc cookie value")
 	flag.StringVar(&ageVerified, "age", "true", "justiceGovAgeVerified cookie")
 	flag.StringVar(&queueIT, "queue", "", "QueueITAccepted cookie value")
+	flag.StringVar(&refreshCmd, "refresh-cmd", "", "Command printing fresh cookies (name=value lines), run when cookies expire")
+	flag.StringVar(&refreshURL, "refresh-url", "", "URL whose Set-Cookie responses renew expired cookies")
+	flag.BoolVar(&refreshBrowser, "refresh-browser", false, "Renew expired cookies with the Python downloader's headless browser harvest")
 	flag.Parse()
+	if err := openLog(); err != nil {
+		fatal("%v", err)
+	}
+	defer closeLog()
+	if watching() {
+		code := watch()
+		closeLog()
+		os.Exit(code)
+	}
+
+	// Ctrl-C also cuts short a cookie refresh at startup
+	stopCtx, abortCtx = handleSignals()
+
+	rate, err := parseRate(bwFlag)
+	if err != nil {
+		fatal("%v", err)
+	}
+	bwLimit = newBandwidth(rate)
+	if minRate, err = parseRate(minRateFlag); err != nil {
+		fatal("-min-rate: %v", err)
+	}
+	minFree, err := parseBytes(minFreeFlag)
+	if err != nil {
+		fatal("-min-free: %v", err)
+	}
+
+	if order != "sequence" && order != "interleave" {
+		fatal("-order must be sequence or interleave, not %q", order)
+	}
+	datasets, err = loadDatasets(dataset, datasetsFile, idsFile, retryFailed, startNum, endNum, outputDir)
+	if err != nil {
+		fatal("%v", err)
+	}
+	dryRunMode = dryRunMode || offline
+	self, of, err := parsePartition(partitionFlag)
+	if err != nil {
+		fatal("%v", err)
+	}
+	if of > 0 {
+		parts = newPartition(self, of, datasets)
+	} else if claimsPath != "" {
+		fatal("-claims shares ranges between -partition instances, so it needs -partition")
+	}
+	if store, err = openStore(storeURL, outputDir); err != nil {
+		fatal("%v", err)
+	}
+	if objects, ok := store.(*objectStore); ok {
+		if err := objects.check(); err != nil {
+			fatal("%v", err)
+		}
+	}
+	if archiveFormat != "" {
+		if storeURL != "" {
+			fatal("-archive writes shards to the output directory, so it can't be used with -store")
+		}
+		limit, err := parseBytes(archiveSize)
+		if err != nil {
+			fatal("-archive-size: %v", err)
+		}
+		dirs := make([]string, len(datasets))
+		for i, ds := range datasets {
+			dirs[i] = ds.dir
+		}
+		if store, err = newArchiveStore(archiveFormat, limit, dirs); err != nil {
+			fatal("%v", err)
+		}
+	}
+	if verifyMode && offline {
+		fatal("-verify asks the server for sizes, so it can't be used with -offline")
+	}
+	if updateMode && dryRunMode {
+		fatal("-update downloads the files that changed, so it can't be used with -dry-run or -offline")
+	}
+	for _, ds := range datasets {
+		if dryRunMode {
+			continue // writes nothing
+		}
+		if err := os.MkdirAll(ds.dir, 0755); err != nil {
+			fatal("creating output dir: %v", err)
+		}
+	}
+
+	if err := checkTransportFlags(); err != nil {
+		fatal("%v", err)
+	}
+	transport = newTransport(nil)
+	proxyURLs, err := loadProxies(proxyList, proxyFile)
+	if err != nil {
+		fatal("%v", err)
+	}
+	if len(proxyURLs) > 0 {
+		proxies = newProxyPool(proxyURLs)
+	}
 
 	if akBmsc == "" {
 		akBmsc = os.Getenv("DOJ_COOKIE_AK_BMSC")
@@ -96,96 +297,382 @@ func main() {
 	if queueIT == "" {
 		queueIT = os.Getenv("DOJ_COOKIE_QUEUE_IT")
 	}
+	cookies = newCookieSet(map[string]string{
+		cookieAkBmsc:      akBmsc,
+		cookieAgeVerified: ageVerified,
+		cookieQueueIT:     queueIT,
+	})
+	source, err := refreshSource()
+	if err != nil {
+		fatal("%v", err)
+	}
+	if source != nil {
+		refreshCookies = newRefresher(source, cookies)
+	}
 
-	if akBmsc == "" || queueIT == "" {
-		fmt.Println("Error: Cookies required. Set via flags or environment variables:")
-		fmt.Println("  DOJ_COOKIE_AK_BMSC")
-		fmt.Println("  DOJ_COOKIE_QUEUE_IT")
-		os.Exit(1)
+	if webToken == "" {
+		webToken = os.Getenv("DOWNLOADER_WEB_TOKEN")
+	}
+	if webAddr != "" {
+		if web, err = startWeb(webAddr); err != nil {
+			fatal("%v", err)
+		}
 	}
 
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		fmt.Printf("Error creating output dir: %v\n", err)
-		os.Exit(1)
+	if (akBmsc == "" || queueIT == "") && !offline {
+		// Without cookies to start with, fetch them now
+		_, generation := cookies.header()
+		if !refreshCookies.refresh(generation) {
+			fatal("Cookies required. Set DOJ_COOKIE_AK_BMSC and DOJ_COOKIE_QUEUE_IT (or -ak and -queue), " +
+				"or give -refresh-cmd, -refresh-url or -refresh-browser to obtain them")
+		}
 	}
 
-	// Create optimized transport for connection reuse
-	transport = &http.Transport{
-		MaxIdleConns:        concurrency * 2,
-		MaxIdleConnsPerHost: concurrency * 2,
-		MaxConnsPerHost:     concurrency * 2,
-		IdleConnTimeout:     90 * time.Second,
-		DisableCompression:  true,
-		DialContext: (&net.Dialer{
-			Timeout:   10 * time.Second,
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
+	if manifestPath == "" {
+		manifestPath = filepath.Join(outputDir, "download_manifest.db")
+	}
+	if dryRunMode {
+		state, err = openManifestReadOnly(manifestPath)
+	} else {
+		state, err = openManifest(manifestPath)
 	}
+	if err != nil {
+		fatal("opening manifest: %v", err)
+	}
+
+	work := make(map[*datasetSpec][]int)
+	var verify []task
+	for _, ds := range datasets {
+		// Only a dataset new to the manifest needs its output directory listed
+		var existing map[int]int64
+		if empty, err := state.empty(ds.Path); err == nil && empty {
+			existing = getExistingFiles(ds.dir)
+			logger.Info(fmt.Sprintf("Found %d existing files in %s", len(existing), store.location(ds.dir)), "dataset", ds.name(), "existing", len(existing))
+			// A dry run counts them as done below instead of recording them
+			if !dryRunMode {
+				if err := state.seed(ds.Path, existing); err != nil {
+					fatal("seeding manifest: %v", err)
+				}
+			}
+		}
+		recorded, err := state.load(ds.Path, ds.Start, ds.End)
+		if err != nil {
+			fatal("reading manifest: %v", err)
+		}
+		if dryRunMode {
+			for num := range existing {
+				recorded[num] = statusOK
+			}
+		}
+		if updateMode {
+			if ds.saved, err = state.saved(ds.Path, ds.Start, ds.End); err != nil {
+				fatal("reading manifest: %v", err)
+			}
+		}
 
-	existing := getExistingFiles()
-	fmt.Printf("Found %d existing files\n", len(existing))
+		var done404, recheck int
+		nums := ds.files()
+		for _, i := range nums {
+			switch recorded[i] {
+			case statusOK:
+				if verifyMode && parts.home(ds, i) {
+					verify = append(verify, task{ds: ds, num: i})
+				}
+				if !updateMode {
+					continue
+				}
+				recheck++
+			case statusMissing:
+				if !recheck404 {
+					done404++
+					continue
+				}
+			}
+			work[ds] = append(work[ds], i)
+		}
+		total, done := len(nums), len(nums)-len(work[ds])+recheck
+		logger.Info(fmt.Sprintf("Manifest %s: %s: %d of %d files done (%d not found)", manifestPath, ds.name(), done, total, done404),
+			"dataset", ds.name(), "files", total, "done", done, "not_found", done404)
+	}
 
-	var work []int
-	for i := startNum; i <= endNum; i++ {
-		if _, exists := existing[i]; !exists {
-			work = append(work, i)
+	limiter = newThrottle(concurrency, !fixed)
+	if !dryRunMode && storeURL == "" {
+		dirs := make([]string, len(datasets))
+		for i, ds := range datasets {
+			dirs[i] = ds.dir
 		}
+		disk = newDiskWatch(dirs, minFree)
+		disk.run()
 	}
+	if len(verify) > 0 {
+		for _, t := range verifyFiles(verify) {
+			if updateMode {
+				delete(t.ds.saved, t.num) // already queued; now for a full download
+				continue
+			}
+			work[t.ds] = append(work[t.ds], t.num)
+		}
+		if stopCtx.Err() != nil {
+			state.close()
+			os.Exit(130)
+		}
+	}
+	// With -partition only this instance's share counts, unless -claims
+	// lets it take over the others' too
+	mine, left := work, 0
+	if parts != nil {
+		mine = parts.mine(work)
+		for _, nums := range work {
+			left += len(nums)
+		}
+	}
+	tasks := schedule(mine, datasets, order)
 
-	if len(work) == 0 {
-		fmt.Println("All files already downloaded!")
+	if len(tasks) == 0 && (claimsPath == "" || dryRunMode || left == 0) {
+		state.close()
+		switch {
+		case retryFailed:
+			fmt.Println("No failed files to retry!")
+		case parts != nil:
+			fmt.Printf("All files of partition %d/%d already downloaded!\n", parts.self, parts.of)
+		default:
+			fmt.Println("All files already downloaded!")
+		}
 		return
 	}
+	if claimsPath != "" && !dryRunMode {
+		if claims, err = openClaims(claimsPath, parts); err != nil {
+			state.close()
+			fatal("%v", err)
+		}
+	}
+	atomic.StoreInt64(&planned, int64(len(tasks)))
 
 	fmt.Println("========================================")
 	fmt.Println("DOJ Epstein Files Downloader (Go)")
 	fmt.Println("========================================")
-	fmt.Printf("Dataset: %s\n", dataset)
-	fmt.Printf("Range: EFTA%08d to EFTA%08d\n", startNum, endNum)
-	fmt.Printf("Files to download: %d\n", len(work))
-	fmt.Printf("Concurrency: %d\n", concurrency)
-	fmt.Printf("Output: %s\n", outputDir)
+	if len(datasets) == 1 {
+		fmt.Printf("Dataset: %s\n", datasets[0].Path)
+		fmt.Printf("Range: EFTA%08d to EFTA%08d\n", datasets[0].Start, datasets[0].End)
+		if datasets[0].ids != nil {
+			fmt.Printf("ID list: %s, %d files\n", datasets[0].IDs, len(datasets[0].ids))
+		}
+	} else {
+		fmt.Printf("Datasets: %d, %s\n", len(datasets), order)
+		for _, ds := range datasets {
+			fmt.Printf("  %s: EFTA%08d to EFTA%08d, %d to download -> %s\n", ds.Path, ds.Start, ds.End, len(work[ds]), ds.dir)
+		}
+	}
+	fmt.Printf("Files to download: %d\n", len(tasks))
+	if updateMode {
+		recheck := 0
+		for _, t := range tasks {
+			if _, ok := t.ds.saved[t.num]; ok {
+				recheck++
+			}
+		}
+		fmt.Printf("Update: %d of them downloaded already, only downloaded again if changed\n", recheck)
+	}
+	if fixed {
+		fmt.Printf("Concurrency: %d\n", concurrency)
+	} else {
+		fmt.Printf("Concurrency: adaptive, up to %d\n", concurrency)
+	}
+	if bwLimit != nil {
+		fmt.Printf("Bandwidth: %s\n", formatRate(rate))
+	}
+	if stallTimeout > 0 || minRate > 0 {
+		fmt.Printf("Timeouts: %s\n", describeTimeouts())
+	}
+	fmt.Printf("Transport: %s\n", describeTransport())
+	if proxies != nil {
+		fmt.Printf("Proxies: %d\n", len(proxyURLs))
+	}
+	if refreshCookies != nil {
+		fmt.Printf("Cookie refresh: %s\n", refreshCookies.source)
+	}
+	if len(datasets) == 1 {
+		fmt.Printf("Output: %s\n", datasets[0].dir)
+	}
+	if storeURL != "" || archiveFormat != "" {
+		fmt.Printf("Store: %s\n", store)
+	}
+	if shardSize > 0 {
+		fmt.Printf("Shards: %d files per subdirectory\n", shardSize)
+	}
+	if disk != nil {
+		if free := disk.free(); free >= 0 {
+			fmt.Printf("Min free: %s, %s free now\n", formatSize(minFree), formatSize(free))
+		} else {
+			fmt.Printf("Min free: %s\n", formatSize(minFree))
+		}
+	}
+	if parts != nil {
+		fmt.Printf("Partition: %d/%d, %d of %d ranges of %d files\n", parts.self, parts.of, parts.homeRanges(), len(parts.ranges), partitionRange)
+	}
+	if claims != nil {
+		fmt.Printf("Claims: %s\n", claimsPath)
+	}
+	if checksumName != "" && !dryRunMode {
+		fmt.Printf("Checksums: %s\n", checksumName)
+	}
 	fmt.Printf("Verbose: %v\n", verbose)
+	if offline {
+		fmt.Println("Mode: dry run, offline")
+	} else if dryRunMode {
+		fmt.Println("Mode: dry run, HEAD requests only")
+	}
 	fmt.Println("========================================")
 
+	if dryRunMode {
+		dryRun(tasks, offline)
+		state.close()
+		if stopCtx.Err() != nil {
+			os.Exit(130)
+		}
+		return
+	}
+
+	if checksumName != "" {
+		checksums = newChecksumLog(checksumName)
+	}
+
+	fileLog.Info("run started", "event", "START", "files", len(tasks), "datasets", len(datasets),
+		"concurrency", concurrency, "adaptive", !fixed, "bandwidth", rate, "proxies", len(proxyURLs), "store", store.String())
 	startTime := time.Now()
 
-	jobs := make(chan int, concurrency*2)
+	jobs := make(chan task, concurrency*2)
 	var wg sync.WaitGroup
 
+	if tuiMode {
+		dash = newDashboard(concurrency)
+	}
 	for i := 0; i < concurrency; i++ {
 		wg.Add(1)
-		go worker(jobs, &wg)
+		go worker(jobs, &wg, dash.worker(i))
 	}
 
 	done := make(chan bool)
-	if !verbose {
-		go progressReporter(len(work), startTime, done)
+	web.run(startTime)
+	if dash != nil {
+		dash.run(startTime)
+	} else if !verbose {
+		go progressReporter(startTime, done)
 	}
 
-	for _, num := range work {
-		jobs <- num
+	feed := func(t task) bool {
+		state.record(t.ds.Path, t.num, statusPending, 0, "")
+		select {
+		case jobs <- t:
+			return true
+		case <-stopCtx.Done():
+			return false
+		}
+	}
+	if claims != nil {
+		if err := claims.dispatch(work, feed); err != nil {
+			logger.Error(fmt.Sprintf("claims: %v; finishing the files handed out", err))
+		}
+	} else {
+		for _, t := range tasks {
+			if !feed(t) {
+				break
+			}
+		}
 	}
 	close(jobs)
 
 	wg.Wait()
-	if !verbose {
+	if err := claims.close(); err != nil {
+		logger.Warn(fmt.Sprintf("claims: giving up unfinished ranges: %v", err))
+	}
+	if err := state.flush(); err != nil {
+		logger.Warn(fmt.Sprintf("manifest incomplete: %v", err))
+	}
+	failedLists := make(map[*datasetSpec]int)
+	for _, ds := range datasets {
+		n, err := writeFailed(ds)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("%s: writing %s: %v", ds.name(), failedFile, err))
+		}
+		failedLists[ds] = n
+	}
+	state.close()
+	if err := checksums.close(); err != nil {
+		logger.Warn(fmt.Sprintf("%s: %v", checksumName, err))
+	}
+	if archive, ok := store.(*archiveStore); ok {
+		if err := archive.close(); err != nil {
+			logger.Warn(fmt.Sprintf("closing archive shards: %v", err))
+		}
+	}
+	if dash != nil {
+		dash.close()
+	} else if !verbose {
 		done <- true
 	}
 
 	elapsed := time.Since(startTime)
 	fmt.Println("\n========================================")
-	fmt.Println("DOWNLOAD COMPLETE")
+	if stopCtx.Err() != nil {
+		fmt.Println("DOWNLOAD INTERRUPTED")
+	} else {
+		fmt.Println("DOWNLOAD COMPLETE")
+	}
 	fmt.Println("========================================")
 	fmt.Printf("Time: %v\n", elapsed.Round(time.Second))
 	fmt.Printf("Downloaded: %d\n", downloaded)
 	fmt.Printf("Failed: %d\n", failed)
 	fmt.Printf("Skipped (404): %d\n", skipped)
+	if updateMode {
+		fmt.Printf("Updated: %d changed on the server and downloaded again, %d unchanged\n", replaced, unchanged-vanished)
+		if vanished > 0 {
+			fmt.Printf("No longer on the server (copy kept): %d\n", vanished)
+		}
+	}
+	if timedOut > 0 {
+		fmt.Printf("Timed out: %d transfers stalled or too slow\n", timedOut)
+	}
 	fmt.Printf("Total size: %.2f GB\n", float64(totalBytes)/1024/1024/1024)
 	if elapsed.Seconds() > 0 {
 		fmt.Printf("Speed: %.1f files/sec (%.1f total/sec)\n",
 			float64(downloaded)/elapsed.Seconds(),
-			float64(downloaded+skipped+failed)/elapsed.Seconds())
+			float64(downloaded+skipped+failed+unchanged)/elapsed.Seconds())
+	}
+	limit, _, limited, cuts := limiter.stats()
+	fmt.Printf("Rate limited (429): %d, concurrency lowered %d times, ending at %d\n", limited, cuts, limit)
+	if refreshCookies != nil {
+		fmt.Printf("Cookie refreshes: %d\n", refreshCookies.refreshes)
+	}
+	if claims != nil {
+		taken, stolen := claims.stats()
+		fmt.Printf("Ranges: %d claimed, %d of them taken over from other instances\n", taken, stolen)
+	}
+	if proxies != nil {
+		total, out, quarantined := proxies.stats()
+		fmt.Printf("Proxies: %d, %d quarantined now, %d quarantines\n", total, out, quarantined)
+	}
+	if len(datasets) > 1 {
+		for _, ds := range datasets {
+			fmt.Printf("  %s: %d downloaded, %d not found, %d failed\n", ds.name(), ds.downloaded, ds.skipped, ds.failed)
+		}
+	}
+	for _, ds := range datasets {
+		if n := failedLists[ds]; n > 0 {
+			fmt.Printf("Failed files listed in %s: %d (retry with -retry-failed)\n", filepath.Join(ds.dir, failedFile), n)
+		}
+	}
+	for _, ds := range datasets {
+		fileLog.Info("dataset finished", "event", "DATASET", "dataset", ds.name(),
+			"downloaded", ds.downloaded, "not_found", ds.skipped, "failed", ds.failed, "failed_listed", failedLists[ds])
+	}
+	fileLog.Info("run finished", "event", "DONE", "interrupted", stopCtx.Err() != nil, "elapsed_seconds", elapsed.Seconds(),
+		"downloaded", downloaded, "failed", failed, "not_found", skipped, "bytes", totalBytes, "replaced", replaced, "unchanged", unchanged,
+		"rate_limited", limited, "concurrency_cuts", cuts, "concurrency", limit)
+
+	if stopCtx.Err() != nil {
+		printResumeSummary()
+		os.Exit(130)
 	}
 
 	// Debug info
@@ -196,7 +683,7 @@ func main() {
 
 	// Test request with full debug
 	fmt.Println("\n--- TEST REQUEST (with headers) ---")
-	testURL := buildURL(dataset, fmt.Sprintf("EFTA%08d.pdf", startNum))
+	testURL := buildURL(datasets[0].Path, fmt.Sprintf("EFTA%08d.pdf", datasets[0].Start))
 	fmt.Printf("Testing: %s\n", testURL.String())
 
 	testReq := &http.Request{
@@ -204,8 +691,8 @@ func main() {
 		URL:    testURL,
 		Header: make(http.Header),
 	}
-	testReq.Header.Set("Cookie", fmt.Sprintf("ak_bmsc=%s; justiceGovAgeVerified=%s; QueueITAccepted-SDFrts345E-V3_usdojfiles=%s",
-		akBmsc, ageVerified, queueIT))
+	cookieHeader, _ := cookies.header()
+	testReq.Header.Set("Cookie", cookieHeader)
 	testReq.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
 	testReq.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
 	testReq.Header.Set("Accept-Language", "en-US,en;q=0.5")
@@ -221,7 +708,8 @@ func main() {
 	}
 
 	testClient := &http.Client{
-		Timeout: 30 * time.Second,
+		Transport: proxies.pick().roundTripper(),
+		Timeout:   30 * time.Second,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			fmt.Printf("  -> Redirect to: %s\n", req.URL)
 			return nil // Follow redirects for test
@@ -241,22 +729,104 @@ func main() {
 	}
 }
 
-func worker(jobs <-chan int, wg *sync.WaitGroup) {
+func worker(jobs <-chan task, wg *sync.WaitGroup, act *activity) {
 	defer wg.Done()
 
+	// Transfers are timed by their progress instead (timeout.go)
 	client := &http.Client{
-		Transport: transport,
-		Timeout:   30 * time.Second,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
 		},
 	}
 
-	for num := range jobs {
-		downloadFile(client, num)
+	for t := range jobs {
+		// Once stopping, queued files stay pending for the next run
+		act.set("", stateWaiting)
+		if !limiter.acquire() {
+			continue
+		}
+		status, file, reason := downloadFile(client, t.ds, t.num, act)
+		limiter.release()
+		act.set("", stateIdle)
+		switch status {
+		case statusOK, statusUnchanged, statusGone:
+			state.recordOK(t.ds.Path, t.num, file)
+		default:
+			state.record(t.ds.Path, t.num, status, file.size, reason)
+		}
+		t.claim.finish()
+
+		switch status {
+		case statusOK:
+			atomic.AddInt64(&t.ds.downloaded, 1)
+		case statusMissing:
+			atomic.AddInt64(&t.ds.skipped, 1)
+		case statusFailed:
+			atomic.AddInt64(&t.ds.failed, 1)
+		}
 	}
 }
 
+// refreshSource is the cookie source the -refresh flags pick, or nil
+func refreshSource() (cookieSource, error) {
+	switch {
+	case refreshCmd != "":
+		return commandSource{command: refreshCmd}, nil
+	case refreshURL != "":
+		u, err := url.Parse(refreshURL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid -refresh-url %q", refreshURL)
+		}
+		return endpointSource{url: u}, nil
+	case refreshBrowser:
+		for _, script := range []string{"download_epstein_files.py", "../download_epstein_files.py"} {
+			if _, err := os.Stat(script); err == nil {
+				python := os.Getenv("PYTHON")
+				if python == "" {
+					python = "python"
+				}
+				return commandSource{command: fmt.Sprintf("%s %s --harvest-cookies -d %q -s %d", python, script, datasets[0].Path, datasets[0].Start)}, nil
+			}
+		}
+		return nil, fmt.Errorf("-refresh-browser needs download_epstein_files.py here or in the parent directory")
+	}
+	return nil, nil
+}
+
+// handleSignals returns the stop and abort contexts, cancelled by the first
+// and second SIGINT/SIGTERM
+func handleSignals() (context.Context, context.Context) {
+	stop, stopNow := context.WithCancel(context.Background())
+	abort, abortNow := context.WithCancel(context.Background())
+
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		logger.Info("Finishing downloads in progress; press Ctrl-C again to abort them", "event", "STOP")
+		stopNow()
+		<-sigs
+		logger.Info("Aborting downloads in progress; partial files are kept for resuming", "event", "STOP")
+		abortNow()
+	}()
+	return stop, abort
+}
+
+// printResumeSummary reports what an interrupted run left to do
+func printResumeSummary() {
+	total := int(atomic.LoadInt64(&planned))
+	finished := int(downloaded + failed + skipped + unchanged)
+	fmt.Println("\n--- RESUME ---")
+	fmt.Printf("Remaining: %d of %d files\n", total-finished, total)
+	if storeURL != "" {
+		fmt.Printf("Aborted mid-transfer: %d (uploads start over)\n", interrupted)
+	} else {
+		fmt.Printf("Aborted mid-transfer: %d (kept as .part)\n", interrupted)
+	}
+	fmt.Printf("Manifest: %s\n", manifestPath)
+	fmt.Println("Run the same command again to pick up where this run stopped")
+}
+
 func buildURL(dataset, filename string) *url.URL {
 	// Build URL and preserve raw encoding
 	rawURL := baseURL + dataset + filename
@@ -266,10 +836,15 @@ func buildURL(dataset, filename string) *url.URL {
 	return u
 }
 
-func downloadFile(client *http.Client, num int) {
+const userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36"
+
+// downloadFile fetches one PDF of ds and returns its manifest status, its
+// size and validators, and why when it failed
+func downloadFile(client *http.Client, ds *datasetSpec, num int, act *activity) (string, saved, string) {
 	filename := fmt.Sprintf("EFTA%08d.pdf", num)
-	fileURL := buildURL(dataset, filename)
-	fpath := filepath.Join(outputDir, filename)
+	fileURL := buildURL(ds.Path, filename)
+	fpath := pdfPath(ds, num)
+	cur, update := conditional(ds, num, fpath)
 
 	// Save for debug
 	lastMu.Lock()
@@ -283,120 +858,312 @@ func downloadFile(client *http.Client, num int) {
 		Header: make(http.Header),
 	}
 
-	req.Header.Set("Cookie", fmt.Sprintf("ak_bmsc=%s; justiceGovAgeVerified=%s; QueueITAccepted-SDFrts345E-V3_usdojfiles=%s",
-		akBmsc, ageVerified, queueIT))
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+	req.Header.Set("User-Agent", userAgent)
 	req.Header.Set("Connection", "keep-alive")
 
 	maxRetries := 3
-	for attempt := 0; attempt < maxRetries; attempt++ {
+	var reason string // of the last failed attempt
+	var tr *transfer  // the attempt's, timed by its progress
+	defer func() { tr.done() }()
+	for attempt := 0; attempt < maxRetries && abortCtx.Err() == nil; attempt++ {
+		tr.done()
+		tr = newTransfer()
+		req = req.WithContext(tr.ctx)
+
+		// What an interrupted attempt left, asked for the rest of
+		offset := store.partial(fpath)
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		} else {
+			req.Header.Del("Range")
+		}
+		// With -update the copy saved is only replaced if the server's has
+		// changed; with a partial copy, an earlier attempt found it has
+		req.Header.Del("If-None-Match")
+		req.Header.Del("If-Modified-Since")
+		if update && offset == 0 {
+			cur.set(req.Header)
+		}
+
+		// Another worker was told to back off, or is refreshing cookies
+		act.set(filename, stateRequest)
+		if d := limiter.pauseLeft(); d > 0 {
+			act.backoff(d)
+		}
+		refreshCookies.wait()
+		cookieHeader, generation := cookies.header()
+		req.Header.Set("Cookie", cookieHeader)
+
+		// Rotate proxies per request; the worker's client is its own
+		px := proxies.pick()
+		client.Transport = px.roundTripper()
+
+		act.set(filename, stateRequest)
+		sent := time.Now()
 		resp, err := client.Do(req)
 		if err != nil {
-			if verbose {
-				fmt.Printf("[RETRY] %s - attempt %d: %v\n", filename, attempt+1, err)
+			if abortCtx.Err() == nil {
+				limiter.observe(0, time.Since(sent))
+				proxies.failed(px, err)
 			}
-			time.Sleep(time.Duration(attempt+1) * 500 * time.Millisecond)
+			reason = err.Error()
+			logger.Debug(fmt.Sprintf("attempt %d: %v", attempt+1, err), "event", "RETRY", "file", filename, "attempt", attempt+1, "error", err)
+			act.backoff(time.Duration(attempt+1) * 500 * time.Millisecond)
 			continue
 		}
 
+		limiter.observe(resp.StatusCode, time.Since(sent))
+		if resp.StatusCode == http.StatusProxyAuthRequired {
+			proxies.failed(px, fmt.Errorf("proxy authentication required"))
+		} else {
+			proxies.ok(px)
+		}
+
 		// Save status for debug
 		lastMu.Lock()
 		lastStatus = resp.StatusCode
 		lastMu.Unlock()
 
 		switch resp.StatusCode {
-		case 200:
-			file, err := os.Create(fpath)
+		case 200, 206:
+			// A 200 means the server ignored the range: start over
+			resume := resp.StatusCode == 206 && offset > 0 &&
+				strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset))
+			if !resume {
+				offset = 0
+			}
+
+			// The hash and the PDF check see the whole file, resumed or not
+			sha, head := sha256.New(), &pdfHead{}
+			h := io.MultiWriter(sha, head)
+			file, err := store.create(fpath, resume, h)
 			if err != nil {
 				resp.Body.Close()
 				atomic.AddInt64(&failed, 1)
-				if verbose {
-					fmt.Printf("[FAIL] %s - create error: %v\n", filename, err)
-				}
-				return
+				logger.Debug(fmt.Sprintf("create error: %v", err), "event", "FAIL", "file", filename, "error", err)
+				return statusFailed, saved{}, fmt.Sprintf("create error: %v", err)
+			}
+			if resume {
+				logger.Debug(fmt.Sprintf("from byte %d", offset), "event", "RESUME", "file", filename, "offset", offset)
 			}
 
-			n, err := io.Copy(file, resp.Body)
-			file.Close()
+			act.set(filename, stateReceiving)
+			n, err := io.Copy(io.MultiWriter(file, h, act), bwLimit.reader(tr.body(resp.Body, resp.ContentLength)))
 			resp.Body.Close()
+			if err != nil {
+				// Keep what arrived; the next attempt asks for the rest
+				file.abort(true)
+				reason = fmt.Sprintf("interrupted after %d bytes: %s", offset+n, tr.reason(err))
+				logger.Debug(fmt.Sprintf("attempt %d: %s", attempt+1, reason), "event", "RETRY", "file", filename, "attempt", attempt+1, "bytes", offset+n, "error", err)
+				act.backoff(time.Duration(attempt+1) * 500 * time.Millisecond)
+				continue
+			}
+
+			// The site sometimes answers 200 with an HTML error page
+			if bad := checkHead(head.b); bad != "" {
+				file.abort(false)
+				reason = bad
+				if ct := resp.Header.Get("Content-Type"); ct != "" {
+					reason += " (" + ct + ")"
+				}
+				logger.Debug(reason+", retrying...", "event", "BAD", "file", filename, "attempt", attempt+1, "reason", reason)
+				act.backoff(time.Duration(attempt+1) * 500 * time.Millisecond)
+				continue
+			}
 
+			size := offset + n
+			sum := hex.EncodeToString(sha.Sum(nil))
+			err = file.commit()
+			if err == nil {
+				err = writeProvenance(fpath, fileURL.String(), sum, size, resp.Header)
+				if err == nil {
+					err = checksums.add(ds, pdfName(num), sum, size)
+				}
+			}
 			if err != nil {
-				os.Remove(fpath)
+				store.remove(fpath)
 				atomic.AddInt64(&failed, 1)
-				if verbose {
-					fmt.Printf("[FAIL] %s - write error: %v\n", filename, err)
-				}
-				return
+				logger.Debug(fmt.Sprintf("write error: %v", err), "event", "FAIL", "file", filename, "error", err)
+				return statusFailed, saved{}, fmt.Sprintf("write error: %v", err)
 			}
 
 			atomic.AddInt64(&downloaded, 1)
 			atomic.AddInt64(&totalBytes, n)
-			if verbose {
-				fmt.Printf("[OK] %s - %d bytes\n", filename, n)
+			if update {
+				atomic.AddInt64(&replaced, 1)
+				logger.Debug("changed on the server, replaced", "event", "UPDATED", "file", filename, "was_bytes", cur.size)
 			}
-			return
+			logger.Debug(fmt.Sprintf("%d bytes", size), "event", "OK", "file", filename, "bytes", size, "sha256", sum, "attempt", attempt+1)
+			return statusOK, savedFrom(size, resp.Header), ""
+
+		case 416:
+			// The partial file doesn't fit the server's copy; start over
+			resp.Body.Close()
+			store.dropPartial(fpath)
+			reason = "partial file rejected (416)"
+			logger.Debug("partial file rejected, restarting", "event", "416", "file", filename, "offset", offset)
+			continue
 
 		case 404:
 			resp.Body.Close()
-			atomic.AddInt64(&skipped, 1)
-			if verbose {
-				fmt.Printf("[404] %s - not found\n", filename)
+			if update {
+				atomic.AddInt64(&unchanged, 1)
+				atomic.AddInt64(&vanished, 1)
+				logger.Debug("404 now, keeping the copy saved", "event", "GONE", "file", filename)
+				return statusGone, cur, ""
 			}
-			return
+			atomic.AddInt64(&skipped, 1)
+			logger.Debug("not found", "event", "404", "file", filename)
+			return statusMissing, saved{}, ""
 
-		case 429:
+		case 429, 503:
+			wait, given := retryAfter(resp.Header)
 			resp.Body.Close()
-			if verbose {
-				fmt.Printf("[429] %s - rate limited, waiting...\n", filename)
+			reason = resp.Status
+			if resp.StatusCode == 503 && !given {
+				// Without Retry-After a 503 is just an error; retry as usual
+				logger.Debug("unavailable, retrying...", "event", "503", "file", filename, "attempt", attempt+1)
+				act.backoff(time.Duration(attempt+1) * 500 * time.Millisecond)
+				continue
 			}
-			time.Sleep(3 * time.Second)
+			limiter.pause(min(wait, maxPause))
+			wait += jitter(wait)
+			logger.Debug(fmt.Sprintf("rate limited, waiting %v...", wait.Round(time.Millisecond)), "event", strconv.Itoa(resp.StatusCode), "file", filename, "wait_ms", wait.Milliseconds())
+			act.backoff(wait)
 			continue
 
 		case 302:
 			resp.Body.Close()
-			fmt.Printf("\n[WARN] %s - 302 redirect, cookies may be expired!\n", filename)
+			cookies.markExpired(generation)
+			if refreshCookies.refresh(generation) {
+				continue
+			}
+			logger.Warn("302 redirect, cookies may be expired!", "event", "WARN", "file", filename)
 			atomic.AddInt64(&failed, 1)
-			return
+			return statusFailed, saved{}, "302 redirect, cookies expired"
+
+		case 304:
+			// Only -update's conditional requests are answered with one
+			if update {
+				resp.Body.Close()
+				atomic.AddInt64(&unchanged, 1)
+				logger.Debug("unchanged", "event", "304", "file", filename)
+				return statusUnchanged, cur.refresh(resp.Header), ""
+			}
+			fallthrough
 
 		default:
 			resp.Body.Close()
-			if verbose {
-				fmt.Printf("[%d] %s - unexpected status, retrying...\n", resp.StatusCode, filename)
-			}
-			time.Sleep(time.Duration(attempt+1) * 500 * time.Millisecond)
+			reason = resp.Status
+			logger.Debug("unexpected status, retrying...", "event", strconv.Itoa(resp.StatusCode), "file", filename, "attempt", attempt+1)
+			act.backoff(time.Duration(attempt+1) * 500 * time.Millisecond)
 			continue
 		}
 	}
 
+	// Aborted: the .part file stays and the file stays pending
+	if abortCtx.Err() != nil {
+		atomic.AddInt64(&interrupted, 1)
+		return statusPending, saved{}, ""
+	}
+
 	atomic.AddInt64(&failed, 1)
-	if verbose {
-		fmt.Printf("[FAIL] %s - max retries exceeded\n", filename)
+	logger.Debug("max retries exceeded: "+reason, "event", "FAIL", "file", filename, "reason", reason)
+	return statusFailed, saved{}, "max retries exceeded: " + reason
+}
+
+const (
+	defaultRetryAfter = 3 * time.Second // on a 429 without Retry-After
+	maxRetryAfter     = 5 * time.Minute
+	maxPause          = 5 * time.Second // of every worker, on a Retry-After
+)
+
+// retryAfter reads a 429 or 503's Retry-After, in seconds or as an HTTP
+// date, capped at maxRetryAfter; given is false when there is none
+func retryAfter(h http.Header) (wait time.Duration, given bool) {
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		wait, given = time.Duration(secs)*time.Second, true
+	} else if at, err := http.ParseTime(v); err == nil {
+		wait, given = max(time.Until(at), 0), true
+	} else {
+		wait = defaultRetryAfter
 	}
+	return min(wait, maxRetryAfter), given
 }
 
-func getExistingFiles() map[int]bool {
-	existing := make(map[int]bool)
-	files, err := os.ReadDir(outputDir)
-	if err != nil {
-		return existing
+// jitter spreads retries over up to a quarter of d, so workers told to
+// wait together don't all come back at once
+func jitter(d time.Duration) time.Duration {
+	if d < 4 {
+		return 0
 	}
+	return time.Duration(rand.Int63n(int64(d / 4)))
+}
 
-	for _, f := range files {
-		if f.IsDir() {
-			continue
+// sleep waits between retries, cut short when downloads are aborted
+func sleep(d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-abortCtx.Done():
+	}
+}
+
+// provenance is the sidecar written next to each PDF; populate_db.py records
+// it on the document so its chain of custody is visible in the API
+type provenance struct {
+	SourceURL       string            `json:"source_url"`
+	RetrievedAt     time.Time         `json:"retrieved_at"`
+	RetrievalTool   string            `json:"retrieval_tool"`
+	SHA256          string            `json:"sha256"`
+	SizeBytes       int64             `json:"size_bytes"`
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+}
+
+// retainedHeaders are the response headers kept in the sidecar: what the
+// server said about the file when it was downloaded. A resumed download
+// keeps the Content-Range and Content-Length of its last request.
+var retainedHeaders = []string{"Last-Modified", "ETag", "Content-Length", "Content-Range", "Content-Type", "Date"}
+
+func writeProvenance(pdfPath, sourceURL, sha string, size int64, header http.Header) error {
+	headers := make(map[string]string)
+	for _, name := range retainedHeaders {
+		if v := header.Get(name); v != "" {
+			headers[name] = v
 		}
+	}
+	data, _ := json.MarshalIndent(provenance{
+		SourceURL:       sourceURL,
+		RetrievedAt:     time.Now().UTC().Truncate(time.Second),
+		RetrievalTool:   "epstein-downloader (Go)",
+		SHA256:          sha,
+		SizeBytes:       size,
+		ResponseHeaders: headers,
+	}, "", "  ")
+	return store.writeFile(strings.TrimSuffix(pdfPath, ".pdf")+".provenance.json", data)
+}
+
+// getExistingFiles lists the PDFs already saved in dir and its shard
+// subdirectories, with their sizes; only needed to seed a new manifest.
+// Shards are listed whatever -shard is, so files saved either way count.
+func getExistingFiles(dir string) map[int]int64 {
+	existing := make(map[int]int64)
+	files, err := store.list(dir)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("listing existing files: %v", err))
+		return existing
+	}
+	for name, size := range files {
 		var num int
-		if _, err := fmt.Sscanf(f.Name(), "EFTA%08d.pdf", &num); err == nil {
-			info, err := f.Info()
-			if err == nil && info.Size() > 0 {
-				existing[num] = true
-			}
+		base := path.Base(name)
+		if _, err := fmt.Sscanf(base, "EFTA%08d.pdf", &num); err == nil && base == fmt.Sprintf("EFTA%08d.pdf", num) {
+			existing[num] = size
 		}
 	}
 	return existing
 }
 
-func progressReporter(total int, startTime time.Time, done chan bool) {
+func progressReporter(startTime time.Time, done chan bool) {
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
@@ -408,7 +1175,8 @@ func progressReporter(total int, startTime time.Time, done chan bool) {
 			d := atomic.LoadInt64(&downloaded)
 			f := atomic.LoadInt64(&failed)
 			s := atomic.LoadInt64(&skipped)
-			completed := d + f + s
+			completed := d + f + s + atomic.LoadInt64(&unchanged)
+			total := int(atomic.LoadInt64(&planned))
 			elapsed := time.Since(startTime).Seconds()
 
 			totalSpeed := float64(completed) / elapsed
@@ -419,8 +1187,10 @@ func progressReporter(total int, startTime time.Time, done chan bool) {
 				remaining = float64(total-int(completed)) / totalSpeed
 			}
 
-			fmt.Printf("\rProgress: %d/%d | OK: %d | 404: %d | Fail: %d | %.0f/sec (%.0f dl/sec) | ETA: %.0fs     ",
-				completed, total, d, s, f, totalSpeed, downloadSpeed, remaining)
+			limit, active, _, _ := limiter.stats()
+
+			printProgress("Progress: %d/%d | OK: %d | 404: %d | Fail: %d | %.0f/sec (%.0f dl/sec) | Workers: %d/%d | ETA: %.0fs     ",
+				completed, total, d, s, f, totalSpeed, downloadSpeed, active, limit, remaining)
 		}
 	}
 }
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// The manifest records each file's outcome in a small SQLite database, so
+// a restart knows what is left without listing millions of files in the
+// output directory. Files are keyed by dataset and number, so datasets
+// sharing a manifest don't shadow each other.
+
+// File states in the manifest
+const (
+	statusPending = "pending" // handed to a worker
+	statusOK      = "ok"
+	statusMissing = "404"
+	statusFailed  = "failed"
+)
+
+type fileState struct {
+	dataset string
+	num     int
+	status  string
+	size    int64
+	reason  string // why it failed
+	at      time.Time
+
+	// What the server sent with a download, for -update
+	etag, lastModified string
+}
+
+type manifest struct {
+	db      *sql.DB
+	updates chan fileState
+	done    chan error
+
+	stopped sync.Once
+	err     error // from the writer
+}
+
+func openManifest(path string) (*manifest, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_synchronous=NORMAL")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	if err := migrateManifest(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	m := &manifest{
+		db:      db,
+		updates: make(chan fileState, 1024),
+		done:    make(chan error, 1),
+	}
+	go m.writer()
+	return m, nil
+}
+
+// openManifestReadOnly opens an existing manifest without migrating or
+// writing it, for a dry run; with none at path it starts an empty one in
+// memory
+func openManifestReadOnly(path string) (*manifest, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return openManifest(":memory:")
+	}
+	// With no write-ahead log left over, nothing else has the manifest open
+	// and it can be read as immutable; otherwise SQLite needs its shared
+	// memory file even to read
+	dsn := "file:" + path + "?mode=ro"
+	if _, err := os.Stat(path + "-wal"); os.IsNotExist(err) {
+		dsn += "&immutable=1"
+	}
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	var columns int
+	err = db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('files') WHERE name IN ('dataset', 'reason')").Scan(&columns)
+	if err == nil && columns < 2 {
+		err = fmt.Errorf("%s predates this version; run once without -dry-run to upgrade it", path)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	m := &manifest{
+		db:      db,
+		updates: make(chan fileState),
+		done:    make(chan error, 1),
+	}
+	go m.writer()
+	return m, nil
+}
+
+const createFiles = `CREATE TABLE IF NOT EXISTS files (
+	dataset       TEXT NOT NULL,
+	num           INTEGER NOT NULL,
+	status        TEXT NOT NULL,
+	size_bytes    INTEGER NOT NULL DEFAULT 0,
+	reason        TEXT NOT NULL DEFAULT '',
+	etag          TEXT NOT NULL DEFAULT '',
+	last_modified TEXT NOT NULL DEFAULT '',
+	updated_at    TEXT NOT NULL,
+	PRIMARY KEY (dataset, num)
+)`
+
+// migrateManifest creates the files table, rekeying one from a manifest
+// that keyed files by number alone, and adds the columns later versions
+// keep to one from before them: the failure reason, and the validators
+// -update sends back
+func migrateManifest(db *sql.DB) error {
+	var keys int
+	err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('files') WHERE pk > 0").Scan(&keys)
+	if err != nil {
+		return err
+	}
+	switch keys {
+	case 0:
+		_, err := db.Exec(createFiles)
+		return err
+	case 1:
+		return rekeyManifest(db)
+	}
+
+	for _, column := range []string{"reason", "etag", "last_modified"} {
+		var n int
+		if err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('files') WHERE name = ?", column).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			if _, err := db.Exec("ALTER TABLE files ADD COLUMN " + column + " TEXT NOT NULL DEFAULT ''"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rekeyManifest moves files keyed by number alone into a files table keyed
+// by dataset and number
+func rekeyManifest(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range []string{
+		"ALTER TABLE files RENAME TO files_old",
+		createFiles,
+		"INSERT INTO files (dataset, num, status, size_bytes, updated_at) SELECT dataset, num, status, size_bytes, updated_at FROM files_old",
+		"DROP TABLE files_old",
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// empty reports whether nothing has been recorded for dataset yet
+func (m *manifest) empty(dataset string) (bool, error) {
+	var n int
+	err := m.db.QueryRow("SELECT COUNT(*) FROM (SELECT 1 FROM files WHERE dataset = ? LIMIT 1)", dataset).Scan(&n)
+	return n == 0, err
+}
+
+// count returns how many files, of every dataset, have status
+func (m *manifest) count(status string) (int, error) {
+	var n int
+	err := m.db.QueryRow("SELECT COUNT(*) FROM files WHERE status = ?", status).Scan(&n)
+	return n, err
+}
+
+// load returns the recorded status of each of dataset's files numbered
+// start to end
+func (m *manifest) load(dataset string, start, end int) (map[int]string, error) {
+	rows, err := m.db.Query("SELECT num, status FROM files WHERE dataset = ? AND num BETWEEN ? AND ?", dataset, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := make(map[int]string)
+	for rows.Next() {
+		var num int
+		var status string
+		if err := rows.Scan(&num, &status); err != nil {
+			return nil, err
+		}
+		states[num] = status
+	}
+	return states, rows.Err()
+}
+
+// saved returns what is recorded of dataset's downloaded files numbered
+// start to end, for -update
+func (m *manifest) saved(dataset string, start, end int) (map[int]saved, error) {
+	rows, err := m.db.Query("SELECT num, size_bytes, etag, last_modified, updated_at FROM files WHERE dataset = ? AND status = ? AND num BETWEEN ? AND ?",
+		dataset, statusOK, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := make(map[int]saved)
+	for rows.Next() {
+		var num int
+		var s saved
+		var at string
+		if err := rows.Scan(&num, &s.size, &s.etag, &s.lastModified, &at); err != nil {
+			return nil, err
+		}
+		s.recorded, _ = time.Parse(time.RFC3339, at)
+		files[num] = s
+	}
+	return files, rows.Err()
+}
+
+// failure is a file recorded as failed, and why
+type failure struct {
+	num    int
+	reason string
+}
+
+// failures returns dataset's files numbered start to end recorded as
+// failed, in order
+func (m *manifest) failures(dataset string, start, end int) ([]failure, error) {
+	rows, err := m.db.Query("SELECT num, reason FROM files WHERE dataset = ? AND status = ? AND num BETWEEN ? AND ? ORDER BY num",
+		dataset, statusFailed, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failed []failure
+	for rows.Next() {
+		var f failure
+		if err := rows.Scan(&f.num, &f.reason); err != nil {
+			return nil, err
+		}
+		failed = append(failed, f)
+	}
+	return failed, rows.Err()
+}
+
+// averageSize returns the average size of dataset's downloaded files, and
+// how many there are
+func (m *manifest) averageSize(dataset string) (int64, int64, error) {
+	var avg float64
+	var n int64
+	err := m.db.QueryRow("SELECT COALESCE(AVG(size_bytes), 0), COUNT(*) FROM files WHERE dataset = ? AND status = ? AND size_bytes > 0",
+		dataset, statusOK).Scan(&avg, &n)
+	return int64(avg), n, err
+}
+
+// seed records files of dataset already in its output directory, by number
+// and size, for a manifest created after earlier runs
+func (m *manifest) seed(dataset string, existing map[int]int64) error {
+	var states []fileState
+	now := time.Now()
+	for num, size := range existing {
+		states = append(states, fileState{dataset: dataset, num: num, status: statusOK, size: size, at: now})
+	}
+	return m.write(states)
+}
+
+// record queues a file's new state, with the reason when it failed; writes
+// are batched in the background
+func (m *manifest) record(dataset string, num int, status string, size int64, reason string) {
+	m.updates <- fileState{dataset: dataset, num: num, status: status, size: size, reason: reason, at: time.Now()}
+}
+
+// recordOK queues a downloaded file's state with the validators the server
+// sent for it
+func (m *manifest) recordOK(dataset string, num int, s saved) {
+	m.updates <- fileState{dataset: dataset, num: num, status: statusOK, size: s.size,
+		etag: s.etag, lastModified: s.lastModified, at: time.Now()}
+}
+
+// flush writes what is queued and stops the background writer, leaving the
+// database open for reading
+func (m *manifest) flush() error {
+	m.stopped.Do(func() {
+		close(m.updates)
+		m.err = <-m.done
+	})
+	return m.err
+}
+
+// close writes what is queued and closes the database
+func (m *manifest) close() error {
+	err := m.flush()
+	if cerr := m.db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writer commits queued states a batch at a time, at least every second
+func (m *manifest) writer() {
+	const batchSize = 500
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var batch []fileState
+	var firstErr error
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := m.write(batch); err != nil && firstErr == nil {
+			firstErr = err
+			logger.Warn(fmt.Sprintf("manifest write failed: %v", err))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case s, ok := <-m.updates:
+			if !ok {
+				flush()
+				m.done <- firstErr
+				return
+			}
+			if batch = append(batch, s); len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (m *manifest) write(states []fileState) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The validators describe the copy saved, so they change with it
+	stmt, err := tx.Prepare(`INSERT INTO files (dataset, num, status, size_bytes, reason, etag, last_modified, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(dataset, num) DO UPDATE SET
+			status = excluded.status,
+			size_bytes = excluded.size_bytes,
+			reason = excluded.reason,
+			etag = CASE WHEN excluded.status = 'ok' THEN excluded.etag ELSE etag END,
+			last_modified = CASE WHEN excluded.status = 'ok' THEN excluded.last_modified ELSE last_modified END,
+			updated_at = excluded.updated_at`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, s := range states {
+		if _, err := stmt.Exec(s.dataset, s.num, s.status, s.size, s.reason, s.etag, s.lastModified, s.at.UTC().Format(time.RFC3339)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
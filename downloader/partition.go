@@ -0,0 +1,489 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// -partition i/n splits the work between n instances run independently, on
+// one machine or several: every dataset's files are cut into ranges of
+// partitionRange files, and instance i takes the i-th of n runs of
+// consecutive ranges. Instances given the same datasets agree on the split
+// without talking to each other.
+//
+// With -claims, they also share a SQLite database in which each claims a
+// range before downloading it. An instance done with its own ranges takes
+// over ones the others haven't started, from the end of the partition with
+// the most left, so a fast instance helps out a slow one; a range whose
+// instance stopped sending heartbeats for claimLease is taken over too. The
+// claims are taken in transactions under SQLite's file locks, so two
+// instances never claim the same range at once. The database can be the
+// manifest when the instances share one.
+
+var (
+	partitionFlag string
+	claimsPath    string
+	parts         *partition
+	claims        *claimSet
+)
+
+const (
+	partitionRange = 1000 // files per range
+	claimLease     = 2 * time.Minute
+	claimBeat      = 30 * time.Second
+)
+
+// fileRange is one range of a dataset's files, first to last inclusive
+type fileRange struct {
+	ds          *datasetSpec
+	first, last int
+	home        int // instance whose partition it's in, 1-based
+}
+
+type partition struct {
+	self, of int
+	ranges   []fileRange
+	byDS     map[*datasetSpec][]int // indexes into ranges, by first file
+}
+
+// parsePartition reads "i/n"; "" gives nil
+func parsePartition(s string) (self, of int, err error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	a, b, ok := strings.Cut(s, "/")
+	self, err1 := strconv.Atoi(a)
+	of, err2 := strconv.Atoi(b)
+	if !ok || err1 != nil || err2 != nil || of < 1 || self < 1 || self > of {
+		return 0, 0, fmt.Errorf("invalid -partition %q, expected i/n with 1 <= i <= n, e.g. 2/4", s)
+	}
+	return self, of, nil
+}
+
+// newPartition cuts the datasets' files into ranges and deals them out to
+// of instances
+func newPartition(self, of int, specs []*datasetSpec) *partition {
+	p := &partition{self: self, of: of, byDS: make(map[*datasetSpec][]int)}
+	for _, ds := range specs {
+		nums := ds.files()
+		for i := 0; i < len(nums); i += partitionRange {
+			last := nums[min(i+partitionRange, len(nums))-1]
+			p.byDS[ds] = append(p.byDS[ds], len(p.ranges))
+			p.ranges = append(p.ranges, fileRange{ds: ds, first: nums[i], last: last})
+		}
+	}
+	for k := range p.ranges {
+		p.ranges[k].home = k*of/len(p.ranges) + 1
+	}
+	return p
+}
+
+// rangeOf is the index of the range holding num of ds, or -1
+func (p *partition) rangeOf(ds *datasetSpec, num int) int {
+	idx := p.byDS[ds]
+	i := sort.Search(len(idx), func(i int) bool { return p.ranges[idx[i]].last >= num })
+	if i == len(idx) || p.ranges[idx[i]].first > num {
+		return -1
+	}
+	return idx[i]
+}
+
+// home reports whether num of ds is in this instance's partition; true for
+// every file without -partition
+func (p *partition) home(ds *datasetSpec, num int) bool {
+	if p == nil {
+		return true
+	}
+	k := p.rangeOf(ds, num)
+	return k >= 0 && p.ranges[k].home == p.self
+}
+
+// mine keeps the files of work in this instance's partition
+func (p *partition) mine(work map[*datasetSpec][]int) map[*datasetSpec][]int {
+	kept := make(map[*datasetSpec][]int, len(work))
+	for ds, nums := range work {
+		for _, num := range nums {
+			if p.home(ds, num) {
+				kept[ds] = append(kept[ds], num)
+			}
+		}
+	}
+	return kept
+}
+
+// homeRanges counts the ranges in this instance's partition
+func (p *partition) homeRanges() int {
+	n := 0
+	for _, r := range p.ranges {
+		if r.home == p.self {
+			n++
+		}
+	}
+	return n
+}
+
+// fingerprint identifies the split, so instances splitting different work
+// can't share claims
+func (p *partition) fingerprint() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n", p.of)
+	for _, r := range p.ranges {
+		fmt.Fprintf(h, "%s %d %d\n", r.ds.Path, r.first, r.last)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Range states in the claims database
+const (
+	claimClaimed = "claimed"
+	claimDone    = "done"
+)
+
+// claimSet is this instance's view of the shared claims
+type claimSet struct {
+	db    *sql.DB
+	parts *partition
+	owner string // "i/n@host:pid"
+
+	mu      sync.Mutex
+	held    map[int]bool // ranges claimed and not done
+	taken   int          // ranges claimed
+	stolen  int          // of them, from other partitions
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// claim is a claimed range being downloaded. A nil claim, as every task has
+// without -claims, ignores finish.
+type claim struct {
+	set   *claimSet
+	index int
+	left  atomic.Int64 // files not yet finished
+}
+
+// finish counts one of the range's files done, marking the range done in
+// the database after the last
+func (c *claim) finish() {
+	if c == nil || c.left.Add(-1) != 0 {
+		return
+	}
+	c.set.done(c.index)
+}
+
+func openClaims(path string, p *partition) (*claimSet, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=30000&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	host, _ := os.Hostname()
+	c := &claimSet{
+		db:      db,
+		parts:   p,
+		owner:   fmt.Sprintf("%d/%d@%s:%d", p.self, p.of, host, os.Getpid()),
+		held:    make(map[int]bool),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if err := c.setup(fmt.Sprintf("%d/%d@%s:", p.self, p.of, host)); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("-claims %s: %w", path, err)
+	}
+	go c.heartbeat()
+	return c, nil
+}
+
+// setup creates the tables, checks the other instances split the same work
+// and gives up the claims an earlier run of this one left behind
+func (c *claimSet) setup(prefix string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS claims (
+			dataset   TEXT NOT NULL,
+			first     INTEGER NOT NULL,
+			owner     TEXT NOT NULL,
+			status    TEXT NOT NULL,
+			heartbeat TEXT NOT NULL,
+			PRIMARY KEY (dataset, first)
+		)`,
+		`CREATE TABLE IF NOT EXISTS claims_layout (fingerprint TEXT NOT NULL)`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	fingerprint := c.parts.fingerprint()
+	var stored string
+	switch err := tx.QueryRow("SELECT fingerprint FROM claims_layout").Scan(&stored); {
+	case err == sql.ErrNoRows:
+		if _, err := tx.Exec("INSERT INTO claims_layout (fingerprint) VALUES (?)", fingerprint); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case stored != fingerprint:
+		// Another split of the work: only once nothing works on it
+		var live int
+		err := tx.QueryRow("SELECT COUNT(*) FROM claims WHERE status = ? AND heartbeat > ?", claimClaimed, stamp(time.Now().Add(-claimLease))).Scan(&live)
+		if err != nil {
+			return err
+		}
+		if live > 0 {
+			return fmt.Errorf("%d ranges are claimed by instances given other datasets, ranges or -partition counts", live)
+		}
+		logger.Warn("The claims are for other datasets, ranges or -partition counts; starting them over", "event", "CLAIMS")
+		for _, stmt := range []string{"DELETE FROM claims", "DELETE FROM claims_layout"} {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec("INSERT INTO claims_layout (fingerprint) VALUES (?)", fingerprint); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec("DELETE FROM claims WHERE status = ? AND substr(owner, 1, ?) = ?", claimClaimed, len(prefix), prefix)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// next claims the next range to download: the first free one in this
+// instance's partition, or else one taken over from another; nil when
+// every range is claimed or done
+func (c *claimSet) next() (*fileRange, int, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	type row struct {
+		owner, status string
+		beat          string
+	}
+	rows, err := tx.Query("SELECT dataset, first, owner, status, heartbeat FROM claims")
+	if err != nil {
+		return nil, 0, err
+	}
+	recorded := make(map[string]row)
+	for rows.Next() {
+		var dataset string
+		var first int
+		var r row
+		if err := rows.Scan(&dataset, &first, &r.owner, &r.status, &r.beat); err != nil {
+			rows.Close()
+			return nil, 0, err
+		}
+		recorded[dataset+"\x00"+strconv.Itoa(first)] = r
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	expiry := stamp(time.Now().Add(-claimLease))
+	free := func(k int) (bool, bool) { // unclaimed, expired
+		r, ok := recorded[c.parts.ranges[k].ds.Path+"\x00"+strconv.Itoa(c.parts.ranges[k].first)]
+		if !ok {
+			return true, false
+		}
+		return false, r.status == claimClaimed && r.beat <= expiry
+	}
+
+	pick := -1
+	// Our own partition, in order
+	for k, r := range c.parts.ranges {
+		if unclaimed, expired := free(k); r.home == c.parts.self && (unclaimed || expired) {
+			pick = k
+			break
+		}
+	}
+	// The last free range of the partition with the most left
+	if pick < 0 {
+		left := make(map[int]int)
+		lastFree := make(map[int]int)
+		for k, r := range c.parts.ranges {
+			if unclaimed, _ := free(k); unclaimed {
+				left[r.home]++
+				lastFree[r.home] = k
+			}
+		}
+		most := 0
+		for home := 1; home <= c.parts.of; home++ {
+			if left[home] > most {
+				most, pick = left[home], lastFree[home]
+			}
+		}
+	}
+	// A range whose instance stopped
+	if pick < 0 {
+		for k := range c.parts.ranges {
+			if _, expired := free(k); expired {
+				pick = k
+				break
+			}
+		}
+	}
+	if pick < 0 {
+		return nil, 0, nil
+	}
+
+	r := &c.parts.ranges[pick]
+	_, err = tx.Exec(`INSERT INTO claims (dataset, first, owner, status, heartbeat) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(dataset, first) DO UPDATE SET owner = excluded.owner, status = excluded.status, heartbeat = excluded.heartbeat`,
+		r.ds.Path, r.first, c.owner, claimClaimed, stamp(time.Now()))
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, 0, err
+	}
+
+	c.mu.Lock()
+	c.held[pick] = true
+	c.taken++
+	if r.home != c.parts.self {
+		c.stolen++
+	}
+	c.mu.Unlock()
+	if r.home != c.parts.self {
+		logger.Info(fmt.Sprintf("Taking over EFTA%08d-EFTA%08d of %s from instance %d", r.first, r.last, r.ds.name(), r.home),
+			"event", "CLAIM", "dataset", r.ds.name(), "first", r.first, "last", r.last, "from", r.home)
+	}
+	return r, pick, nil
+}
+
+// done marks range k finished
+func (c *claimSet) done(k int) {
+	r := c.parts.ranges[k]
+	_, err := c.db.Exec("UPDATE claims SET status = ?, heartbeat = ? WHERE dataset = ? AND first = ? AND owner = ?",
+		claimDone, stamp(time.Now()), r.ds.Path, r.first, c.owner)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("claims: marking EFTA%08d-EFTA%08d done: %v", r.first, r.last, err))
+	}
+	c.mu.Lock()
+	delete(c.held, k)
+	c.mu.Unlock()
+}
+
+// heartbeat keeps this instance's claims from expiring while it runs
+func (c *claimSet) heartbeat() {
+	defer close(c.stopped)
+	ticker := time.NewTicker(claimBeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			_, err := c.db.Exec("UPDATE claims SET heartbeat = ? WHERE owner = ? AND status = ?", stamp(time.Now()), c.owner, claimClaimed)
+			if err != nil {
+				logger.Warn(fmt.Sprintf("claims heartbeat: %v", err))
+			}
+		}
+	}
+}
+
+// dispatch claims ranges one after another and feeds their files in work to
+// feed, until there are none left or feed returns false. A range with
+// nothing left to download here is marked done straight away.
+func (c *claimSet) dispatch(work map[*datasetSpec][]int, feed func(task) bool) error {
+	byRange := make(map[int][]int)
+	for ds, nums := range work {
+		for _, num := range nums {
+			if k := c.parts.rangeOf(ds, num); k >= 0 {
+				byRange[k] = append(byRange[k], num)
+			}
+		}
+	}
+
+	counted := make(map[int]bool) // ranges already in the planned total
+	for k, r := range c.parts.ranges {
+		if r.home == c.parts.self {
+			counted[k] = true
+		}
+	}
+	for stopCtx.Err() == nil {
+		r, k, err := c.next()
+		if err != nil {
+			return err
+		}
+		if r == nil {
+			return nil
+		}
+		nums := byRange[k]
+		if !counted[k] {
+			atomic.AddInt64(&planned, int64(len(nums)))
+		}
+		if len(nums) == 0 {
+			c.done(k)
+			continue
+		}
+		cl := &claim{set: c, index: k}
+		cl.left.Store(int64(len(nums)))
+		for _, num := range nums {
+			if !feed(task{ds: r.ds, num: num, claim: cl}) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// stats reports the ranges claimed, and how many of them were taken over
+// from other partitions
+func (c *claimSet) stats() (taken, stolen int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.taken, c.stolen
+}
+
+// close gives up the ranges not finished, for another instance or the next
+// run, and closes the database
+func (c *claimSet) close() error {
+	if c == nil {
+		return nil
+	}
+	close(c.stop)
+	<-c.stopped
+	c.mu.Lock()
+	var held []int
+	for k := range c.held {
+		held = append(held, k)
+	}
+	c.mu.Unlock()
+
+	var first error
+	for _, k := range held {
+		r := c.parts.ranges[k]
+		_, err := c.db.Exec("DELETE FROM claims WHERE dataset = ? AND first = ? AND owner = ? AND status = ?", r.ds.Path, r.first, c.owner, claimClaimed)
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	if err := c.db.Close(); err != nil && first == nil {
+		first = err
+	}
+	return first
+}
+
+func stamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Downloads can go through one proxy or rotate over a list, each with its own
+// transport so connections are pooled per proxy. A proxy that fails
+// maxProxyFailures requests in a row is quarantined, for a minute at first
+// and twice as long each time it fails again, up to quarantineMax.
+
+const (
+	maxProxyFailures = 3
+	quarantineMin    = time.Minute
+	quarantineMax    = 30 * time.Minute
+)
+
+type proxy struct {
+	url       *url.URL
+	transport *http.Transport
+
+	failures   int // in a row
+	quarantine time.Duration
+	until      time.Time // quarantined until
+}
+
+type proxyPool struct {
+	mu      sync.Mutex
+	proxies []*proxy
+	next    int
+
+	quarantined int64 // times a proxy was quarantined
+}
+
+// newProxyPool builds a transport per proxy URL
+func newProxyPool(urls []*url.URL) *proxyPool {
+	pool := &proxyPool{}
+	for _, u := range urls {
+		pool.proxies = append(pool.proxies, &proxy{url: u, transport: newTransport(http.ProxyURL(u))})
+	}
+	return pool
+}
+
+// pick returns the next proxy in turn that isn't quarantined, or the one
+// whose quarantine ends first when all are; nil without proxies
+func (p *proxyPool) pick() *proxy {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	var soonest *proxy
+	for i := range p.proxies {
+		px := p.proxies[(p.next+i)%len(p.proxies)]
+		if !now.Before(px.until) {
+			p.next = (p.next + i + 1) % len(p.proxies)
+			return px
+		}
+		if soonest == nil || px.until.Before(soonest.until) {
+			soonest = px
+		}
+	}
+	return soonest
+}
+
+// ok records a request that got through px
+func (p *proxyPool) ok(px *proxy) {
+	if px == nil {
+		return
+	}
+	p.mu.Lock()
+	px.failures = 0
+	px.quarantine = 0
+	p.mu.Unlock()
+}
+
+// failed records a request that px couldn't carry, quarantining it after
+// maxProxyFailures in a row
+func (p *proxyPool) failed(px *proxy, err error) {
+	if px == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if px.failures++; px.failures < maxProxyFailures {
+		return
+	}
+	px.quarantine = min(max(px.quarantine*2, quarantineMin), quarantineMax)
+	px.until = time.Now().Add(px.quarantine)
+	px.failures = 0
+	p.quarantined++
+	logger.Debug(fmt.Sprintf("%s quarantined for %v: %v", px.url.Redacted(), px.quarantine, err),
+		"event", "PROXY", "proxy", px.url.Redacted(), "quarantine_seconds", px.quarantine.Seconds(), "error", err)
+}
+
+// roundTripper is px's transport, or the shared direct one for a nil proxy
+func (px *proxy) roundTripper() http.RoundTripper {
+	if px == nil {
+		return transport
+	}
+	return px.transport
+}
+
+// stats returns the proxies in the pool, how many are quarantined now and
+// how many times one was quarantined
+func (p *proxyPool) stats() (total, out int, quarantined int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for _, px := range p.proxies {
+		if now.Before(px.until) {
+			out++
+		}
+	}
+	return len(p.proxies), out, p.quarantined
+}
+
+// loadProxies reads the -proxy list (comma-separated) and -proxy-file (one
+// per line, # for comments)
+func loadProxies(list, file string) ([]*url.URL, error) {
+	lines := strings.Split(list, ",")
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var urls []*url.URL
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, err := parseProxy(line)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+	return urls, nil
+}
+
+// parseProxy reads a proxy URL; without a scheme it is an HTTP proxy
+func parseProxy(s string) (*url.URL, error) {
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %v", s, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid proxy %q: scheme must be http, https or socks5", s)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: no host", s)
+	}
+	return u, nil
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// With -store s3://bucket/prefix (or gs://bucket/prefix) finished PDFs are
+// streamed to object storage instead of the output directory. A file is
+// held in memory until it reaches s3PartSize, then sent in parts with a
+// multipart upload, so nothing appears in the bucket before the whole file
+// has arrived and looks like a PDF. Uploads can't be resumed across
+// attempts: a cut-off transfer starts over.
+//
+// Requests are signed with AWS Signature Version 4, which GCS accepts on its
+// XML API with HMAC keys. Credentials come from the environment:
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN and
+// AWS_REGION (default us-east-1), or for gs:// GCS_HMAC_ACCESS_KEY and
+// GCS_HMAC_SECRET. S3_ENDPOINT points s3:// at another S3-compatible service
+// such as MinIO or R2, addressing buckets by path.
+
+// s3PartSize is the multipart upload part size; S3 requires all but the
+// last part to be at least 5 MiB
+const s3PartSize = 8 << 20
+
+const s3Timeout = 5 * time.Minute
+
+// objectStore saves files as objects under prefix
+type objectStore struct {
+	scheme    string // s3 or gs
+	bucket    string
+	prefix    string
+	root      string // local output directory the keys are relative to
+	base      *url.URL
+	hostStyle bool // bucket in the host name rather than the path
+
+	region, accessKey, secretKey, token string
+
+	client *http.Client
+}
+
+func newObjectStore(raw, root string) (*objectStore, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid -store %q, expected s3://bucket/prefix or gs://bucket/prefix", raw)
+	}
+	s := &objectStore{
+		scheme: u.Scheme,
+		bucket: u.Host,
+		prefix: strings.Trim(u.Path, "/"),
+		root:   root,
+		client: &http.Client{Timeout: s3Timeout},
+	}
+
+	endpoint := ""
+	switch u.Scheme {
+	case "s3":
+		s.region = firstEnv("AWS_REGION", "AWS_DEFAULT_REGION")
+		if s.region == "" {
+			s.region = "us-east-1"
+		}
+		s.accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		s.secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		s.token = os.Getenv("AWS_SESSION_TOKEN")
+		endpoint = os.Getenv("S3_ENDPOINT")
+		if endpoint == "" {
+			endpoint = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", s.bucket, s.region)
+			s.hostStyle = true
+		}
+	case "gs":
+		s.region = "auto"
+		s.accessKey = os.Getenv("GCS_HMAC_ACCESS_KEY")
+		s.secretKey = os.Getenv("GCS_HMAC_SECRET")
+		endpoint = "https://storage.googleapis.com"
+	default:
+		return nil, fmt.Errorf("invalid -store %q: scheme must be s3 or gs", raw)
+	}
+	if s.accessKey == "" || s.secretKey == "" {
+		if s.scheme == "gs" {
+			return nil, fmt.Errorf("-store %s needs GCS_HMAC_ACCESS_KEY and GCS_HMAC_SECRET", raw)
+		}
+		return nil, fmt.Errorf("-store %s needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY", raw)
+	}
+	if s.base, err = url.Parse(strings.TrimSuffix(endpoint, "/")); err != nil || s.base.Host == "" {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT %q", endpoint)
+	}
+	return s, nil
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// check lists one key, so bad credentials or a missing bucket are reported
+// before any download starts
+func (s *objectStore) check() error {
+	_, err := s.do(context.Background(), http.MethodGet, "", url.Values{"list-type": {"2"}, "max-keys": {"1"}, "prefix": {s.prefix}}, nil, nil)
+	return err
+}
+
+// key is the object key of a local output path
+func (s *objectStore) key(p string) string {
+	rel, err := filepath.Rel(s.root, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		// A dataset output outside -o keeps its own path
+		rel = strings.TrimPrefix(filepath.ToSlash(strings.TrimPrefix(p, filepath.VolumeName(p))), "/")
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == "." {
+		return s.prefix
+	}
+	if s.prefix == "" {
+		return rel
+	}
+	return s.prefix + "/" + rel
+}
+
+func (s *objectStore) partial(string) int64 { return 0 }
+
+func (s *objectStore) dropPartial(string) {}
+
+func (s *objectStore) create(p string, resume bool, h io.Writer) (fileWriter, error) {
+	return &objectWriter{s: s, key: s.key(p)}, nil
+}
+
+func (s *objectStore) writeFile(p string, data []byte) error {
+	_, err := s.do(context.Background(), http.MethodPut, s.key(p), nil, data, nil)
+	return err
+}
+
+func (s *objectStore) remove(p string) error {
+	_, err := s.do(context.Background(), http.MethodDelete, s.key(p), nil, nil, nil)
+	return err
+}
+
+func (s *objectStore) stat(p string) (int64, bool, error) {
+	resp, err := s.do(context.Background(), http.MethodHead, s.key(p), nil, nil, nil)
+	if err == errObjectNotFound {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return resp.size, true, nil
+}
+
+func (s *objectStore) readHead(p string, n int) ([]byte, error) {
+	header := http.Header{"Range": {fmt.Sprintf("bytes=0-%d", n-1)}}
+	resp, err := s.do(context.Background(), http.MethodGet, s.key(p), nil, nil, header)
+	if err == errObjectNotFound {
+		return nil, fmt.Errorf("%s not found in %s", path.Base(p), s)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp.body, nil
+}
+
+// list pages through the keys under dir. Only checked PDFs are ever
+// uploaded, so their content isn't read again.
+func (s *objectStore) list(dir string) (map[string]int64, error) {
+	prefix := s.key(dir)
+	if prefix != "" {
+		prefix += "/"
+	}
+	files := make(map[string]int64)
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		resp, err := s.do(context.Background(), http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Contents []struct {
+				Key  string
+				Size int64
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		if err := xml.Unmarshal(resp.body, &page); err != nil {
+			return nil, fmt.Errorf("list %s: %w", s, err)
+		}
+		for _, obj := range page.Contents {
+			name := strings.TrimPrefix(obj.Key, prefix)
+			shard, file := path.Split(name)
+			if strings.HasSuffix(file, ".pdf") && obj.Size > 0 && (shard == "" || isShardDir(strings.TrimSuffix(shard, "/"))) {
+				files[name] = obj.Size
+			}
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return files, nil
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+}
+
+func (s *objectStore) location(p string) string {
+	return fmt.Sprintf("%s://%s/%s", s.scheme, s.bucket, s.key(p))
+}
+
+func (s *objectStore) String() string {
+	if s.prefix == "" {
+		return fmt.Sprintf("%s://%s", s.scheme, s.bucket)
+	}
+	return fmt.Sprintf("%s://%s/%s", s.scheme, s.bucket, s.prefix)
+}
+
+// ============================================================================
+// UPLOADS
+// ============================================================================
+
+// objectWriter buffers a download and uploads it: whole on commit when it
+// is smaller than a part, otherwise part by part as the parts fill
+type objectWriter struct {
+	s        *objectStore
+	key      string
+	buf      []byte
+	uploadID string
+	etags    []string
+}
+
+func (w *objectWriter) Write(b []byte) (int, error) {
+	w.buf = append(w.buf, b...)
+	for len(w.buf) >= s3PartSize {
+		if err := w.uploadPart(w.buf[:s3PartSize]); err != nil {
+			return 0, err
+		}
+		w.buf = append(w.buf[:0], w.buf[s3PartSize:]...)
+	}
+	return len(b), nil
+}
+
+func (w *objectWriter) uploadPart(part []byte) error {
+	ctx := context.Background()
+	if w.uploadID == "" {
+		resp, err := w.s.do(ctx, http.MethodPost, w.key, url.Values{"uploads": {""}}, nil, nil)
+		if err != nil {
+			return err
+		}
+		var started struct{ UploadId string }
+		if err := xml.Unmarshal(resp.body, &started); err != nil || started.UploadId == "" {
+			return fmt.Errorf("start upload of %s: no upload ID in response", w.key)
+		}
+		w.uploadID = started.UploadId
+	}
+
+	query := url.Values{"partNumber": {strconv.Itoa(len(w.etags) + 1)}, "uploadId": {w.uploadID}}
+	resp, err := w.s.do(ctx, http.MethodPut, w.key, query, part, nil)
+	if err != nil {
+		return err
+	}
+	w.etags = append(w.etags, resp.header.Get("ETag"))
+	return nil
+}
+
+func (w *objectWriter) commit() error {
+	ctx := context.Background()
+	if w.uploadID == "" {
+		_, err := w.s.do(ctx, http.MethodPut, w.key, nil, w.buf, nil)
+		return err
+	}
+	if len(w.buf) > 0 {
+		if err := w.uploadPart(w.buf); err != nil {
+			w.abort(false)
+			return err
+		}
+	}
+
+	var list bytes.Buffer
+	list.WriteString("<CompleteMultipartUpload>")
+	for i, etag := range w.etags {
+		fmt.Fprintf(&list, "<Part><PartNumber>%d</PartNumber><ETag>%s</ETag></Part>", i+1, etag)
+	}
+	list.WriteString("</CompleteMultipartUpload>")
+	_, err := w.s.do(ctx, http.MethodPost, w.key, url.Values{"uploadId": {w.uploadID}}, list.Bytes(), nil)
+	if err != nil {
+		w.abort(false)
+	}
+	return err
+}
+
+// abort cancels the multipart upload, so the bucket doesn't keep (and bill
+// for) its parts; nothing can be kept to resume
+func (w *objectWriter) abort(keep bool) {
+	if w.uploadID != "" {
+		w.s.do(context.Background(), http.MethodDelete, w.key, url.Values{"uploadId": {w.uploadID}}, nil, nil)
+		w.uploadID = ""
+	}
+	w.buf = nil
+}
+
+// ============================================================================
+// REQUESTS
+// ============================================================================
+
+var errObjectNotFound = errors.New("object not found")
+
+type objectResponse struct {
+	header http.Header
+	body   []byte
+	size   int64 // Content-Length
+}
+
+// do sends a signed request for key (the bucket itself when empty) and
+// reads the response. A 404 for a missing object is errObjectNotFound; other
+// failures carry the service's error code.
+func (s *objectStore) do(ctx context.Context, method, key string, query url.Values, body []byte, header http.Header) (*objectResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, s3Timeout)
+	defer cancel()
+
+	u := *s.base
+	u.Path = "/" + key
+	if !s.hostStyle {
+		u.Path = strings.TrimSuffix("/"+s.bucket+"/"+key, "/")
+	}
+	u.RawPath = awsEscape(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.ContentLength = int64(len(body))
+	s.sign(req, u.RawPath, u.RawQuery, body)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// CompleteMultipartUpload can fail with a 200 and an error document
+	var failure struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}
+	xml.Unmarshal(data, &failure)
+	if resp.StatusCode == http.StatusNotFound && method != http.MethodPost && failure.Code != "NoSuchBucket" {
+		return nil, errObjectNotFound
+	}
+	if resp.StatusCode >= 300 || (method == http.MethodPost && failure.Code != "") {
+		what := strings.TrimSuffix(s.String()+"/"+strings.TrimPrefix(strings.TrimPrefix(key, s.prefix), "/"), "/")
+		if failure.Code != "" {
+			return nil, fmt.Errorf("%s %s: %s: %s %s", method, what, resp.Status, failure.Code, failure.Message)
+		}
+		return nil, fmt.Errorf("%s %s: %s", method, what, resp.Status)
+	}
+	return &objectResponse{header: resp.Header, body: data, size: resp.ContentLength}, nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header
+func (s *objectStore) sign(req *http.Request, escapedPath, rawQuery string, body []byte) {
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payload := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(payload[:])
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.token != "" {
+		req.Header.Set("X-Amz-Security-Token", s.token)
+	}
+
+	signed := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "range" {
+			signed[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(signed))
+	for name := range signed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + signed[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method, escapedPath, rawQuery, canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+	scope := day + "/" + s.region + "/s3/aws4_request"
+	digest := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(digest[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), day)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes query sorted by name, the form SigV4 signs
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		for _, v := range query[name] {
+			parts = append(parts, awsEscape(name, true)+"="+awsEscape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape percent-encodes everything but unreserved characters, and '/'
+// unless encodeSlash, as SigV4 requires
+func awsEscape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+)
+
+// With -shard N, each output directory holds subdirectories of N files each,
+// named for the file number divided by N, so EFTA00273456.pdf lands in
+// 000027/ with N = 10000. Millions of files in a single directory are slow
+// to list on most filesystems, and unusable in file managers.
+
+// pdfName is num's PDF path relative to its output directory, with forward
+// slashes
+func pdfName(num int) string {
+	name := fmt.Sprintf("EFTA%08d.pdf", num)
+	if shardSize > 0 {
+		return path.Join(shardName(num/shardSize), name)
+	}
+	return name
+}
+
+// pdfPath is where num's PDF of ds is saved
+func pdfPath(ds *datasetSpec, num int) string {
+	return filepath.Join(ds.dir, filepath.FromSlash(pdfName(num)))
+}
+
+func shardName(shard int) string {
+	return fmt.Sprintf("%06d", shard)
+}
+
+// isShardDir reports whether name is a shard subdirectory's name, so a
+// dataset listed in its own subdirectory of the output isn't mistaken for one
+func isShardDir(name string) bool {
+	if len(name) != 6 {
+		return false
+	}
+	for _, c := range name {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
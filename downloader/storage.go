@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Finished PDFs and their provenance sidecars go to a fileStore: the output
+// directory, or with -store an S3 or GCS bucket (s3.go). Paths are the local
+// paths a file would have under -o; an object store turns them into keys
+// under its prefix. The manifest, checksums.csv and failed.txt always stay
+// in the output directory.
+
+// fileStore saves downloaded files
+type fileStore interface {
+	// partial is the size of what an earlier attempt at path left to
+	// resume, 0 when there is nothing
+	partial(path string) int64
+	// create starts writing path. Resuming, it appends to the partial copy
+	// after feeding it to h, so a hash written to h covers the whole file.
+	create(path string, resume bool, h io.Writer) (fileWriter, error)
+	// dropPartial discards what an earlier attempt at path left
+	dropPartial(path string)
+	// writeFile saves a small file whole
+	writeFile(path string, data []byte) error
+	// remove deletes a saved file
+	remove(path string) error
+	// stat returns the size of a saved file, and false when there is none
+	stat(path string) (int64, bool, error)
+	// readHead returns up to n bytes from the start of a saved file
+	readHead(path string, n int) ([]byte, error)
+	// list returns the sizes of the PDFs saved in dir and its shard
+	// subdirectories, by slash-separated path relative to dir; only needed
+	// to seed a new manifest
+	list(dir string) (map[string]int64, error)
+	// location names where path is saved, for messages
+	location(path string) string
+	// String describes where files are saved, for the run header
+	String() string
+}
+
+// fileWriter receives one download. Nothing is visible under the file's
+// name until commit.
+type fileWriter interface {
+	io.Writer
+	commit() error
+	// abort stops writing; with keep, what was written stays for a later
+	// attempt to resume where the store can
+	abort(keep bool)
+}
+
+// openStore returns the object store named by raw (s3://bucket/prefix or
+// gs://bucket/prefix) with keys relative to root, or the output directory
+// itself when raw is empty
+func openStore(raw, root string) (fileStore, error) {
+	if raw == "" {
+		return localStore{}, nil
+	}
+	return newObjectStore(raw, root)
+}
+
+// pdfHead keeps the first bytes written through it, so a download can be
+// checked with checkHead before it is committed
+type pdfHead struct {
+	b []byte
+}
+
+func (p *pdfHead) Write(b []byte) (int, error) {
+	if need := 4 - len(p.b); need > 0 {
+		p.b = append(p.b, b[:min(need, len(b))]...)
+	}
+	return len(b), nil
+}
+
+// checkPDF returns why the saved file at path isn't a PDF, or "" when it
+// starts like one
+func checkPDF(path string) string {
+	head, err := store.readHead(path, 4)
+	if err != nil {
+		return err.Error()
+	}
+	return checkHead(head)
+}
+
+// checkHead returns why a file starting with head isn't a PDF, or ""
+func checkHead(head []byte) string {
+	switch {
+	case len(head) == 0:
+		return "empty response"
+	case string(head) != "%PDF":
+		return fmt.Sprintf("not a PDF, starts with %q", head)
+	}
+	return ""
+}
+
+// ============================================================================
+// OUTPUT DIRECTORY
+// ============================================================================
+
+// localStore saves files under their paths. In-progress data goes to a
+// .part file, renamed once complete, so an interrupted transfer resumes
+// from where it stopped.
+type localStore struct{}
+
+func (localStore) partial(path string) int64 {
+	if info, err := os.Stat(path + ".part"); err == nil {
+		return info.Size()
+	}
+	return 0
+}
+
+func (localStore) create(path string, resume bool, h io.Writer) (fileWriter, error) {
+	file, err := openPart(path+".part", resume, h)
+	if err != nil {
+		return nil, err
+	}
+	return &partFile{File: file, path: path}, nil
+}
+
+func (localStore) dropPartial(path string) {
+	os.Remove(path + ".part")
+}
+
+func (localStore) writeFile(path string, data []byte) error {
+	return os.WriteFile(path, data, 0644)
+}
+
+func (localStore) remove(path string) error {
+	return os.Remove(path)
+}
+
+func (localStore) stat(path string) (int64, bool, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return info.Size(), true, nil
+}
+
+func (localStore) readHead(path string, n int) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	head := make([]byte, n)
+	read, err := io.ReadFull(file, head)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return head[:read], err
+}
+
+// list skips .part files, which are resumed instead, and error pages saved
+// as PDFs by older runs, which are downloaded again
+func (s localStore) list(dir string) (map[string]int64, error) {
+	files := make(map[string]int64)
+	s.listDir(dir, "", files)
+	return files, nil
+}
+
+func (s localStore) listDir(dir, shard string, files map[string]int64) {
+	entries, err := os.ReadDir(filepath.Join(dir, shard))
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			if shard == "" && isShardDir(e.Name()) {
+				s.listDir(dir, e.Name(), files)
+			}
+			continue
+		}
+		if !strings.HasSuffix(e.Name(), ".pdf") {
+			continue
+		}
+		name := e.Name()
+		if shard != "" {
+			name = shard + "/" + name
+		}
+		info, err := e.Info()
+		if err == nil && info.Size() > 0 && checkPDF(filepath.Join(dir, filepath.FromSlash(name))) == "" {
+			files[name] = info.Size()
+		}
+	}
+}
+
+func (localStore) location(path string) string {
+	return path
+}
+
+func (localStore) String() string {
+	return "output directory"
+}
+
+// partFile is a download in progress in its .part file
+type partFile struct {
+	*os.File
+	path string
+}
+
+func (p *partFile) commit() error {
+	if err := p.Close(); err != nil {
+		return err
+	}
+	return os.Rename(p.Name(), p.path)
+}
+
+func (p *partFile) abort(keep bool) {
+	p.Close()
+	if !keep {
+		os.Remove(p.Name())
+	}
+}
+
+// openPart opens a download's .part file: appended to when resuming, after
+// feeding what is already there to h so the hash covers the whole file, or
+// truncated when starting over
+func openPart(path string, resume bool, h io.Writer) (*os.File, error) {
+	if !resume {
+		// With -shard its directory may be new
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		return os.Create(path)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(h, file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
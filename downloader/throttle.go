@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The throttle adapts how many of the -c workers may download at once,
+// AIMD-style: the limit grows by one after each window of successful
+// responses and halves on a 429, or drops by a quarter when response
+// latency climbs well above the best seen, so a rate-limited site gets
+// backed off instead of hammered. A Retry-After also pauses every worker's
+// next request for a moment, so the pool doesn't keep hitting the site
+// while it throttles us.
+
+const (
+	startLimit    = 10  // workers allowed in flight at first
+	latencyFactor = 2.0 // latency over this times the baseline counts as congestion
+)
+
+// Why workers are held back from starting new files
+const (
+	holdPaused = "paused" // -web's pause button
+	holdDisk   = "disk"   // free space under -min-free (disk.go)
+)
+
+type throttle struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	adaptive bool
+	limit    int // workers allowed in flight
+	max      int
+	active   int
+
+	latency   time.Duration // smoothed response latency
+	baseline  time.Duration // lowest smoothed latency, slowly forgotten
+	successes int           // since the limit last grew
+	lastCut   time.Time
+	pauseEnd  time.Time       // no requests are sent before this
+	held      map[string]bool // no new files start while there's a reason in it
+
+	limited int64 // 429s seen
+	cuts    int64 // times the limit was lowered
+}
+
+// newThrottle allows max workers in flight, starting lower when adaptive
+func newThrottle(max int, adaptive bool) *throttle {
+	t := &throttle{adaptive: adaptive, limit: max, max: max, held: make(map[string]bool)}
+	if adaptive && max > startLimit {
+		t.limit = startLimit
+	}
+	t.cond = sync.NewCond(&t.mu)
+
+	// Wake waiting workers so they see the stop
+	go func() {
+		<-stopCtx.Done()
+		t.cond.Broadcast()
+	}()
+	return t
+}
+
+// acquire waits for a slot; false once stopping, with no slot taken
+func (t *throttle) acquire() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for (t.active >= t.limit || len(t.held) > 0) && stopCtx.Err() == nil {
+		t.cond.Wait()
+	}
+	if stopCtx.Err() != nil {
+		return false
+	}
+	t.active++
+	return true
+}
+
+func (t *throttle) release() {
+	t.mu.Lock()
+	t.active--
+	t.mu.Unlock()
+	t.cond.Signal()
+}
+
+// observe adjusts the limit for a response's status and latency; status 0
+// is a request that failed outright, which counts as congestion
+func (t *throttle) observe(status int, latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if status == 429 {
+		t.limited++
+	}
+	if !t.adaptive {
+		return
+	}
+
+	switch {
+	case status == 429:
+		t.cut(t.limit/2, "rate limited")
+	case status == 0:
+		t.cut(t.limit*3/4, "request failed")
+	case status == 503:
+		t.cut(t.limit*3/4, "service unavailable")
+	default:
+		t.sample(latency)
+		if float64(t.latency) > latencyFactor*float64(t.baseline) {
+			t.cut(t.limit*3/4, fmt.Sprintf("latency %v", t.latency.Round(time.Millisecond)))
+			return
+		}
+		if t.successes++; t.successes >= t.limit && t.limit < t.max {
+			t.limit++
+			t.successes = 0
+			t.cond.Broadcast()
+		}
+	}
+}
+
+// sample folds a latency into the smoothed latency and the baseline; the
+// caller holds mu
+func (t *throttle) sample(latency time.Duration) {
+	if t.latency == 0 {
+		t.latency, t.baseline = latency, latency
+		return
+	}
+	t.latency += (latency - t.latency) / 5
+	if t.latency < t.baseline {
+		t.baseline = t.latency
+	} else {
+		t.baseline += (t.latency - t.baseline) / 100
+	}
+}
+
+// cut lowers the limit, at most once per smoothed latency (and at least a
+// second apart) so one burst of 429s counts once; the caller holds mu
+func (t *throttle) cut(limit int, reason string) {
+	if time.Since(t.lastCut) < max(t.latency, time.Second) {
+		return
+	}
+	limit = max(limit, 1)
+	if limit >= t.limit {
+		return
+	}
+	logger.Debug(fmt.Sprintf("%s: %d -> %d workers", reason, t.limit, limit), "event", "THROTTLE", "reason", reason, "from", t.limit, "to", limit)
+	t.limit = limit
+	t.successes = 0
+	t.lastCut = time.Now()
+	t.cuts++
+}
+
+// pause holds back every worker's next request for d
+func (t *throttle) pause(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if end := time.Now().Add(d); end.After(t.pauseEnd) {
+		t.pauseEnd = end
+	}
+}
+
+// pauseLeft is how long requests are still held back
+func (t *throttle) pauseLeft() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return time.Until(t.pauseEnd)
+}
+
+// hold stops workers starting new files, for reason, until every reason is
+// released; those in flight finish
+func (t *throttle) hold(reason string, held bool) {
+	t.mu.Lock()
+	if held {
+		t.held[reason] = true
+	} else {
+		delete(t.held, reason)
+	}
+	t.mu.Unlock()
+	t.cond.Broadcast()
+}
+
+// holding reports whether new files are held back for reason
+func (t *throttle) holding(reason string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.held[reason]
+}
+
+// stats returns the current limit, the workers in flight, 429s seen and
+// times the limit was lowered
+func (t *throttle) stats() (limit, active int, limited, cuts int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limit, t.active, t.limited, t.cuts
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Transfers are timed by their progress rather than by a flat limit, so a
+// large file arriving slowly isn't cut off while a small one that stopped
+// isn't left hanging. A transfer is abandoned when no bytes arrive for
+// -stall, or when it takes longer than its size allows at -min-rate (plus
+// transferGrace for a slow start). Either way what arrived is kept and the
+// next attempt asks for the rest. -stall also bounds the wait for the
+// response headers.
+
+var (
+	stallTimeout time.Duration
+	minRateFlag  string
+	minRate      int64 // bytes per second; 0 for no time limit
+
+	timedOut int64 // transfers abandoned as stalled or too slow
+)
+
+const transferGrace = time.Minute
+
+var (
+	errStalled = errors.New("stalled")
+	errTooSlow = errors.New("too slow")
+)
+
+// transfer is the context of one attempt at a file, cancelled when its body
+// stalls or runs out of time, or when downloads are aborted
+type transfer struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	timers []*time.Timer
+	stall  *time.Timer
+}
+
+func newTransfer() *transfer {
+	ctx, cancel := context.WithCancelCause(abortCtx)
+	return &transfer{ctx: ctx, cancel: cancel}
+}
+
+// body times r, the rest of a file of size bytes (-1 when unknown), from now
+func (t *transfer) body(r io.Reader, size int64) io.Reader {
+	if stallTimeout > 0 {
+		t.stall = time.AfterFunc(stallTimeout, func() { t.cancel(errStalled) })
+		t.timers = append(t.timers, t.stall)
+	}
+	if limit := transferLimit(size); limit > 0 {
+		t.timers = append(t.timers, time.AfterFunc(limit, func() { t.cancel(errTooSlow) }))
+	}
+	return &progressReader{r: r, t: t}
+}
+
+// done releases the attempt's context and timers
+func (t *transfer) done() {
+	if t == nil {
+		return
+	}
+	for _, timer := range t.timers {
+		timer.Stop()
+	}
+	t.cancel(nil)
+}
+
+// reason says why the transfer failed with err, counting it when it timed out
+func (t *transfer) reason(err error) string {
+	switch cause := context.Cause(t.ctx); cause {
+	case errStalled:
+		atomic.AddInt64(&timedOut, 1)
+		return fmt.Sprintf("stalled: nothing received for %v", stallTimeout)
+	case errTooSlow:
+		atomic.AddInt64(&timedOut, 1)
+		return fmt.Sprintf("too slow: under %s on average", formatRate(minRate))
+	}
+	return err.Error()
+}
+
+// transferLimit is how long size bytes may take, 0 for no limit. With -bw
+// the rate floor is at most a worker's share of it.
+func transferLimit(size int64) time.Duration {
+	rate := minRate
+	if bwLimit != nil {
+		rate = min(rate, int64(bwLimit.rate)/int64(max(concurrency, 1)))
+	}
+	if size < 0 || rate <= 0 {
+		return 0
+	}
+	return transferGrace + time.Duration(float64(size)/float64(rate)*float64(time.Second))
+}
+
+// describeTimeouts is the -stall and -min-rate settings, for the header
+func describeTimeouts() string {
+	var parts []string
+	if stallTimeout > 0 {
+		parts = append(parts, fmt.Sprintf("stalled after %v", stallTimeout))
+	}
+	if minRate > 0 {
+		parts = append(parts, fmt.Sprintf("too slow under %s", formatRate(minRate)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// progressReader puts the stall timer back on every read that brings bytes
+type progressReader struct {
+	r io.Reader
+	t *transfer
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 && p.t.stall != nil {
+		p.t.stall.Reset(stallTimeout)
+	}
+	return n, err
+}
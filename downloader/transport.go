@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The transport is tuned for many downloads from one host. The flags below
+// adjust it to the network and to how the DOJ's CDN behaves: some edges
+// serve HTTP/2 better than many HTTP/1.1 connections, some the reverse. With
+// -tls-sessions a shared cache lets new connections resume TLS sessions
+// instead of doing full handshakes. Every proxy's transport is built the
+// same way.
+
+var (
+	httpVersion    string
+	tlsSessions    int
+	idlePerHost    int
+	dialTimeout    time.Duration
+	keepAlive      time.Duration
+	tlsTimeout     time.Duration
+	readBufferFlag string
+	readBufferSize int
+	sessionCache   tls.ClientSessionCache
+)
+
+// checkTransportFlags validates the transport flags once they are parsed
+func checkTransportFlags() error {
+	if httpVersion != "1.1" && httpVersion != "2" {
+		return fmt.Errorf("-http must be 1.1 or 2, not %q", httpVersion)
+	}
+	if tlsSessions < 0 || idlePerHost < 0 {
+		return fmt.Errorf("-tls-sessions and -idle-per-host can't be negative")
+	}
+	size, err := parseBytes(readBufferFlag)
+	if err != nil {
+		return fmt.Errorf("-read-buffer: %v", err)
+	}
+	readBufferSize = int(size)
+	if tlsSessions > 0 {
+		sessionCache = tls.NewLRUClientSessionCache(tlsSessions)
+	}
+	return nil
+}
+
+// newTransport builds a transport tuned for connection reuse, through proxy
+// when it isn't nil
+func newTransport(proxy func(*http.Request) (*url.URL, error)) *http.Transport {
+	idle := idlePerHost
+	if idle == 0 {
+		idle = concurrency * 2
+	}
+	t := &http.Transport{
+		Proxy:                 proxy,
+		MaxIdleConns:          max(concurrency*2, idle),
+		MaxIdleConnsPerHost:   idle,
+		MaxConnsPerHost:       concurrency * 2,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   tlsTimeout,
+		ResponseHeaderTimeout: stallTimeout,
+		DisableCompression:    true,
+		ReadBufferSize:        readBufferSize,
+		TLSClientConfig:       &tls.Config{ClientSessionCache: sessionCache},
+		DialContext: (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: keepAlive,
+		}).DialContext,
+	}
+	if httpVersion == "2" {
+		t.ForceAttemptHTTP2 = true
+	} else {
+		// A non-nil empty map keeps HTTP/2 off whatever else is set
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return t
+}
+
+// describeTransport is the transport settings, for the header
+func describeTransport() string {
+	parts := []string{"HTTP/" + httpVersion}
+	if idlePerHost > 0 {
+		parts = append(parts, fmt.Sprintf("%d idle per host", idlePerHost))
+	}
+	if tlsSessions > 0 {
+		parts = append(parts, fmt.Sprintf("%d TLS sessions cached", tlsSessions))
+	}
+	if readBufferSize > 0 {
+		parts = append(parts, formatSize(int64(readBufferSize))+" read buffer")
+	}
+	parts = append(parts, fmt.Sprintf("dial %v, TLS handshake %v", dialTimeout, tlsTimeout))
+	return strings.Join(parts, ", ")
+}
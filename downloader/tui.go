@@ -0,0 +1,367 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// -tui replaces the progress line with a full-screen dashboard, redrawn
+// twice a second: totals and ETA, a graph of the download speed over the
+// last minutes, what each worker is doing, and the latest warnings and
+// failed attempts, which otherwise only show with -v. It needs a terminal;
+// without one the run falls back to the progress line.
+
+var (
+	tuiMode bool
+	dash    *dashboard
+)
+
+const (
+	tuiRefresh  = 500 * time.Millisecond
+	graphHeight = 6
+	logKeep     = 200 // lines of the event pane kept
+	workerWidth = 38  // of a worker's cell
+)
+
+// Worker states
+const (
+	stateIdle      = "idle"
+	stateWaiting   = "waiting" // for a slot from the throttle
+	stateRequest   = "request"
+	stateReceiving = "receiving"
+	stateBackoff   = "backoff"
+)
+
+// activity is what one worker is doing, for the dashboard. A nil activity,
+// as every worker has without -tui, ignores updates.
+type activity struct {
+	mu    sync.Mutex
+	file  string
+	state string
+	since time.Time
+	bytes atomic.Int64 // of the current attempt
+}
+
+func (a *activity) set(file, state string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	a.file, a.state, a.since = file, state, time.Now()
+	a.mu.Unlock()
+	if state != stateReceiving {
+		a.bytes.Store(0)
+	}
+}
+
+// backoff sleeps for d between attempts, showing the worker as backing off
+func (a *activity) backoff(d time.Duration) {
+	if a != nil {
+		a.mu.Lock()
+		file := a.file
+		a.mu.Unlock()
+		a.set(file, stateBackoff)
+	}
+	sleep(d)
+}
+
+// Write counts the bytes of the file being received
+func (a *activity) Write(p []byte) (int, error) {
+	if a != nil {
+		a.bytes.Add(int64(len(p)))
+	}
+	return len(p), nil
+}
+
+func (a *activity) snapshot() (file, state string, since time.Time, bytes int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file, a.state, a.since, a.bytes.Load()
+}
+
+type logLine struct {
+	at    time.Time
+	level slog.Level
+	text  string
+}
+
+type dashboard struct {
+	out     io.Writer
+	start   time.Time
+	workers []*activity
+
+	mu    sync.Mutex
+	lines []logLine
+	speed []float64 // bytes/sec, one a second, newest last
+
+	showing atomic.Bool
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// newDashboard sets up -tui for the given number of workers, or returns nil
+// when stdout isn't a terminal
+func newDashboard(workers int) *dashboard {
+	if _, _, ok := termSize(); !ok {
+		logger.Warn("-tui needs a terminal, showing the progress line instead")
+		return nil
+	}
+	enableANSI()
+	d := &dashboard{out: os.Stdout, workers: make([]*activity, workers)}
+	for i := range d.workers {
+		d.workers[i] = &activity{state: stateIdle, since: time.Now()}
+	}
+	return d
+}
+
+// worker returns worker i's activity, nil without a dashboard
+func (d *dashboard) worker(i int) *activity {
+	if d == nil {
+		return nil
+	}
+	return d.workers[i]
+}
+
+// run draws the dashboard on the alternate screen until close
+func (d *dashboard) run(start time.Time) {
+	d.start = start
+	d.stop, d.stopped = make(chan struct{}), make(chan struct{})
+	fmt.Fprint(d.out, "\x1b[?1049h\x1b[?25l")
+	d.showing.Store(true)
+
+	go func() {
+		defer close(d.stopped)
+		ticker := time.NewTicker(tuiRefresh)
+		defer ticker.Stop()
+		lastBytes, lastSample := int64(0), time.Now()
+		for {
+			select {
+			case <-d.stop:
+				return
+			case now := <-ticker.C:
+				if now.Sub(lastSample) >= time.Second {
+					b := atomic.LoadInt64(&totalBytes)
+					d.mu.Lock()
+					d.speed = append(d.speed, float64(b-lastBytes)/now.Sub(lastSample).Seconds())
+					if len(d.speed) > 1000 {
+						d.speed = d.speed[len(d.speed)-1000:]
+					}
+					d.mu.Unlock()
+					lastBytes, lastSample = b, now
+				}
+				d.draw()
+			}
+		}
+	}()
+}
+
+// visible reports whether the dashboard is on screen
+func (d *dashboard) visible() bool {
+	return d != nil && d.showing.Load()
+}
+
+// close leaves the alternate screen, so the final summary prints as usual
+func (d *dashboard) close() {
+	if d == nil || !d.showing.Swap(false) {
+		return
+	}
+	close(d.stop)
+	<-d.stopped
+	consoleMu.Lock()
+	fmt.Fprint(d.out, "\x1b[?25h\x1b[?1049l")
+	consoleMu.Unlock()
+}
+
+// add puts a log record in the event pane. Successful files, 404s and
+// resumes are left out unless -v, so the pane shows what went wrong.
+func (d *dashboard) add(level slog.Level, event, text string) {
+	if level <= slog.LevelDebug && !verbose && (event == "OK" || event == "404" || event == "RESUME") {
+		return
+	}
+	d.mu.Lock()
+	d.lines = append(d.lines, logLine{time.Now(), level, text})
+	if len(d.lines) > logKeep {
+		d.lines = d.lines[len(d.lines)-logKeep:]
+	}
+	d.mu.Unlock()
+}
+
+func (d *dashboard) draw() {
+	width, height, ok := termSize()
+	if !ok {
+		return
+	}
+	var b strings.Builder
+	n := 0 // lines drawn
+	line := func(format string, args ...any) {
+		b.WriteString(clip(fmt.Sprintf(format, args...), width))
+		b.WriteString("\x1b[K\r\n")
+		n++
+	}
+
+	dl := atomic.LoadInt64(&downloaded)
+	fl := atomic.LoadInt64(&failed)
+	sk := atomic.LoadInt64(&skipped)
+	completed := dl + fl + sk + atomic.LoadInt64(&unchanged)
+	total := atomic.LoadInt64(&planned)
+	elapsed := time.Since(d.start)
+	rate := float64(completed) / elapsed.Seconds()
+	eta := "-"
+	if rate > 0 {
+		eta = (time.Duration(float64(total-completed)/rate) * time.Second).String()
+	}
+	limit, active, limited, _ := limiter.stats()
+
+	d.mu.Lock()
+	speed := append([]float64(nil), d.speed...)
+	lines := append([]logLine(nil), d.lines...)
+	d.mu.Unlock()
+	current := 0.0
+	if len(speed) > 0 {
+		current = speed[len(speed)-1]
+	}
+
+	line("DOJ Epstein Files Downloader   elapsed %s   ETA %s", elapsed.Round(time.Second), eta)
+	pct := 0.0
+	if total > 0 {
+		pct = float64(completed) / float64(total)
+	}
+	barWidth := max(width-30, 10)
+	filled := min(int(pct*float64(barWidth)), barWidth)
+	line("%s%s %d/%d %.1f%%", strings.Repeat("█", filled), strings.Repeat("░", barWidth-filled), completed, total, pct*100)
+	line("OK %d   404 %d   Fail %d   %.1f files/sec   %s   %s total   Workers %d/%d   429s %d",
+		dl, sk, fl, rate, formatRate(int64(current)), formatSize(atomic.LoadInt64(&totalBytes)), active, limit, limited)
+	line("")
+
+	// Speed, one column a second, scaled to the peak on screen
+	if len(speed) > width-11 {
+		speed = speed[len(speed)-max(width-11, 1):]
+	}
+	peak := 0.0
+	for _, s := range speed {
+		peak = max(peak, s)
+	}
+	line("Speed, last %s", time.Duration(len(speed))*time.Second)
+	for r, row := range graph(speed, peak, graphHeight) {
+		label := ""
+		if r == 0 {
+			label = formatRate(int64(peak))
+		}
+		line("%10s %s", label, row)
+	}
+	line("")
+
+	// Workers in columns, busy ones first, in the space left after
+	// keeping a few lines for events
+	cols := max(width/workerWidth, 1)
+	rows := (len(d.workers) + cols - 1) / cols
+	rows = max(min(rows, height-n-8), 1)
+	type cell struct {
+		id   int
+		text string
+		busy bool
+	}
+	cells := make([]cell, 0, len(d.workers))
+	for i, a := range d.workers {
+		file, state, since, bytes := a.snapshot()
+		c := cell{id: i + 1, busy: state != stateIdle && state != stateWaiting, text: state}
+		age := time.Since(since).Round(time.Second)
+		switch {
+		case state == stateReceiving:
+			c.text = fmt.Sprintf("%s %9s %5s", strings.TrimSuffix(file, ".pdf"), formatSize(bytes), age)
+		case c.busy:
+			c.text = fmt.Sprintf("%s %-9s %5s", strings.TrimSuffix(file, ".pdf"), state, age)
+		}
+		cells = append(cells, c)
+	}
+	sort.SliceStable(cells, func(i, j int) bool {
+		return cells[i].busy && !cells[j].busy
+	})
+	shown := min(rows*cols, len(cells))
+	line("Workers, %d in flight", active)
+	for r := 0; r < rows; r++ {
+		var row strings.Builder
+		for c := 0; c < cols; c++ {
+			k := c*rows + r
+			if k >= shown {
+				break
+			}
+			text := fmt.Sprintf("%3d %s", cells[k].id, cells[k].text)
+			if k == shown-1 && shown < len(cells) {
+				text = fmt.Sprintf("    ... %d more", len(cells)-shown+1)
+			}
+			row.WriteString(pad(text, workerWidth))
+		}
+		line("%s", row.String())
+	}
+	line("")
+
+	// Events fill the rest of the screen, newest last
+	line("Events")
+	if room := height - n; len(lines) > room {
+		lines = lines[len(lines)-max(room, 0):]
+	}
+	for _, l := range lines {
+		text := clip(l.at.Format("15:04:05")+" "+l.text, width)
+		switch {
+		case l.level >= slog.LevelError:
+			text = "\x1b[31m" + text + "\x1b[0m"
+		case l.level >= slog.LevelWarn:
+			text = "\x1b[33m" + text + "\x1b[0m"
+		}
+		b.WriteString(text + "\x1b[K\r\n")
+	}
+
+	consoleMu.Lock()
+	defer consoleMu.Unlock()
+	if d.showing.Load() {
+		fmt.Fprint(d.out, "\x1b[H"+strings.TrimSuffix(b.String(), "\r\n")+"\x1b[J")
+	}
+}
+
+// graph draws values as columns of block characters, height rows tall with
+// eighths of a row, top row first
+func graph(values []float64, peak float64, height int) []string {
+	blocks := []rune(" ▁▂▃▄▅▆▇█")
+	rows := make([][]rune, height)
+	for r := range rows {
+		rows[r] = make([]rune, len(values))
+	}
+	for i, v := range values {
+		eighths := 0
+		if peak > 0 {
+			eighths = int(v/peak*float64(height*8) + 0.5)
+		}
+		for r := 0; r < height; r++ {
+			level := min(max(eighths-(height-1-r)*8, 0), 8)
+			rows[r][i] = blocks[level]
+		}
+	}
+	out := make([]string, height)
+	for r, row := range rows {
+		out[r] = string(row)
+	}
+	return out
+}
+
+// clip cuts s to width characters
+func clip(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:max(width, 0)])
+}
+
+// pad fills s out to width characters, clipping it if longer
+func pad(s string, width int) string {
+	s = clip(s, width-1)
+	return s + strings.Repeat(" ", width-utf8.RuneCountInString(s))
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32                   = syscall.NewLazyDLL("kernel32.dll")
+	getConsoleScreenBufferInfo = kernel32.NewProc("GetConsoleScreenBufferInfo")
+	getConsoleMode             = kernel32.NewProc("GetConsoleMode")
+	setConsoleMode             = kernel32.NewProc("SetConsoleMode")
+)
+
+const enableVirtualTerminalProcessing = 0x0004
+
+type consoleScreenBufferInfo struct {
+	size, cursor             struct{ X, Y int16 }
+	attributes               uint16
+	left, top, right, bottom int16
+	maxSize                  struct{ X, Y int16 }
+}
+
+// termSize is the console window's size in characters; ok is false when
+// stdout isn't a console
+func termSize() (width, height int, ok bool) {
+	var info consoleScreenBufferInfo
+	r, _, _ := getConsoleScreenBufferInfo.Call(os.Stdout.Fd(), uintptr(unsafe.Pointer(&info)))
+	if r == 0 {
+		return 0, 0, false
+	}
+	return int(info.right-info.left) + 1, int(info.bottom-info.top) + 1, true
+}
+
+// enableANSI turns on escape code handling, off by default in Windows
+// consoles
+func enableANSI() {
+	var mode uint32
+	if r, _, _ := getConsoleMode.Call(os.Stdout.Fd(), uintptr(unsafe.Pointer(&mode))); r != 0 {
+		setConsoleMode.Call(os.Stdout.Fd(), uintptr(mode|enableVirtualTerminalProcessing))
+	}
+}
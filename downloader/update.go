@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// -update asks again for the files already downloaded, as conditional
+// requests: If-None-Match with the ETag and If-Modified-Since with the
+// Last-Modified the server sent with each, so only files the DOJ has
+// replaced since are downloaded again. The manifest keeps both for files
+// downloaded by this version; for older ones they come from the provenance
+// sidecar, and failing that If-Modified-Since is when the manifest recorded
+// the file. A 304 leaves the copy as it is, and so does a 404: a file taken
+// down is kept.
+
+var (
+	updateMode bool
+
+	unchanged int64 // -update: left as they are, 304 or 404 now
+	vanished  int64 // of those, 404 now
+	replaced  int64 // -update: changed on the server and downloaded again
+)
+
+// Outcomes of -update that leave the copy as it is; the manifest keeps the
+// file as statusOK
+const (
+	statusUnchanged = "unchanged" // 304
+	statusGone      = "gone"      // 404 now
+)
+
+// saved is what the manifest knows of a file already downloaded
+type saved struct {
+	size         int64
+	etag         string
+	lastModified string
+	recorded     time.Time
+}
+
+// savedFrom reads what the server said about a download from its headers
+func savedFrom(size int64, h http.Header) saved {
+	return saved{size: size, etag: h.Get("ETag"), lastModified: h.Get("Last-Modified")}
+}
+
+// conditional is what to send for the copy of ds's file num at fpath, with
+// the validators from its provenance sidecar when the manifest has none.
+// False when ds has no copy of it.
+func conditional(ds *datasetSpec, num int, fpath string) (saved, bool) {
+	s, ok := ds.saved[num]
+	if !ok || s.etag != "" || s.lastModified != "" {
+		return s, ok
+	}
+	if data, err := store.readHead(strings.TrimSuffix(fpath, ".pdf")+".provenance.json", 64<<10); err == nil {
+		var p provenance
+		if json.Unmarshal(data, &p) == nil {
+			s.etag, s.lastModified = p.ResponseHeaders["ETag"], p.ResponseHeaders["Last-Modified"]
+		}
+	}
+	return s, true
+}
+
+// set adds the conditional headers to req
+func (s saved) set(h http.Header) {
+	if s.etag != "" {
+		h.Set("If-None-Match", s.etag)
+	}
+	switch {
+	case s.lastModified != "":
+		h.Set("If-Modified-Since", s.lastModified)
+	case s.etag == "" && !s.recorded.IsZero():
+		h.Set("If-Modified-Since", s.recorded.UTC().Format(http.TimeFormat))
+	}
+}
+
+// refresh takes the validators a 304 sends, which describe the same file
+func (s saved) refresh(h http.Header) saved {
+	if v := h.Get("ETag"); v != "" {
+		s.etag = v
+	}
+	if v := h.Get("Last-Modified"); v != "" {
+		s.lastModified = v
+	}
+	return s
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A verify pass checks the files the manifest has as downloaded before the
+// run starts, for after a crash or a full disk. A file missing from disk,
+// empty or not a PDF is downloaded again straight away; the rest are asked
+// for with a HEAD request, and downloaded again when their size on disk
+// differs from the Content-Length. Files the server gives no length for, or
+// doesn't answer for, are left as they are.
+
+// verifyStats are the verify pass results over every dataset
+type verifyStats struct {
+	checked, matched, requeued int64
+	unknown                    int64 // no Content-Length, or no answer
+	gone                       int64 // 404 now; kept
+}
+
+// verifyFiles checks tasks, files recorded as downloaded, and returns those
+// to download again. Each is recorded as failed with the reason, so it is
+// retried by -retry-failed should this run not get to it; a dry run records
+// nothing.
+func verifyFiles(tasks []task) []task {
+	var (
+		stats   verifyStats
+		mu      sync.Mutex
+		requeue []task
+	)
+	bad := func(t task, reason string) {
+		atomic.AddInt64(&stats.requeued, 1)
+		logger.Debug(reason+", downloading again", "event", "VERIFY", "file", fmt.Sprintf("EFTA%08d.pdf", t.num), "reason", reason)
+		if !dryRunMode {
+			state.record(t.ds.Path, t.num, statusFailed, 0, reason)
+		}
+		mu.Lock()
+		requeue = append(requeue, t)
+		mu.Unlock()
+	}
+
+	startTime := time.Now()
+	jobs := make(chan task, concurrency*2)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client := newProbeClient()
+			for t := range jobs {
+				path := pdfPath(t.ds, t.num)
+				stored, found, err := store.stat(path)
+				if err != nil {
+					atomic.AddInt64(&stats.checked, 1)
+					atomic.AddInt64(&stats.unknown, 1)
+					logger.Debug(err.Error(), "event", "VERIFY", "file", fmt.Sprintf("EFTA%08d.pdf", t.num), "error", err)
+					continue
+				}
+				if !found {
+					atomic.AddInt64(&stats.checked, 1)
+					bad(t, "missing from "+store.String())
+					continue
+				}
+				if reason := checkPDF(path); reason != "" {
+					atomic.AddInt64(&stats.checked, 1)
+					bad(t, reason)
+					continue
+				}
+
+				if !limiter.acquire() {
+					continue
+				}
+				status, size := headFile(client, t.ds, t.num)
+				limiter.release()
+				if status == statusPending {
+					continue // aborted
+				}
+
+				atomic.AddInt64(&stats.checked, 1)
+				switch {
+				case status == statusMissing:
+					atomic.AddInt64(&stats.gone, 1)
+					logger.Debug("404 now, keeping the copy on disk", "event", "VERIFY", "file", fmt.Sprintf("EFTA%08d.pdf", t.num))
+				case status != statusOK || size < 0:
+					atomic.AddInt64(&stats.unknown, 1)
+				case size != stored:
+					bad(t, fmt.Sprintf("size mismatch: %d bytes on disk, %d on the server", stored, size))
+				default:
+					atomic.AddInt64(&stats.matched, 1)
+				}
+			}
+		}()
+	}
+
+	done := make(chan bool)
+	if !verbose {
+		go func() {
+			ticker := time.NewTicker(time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					printProgress("Verifying: %d/%d | OK: %d | Requeued: %d | Unknown: %d     ",
+						atomic.LoadInt64(&stats.checked), len(tasks), atomic.LoadInt64(&stats.matched),
+						atomic.LoadInt64(&stats.requeued), atomic.LoadInt64(&stats.unknown))
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for _, t := range tasks {
+		select {
+		case jobs <- t:
+		case <-stopCtx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if !verbose {
+		done <- true
+	}
+
+	fmt.Println("\n========================================")
+	if stopCtx.Err() != nil {
+		fmt.Println("VERIFY INTERRUPTED")
+	} else {
+		fmt.Println("VERIFY")
+	}
+	fmt.Println("========================================")
+	fmt.Printf("Time: %v\n", time.Since(startTime).Round(time.Second))
+	fmt.Printf("Checked: %d of %d\n", stats.checked, len(tasks))
+	fmt.Printf("Matching: %d\n", stats.matched)
+	fmt.Printf("To download again: %d\n", stats.requeued)
+	fmt.Printf("Unknown size (kept): %d\n", stats.unknown)
+	if stats.gone > 0 {
+		fmt.Printf("Not found now (kept): %d\n", stats.gone)
+	}
+	sort.Slice(requeue, func(i, j int) bool { return requeue[i].num < requeue[j].num })
+	return requeue
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// With -watch the downloader keeps running and sweeps the range again every
+// -watch, to pick up files published since. Each sweep is a run of this same
+// program with the same flags, so it starts clean, resumes from the manifest
+// like any other run and prints its own summary. Sweeps ask again for the
+// files recorded as 404, as that is how newly published files show up. A
+// sweep that downloads nothing new doubles the wait before the next, up to
+// -watch-max; one that does brings it back to -watch.
+
+var (
+	watchEvery time.Duration
+	watchMax   time.Duration
+)
+
+// watchSweep marks the environment of a sweep started by watch, which runs
+// once instead of watching too
+const watchSweep = "DOWNLOADER_WATCH_SWEEP"
+
+// watching reports whether this process is the one doing the watching
+func watching() bool {
+	return watchEvery > 0 && os.Getenv(watchSweep) == ""
+}
+
+// watch runs sweeps until a signal stops it, and returns the exit status. A
+// signal reaches the sweep in progress too (Ctrl-C goes to the whole process
+// group, and a service manager signals every process of the service), which
+// stops as usual; watch then exits with its status. The first sweep failing
+// ends the watch, as that is most likely a flag or cookie problem; a later
+// one is tried again at the next sweep.
+func watch() int {
+	if dryRunMode || offline {
+		fatal("-watch downloads what gets published, so it can't be used with -dry-run or -offline")
+	}
+	if watchMax == 0 {
+		watchMax = 8 * watchEvery
+	}
+	watchMax = max(watchMax, watchEvery)
+	exe, err := os.Executable()
+	if err != nil {
+		fatal("-watch: %v", err)
+	}
+	manifest := manifestPath
+	if manifest == "" {
+		manifest = filepath.Join(outputDir, "download_manifest.db")
+	}
+
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	// The sweep takes the usual recheck of 404s first, so a -recheck-404
+	// given explicitly still wins
+	args := append([]string{"-recheck-404"}, os.Args[1:]...)
+
+	idle := 0
+	for sweep := 1; ; sweep++ {
+		before := downloadedFiles(manifest)
+		logger.Info(fmt.Sprintf("Sweep %d starting", sweep), "event", "WATCH", "sweep", sweep)
+		cmd := exec.Command(exe, args...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		cmd.Env = append(os.Environ(), watchSweep+"=1")
+		if err := cmd.Start(); err != nil {
+			fatal("-watch: starting sweep: %v", err)
+		}
+		stopped := false
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+		for waiting := true; waiting; {
+			select {
+			case <-sigs:
+				stopped = true // the sweep got it too
+			case err = <-done:
+				waiting = false
+			}
+		}
+
+		code := 0
+		var exit *exec.ExitError
+		if errors.As(err, &exit) {
+			code = exit.ExitCode()
+		} else if err != nil {
+			code = 1
+		}
+		if stopped || code == 130 {
+			return 130
+		}
+		if code != 0 && sweep == 1 {
+			return code
+		}
+
+		found := downloadedFiles(manifest) - before
+		if found > 0 {
+			idle = 0
+		} else {
+			idle++
+		}
+		wait := watchEvery
+		for i := 0; i < idle && wait < watchMax; i++ {
+			wait *= 2
+		}
+		wait = min(wait, watchMax)
+		next := time.Now().Add(wait)
+		msg := fmt.Sprintf("Sweep %d found %d new files; next sweep in %v, at %s", sweep, found, wait, next.Format("2006-01-02 15:04"))
+		if code != 0 {
+			msg = fmt.Sprintf("Sweep %d failed with status %d after %d new files; next sweep in %v, at %s", sweep, code, found, wait, next.Format("2006-01-02 15:04"))
+		}
+		logger.Info(msg, "event", "WATCH", "sweep", sweep, "new", found, "status", code, "wait_seconds", wait.Seconds())
+
+		select {
+		case <-sigs:
+			logger.Info("Watch stopped", "event", "STOP")
+			return 130
+		case <-time.After(wait):
+		}
+	}
+}
+
+// downloadedFiles counts the files the manifest at path has as downloaded,
+// 0 when there is none yet
+func downloadedFiles(path string) int {
+	m, err := openManifestReadOnly(path)
+	if err != nil {
+		return 0
+	}
+	defer m.close()
+	n, err := m.count(statusOK)
+	if err != nil {
+		return 0
+	}
+	return n
+}
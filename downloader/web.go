@@ -0,0 +1,330 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// -web serves a page with the run's progress, its latest failures and the
+// state of the cookies, and buttons to pause and resume it, so a run on a
+// headless server can be watched from a browser. Pausing holds back new
+// files; those in flight finish. With -web-token set, the page and its API
+// need ?token= (the page passes it on) or "Authorization: Bearer <token>".
+// Without one it only listens on loopback, and answers requests naming a
+// loopback host, so another site can't reach it through DNS rebinding.
+// Pause and resume are refused from a page of another origin.
+
+var (
+	webAddr  string
+	webToken string
+	web      *webServer
+)
+
+const webKeep = 100 // failures kept for the page
+
+type webEvent struct {
+	At    time.Time `json:"at"`
+	Level string    `json:"level"`
+	Event string    `json:"event,omitempty"`
+	File  string    `json:"file,omitempty"`
+	Text  string    `json:"text"`
+}
+
+type webServer struct {
+	mu     sync.Mutex
+	events []webEvent
+	start  time.Time
+	speed  float64 // bytes/sec over the last second
+}
+
+// startWeb listens on addr, before the run so a bad address fails early
+func startWeb(addr string) (*webServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("-web: %w", err)
+	}
+	if tcp, ok := ln.Addr().(*net.TCPAddr); ok && !tcp.IP.IsLoopback() && webToken == "" {
+		ln.Close()
+		return nil, fmt.Errorf("-web: %s is reachable from other machines; set -web-token or listen on localhost", addr)
+	}
+	w := &webServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", w.page)
+	mux.HandleFunc("/api/status", w.status)
+	mux.HandleFunc("/api/pause", w.pause(true))
+	mux.HandleFunc("/api/resume", w.pause(false))
+	go http.Serve(ln, w.auth(mux))
+	logger.Info(fmt.Sprintf("Dashboard at http://%s/", ln.Addr()), "event", "WEB", "addr", ln.Addr().String())
+	return w, nil
+}
+
+// run starts sampling the speed of the run
+func (w *webServer) run(start time.Time) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	w.start = start
+	w.mu.Unlock()
+	go func() {
+		last := atomic.LoadInt64(&totalBytes)
+		for range time.Tick(time.Second) {
+			b := atomic.LoadInt64(&totalBytes)
+			w.mu.Lock()
+			w.speed = float64(b - last)
+			w.mu.Unlock()
+			last = b
+		}
+	}()
+}
+
+// add keeps a log record for the page if it's a failure: a failed file, or
+// a warning or error
+func (w *webServer) add(level slog.Level, event, file, text string) {
+	if w == nil || (level < slog.LevelWarn && event != "FAIL") {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.events = append(w.events, webEvent{time.Now(), level.String(), event, file, text})
+	if len(w.events) > webKeep {
+		w.events = w.events[len(w.events)-webKeep:]
+	}
+}
+
+func (w *webServer) auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if webToken != "" {
+			sent := r.URL.Query().Get("token")
+			if h := r.Header.Get("Authorization"); len(h) > 7 && h[:7] == "Bearer " {
+				sent = h[7:]
+			}
+			if subtle.ConstantTimeCompare([]byte(sent), []byte(webToken)) != 1 {
+				http.Error(rw, "token required", http.StatusUnauthorized)
+				return
+			}
+		} else if !loopbackHost(r.Host) {
+			http.Error(rw, "unknown host", http.StatusForbidden)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && !sameOrigin(r) {
+			http.Error(rw, "cross-origin request", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// loopbackHost reports whether a Host header names this machine
+func loopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// sameOrigin reports whether a request comes from the page itself. Browsers
+// send Origin with every POST; clients like curl don't, and aren't refused.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// webStatus is what /api/status reports
+type webStatus struct {
+	Elapsed    float64 `json:"elapsed_seconds"`
+	Total      int     `json:"total"`
+	Completed  int64   `json:"completed"`
+	Downloaded int64   `json:"downloaded"`
+	NotFound   int64   `json:"not_found"`
+	Failed     int64   `json:"failed"`
+	Bytes      int64   `json:"bytes"`
+	FilesPerS  float64 `json:"files_per_second"`
+	BytesPerS  float64 `json:"bytes_per_second"`
+	ETA        float64 `json:"eta_seconds"` // -1 when unknown
+	Workers    int     `json:"workers"`
+	Limit      int     `json:"limit"`
+	Limited    int64   `json:"rate_limited"`
+	Paused     bool    `json:"paused"`
+	DiskLow    bool    `json:"disk_low"`        // held back by -min-free
+	DiskFree   int64   `json:"disk_free_bytes"` // on the fullest output volume; -1 unknown
+	Stopping   bool    `json:"stopping"`
+
+	Cookies struct {
+		State     string     `json:"state"` // ok, expired or refreshing
+		Source    string     `json:"refresh_source,omitempty"`
+		Refreshes int64      `json:"refreshes"`
+		Failures  int        `json:"refresh_failures"` // in a row
+		LastTry   *time.Time `json:"last_refresh,omitempty"`
+		Last302   *time.Time `json:"last_302,omitempty"`
+	} `json:"cookies"`
+
+	Failures []webEvent `json:"failures"` // newest first
+}
+
+func (w *webServer) status(rw http.ResponseWriter, r *http.Request) {
+	w.mu.Lock()
+	s := webStatus{Total: int(atomic.LoadInt64(&planned)), BytesPerS: w.speed, ETA: -1}
+	start := w.start
+	s.Failures = make([]webEvent, 0, len(w.events))
+	for i := len(w.events) - 1; i >= 0; i-- {
+		s.Failures = append(s.Failures, w.events[i])
+	}
+	w.mu.Unlock()
+
+	s.Downloaded = atomic.LoadInt64(&downloaded)
+	s.NotFound = atomic.LoadInt64(&skipped)
+	s.Failed = atomic.LoadInt64(&failed)
+	s.Bytes = atomic.LoadInt64(&totalBytes)
+	s.Completed = s.Downloaded + s.NotFound + s.Failed + atomic.LoadInt64(&unchanged)
+	if !start.IsZero() {
+		s.Elapsed = time.Since(start).Seconds()
+		if s.Elapsed > 0 {
+			s.FilesPerS = float64(s.Completed) / s.Elapsed
+		}
+		if s.FilesPerS > 0 {
+			s.ETA = float64(int64(s.Total)-s.Completed) / s.FilesPerS
+		}
+	}
+	if limiter != nil {
+		s.Limit, s.Workers, s.Limited, _ = limiter.stats()
+		s.Paused = limiter.holding(holdPaused)
+		s.DiskLow = limiter.holding(holdDisk)
+	}
+	s.Stopping = stopCtx.Err() != nil
+	s.DiskFree = disk.free()
+
+	expired, at := cookies.expiry()
+	s.Cookies.State = "ok"
+	if expired {
+		s.Cookies.State = "expired"
+	}
+	if !at.IsZero() {
+		s.Cookies.Last302 = &at
+	}
+	if refreshCookies != nil {
+		running, refreshes, failures, last := refreshCookies.status()
+		s.Cookies.Source = refreshCookies.source.String()
+		s.Cookies.Refreshes, s.Cookies.Failures = refreshes, failures
+		if running {
+			s.Cookies.State = "refreshing"
+		}
+		if !last.IsZero() {
+			s.Cookies.LastTry = &last
+		}
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(rw).Encode(s)
+}
+
+func (w *webServer) pause(held bool) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(rw, "POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		if limiter == nil {
+			http.Error(rw, "the run hasn't started", http.StatusConflict)
+			return
+		}
+		if held != limiter.holding(holdPaused) {
+			limiter.hold(holdPaused, held)
+			if held {
+				logger.Info("Paused from the dashboard; downloads in progress finish", "event", "PAUSE")
+			} else {
+				logger.Info("Resumed from the dashboard", "event", "RESUME")
+			}
+		}
+		w.status(rw, r)
+	}
+}
+
+func (w *webServer) page(rw http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(rw, r)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(rw, webPage)
+}
+
+const webPage = `<!doctype html>
+<html><head><meta charset="utf-8"><title>DOJ Epstein Files Downloader</title>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<style>
+body { font: 14px system-ui, sans-serif; margin: 2em auto; max-width: 60em; padding: 0 1em; color: #222 }
+h1 { font-size: 1.3em }
+.bar { background: #eee; height: 1.4em; border-radius: 3px; overflow: hidden }
+.bar div { background: #3a7; height: 100% }
+.stats { display: grid; grid-template-columns: repeat(auto-fill, minmax(11em, 1fr)); gap: .5em; margin: 1em 0 }
+.stats div { background: #f6f6f6; padding: .5em; border-radius: 3px }
+.stats b { display: block; font-size: 1.2em }
+button { font-size: 1em; padding: .4em 1.2em }
+.ok { color: #3a7 } .expired, .ERROR { color: #c33 } .refreshing, .WARN { color: #b80 }
+table { border-collapse: collapse; width: 100% } td { padding: .2em .5em; border-top: 1px solid #eee; vertical-align: top }
+td:first-child { white-space: nowrap; color: #777 }
+</style></head><body>
+<h1>DOJ Epstein Files Downloader</h1>
+<div class="bar"><div id="bar" style="width:0"></div></div>
+<p id="summary">Connecting...</p>
+<p><button id="pause">Pause</button> <span id="state"></span></p>
+<div class="stats" id="stats"></div>
+<h2>Cookies: <span id="cookies"></span></h2>
+<p id="cookieInfo"></p>
+<h2>Recent failures</h2>
+<table id="failures"></table>
+<script>
+const token = new URLSearchParams(location.search).get("token");
+const q = token ? "?token=" + encodeURIComponent(token) : "";
+const $ = id => document.getElementById(id);
+const size = b => { const u = ["B", "KB", "MB", "GB", "TB"]; let i = 0; while (b >= 1024 && i < 4) { b /= 1024; i++ } return b.toFixed(i ? 1 : 0) + " " + u[i] };
+const dur = s => s < 0 ? "-" : new Date(s * 1000).toISOString().substr(11, 8);
+const time = t => t ? new Date(t).toLocaleTimeString() : "never";
+const esc = s => s.replace(/[&<>]/g, c => ({"&": "&amp;", "<": "&lt;", ">": "&gt;"})[c]);
+let paused = false;
+function show(s) {
+  paused = s.paused;
+  const pct = s.total ? 100 * s.completed / s.total : 0;
+  $("bar").style.width = pct + "%";
+  $("summary").textContent = s.completed + " of " + s.total + " files (" + pct.toFixed(1) + "%), elapsed " + dur(s.elapsed_seconds) + ", ETA " + dur(s.eta_seconds);
+  $("pause").textContent = paused ? "Resume" : "Pause";
+  $("state").textContent = s.stopping ? "Stopping" : paused ? "Paused: no new files start" :
+    s.disk_low ? "Held: only " + size(s.disk_free_bytes) + " free on the output disk" : "";
+  $("stats").innerHTML = [["Downloaded", s.downloaded], ["Not found", s.not_found], ["Failed", s.failed],
+    ["Size", size(s.bytes)], ["Speed", size(s.bytes_per_second) + "/s"], ["Files/sec", s.files_per_second.toFixed(1)],
+    ["Workers", s.workers + "/" + s.limit], ["Rate limited", s.rate_limited]]
+    .map(([k, v]) => "<div>" + k + "<b>" + v + "</b></div>").join("");
+  const c = s.cookies;
+  $("cookies").textContent = c.state;
+  $("cookies").className = c.state;
+  $("cookieInfo").textContent = "Last 302: " + time(c.last_302) + (c.refresh_source ? ". Refresh via " + c.refresh_source + ": " +
+    c.refreshes + " done, last " + time(c.last_refresh) + (c.refresh_failures ? ", " + c.refresh_failures + " failed in a row" : "") : ". No refresh source set");
+  $("failures").innerHTML = s.failures.map(f => "<tr><td>" + time(f.at) + "</td><td class=\"" + f.level + "\">" + esc(f.text) + "</td></tr>").join("") || "<tr><td>None</td></tr>";
+}
+function poll() {
+  fetch("api/status" + q).then(r => r.json()).then(show).catch(() => $("summary").textContent = "Run finished or unreachable");
+}
+$("pause").onclick = () => fetch("api/" + (paused ? "resume" : "pause") + q, {method: "POST"}).then(r => r.json()).then(show);
+poll();
+setInterval(poll, 1000);
+</script></body></html>
+`
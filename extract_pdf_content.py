@@ -3,19 +3,33 @@ PDF Content Extractor
 Extracts images and text from PDF files.
 - Creates a folder for each PDF with extracted images
 - Extracts EXIF/metadata from images
+- Scores image sharpness/brightness so galleries can surface usable photos
+- Flags blank separator / filler pages
+- Renders page thumbnail sprite sheets for fast gallery scrubbing
+- Detects sideways / skewed scans and records the correction angle
+- Tells OCR text layers laid over scans from born-digital text
 - Saves text content to JSON
+- Detects tables (e.g. financial records) and saves them as CSV
+- Optionally traces each extraction stage with OpenTelemetry
 """
 
 import fitz  # PyMuPDF
 import os
 import json
 import io
+import csv
+import math
+import re
+import shutil
+import sys
+import urllib.request
+from contextlib import contextmanager
 from pathlib import Path
 from tqdm import tqdm
 import logging
 from concurrent.futures import ProcessPoolExecutor, as_completed
 import multiprocessing
-from PIL import Image
+from PIL import Image, ImageFilter, ImageStat
 from PIL.ExifTags import TAGS, GPSTAGS
 import exifread
 
@@ -23,8 +37,48 @@ import exifread
 DOWNLOADS_DIR = Path("downloads")
 IMAGES_OUTPUT_DIR = Path("extracted_images")
 TEXT_OUTPUT_DIR = Path("extracted_text")
+TABLES_OUTPUT_DIR = Path("extracted_tables")
+SPRITES_OUTPUT_DIR = Path("extracted_sprites")
+# Optional external table extraction service (camelot-style). It receives the
+# raw PDF bytes and must return JSON: [{"page": 1, "rows": [["a", "b"], ...]}]
+TABLE_SERVICE_URL = os.getenv("TABLE_SERVICE_URL", "")
 MAX_WORKERS = multiprocessing.cpu_count()  # Parallel processing
 
+# Quality scoring
+QUALITY_MAX_SIDE = 512           # Downscale before scoring for speed
+SHARPNESS_REFERENCE = 1000.0     # Laplacian variance treated as "fully sharp"
+
+# Color detection (Hasler-Susstrunk colorfulness on the 0-255 scale)
+COLOR_MAX_SIDE = 256
+COLOR_THRESHOLD = 15.0           # Scans pick up some chroma noise; below is grayscale
+
+# Blank page detection
+BLANK_RENDER_DPI = 24            # Low-res render is enough to judge a page
+BLANK_STDDEV_THRESHOLD = 6.0     # Grayscale stddev below this is "uniform"
+BLANK_MAX_TEXT_CHARS = 20        # Allow a Bates stamp on otherwise blank pages
+
+# Rotation / deskew detection
+DESKEW_RENDER_DPI = 50
+DESKEW_MAX_ANGLE = 5.0           # Search +/- this many degrees of skew
+DESKEW_STEP = 0.5
+
+# OCR text layer detection. OCR tools (Tesseract, ocrmypdf, Acrobat) lay
+# their text invisibly over the scanned image, so the text layer alone
+# doesn't tell OCR from born-digital text.
+OCR_INVISIBLE_SHARE = 0.8        # Share of characters drawn invisibly or in GlyphLessFont
+OCR_SCAN_COVERAGE = 0.85         # Share of the page one image covers on a scanned page
+
+# Sprite sheets (grid of page thumbnails per document)
+SPRITE_TILE_WIDTH = 120
+SPRITE_TILE_HEIGHT = 160
+SPRITE_COLUMNS = 10
+SPRITE_ROWS = 10                 # 100 pages per sheet, more sheets for long PDFs
+SPRITE_JPEG_QUALITY = 70
+
+# Tracing: spans are exported over OTLP when OTEL_EXPORTER_OTLP_ENDPOINT is set
+# (pip install opentelemetry-sdk opentelemetry-exporter-otlp-proto-http)
+OTEL_ENDPOINT = os.getenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+
 # Setup logging
 logging.basicConfig(
     level=logging.INFO,
@@ -85,6 +139,205 @@ def extract_exif_exifread(image_bytes: bytes) -> dict:
     return exif_data
 
 
+def compute_quality_scores(image_bytes: bytes) -> dict:
+    """Score sharpness (Laplacian variance) and brightness of an image.
+
+    quality is a 0-1 blend of normalized sharpness and exposure, where
+    exposure penalises images that are nearly black or washed out.
+    """
+    try:
+        img = Image.open(io.BytesIO(image_bytes)).convert("L")
+        img.thumbnail((QUALITY_MAX_SIDE, QUALITY_MAX_SIDE))
+
+        laplacian = img.filter(ImageFilter.Kernel(
+            (3, 3), [0, 1, 0, 1, -4, 1, 0, 1, 0], scale=1, offset=128
+        ))
+        sharpness = ImageStat.Stat(laplacian).var[0]
+        brightness = ImageStat.Stat(img).mean[0] / 255.0
+
+        sharpness_norm = min(sharpness / SHARPNESS_REFERENCE, 1.0)
+        exposure = max(0.0, 1.0 - abs(brightness - 0.5) * 2)
+        quality = 0.7 * sharpness_norm + 0.3 * exposure
+
+        return {
+            "sharpness": round(sharpness, 2),
+            "brightness": round(brightness, 4),
+            "quality": round(quality, 4),
+        }
+    except Exception:
+        return {"sharpness": 0.0, "brightness": 0.0, "quality": 0.0}
+
+
+def compute_color_stats(image_bytes: bytes) -> dict:
+    """Measure colorfulness and decide whether an image is color or grayscale"""
+    try:
+        img = Image.open(io.BytesIO(image_bytes)).convert("RGB")
+        img.thumbnail((COLOR_MAX_SIDE, COLOR_MAX_SIDE))
+
+        n = 0
+        rg_sum = rg_sq = yb_sum = yb_sq = 0.0
+        for r, g, b in img.getdata():
+            rg = r - g
+            yb = 0.5 * (r + g) - b
+            rg_sum += rg
+            rg_sq += rg * rg
+            yb_sum += yb
+            yb_sq += yb * yb
+            n += 1
+        if n == 0:
+            return {"is_color": None, "colorfulness": 0.0}
+
+        rg_mean, yb_mean = rg_sum / n, yb_sum / n
+        rg_std = max(0.0, rg_sq / n - rg_mean * rg_mean) ** 0.5
+        yb_std = max(0.0, yb_sq / n - yb_mean * yb_mean) ** 0.5
+        colorfulness = (rg_std ** 2 + yb_std ** 2) ** 0.5 + 0.3 * (rg_mean ** 2 + yb_mean ** 2) ** 0.5
+
+        return {
+            "is_color": colorfulness >= COLOR_THRESHOLD,
+            "colorfulness": round(colorfulness, 2),
+        }
+    except Exception:
+        return {"is_color": None, "colorfulness": 0.0}
+
+
+def is_uniform_image(img: Image.Image) -> bool:
+    """True if the image is (nearly) a single flat color"""
+    gray = img.convert("L")
+    gray.thumbnail((QUALITY_MAX_SIDE, QUALITY_MAX_SIDE))
+    return ImageStat.Stat(gray).stddev[0] < BLANK_STDDEV_THRESHOLD
+
+
+def is_blank_page(page, text: str) -> bool:
+    """Detect blank separator sheets: almost no text and a uniform render"""
+    if len(text.strip()) > BLANK_MAX_TEXT_CHARS:
+        return False
+    try:
+        pix = page.get_pixmap(dpi=BLANK_RENDER_DPI, colorspace=fitz.csGRAY)
+        img = Image.frombytes("L", (pix.width, pix.height), pix.samples)
+        return is_uniform_image(img)
+    except Exception:
+        return False
+
+
+def is_ocr_layer(page, text: str) -> bool:
+    """Whether a page's text is an OCR layer over a scan: mostly invisible
+    (render mode 3) or GlyphLessFont characters, or any text on a page that
+    is one big image"""
+    if not text.strip():
+        return False
+    try:
+        chars = hidden = 0
+        for span in page.get_texttrace():
+            n = len(span.get("chars", ()))
+            chars += n
+            if span.get("type") == 3 or "GlyphLess" in span.get("font", ""):
+                hidden += n
+        if chars and hidden / chars >= OCR_INVISIBLE_SHARE:
+            return True
+
+        page_area = abs(page.rect)
+        for info in page.get_image_info():
+            if page_area and abs(fitz.Rect(info["bbox"]) & page.rect) / page_area >= OCR_SCAN_COVERAGE:
+                return True
+    except Exception:
+        pass
+    return False
+
+
+# A token that reads as a word or a number, with surrounding punctuation
+PLAUSIBLE_TOKEN = re.compile(r"^[(\[\"'“‘]*(?:[^\W\d_]+(?:['’-][^\W\d_]+)*|[$€£]?\d+(?:[.,:/-]\d+)*%?)[)\]\"'”’.,;:!?]*$")
+
+
+def ocr_confidence(text: str) -> float:
+    """Estimated confidence (0-1) of an OCR layer, which records none of its
+    own: the share of its tokens that read as words or numbers. Misread
+    scans come out as fragments mixing letters, digits and symbols."""
+    tokens = text.split()
+    if not tokens:
+        return 0.0
+    plausible = 0
+    for token in tokens:
+        if PLAUSIBLE_TOKEN.match(token):
+            letters = [c for c in token if c.isalpha()]
+            # Long runs without a vowel are noise ("rnmnl"); short ones are initials
+            if len(letters) <= 3 or not all(c.isascii() for c in letters) or any(c in "aeiouyAEIOUY" for c in letters):
+                plausible += 1
+    return round(plausible / len(tokens), 3)
+
+
+def page_ocr_confidence(page, text: str):
+    """ocr_confidence for a page: the estimate for an OCR layer, None for
+    born-digital text or no text"""
+    return ocr_confidence(text) if is_ocr_layer(page, text) else None
+
+
+def detect_text_orientation(page):
+    """Estimate orientation from the direction of text lines.
+
+    Returns (rotation, skew): rotation is the clockwise multiple of 90 degrees
+    that makes text upright, skew is the residual angle in degrees. Returns
+    None when the page has no usable text layer.
+    """
+    weights = {}
+    weighted_skew = {}
+    for block in page.get_text("dict").get("blocks", []):
+        for line in block.get("lines", []):
+            chars = sum(len(span.get("text", "").strip()) for span in line.get("spans", []))
+            if chars == 0:
+                continue
+            cos, sin = line["dir"]
+            angle = math.degrees(math.atan2(sin, cos))
+            quadrant = int(round(angle / 90.0)) % 4
+            weights[quadrant] = weights.get(quadrant, 0) + chars
+            weighted_skew[quadrant] = weighted_skew.get(quadrant, 0.0) + (angle - round(angle / 90.0) * 90) * chars
+
+    if not weights:
+        return None
+
+    quadrant = max(weights, key=weights.get)
+    skew = weighted_skew[quadrant] / weights[quadrant]
+    # Text running at +90 degrees (PDF y axis points down) needs a 270 turn
+    rotation = (360 - quadrant * 90) % 360
+    return rotation, -skew
+
+
+def detect_image_skew(page) -> float:
+    """Projection-profile deskew for scanned pages with no text layer.
+
+    The rendered page is rotated through small angles; the angle whose row
+    brightness profile has the highest variance aligns text lines best.
+    """
+    pix = page.get_pixmap(dpi=DESKEW_RENDER_DPI, colorspace=fitz.csGRAY)
+    img = Image.frombytes("L", (pix.width, pix.height), pix.samples)
+
+    best_angle, best_score = 0.0, -1.0
+    steps = int(DESKEW_MAX_ANGLE / DESKEW_STEP)
+    for i in range(-steps, steps + 1):
+        angle = i * DESKEW_STEP
+        rotated = img.rotate(angle, resample=Image.BILINEAR, fillcolor=255)
+        profile = list(rotated.resize((1, rotated.height), Image.BOX).getdata())
+        mean = sum(profile) / len(profile)
+        score = sum((v - mean) ** 2 for v in profile)
+        if score > best_score:
+            best_angle, best_score = angle, score
+
+    # PIL rotates counter-clockwise; store the clockwise correction
+    return -best_angle
+
+
+def detect_page_correction(page) -> dict:
+    """Correction to display the page upright: rotation plus residual skew"""
+    try:
+        orientation = detect_text_orientation(page)
+        if orientation is not None:
+            rotation, skew = orientation
+        else:
+            rotation, skew = 0, detect_image_skew(page)
+        return {"correction_rotation": rotation, "skew_angle": round(skew, 2)}
+    except Exception:
+        return {"correction_rotation": 0, "skew_angle": 0.0}
+
+
 def extract_image_metadata(image_bytes: bytes, image_ext: str) -> dict:
     """Extract all available metadata from an image"""
     metadata = {
@@ -127,6 +380,12 @@ def extract_image_metadata(image_bytes: bytes, image_ext: str) -> dict:
             combined_exif[clean_key] = value
 
     metadata["combined_exif"] = combined_exif
+    metadata["quality"] = compute_quality_scores(image_bytes)
+    metadata["color"] = compute_color_stats(image_bytes)
+    try:
+        metadata["is_blank"] = is_uniform_image(Image.open(io.BytesIO(image_bytes)))
+    except Exception:
+        metadata["is_blank"] = False
 
     return metadata
 
@@ -218,10 +477,17 @@ def extract_text_from_pdf(pdf_path: Path) -> dict:
 
         for page_num in range(len(doc)):
             page = doc[page_num]
-            text = page.get_text("text")
+            # sort=True orders blocks top-to-bottom, left-to-right (reading order)
+            text = page.get_text("text", sort=True)
             pages_text.append({
                 "page": page_num + 1,
-                "text": text
+                "text": text,
+                "width": page.rect.width,
+                "height": page.rect.height,
+                "rotation": page.rotation,
+                "is_blank": is_blank_page(page, text),
+                "ocr_confidence": page_ocr_confidence(page, text),
+                **detect_page_correction(page)
             })
             full_text += text + "\n"
 
@@ -230,6 +496,7 @@ def extract_text_from_pdf(pdf_path: Path) -> dict:
         return {
             "status": "success",
             "page_count": len(pages_text),
+            "blank_page_count": sum(1 for p in pages_text if p["is_blank"]),
             "pages": pages_text,
             "full_text": full_text.strip(),
             "char_count": len(full_text.strip())
@@ -240,12 +507,183 @@ def extract_text_from_pdf(pdf_path: Path) -> dict:
             "status": "error",
             "error": str(e),
             "page_count": 0,
+            "blank_page_count": 0,
             "pages": [],
             "full_text": "",
             "char_count": 0
         }
 
 
+def detect_tables_pymupdf(pdf_path: Path) -> list:
+    """Detect tables on each page using PyMuPDF's table finder"""
+    tables = []
+    doc = fitz.open(pdf_path)
+    try:
+        for page_num in range(len(doc)):
+            page = doc[page_num]
+            for table in page.find_tables().tables:
+                rows = [[cell if cell is not None else "" for cell in row] for row in table.extract()]
+                if rows:
+                    tables.append({"page": page_num + 1, "rows": rows})
+    finally:
+        doc.close()
+    return tables
+
+
+def detect_tables_service(pdf_path: Path) -> list:
+    """Send the PDF to the external table extraction service"""
+    with open(pdf_path, "rb") as f:
+        req = urllib.request.Request(
+            TABLE_SERVICE_URL,
+            data=f.read(),
+            headers={"Content-Type": "application/pdf"},
+            method="POST",
+        )
+    with urllib.request.urlopen(req, timeout=120) as resp:
+        return json.loads(resp.read().decode("utf-8"))
+
+
+def extract_tables_from_pdf(pdf_path: Path, output_dir: Path) -> dict:
+    """Extract tables from a PDF and save each one as a CSV file"""
+    try:
+        if TABLE_SERVICE_URL:
+            extractor = "service"
+            tables = detect_tables_service(pdf_path)
+        else:
+            extractor = "pymupdf"
+            tables = detect_tables_pymupdf(pdf_path)
+
+        if not tables:
+            return {"status": "success", "table_count": 0}
+
+        pdf_output_dir = output_dir / pdf_path.stem
+        pdf_output_dir.mkdir(parents=True, exist_ok=True)
+
+        index = []
+        per_page = {}
+        for table in tables:
+            page_num = table["page"]
+            per_page[page_num] = per_page.get(page_num, 0) + 1
+            csv_filename = f"page{page_num}_table{per_page[page_num]}.csv"
+
+            with open(pdf_output_dir / csv_filename, "w", encoding="utf-8", newline="") as f:
+                csv.writer(f).writerows(table["rows"])
+
+            index.append({
+                "page": page_num,
+                "table_index": per_page[page_num],
+                "filename": csv_filename,
+                "row_count": len(table["rows"]),
+                "column_count": max(len(row) for row in table["rows"]),
+            })
+
+        with open(pdf_output_dir / "tables.json", "w", encoding="utf-8") as f:
+            json.dump({
+                "source_pdf": pdf_path.name,
+                "extractor": extractor,
+                "tables": index
+            }, f, indent=2, ensure_ascii=False)
+
+        return {"status": "success", "table_count": len(index)}
+
+    except Exception as e:
+        return {"status": "error", "error": str(e), "table_count": 0}
+
+
+def render_page_tile(page, correction: dict = None) -> Image.Image:
+    """Render a page thumbnail, upright, letterboxed into a fixed-size tile"""
+    zoom = 2 * min(SPRITE_TILE_WIDTH / page.rect.width, SPRITE_TILE_HEIGHT / page.rect.height)
+    pix = page.get_pixmap(matrix=fitz.Matrix(zoom, zoom), colorspace=fitz.csRGB, alpha=False)
+    thumb = Image.frombytes("RGB", (pix.width, pix.height), pix.samples)
+
+    if correction:
+        angle = correction.get("correction_rotation", 0) + correction.get("skew_angle", 0.0)
+        if angle:
+            # PIL rotates counter-clockwise, corrections are clockwise
+            thumb = thumb.rotate(-angle, resample=Image.BILINEAR, expand=True, fillcolor="white")
+    thumb.thumbnail((SPRITE_TILE_WIDTH, SPRITE_TILE_HEIGHT))
+
+    tile = Image.new("RGB", (SPRITE_TILE_WIDTH, SPRITE_TILE_HEIGHT), "white")
+    tile.paste(thumb, ((SPRITE_TILE_WIDTH - thumb.width) // 2, (SPRITE_TILE_HEIGHT - thumb.height) // 2))
+    return tile
+
+
+def build_sprites_from_pdf(pdf_path: Path, output_dir: Path, corrections: dict = None) -> dict:
+    """Render all pages into sprite sheets plus a JSON index of the grid.
+
+    corrections maps 1-based page numbers to their detected rotation/skew.
+    """
+    corrections = corrections or {}
+    try:
+        doc = fitz.open(pdf_path)
+        page_count = len(doc)
+        if page_count == 0:
+            doc.close()
+            return {"status": "success", "sheet_count": 0}
+
+        pdf_output_dir = output_dir / pdf_path.stem
+        pdf_output_dir.mkdir(parents=True, exist_ok=True)
+
+        per_sheet = SPRITE_COLUMNS * SPRITE_ROWS
+        sheets = []
+        for sheet_index, first in enumerate(range(0, page_count, per_sheet)):
+            pages = range(first, min(first + per_sheet, page_count))
+            rows = (len(pages) + SPRITE_COLUMNS - 1) // SPRITE_COLUMNS
+            columns = min(len(pages), SPRITE_COLUMNS)
+
+            sheet = Image.new("RGB", (columns * SPRITE_TILE_WIDTH, rows * SPRITE_TILE_HEIGHT), "white")
+            for i, page_num in enumerate(pages):
+                tile = render_page_tile(doc[page_num], corrections.get(page_num + 1))
+                sheet.paste(tile, ((i % SPRITE_COLUMNS) * SPRITE_TILE_WIDTH, (i // SPRITE_COLUMNS) * SPRITE_TILE_HEIGHT))
+
+            filename = f"sprite{sheet_index + 1}.jpg"
+            sheet.save(pdf_output_dir / filename, "JPEG", quality=SPRITE_JPEG_QUALITY)
+            sheets.append({
+                "sheet": sheet_index + 1,
+                "filename": filename,
+                "first_page": first + 1,
+                "page_count": len(pages),
+                "columns": columns,
+                "rows": rows,
+            })
+
+        doc.close()
+
+        with open(pdf_output_dir / "sprite.json", "w", encoding="utf-8") as f:
+            json.dump({
+                "source_pdf": pdf_path.name,
+                "tile_width": SPRITE_TILE_WIDTH,
+                "tile_height": SPRITE_TILE_HEIGHT,
+                "sheets": sheets
+            }, f, indent=2)
+
+        return {"status": "success", "sheet_count": len(sheets)}
+
+    except Exception as e:
+        return {"status": "error", "error": str(e), "sheet_count": 0}
+
+
+def list_pdfs(downloads_dir: Path) -> list:
+    """PDFs in the downloads folder and in the numbered subfolders the Go
+    downloader's -shard option saves them to"""
+    if not downloads_dir.exists():
+        return []
+    pdfs = list(downloads_dir.glob("*.pdf"))
+    for shard in downloads_dir.iterdir():
+        if shard.is_dir() and len(shard.name) == 6 and shard.name.isdigit():
+            pdfs.extend(shard.glob("*.pdf"))
+    return pdfs
+
+
+def find_pdf(downloads_dir: Path, pdf_name: str):
+    """Path of one downloaded PDF, in the downloads folder or a shard
+    subfolder, or None"""
+    path = downloads_dir / f"{pdf_name}.pdf"
+    if path.exists():
+        return path
+    return next(downloads_dir.glob(f"[0-9][0-9][0-9][0-9][0-9][0-9]/{pdf_name}.pdf"), None)
+
+
 def is_already_extracted(pdf_path: Path, images_dir: Path, text_dir: Path) -> bool:
     """Check if a PDF has already been extracted"""
     pdf_name = pdf_path.stem
@@ -260,7 +698,60 @@ def is_already_extracted(pdf_path: Path, images_dir: Path, text_dir: Path) -> bo
     return True
 
 
-def process_single_pdf(pdf_path: Path, images_dir: Path, text_dir: Path) -> dict:
+# ============================================================================
+# TRACING
+# ============================================================================
+
+_tracer = None
+_tracer_provider = None
+
+
+def get_tracer():
+    """Lazily set up tracing; each worker process gets its own provider"""
+    global _tracer, _tracer_provider
+    if _tracer is not None or not OTEL_ENDPOINT:
+        return _tracer
+    try:
+        from opentelemetry import trace
+        from opentelemetry.sdk.resources import Resource
+        from opentelemetry.sdk.trace import TracerProvider
+        from opentelemetry.sdk.trace.export import BatchSpanProcessor
+        from opentelemetry.exporter.otlp.proto.http.trace_exporter import OTLPSpanExporter
+    except ImportError:
+        logger.warning("OTEL_EXPORTER_OTLP_ENDPOINT is set but opentelemetry is not installed")
+        return None
+
+    service = os.getenv("OTEL_SERVICE_NAME", "epstein-files-ingest")
+    _tracer_provider = TracerProvider(resource=Resource.create({"service.name": service}))
+    _tracer_provider.add_span_processor(BatchSpanProcessor(OTLPSpanExporter()))
+    _tracer = _tracer_provider.get_tracer("extract_pdf_content")
+    return _tracer
+
+
+@contextmanager
+def stage_span(name: str, **attributes):
+    """Span around an extraction stage; a no-op when tracing is off"""
+    tracer = get_tracer()
+    if tracer is None:
+        yield None
+        return
+    with tracer.start_as_current_span(name, attributes=attributes) as span:
+        yield span
+
+
+def flush_spans():
+    """Export buffered spans; worker processes exit without running atexit"""
+    if _tracer_provider is not None:
+        _tracer_provider.force_flush()
+
+
+def process_single_pdf(pdf_path: Path, images_dir: Path, text_dir: Path, tables_dir: Path, sprites_dir: Path) -> dict:
+    """Process a single PDF inside an "extract_pdf" span"""
+    with stage_span("extract_pdf", pdf=pdf_path.name):
+        return _process_single_pdf(pdf_path, images_dir, text_dir, tables_dir, sprites_dir)
+
+
+def _process_single_pdf(pdf_path: Path, images_dir: Path, text_dir: Path, tables_dir: Path, sprites_dir: Path) -> dict:
     """Process a single PDF - extract images and text"""
     pdf_name = pdf_path.stem
 
@@ -274,53 +765,75 @@ def process_single_pdf(pdf_path: Path, images_dir: Path, text_dir: Path) -> dict
         result["skipped"] = True
         result["images"] = {"status": "skipped", "image_count": 0, "images": []}
         result["text"] = {"status": "skipped", "page_count": 0, "char_count": 0}
+        result["tables"] = {"status": "skipped", "table_count": 0}
+        result["sprites"] = {"status": "skipped", "sheet_count": 0}
         return result
 
     result["skipped"] = False
 
     # Extract images
-    images_result = extract_images_from_pdf(pdf_path, images_dir)
+    with stage_span("extract_images"):
+        images_result = extract_images_from_pdf(pdf_path, images_dir)
     result["images"] = images_result
 
     # Extract text
-    text_result = extract_text_from_pdf(pdf_path)
+    with stage_span("extract_text"):
+        text_result = extract_text_from_pdf(pdf_path)
     result["text"] = {
         "status": text_result["status"],
         "page_count": text_result["page_count"],
         "char_count": text_result["char_count"]
     }
 
+    # Extract tables
+    with stage_span("extract_tables"):
+        result["tables"] = extract_tables_from_pdf(pdf_path, tables_dir)
+
+    # Render thumbnail sprite sheets
+    corrections = {p["page"]: p for p in text_result["pages"]}
+    with stage_span("build_sprites"):
+        result["sprites"] = build_sprites_from_pdf(pdf_path, sprites_dir, corrections)
+
     # Save text to JSON file
     if text_result["status"] == "success":
-        text_output_path = text_dir / f"{pdf_name}.json"
-        text_dir.mkdir(parents=True, exist_ok=True)
-
-        text_data = {
-            "filename": pdf_path.name,
-            "page_count": text_result["page_count"],
-            "pages": text_result["pages"],
-            "full_text": text_result["full_text"]
-        }
-
-        with open(text_output_path, "w", encoding="utf-8") as f:
-            json.dump(text_data, f, indent=2, ensure_ascii=False)
+        save_text(pdf_path, text_result, text_dir)
 
     return result
 
 
+def save_text(pdf_path: Path, text_result: dict, text_dir: Path):
+    """Write extracted text to <text_dir>/<pdf name>.json for populate_db.py"""
+    text_dir.mkdir(parents=True, exist_ok=True)
+    text_data = {
+        "filename": pdf_path.name,
+        "page_count": text_result["page_count"],
+        "blank_page_count": text_result["blank_page_count"],
+        "pages": text_result["pages"],
+        "full_text": text_result["full_text"]
+    }
+
+    with open(text_dir / f"{pdf_path.stem}.json", "w", encoding="utf-8") as f:
+        json.dump(text_data, f, indent=2, ensure_ascii=False)
+
+
 def process_pdf_wrapper(args):
     """Wrapper for multiprocessing"""
-    pdf_path, images_dir, text_dir = args
-    return process_single_pdf(Path(pdf_path), Path(images_dir), Path(text_dir))
+    pdf_path, images_dir, text_dir, tables_dir, sprites_dir = args
+    try:
+        return process_single_pdf(Path(pdf_path), Path(images_dir), Path(text_dir), Path(tables_dir), Path(sprites_dir))
+    finally:
+        flush_spans()
 
 
 def main():
     # Create output directories
     IMAGES_OUTPUT_DIR.mkdir(exist_ok=True)
     TEXT_OUTPUT_DIR.mkdir(exist_ok=True)
+    TABLES_OUTPUT_DIR.mkdir(exist_ok=True)
+    SPRITES_OUTPUT_DIR.mkdir(exist_ok=True)
 
     # Get list of PDFs
-    pdf_files = list(DOWNLOADS_DIR.glob("*.pdf"))
+    pdf_files = list_pdfs(DOWNLOADS_DIR)
 
     if not pdf_files:
         logger.info("No PDF files found in downloads folder")
@@ -345,13 +858,15 @@ def main():
     # Track statistics
     total_images = 0
     total_text_chars = 0
+    total_tables = 0
     successful = 0
     failed = 0
     skipped = 0
 
     # Process PDFs with progress bar
     # Using ProcessPoolExecutor for CPU-bound PDF processing
-    args_list = [(str(pdf), str(IMAGES_OUTPUT_DIR), str(TEXT_OUTPUT_DIR)) for pdf in pdf_files]
+    args_list = [(str(pdf), str(IMAGES_OUTPUT_DIR), str(TEXT_OUTPUT_DIR), str(TABLES_OUTPUT_DIR), str(SPRITES_OUTPUT_DIR))
+                 for pdf in pdf_files]
 
     with ProcessPoolExecutor(max_workers=MAX_WORKERS) as executor:
         futures = {executor.submit(process_pdf_wrapper, args): args[0] for args in args_list}
@@ -369,6 +884,7 @@ def main():
                             total_images += result["images"]["image_count"]
                         if result["text"]["status"] == "success":
                             total_text_chars += result["text"]["char_count"]
+                        total_tables += result["tables"]["table_count"]
                         successful += 1
                     else:
                         failed += 1
@@ -389,7 +905,85 @@ def main():
     logger.info(f"Failed: {failed:,}")
     logger.info(f"Total images extracted: {total_images:,}")
     logger.info(f"Total text characters: {total_text_chars:,}")
+    logger.info(f"Total tables extracted: {total_tables:,}")
+
+
+def detect_ocr():
+    """Add OCR layer detection to text extracted before it was recorded,
+    reopening each PDF but leaving the rest of its extraction as it is"""
+    pdfs = {pdf.stem: pdf for pdf in list_pdfs(DOWNLOADS_DIR)}
+    text_files = [f for f in sorted(TEXT_OUTPUT_DIR.glob("*.json")) if f.stem in pdfs]
+    updated = 0
+    for text_file in tqdm(text_files, desc="Detecting OCR", unit="pdf"):
+        try:
+            with open(text_file, "r", encoding="utf-8") as f:
+                text_data = json.load(f)
+            pages = text_data.get("pages", [])
+            if not pages or all("ocr_confidence" in p for p in pages):
+                continue
+
+            doc = fitz.open(pdfs[text_file.stem])
+            for p in pages:
+                number = p.get("page", 1) - 1
+                if 0 <= number < len(doc):
+                    p["ocr_confidence"] = page_ocr_confidence(doc[number], p.get("text", ""))
+            doc.close()
+
+            with open(text_file, "w", encoding="utf-8") as f:
+                json.dump(text_data, f, indent=2, ensure_ascii=False)
+            updated += 1
+        except Exception as e:
+            logger.error(f"Error detecting OCR in {text_file.stem}: {e}")
+
+    logger.info(f"OCR detection added to {updated:,} of {len(text_files):,} extracted documents")
+
+
+REEXTRACT_STAGES = ("text", "images")
+
+
+def reextract(pdf_name: str, stages: list) -> bool:
+    """Extract one PDF again, e.g. after a corrupt download was replaced,
+    overwriting its earlier text ("text") and images ("images"). Run by the
+    backend's re-ingest job before populate_db.py reingest."""
+    pdf_path = find_pdf(DOWNLOADS_DIR, pdf_name)
+    if pdf_path is None:
+        logger.error(f"{pdf_name}.pdf not found in {DOWNLOADS_DIR}")
+        return False
+
+    if "images" in stages:
+        # Images no longer in the PDF must not be picked up again
+        shutil.rmtree(IMAGES_OUTPUT_DIR / pdf_name, ignore_errors=True)
+        with stage_span("extract_images", pdf=pdf_path.name):
+            images_result = extract_images_from_pdf(pdf_path, IMAGES_OUTPUT_DIR)
+        if images_result["status"] != "success":
+            logger.error(f"Extracting images from {pdf_path.name} failed: {images_result['error']}")
+            return False
+        logger.info(f"{pdf_path.name}: {images_result['image_count']:,} images")
+
+    if "text" in stages:
+        with stage_span("extract_text", pdf=pdf_path.name):
+            text_result = extract_text_from_pdf(pdf_path)
+        if text_result["status"] != "success":
+            logger.error(f"Extracting text from {pdf_path.name} failed: {text_result['error']}")
+            return False
+        save_text(pdf_path, text_result, TEXT_OUTPUT_DIR)
+        logger.info(f"{pdf_path.name}: {text_result['page_count']:,} pages, {text_result['char_count']:,} characters")
+
+    flush_spans()
+    return True
 
 
 if __name__ == "__main__":
-    main()
+    if len(sys.argv) > 1 and sys.argv[1] == "detect-ocr":
+        detect_ocr()
+    elif len(sys.argv) > 1 and sys.argv[1] == "reextract":
+        # reextract <pdf name> [--stages text,images]
+        if len(sys.argv) < 3:
+            sys.exit("usage: extract_pdf_content.py reextract <pdf name> [--stages text,images]")
+        stages = list(REEXTRACT_STAGES)
+        if "--stages" in sys.argv[3:]:
+            stages = sys.argv[sys.argv.index("--stages") + 1].split(",")
+        if not reextract(sys.argv[2], [s for s in stages if s in REEXTRACT_STAGES]):
+            sys.exit(1)
+    else:
+        main()
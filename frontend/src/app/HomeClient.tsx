@@ -5,6 +5,7 @@ import { useRouter, useSearchParams } from 'next/navigation';
 import Link from 'next/link';
 import { Search, Grid, List, FileText, MapPin, Calendar, Shield, Database, ChevronDown, HelpCircle } from 'lucide-react';
 import { ImageCard } from '@/components/ImageCard';
+import { GrowthChart } from '@/components/GrowthChart';
 import {
   Image,
   Stats,
@@ -304,6 +305,7 @@ export function HomeClient({
                   highlight
                   mounted={mounted}
                 />
+                <GrowthChart />
               </div>
             )}
           </div>
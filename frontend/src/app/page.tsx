@@ -42,16 +42,17 @@ async function searchImages(query: string, limit = 100): Promise<SearchResult> {
     const params = new URLSearchParams();
     params.set('q', query);
     params.set('limit', limit.toString());
+    params.set('expand', 'true'); // the gallery shows every matching image
     
     const res = await fetch(`${API_BASE}/search?${params}`, {
       next: { revalidate: 60 }, // Cache for 1 minute
     });
     if (!res.ok) {
-      return { documents: [], images: [], query, total: 0 };
+      return { documents: [], query, total: 0 };
     }
     return res.json();
   } catch {
-    return { documents: [], images: [], query, total: 0 };
+    return { documents: [], query, total: 0 };
   }
 }
 
@@ -142,7 +143,7 @@ async function HomeContent({
 
   if (searchQuery) {
     const searchResult = imagesResponse as SearchResult;
-    images = searchResult.images || [];
+    images = (searchResult.documents || []).flatMap((doc) => doc.images || []);
     total = searchResult.total;
     hasMore = false;
     nextCursor = undefined;
@@ -0,0 +1,62 @@
+'use client';
+
+import { useEffect, useState } from 'react';
+import { TrendingUp } from 'lucide-react';
+import { GrowthBucket, getGrowth, formatNumber } from '@/lib/api';
+
+const WIDTH = 240;
+const HEIGHT = 48;
+
+// Cumulative document count per week, drawn as a small area chart next to
+// the header stats (wide screens only)
+export function GrowthChart() {
+  const [buckets, setBuckets] = useState<GrowthBucket[]>([]);
+
+  useEffect(() => {
+    getGrowth('week')
+      .then((res) => setBuckets(res.data))
+      .catch(() => setBuckets([]));
+  }, []);
+
+  // A single period has no trend to draw
+  if (buckets.length < 2) return null;
+
+  const max = buckets[buckets.length - 1].total_documents || 1;
+  const step = WIDTH / (buckets.length - 1);
+  const points = buckets.map((b, i) => {
+    const x = i * step;
+    const y = HEIGHT - (b.total_documents / max) * HEIGHT;
+    return `${x.toFixed(1)},${y.toFixed(1)}`;
+  });
+  const area = `0,${HEIGHT} ${points.join(' ')} ${WIDTH},${HEIGHT}`;
+
+  const first = buckets[0];
+  const last = buckets[buckets.length - 1];
+
+  return (
+    <>
+      <div className="hidden lg:block w-px h-12 sm:h-16 bg-gradient-to-b from-transparent via-zinc-700 to-transparent flex-shrink-0" />
+      <div className="hidden lg:block flex-shrink-0">
+        <svg
+          width={WIDTH}
+          height={HEIGHT}
+          viewBox={`0 0 ${WIDTH} ${HEIGHT}`}
+          className="overflow-visible"
+          role="img"
+          aria-label={`Archive grew to ${formatNumber(last.total_documents)} documents since ${first.period}`}
+        >
+          <polygon points={area} className="fill-amber-500/10" />
+          <polyline points={points.join(' ')} fill="none" className="stroke-amber-500" strokeWidth={1.5} />
+        </svg>
+        <div className="flex items-center justify-between gap-2 mt-1">
+          <span className="font-mono text-[9px] sm:text-[10px] text-zinc-600">{first.period}</span>
+          <span className="flex items-center gap-1.5 font-mono text-[9px] sm:text-[10px] text-zinc-500 tracking-widest">
+            <TrendingUp size={12} className="text-zinc-600" />
+            ARCHIVE GROWTH
+          </span>
+          <span className="font-mono text-[9px] sm:text-[10px] text-zinc-600">{last.period}</span>
+        </div>
+      </div>
+    </>
+  );
+}
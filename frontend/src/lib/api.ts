@@ -24,6 +24,7 @@ export interface Document {
   page_count: number;
   created_at: string;
   images?: Image[];
+  matching_images?: number; // search results: images on matching pages
 }
 
 export interface Stats {
@@ -34,6 +35,24 @@ export interface Stats {
   total_size_bytes: number;
 }
 
+export type GrowthInterval = 'day' | 'week' | 'month' | 'year';
+
+export interface GrowthBucket {
+  period: string; // first day of the period, YYYY-MM-DD
+  documents: number;
+  images: number;
+  document_bytes: number;
+  image_bytes: number;
+  total_documents: number;
+  total_images: number;
+  total_bytes: number;
+}
+
+export interface GrowthResponse {
+  interval: GrowthInterval;
+  data: GrowthBucket[];
+}
+
 export interface PaginatedResponse<T> {
   data: T[];
   next_cursor?: string;
@@ -42,8 +61,7 @@ export interface PaginatedResponse<T> {
 }
 
 export interface SearchResult {
-  documents: Document[];
-  images: Image[];
+  documents: Document[]; // image hits are under each document's images
   query: string;
   total: number;
 }
@@ -115,6 +133,12 @@ export async function getStats(): Promise<Stats> {
   return res.json();
 }
 
+export async function getGrowth(interval: GrowthInterval = 'week'): Promise<GrowthResponse> {
+  const res = await fetch(`${API_BASE}/stats/growth?interval=${interval}`);
+  if (!res.ok) throw new Error('Failed to fetch growth');
+  return res.json();
+}
+
 // Utility functions
 export function formatFileSize(bytes: number): string {
   if (!bytes) return '—';
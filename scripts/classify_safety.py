@@ -0,0 +1,155 @@
+"""
+Image Safety Classification
+
+Assigns a sensitivity label (safe / sensitive / explicit) to every image in
+the database so the API can blur or omit flagged images in safe mode.
+- Pluggable providers selected with SAFETY_PROVIDER
+- Skips already classified images (use --all to reclassify)
+- Reads image bytes from the local extracted_images folder
+
+Providers:
+  http     POST image bytes to SAFETY_API_URL, expects
+           {"label": "safe|sensitive|explicit", "score": 0.0-1.0}
+  nudenet  Local NudeNet detector (pip install nudenet)
+"""
+
+import json
+import os
+import sqlite3
+import sys
+import logging
+import urllib.request
+from tqdm import tqdm
+
+import config
+
+logging.basicConfig(
+    level=logging.INFO,
+    format='%(asctime)s - %(levelname)s - %(message)s',
+    handlers=[
+        logging.FileHandler(config.PROJECT_ROOT / "classify_safety.log"),
+        logging.StreamHandler()
+    ]
+)
+logger = logging.getLogger(__name__)
+
+SAFETY_PROVIDER = os.getenv("SAFETY_PROVIDER", "http")
+SAFETY_API_URL = os.getenv("SAFETY_API_URL", "")
+SAFETY_API_KEY = os.getenv("SAFETY_API_KEY", "")
+
+# Score thresholds used to turn a provider score into a label
+SENSITIVE_THRESHOLD = float(os.getenv("SAFETY_SENSITIVE_THRESHOLD", "0.5"))
+EXPLICIT_THRESHOLD = float(os.getenv("SAFETY_EXPLICIT_THRESHOLD", "0.85"))
+
+BATCH_SIZE = 200
+
+
+def label_for_score(score: float) -> str:
+    if score >= EXPLICIT_THRESHOLD:
+        return "explicit"
+    if score >= SENSITIVE_THRESHOLD:
+        return "sensitive"
+    return "safe"
+
+
+# ============================================================================
+# PROVIDERS
+# ============================================================================
+
+class HTTPProvider:
+    """Delegates classification to an external HTTP service"""
+    name = "http"
+
+    def __init__(self):
+        if not SAFETY_API_URL:
+            raise RuntimeError("SAFETY_API_URL is required for the http provider")
+
+    def classify(self, image_bytes: bytes) -> tuple:
+        headers = {"Content-Type": "application/octet-stream"}
+        if SAFETY_API_KEY:
+            headers["Authorization"] = f"Bearer {SAFETY_API_KEY}"
+        req = urllib.request.Request(SAFETY_API_URL, data=image_bytes, headers=headers, method="POST")
+        with urllib.request.urlopen(req, timeout=60) as resp:
+            result = json.loads(resp.read().decode("utf-8"))
+        score = float(result.get("score", 0.0))
+        return result.get("label") or label_for_score(score), score
+
+
+class NudeNetProvider:
+    """Local NudeNet detector; score is the highest exposed-class confidence"""
+    name = "nudenet"
+
+    EXPOSED_CLASSES = {
+        "FEMALE_BREAST_EXPOSED", "FEMALE_GENITALIA_EXPOSED",
+        "MALE_GENITALIA_EXPOSED", "BUTTOCKS_EXPOSED", "ANUS_EXPOSED",
+    }
+
+    def __init__(self):
+        from nudenet import NudeDetector
+        self.detector = NudeDetector()
+
+    def classify(self, image_bytes: bytes) -> tuple:
+        detections = self.detector.detect(image_bytes)
+        score = max(
+            (d["score"] for d in detections if d.get("class") in self.EXPOSED_CLASSES),
+            default=0.0
+        )
+        return label_for_score(score), score
+
+
+PROVIDERS = {
+    "http": HTTPProvider,
+    "nudenet": NudeNetProvider,
+}
+
+
+# ============================================================================
+# MAIN
+# ============================================================================
+
+def main(reclassify: bool = False):
+    if SAFETY_PROVIDER not in PROVIDERS:
+        logger.error(f"Unknown SAFETY_PROVIDER '{SAFETY_PROVIDER}'. Options: {', '.join(PROVIDERS)}")
+        return
+
+    provider = PROVIDERS[SAFETY_PROVIDER]()
+    logger.info(f"Using safety provider: {provider.name}")
+
+    conn = sqlite3.connect(config.DATABASE_PATH)
+    cursor = conn.cursor()
+
+    where = "" if reclassify else "WHERE safety_label IS NULL OR safety_label = ''"
+    cursor.execute(f"SELECT id, document_id, filename FROM images {where} ORDER BY id")
+    rows = cursor.fetchall()
+    logger.info(f"Images to classify: {len(rows):,}")
+
+    counts = {"safe": 0, "sensitive": 0, "explicit": 0, "failed": 0}
+    pending = 0
+
+    for image_id, document_id, filename in tqdm(rows, desc="Classifying", unit="img"):
+        path = config.EXTRACTED_IMAGES / document_id / filename
+        try:
+            label, score = provider.classify(path.read_bytes())
+        except Exception as e:
+            counts["failed"] += 1
+            logger.debug(f"Failed to classify {path}: {e}")
+            continue
+
+        cursor.execute(
+            "UPDATE images SET safety_label = ?, safety_score = ?, safety_provider = ? WHERE id = ?",
+            (label, score, provider.name, image_id)
+        )
+        counts[label] = counts.get(label, 0) + 1
+        pending += 1
+        if pending >= BATCH_SIZE:
+            conn.commit()
+            pending = 0
+
+    conn.commit()
+    conn.close()
+
+    logger.info(f"Classification complete: {counts}")
+
+
+if __name__ == "__main__":
+    main(reclassify="--all" in sys.argv)
@@ -0,0 +1,286 @@
+"""
+Face Clustering (opt-in)
+
+Detects faces in every image and groups them into anonymous clusters so
+researchers can find all photos of the same unidentified person.
+- Disabled unless FACES_ENABLED=true
+- Embeddings stay in the local database; nothing is matched against
+  outside sources and no names are ever attached to a cluster
+- Skips already scanned images (use --all to rescan)
+- Clusters are rebuilt from scratch after each scan, so cluster IDs change
+- Reads image bytes from the local extracted_images folder
+- Needs numpy (pip install numpy)
+
+Providers:
+  face_recognition  Local dlib detector and 128-d encoder (pip install face_recognition)
+  http              POST image bytes to FACES_API_URL, expects
+                    {"faces": [{"box": [x, y, w, h], "score": 0.0-1.0, "embedding": [...]}]}
+
+Usage:
+  python cluster_faces.py            # scan new images, then recluster
+  python cluster_faces.py --all      # rescan every image, then recluster
+  python cluster_faces.py cluster    # recluster only
+"""
+
+import io
+import json
+import os
+import sqlite3
+import sys
+import logging
+import urllib.request
+
+import numpy as np
+from tqdm import tqdm
+
+import config
+
+logging.basicConfig(
+    level=logging.INFO,
+    format='%(asctime)s - %(levelname)s - %(message)s',
+    handlers=[
+        logging.FileHandler(config.PROJECT_ROOT / "cluster_faces.log"),
+        logging.StreamHandler()
+    ]
+)
+logger = logging.getLogger(__name__)
+
+FACES_ENABLED = os.getenv("FACES_ENABLED", "false").lower() in ("1", "true", "yes")
+FACES_PROVIDER = os.getenv("FACES_PROVIDER", "face_recognition")
+FACES_API_URL = os.getenv("FACES_API_URL", "")
+FACES_API_KEY = os.getenv("FACES_API_KEY", "")
+
+# Detections below this confidence are dropped
+MIN_FACE_SCORE = float(os.getenv("FACES_MIN_SCORE", "0.5"))
+# Faces smaller than this (pixels, either side) are too blurry to cluster
+MIN_FACE_SIZE = int(os.getenv("FACES_MIN_SIZE", "40"))
+# Embeddings closer than this (Euclidean) are linked into one cluster.
+# 0.5 suits face_recognition; other providers need their own value.
+CLUSTER_DISTANCE = float(os.getenv("FACES_CLUSTER_DISTANCE", "0.5"))
+MIN_CLUSTER_SIZE = int(os.getenv("FACES_MIN_CLUSTER_SIZE", "2"))
+
+BATCH_SIZE = 200
+
+
+# ============================================================================
+# PROVIDERS
+# ============================================================================
+
+class FaceRecognitionProvider:
+    """Local dlib HOG detector with the 128-d face_recognition encoder"""
+    name = "face_recognition"
+
+    def __init__(self):
+        import face_recognition
+        from PIL import Image
+        self.fr = face_recognition
+        self.Image = Image
+
+    def detect(self, image_bytes: bytes) -> list:
+        img = np.array(self.Image.open(io.BytesIO(image_bytes)).convert("RGB"))
+        locations = self.fr.face_locations(img)
+        encodings = self.fr.face_encodings(img, known_face_locations=locations)
+        faces = []
+        for (top, right, bottom, left), encoding in zip(locations, encodings):
+            # HOG gives no confidence; every returned box passed its threshold
+            faces.append({
+                "box": [left, top, right - left, bottom - top],
+                "score": 1.0,
+                "embedding": encoding,
+            })
+        return faces
+
+
+class HTTPProvider:
+    """Delegates detection and embedding to an external HTTP service"""
+    name = "http"
+
+    def __init__(self):
+        if not FACES_API_URL:
+            raise RuntimeError("FACES_API_URL is required for the http provider")
+
+    def detect(self, image_bytes: bytes) -> list:
+        headers = {"Content-Type": "application/octet-stream"}
+        if FACES_API_KEY:
+            headers["Authorization"] = f"Bearer {FACES_API_KEY}"
+        req = urllib.request.Request(FACES_API_URL, data=image_bytes, headers=headers, method="POST")
+        with urllib.request.urlopen(req, timeout=60) as resp:
+            result = json.loads(resp.read().decode("utf-8"))
+        return result.get("faces", [])
+
+
+PROVIDERS = {
+    "face_recognition": FaceRecognitionProvider,
+    "http": HTTPProvider,
+}
+
+
+# ============================================================================
+# DETECTION
+# ============================================================================
+
+def scan_images(conn, rescan: bool = False):
+    """Detect faces in unscanned images and store their embeddings"""
+    if FACES_PROVIDER not in PROVIDERS:
+        logger.error(f"Unknown FACES_PROVIDER '{FACES_PROVIDER}'. Options: {', '.join(PROVIDERS)}")
+        return False
+
+    provider = PROVIDERS[FACES_PROVIDER]()
+    logger.info(f"Using face provider: {provider.name}")
+
+    cursor = conn.cursor()
+    where = "" if rescan else "WHERE face_count IS NULL"
+    cursor.execute(f"SELECT id, document_id, filename FROM images {where} ORDER BY id")
+    rows = cursor.fetchall()
+    logger.info(f"Images to scan: {len(rows):,}")
+
+    counts = {"images": 0, "faces": 0, "failed": 0}
+    pending = 0
+
+    for image_id, document_id, filename in tqdm(rows, desc="Detecting faces", unit="img"):
+        path = config.EXTRACTED_IMAGES / document_id / filename
+        try:
+            detections = provider.detect(path.read_bytes())
+        except Exception as e:
+            counts["failed"] += 1
+            logger.debug(f"Failed to scan {path}: {e}")
+            continue
+
+        cursor.execute("DELETE FROM faces WHERE image_id = ?", (image_id,))
+        kept = 0
+        for face in detections:
+            x, y, w, h = (int(v) for v in face["box"])
+            score = float(face.get("score", 1.0))
+            if score < MIN_FACE_SCORE or w < MIN_FACE_SIZE or h < MIN_FACE_SIZE:
+                continue
+            embedding = np.asarray(face["embedding"], dtype="<f4").tobytes()
+            cursor.execute('''
+                INSERT INTO faces (image_id, document_id, x, y, width, height, score, embedding, provider, created_at)
+                VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, datetime('now'))
+            ''', (image_id, document_id, x, y, w, h, score, embedding, provider.name))
+            kept += 1
+
+        cursor.execute("UPDATE images SET face_count = ? WHERE id = ?", (kept, image_id))
+        counts["images"] += 1
+        counts["faces"] += kept
+        pending += 1
+        if pending >= BATCH_SIZE:
+            conn.commit()
+            pending = 0
+
+    conn.commit()
+    logger.info(f"Detection complete: {counts}")
+    return True
+
+
+# ============================================================================
+# CLUSTERING
+# ============================================================================
+
+def link_faces(embeddings: np.ndarray) -> np.ndarray:
+    """Single-linkage clustering: faces closer than CLUSTER_DISTANCE share a root"""
+    n = len(embeddings)
+    parent = np.arange(n)
+
+    def find(i):
+        while parent[i] != i:
+            parent[i] = parent[parent[i]]
+            i = parent[i]
+        return i
+
+    sq = (embeddings ** 2).sum(axis=1)
+    threshold = CLUSTER_DISTANCE ** 2
+    chunk = 1024
+    for start in range(0, n, chunk):
+        block = embeddings[start:start + chunk]
+        dist = sq[start:start + chunk, None] + sq[None, :] - 2 * block @ embeddings.T
+        for i, j in zip(*np.nonzero(dist < threshold)):
+            i += start
+            if i < j:
+                ri, rj = find(i), find(j)
+                if ri != rj:
+                    parent[rj] = ri
+
+    return np.array([find(i) for i in range(n)])
+
+
+def rebuild_clusters(conn):
+    """Replace all face clusters with a fresh clustering of every stored face"""
+    cursor = conn.cursor()
+    cursor.execute("SELECT id, image_id, document_id, score, embedding FROM faces ORDER BY id")
+    rows = cursor.fetchall()
+
+    cursor.execute("UPDATE faces SET cluster_id = NULL")
+    cursor.execute("DELETE FROM face_clusters")
+    if not rows:
+        conn.commit()
+        logger.info("No faces to cluster")
+        return
+
+    sizes = {len(r[4]) for r in rows}
+    if len(sizes) > 1:
+        logger.error(f"Faces have mixed embedding sizes {sorted(sizes)}; rescan with --all after changing provider")
+        conn.rollback()
+        return
+
+    embeddings = np.stack([np.frombuffer(r[4], dtype="<f4") for r in rows])
+    logger.info(f"Clustering {len(rows):,} faces")
+    roots = link_faces(embeddings)
+
+    groups = {}
+    for row, root in zip(rows, roots):
+        groups.setdefault(root, []).append(row)
+
+    clusters = 0
+    for members in sorted(groups.values(), key=len, reverse=True):
+        if len(members) < MIN_CLUSTER_SIZE:
+            continue
+        cover = max(members, key=lambda r: r[3])
+        cursor.execute('''
+            INSERT INTO face_clusters (face_count, image_count, document_count, cover_face_id, cover_image_id, created_at)
+            VALUES (?, ?, ?, ?, ?, datetime('now'))
+        ''', (
+            len(members),
+            len({r[1] for r in members}),
+            len({r[2] for r in members}),
+            cover[0],
+            cover[1],
+        ))
+        cluster_id = cursor.lastrowid
+        cursor.executemany(
+            "UPDATE faces SET cluster_id = ? WHERE id = ?",
+            [(cluster_id, r[0]) for r in members]
+        )
+        clusters += 1
+
+    conn.commit()
+    logger.info(f"Clustering complete: {clusters:,} clusters of {MIN_CLUSTER_SIZE}+ faces")
+
+
+# ============================================================================
+# MAIN
+# ============================================================================
+
+def main(args):
+    if not FACES_ENABLED:
+        logger.error("Face clustering is disabled. Set FACES_ENABLED=true to opt in.")
+        return
+
+    conn = sqlite3.connect(config.DATABASE_PATH)
+    cursor = conn.cursor()
+    cursor.execute("SELECT name FROM sqlite_master WHERE type='table' AND name='faces'")
+    if not cursor.fetchone():
+        conn.close()
+        logger.error("Table 'faces' not found. Start the Go backend once to migrate the database.")
+        return
+
+    if "cluster" not in args:
+        if not scan_images(conn, rescan="--all" in args):
+            conn.close()
+            return
+    rebuild_clusters(conn)
+    conn.close()
+
+
+if __name__ == "__main__":
+    main(sys.argv[1:])
@@ -9,12 +9,20 @@ from dotenv import load_dotenv
 # Load environment variables
 load_dotenv()
 
-# Paths
-PROJECT_ROOT = Path(__file__).parent.parent
+# Paths. ARCHIVE_FILES_DIR points the working directories at one archive's
+# (set by the backend when it serves several, see ARCHIVES_CONFIG)
+PROJECT_ROOT = Path(os.getenv("ARCHIVE_FILES_DIR") or Path(__file__).parent.parent)
+DOWNLOADS = PROJECT_ROOT / "downloads"
 EXTRACTED_IMAGES = PROJECT_ROOT / "extracted_images"
 EXTRACTED_TEXT = PROJECT_ROOT / "extracted_text"
+EXTRACTED_TABLES = PROJECT_ROOT / "extracted_tables"
+EXTRACTED_SPRITES = PROJECT_ROOT / "extracted_sprites"
+DATASETS = PROJECT_ROOT / "datasets"  # per-release README, index and cover letter files
 DATA_DIR = PROJECT_ROOT / "data"
-DATABASE_PATH = DATA_DIR / "archive.db"
+DATABASE_PATH = Path(os.getenv("DATABASE_PATH", DATA_DIR / "archive.db"))  # set by backendctl ingest
+
+# Running backend whose schema version is checked before writing (optional)
+BACKEND_URL = os.getenv("BACKEND_URL", "")
 
 # BunnyCDN Configuration
 BUNNY_STORAGE_ZONE = os.getenv("BUNNY_STORAGE_ZONE", "")
@@ -31,6 +39,36 @@ RETRY_BACKOFF = float(os.getenv("RETRY_BACKOFF", "2.0"))
 # Database batch settings
 DB_BATCH_SIZE = int(os.getenv("DB_BATCH_SIZE", "1000"))
 
+# An ingest lock not refreshed for this long was left by a run that died;
+# shared with the Go backend
+INGEST_LOCK_STALE_MINUTES = int(os.getenv("INGEST_LOCK_STALE_MINUTES", "10"))
+
+# Full-text index tokenizer, shared with the Go backend
+FTS_REMOVE_DIACRITICS = int(os.getenv("FTS_REMOVE_DIACRITICS", "2"))
+FTS_PORTER = os.getenv("FTS_PORTER", "false").lower() in ("1", "true", "yes")
+FTS_STOPWORDS = [
+    w.strip().lower() for w in os.getenv("FTS_STOPWORDS", "").split(",") if w.strip()
+]
+
+
+def fts_tokenizer() -> str:
+    """FTS5 tokenize argument for the configured options"""
+    tokenizer = f"unicode61 remove_diacritics {FTS_REMOVE_DIACRITICS}"
+    if FTS_PORTER:
+        tokenizer = "porter " + tokenizer
+    return tokenizer
+
+
+def download_path(name: str) -> Path:
+    """Path of a downloaded file (PDF or provenance sidecar) by file name:
+    in DOWNLOADS, or else in one of the numbered subfolders the Go
+    downloader's -shard option saves to"""
+    path = DOWNLOADS / name
+    if not path.exists() and DOWNLOADS.exists():
+        for candidate in DOWNLOADS.glob(f"[0-9][0-9][0-9][0-9][0-9][0-9]/{name}"):
+            return candidate
+    return path
+
 
 def validate_bunny_config():
     """Validate BunnyCDN configuration"""
@@ -0,0 +1,195 @@
+"""
+Passage Embedding
+
+Splits page text into overlapping passages and embeds them, so the backend's
+/api/search/passages can return the chunks closest in meaning to a question
+(for retrieval-augmented generation) with their document, page and offsets.
+- Any OpenAI-compatible embeddings endpoint (OpenAI, Ollama, llama.cpp,
+  vLLM, text-embeddings-inference...) via EMBEDDINGS_API_URL
+- Passages of about PASSAGE_CHARS characters, overlapping by PASSAGE_OVERLAP,
+  broken at sentence ends or whitespace
+- Start and end are character offsets into the page text
+- Skips pages already embedded with EMBEDDINGS_MODEL that haven't been
+  re-ingested since (use --all to re-embed)
+- The backend must be configured with the same EMBEDDINGS_MODEL
+
+Examples:
+  EMBEDDINGS_API_URL=http://localhost:11434/v1/embeddings EMBEDDINGS_MODEL=nomic-embed-text
+  EMBEDDINGS_API_URL=https://api.openai.com/v1/embeddings EMBEDDINGS_MODEL=text-embedding-3-small
+"""
+
+import json
+import os
+import sqlite3
+import struct
+import sys
+import logging
+import urllib.request
+from tqdm import tqdm
+
+import config
+
+logging.basicConfig(
+    level=logging.INFO,
+    format='%(asctime)s - %(levelname)s - %(message)s',
+    handlers=[
+        logging.FileHandler(config.PROJECT_ROOT / "embed_passages.log"),
+        logging.StreamHandler()
+    ]
+)
+logger = logging.getLogger(__name__)
+
+EMBEDDINGS_API_URL = os.getenv("EMBEDDINGS_API_URL", "")
+EMBEDDINGS_API_KEY = os.getenv("EMBEDDINGS_API_KEY", "")
+EMBEDDINGS_MODEL = os.getenv("EMBEDDINGS_MODEL", "nomic-embed-text")
+
+PASSAGE_CHARS = int(os.getenv("PASSAGE_CHARS", "1000"))
+PASSAGE_OVERLAP = int(os.getenv("PASSAGE_OVERLAP", "200"))
+PASSAGE_MIN_CHARS = 40  # a shorter tail is dropped; the overlap already covers it
+
+EMBED_BATCH = int(os.getenv("EMBEDDINGS_BATCH", "32"))  # passages per request
+BATCH_SIZE = 200
+
+
+# ============================================================================
+# CHUNKING
+# ============================================================================
+
+def break_at(text: str, start: int, end: int) -> int:
+    """The best place to end a passage in text[start:end]: after the last
+    sentence end in its second half, else the last whitespace, else end"""
+    floor = start + (end - start) // 2
+    for marks in ((". ", "? ", "! ", ".\n", "\n\n"), (" ", "\n", "\t")):
+        best = max(text.rfind(m, floor, end) for m in marks)
+        if best >= floor:
+            return best + 1
+    return end
+
+
+def chunk(text: str) -> list:
+    """Split text into (start, end) passages of about PASSAGE_CHARS, each
+    starting PASSAGE_OVERLAP or so before the previous one ended"""
+    passages = []
+    start = 0
+    while start < len(text):
+        while start < len(text) and text[start].isspace():
+            start += 1
+        if start >= len(text):
+            break
+        end = len(text)
+        if end - start > PASSAGE_CHARS:
+            end = break_at(text, start, start + PASSAGE_CHARS)
+        stop = end
+        while stop > start and text[stop - 1].isspace():
+            stop -= 1
+        if stop - start >= PASSAGE_MIN_CHARS or not passages:
+            passages.append((start, stop))
+        if end >= len(text):
+            break
+        # Step back by the overlap, to a word boundary
+        next_start = max(end - PASSAGE_OVERLAP, start + 1)
+        space = text.find(" ", next_start, end)
+        start = space + 1 if space >= 0 else next_start
+    return passages
+
+
+# ============================================================================
+# EMBEDDING
+# ============================================================================
+
+def embed(texts: list) -> list:
+    """Embeddings of texts, in order"""
+    headers = {"Content-Type": "application/json"}
+    if EMBEDDINGS_API_KEY:
+        headers["Authorization"] = f"Bearer {EMBEDDINGS_API_KEY}"
+    body = json.dumps({"model": EMBEDDINGS_MODEL, "input": texts}).encode("utf-8")
+    req = urllib.request.Request(EMBEDDINGS_API_URL, data=body, headers=headers, method="POST")
+    with urllib.request.urlopen(req, timeout=120) as resp:
+        result = json.loads(resp.read().decode("utf-8"))
+    data = sorted(result["data"], key=lambda d: d.get("index", 0))
+    if len(data) != len(texts):
+        raise RuntimeError(f"asked for {len(texts)} embeddings, got {len(data)}")
+    return [d["embedding"] for d in data]
+
+
+def pack(vector: list) -> bytes:
+    """Little-endian float32, as the backend reads it"""
+    return struct.pack(f"<{len(vector)}f", *vector)
+
+
+# ============================================================================
+# MAIN
+# ============================================================================
+
+def main(reembed: bool = False):
+    if not EMBEDDINGS_API_URL:
+        logger.error("EMBEDDINGS_API_URL is required")
+        return
+    logger.info(f"Embedding with {EMBEDDINGS_MODEL} at {EMBEDDINGS_API_URL}")
+
+    conn = sqlite3.connect(config.DATABASE_PATH)
+    cursor = conn.cursor()
+
+    cursor.execute("SELECT name FROM sqlite_master WHERE type='table' AND name = 'passages'")
+    if not cursor.fetchone():
+        logger.error("No passages table; start the backend once to migrate the database")
+        return
+
+    # A page is re-embedded when populate_db rewrote it after its passages
+    where = ["p.is_blank = 0", "TRIM(COALESCE(p.text, '')) != ''"]
+    params = []
+    if not reembed:
+        where.append('''NOT EXISTS (
+            SELECT 1 FROM passages s
+            WHERE s.document_id = p.document_id AND s.page = p.number AND s.model = ?
+              AND s.created_at >= p.created_at
+        )''')
+        params.append(EMBEDDINGS_MODEL)
+    cursor.execute(
+        f"SELECT p.document_id, p.number, p.text FROM pages p WHERE {' AND '.join(where)} "
+        "ORDER BY p.document_id, p.number", params
+    )
+    pages = cursor.fetchall()
+    logger.info(f"Pages to embed: {len(pages):,}")
+
+    counts = {"pages": 0, "passages": 0, "failed": 0}
+    pending = 0
+
+    for document_id, number, text in tqdm(pages, desc="Embedding", unit="page"):
+        spans = chunk(text)
+        try:
+            vectors = []
+            for i in range(0, len(spans), EMBED_BATCH):
+                vectors += embed([text[s:e] for s, e in spans[i:i + EMBED_BATCH]])
+        except Exception as e:
+            counts["failed"] += 1
+            logger.debug(f"Failed to embed {document_id} page {number}: {e}")
+            continue
+
+        cursor.execute(
+            "DELETE FROM passages WHERE document_id = ? AND page = ? AND model = ?",
+            (document_id, number, EMBEDDINGS_MODEL)
+        )
+        cursor.executemany('''
+            INSERT INTO passages (document_id, page, "start", "end", text, embedding, model, created_at)
+            VALUES (?, ?, ?, ?, ?, ?, ?, datetime('now'))
+        ''', [
+            (document_id, number, s, e, text[s:e], pack(v), EMBEDDINGS_MODEL)
+            for (s, e), v in zip(spans, vectors)
+        ])
+
+        counts["pages"] += 1
+        counts["passages"] += len(spans)
+        pending += 1
+        if pending >= BATCH_SIZE:
+            conn.commit()
+            pending = 0
+
+    conn.commit()
+    conn.close()
+
+    logger.info(f"Embedding complete: {counts}")
+
+
+if __name__ == "__main__":
+    main(reembed="--all" in sys.argv)
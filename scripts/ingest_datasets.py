@@ -0,0 +1,185 @@
+"""
+Dataset Metadata Ingestion
+
+Records each DOJ release and the files shipped alongside it (README, index,
+cover letter, manifest) so the archive keeps the official context of every
+dataset, served by GET /api/datasets/:id.
+- Reads datasets/<number>/ folders (e.g. datasets/9/ for DataSet 9)
+- An optional dataset.json in a folder sets name, source_url, released_at
+  and notes, plus per-file source_url and kind overrides:
+    {"name": "DataSet 9", "source_url": "https://.../DataSet%209/",
+     "released_at": "2025-12-19", "files": {"index.csv": {"kind": "index"}}}
+- Files are kept verbatim under datasets/ (upload_to_cdn.py uploads them for
+  the cdn storage backend), hashed, and their text extracted for display
+- Skips files whose hash is unchanged (use --all to re-extract)
+- Holds the ingest lock (ingest_lock.py) while it writes, after checking
+  the schema version (schema.py)
+"""
+
+import hashlib
+import json
+import mimetypes
+import re
+import sqlite3
+import sys
+import logging
+
+import fitz  # PyMuPDF
+
+import config
+from ingest_lock import IngestLockError, ingest_lock
+from schema import SchemaError
+
+logging.basicConfig(
+    level=logging.INFO,
+    format='%(asctime)s - %(levelname)s - %(message)s',
+    handlers=[
+        logging.FileHandler(config.PROJECT_ROOT / "ingest_datasets.log"),
+        logging.StreamHandler()
+    ]
+)
+logger = logging.getLogger(__name__)
+
+DATASET_INFO = "dataset.json"
+
+# First match wins; anything else is "other"
+KIND_PATTERNS = [
+    ("cover_letter", re.compile(r"cover|letter|transmittal", re.IGNORECASE)),
+    ("readme", re.compile(r"read[\s_-]*me", re.IGNORECASE)),
+    ("index", re.compile(r"index|\bidx\b|load[\s_-]*file|\.(dat|opt|lst)$", re.IGNORECASE)),
+    ("manifest", re.compile(r"manifest|checksum|hash|\.(sha256|md5)$", re.IGNORECASE)),
+]
+
+TEXT_SUFFIXES = {".txt", ".md", ".csv", ".tsv", ".json", ".dat", ".opt", ".lst", ".sha256", ".md5", ".xml"}
+
+
+def guess_kind(filename: str) -> str:
+    for kind, pattern in KIND_PATTERNS:
+        if pattern.search(filename):
+            return kind
+    return "other"
+
+
+def extract_text(path) -> str:
+    """Text of a PDF or plain-text file; other formats have none"""
+    suffix = path.suffix.lower()
+    if suffix == ".pdf":
+        with fitz.open(path) as doc:
+            return "\n".join(page.get_text() for page in doc).strip()
+    if suffix in TEXT_SUFFIXES:
+        return path.read_text(encoding="utf-8", errors="replace")
+    return ""
+
+
+def file_hash(path) -> str:
+    h = hashlib.sha256()
+    with open(path, "rb") as f:
+        for chunk in iter(lambda: f.read(1 << 20), b""):
+            h.update(chunk)
+    return h.hexdigest()
+
+
+def ingest_dataset(cursor, folder, reextract: bool) -> dict:
+    dataset_id = int(folder.name)
+    info = {}
+    info_path = folder / DATASET_INFO
+    if info_path.exists():
+        info = json.loads(info_path.read_text(encoding="utf-8"))
+
+    cursor.execute('''
+        INSERT INTO datasets (id, name, source_url, released_at, notes, created_at, updated_at)
+        VALUES (?, ?, ?, ?, ?, datetime('now'), datetime('now'))
+        ON CONFLICT(id) DO UPDATE SET
+            name = excluded.name,
+            source_url = excluded.source_url,
+            released_at = excluded.released_at,
+            notes = excluded.notes,
+            updated_at = excluded.updated_at
+    ''', (
+        dataset_id,
+        info.get("name") or f"DataSet {dataset_id}",
+        info.get("source_url", ""),
+        info.get("released_at"),
+        info.get("notes", ""),
+    ))
+
+    counts = {"files": 0, "skipped": 0}
+    overrides = info.get("files", {})
+    for path in sorted(folder.iterdir()):
+        if not path.is_file() or path.name == DATASET_INFO or path.name.startswith("."):
+            continue
+
+        sha256 = file_hash(path)
+        cursor.execute(
+            "SELECT sha256 FROM dataset_files WHERE dataset_id = ? AND filename = ?",
+            (dataset_id, path.name)
+        )
+        row = cursor.fetchone()
+        if row and row[0] == sha256 and not reextract:
+            counts["skipped"] += 1
+            continue
+
+        override = overrides.get(path.name, {})
+        try:
+            text = extract_text(path)
+        except Exception as e:
+            logger.warning(f"Could not extract text from {path}: {e}")
+            text = ""
+
+        cursor.execute('''
+            INSERT INTO dataset_files
+                (dataset_id, filename, kind, source_url, content_type, size_bytes, sha256, text, created_at)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, datetime('now'))
+            ON CONFLICT(dataset_id, filename) DO UPDATE SET
+                kind = excluded.kind,
+                source_url = excluded.source_url,
+                content_type = excluded.content_type,
+                size_bytes = excluded.size_bytes,
+                sha256 = excluded.sha256,
+                text = excluded.text
+        ''', (
+            dataset_id,
+            path.name,
+            override.get("kind") or guess_kind(path.name),
+            override.get("source_url", ""),
+            mimetypes.guess_type(path.name)[0] or "application/octet-stream",
+            path.stat().st_size,
+            sha256,
+            text,
+        ))
+        counts["files"] += 1
+
+    return counts
+
+
+def main(reextract: bool = False):
+    if not config.DATASETS.exists():
+        logger.error(f"Datasets directory not found: {config.DATASETS}")
+        return
+
+    conn = sqlite3.connect(config.DATABASE_PATH)
+    cursor = conn.cursor()
+    cursor.execute("SELECT name FROM sqlite_master WHERE type='table' AND name='dataset_files'")
+    if not cursor.fetchone():
+        conn.close()
+        logger.error("Table 'dataset_files' not found. Start the Go backend once to migrate the database.")
+        return
+
+    try:
+        with ingest_lock("ingest_datasets.py") as lock:
+            for folder in sorted(config.DATASETS.iterdir()):
+                if not folder.is_dir() or not folder.name.isdigit():
+                    continue
+                lock.check()
+                counts = ingest_dataset(cursor, folder, reextract)
+                conn.commit()
+                logger.info(f"DataSet {int(folder.name)}: {counts['files']} files ingested, {counts['skipped']} unchanged")
+    except (IngestLockError, SchemaError) as e:
+        logger.error(str(e))
+        sys.exit(1)
+    finally:
+        conn.close()
+
+
+if __name__ == "__main__":
+    main(reextract="--all" in sys.argv)
@@ -0,0 +1,159 @@
+"""
+Ingest Lock
+
+An advisory lock held for the length of an ingest, so two runs against the
+same database can't interleave their writes. The lock is a row in the
+ingest_locks table (created by the Go backend):
+- Taken in an IMMEDIATE transaction, so only one process can win it
+- Refreshed every minute by a background thread; a lock whose heartbeat is
+  older than INGEST_LOCK_STALE_MINUTES was left by a run that died and is
+  taken over, so a run whose heartbeats keep failing that long stops
+- Released when the run ends, however it ends
+- Only taken when the database is on the schema version the scripts write
+
+    with ingest_lock("populate_db") as lock:
+        ...
+        lock.check()  # between batches: stop if the lock was lost
+"""
+
+import os
+import socket
+import sqlite3
+import threading
+import time
+import logging
+from contextlib import contextmanager
+
+import config
+import schema
+
+logger = logging.getLogger(__name__)
+
+LOCK_NAME = "ingest"  # models.IngestLockName
+HEARTBEAT_SECONDS = 60
+
+
+class IngestLockError(RuntimeError):
+    """Another ingest holds the lock, or this one lost it"""
+
+
+class IngestLock:
+    def __init__(self, owner: str):
+        self.owner = owner
+        self.lost = False
+        self._stop = threading.Event()
+        self._thread = threading.Thread(target=self._heartbeat, daemon=True)
+
+    def check(self):
+        """Raise if the lock was taken over or removed meanwhile"""
+        if self.lost:
+            raise IngestLockError("Ingest lock lost (taken over or removed with 'unlock'); stopping")
+
+    def _heartbeat(self):
+        # A heartbeat that fails (say the database stays locked) is retried on
+        # the next tick; once the lock would go stale before the one after,
+        # another run may take it over, so it counts as lost
+        stale_seconds = config.INGEST_LOCK_STALE_MINUTES * 60
+        last_beat = time.monotonic()
+        conn = connect()
+        try:
+            while not self._stop.wait(HEARTBEAT_SECONDS):
+                try:
+                    cursor = conn.execute(
+                        "UPDATE ingest_locks SET heartbeat_at = CURRENT_TIMESTAMP WHERE name = ? AND owner = ?",
+                        (LOCK_NAME, self.owner)
+                    )
+                except sqlite3.Error as e:
+                    if time.monotonic() - last_beat + HEARTBEAT_SECONDS < stale_seconds:
+                        logger.warning(f"Ingest lock heartbeat failed, retrying: {e}")
+                        continue
+                    self.lost = True
+                    logger.error(f"Ingest lock heartbeats kept failing ({e}); it may be taken over, so this run will stop at the next batch")
+                    return
+                if cursor.rowcount == 0:
+                    self.lost = True
+                    logger.error("Ingest lock lost; this run will stop at the next batch")
+                    return
+                last_beat = time.monotonic()
+        finally:
+            conn.close()
+
+
+def connect():
+    # Autocommit, so transactions are only the ones begun explicitly
+    return sqlite3.connect(config.DATABASE_PATH, timeout=30, isolation_level=None)
+
+
+def acquire(command: str) -> IngestLock:
+    """Take the lock or raise IngestLockError naming the current holder.
+    Raises schema.SchemaError first if the database is on another schema."""
+    schema.check()
+    owner = f"{socket.gethostname()}:{os.getpid()} {command}"
+    stale = f"-{config.INGEST_LOCK_STALE_MINUTES} minutes"
+
+    conn = connect()
+    try:
+        conn.execute("BEGIN IMMEDIATE")
+        try:
+            row = conn.execute(
+                "SELECT owner, acquired_at, heartbeat_at, heartbeat_at < datetime('now', ?) FROM ingest_locks WHERE name = ?",
+                (stale, LOCK_NAME)
+            ).fetchone()
+        except sqlite3.OperationalError as e:
+            conn.execute("ROLLBACK")
+            raise IngestLockError(f"{e}. Start the Go backend once to migrate the database.")
+
+        if row and not row[3]:
+            conn.execute("ROLLBACK")
+            raise IngestLockError(
+                f"Another ingest is running: {row[0]}, since {row[1]} UTC (last heartbeat {row[2]} UTC). "
+                f"Wait for it to finish. If it died, its lock expires {config.INGEST_LOCK_STALE_MINUTES} "
+                f"minutes after the last heartbeat, or remove it with 'python populate_db.py unlock'."
+            )
+        if row:
+            logger.warning(f"Taking over the ingest lock abandoned by {row[0]} (last heartbeat {row[2]} UTC)")
+
+        conn.execute(
+            "INSERT OR REPLACE INTO ingest_locks (name, owner, acquired_at, heartbeat_at) VALUES (?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)",
+            (LOCK_NAME, owner)
+        )
+        conn.execute("COMMIT")
+    finally:
+        conn.close()
+
+    lock = IngestLock(owner)
+    lock._thread.start()
+    return lock
+
+
+def release(lock: IngestLock):
+    lock._stop.set()
+    lock._thread.join()
+    conn = connect()
+    try:
+        conn.execute("DELETE FROM ingest_locks WHERE name = ? AND owner = ?", (LOCK_NAME, lock.owner))
+    finally:
+        conn.close()
+
+
+@contextmanager
+def ingest_lock(command: str):
+    lock = acquire(command)
+    try:
+        yield lock
+    finally:
+        release(lock)
+
+
+def unlock():
+    """Remove the lock, whoever holds it; for a run that died"""
+    conn = connect()
+    try:
+        row = conn.execute("SELECT owner FROM ingest_locks WHERE name = ?", (LOCK_NAME,)).fetchone()
+        conn.execute("DELETE FROM ingest_locks WHERE name = ?", (LOCK_NAME,))
+    finally:
+        conn.close()
+    if row:
+        logger.info(f"Removed the ingest lock held by {row[0]}")
+    else:
+        logger.info("No ingest lock was held")
@@ -0,0 +1,182 @@
+"""
+Image OCR
+
+Reads the text inside pictures (signs, papers held up to the camera,
+whiteboards, screens) so image search can find it. Page OCR only covers the
+text layer of scanned pages; this runs over the extracted images themselves.
+- Pluggable providers selected with OCR_PROVIDER
+- Lines are kept when their mean word confidence is at least
+  OCR_MIN_CONFIDENCE; an image with none gets empty text
+- Skips blank images and those tagged as page scans (OCR_SKIP_TAGS), whose
+  text page OCR already has
+- Skips already read images (use --all to reread)
+- Reads image bytes from the local extracted_images folder
+
+Providers:
+  tesseract  Local Tesseract (pip install pytesseract, plus the tesseract
+             binary); OCR_LANGUAGES picks its languages, e.g. "eng+fra"
+  http       POST image bytes to OCR_API_URL, expects
+             {"lines": [{"text": "...", "confidence": 0.0-1.0}]}
+"""
+
+import io
+import json
+import os
+import sqlite3
+import sys
+import logging
+import urllib.request
+from tqdm import tqdm
+
+import config
+
+logging.basicConfig(
+    level=logging.INFO,
+    format='%(asctime)s - %(levelname)s - %(message)s',
+    handlers=[
+        logging.FileHandler(config.PROJECT_ROOT / "ocr_images.log"),
+        logging.StreamHandler()
+    ]
+)
+logger = logging.getLogger(__name__)
+
+OCR_PROVIDER = os.getenv("OCR_PROVIDER", "tesseract")
+OCR_API_URL = os.getenv("OCR_API_URL", "")
+OCR_API_KEY = os.getenv("OCR_API_KEY", "")
+OCR_LANGUAGES = os.getenv("OCR_LANGUAGES", "eng")
+
+OCR_MIN_CONFIDENCE = float(os.getenv("OCR_MIN_CONFIDENCE", "0.6"))
+
+# Tags (from tag_images.py) of images that are pages rather than photos
+OCR_SKIP_TAGS = [
+    t.strip().lower() for t in os.getenv("OCR_SKIP_TAGS", "document scan,typed letter").split(",") if t.strip()
+]
+
+BATCH_SIZE = 200
+
+
+# ============================================================================
+# PROVIDERS
+# ============================================================================
+
+class TesseractProvider:
+    """Local Tesseract; word confidences are averaged per line"""
+    name = "tesseract"
+
+    def __init__(self):
+        import pytesseract
+        from PIL import Image
+        self.pytesseract = pytesseract
+        self.Image = Image
+
+    def read(self, image_bytes: bytes) -> list:
+        img = self.Image.open(io.BytesIO(image_bytes)).convert("RGB")
+        data = self.pytesseract.image_to_data(
+            img, lang=OCR_LANGUAGES, output_type=self.pytesseract.Output.DICT
+        )
+        lines = {}
+        for i, word in enumerate(data["text"]):
+            conf = float(data["conf"][i])
+            if not word.strip() or conf < 0:
+                continue
+            key = (data["block_num"][i], data["par_num"][i], data["line_num"][i])
+            lines.setdefault(key, []).append((word.strip(), conf / 100))
+        return [
+            (" ".join(w for w, _ in words), sum(c for _, c in words) / len(words))
+            for _, words in sorted(lines.items())
+        ]
+
+
+class HTTPProvider:
+    """Delegates OCR to an external HTTP service"""
+    name = "http"
+
+    def __init__(self):
+        if not OCR_API_URL:
+            raise RuntimeError("OCR_API_URL is required for the http provider")
+
+    def read(self, image_bytes: bytes) -> list:
+        headers = {"Content-Type": "application/octet-stream"}
+        if OCR_API_KEY:
+            headers["Authorization"] = f"Bearer {OCR_API_KEY}"
+        req = urllib.request.Request(OCR_API_URL, data=image_bytes, headers=headers, method="POST")
+        with urllib.request.urlopen(req, timeout=60) as resp:
+            result = json.loads(resp.read().decode("utf-8"))
+        return [(l["text"], float(l.get("confidence", 0.0))) for l in result.get("lines", [])]
+
+
+PROVIDERS = {
+    "tesseract": TesseractProvider,
+    "http": HTTPProvider,
+}
+
+
+def select_text(lines: list) -> str:
+    """Confident lines with at least one letter or digit, one per line"""
+    kept = []
+    for text, confidence in lines:
+        text = " ".join(text.split())
+        if confidence >= OCR_MIN_CONFIDENCE and any(c.isalnum() for c in text):
+            kept.append(text)
+    return "\n".join(kept)
+
+
+# ============================================================================
+# MAIN
+# ============================================================================
+
+def main(reread: bool = False):
+    if OCR_PROVIDER not in PROVIDERS:
+        logger.error(f"Unknown OCR_PROVIDER '{OCR_PROVIDER}'. Options: {', '.join(PROVIDERS)}")
+        return
+
+    provider = PROVIDERS[OCR_PROVIDER]()
+    logger.info(f"Using OCR provider: {provider.name}")
+
+    conn = sqlite3.connect(config.DATABASE_PATH)
+    cursor = conn.cursor()
+
+    where = ["is_blank = 0"]
+    if not reread:
+        where.append("ocr_at IS NULL")
+    if OCR_SKIP_TAGS:
+        marks = ", ".join("?" * len(OCR_SKIP_TAGS))
+        where.append(f"id NOT IN (SELECT image_id FROM image_tags WHERE tag IN ({marks}))")
+    cursor.execute(
+        f"SELECT id, document_id, filename FROM images WHERE {' AND '.join(where)} ORDER BY id", OCR_SKIP_TAGS
+    )
+    rows = cursor.fetchall()
+    logger.info(f"Images to read: {len(rows):,}")
+
+    counts = {"read": 0, "with_text": 0, "failed": 0}
+    pending = 0
+
+    for image_id, document_id, filename in tqdm(rows, desc="Reading", unit="img"):
+        path = config.EXTRACTED_IMAGES / document_id / filename
+        try:
+            text = select_text(provider.read(path.read_bytes()))
+        except Exception as e:
+            counts["failed"] += 1
+            logger.debug(f"Failed to read {path}: {e}")
+            continue
+
+        cursor.execute(
+            "UPDATE images SET ocr_text = ?, ocr_at = datetime('now') WHERE id = ?", (text, image_id)
+        )
+
+        counts["read"] += 1
+        if text:
+            counts["with_text"] += 1
+        pending += 1
+        if pending >= BATCH_SIZE:
+            conn.commit()
+            pending = 0
+
+    conn.commit()
+    conn.close()
+
+    logger.info(f"OCR complete: {counts}")
+
+
+if __name__ == "__main__":
+    main(reread="--all" in sys.argv)
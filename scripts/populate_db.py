@@ -7,19 +7,27 @@ Populates SQLite database with document and image metadata.
 - Batch inserts for performance
 - Resume capability
 - Detailed error logging
+- Holds the ingest lock (ingest_lock.py) so two runs can't interleave, and
+  upserts rows so re-running never duplicates them
+- Refuses to write a database on another schema version (schema.py)
 """
 
+import hashlib
 import json
 import sqlite3
 import time
 import logging
 import re
+import urllib.parse
+import urllib.request
 from pathlib import Path
 from datetime import datetime
 from tqdm import tqdm
 from typing import Optional
 
 import config
+from ingest_lock import IngestLockError, ingest_lock, unlock
+from schema import SchemaError
 
 # ============================================================================
 # LOGGING SETUP
@@ -58,11 +66,12 @@ def init_database():
     conn = sqlite3.connect(config.DATABASE_PATH)
     cursor = conn.cursor()
 
-    # Verify tables exist
-    cursor.execute("SELECT name FROM sqlite_master WHERE type='table' AND name='documents'")
-    if not cursor.fetchone():
+    # Verify tables exist; document_texts is missing until a backend
+    # upgraded from storing text on documents has migrated the schema
+    cursor.execute("SELECT name FROM sqlite_master WHERE type='table' AND name IN ('documents', 'document_texts')")
+    if len(cursor.fetchall()) < 2:
         conn.close()
-        logger.error("Tables not found. Please start the Go backend first to create tables.")
+        logger.error("Tables not found. Please start the Go backend first to create or migrate tables.")
         return False
 
     conn.close()
@@ -128,16 +137,157 @@ def sanitize_text(text: str) -> str:
     return text
 
 
+def file_sha256(path: Path) -> str:
+    """SHA-256 of a file, or empty string if it is missing"""
+    if not path.exists():
+        return ""
+    h = hashlib.sha256()
+    with open(path, 'rb') as f:
+        for chunk in iter(lambda: f.read(1 << 20), b''):
+            h.update(chunk)
+    return h.hexdigest()
+
+
+# Megapixel upper bounds per size class; must match models.SizeClasses
+SIZE_CLASSES = [("tiny", 0.1), ("small", 0.5), ("medium", 2), ("large", 8)]
+
+
+def size_class(width: int, height: int) -> str:
+    """Bucket image dimensions into a size class, empty if unknown"""
+    if not width or not height:
+        return ""
+    mp = width * height / 1e6
+    for name, max_mp in SIZE_CLASSES:
+        if mp < max_mp:
+            return name
+    return "xlarge"
+
+
+def orientation(width: int, height: int) -> str:
+    """Portrait, landscape or square, empty if unknown; matches models.OrientationFor"""
+    if not width or not height:
+        return ""
+    if height > width:
+        return "portrait"
+    if width > height:
+        return "landscape"
+    return "square"
+
+
+# The commonest words of each language detect_language tells apart
+LANGUAGE_WORDS = {
+    "en": {"the", "and", "of", "to", "in", "is", "that", "for", "it", "with", "was", "on", "as", "be", "by", "this", "are", "from", "at", "have"},
+    "es": {"de", "la", "que", "el", "en", "los", "del", "las", "por", "con", "una", "para", "es", "se", "no", "al", "lo", "su", "como", "más"},
+    "fr": {"de", "la", "le", "et", "les", "des", "en", "du", "un", "une", "est", "que", "pour", "dans", "qui", "pas", "sur", "au", "par", "ce"},
+    "de": {"der", "die", "und", "den", "das", "von", "zu", "mit", "ist", "des", "sich", "nicht", "auf", "für", "ein", "eine", "dem", "im", "auch", "es"},
+    "it": {"di", "che", "il", "la", "per", "non", "una", "del", "della", "sono", "con", "le", "si", "da", "gli", "alla", "nel", "anche", "come", "questo"},
+    "pt": {"de", "que", "não", "uma", "para", "com", "os", "do", "da", "em", "as", "se", "por", "dos", "mais", "das", "ao", "ou", "ser", "foi"},
+    "nl": {"de", "het", "een", "van", "en", "niet", "dat", "zijn", "op", "te", "voor", "met", "die", "aan", "er", "ook", "als", "maar", "bij", "wordt"},
+}
+
+WORD_PATTERN = re.compile(r"[^\W\d_]+(?:['’][^\W\d_]+)*")
+SENTENCE_END = re.compile(r"[.!?]+")
+VOWEL_GROUPS = re.compile(r"[aeiouy]+")
+
+# Flesch reading ease is an English formula, and noisy on short texts
+READING_EASE_MIN_WORDS = 100
+
+
+def detect_language(words: list) -> str:
+    """ISO 639-1 code of the language whose common words make up the most of
+    words, or empty when too few of them do (garbled OCR, lists of names)"""
+    counts = dict.fromkeys(LANGUAGE_WORDS, 0)
+    for word in words:
+        for lang, common in LANGUAGE_WORDS.items():
+            if word in common:
+                counts[lang] += 1
+    ranked = sorted(counts.items(), key=lambda item: item[1], reverse=True)
+    (best, hits), (_, runner_up) = ranked[0], ranked[1]
+    if hits < max(5, 0.05 * len(words)) or hits == runner_up:
+        return ""
+    return best
+
+
+def syllables(word: str) -> int:
+    """Rough English syllable count: vowel groups, less a silent final e"""
+    count = len(VOWEL_GROUPS.findall(word))
+    if word.endswith("e") and not word.endswith("le") and count > 1:
+        count -= 1
+    return max(count, 1)
+
+
+def text_stats(text: str) -> dict:
+    """Word count, language and readability of a document's text"""
+    words = [w.lower() for w in WORD_PATTERN.findall(text or "")]
+    stats = {"word_count": len(words), "language": "", "avg_word_length": 0.0, "reading_ease": None}
+    if not words:
+        return stats
+
+    stats["language"] = detect_language(words)
+    stats["avg_word_length"] = round(sum(len(w) for w in words) / len(words), 2)
+    if stats["language"] == "en" and len(words) >= READING_EASE_MIN_WORDS:
+        sentences = max(len(SENTENCE_END.findall(text)), 1)
+        syllable_count = sum(syllables(w) for w in words)
+        stats["reading_ease"] = round(
+            206.835 - 1.015 * len(words) / sentences - 84.6 * syllable_count / len(words), 1
+        )
+    return stats
+
+
+def text_source(pages: list) -> tuple:
+    """Where a document's text came from over its pages with any: "native",
+    "ocr" or "mixed", with the mean estimated confidence of the OCR pages.
+    Empty for no text, or text extracted before OCR layers were detected;
+    extract_pdf_content.py detect-ocr adds them."""
+    text_pages = [p for p in pages if (p.get("text") or "").strip()]
+    if not text_pages or not all("ocr_confidence" in p for p in pages):
+        return "", None
+    ocr = [p["ocr_confidence"] for p in text_pages if p["ocr_confidence"] is not None]
+    if not ocr:
+        return "native", None
+    source = "ocr" if len(ocr) == len(text_pages) else "mixed"
+    return source, round(sum(ocr) / len(ocr), 3)
+
+
+def load_text_data(pdf_name: str) -> dict:
+    """Read the text the extractor saved for a PDF, empty if there is none"""
+    text_file = config.EXTRACTED_TEXT / f"{pdf_name}.json"
+    if not text_file.exists():
+        return {}
+    with open(text_file, 'r', encoding='utf-8') as f:
+        return json.load(f)
+
+
+def load_provenance(pdf_name: str) -> dict:
+    """Read the provenance sidecar the downloader wrote next to the PDF"""
+    sidecar = config.download_path(f"{pdf_name}.provenance.json")
+    if not sidecar.exists():
+        return {}
+    try:
+        with open(sidecar, 'r') as f:
+            return json.load(f)
+    except (OSError, json.JSONDecodeError) as e:
+        error_logger.error(f"Bad provenance sidecar {sidecar}: {e}")
+        return {}
+
+
+def wayback_lookup(url: str) -> str:
+    """Closest Internet Archive capture of url, or empty string"""
+    query = urllib.parse.urlencode({"url": url})
+    try:
+        with urllib.request.urlopen(f"https://archive.org/wayback/available?{query}", timeout=30) as resp:
+            closest = json.load(resp).get("archived_snapshots", {}).get("closest", {})
+    except (OSError, ValueError) as e:
+        error_logger.error(f"Wayback lookup failed for {url}: {e}")
+        return ""
+    return closest.get("url", "") if closest.get("available") else ""
+
+
 def load_document_data(pdf_name: str, cdn_mapping: dict) -> Optional[dict]:
     """Load all data for a single document"""
     try:
         # Load text data
-        text_file = config.EXTRACTED_TEXT / f"{pdf_name}.json"
-        text_data = {"pages": [], "full_text": "", "page_count": 0}
-
-        if text_file.exists():
-            with open(text_file, 'r', encoding='utf-8') as f:
-                text_data = json.load(f)
+        text_data = load_text_data(pdf_name) or {"pages": [], "full_text": "", "page_count": 0}
 
         # Load image metadata
         images_dir = config.EXTRACTED_IMAGES / pdf_name
@@ -155,12 +305,12 @@ def load_document_data(pdf_name: str, cdn_mapping: dict) -> Optional[dict]:
                 # Get CDN URL from mapping
                 cdn_url = cdn_mapping.get(local_path, "")
 
-                # Get page text
+                # Get page blank flag
                 page_num = img_info.get("page", 1)
-                page_text = ""
+                page_blank = False
                 for page in text_data.get("pages", []):
                     if page.get("page") == page_num:
-                        page_text = sanitize_text(page.get("text", ""))
+                        page_blank = page.get("is_blank", False)
                         break
 
                 # Extract EXIF data
@@ -179,26 +329,122 @@ def load_document_data(pdf_name: str, cdn_mapping: dict) -> Optional[dict]:
                     combined_exif.get("DateTime", "")
                 )
 
+                quality = metadata.get("quality", {})
+                color = metadata.get("color", {})
+                width = img_info.get("width", 0)
+                height = img_info.get("height", 0)
+
                 images.append({
                     "page": page_num,
                     "filename": img_filename,
                     "cdn_url": cdn_url,
-                    "width": img_info.get("width", 0),
-                    "height": img_info.get("height", 0),
+                    "width": width,
+                    "height": height,
                     "size_bytes": img_info.get("size_bytes", 0),
                     "format": metadata.get("image_info", {}).get("format", ""),
+                    "sha256": file_sha256(images_dir / img_filename),
                     "exif": json.dumps(combined_exif) if combined_exif else None,
                     "has_gps": has_gps,
                     "date_taken": date_taken,
-                    "page_text": page_text
+                    "sharpness": quality.get("sharpness", 0),
+                    "brightness": quality.get("brightness", 0),
+                    "quality": quality.get("quality", 0),
+                    "is_blank": page_blank or metadata.get("is_blank", False),
+                    "is_color": color.get("is_color"),
+                    "colorfulness": color.get("colorfulness", 0),
+                    "megapixels": round(width * height / 1e6, 2),
+                    "size_class": size_class(width, height),
+                    "orientation": orientation(width, height)
+                })
+
+        # Load extracted tables
+        tables = []
+        tables_dir = config.EXTRACTED_TABLES / pdf_name
+        tables_index = tables_dir / "tables.json"
+        if tables_index.exists():
+            with open(tables_index, 'r', encoding='utf-8') as f:
+                tables_data = json.load(f)
+
+            for table_info in tables_data.get("tables", []):
+                csv_path = tables_dir / table_info["filename"]
+                if not csv_path.exists():
+                    continue
+                tables.append({
+                    "page": table_info.get("page", 1),
+                    "table_index": table_info.get("table_index", 1),
+                    "row_count": table_info.get("row_count", 0),
+                    "column_count": table_info.get("column_count", 0),
+                    "extractor": tables_data.get("extractor", ""),
+                    "csv": sanitize_text(csv_path.read_text(encoding='utf-8'))
+                })
+
+        # Load sprite sheet grid metadata
+        sprites = []
+        sprites_dir = config.EXTRACTED_SPRITES / pdf_name
+        sprite_index = sprites_dir / "sprite.json"
+        if sprite_index.exists():
+            with open(sprite_index, 'r', encoding='utf-8') as f:
+                sprite_data = json.load(f)
+
+            for sheet in sprite_data.get("sheets", []):
+                sprites.append({
+                    "sheet": sheet["sheet"],
+                    "cdn_url": cdn_mapping.get(str(sprites_dir / sheet["filename"]), ""),
+                    "tile_width": sprite_data.get("tile_width", 0),
+                    "tile_height": sprite_data.get("tile_height", 0),
+                    "columns": sheet.get("columns", 0),
+                    "rows": sheet.get("rows", 0),
+                    "first_page": sheet.get("first_page", 1),
+                    "page_count": sheet.get("page_count", 0)
                 })
 
+        # Pages with reading-order text
+        pages = []
+        for page in text_data.get("pages", []):
+            pages.append({
+                "number": page.get("page", 1),
+                "text": sanitize_text(page.get("text", "")),
+                "ocr_confidence": page.get("ocr_confidence"),
+                "width": page.get("width", 0),
+                "height": page.get("height", 0),
+                "rotation": page.get("rotation", 0),
+                "correction_rotation": page.get("correction_rotation", 0),
+                "skew_angle": page.get("skew_angle", 0.0),
+                "is_blank": page.get("is_blank", False)
+            })
+
+        pdf_path = config.download_path(f"{pdf_name}.pdf")
+        sha256 = file_sha256(pdf_path)
+        full_text = sanitize_text(text_data.get("full_text", ""))
+        source, ocr_confidence = text_source(text_data.get("pages", []))
+
+        provenance = load_provenance(pdf_name)
+        if sha256 and provenance.get("sha256") and provenance["sha256"] != sha256:
+            error_logger.error(f"{pdf_name}: file hash differs from the hash recorded at download")
+
         return {
             "id": pdf_name,
             "filename": f"{pdf_name}.pdf",
+            "size_bytes": pdf_path.stat().st_size if pdf_path.exists() else 0,
+            "sha256": sha256,
+            "source_url": provenance.get("source_url", ""),
+            "retrieved_at": provenance.get("retrieved_at"),
+            "retrieval_tool": provenance.get("retrieval_tool", ""),
+            "wayback_url": provenance.get("wayback_url", ""),
+            "response_headers": json.dumps(provenance["response_headers"]) if provenance.get("response_headers") else None,
             "page_count": text_data.get("page_count", 0),
-            "full_text": sanitize_text(text_data.get("full_text", "")),
-            "images": images
+            "blank_page_count": text_data.get(
+                "blank_page_count",
+                sum(1 for p in text_data.get("pages", []) if p.get("is_blank"))
+            ),
+            "full_text": full_text,
+            **text_stats(full_text),
+            "text_source": source,
+            "ocr_confidence": ocr_confidence,
+            "pages": pages,
+            "images": images,
+            "tables": tables,
+            "sprites": sprites
         }
 
     except Exception as e:
@@ -210,8 +456,84 @@ def load_document_data(pdf_name: str, cdn_mapping: dict) -> Optional[dict]:
 # DATABASE INSERTION
 # ============================================================================
 
+def upsert(cursor, table: str, key: tuple, row: dict) -> int:
+    """Update the row matching row's key columns, or insert it, and return
+    its ID. Updating in place keeps the row's ID, which faces and tags refer to."""
+    where = " AND ".join(f'"{col}" = ?' for col in key)
+    existing = cursor.execute(
+        f"SELECT id FROM {table} WHERE {where}", tuple(row[col] for col in key)
+    ).fetchone()
+
+    if existing:
+        assignments = ", ".join(f'"{col}" = ?' for col in row)
+        cursor.execute(f"UPDATE {table} SET {assignments} WHERE id = ?", (*row.values(), existing[0]))
+        return existing[0]
+
+    columns = ", ".join(f'"{col}"' for col in row) + ", created_at"
+    placeholders = ", ".join("?" for _ in row) + ", CURRENT_TIMESTAMP"
+    cursor.execute(f"INSERT INTO {table} ({columns}) VALUES ({placeholders})", tuple(row.values()))
+    return cursor.lastrowid
+
+
+def insert_pages(cursor, doc: dict):
+    """Insert or replace a document's pages"""
+    for page in doc.get("pages", []):
+        cursor.execute('''
+            INSERT OR REPLACE INTO pages (
+                document_id, number, text, ocr_confidence, width, height,
+                rotation, correction_rotation, skew_angle, is_blank, created_at
+            ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+        ''', (
+            doc["id"],
+            page["number"],
+            page["text"],
+            page["ocr_confidence"],
+            page["width"],
+            page["height"],
+            page["rotation"],
+            page["correction_rotation"],
+            page["skew_angle"],
+            1 if page["is_blank"] else 0
+        ))
+
+
+def upsert_images(cursor, doc: dict) -> list:
+    """Upsert a document's images and return their IDs: the same content on
+    the same page is the same image; unhashed images (file missing) are
+    matched by filename"""
+    ids = []
+    for img in doc.get("images", []):
+        key = ("document_id", "page", "sha256") if img["sha256"] else ("document_id", "filename")
+        ids.append(upsert(cursor, "images", key, {
+            "document_id": doc["id"],
+            "page": img["page"],
+            "filename": img["filename"],
+            "cdn_url": img["cdn_url"],
+            "width": img["width"],
+            "height": img["height"],
+            "size_bytes": img["size_bytes"],
+            "format": img["format"],
+            "sha256": img["sha256"],
+            "exif": img["exif"],
+            "has_gps": 1 if img["has_gps"] else 0,
+            "date_taken": img["date_taken"],
+            "sharpness": img["sharpness"],
+            "brightness": img["brightness"],
+            "quality": img["quality"],
+            "is_blank": 1 if img["is_blank"] else 0,
+            "is_color": None if img["is_color"] is None else int(img["is_color"]),
+            "colorfulness": img["colorfulness"],
+            "megapixels": img["megapixels"],
+            "size_class": img["size_class"],
+            "orientation": img["orientation"],
+        }))
+    return ids
+
+
 def insert_documents_batch(documents: list):
-    """Insert a batch of documents into the database"""
+    """Insert a batch of documents into the database. Documents whose source
+    PDF hash matches the stored one are left as they are; images, tables and
+    sprites are upserted, so re-ingesting a document never duplicates them."""
     if not documents:
         return 0, 0
 
@@ -223,40 +545,80 @@ def insert_documents_batch(documents: list):
 
     try:
         for doc in documents:
+            # Unchanged since it was ingested: keyed on the PDF's content hash
+            if doc["sha256"]:
+                stored = cursor.execute("SELECT sha256 FROM documents WHERE id = ?", (doc["id"],)).fetchone()
+                if stored and stored[0] == doc["sha256"]:
+                    continue
+
             # Insert document
             cursor.execute('''
-                INSERT OR REPLACE INTO documents (id, filename, page_count, full_text, updated_at)
-                VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+                INSERT OR REPLACE INTO documents (
+                    id, filename, page_count, blank_page_count,
+                    size_bytes, sha256, source_url, retrieved_at, retrieval_tool,
+                    wayback_url, response_headers, word_count, language,
+                    avg_word_length, reading_ease, text_source, ocr_confidence,
+                    created_at, updated_at
+                ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
+                    COALESCE((SELECT created_at FROM documents WHERE id = ?), CURRENT_TIMESTAMP),
+                    CURRENT_TIMESTAMP)
             ''', (
                 doc["id"],
                 doc["filename"],
                 doc["page_count"],
-                doc["full_text"]
+                doc["blank_page_count"],
+                doc["size_bytes"],
+                doc["sha256"],
+                doc["source_url"],
+                doc["retrieved_at"],
+                doc["retrieval_tool"],
+                doc["wayback_url"],
+                doc["response_headers"],
+                doc["word_count"],
+                doc["language"],
+                doc["avg_word_length"],
+                doc["reading_ease"],
+                doc["text_source"],
+                doc["ocr_confidence"],
+                doc["id"]  # keep the first ingest time on re-import
             ))
             doc_count += 1
 
-            # Insert images
-            for img in doc.get("images", []):
-                cursor.execute('''
-                    INSERT INTO images (
-                        document_id, page, filename, cdn_url, width, height,
-                        size_bytes, format, exif, has_gps, date_taken, page_text
-                    ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-                ''', (
-                    doc["id"],
-                    img["page"],
-                    img["filename"],
-                    img["cdn_url"],
-                    img["width"],
-                    img["height"],
-                    img["size_bytes"],
-                    img["format"],
-                    img["exif"],
-                    1 if img["has_gps"] else 0,
-                    img["date_taken"],
-                    img["page_text"]
-                ))
-                img_count += 1
+            # Full text lives apart from documents, so huge PDFs don't slow
+            # every query on the documents table
+            cursor.execute('''
+                INSERT OR REPLACE INTO document_texts (document_id, text, updated_at)
+                VALUES (?, ?, CURRENT_TIMESTAMP)
+            ''', (doc["id"], doc["full_text"]))
+
+            insert_pages(cursor, doc)
+            img_count += len(upsert_images(cursor, doc))
+
+            # Upsert extracted tables
+            for table in doc.get("tables", []):
+                upsert(cursor, "document_tables", ("document_id", "page", "table_index"), {
+                    "document_id": doc["id"],
+                    "page": table["page"],
+                    "table_index": table["table_index"],
+                    "row_count": table["row_count"],
+                    "column_count": table["column_count"],
+                    "extractor": table["extractor"],
+                    "csv": table["csv"],
+                })
+
+            # Upsert sprite sheets
+            for sprite in doc.get("sprites", []):
+                upsert(cursor, "document_sprites", ("document_id", "sheet"), {
+                    "document_id": doc["id"],
+                    "sheet": sprite["sheet"],
+                    "cdn_url": sprite["cdn_url"],
+                    "tile_width": sprite["tile_width"],
+                    "tile_height": sprite["tile_height"],
+                    "columns": sprite["columns"],
+                    "rows": sprite["rows"],
+                    "first_page": sprite["first_page"],
+                    "page_count": sprite["page_count"],
+                })
 
         conn.commit()
 
@@ -275,15 +637,11 @@ def insert_documents_batch(documents: list):
 # MAIN
 # ============================================================================
 
-def main():
+def main(lock):
     logger.info("=" * 60)
     logger.info("Database Population Script")
     logger.info("=" * 60)
 
-    # Check database exists (created by Go backend)
-    if not init_database():
-        return
-
     # Load CDN mapping
     logger.info("Loading CDN URL mapping...")
     cdn_mapping = load_cdn_mapping()
@@ -341,6 +699,7 @@ def main():
                 batch.append(doc_data)
 
                 if len(batch) >= batch_size:
+                    lock.check()
                     try:
                         docs, imgs = insert_documents_batch(batch)
                         total_docs += docs
@@ -357,6 +716,7 @@ def main():
 
         # Insert remaining batch
         if batch:
+            lock.check()
             try:
                 docs, imgs = insert_documents_batch(batch)
                 total_docs += docs
@@ -386,9 +746,23 @@ def main():
     logger.info(f"  Images with GPS: {stats['images_with_gps']:,}")
 
 
+def strip_stopwords(text: str, pattern) -> str:
+    """Blank out stopwords so they are never indexed"""
+    return pattern.sub(" ", text) if pattern else text
+
+
+def stopword_pattern():
+    """Regex matching the configured FTS stopwords, or None"""
+    if not config.FTS_STOPWORDS:
+        return None
+    alternatives = "|".join(re.escape(w) for w in config.FTS_STOPWORDS)
+    return re.compile(rf"\b(?:{alternatives})\b", re.IGNORECASE)
+
+
 def rebuild_fts():
-    """Rebuild the FTS index from scratch"""
-    logger.info("Rebuilding FTS index...")
+    """Rebuild the FTS index from scratch with the configured tokenizer"""
+    tokenizer = config.fts_tokenizer()
+    logger.info(f"Rebuilding FTS index (tokenize='{tokenizer}', {len(config.FTS_STOPWORDS)} stopwords)...")
 
     conn = sqlite3.connect(config.DATABASE_PATH)
     cursor = conn.cursor()
@@ -399,16 +773,28 @@ def rebuild_fts():
         CREATE VIRTUAL TABLE documents_fts USING fts5(
             document_id,
             full_text,
-            content='documents',
-            content_rowid='rowid'
+            tokenize='{tokenizer}'
         )
+    '''.format(tokenizer=tokenizer))
+
+    # The index keeps its own copy of the text (stopwords removed), so it
+    # can't be an external-content table over document_texts. The backend drops
+    # the same stopwords from queries.
+    stopwords = stopword_pattern()
+
+    rows = conn.execute('''
+        SELECT document_id, text FROM document_texts WHERE text IS NOT NULL AND text != ''
     ''')
+    cursor.executemany(
+        "INSERT INTO documents_fts(document_id, full_text) VALUES (?, ?)",
+        ((doc_id, strip_stopwords(text, stopwords)) for doc_id, text in rows)
+    )
 
-    # Populate FTS from documents
+    # Reported by GET /api/admin/fts/status
     cursor.execute('''
-        INSERT INTO documents_fts(document_id, full_text)
-        SELECT id, full_text FROM documents WHERE full_text IS NOT NULL AND full_text != ''
-    ''')
+        INSERT OR REPLACE INTO meta (key, value, updated_at)
+        VALUES ('fts.last_rebuild', ?, CURRENT_TIMESTAMP)
+    ''', (datetime.utcnow().strftime('%Y-%m-%dT%H:%M:%SZ'),))
 
     conn.commit()
     conn.close()
@@ -416,10 +802,220 @@ def rebuild_fts():
     logger.info("FTS index rebuilt successfully")
 
 
+def backfill_hashes():
+    """Hash source PDFs and images ingested before hashes were recorded"""
+    logger.info("Backfilling file hashes...")
+
+    conn = sqlite3.connect(config.DATABASE_PATH)
+    cursor = conn.cursor()
+
+    cursor.execute("SELECT id, filename FROM documents WHERE sha256 IS NULL OR sha256 = ''")
+    for doc_id, filename in tqdm(cursor.fetchall(), desc="PDFs", unit="doc"):
+        pdf_path = config.download_path(filename)
+        if pdf_path.exists():
+            conn.execute(
+                "UPDATE documents SET size_bytes = ?, sha256 = ? WHERE id = ?",
+                (pdf_path.stat().st_size, file_sha256(pdf_path), doc_id)
+            )
+    conn.commit()
+
+    cursor.execute("SELECT id, document_id, filename FROM images WHERE sha256 IS NULL OR sha256 = ''")
+    for image_id, document_id, filename in tqdm(cursor.fetchall(), desc="Images", unit="img"):
+        digest = file_sha256(config.EXTRACTED_IMAGES / document_id / filename)
+        if digest:
+            conn.execute("UPDATE images SET sha256 = ? WHERE id = ?", (digest, image_id))
+    conn.commit()
+    conn.close()
+
+    logger.info("Hash backfill complete")
+
+
+def backfill_text_stats(everything: bool = False):
+    """Compute text statistics and text sources for documents ingested
+    before they were recorded, or for every document with everything. Text
+    sources, and the OCR confidence of pages, come from the extracted text."""
+    logger.info("Backfilling text statistics...")
+
+    conn = sqlite3.connect(config.DATABASE_PATH)
+    cursor = conn.cursor()
+
+    where = "" if everything else "WHERE word_count IS NULL OR word_count = 0 OR text_source IS NULL OR text_source = ''"
+    cursor.execute(f"SELECT id FROM documents {where}")
+    for (doc_id,) in tqdm(cursor.fetchall(), desc="Documents", unit="doc"):
+        row = conn.execute("SELECT text FROM document_texts WHERE document_id = ?", (doc_id,)).fetchone()
+        stats = text_stats(row[0] if row else "")
+        conn.execute(
+            "UPDATE documents SET word_count = ?, language = ?, avg_word_length = ?, reading_ease = ? WHERE id = ?",
+            (stats["word_count"], stats["language"], stats["avg_word_length"], stats["reading_ease"], doc_id)
+        )
+
+        pages = load_text_data(doc_id).get("pages", [])
+        source, ocr_confidence = text_source(pages)
+        if source:
+            conn.execute(
+                "UPDATE documents SET text_source = ?, ocr_confidence = ? WHERE id = ?",
+                (source, ocr_confidence, doc_id)
+            )
+            conn.executemany(
+                "UPDATE pages SET ocr_confidence = ? WHERE document_id = ? AND number = ?",
+                ((p["ocr_confidence"], doc_id, p.get("page", 1)) for p in pages)
+            )
+    conn.commit()
+    conn.close()
+
+    logger.info("Text statistics backfill complete")
+
+
+def backfill_provenance(wayback: bool = False):
+    """Record provenance sidecars for documents ingested before they were
+    read, and optionally look up Wayback Machine captures of source URLs"""
+    logger.info("Backfilling provenance...")
+
+    conn = sqlite3.connect(config.DATABASE_PATH)
+    cursor = conn.cursor()
+
+    cursor.execute('''
+        SELECT id FROM documents
+        WHERE source_url IS NULL OR source_url = '' OR response_headers IS NULL
+    ''')
+    for (doc_id,) in tqdm(cursor.fetchall(), desc="Sidecars", unit="doc"):
+        provenance = load_provenance(doc_id)
+        if provenance:
+            headers = provenance.get("response_headers")
+            conn.execute(
+                "UPDATE documents SET source_url = ?, retrieved_at = ?, retrieval_tool = ?, wayback_url = ?, response_headers = ? WHERE id = ?",
+                (provenance.get("source_url", ""), provenance.get("retrieved_at"),
+                 provenance.get("retrieval_tool", ""), provenance.get("wayback_url", ""),
+                 json.dumps(headers) if headers else None, doc_id)
+            )
+    conn.commit()
+
+    if wayback:
+        cursor.execute('''
+            SELECT id, source_url FROM documents
+            WHERE source_url != '' AND (wayback_url IS NULL OR wayback_url = '')
+        ''')
+        for doc_id, source_url in tqdm(cursor.fetchall(), desc="Wayback", unit="doc"):
+            capture = wayback_lookup(source_url)
+            if capture:
+                conn.execute("UPDATE documents SET wayback_url = ? WHERE id = ?", (capture, doc_id))
+                conn.commit()
+
+    conn.close()
+    logger.info("Provenance backfill complete")
+
+
+REINGEST_STAGES = ("text", "images")
+
+
+def reingest(pdf_name: str, stages: list) -> bool:
+    """Replace one document's derived rows with its current extraction, in a
+    single transaction: text, pages and its full-text index row with "text",
+    images with "images". Pages and images no longer in the extraction are
+    deleted, faces and tags of deleted images with them. The document's file
+    hash, size and provenance are refreshed either way. Run by the backend's
+    re-ingest job after extract_pdf_content.py reextract."""
+    conn = sqlite3.connect(config.DATABASE_PATH)
+    cursor = conn.cursor()
+    if not cursor.execute("SELECT 1 FROM documents WHERE id = ?", (pdf_name,)).fetchone():
+        logger.error(f"{pdf_name} is not in the database")
+        conn.close()
+        return False
+
+    doc = load_document_data(pdf_name, load_cdn_mapping())
+    if doc is None:
+        logger.error(f"Loading {pdf_name} failed, see db_populate_errors.log")
+        conn.close()
+        return False
+
+    try:
+        cursor.execute('''
+            UPDATE documents SET size_bytes = ?, sha256 = ?, source_url = ?, retrieved_at = ?,
+                retrieval_tool = ?, wayback_url = ?, response_headers = ?, updated_at = CURRENT_TIMESTAMP
+            WHERE id = ?
+        ''', (doc["size_bytes"], doc["sha256"], doc["source_url"], doc["retrieved_at"],
+              doc["retrieval_tool"], doc["wayback_url"], doc["response_headers"], pdf_name))
+
+        if "text" in stages:
+            cursor.execute('''
+                UPDATE documents SET page_count = ?, blank_page_count = ?, word_count = ?, language = ?,
+                    avg_word_length = ?, reading_ease = ?, text_source = ?, ocr_confidence = ?
+                WHERE id = ?
+            ''', (doc["page_count"], doc["blank_page_count"], doc["word_count"], doc["language"],
+                  doc["avg_word_length"], doc["reading_ease"], doc["text_source"], doc["ocr_confidence"], pdf_name))
+            cursor.execute('''
+                INSERT OR REPLACE INTO document_texts (document_id, text, updated_at)
+                VALUES (?, ?, CURRENT_TIMESTAMP)
+            ''', (pdf_name, doc["full_text"]))
+            insert_pages(cursor, doc)
+            cursor.execute("DELETE FROM pages WHERE document_id = ? AND number > ?", (pdf_name, len(doc["pages"])))
+
+            fts = cursor.execute("SELECT 1 FROM sqlite_master WHERE type='table' AND name='documents_fts'").fetchone()
+            if fts:
+                cursor.execute("DELETE FROM documents_fts WHERE document_id = ?", (pdf_name,))
+                if doc["full_text"]:
+                    cursor.execute(
+                        "INSERT INTO documents_fts(document_id, full_text) VALUES (?, ?)",
+                        (pdf_name, strip_stopwords(doc["full_text"], stopword_pattern()))
+                    )
+            logger.info(f"{pdf_name}: {len(doc['pages']):,} pages, {doc['word_count']:,} words")
+
+        if "images" in stages:
+            kept = upsert_images(cursor, doc)
+            stale = [row[0] for row in cursor.execute("SELECT id FROM images WHERE document_id = ?", (pdf_name,))
+                     if row[0] not in kept]
+            for table in ("faces", "image_tags"):
+                cursor.executemany(f"DELETE FROM {table} WHERE image_id = ?", ((i,) for i in stale))
+            cursor.executemany("DELETE FROM images WHERE id = ?", ((i,) for i in stale))
+            logger.info(f"{pdf_name}: {len(kept):,} images, {len(stale):,} removed")
+
+        conn.commit()
+
+    except Exception as e:
+        conn.rollback()
+        logger.error(f"Re-ingesting {pdf_name} failed: {e}")
+        return False
+
+    finally:
+        conn.close()
+
+    return True
+
+
 if __name__ == "__main__":
     import sys
 
-    if len(sys.argv) > 1 and sys.argv[1] == "rebuild-fts":
-        rebuild_fts()
-    else:
-        main()
+    command = sys.argv[1] if len(sys.argv) > 1 else "populate"
+
+    # Check database exists (created by Go backend)
+    if not init_database():
+        sys.exit(1)
+
+    if command == "unlock":
+        unlock()
+        sys.exit()
+
+    try:
+        with ingest_lock(f"populate_db.py {command}") as lock:
+            if command == "rebuild-fts":
+                rebuild_fts()
+            elif command == "backfill-hashes":
+                backfill_hashes()
+            elif command == "backfill-text-stats":
+                backfill_text_stats(everything="--all" in sys.argv[2:])
+            elif command == "backfill-provenance":
+                backfill_provenance(wayback="--wayback" in sys.argv[2:])
+            elif command == "reingest":
+                # reingest <document id> [--stages text,images]
+                if len(sys.argv) < 3:
+                    sys.exit("usage: populate_db.py reingest <document id> [--stages text,images]")
+                stages = list(REINGEST_STAGES)
+                if "--stages" in sys.argv[3:]:
+                    stages = sys.argv[sys.argv.index("--stages") + 1].split(",")
+                if not reingest(sys.argv[2], [s for s in stages if s in REINGEST_STAGES]):
+                    sys.exit(1)
+            else:
+                main(lock)
+    except (IngestLockError, SchemaError) as e:
+        logger.error(str(e))
+        sys.exit(1)
@@ -0,0 +1,84 @@
+"""
+Schema Version
+
+The Go backend records the schema version it migrated the database to
+(meta 'schema.version', models.SchemaVersion in the backend). These scripts
+write that schema directly, so they refuse to run against any other version
+rather than write rows the backend can't read. With BACKEND_URL set, the
+running backend is asked too (GET /api/version), which catches a server still
+on an old build after a newer one migrated the database.
+
+    schema.check()  # raises SchemaError
+"""
+
+import json
+import logging
+import sqlite3
+import urllib.error
+import urllib.request
+
+import config
+
+logger = logging.getLogger(__name__)
+
+SCHEMA_VERSION = 2  # models.SchemaVersion; bump both together
+
+
+class SchemaError(RuntimeError):
+    """The database or backend uses a schema these scripts don't write"""
+
+
+def database_version() -> int:
+    """Schema version recorded in the database; 0 when none is"""
+    conn = sqlite3.connect(config.DATABASE_PATH)
+    try:
+        row = conn.execute("SELECT value FROM meta WHERE key = 'schema.version'").fetchone()
+    except sqlite3.OperationalError:
+        row = None
+    finally:
+        conn.close()
+    return int(row[0]) if row and row[0] else 0
+
+
+def backend_version(url: str) -> dict:
+    """GET /api/version from the backend at url"""
+    try:
+        with urllib.request.urlopen(url.rstrip("/") + "/api/version", timeout=10) as resp:
+            return json.load(resp)
+    except urllib.error.HTTPError as e:
+        if e.code == 404:
+            raise SchemaError(f"The backend at {url} predates /api/version; upgrade it")
+        raise SchemaError(f"Backend version check failed: {e}")
+    except (urllib.error.URLError, OSError, ValueError) as e:
+        raise SchemaError(f"Can't reach the backend at {url}: {e}")
+
+
+def check():
+    """Raise SchemaError unless the database (and backend, when BACKEND_URL is
+    set) are on SCHEMA_VERSION"""
+    stored = database_version()
+    if stored == 0:
+        raise SchemaError(
+            "The database doesn't record a schema version. "
+            "Start the Go backend (or run 'backendctl migrate') to migrate it."
+        )
+    if stored > SCHEMA_VERSION:
+        raise SchemaError(
+            f"The database is on schema version {stored}, these scripts write version {SCHEMA_VERSION}. "
+            "Update the scripts to match the backend."
+        )
+    if stored < SCHEMA_VERSION:
+        raise SchemaError(
+            f"The database is on schema version {stored}, these scripts write version {SCHEMA_VERSION}. "
+            "Upgrade the Go backend and start it (or run 'backendctl migrate') to migrate the database."
+        )
+
+    if not config.BACKEND_URL:
+        return
+    version = backend_version(config.BACKEND_URL)
+    if version.get("schema_version") != SCHEMA_VERSION:
+        raise SchemaError(
+            f"The backend at {config.BACKEND_URL} ({version.get('version')}) is on schema version "
+            f"{version.get('schema_version')}, these scripts write version {SCHEMA_VERSION}"
+        )
+    logger.info(f"Backend {version.get('version')} ({(version.get('commit') or 'unknown')[:12]}) is on schema version {SCHEMA_VERSION}")
@@ -0,0 +1,173 @@
+"""
+Image Object and Scene Tagging
+
+Labels every image with the objects and scenes it shows (aircraft interior,
+beach, office, document scan, ...) so the API can filter and facet on them.
+- Pluggable providers selected with TAGS_PROVIDER
+- Tags are stored with the provider's confidence; those below
+  TAGS_MIN_CONFIDENCE are dropped
+- Skips already tagged images (use --all to retag)
+- Reads image bytes from the local extracted_images folder
+
+Providers:
+  clip  Local zero-shot CLIP model scored against TAGS_VOCABULARY
+        (pip install transformers torch)
+  http  POST image bytes to TAGS_API_URL, expects
+        {"tags": [{"tag": "beach", "confidence": 0.0-1.0}]}
+"""
+
+import io
+import json
+import os
+import sqlite3
+import sys
+import logging
+import urllib.request
+from tqdm import tqdm
+
+import config
+
+logging.basicConfig(
+    level=logging.INFO,
+    format='%(asctime)s - %(levelname)s - %(message)s',
+    handlers=[
+        logging.FileHandler(config.PROJECT_ROOT / "tag_images.log"),
+        logging.StreamHandler()
+    ]
+)
+logger = logging.getLogger(__name__)
+
+TAGS_PROVIDER = os.getenv("TAGS_PROVIDER", "clip")
+TAGS_API_URL = os.getenv("TAGS_API_URL", "")
+TAGS_API_KEY = os.getenv("TAGS_API_KEY", "")
+TAGS_CLIP_MODEL = os.getenv("TAGS_CLIP_MODEL", "openai/clip-vit-base-patch32")
+
+TAGS_MIN_CONFIDENCE = float(os.getenv("TAGS_MIN_CONFIDENCE", "0.2"))
+TAGS_MAX_PER_IMAGE = int(os.getenv("TAGS_MAX_PER_IMAGE", "5"))
+
+# Labels the clip provider chooses from; override with a comma-separated list
+DEFAULT_VOCABULARY = [
+    "aircraft interior", "airplane", "airport", "beach", "boat", "pool",
+    "island", "house exterior", "house interior", "bedroom", "bathroom",
+    "office", "restaurant", "party", "car", "street", "city", "nature",
+    "portrait", "group photo", "document scan", "handwritten note",
+    "typed letter", "receipt", "calendar", "map", "screenshot", "artwork",
+]
+TAGS_VOCABULARY = [
+    t.strip().lower() for t in os.getenv("TAGS_VOCABULARY", "").split(",") if t.strip()
+] or DEFAULT_VOCABULARY
+
+BATCH_SIZE = 200
+
+
+# ============================================================================
+# PROVIDERS
+# ============================================================================
+
+class CLIPProvider:
+    """Zero-shot CLIP; confidences are softmaxed over the vocabulary"""
+    name = "clip"
+
+    def __init__(self):
+        from PIL import Image
+        from transformers import pipeline
+        self.Image = Image
+        self.classifier = pipeline("zero-shot-image-classification", model=TAGS_CLIP_MODEL)
+
+    def tag(self, image_bytes: bytes) -> list:
+        img = self.Image.open(io.BytesIO(image_bytes)).convert("RGB")
+        results = self.classifier(
+            img, candidate_labels=TAGS_VOCABULARY, hypothesis_template="a photo of {}"
+        )
+        return [(r["label"], float(r["score"])) for r in results]
+
+
+class HTTPProvider:
+    """Delegates tagging to an external HTTP service"""
+    name = "http"
+
+    def __init__(self):
+        if not TAGS_API_URL:
+            raise RuntimeError("TAGS_API_URL is required for the http provider")
+
+    def tag(self, image_bytes: bytes) -> list:
+        headers = {"Content-Type": "application/octet-stream"}
+        if TAGS_API_KEY:
+            headers["Authorization"] = f"Bearer {TAGS_API_KEY}"
+        req = urllib.request.Request(TAGS_API_URL, data=image_bytes, headers=headers, method="POST")
+        with urllib.request.urlopen(req, timeout=60) as resp:
+            result = json.loads(resp.read().decode("utf-8"))
+        return [(t["tag"], float(t.get("confidence", 0.0))) for t in result.get("tags", [])]
+
+
+PROVIDERS = {
+    "clip": CLIPProvider,
+    "http": HTTPProvider,
+}
+
+
+def select_tags(scored: list) -> list:
+    """Most confident tags above the threshold, lowercased and deduplicated"""
+    best = {}
+    for tag, confidence in scored:
+        tag = tag.strip().lower()
+        if tag and confidence >= TAGS_MIN_CONFIDENCE and confidence > best.get(tag, -1):
+            best[tag] = confidence
+    ranked = sorted(best.items(), key=lambda kv: kv[1], reverse=True)
+    return ranked[:TAGS_MAX_PER_IMAGE]
+
+
+# ============================================================================
+# MAIN
+# ============================================================================
+
+def main(retag: bool = False):
+    if TAGS_PROVIDER not in PROVIDERS:
+        logger.error(f"Unknown TAGS_PROVIDER '{TAGS_PROVIDER}'. Options: {', '.join(PROVIDERS)}")
+        return
+
+    provider = PROVIDERS[TAGS_PROVIDER]()
+    logger.info(f"Using tag provider: {provider.name}")
+
+    conn = sqlite3.connect(config.DATABASE_PATH)
+    cursor = conn.cursor()
+
+    where = "" if retag else "WHERE tagged_at IS NULL"
+    cursor.execute(f"SELECT id, document_id, filename FROM images {where} ORDER BY id")
+    rows = cursor.fetchall()
+    logger.info(f"Images to tag: {len(rows):,}")
+
+    counts = {"tagged": 0, "tags": 0, "failed": 0}
+    pending = 0
+
+    for image_id, document_id, filename in tqdm(rows, desc="Tagging", unit="img"):
+        path = config.EXTRACTED_IMAGES / document_id / filename
+        try:
+            tags = select_tags(provider.tag(path.read_bytes()))
+        except Exception as e:
+            counts["failed"] += 1
+            logger.debug(f"Failed to tag {path}: {e}")
+            continue
+
+        cursor.execute("DELETE FROM image_tags WHERE image_id = ?", (image_id,))
+        cursor.executemany('''
+            INSERT INTO image_tags (image_id, tag, confidence, provider, created_at)
+            VALUES (?, ?, ?, ?, datetime('now'))
+        ''', [(image_id, tag, round(conf, 4), provider.name) for tag, conf in tags])
+        cursor.execute("UPDATE images SET tagged_at = datetime('now') WHERE id = ?", (image_id,))
+
+        counts["tagged"] += 1
+        counts["tags"] += len(tags)
+        pending += 1
+        if pending >= BATCH_SIZE:
+            conn.commit()
+            pending = 0
+
+    conn.commit()
+    conn.close()
+
+    logger.info(f"Tagging complete: {counts}")
+
+
+if __name__ == "__main__":
+    main(retag="--all" in sys.argv)
@@ -1,7 +1,7 @@
 """
 BunnyCDN Image Uploader
 
-Uploads extracted images to BunnyCDN with:
+Uploads extracted images and page sprite sheets to BunnyCDN with:
 - Skip logic for already uploaded files
 - Retry with exponential backoff
 - Progress checkpointing
@@ -228,6 +228,44 @@ def collect_files_to_upload() -> list:
                     "size_bytes": img_file.stat().st_size
                 })
 
+    # Page thumbnail sprite sheets
+    if config.EXTRACTED_SPRITES.exists():
+        for pdf_folder in config.EXTRACTED_SPRITES.iterdir():
+            if not pdf_folder.is_dir():
+                continue
+
+            for sprite_file in pdf_folder.glob("*.jpg"):
+                local_path = str(sprite_file)
+                if local_path in successful:
+                    continue
+
+                cdn_path = f"sprites/{pdf_folder.name}/{sprite_file.name}"
+                files.append({
+                    "local_path": local_path,
+                    "cdn_path": cdn_path,
+                    "cdn_url": config.get_cdn_url(cdn_path),
+                    "size_bytes": sprite_file.stat().st_size
+                })
+
+    # Dataset README, index and cover letter files (ingest_datasets.py)
+    if config.DATASETS.exists():
+        for dataset_folder in config.DATASETS.iterdir():
+            if not dataset_folder.is_dir() or not dataset_folder.name.isdigit():
+                continue
+
+            for dataset_file in dataset_folder.glob("*"):
+                local_path = str(dataset_file)
+                if not dataset_file.is_file() or dataset_file.name == "dataset.json" or local_path in successful:
+                    continue
+
+                cdn_path = f"datasets/{int(dataset_folder.name)}/{dataset_file.name}"
+                files.append({
+                    "local_path": local_path,
+                    "cdn_path": cdn_path,
+                    "cdn_url": config.get_cdn_url(cdn_path),
+                    "size_bytes": dataset_file.stat().st_size
+                })
+
     return files
 
 